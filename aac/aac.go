@@ -431,7 +431,14 @@ func (v *ADTSImpl) Decode(data []byte) (raw, left []byte, err error) {
 	v.asc.Channels = Channels(channelConfiguration)
 	v.asc.SampleRate = SampleRateIndex(samplingFrequencyIndex)
 
-	nbRaw := int(frameLength - 7)
+	// The frame_length includes the header and the crc_check.
+	nbRaw := int(frameLength) - 7
+	if protectionAbsent == 0 {
+		nbRaw -= 2
+	}
+	if nbRaw < 0 {
+		return nil, nil, errors.Errorf("invalid frame length %v", frameLength)
+	}
 	if len(p) < nbRaw {
 		return nil, nil, errors.Errorf("requires %v but only %v bytes", nbRaw, len(p))
 	}
@@ -451,10 +458,17 @@ func (v *ADTSImpl) ASC() *AudioSpecificConfig {
 
 // Convert the ASC(Audio Specific Configuration).
 // Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @page 33, @section 1.6.2.1 AudioSpecificConfig
+// @remark For HE-AAC, the SampleRate and Channels are of the core AAC-LC, see SBRSignaling.
 type AudioSpecificConfig struct {
 	Object     ObjectType      // AAC object type.
 	SampleRate SampleRateIndex // AAC sample rate, not the FLV sampling rate.
 	Channels   Channels        // AAC channel configuration.
+
+	// The sample rate of SBR for HE-AAC and HE-AACv2, which is the output sample rate,
+	// use the double of SampleRate if zero.
+	ExtensionSampleRate SampleRateIndex
+	// How the SBR and PS are signaled for HE-AAC and HE-AACv2.
+	Signaling SBRSignaling
 }
 
 func (v *AudioSpecificConfig) validate() (err error) {
@@ -471,6 +485,12 @@ func (v *AudioSpecificConfig) validate() (err error) {
 	if v.Channels < ChannelMono || v.Channels > Channel7_1 {
 		return errors.Errorf("invalid channels %#x", uint8(v.Channels))
 	}
+
+	if v.Object == ObjectTypeHE || v.Object == ObjectTypeHEv2 {
+		if sr := v.extensionSampleRate(); sr < SampleRateIndex88kHz || sr > SampleRateIndex7kHz {
+			return errors.Errorf("invalid extension sample-rate %#x", uint8(sr))
+		}
+	}
 	return
 }
 
@@ -478,21 +498,20 @@ func (v *AudioSpecificConfig) UnmarshalBinary(data []byte) (err error) {
 	// AudioSpecificConfig
 	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @page 33, @section 1.6.2.1 AudioSpecificConfig
 	//
-	// only need to decode the first 2bytes:
 	// audioObjectType, 5bits.
 	// samplingFrequencyIndex, aac_sample_rate, 4bits.
 	// channelConfiguration, aac_channels, 4bits
+	// For SBR and PS, the extensionSamplingFrequencyIndex and the sync extensions.
 	//
 	// @see SrsAacTransmuxer::write_audio
 	if len(data) < 2 {
 		return errors.Errorf("requires 2 but only %v bytes", len(data))
 	}
 
-	t0, t1 := uint8(data[0]), uint8(data[1])
-
-	v.Object = ObjectType((t0 >> 3) & 0x1f)
-	v.SampleRate = SampleRateIndex(((t0 << 1) & 0x0e) | ((t1 >> 7) & 0x01))
-	v.Channels = Channels((t1 >> 3) & 0x0f)
+	*v = AudioSpecificConfig{}
+	if err = v.unmarshalExtension(newBitReader(data)); err != nil {
+		return errors.WithMessage(err, "asc")
+	}
 
 	return v.validate()
 }
@@ -505,12 +524,11 @@ func (v *AudioSpecificConfig) MarshalBinary() (data []byte, err error) {
 	// AudioSpecificConfig
 	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @page 33, @section 1.6.2.1 AudioSpecificConfig
 	//
-	// only need to decode the first 2bytes:
 	// audioObjectType, 5bits.
 	// samplingFrequencyIndex, aac_sample_rate, 4bits.
 	// channelConfiguration, aac_channels, 4bits
-	return []byte{
-		byte(byte(v.Object)&0x1f)<<3 | byte(byte(v.SampleRate)&0x0e)>>1,
-		byte(byte(v.SampleRate)&0x01)<<7 | byte(byte(v.Channels)&0x0f)<<3,
-	}, nil
+	// For SBR and PS, the extensionSamplingFrequencyIndex and the sync extensions.
+	bw := &bitWriter{}
+	v.marshalExtension(bw)
+	return bw.Bytes(), nil
 }
@@ -23,7 +23,10 @@ package aac
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"testing"
+	"testing/iotest"
 )
 
 func TestAudioSpecificConfig_MarshalBinary(t *testing.T) {
@@ -65,6 +68,55 @@ func TestAudioSpecificConfig_UnmarshalBinary(t *testing.T) {
 	}
 }
 
+func TestAudioSpecificConfig_SBR(t *testing.T) {
+	pvs := []struct {
+		ps        bool
+		signaling SBRSignaling
+		asc       string
+	}{
+		{false, SBRSignalingHierarchical, "2b920800"},
+		{true, SBRSignalingHierarchical, "eb8a0800"},
+		{false, SBRSignalingBackwardCompatible, "139056e5a0"},
+		{true, SBRSignalingBackwardCompatible, "138856e5a54880"},
+		{false, SBRSignalingImplicit, "1390"},
+	}
+	for _, pv := range pvs {
+		asc, err := NewHEAudioSpecificConfig(SampleRateIndex44kHz, ChannelStereo, pv.ps, pv.signaling)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := asc.MarshalBinary()
+		if err != nil || fmt.Sprintf("%x", b) != pv.asc {
+			t.Errorf("%v ps=%v marshal %x, err is %v", pv.signaling, pv.ps, b, err)
+			continue
+		}
+
+		// The implicit signaling is parsed as AAC-LC.
+		r := &AudioSpecificConfig{}
+		if err = r.UnmarshalBinary(b); err != nil {
+			t.Errorf("%v ps=%v unmarshal %x, err is %v", pv.signaling, pv.ps, b, err)
+		} else if pv.signaling == SBRSignalingImplicit {
+			if r.Object != ObjectTypeLC || r.OutputSampleRate() != 22050 {
+				t.Errorf("implicit got %+v", r)
+			}
+		} else if r.Object != asc.Object || r.Signaling != pv.signaling || r.OutputSampleRate() != 44100 ||
+			r.OutputChannels() != ChannelStereo || r.SampleRate != SampleRateIndex22kHz {
+			t.Errorf("%v ps=%v got %+v", pv.signaling, pv.ps, r)
+		}
+	}
+
+	// The object type only, use the double of sample rate.
+	r := &AudioSpecificConfig{}
+	if err := r.UnmarshalBinary([]byte{0x2b, 0x90}); err != nil || r.Object != ObjectTypeHE || r.OutputSampleRate() != 44100 {
+		t.Errorf("got %+v, err is %v", r, err)
+	}
+
+	if _, err := NewHEAudioSpecificConfig(SampleRateIndex44kHz, ChannelMono, true, SBRSignalingHierarchical); err == nil {
+		t.Error("PS requires stereo")
+	}
+}
+
 func TestAdts_Encode(t *testing.T) {
 	adts, err := NewADTS()
 	if err != nil {
@@ -164,3 +216,73 @@ func TestAdts_Decode4(t *testing.T) {
 		t.Error("decode")
 	}
 }
+
+func TestGapless(t *testing.T) {
+	g, err := ParseITunSMPB(" 00000000 00000840 000001CA 00000000003F31F6 00000000 00000000")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if g.EncoderDelay != 2112 || g.Padding != 458 || g.OriginalSamples != 4141558 {
+		t.Errorf("invalid %+v", g)
+	}
+
+	if p, err := ParseITunSMPB(g.String()); err != nil || *p != *g {
+		t.Errorf("invalid %+v, err %+v", p, err)
+	}
+
+	if _, err := ParseITunSMPB(" 00000000 00000840"); err == nil {
+		t.Error("parse")
+	}
+
+	// The 3 frames of 1024 samples, with 1500 priming and 500 padding.
+	g = &Gapless{EncoderDelay: 1500, Padding: 500}
+	if mediaTime, duration := g.EditList(3072); mediaTime != 1500 || duration != 1072 {
+		t.Errorf("invalid %v %v", mediaTime, duration)
+	}
+
+	pvs := []struct {
+		start    uint64
+		from, to uint32
+	}{
+		{0, 0, 0}, {1024, 476, 1024}, {2048, 0, 524},
+	}
+	for _, pv := range pvs {
+		if from, to := g.Trim(pv.start, 1024, 3072); from != pv.from || to != pv.to {
+			t.Errorf("trim %v got [%v, %v), want [%v, %v)", pv.start, from, to, pv.from, pv.to)
+		}
+	}
+}
+
+func TestADTSReader(t *testing.T) {
+	adts, _ := NewADTS()
+	if err := adts.SetASC([]byte{0x12, 0x10}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The frames with junk bytes, the partial frame at end is discarded.
+	var stream []byte
+	for i, junk := range [][]byte{nil, {0x00, 0xff, 0x01}, {0xff}, nil} {
+		frame, _ := adts.Encode(bytes.Repeat([]byte{byte(i)}, 10+i))
+		stream = append(append(stream, junk...), frame...)
+	}
+	frame, _ := adts.Encode([]byte{0x05, 0x05})
+	stream = append(stream, frame[:5]...)
+
+	r := NewADTSReader(iotest.OneByteReader(bytes.NewReader(stream)))
+	for i := 0; i < 4; i++ {
+		raw, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, bytes.Repeat([]byte{byte(i)}, 10+i)) {
+			t.Errorf("frame %v is %x", i, raw)
+		}
+	}
+	if _, err := r.ReadFrame(); err != io.EOF {
+		t.Errorf("should EOF, err is %v", err)
+	}
+
+	if r.Skipped() != 4 || r.ASC().SampleRate != SampleRateIndex44kHz {
+		t.Errorf("skipped %v, asc %+v", r.Skipped(), r.ASC())
+	}
+}
@@ -0,0 +1,266 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The SBR and PS signaling of AudioSpecificConfig, for HE-AAC and HE-AACv2.
+package aac
+
+import (
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// How the SBR and PS are signaled in ASC.
+// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @page 33, @section 1.6.5 Signaling of SBR
+type SBRSignaling uint8
+
+const (
+	// The explicit hierarchical signaling, the object type is HE or HEv2, follows by the
+	// extension sample rate and the core object type.
+	SBRSignalingHierarchical SBRSignaling = iota
+	// The explicit backward compatible signaling, the object type is LC, and the SBR and
+	// PS are in the sync extensions, so the legacy decoder plays the core AAC-LC.
+	SBRSignalingBackwardCompatible
+	// The implicit signaling, only the core AAC-LC in ASC, the decoder detects the SBR
+	// and PS in bitstream.
+	SBRSignalingImplicit
+)
+
+func (v SBRSignaling) String() string {
+	switch v {
+	case SBRSignalingHierarchical:
+		return "Hierarchical"
+	case SBRSignalingBackwardCompatible:
+		return "BackwardCompatible"
+	case SBRSignalingImplicit:
+		return "Implicit"
+	default:
+		return "Forbidden"
+	}
+}
+
+// The syncExtensionType of SBR and PS.
+const (
+	syncExtensionTypeSBR = 0x2b7
+	syncExtensionTypePS  = 0x548
+)
+
+// Create the ASC of HE-AAC, or HE-AACv2 if ps, by the output sample rate and channels.
+// The core AAC-LC is of the half sample rate, and it's mono for HE-AACv2 because of PS.
+func NewHEAudioSpecificConfig(sampleRate SampleRateIndex, channels Channels, ps bool, signaling SBRSignaling) (*AudioSpecificConfig, error) {
+	v := &AudioSpecificConfig{
+		Object: ObjectTypeHE, SampleRate: sampleRate + 3, Channels: channels,
+		ExtensionSampleRate: sampleRate, Signaling: signaling,
+	}
+
+	if ps {
+		if channels != ChannelStereo {
+			return nil, errors.Errorf("PS requires stereo, got %v", channels)
+		}
+		v.Object, v.Channels = ObjectTypeHEv2, ChannelMono
+	}
+
+	if err := v.validate(); err != nil {
+		return nil, errors.WithMessage(err, "he-aac")
+	}
+	return v, nil
+}
+
+// The output sample rate in Hz, which is the extension sample rate for HE-AAC.
+func (v *AudioSpecificConfig) OutputSampleRate() int {
+	if v.Object == ObjectTypeHE || v.Object == ObjectTypeHEv2 {
+		return v.extensionSampleRate().ToHz()
+	}
+	return v.SampleRate.ToHz()
+}
+
+// The output channels, which is stereo for HE-AACv2 of mono core, because of PS.
+func (v *AudioSpecificConfig) OutputChannels() Channels {
+	if v.Object == ObjectTypeHEv2 && v.Channels == ChannelMono {
+		return ChannelStereo
+	}
+	return v.Channels
+}
+
+// The extension sample rate, use double of the core if not set.
+func (v *AudioSpecificConfig) extensionSampleRate() SampleRateIndex {
+	if v.ExtensionSampleRate == SampleRateIndex96kHz && v.SampleRate >= SampleRateIndex48kHz {
+		return v.SampleRate - 3
+	}
+	return v.ExtensionSampleRate
+}
+
+// Parse the ASC with the SBR and PS signaling.
+func (v *AudioSpecificConfig) unmarshalExtension(br *bitReader) (err error) {
+	object := readObjectType(br)
+	v.SampleRate, v.Channels = readSampleRate(br), Channels(br.read(4))
+
+	// The explicit hierarchical signaling, the core object type follows.
+	if object == ObjectTypeHE || object == ObjectTypeHEv2 {
+		v.Object, v.Signaling = object, SBRSignalingHierarchical
+
+		// Some encoders only write the object type, use the default extension sample rate.
+		if br.err == nil && br.left() >= 9 {
+			v.ExtensionSampleRate = readSampleRate(br)
+			readObjectType(br)
+		}
+		return br.err
+	}
+	v.Object = object
+
+	// The GASpecificConfig, the frameLengthFlag, dependsOnCoreCoder and extensionFlag.
+	// Refer to @doc ISO_IEC_14496-3-AAC-2001.pdf, @page 482, @section 4.4.1 GA specific configuration
+	if object == ObjectTypeMain || object == ObjectTypeLC || object == ObjectTypeSSR {
+		br.read(1)
+		if br.read(1) == 1 {
+			br.read(14)
+		}
+		br.read(1)
+	}
+	if br.err != nil {
+		return br.err
+	}
+
+	// The explicit backward compatible signaling, in the sync extensions.
+	if br.left() < 16 || br.read(11) != syncExtensionTypeSBR {
+		return nil
+	}
+	if readObjectType(br) != ObjectTypeHE || br.read(1) != 1 {
+		return br.err
+	}
+
+	v.Object, v.Signaling = ObjectTypeHE, SBRSignalingBackwardCompatible
+	v.ExtensionSampleRate = readSampleRate(br)
+
+	if br.left() >= 12 && br.read(11) == syncExtensionTypePS && br.read(1) == 1 {
+		v.Object = ObjectTypeHEv2
+	}
+	return br.err
+}
+
+// Marshal the ASC with the SBR and PS signaling.
+func (v *AudioSpecificConfig) marshalExtension(bw *bitWriter) {
+	object, signaling := v.Object, v.Signaling
+	if object != ObjectTypeHE && object != ObjectTypeHEv2 {
+		signaling = SBRSignalingImplicit
+	}
+
+	switch signaling {
+	case SBRSignalingHierarchical:
+		bw.write(uint32(object), 5)
+		bw.write(uint32(v.SampleRate), 4)
+		bw.write(uint32(v.Channels), 4)
+		bw.write(uint32(v.extensionSampleRate()), 4)
+		bw.write(uint32(ObjectTypeLC), 5)
+		// The GASpecificConfig, all zero.
+		bw.write(0, 3)
+	default:
+		if object == ObjectTypeHE || object == ObjectTypeHEv2 {
+			object = ObjectTypeLC
+		}
+		bw.write(uint32(object), 5)
+		bw.write(uint32(v.SampleRate), 4)
+		bw.write(uint32(v.Channels), 4)
+		bw.write(0, 3)
+	}
+
+	if signaling != SBRSignalingBackwardCompatible {
+		return
+	}
+
+	bw.write(syncExtensionTypeSBR, 11)
+	bw.write(uint32(ObjectTypeHE), 5)
+	bw.write(1, 1)
+	bw.write(uint32(v.extensionSampleRate()), 4)
+
+	if v.Object == ObjectTypeHEv2 {
+		bw.write(syncExtensionTypePS, 11)
+		bw.write(1, 1)
+	}
+}
+
+// Read the audioObjectType, 5bits, or 6bits more for escape.
+func readObjectType(br *bitReader) ObjectType {
+	if t := br.read(5); t != 31 {
+		return ObjectType(t)
+	}
+	return ObjectType(32 + br.read(6))
+}
+
+// Read the samplingFrequencyIndex, the explicit frequency is not supported.
+func readSampleRate(br *bitReader) SampleRateIndex {
+	sr := SampleRateIndex(br.read(4))
+	if sr == 0x0f && br.err == nil {
+		br.err = errors.New("explicit sample rate not supported")
+	}
+	return sr
+}
+
+// The bit reader in MSB order, the read returns 0 after error.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+// The number of bits left.
+func (v *bitReader) left() int {
+	return len(v.data)*8 - v.pos
+}
+
+func (v *bitReader) read(n int) (r uint32) {
+	if v.err != nil {
+		return 0
+	}
+	if v.left() < n {
+		v.err = errors.Errorf("requires %v bits but only %v", n, v.left())
+		return 0
+	}
+
+	for i := 0; i < n; i++ {
+		r = r<<1 | uint32(v.data[v.pos/8]>>uint(7-v.pos%8))&0x01
+		v.pos++
+	}
+	return
+}
+
+// The bit writer in MSB order.
+type bitWriter struct {
+	data []byte
+	pos  int
+}
+
+func (v *bitWriter) write(value uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if v.pos%8 == 0 {
+			v.data = append(v.data, 0)
+		}
+		v.data[v.pos/8] |= byte(value>>uint(i)&0x01) << uint(7-v.pos%8)
+		v.pos++
+	}
+}
+
+// The bytes written, padding with zero bits.
+func (v *bitWriter) Bytes() []byte {
+	return v.data
+}
@@ -24,6 +24,7 @@ package aac_test
 import (
 	"fmt"
 	"github.com/ossrs/go-oryx-lib/aac"
+	"net/http"
 )
 
 func ExampleADTSImpl_Decode() {
@@ -68,3 +69,24 @@ func ExampleADTSImpl_Encode() {
 	// Use the ADTS data.
 	_ = data
 }
+
+func ExampleADTSReader() {
+	// The AAC stream over HTTP, the frames are split across reads.
+	res, err := http.Get("http://127.0.0.1:8080/live/livestream.aac")
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	r := aac.NewADTSReader(res.Body)
+	for {
+		raw, err := r.ReadFrame()
+		if err != nil {
+			fmt.Println(fmt.Sprintf("APP: Read frame failed, err is %+v", err))
+			return
+		}
+
+		// Use the RAW frame and the asc, the raw is valid until next read.
+		_, _ = raw, r.ASC()
+	}
+}
@@ -0,0 +1,120 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The gapless information of AAC, the encoder delay(priming) and padding samples.
+package aac
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/errors"
+	"strconv"
+	"strings"
+)
+
+// Get the number of PCM samples of each AAC frame, which is 1024 for AAC-LC,
+// and 2048 for HE-AAC because of the SBR.
+func (v *AudioSpecificConfig) FrameSamples() int {
+	if v.Object == ObjectTypeHE || v.Object == ObjectTypeHEv2 {
+		return 2048
+	}
+	return 1024
+}
+
+// The gapless information, all in samples, to trim the decoded audio, so the
+// audio starts and ends without the silence or clicks.
+type Gapless struct {
+	// The priming samples at the start, inserted by encoder.
+	EncoderDelay uint32
+	// The padding samples at the end, to fill the last frame.
+	Padding uint32
+	// The number of samples of the original audio, 0 if unknown.
+	OriginalSamples uint64
+}
+
+// Parse the iTunSMPB of iTunes metadata, which is hex fields separated by space:
+//		" 00000000 00000840 000001CA 00000000003F31F6 00000000 ..."
+// where the fields are reserved, encoder delay, padding and original samples.
+func ParseITunSMPB(s string) (v *Gapless, err error) {
+	fields := strings.Fields(s)
+	if len(fields) < 4 {
+		return nil, errors.Errorf("requires 4 but only %v fields", len(fields))
+	}
+
+	var delay, padding, samples uint64
+	if delay, err = strconv.ParseUint(fields[1], 16, 32); err != nil {
+		return nil, errors.Wrapf(err, "parse delay %v", fields[1])
+	}
+	if padding, err = strconv.ParseUint(fields[2], 16, 32); err != nil {
+		return nil, errors.Wrapf(err, "parse padding %v", fields[2])
+	}
+	if samples, err = strconv.ParseUint(fields[3], 16, 64); err != nil {
+		return nil, errors.Wrapf(err, "parse samples %v", fields[3])
+	}
+
+	return &Gapless{EncoderDelay: uint32(delay), Padding: uint32(padding), OriginalSamples: samples}, nil
+}
+
+// Format to iTunSMPB, to write in the metadata.
+func (v *Gapless) String() string {
+	return fmt.Sprintf(" 00000000 %08X %08X %016X 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000",
+		v.EncoderDelay, v.Padding, v.OriginalSamples)
+}
+
+// Get the valid samples, where total is the samples of all decoded frames.
+// @remark Use the OriginalSamples if known.
+func (v *Gapless) Duration(total uint64) uint64 {
+	if v.OriginalSamples > 0 {
+		return v.OriginalSamples
+	}
+
+	trimmed := uint64(v.EncoderDelay) + uint64(v.Padding)
+	if total <= trimmed {
+		return 0
+	}
+	return total - trimmed
+}
+
+// Get the edit list for MP4, which is the media_time and segment_duration of elst,
+// in samples, where total is the samples of all frames.
+func (v *Gapless) EditList(total uint64) (mediaTime int64, duration uint64) {
+	return int64(v.EncoderDelay), v.Duration(total)
+}
+
+// Trim the decoded frame, where start is the index of first sample of frame,
+// count is the samples of frame, and total is the samples of all frames.
+// @return The range [from, to) of frame to keep, empty if from equals to.
+func (v *Gapless) Trim(start uint64, count uint32, total uint64) (from, to uint32) {
+	begin := uint64(v.EncoderDelay)
+	end := begin + v.Duration(total)
+
+	first, last := start, start+uint64(count)
+	if first < begin {
+		first = begin
+	}
+	if last > end {
+		last = end
+	}
+
+	if first >= last {
+		return 0, 0
+	}
+	return uint32(first - start), uint32(last - start)
+}
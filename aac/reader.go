@@ -0,0 +1,159 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The ADTS stream reader, to read the raw AAC frames from network stream.
+package aac
+
+import (
+	"github.com/ossrs/go-oryx-lib/errors"
+	"io"
+)
+
+// The size of ADTS header, without and with the crc_check.
+const (
+	adtsHeaderSize    = 7
+	adtsHeaderCRCSize = 9
+)
+
+// The ADTSReader reads the ADTS stream, such as the AAC over HTTP or TCP, which re-assembles
+// the frames split across reads, and skips the junk bytes before syncword.
+// @remark The raw frame is valid until next ReadFrame.
+type ADTSReader struct {
+	r    io.Reader
+	adts ADTS
+	// The bytes read but not consumed.
+	buf []byte
+	// The bytes of buf consumed by last frame.
+	consumed int
+	// The number of junk bytes skipped.
+	skipped uint64
+}
+
+func NewADTSReader(r io.Reader) *ADTSReader {
+	return &ADTSReader{r: r, adts: &ADTSImpl{}}
+}
+
+// Get the ASC of last frame, to build the sequence header.
+func (v *ADTSReader) ASC() *AudioSpecificConfig {
+	return v.adts.ASC()
+}
+
+// Get the number of junk bytes skipped.
+func (v *ADTSReader) Skipped() uint64 {
+	return v.skipped
+}
+
+// Read the next raw AAC frame, io.EOF when stream ends.
+// @remark The partial frame at end of stream is discarded, and io.EOF returned.
+func (v *ADTSReader) ReadFrame() (raw []byte, err error) {
+	v.buf, v.consumed = v.buf[v.consumed:], 0
+
+	for {
+		// Skip the junk bytes until syncword.
+		if pos := adtsSyncword(v.buf); pos > 0 {
+			v.skip(pos)
+		}
+
+		if len(v.buf) >= adtsHeaderSize && adtsSyncword(v.buf) == 0 {
+			headerSize, frameLength := adtsFrameLength(v.buf)
+
+			// The frame length is corrupt, it's not a syncword.
+			if frameLength <= headerSize {
+				v.skip(1)
+				continue
+			}
+
+			if len(v.buf) >= frameLength {
+				var left []byte
+				if raw, left, err = v.adts.Decode(v.buf[:frameLength]); err != nil || len(left) != 0 {
+					v.skip(1)
+					continue
+				}
+
+				v.consumed = frameLength
+				return raw, nil
+			}
+		}
+
+		if err = v.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Discard n bytes of buffer as junk.
+func (v *ADTSReader) skip(n int) {
+	v.buf = v.buf[n:]
+	v.skipped += uint64(n)
+}
+
+// Read more bytes to buffer.
+func (v *ADTSReader) fill() error {
+	// Grow the buffer, which also drops the consumed bytes.
+	if cap(v.buf)-len(v.buf) < 4096 {
+		b := make([]byte, len(v.buf), 2*len(v.buf)+4096)
+		copy(b, v.buf)
+		v.buf = b
+	}
+
+	n, err := v.r.Read(v.buf[len(v.buf):cap(v.buf)])
+	v.buf = v.buf[:len(v.buf)+n]
+
+	if n > 0 {
+		return nil
+	}
+	if err == nil {
+		return io.ErrNoProgress
+	}
+	if err != io.EOF {
+		return errors.Wrap(err, "read adts")
+	}
+	return err
+}
+
+// Get the position of syncword 0xFFF with layer 0, len(b) if not found, or the last
+// byte is 0xff which might be the syncword.
+func adtsSyncword(b []byte) int {
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0xff {
+			continue
+		}
+		if i == len(b)-1 {
+			return i
+		}
+		if b[i+1]&0xf6 == 0xf0 {
+			return i
+		}
+	}
+	return len(b)
+}
+
+// Get the size of header and the aac_frame_length, the b must be 7+ bytes.
+// Refer to @doc ISO_IEC_13818-7-AAC-2004.pdf, @page 27, @section 6.2.2 Variable Header of ADTS
+func adtsFrameLength(b []byte) (headerSize, frameLength int) {
+	headerSize = adtsHeaderSize
+	if b[1]&0x01 == 0 {
+		headerSize = adtsHeaderCRCSize
+	}
+
+	frameLength = int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5]>>5)
+	return
+}
@@ -30,6 +30,7 @@ import (
 	oe "github.com/ossrs/go-oryx-lib/errors"
 	"math"
 	"sync"
+	"unicode/utf8"
 )
 
 // Please read @doc amf0_spec_121207.pdf, @page 4, @section 2.1 Types Overview
@@ -124,6 +125,26 @@ type Amf0 interface {
 	amf0Marker() marker
 }
 
+// The AMF0 which can marshal to the end of a buffer, to avoid allocation when
+// marshal many AMF0 to a reused buffer.
+type Appender interface {
+	// Append the marshaled bytes to dst and return the extended buffer.
+	AppendBinary(dst []byte) ([]byte, error)
+}
+
+// Append the marshaled bytes of AMF0 a to dst, use the AppendBinary if a is an Appender.
+func Append(dst []byte, a Amf0) ([]byte, error) {
+	if v, ok := a.(Appender); ok {
+		return v.AppendBinary(dst)
+	}
+
+	pb, err := a.MarshalBinary()
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, pb...), nil
+}
+
 // Discovery the amf0 object from the bytes b.
 func Discovery(p []byte) (a Amf0, err error) {
 	if len(p) < 1 {
@@ -182,16 +203,13 @@ func (v *amf0UTF8) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *amf0UTF8) MarshalBinary() (data []byte, err error) {
-	data = make([]byte, v.Size())
+	return v.AppendBinary(make([]byte, 0, v.Size()))
+}
 
+func (v *amf0UTF8) AppendBinary(dst []byte) (data []byte, err error) {
 	size := uint16(len(string(*v)))
-	data[0] = byte(size >> 8)
-	data[1] = byte(size)
-
-	if size > 0 {
-		copy(data[2:], []byte(*v))
-	}
-
+	data = append(dst, byte(size>>8), byte(size))
+	data = append(data, string(*v)...)
 	return
 }
 
@@ -226,10 +244,15 @@ func (v *Number) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *Number) MarshalBinary() (data []byte, err error) {
-	data = make([]byte, 9)
-	data[0] = byte(markerNumber)
+	return v.AppendBinary(make([]byte, 0, 9))
+}
+
+func (v *Number) AppendBinary(dst []byte) (data []byte, err error) {
 	f := math.Float64bits(float64(*v))
-	binary.BigEndian.PutUint64(data[1:], f)
+	data = append(dst, byte(markerNumber),
+		byte(f>>56), byte(f>>48), byte(f>>40), byte(f>>32),
+		byte(f>>24), byte(f>>16), byte(f>>8), byte(f),
+	)
 	return
 }
 
@@ -268,14 +291,15 @@ func (v *String) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *String) MarshalBinary() (data []byte, err error) {
+	return v.AppendBinary(make([]byte, 0, v.Size()))
+}
+
+func (v *String) AppendBinary(dst []byte) (data []byte, err error) {
 	u := amf0UTF8(*v)
 
-	var pb []byte
-	if pb, err = u.MarshalBinary(); err != nil {
+	if data, err = u.AppendBinary(append(dst, byte(markerString))); err != nil {
 		return nil, oe.WithMessage(err, "utf8")
 	}
-
-	data = append([]byte{byte(markerString)}, pb...)
 	return
 }
 
@@ -308,6 +332,71 @@ func (v *objectEOF) MarshalBinary() (data []byte, err error) {
 	return []byte{0, 0, 9}, nil
 }
 
+func (v *objectEOF) AppendBinary(dst []byte) (data []byte, err error) {
+	return append(dst, 0, 0, 9), nil
+}
+
+// The policy for duplicated property names when unmarshal object and ecma array,
+// because different servers disagree about it.
+type DuplicatePolicy uint8
+
+const (
+	// Use the last value, but keep the order of the first one.
+	DuplicateKeepLast DuplicatePolicy = iota
+	// Use the first value, ignore the others.
+	DuplicateKeepFirst
+	// Fail to unmarshal.
+	DuplicateError
+)
+
+func (v DuplicatePolicy) String() string {
+	switch v {
+	case DuplicateKeepLast:
+		return "KeepLast"
+	case DuplicateKeepFirst:
+		return "KeepFirst"
+	case DuplicateError:
+		return "Error"
+	default:
+		return "Unknown"
+	}
+}
+
+// The decoder with options to unmarshal AMF0, which are applied to the nested objects,
+// for example, (&Decoder{Duplicates: DuplicateError}).Unmarshal(p). The UnmarshalBinary
+// of values uses the zero value of decoder.
+// @remark It's safe for concurrent use, if the options are not changed.
+type Decoder struct {
+	// The policy for duplicated property names, default to DuplicateKeepLast.
+	Duplicates DuplicatePolicy
+	// Whether validate the property names, which must be valid UTF-8.
+	ValidateUTF8 bool
+}
+
+// The decoder used by UnmarshalBinary of values.
+var defaultDecoder = &Decoder{}
+
+// Discovery and unmarshal the AMF0 value from p, with the options of decoder.
+func (v *Decoder) Unmarshal(p []byte) (a Amf0, err error) {
+	if a, err = Discovery(p); err != nil {
+		return nil, oe.WithMessage(err, "discovery")
+	}
+
+	if ob, ok := a.(objectDecoder); ok {
+		ob.setDecoder(v)
+	}
+
+	if err = a.UnmarshalBinary(p); err != nil {
+		return nil, oe.WithMessage(err, "unmarshal")
+	}
+	return
+}
+
+// The object which unmarshal the properties by decoder.
+type objectDecoder interface {
+	setDecoder(d *Decoder)
+}
+
 // Use array for object and ecma array, to keep the original order.
 type property struct {
 	key   amf0UTF8
@@ -318,6 +407,29 @@ type property struct {
 type objectBase struct {
 	properties []*property
 	lock       sync.Mutex
+	// The decoder to unmarshal properties, nil to use the default decoder.
+	decoder *Decoder
+	// The bytes of duplicated properties dropped by unmarshal.
+	dropped int
+}
+
+func (v *objectBase) setDecoder(d *Decoder) {
+	v.decoder = d
+}
+
+func (v *objectBase) droppedSize() int {
+	return v.dropped
+}
+
+// The bytes consumed by unmarshal a, which is larger than the size of a when the
+// duplicated properties are dropped.
+func unmarshaledSize(a Amf0) int {
+	if ob, ok := a.(interface {
+		droppedSize() int
+	}); ok {
+		return a.Size() + ob.droppedSize()
+	}
+	return a.Size()
 }
 
 func (v *objectBase) Size() int {
@@ -368,6 +480,56 @@ func (v *objectBase) Set(key string, value Amf0) *objectBase {
 	return v
 }
 
+// Delete the property of key, nothing happens if not exists.
+func (v *objectBase) Delete(key string) *objectBase {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for i, p := range v.properties {
+		if string(p.key) == key {
+			v.properties = append(v.properties[:i], v.properties[i+1:]...)
+			break
+		}
+	}
+
+	return v
+}
+
+// Get the keys of properties, in the original order.
+func (v *objectBase) Keys() []string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	keys := make([]string, 0, len(v.properties))
+	for _, p := range v.properties {
+		keys = append(keys, string(p.key))
+	}
+
+	return keys
+}
+
+// Get the number of properties.
+func (v *objectBase) Len() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return len(v.properties)
+}
+
+// Copy the properties to dst, the values are shared.
+func (v *objectBase) copyTo(dst *objectBase) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	dst.lock.Lock()
+	defer dst.lock.Unlock()
+
+	dst.properties = make([]*property, 0, len(v.properties))
+	for _, p := range v.properties {
+		dst.properties = append(dst.properties, &property{key: p.key, value: p.value})
+	}
+}
+
 func (v *objectBase) unmarshal(p []byte, eof bool, maxElems int) (err error) {
 	// if no eof, elems specified by maxElems.
 	if !eof && maxElems < 0 {
@@ -378,17 +540,32 @@ func (v *objectBase) unmarshal(p []byte, eof bool, maxElems int) (err error) {
 		return oe.Errorf("maxElems=%v with eof", maxElems)
 	}
 
+	d := v.decoder
+	if d == nil {
+		d = defaultDecoder
+	}
+	v.dropped = 0
+
 	readOne := func() (amf0UTF8, Amf0, error) {
 		var u amf0UTF8
 		if err = u.UnmarshalBinary(p); err != nil {
 			return "", nil, oe.WithMessage(err, "prop name")
 		}
 
+		if d.ValidateUTF8 && !utf8.ValidString(string(u)) {
+			return "", nil, oe.Errorf("prop name %q is not UTF-8", string(u))
+		}
+
 		p = p[u.Size():]
 		var a Amf0
 		if a, err = Discovery(p); err != nil {
 			return "", nil, oe.WithMessage(err, fmt.Sprintf("discover prop %v", string(u)))
 		}
+
+		// The nested objects use the same decoder.
+		if ob, ok := a.(objectDecoder); ok {
+			ob.setDecoder(d)
+		}
 		return u, a, nil
 	}
 
@@ -398,8 +575,23 @@ func (v *objectBase) unmarshal(p []byte, eof bool, maxElems int) (err error) {
 			return oe.WithMessage(err, fmt.Sprintf("unmarshal prop %v", string(u)))
 		}
 
+		n := unmarshaledSize(a)
+		p = p[n:]
+
+		// For object and ecma array, apply the policy for duplicated names.
+		if old := v.Get(string(u)); eof && old != nil {
+			switch d.Duplicates {
+			case DuplicateKeepFirst:
+				v.dropped += u.Size() + n
+				return nil
+			case DuplicateError:
+				return oe.Errorf("duplicated prop %v", string(u))
+			default:
+				v.dropped += u.Size() + unmarshaledSize(old)
+			}
+		}
+
 		v.Set(string(u), a)
-		p = p[a.Size():]
 		return nil
 	}
 
@@ -584,6 +776,50 @@ func (v *EcmaArray) MarshalBinary() (data []byte, err error) {
 	return b.Bytes(), nil
 }
 
+// Convert to object, the properties and order are kept, and the values are shared.
+// For example, some peers send onMetaData as EcmaArray, others as Object.
+func (v *EcmaArray) ToObject() *Object {
+	o := NewObject()
+	v.copyTo(&o.objectBase)
+	return o
+}
+
+// Convert to ecma array, the properties and order are kept, and the values are shared.
+// @remark The count of ecma array is set to the number of properties.
+func (v *Object) ToEcmaArray() *EcmaArray {
+	a := NewEcmaArray()
+	v.copyTo(&a.objectBase)
+	a.count = uint32(a.Len())
+	return a
+}
+
+// The key-value AMF0 structure, the Object and EcmaArray, to access the properties
+// without type switches, for example, the onMetaData.
+type KeyValues interface {
+	Amf0
+	// Get the value of key, nil if not exists.
+	Get(key string) Amf0
+	// Set the value of key, overwrite if exists.
+	Set(key string, value Amf0) *objectBase
+	// Delete the property of key.
+	Delete(key string) *objectBase
+	// Get the keys in the original order.
+	Keys() []string
+	// Get the number of properties.
+	Len() int
+}
+
+// Get the key-values of a, which must be an Object or EcmaArray.
+func ToKeyValues(a Amf0) (KeyValues, bool) {
+	switch a := a.(type) {
+	case *Object:
+		return a, true
+	case *EcmaArray:
+		return a, true
+	}
+	return nil, false
+}
+
 // The AMF0 strict array, please read @doc amf0_spec_121207.pdf, @page 7, @section 2.12 Strict Array Type
 type StrictArray struct {
 	objectBase
@@ -675,6 +911,10 @@ func (v *singleMarkerObject) MarshalBinary() (data []byte, err error) {
 	return []byte{byte(v.target)}, nil
 }
 
+func (v *singleMarkerObject) AppendBinary(dst []byte) (data []byte, err error) {
+	return append(dst, byte(v.target)), nil
+}
+
 // The AMF0 null, please read @doc amf0_spec_121207.pdf, @page 6, @section 2.7 null Type
 type null struct {
 	singleMarkerObject
@@ -730,9 +970,13 @@ func (v *Boolean) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *Boolean) MarshalBinary() (data []byte, err error) {
+	return v.AppendBinary(make([]byte, 0, 2))
+}
+
+func (v *Boolean) AppendBinary(dst []byte) (data []byte, err error) {
 	var b byte
 	if *v {
 		b = 1
 	}
-	return []byte{byte(markerBoolean), b}, nil
+	return append(dst, byte(markerBoolean), b), nil
 }
@@ -24,6 +24,7 @@ package amf0
 import (
 	"bytes"
 	"encoding"
+	"encoding/json"
 	oe "github.com/ossrs/go-oryx-lib/errors"
 	"testing"
 )
@@ -566,6 +567,17 @@ func TestAmf0ObjectBase_Set(t *testing.T) {
 	}
 }
 
+func TestAmf0ObjectBase_Delete(t *testing.T) {
+	o := &objectBase{}
+	o.Set("name", NewString("oryx")).Set("years", NewNumber(4)).Delete("name").Delete("none")
+	if v := o.Get("name"); v != nil {
+		t.Error("should deleted")
+	}
+	if v := o.Get("years"); v == nil || len(o.properties) != 1 {
+		t.Error("invalid properties")
+	}
+}
+
 func TestAmf0Object_Size(t *testing.T) {
 	if v := NewObject(); v.Size() != 1+3 {
 		t.Errorf("invalid size %v", v.Size())
@@ -868,3 +880,400 @@ func TestAmf0Boolean_UnmarshalBinary2(t *testing.T) {
 		}
 	}
 }
+
+func TestAmf0ObjectBase_Duplicates(t *testing.T) {
+	csk := amf0UTF8("name")
+	cs := NewString("oryx")
+	cs2 := NewString("srs")
+	cnk := amf0UTF8("years")
+	cn := NewNumber(4)
+	eof := &objectEOF{}
+	b := concat(&csk, cs, &cnk, cn, &csk, cs2, eof)
+
+	pvs := []struct {
+		policy DuplicatePolicy
+		value  string
+		err    bool
+	}{
+		{DuplicateKeepLast, "srs", false},
+		{DuplicateKeepFirst, "oryx", false},
+		{DuplicateError, "", true},
+	}
+	for _, pv := range pvs {
+		v := &objectBase{decoder: &Decoder{Duplicates: pv.policy}}
+		err := v.unmarshal(b, true, -1)
+		if pv.err {
+			if err == nil {
+				t.Errorf("should error for %v", pv.policy)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unmarshal %v err %+v", pv.policy, err)
+		} else if len(v.properties) != 2 || string(v.properties[0].key) != "name" {
+			t.Errorf("invalid order for %v", pv.policy)
+		} else if s, ok := v.Get("name").(*String); !ok || string(*s) != pv.value {
+			t.Errorf("invalid value for %v", pv.policy)
+		}
+	}
+}
+
+func TestAmf0ObjectBase_ValidateUTF8(t *testing.T) {
+	csk := amf0UTF8("\xff\xfe")
+	cs := NewString("oryx")
+	eof := &objectEOF{}
+	b := concat(&csk, cs, eof)
+
+	if err := (&objectBase{}).unmarshal(b, true, -1); err != nil {
+		t.Errorf("unmarshal err %+v", err)
+	}
+
+	if err := (&objectBase{decoder: &Decoder{ValidateUTF8: true}}).unmarshal(b, true, -1); err == nil {
+		t.Errorf("should error for invalid UTF-8")
+	}
+}
+
+func TestDecoder_Unmarshal(t *testing.T) {
+	// The object {"info":{"app":"a", "app":"b"}}.
+	b := []byte{3, 0, 4, 'i', 'n', 'f', 'o',
+		3, 0, 3, 'a', 'p', 'p', 2, 0, 1, 'a', 0, 3, 'a', 'p', 'p', 2, 0, 1, 'b', 0, 0, 9,
+		0, 0, 9}
+
+	// The default decoder keeps the last.
+	o := NewObject()
+	if err := o.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := o.Get("info").(*Object).Get("app").(*String); !ok || string(*s) != "b" {
+		t.Errorf("invalid app %v", o)
+	}
+
+	// The options of decoder are applied to the nested objects.
+	a, err := (&Decoder{Duplicates: DuplicateKeepFirst}).Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := a.(*Object).Get("info").(*Object).Get("app").(*String); !ok || string(*s) != "a" {
+		t.Errorf("invalid app %v", a)
+	}
+
+	if _, err := (&Decoder{Duplicates: DuplicateError}).Unmarshal(b); err == nil {
+		t.Error("should fail for duplicated")
+	}
+}
+
+func TestAmf0Append(t *testing.T) {
+	o := NewObject()
+	o.Set("app", NewString("live"))
+
+	for _, a := range []Amf0{NewNumber(1.5), NewString("oryx"), NewBoolean(true), NewNull(), o} {
+		pb, err := a.MarshalBinary()
+		if err != nil {
+			t.Errorf("marshal %v failed, err is %+v", a, err)
+		}
+
+		dst := []byte{0xff}
+		if dst, err = Append(dst, a); err != nil {
+			t.Errorf("append %v failed, err is %+v", a, err)
+		}
+		if !bytes.Equal(dst, append([]byte{0xff}, pb...)) {
+			t.Errorf("append %v invalid, %v != %v", a, dst[1:], pb)
+		}
+	}
+}
+
+func TestAmf0EcmaArray_ToObject(t *testing.T) {
+	a := NewEcmaArray()
+	a.Set("width", NewNumber(1280)).Set("height", NewNumber(720))
+
+	o := a.ToObject()
+	if keys := o.Keys(); len(keys) != 2 || keys[0] != "width" || keys[1] != "height" {
+		t.Errorf("invalid keys %v", keys)
+	}
+
+	// Convert back, should be the same bytes, with count of properties.
+	b := o.ToEcmaArray()
+	a.count = 2
+	pa, _ := a.MarshalBinary()
+	if pb, _ := b.MarshalBinary(); !bytes.Equal(pa, pb) {
+		t.Errorf("invalid ecma array %v != %v", pb, pa)
+	}
+
+	for _, v := range []Amf0{a, o, b} {
+		kv, ok := ToKeyValues(v)
+		if !ok || kv.Len() != 2 || *(kv.Get("height").(*Number)) != 720 {
+			t.Errorf("invalid key-values %v", v)
+		}
+	}
+	if _, ok := ToKeyValues(NewStrictArray()); ok {
+		t.Error("strict array should not be key-values")
+	}
+}
+
+func BenchmarkAmf0String_MarshalBinary(b *testing.B) {
+	v := NewString("onMetaData")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.MarshalBinary(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAmf0String_AppendBinary(b *testing.B) {
+	v := NewString("onMetaData")
+	buf := make([]byte, 0, v.Size())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.AppendBinary(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAmf0Number_MarshalBinary(b *testing.B) {
+	v := NewNumber(1.0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.MarshalBinary(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAmf0Number_AppendBinary(b *testing.B) {
+	v := NewNumber(1.0)
+	buf := make([]byte, 0, v.Size())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.AppendBinary(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAmf0Native(t *testing.T) {
+	o := NewObject()
+	o.Set("width", NewNumber(1280)).Set("title", NewString("oryx")).Set("stereo", NewBoolean(true))
+	o.Set("copyright", NewNull())
+
+	m, ok := ToNative(o).(map[string]interface{})
+	if !ok || len(m) != 4 || m["width"] != float64(1280) || m["title"] != "oryx" || m["stereo"] != true || m["copyright"] != nil {
+		t.Errorf("invalid native %v", m)
+	}
+
+	a, err := FromNative(map[string]interface{}{
+		"width": 1280, "title": "oryx", "tags": []string{"live", "hd"}, "meta": map[string]int{"fps": 25},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys are sorted.
+	kv, ok := ToKeyValues(a)
+	if keys := kv.Keys(); !ok || len(keys) != 4 || keys[0] != "meta" || keys[3] != "width" {
+		t.Errorf("invalid keys %v", keys)
+	}
+	if *(kv.Get("width").(*Number)) != 1280 {
+		t.Errorf("invalid width %v", kv.Get("width"))
+	}
+
+	// Marshal then unmarshal to native.
+	var b []byte
+	if b, err = a.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+
+	var any Any
+	if err = any.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if any.Size() != len(b) {
+		t.Errorf("invalid size %v != %v", any.Size(), len(b))
+	}
+
+	m = any.Value.(map[string]interface{})
+	if tags := m["tags"].([]interface{}); len(tags) != 2 || tags[1] != "hd" {
+		t.Errorf("invalid tags %v", tags)
+	}
+	if meta := m["meta"].(map[string]interface{}); meta["fps"] != float64(25) {
+		t.Errorf("invalid meta %v", meta)
+	}
+
+	if _, err = FromNative(map[int]string{1: "oryx"}); err == nil {
+		t.Error("should fail for non-string key")
+	}
+	if _, err = FromNative(make(chan bool)); err == nil {
+		t.Error("should fail for chan")
+	}
+
+	// The Any can be marshaled as AMF0.
+	pa, _ := NewAny("oryx").MarshalBinary()
+	if ps, _ := NewString("oryx").MarshalBinary(); !bytes.Equal(pa, ps) || NewAny("oryx").Size() != len(ps) {
+		t.Errorf("invalid any %v != %v", pa, ps)
+	}
+}
+
+func TestAmf0JSON(t *testing.T) {
+	arr := NewStrictArray()
+	arr.UnmarshalJSON([]byte(`["live",1]`))
+
+	o := NewObject()
+	o.Set("width", NewNumber(1280)).Set("title", NewString("oryx")).Set("stereo", NewBoolean(true))
+	o.Set("copyright", NewNull()).Set("tags", arr)
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"width":1280,"title":"oryx","stereo":true,"copyright":null,"tags":["live",1]}`
+	if string(b) != want {
+		t.Errorf("got %v, want %v", string(b), want)
+	}
+
+	// Unmarshal to ecma array, in the original order.
+	a := NewEcmaArray()
+	if err = json.Unmarshal(b, a); err != nil {
+		t.Fatal(err)
+	}
+	if keys := a.Keys(); len(keys) != 5 || keys[0] != "width" || keys[4] != "tags" || a.count != 5 {
+		t.Errorf("invalid keys %v", keys)
+	}
+	if v, ok := a.Get("tags").(*StrictArray); !ok || v.count != 2 || *(v.Get("1").(*Number)) != 1 {
+		t.Errorf("invalid tags %v", a.Get("tags"))
+	}
+
+	// Round-trip by AMF0.
+	var pa []byte
+	if pa, err = a.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewEcmaArray()
+	if err = r.UnmarshalBinary(pa); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ = json.Marshal(r); string(b) != want {
+		t.Errorf("got %v, want %v", string(b), want)
+	}
+
+	var any Any
+	if err = json.Unmarshal([]byte(`{"fps":25}`), &any); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ = json.Marshal(&any); string(b) != `{"fps":25}` {
+		t.Errorf("invalid any %v", string(b))
+	}
+
+	if err = json.Unmarshal([]byte(`{"fps":nope}`), NewObject()); err == nil {
+		t.Error("should fail for invalid json")
+	}
+}
+
+func mockConnectPayload(t testing.TB) []byte {
+	o := NewObject()
+	o.Set("app", NewString("live"))
+	o.Set("flashVer", NewString("FMLE/3.0 (compatible; FMSc/1.0)"))
+	o.Set("tcUrl", NewString("rtmp://ossrs.net/live"))
+	o.Set("fpad", NewBoolean(false))
+	o.Set("capabilities", NewNumber(239))
+	o.Set("audioCodecs", NewNumber(3575))
+	o.Set("videoCodecs", NewNumber(252))
+	o.Set("objectEncoding", NewNumber(0))
+
+	var b []byte
+	for _, a := range []Amf0{NewString("connect"), NewNumber(1), o, NewNull()} {
+		var err error
+		if b, err = Append(b, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func TestAmf0View(t *testing.T) {
+	v := NewView(mockConnectPayload(t))
+
+	if s, err := v.Index(0).AsString(); err != nil || s != "connect" {
+		t.Errorf("invalid command %v %+v", s, err)
+	}
+	if n, err := v.Index(1).AsNumber(); err != nil || n != 1 {
+		t.Errorf("invalid transaction %v %+v", n, err)
+	}
+	if s, err := v.Index(2).Get("tcUrl").AsString(); err != nil || s != "rtmp://ossrs.net/live" {
+		t.Errorf("invalid tcUrl %v %+v", s, err)
+	}
+	if b, err := v.Index(2).Get("fpad").AsBoolean(); err != nil || b {
+		t.Errorf("invalid fpad %v %+v", b, err)
+	}
+	if a, err := v.Index(3).Value(); err != nil || a.amf0Marker() != markerNull {
+		t.Errorf("invalid null %v %+v", a, err)
+	}
+
+	if _, err := v.Index(4).AsString(); err == nil {
+		t.Error("should fail for index")
+	}
+	if _, err := v.Index(2).Get("swfUrl").AsString(); err == nil {
+		t.Error("should fail for no prop")
+	}
+	if _, err := v.Index(0).Get("tcUrl").AsString(); err == nil {
+		t.Error("should fail for not object")
+	}
+	if _, err := v.Index(1).AsString(); err == nil {
+		t.Error("should fail for not string")
+	}
+	if _, err := NewView(v.Bytes()[:40]).Index(2).Get("tcUrl").AsString(); err == nil {
+		t.Error("should fail for not enough data")
+	}
+
+	a, err := v.Index(2).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := a.(*Object); !ok || o.Len() != 8 || v.Index(2).Err() != nil || len(v.Index(2).Bytes()) != o.Size() {
+		t.Errorf("invalid object %v", a)
+	}
+}
+
+func TestAmf0View_Duplicates(t *testing.T) {
+	// The object {"app":"a", "app":"b"}.
+	b := []byte{3, 0, 3, 'a', 'p', 'p', 2, 0, 1, 'a', 0, 3, 'a', 'p', 'p', 2, 0, 1, 'b', 0, 0, 9}
+
+	if s, err := NewView(b).Get("app").AsString(); err != nil || s != "b" {
+		t.Errorf("invalid last %v %+v", s, err)
+	}
+
+	d := &Decoder{Duplicates: DuplicateKeepFirst}
+	if s, err := d.View(b).Get("app").AsString(); err != nil || s != "a" {
+		t.Errorf("invalid first %v %+v", s, err)
+	}
+
+	d = &Decoder{Duplicates: DuplicateError}
+	if _, err := d.View(b).Get("app").AsString(); err == nil {
+		t.Error("should fail for duplicated")
+	}
+}
+
+func BenchmarkAmf0View_Get(b *testing.B) {
+	p := mockConnectPayload(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewView(p).Index(2).Get("tcUrl").AsString(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAmf0Object_Get(b *testing.B) {
+	p := mockConnectPayload(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		o := NewObject()
+		if err := o.UnmarshalBinary(p[19:]); err != nil {
+			b.Fatal(err)
+		}
+		if s, ok := o.Get("tcUrl").(*String); !ok || *s == "" {
+			b.Fatal("no tcUrl")
+		}
+	}
+}
@@ -0,0 +1,372 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The amf0gen generates the typed AMF0 struct from a declarative schema, which
+// emits the struct with Size, UnmarshalBinary and MarshalBinary, for example:
+//		//go:generate go run github.com/ossrs/go-oryx-lib/amf0/amf0gen -type=PausePayload -fields=CommandName:String,TransactionID:Number,CommandObject:Null,IsPause:Boolean,Time:Number
+// which writes the pausepayload_amf0.go in the package of the go:generate file.
+// The fields are encoded in order, the type is one of:
+//		Number, String, Boolean, Null, Object, EcmaArray, StrictArray, Amf0
+// The field suffixed by ? is optional, which is nil when absent, and the Amf0 field
+// suffixed by * is repeated until the end, for example:
+//		Args:Amf0?
+//		Args:Amf0*
+// For the packets of rtmp, which embed the variantCallPacket and declare the struct by
+// hand, only generate the methods, see rtmp/generate.go:
+//		-type=PausePacket -embed=variantCallPacket -methods -fields=IsPause:Boolean,Time:Number
+// @remark Only the Object, EcmaArray, StrictArray and Amf0 can be optional,
+// and the optional or repeated fields must be at the end.
+// @remark The embedded struct must have Size, UnmarshalBinary and appendBinary.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The AMF0 type of field in schema.
+type amf0Type struct {
+	// The go type of field, without the package.
+	goType string
+	// Whether the field is a pointer, which should be created before unmarshal.
+	pointer bool
+	// The constructor of pointer type, empty to discovery from the bytes.
+	constructor string
+}
+
+var amf0Types = map[string]amf0Type{
+	"Number":      {goType: "Number"},
+	"String":      {goType: "String"},
+	"Boolean":     {goType: "Boolean"},
+	"Null":        {goType: "Amf0", pointer: true, constructor: "NewNull"},
+	"Object":      {goType: "*Object", pointer: true, constructor: "NewObject"},
+	"EcmaArray":   {goType: "*EcmaArray", pointer: true, constructor: "NewEcmaArray"},
+	"StrictArray": {goType: "*StrictArray", pointer: true, constructor: "NewStrictArray"},
+	"Amf0":        {goType: "Amf0", pointer: true},
+}
+
+// The field of schema.
+type field struct {
+	Name     string
+	Type     string
+	Optional bool
+	Repeated bool
+}
+
+// The schema of struct to generate.
+type schema struct {
+	// The package to generate in.
+	pkg string
+	// The name of struct.
+	typ string
+	// The embedded struct, optional, which is encoded before fields.
+	embed string
+	// Whether only generate the methods, for the struct declared by user.
+	methods bool
+	fields  []field
+}
+
+// Parse the fields in schema, the format is Name:Type[?*],Name:Type[?*],...
+func parseFields(s string) (fields []field, err error) {
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+
+		vs := strings.Split(f, ":")
+		if len(vs) != 2 || vs[0] == "" {
+			return nil, oe.Errorf("invalid field %v", f)
+		}
+
+		v := field{Name: vs[0], Type: vs[1]}
+		if strings.HasSuffix(v.Type, "?") {
+			v.Type, v.Optional = strings.TrimSuffix(v.Type, "?"), true
+		} else if strings.HasSuffix(v.Type, "*") {
+			v.Type, v.Repeated = strings.TrimSuffix(v.Type, "*"), true
+		}
+
+		t, ok := amf0Types[v.Type]
+		if !ok {
+			return nil, oe.Errorf("invalid type %v of %v", v.Type, v.Name)
+		}
+		if v.Optional && (!t.pointer || v.Type == "Null") {
+			return nil, oe.Errorf("%v of %v can not be optional", v.Type, v.Name)
+		}
+		if v.Repeated && v.Type != "Amf0" {
+			return nil, oe.Errorf("%v of %v can not be repeated", v.Type, v.Name)
+		}
+		if len(fields) > 0 {
+			if last := fields[len(fields)-1]; last.Repeated {
+				return nil, oe.Errorf("%v after repeated field", v.Name)
+			} else if !v.Optional && !v.Repeated && last.Optional {
+				return nil, oe.Errorf("required %v after optional field", v.Name)
+			}
+		}
+
+		fields = append(fields, v)
+	}
+
+	if len(fields) == 0 {
+		return nil, oe.New("no fields")
+	}
+	return
+}
+
+// Generate the go source of typed struct.
+func generate(sc *schema) (src []byte, err error) {
+	// The prefix of amf0 types, empty when generate in the amf0 package.
+	prefix := "amf0."
+	if sc.pkg == "amf0" {
+		prefix = ""
+	}
+
+	args := []string{"-type=" + sc.typ}
+	if sc.embed != "" {
+		args = append(args, "-embed="+sc.embed)
+	}
+	if sc.methods {
+		args = append(args, "-methods")
+	}
+
+	var specs []string
+	for _, f := range sc.fields {
+		spec := f.Name + ":" + f.Type
+		if f.Optional {
+			spec += "?"
+		} else if f.Repeated {
+			spec += "*"
+		}
+		specs = append(specs, spec)
+	}
+	args = append(args, "-fields="+strings.Join(specs, ","))
+
+	b := &bytes.Buffer{}
+	w := func(format string, a ...interface{}) {
+		fmt.Fprintf(b, format, a...)
+	}
+
+	w("// Code generated by amf0gen %v; DO NOT EDIT.\n\n", strings.Join(args, " "))
+	w("package %v\n\n", sc.pkg)
+	w("import (\n")
+	if prefix != "" {
+		w("\"github.com/ossrs/go-oryx-lib/amf0\"\n")
+	}
+	w("oe \"github.com/ossrs/go-oryx-lib/errors\"\n")
+	w(")\n\n")
+
+	if !sc.methods {
+		w("// The %v is generated from schema %v.\n", sc.typ, strings.Join(specs, ","))
+		w("type %v struct {\n", sc.typ)
+		if sc.embed != "" {
+			w("%v\n", sc.embed)
+		}
+		for _, f := range sc.fields {
+			t := amf0Types[f.Type]
+			goType := strings.Replace(prefix+t.goType, prefix+"*", "*"+prefix, 1)
+			if f.Repeated {
+				goType = "[]" + goType
+			}
+			w("%v %v\n", f.Name, goType)
+		}
+		w("}\n\n")
+
+		w("// Create the %v, with the pointer fields initialized.\n", sc.typ)
+		w("func New%v() *%v {\n", sc.typ, sc.typ)
+		w("v := &%v{}\n", sc.typ)
+		for _, f := range sc.fields {
+			if t := amf0Types[f.Type]; t.constructor != "" && !f.Optional {
+				w("v.%v = %v%v()\n", f.Name, prefix, t.constructor)
+			}
+		}
+		w("return v\n")
+		w("}\n\n")
+	}
+
+	w("func (v *%v) Size() int {\n", sc.typ)
+	if sc.embed != "" {
+		w("size := v.%v.Size()\n", sc.embed)
+	} else {
+		w("size := 0\n")
+	}
+	for _, f := range sc.fields {
+		if f.Optional {
+			w("if v.%v != nil {\n", f.Name)
+			w("size += v.%v.Size()\n", f.Name)
+			w("}\n")
+		} else if f.Repeated {
+			w("for _, e := range v.%v {\n", f.Name)
+			w("size += e.Size()\n")
+			w("}\n")
+		} else {
+			w("size += v.%v.Size()\n", f.Name)
+		}
+	}
+	w("return size\n")
+	w("}\n\n")
+
+	w("func (v *%v) UnmarshalBinary(data []byte) (err error) {\n", sc.typ)
+	w("p := data\n\n")
+	if sc.embed != "" {
+		w("if err = v.%v.UnmarshalBinary(p); err != nil {\n", sc.embed)
+		w("return oe.WithMessage(err, \"unmarshal %v\")\n", sc.embed)
+		w("}\n")
+		w("p = p[v.%v.Size():]\n\n", sc.embed)
+	}
+	for _, f := range sc.fields {
+		if f.Optional || f.Repeated {
+			w("v.%v = nil\n", f.Name)
+		}
+	}
+	for _, f := range sc.fields {
+		t := amf0Types[f.Type]
+		if f.Repeated {
+			w("for len(p) > 0 {\n")
+			w("var e %vAmf0\n", prefix)
+			w("if e, err = %vDiscovery(p); err != nil {\n", prefix)
+			w("return oe.WithMessage(err, \"discovery %v\")\n", f.Name)
+			w("}\n")
+			w("if err = e.UnmarshalBinary(p); err != nil {\n")
+			w("return oe.WithMessage(err, \"unmarshal %v\")\n", f.Name)
+			w("}\n")
+			w("p = p[e.Size():]\n\n")
+			w("v.%v = append(v.%v, e)\n", f.Name, f.Name)
+			w("}\n\n")
+			continue
+		}
+
+		if f.Optional {
+			w("if len(p) == 0 {\n")
+			w("return\n")
+			w("}\n")
+		}
+		if t.pointer && t.constructor == "" {
+			w("if v.%v, err = %vDiscovery(p); err != nil {\n", f.Name, prefix)
+			w("return oe.WithMessage(err, \"discovery %v\")\n", f.Name)
+			w("}\n")
+		} else if t.pointer {
+			w("v.%v = %v%v()\n", f.Name, prefix, t.constructor)
+		}
+		w("if err = v.%v.UnmarshalBinary(p); err != nil {\n", f.Name)
+		w("return oe.WithMessage(err, \"unmarshal %v\")\n", f.Name)
+		w("}\n")
+		w("p = p[v.%v.Size():]\n\n", f.Name)
+	}
+	w("return\n")
+	w("}\n\n")
+
+	w("func (v *%v) MarshalBinary() (data []byte, err error) {\n", sc.typ)
+	if sc.embed != "" {
+		w("if data, err = v.%v.appendBinary(make([]byte, 0, v.Size())); err != nil {\n", sc.embed)
+		w("return nil, oe.WithMessage(err, \"marshal %v\")\n", sc.embed)
+		w("}\n\n")
+	} else {
+		w("data = make([]byte, 0, v.Size())\n\n")
+	}
+	for _, f := range sc.fields {
+		if f.Repeated {
+			w("for _, e := range v.%v {\n", f.Name)
+			w("if data, err = %vAppend(data, e); err != nil {\n", prefix)
+			w("return nil, oe.WithMessage(err, \"marshal %v\")\n", f.Name)
+			w("}\n")
+			w("}\n\n")
+			continue
+		}
+
+		if f.Optional {
+			w("if v.%v != nil {\n", f.Name)
+		}
+		w("if data, err = %vAppend(data, %vv.%v); err != nil {\n", prefix, addressOf(f), f.Name)
+		w("return nil, oe.WithMessage(err, \"marshal %v\")\n", f.Name)
+		w("}\n")
+		if f.Optional {
+			w("}\n")
+		}
+		w("\n")
+	}
+	w("return\n")
+	w("}\n")
+
+	if src, err = format.Source(b.Bytes()); err != nil {
+		return nil, oe.Wrap(err, "format")
+	}
+	return
+}
+
+// The value fields should be appended by address, to use the pointer receiver.
+func addressOf(f field) string {
+	if amf0Types[f.Type].pointer {
+		return ""
+	}
+	return "&"
+}
+
+func main() {
+	var typ, embed, fields, output string
+	var methods bool
+	flag.StringVar(&typ, "type", "", "The name of struct to generate.")
+	flag.StringVar(&embed, "embed", "", "The embedded struct encoded before fields, optional.")
+	flag.BoolVar(&methods, "methods", false, "Only generate the methods, for the struct declared by user.")
+	flag.StringVar(&fields, "fields", "", "The fields in order, for example, Name:String,Value:Number,Args:Amf0?")
+	flag.StringVar(&output, "output", "", "The output file, default to <type>_amf0.go.")
+	flag.Parse()
+
+	if typ == "" || fields == "" {
+		flag.Usage()
+		os.Exit(-1)
+	}
+	if output == "" {
+		output = strings.ToLower(typ) + "_amf0.go"
+	}
+
+	// The go:generate sets the package of file to generate in.
+	pkg := os.Getenv("GOPACKAGE")
+	if pkg == "" {
+		pkg = "main"
+	}
+
+	sc := &schema{pkg: pkg, typ: typ, embed: embed, methods: methods}
+	if err := run(sc, fields, output); err != nil {
+		fmt.Fprintln(os.Stderr, "amf0gen:", err)
+		os.Exit(-1)
+	}
+}
+
+func run(sc *schema, fields, output string) (err error) {
+	if sc.fields, err = parseFields(fields); err != nil {
+		return oe.WithMessage(err, "parse fields")
+	}
+
+	var src []byte
+	if src, err = generate(sc); err != nil {
+		return oe.WithMessage(err, "generate")
+	}
+
+	if err = ioutil.WriteFile(output, src, 0644); err != nil {
+		return oe.Wrap(err, "write")
+	}
+	return
+}
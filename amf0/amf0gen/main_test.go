@@ -0,0 +1,115 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	if fs, err := parseFields("Name:String, Time:Number,Args:Amf0?"); err != nil {
+		t.Error(err)
+	} else if len(fs) != 3 || fs[1].Name != "Time" || fs[1].Type != "Number" || !fs[2].Optional {
+		t.Errorf("invalid fields %v", fs)
+	}
+
+	if fs, err := parseFields("Name:String,Args:Amf0*"); err != nil {
+		t.Error(err)
+	} else if len(fs) != 2 || !fs[1].Repeated || fs[1].Optional {
+		t.Errorf("invalid fields %v", fs)
+	}
+
+	for _, s := range []string{
+		"", "Name", ":String", "Name:Int", "Name:String?", "Name:Null?", "Args:Object?,Name:String",
+		"Args:Object*", "Args:Amf0*,Name:String", "Args:Amf0*,Extra:Amf0?",
+	} {
+		if _, err := parseFields(s); err == nil {
+			t.Errorf("should fail for %v", s)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	fs, err := parseFields("Name:String,Props:Object,Args:Amf0?")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var src []byte
+	if src, err = generate(&schema{pkg: "rtmp", typ: "Payload", fields: fs}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = parser.ParseFile(token.NewFileSet(), "payload_amf0.go", src, 0); err != nil {
+		t.Error(err)
+	}
+
+	for _, s := range []string{
+		"package rtmp", "\"github.com/ossrs/go-oryx-lib/amf0\"", "Props *amf0.Object", "v.Props = amf0.NewObject()",
+		"amf0.Append(data, &v.Name)", "v.Args, err = amf0.Discovery(p)", "func (v *Payload) Size() int",
+	} {
+		if !strings.Contains(string(src), s) {
+			t.Errorf("no %v in %v", s, string(src))
+		}
+	}
+
+	// In the amf0 package, the types are not prefixed.
+	if src, err = generate(&schema{pkg: "amf0", typ: "Payload", fields: fs}); err != nil {
+		t.Fatal(err)
+	}
+	if s := string(src); strings.Contains(s, "amf0.") || !strings.Contains(s, "Props *Object") {
+		t.Errorf("invalid %v", s)
+	}
+}
+
+func TestGenerate_Methods(t *testing.T) {
+	fs, err := parseFields("Args:Amf0*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the methods, for the struct which embeds the call packet.
+	var src []byte
+	if src, err = generate(&schema{pkg: "rtmp", typ: "RPCPacket", embed: "variantCallPacket", methods: true, fields: fs}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = parser.ParseFile(token.NewFileSet(), "rpcpacket_amf0.go", src, 0); err != nil {
+		t.Error(err)
+	}
+
+	s := string(src)
+	if strings.Contains(s, "type RPCPacket struct") || strings.Contains(s, "func NewRPCPacket") {
+		t.Errorf("should not declare struct %v", s)
+	}
+	for _, v := range []string{
+		"-type=RPCPacket -embed=variantCallPacket -methods -fields=Args:Amf0*", "size := v.variantCallPacket.Size()",
+		"v.variantCallPacket.appendBinary(make([]byte, 0, v.Size()))", "v.Args = append(v.Args, e)",
+	} {
+		if !strings.Contains(s, v) {
+			t.Errorf("no %v in %v", v, s)
+		}
+	}
+}
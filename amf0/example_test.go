@@ -20,3 +20,31 @@
 // CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 
 package amf0_test
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf0"
+)
+
+func ExampleView() {
+	o := amf0.NewObject()
+	o.Set("app", amf0.NewString("live"))
+	o.Set("tcUrl", amf0.NewString("rtmp://ossrs.net/live"))
+
+	// The payload of connect command, for example, from RTMP message.
+	var payload []byte
+	for _, a := range []amf0.Amf0{amf0.NewString("connect"), amf0.NewNumber(1), o} {
+		payload, _ = amf0.Append(payload, a)
+	}
+
+	// Only scan for the tcUrl, without decoding the whole command object.
+	tcUrl, err := amf0.NewView(payload).Index(2).Get("tcUrl").AsString()
+	if err != nil {
+		fmt.Println(fmt.Sprintf("APP: Get tcUrl failed, err is %+v", err))
+		return
+	}
+	fmt.Println(tcUrl)
+
+	// Output:
+	// rtmp://ossrs.net/live
+}
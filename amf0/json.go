@@ -0,0 +1,242 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The JSON marshaler and unmarshaler of AMF0, for example, to dump the metadata.
+package amf0
+
+import (
+	"bytes"
+	"encoding/json"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"strconv"
+)
+
+// Marshal the AMF0 to JSON, the null and undefined are null.
+func marshalJSON(a Amf0) ([]byte, error) {
+	if m, ok := a.(json.Marshaler); ok {
+		return m.MarshalJSON()
+	}
+	return []byte("null"), nil
+}
+
+// Unmarshal the JSON to AMF0, the object is Object and array is StrictArray.
+func unmarshalJSON(data []byte) (a Amf0, err error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, oe.New("empty json")
+	}
+
+	switch data[0] {
+	case '{':
+		a = NewObject()
+	case '[':
+		a = NewStrictArray()
+	case '"':
+		a = NewString("")
+	case 't', 'f':
+		a = NewBoolean(false)
+	case 'n':
+		if string(data) != "null" {
+			return nil, oe.Errorf("invalid json %v", string(data))
+		}
+		return NewNull(), nil
+	default:
+		a = NewNumber(0)
+	}
+
+	if err = a.(json.Unmarshaler).UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (v *Number) MarshalJSON() ([]byte, error) {
+	return json.Marshal(float64(*v))
+}
+
+func (v *Number) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*float64)(v))
+}
+
+func (v *String) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(*v))
+}
+
+func (v *String) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*string)(v))
+}
+
+func (v *Boolean) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bool(*v))
+}
+
+func (v *Boolean) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*bool)(v))
+}
+
+// Marshal the properties as JSON object, in the original order.
+func (v *objectBase) marshalJSON() ([]byte, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	b := &bytes.Buffer{}
+	b.WriteByte('{')
+	for i, p := range v.properties {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		kb, err := json.Marshal(string(p.key))
+		if err != nil {
+			return nil, oe.Wrapf(err, "marshal key %v", string(p.key))
+		}
+		b.Write(kb)
+		b.WriteByte(':')
+
+		vb, err := marshalJSON(p.value)
+		if err != nil {
+			return nil, oe.WithMessage(err, string(p.key))
+		}
+		b.Write(vb)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+// Unmarshal the JSON object to properties, in the original order.
+func (v *objectBase) unmarshalJSON(data []byte) (err error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+
+	var t json.Token
+	if t, err = d.Token(); err != nil {
+		return oe.Wrap(err, "object start")
+	}
+	if t != json.Delim('{') {
+		return oe.Errorf("object start %v is illegal", t)
+	}
+
+	properties := []*property{}
+	for d.More() {
+		if t, err = d.Token(); err != nil {
+			return oe.Wrap(err, "key")
+		}
+		key, _ := t.(string)
+
+		var raw json.RawMessage
+		if err = d.Decode(&raw); err != nil {
+			return oe.Wrapf(err, "value of %v", key)
+		}
+
+		var a Amf0
+		if a, err = unmarshalJSON(raw); err != nil {
+			return oe.WithMessage(err, key)
+		}
+		properties = append(properties, &property{key: amf0UTF8(key), value: a})
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.properties = properties
+
+	return
+}
+
+func (v *Object) MarshalJSON() ([]byte, error) {
+	return v.marshalJSON()
+}
+
+func (v *Object) UnmarshalJSON(data []byte) error {
+	return v.unmarshalJSON(data)
+}
+
+func (v *EcmaArray) MarshalJSON() ([]byte, error) {
+	return v.marshalJSON()
+}
+
+// Unmarshal the JSON object, the count of ecma array is the number of properties.
+func (v *EcmaArray) UnmarshalJSON(data []byte) (err error) {
+	if err = v.unmarshalJSON(data); err != nil {
+		return
+	}
+
+	v.count = uint32(v.Len())
+	return
+}
+
+// Marshal the values as JSON array, the keys are ignored.
+func (v *StrictArray) MarshalJSON() ([]byte, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	b := &bytes.Buffer{}
+	b.WriteByte('[')
+	for i, p := range v.properties {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		vb, err := marshalJSON(p.value)
+		if err != nil {
+			return nil, oe.WithMessage(err, strconv.Itoa(i))
+		}
+		b.Write(vb)
+	}
+	b.WriteByte(']')
+
+	return b.Bytes(), nil
+}
+
+func (v *StrictArray) UnmarshalJSON(data []byte) (err error) {
+	var raws []json.RawMessage
+	if err = json.Unmarshal(data, &raws); err != nil {
+		return oe.Wrap(err, "array")
+	}
+
+	properties := make([]*property, 0, len(raws))
+	for i, raw := range raws {
+		var a Amf0
+		if a, err = unmarshalJSON(raw); err != nil {
+			return oe.WithMessage(err, strconv.Itoa(i))
+		}
+		properties = append(properties, &property{key: amf0UTF8(strconv.Itoa(i)), value: a})
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.properties, v.count = properties, uint32(len(properties))
+
+	return
+}
+
+func (v *Any) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value)
+}
+
+func (v *Any) UnmarshalJSON(data []byte) (err error) {
+	var a Amf0
+	if a, err = unmarshalJSON(data); err != nil {
+		return
+	}
+
+	v.Value, v.size = ToNative(a), 0
+	return
+}
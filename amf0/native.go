@@ -0,0 +1,206 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The conversion between AMF0 and native Go types, like encoding/json's interface{}.
+package amf0
+
+import (
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Convert the AMF0 to native Go value, which is one of:
+//		float64, for Number
+//		string, for String
+//		bool, for Boolean
+//		nil, for null and undefined
+//		map[string]interface{}, for Object and EcmaArray
+//		[]interface{}, for StrictArray
+// @remark The order of properties is lost, use Keys of Object if required.
+func ToNative(a Amf0) interface{} {
+	switch a := a.(type) {
+	case *Number:
+		return float64(*a)
+	case *String:
+		return string(*a)
+	case *Boolean:
+		return bool(*a)
+	case *Any:
+		return a.Value
+	case *StrictArray:
+		a.lock.Lock()
+		defer a.lock.Unlock()
+
+		vs := make([]interface{}, 0, len(a.properties))
+		for _, p := range a.properties {
+			vs = append(vs, ToNative(p.value))
+		}
+		return vs
+	}
+
+	if kv, ok := ToKeyValues(a); ok {
+		m := make(map[string]interface{}, kv.Len())
+		for _, key := range kv.Keys() {
+			m[key] = ToNative(kv.Get(key))
+		}
+		return m
+	}
+
+	return nil
+}
+
+// Convert the native Go value to AMF0, the reverse of ToNative, for example, to build the
+// onMetaData from map[string]interface{}. The v can be:
+//		nil, to null
+//		bool, to Boolean
+//		string, to String
+//		int, uint, float and their sized variants, to Number
+//		map with string key, to Object, the properties are sorted by key
+//		slice or array, to StrictArray
+//		Amf0, returned directly
+func FromNative(v interface{}) (a Amf0, err error) {
+	switch v := v.(type) {
+	case nil:
+		return NewNull(), nil
+	case Amf0:
+		return v, nil
+	case bool:
+		return NewBoolean(v), nil
+	case string:
+		return NewString(v), nil
+	case float64:
+		return NewNumber(v), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewNumber(float64(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewNumber(float64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return NewNumber(rv.Float()), nil
+	case reflect.Bool:
+		return NewBoolean(rv.Bool()), nil
+	case reflect.String:
+		return NewString(rv.String()), nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return NewNull(), nil
+		}
+		return FromNative(rv.Elem().Interface())
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, oe.Errorf("map key %v is not string", rv.Type().Key())
+		}
+
+		var keys []string
+		for _, key := range rv.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+
+		o := NewObject()
+		for _, key := range keys {
+			var e Amf0
+			if e, err = FromNative(rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).Interface()); err != nil {
+				return nil, oe.WithMessage(err, key)
+			}
+			o.Set(key, e)
+		}
+		return o, nil
+	case reflect.Slice, reflect.Array:
+		arr := NewStrictArray()
+		for i := 0; i < rv.Len(); i++ {
+			var e Amf0
+			if e, err = FromNative(rv.Index(i).Interface()); err != nil {
+				return nil, oe.WithMessage(err, strconv.Itoa(i))
+			}
+			arr.properties = append(arr.properties, &property{key: amf0UTF8(strconv.Itoa(i)), value: e})
+		}
+		arr.count = uint32(len(arr.properties))
+		return arr, nil
+	}
+
+	return nil, oe.Errorf("unsupported type %T", v)
+}
+
+// The Any is an AMF0 of any type, which value is native Go type, see ToNative and
+// FromNative. For example, to unmarshal the onMetaData to map[string]interface{}:
+//		var a Any
+//		if err := a.UnmarshalBinary(p); err != nil { ... }
+//		m := a.Value.(map[string]interface{})
+// @remark The Size is the bytes consumed by UnmarshalBinary, because the AMF0 type might
+// change, for example, the EcmaArray is marshaled as Object. Use NewAny to marshal.
+type Any struct {
+	Value interface{}
+	// The bytes consumed by unmarshal, zero to use the size to marshal.
+	size int
+}
+
+func NewAny(v interface{}) *Any {
+	return &Any{Value: v}
+}
+
+// Convert the value to AMF0, null if failed.
+func (v *Any) amf0() Amf0 {
+	a, err := FromNative(v.Value)
+	if err != nil {
+		return NewNull()
+	}
+	return a
+}
+
+func (v *Any) amf0Marker() marker {
+	return v.amf0().amf0Marker()
+}
+
+func (v *Any) Size() int {
+	if v.size > 0 {
+		return v.size
+	}
+	return v.amf0().Size()
+}
+
+func (v *Any) UnmarshalBinary(data []byte) (err error) {
+	var a Amf0
+	if a, err = Discovery(data); err != nil {
+		return oe.WithMessage(err, "discovery")
+	}
+
+	if err = a.UnmarshalBinary(data); err != nil {
+		return oe.WithMessage(err, "unmarshal")
+	}
+
+	v.Value, v.size = ToNative(a), a.Size()
+	return
+}
+
+func (v *Any) MarshalBinary() (data []byte, err error) {
+	var a Amf0
+	if a, err = FromNative(v.Value); err != nil {
+		return nil, oe.WithMessage(err, "from native")
+	}
+
+	return a.MarshalBinary()
+}
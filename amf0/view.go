@@ -0,0 +1,292 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The lazy view over the AMF0 bytes, to get some fields without decoding all values.
+package amf0
+
+import (
+	"encoding/binary"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"math"
+)
+
+// The lazy view over the marshaled AMF0 bytes, which scans the bytes for a value
+// without building the whole object graph. For example, to get the tcUrl of the
+// connect command from RTMP message payload:
+//		tcUrl, err := amf0.NewView(payload).Index(2).Get("tcUrl").AsString()
+// @remark The view refers to the bytes, never copied, so user should never modify them.
+// @remark The error of scanning is deferred to the As methods, to chain the lookups.
+type View struct {
+	b   []byte
+	err error
+	// The decoder for duplicated keys and Value, nil to use the default decoder.
+	d *Decoder
+}
+
+// Create a view over p, which is a sequence of AMF0 values.
+func NewView(p []byte) View {
+	return View{b: p}
+}
+
+// Create a view over p, which uses the options of decoder.
+func (v *Decoder) View(p []byte) View {
+	return View{b: p, d: v}
+}
+
+func (v View) decoder() *Decoder {
+	if v.d == nil {
+		return defaultDecoder
+	}
+	return v.d
+}
+
+// Get the error of scanning, nil if ok.
+func (v View) Err() error {
+	return v.err
+}
+
+// Get the bytes of view, for Index and Get, the bytes of the value.
+func (v View) Bytes() []byte {
+	return v.b
+}
+
+// Get the view of the i-th value in the sequence, starts from 0.
+func (v View) Index(i int) View {
+	if v.err != nil {
+		return v
+	}
+
+	p := v.b
+	for ; i >= 0; i-- {
+		n, err := viewSize(p)
+		if err != nil {
+			return View{err: oe.WithMessage(err, "index")}
+		}
+
+		if i == 0 {
+			return View{b: p[:n], d: v.d}
+		}
+		p = p[n:]
+	}
+	return View{err: oe.Errorf("invalid index %v", i)}
+}
+
+// Get the view of the value of key, the view must be an Object or EcmaArray.
+// @remark The Duplicates policy of decoder is applied for duplicated keys.
+func (v View) Get(key string) View {
+	if v.err != nil {
+		return v
+	}
+
+	if len(v.b) < 1 {
+		return View{err: oe.Errorf("require 1 bytes only %v", len(v.b))}
+	}
+	if m := marker(v.b[0]); m != markerObject && m != markerEcmaArray {
+		return View{err: oe.Errorf("Marker %v is not key-values", m)}
+	}
+
+	duplicates := v.decoder().Duplicates
+
+	var value []byte
+	var duplicated bool
+	_, err := viewProperties(v.b, func(k, vb []byte) bool {
+		if string(k) != key {
+			return true
+		}
+
+		if value != nil {
+			duplicated = true
+			if duplicates == DuplicateKeepFirst || duplicates == DuplicateError {
+				return false
+			}
+		}
+		value = vb
+		return true
+	})
+
+	if duplicated && duplicates == DuplicateError {
+		return View{err: oe.Errorf("duplicated prop %v", key)}
+	}
+	if value == nil && err != nil {
+		return View{err: oe.WithMessage(err, "get")}
+	}
+	if value == nil {
+		return View{err: oe.Errorf("no prop %v", key)}
+	}
+	return View{b: value, d: v.d}
+}
+
+// Decode the value of view, which allocates the whole value.
+func (v View) Value() (a Amf0, err error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+
+	return v.decoder().Unmarshal(v.b)
+}
+
+// Get the string of view, which must be a String.
+func (v View) AsString() (string, error) {
+	if v.err != nil {
+		return "", v.err
+	}
+
+	if err := v.expect(markerString, 3); err != nil {
+		return "", err
+	}
+
+	size := int(binary.BigEndian.Uint16(v.b[1:]))
+	if len(v.b) < 3+size {
+		return "", oe.Errorf("require %v bytes only %v", 3+size, len(v.b))
+	}
+	return string(v.b[3 : 3+size]), nil
+}
+
+// Get the number of view, which must be a Number.
+func (v View) AsNumber() (float64, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+
+	if err := v.expect(markerNumber, 9); err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(v.b[1:])), nil
+}
+
+// Get the boolean of view, which must be a Boolean.
+func (v View) AsBoolean() (bool, error) {
+	if v.err != nil {
+		return false, v.err
+	}
+
+	if err := v.expect(markerBoolean, 2); err != nil {
+		return false, err
+	}
+	return v.b[1] != 0, nil
+}
+
+func (v View) expect(m marker, size int) error {
+	if len(v.b) < size {
+		return oe.Errorf("require %v bytes only %v", size, len(v.b))
+	}
+	if vm := marker(v.b[0]); vm != m {
+		return oe.Errorf("%v marker %v is illegal", m, vm)
+	}
+	return nil
+}
+
+// The size of the first AMF0 value in p.
+func viewSize(p []byte) (int, error) {
+	if len(p) < 1 {
+		return 0, oe.Errorf("require 1 bytes only %v", len(p))
+	}
+
+	var size int
+	switch m := marker(p[0]); m {
+	case markerNumber:
+		size = 1 + 8
+	case markerBoolean:
+		size = 1 + 1
+	case markerNull, markerUndefined:
+		size = 1
+	case markerString:
+		if len(p) < 3 {
+			return 0, oe.Errorf("require 3 bytes only %v", len(p))
+		}
+		size = 3 + int(binary.BigEndian.Uint16(p[1:]))
+	case markerObject, markerEcmaArray:
+		n, err := viewProperties(p, func(key, value []byte) bool { return true })
+		if err != nil {
+			return 0, oe.WithMessage(err, m.String())
+		}
+		size = n
+	case markerStrictArray:
+		if len(p) < 5 {
+			return 0, oe.Errorf("require 5 bytes only %v", len(p))
+		}
+		// Keep the same layout as StrictArray.UnmarshalBinary, the count of properties.
+		size = 5
+		for i := 0; i < int(binary.BigEndian.Uint32(p[1:])); i++ {
+			n, err := viewProperty(p[size:])
+			if err != nil {
+				return 0, oe.WithMessage(err, m.String())
+			}
+			size += n
+		}
+	default:
+		return 0, oe.Errorf("Marker %v is not supported", m)
+	}
+
+	if len(p) < size {
+		return 0, oe.Errorf("require %v bytes only %v", size, len(p))
+	}
+	return size, nil
+}
+
+// The size of property in p, the key and value.
+func viewProperty(p []byte) (int, error) {
+	if len(p) < 2 {
+		return 0, oe.Errorf("require 2 bytes only %v", len(p))
+	}
+	key := 2 + int(binary.BigEndian.Uint16(p))
+	if len(p) < key {
+		return 0, oe.Errorf("require %v bytes only %v", key, len(p))
+	}
+
+	n, err := viewSize(p[key:])
+	if err != nil {
+		return 0, oe.WithMessage(err, "prop")
+	}
+	return key + n, nil
+}
+
+// Visit the properties of Object or EcmaArray p until the object EOF, or the fn
+// returns false, return the size of p when EOF is visited.
+func viewProperties(p []byte, fn func(key, value []byte) bool) (int, error) {
+	size := 1
+	if marker(p[0]) == markerEcmaArray {
+		size = 5
+	}
+	if len(p) < size {
+		return 0, oe.Errorf("require %v bytes only %v", size, len(p))
+	}
+
+	for {
+		if len(p) < size+3 {
+			return 0, oe.Errorf("require %v bytes only %v", size+3, len(p))
+		}
+		if p[size] == 0 && p[size+1] == 0 && marker(p[size+2]) == markerObjectEnd {
+			return size + 3, nil
+		}
+
+		n, err := viewProperty(p[size:])
+		if err != nil {
+			return 0, err
+		}
+
+		key := 2 + int(binary.BigEndian.Uint16(p[size:]))
+		if !fn(p[size+2:size+key], p[size+key:size+n]) {
+			return 0, nil
+		}
+		size += n
+	}
+}
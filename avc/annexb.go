@@ -0,0 +1,151 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The AnnexB and AVCC(IBMF) converter, and build the AVCDecoderConfigurationRecord from NALUs.
+package avc
+
+import (
+	"bytes"
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// Split the AnnexB stream to NALUs, the start code is 0x000001 or 0x00000001.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 211, AnnexB Byte stream Format.
+// @remark The data of NALU is shared with data, without copy.
+func SplitAnnexB(data []byte) (nalus []*NALU, err error) {
+	startCode := []byte{0x00, 0x00, 0x01}
+
+	pos := bytes.Index(data, startCode)
+	if pos < 0 {
+		return nil, errors.New("no start code")
+	}
+
+	for b := data[pos+len(startCode):]; len(b) > 0; {
+		// The trailing zero of NALU belongs to the next 4 bytes start code.
+		end := bytes.Index(b, startCode)
+		next := end + len(startCode)
+		if end < 0 {
+			end, next = len(b), len(b)
+		}
+		for end > 0 && b[end-1] == 0x00 {
+			end--
+		}
+
+		if end > 0 {
+			nalu := NewNALU()
+			if err = nalu.UnmarshalBinary(b[:end]); err != nil {
+				return nil, errors.WithMessage(err, "unmarshal")
+			}
+			nalus = append(nalus, nalu)
+		}
+		b = b[next:]
+	}
+
+	return
+}
+
+// Marshal the NALUs in AnnexB, use the 4 bytes start code.
+func MarshalAnnexB(nalus ...*NALU) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, nalu := range nalus {
+		b, err := nalu.MarshalBinary()
+		if err != nil {
+			return nil, errors.WithMessage(err, "marshal")
+		}
+
+		buf.Write([]byte{0x00, 0x00, 0x00, 0x01})
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+// Convert the AnnexB stream to AVCC, the NALUs are prefixed by length of lengthSizeMinusOne+1
+// bytes, generally 3 for 4 bytes, see AVCDecoderConfigurationRecord.
+func AnnexBToAVCC(data []byte, lengthSizeMinusOne uint8) ([]byte, error) {
+	nalus, err := SplitAnnexB(data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "split annexb")
+	}
+
+	sample := NewAVCSample(lengthSizeMinusOne)
+	sample.NALUs = nalus
+	return sample.MarshalBinary()
+}
+
+// Convert the AVCC to AnnexB stream, for example, the frame in FLV to TS.
+func AVCCToAnnexB(data []byte, lengthSizeMinusOne uint8) ([]byte, error) {
+	sample := NewAVCSample(lengthSizeMinusOne)
+	if err := sample.UnmarshalBinary(data); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal avcc")
+	}
+
+	return MarshalAnnexB(sample.NALUs...)
+}
+
+// Build the AVCDecoderConfigurationRecord from the SPS and PPS in NALUs, other NALUs are
+// ignored, for example, the NALUs of the AnnexB IDR frame. The length of NALU is 4 bytes.
+func NewAVCDecoderConfigurationRecordFrom(nalus ...*NALU) (*AVCDecoderConfigurationRecord, error) {
+	v := NewAVCDecoderConfigurationRecord()
+	v.LengthSizeMinusOne = 3
+
+	for _, nalu := range nalus {
+		switch nalu.NALUType {
+		case NALUTypeSPS:
+			v.SequenceParameterSetNALUnits = append(v.SequenceParameterSetNALUnits, nalu)
+		case NALUTypePPS:
+			v.PictureParameterSetNALUnits = append(v.PictureParameterSetNALUnits, nalu)
+		}
+	}
+
+	if len(v.SequenceParameterSetNALUnits) == 0 || len(v.PictureParameterSetNALUnits) == 0 {
+		return nil, errors.Errorf("requires sps and pps, got %v and %v",
+			len(v.SequenceParameterSetNALUnits), len(v.PictureParameterSetNALUnits))
+	}
+
+	// The profile, constraint flags and level, are the 3 bytes after SPS NALU header.
+	sps := v.SequenceParameterSetNALUnits[0]
+	if len(sps.Data) < 3 {
+		return nil, errors.Errorf("requires 3+ only %v bytes", len(sps.Data))
+	}
+	v.AVCProfileIndication = AVCProfile(sps.Data[0])
+	v.profileCompatibility = uint8(sps.Data[1])
+	v.AVCLevelIndication = AVCLevel(sps.Data[2])
+
+	return v, nil
+}
+
+// Parse the first SPS of record.
+func (v *AVCDecoderConfigurationRecord) SPS() (*SPS, error) {
+	if len(v.SequenceParameterSetNALUnits) == 0 {
+		return nil, errors.New("no sps")
+	}
+
+	b, err := v.SequenceParameterSetNALUnits[0].MarshalBinary()
+	if err != nil {
+		return nil, errors.WithMessage(err, "marshal sps")
+	}
+
+	sps := NewSPS()
+	if err = sps.UnmarshalBinary(b); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal sps")
+	}
+	return sps, nil
+}
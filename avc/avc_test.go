@@ -0,0 +1,257 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package avc
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The bit writer to build the RBSP, with the Exp-Golomb codes.
+type testBitWriter struct {
+	bits []byte
+}
+
+func (v *testBitWriter) u(n int, x uint32) *testBitWriter {
+	for i := n - 1; i >= 0; i-- {
+		v.bits = append(v.bits, byte(x>>uint(i))&0x01)
+	}
+	return v
+}
+
+func (v *testBitWriter) ue(x uint32) *testBitWriter {
+	n := 0
+	for y := uint64(x) + 1; y > 1; y >>= 1 {
+		n++
+	}
+	return v.u(n, 0).u(n+1, x+1)
+}
+
+func (v *testBitWriter) se(x int32) *testBitWriter {
+	if x > 0 {
+		return v.ue(uint32(2*x - 1))
+	}
+	return v.ue(uint32(-2 * x))
+}
+
+// Build the SPS NALU, with the rbsp_trailing_bits and the emulation_prevention_three_byte.
+func (v *testBitWriter) sps(profile AVCProfile) []byte {
+	v.u(1, 1)
+	for len(v.bits)%8 != 0 {
+		v.bits = append(v.bits, 0)
+	}
+
+	b := []byte{0x67, byte(profile), 0x00, 0x28}
+	var zeros int
+	for i := 0; i < len(v.bits); i += 8 {
+		var c byte
+		for _, bit := range v.bits[i : i+8] {
+			c = c<<1 | bit
+		}
+
+		if zeros >= 2 && c <= 0x03 {
+			b, zeros = append(b, 0x03), 0
+		}
+		if c == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// Write the fields after profile specific fields, the pic_order_cnt_type is 2.
+func (v *testBitWriter) picture(refs, widthInMbs, heightInMapUnits uint32, frameMbsOnly bool, crops ...uint32) *testBitWriter {
+	v.ue(0).ue(2).ue(refs).u(1, 0)
+	v.ue(widthInMbs - 1).ue(heightInMapUnits - 1)
+	if frameMbsOnly {
+		v.u(1, 1)
+	} else {
+		v.u(1, 0).u(1, 0)
+	}
+	v.u(1, 1)
+
+	if len(crops) == 0 {
+		return v.u(1, 0)
+	}
+	v.u(1, 1)
+	for _, crop := range crops {
+		v.ue(crop)
+	}
+	return v
+}
+
+func TestSPS_UnmarshalBinary(t *testing.T) {
+	// The high profile with chroma_format_idc and bit depth.
+	high := func(chroma uint32) *testBitWriter {
+		w := (&testBitWriter{}).ue(0).ue(chroma)
+		if chroma == 3 {
+			w.u(1, 0)
+		}
+		return w.ue(2).ue(2).u(1, 0).u(1, 0)
+	}
+
+	// The scaling lists, the first 4x4 list is present and stop by delta, the first 8x8 list
+	// is present, others are not.
+	scaling := (&testBitWriter{}).ue(0).ue(1).ue(0).ue(0).u(1, 0).u(1, 1)
+	scaling.u(1, 1).se(-8)
+	scaling.u(5, 0)
+	scaling.u(1, 1)
+	for i := 0; i < 64; i++ {
+		scaling.se(1)
+	}
+	scaling.u(1, 0)
+
+	pvs := []struct {
+		name    string
+		sps     []byte
+		width   int
+		height  int
+		chroma  uint32
+		bits    uint32
+		refs    uint32
+		mbsOnly bool
+	}{
+		{"baseline", (&testBitWriter{}).ue(0).picture(1, 120, 68, true, 0, 0, 0, 4).sps(66), 1920, 1080, 1, 8, 1, true},
+		{"no-crop", (&testBitWriter{}).ue(0).picture(4, 80, 45, true).sps(77), 1280, 720, 1, 8, 4, true},
+		{"high", high(1).picture(4, 120, 68, true, 0, 0, 0, 4).sps(100), 1920, 1080, 1, 10, 4, true},
+		{"high-422", high(2).picture(4, 120, 68, true, 0, 0, 0, 8).sps(122), 1920, 1080, 2, 10, 4, true},
+		{"high-444", high(3).picture(4, 120, 68, true, 0, 0, 0, 8).sps(244), 1920, 1080, 3, 10, 4, true},
+		{"monochrome", high(0).picture(4, 120, 68, true, 0, 0, 0, 8).sps(100), 1920, 1080, 0, 10, 4, true},
+		{"scaling", scaling.picture(4, 80, 45, true).sps(100), 1280, 720, 1, 8, 4, true},
+		{"interlaced", (&testBitWriter{}).ue(0).picture(1, 120, 34, false, 0, 0, 0, 2).sps(77), 1920, 1080, 1, 8, 1, false},
+		{"crop-left-right", (&testBitWriter{}).ue(0).picture(1, 120, 68, true, 4, 4, 0, 4).sps(66), 1904, 1080, 1, 8, 1, true},
+		{"emulation", (&testBitWriter{}).ue(0).picture(0x1ffff, 120, 68, true, 0, 0, 0, 4).sps(66), 1920, 1080, 1, 8, 0x1ffff, true},
+	}
+	for _, pv := range pvs {
+		sps := NewSPS()
+		if err := sps.UnmarshalBinary(pv.sps); err != nil {
+			t.Errorf("%v failed, err is %+v", pv.name, err)
+			continue
+		}
+
+		if sps.Width != pv.width || sps.Height != pv.height || sps.ChromaFormatIDC != pv.chroma ||
+			sps.BitDepthLuma != pv.bits || sps.BitDepthChroma != pv.bits ||
+			sps.MaxNumRefFrames != pv.refs || sps.FrameMbsOnly != pv.mbsOnly {
+			t.Errorf("%v invalid sps %+v", pv.name, sps)
+		}
+	}
+
+	// The emulation_prevention_three_byte is removed.
+	if b := pvs[len(pvs)-1].sps; !bytes.Contains(b, []byte{0x00, 0x00, 0x03}) {
+		t.Errorf("no emulation prevention in %x", b)
+	}
+}
+
+func TestSPS_UnmarshalBinaryError(t *testing.T) {
+	baseline := (&testBitWriter{}).ue(0).picture(1, 120, 68, true, 0, 0, 0, 4).sps(66)
+
+	pvs := []struct {
+		name string
+		sps  []byte
+	}{
+		{"empty", nil},
+		{"header", baseline[:4]},
+		{"pps", append([]byte{0x68}, baseline[1:]...)},
+		{"crop-width", (&testBitWriter{}).ue(0).picture(1, 120, 68, true, 480, 480, 0, 0).sps(66)},
+		{"crop-height", (&testBitWriter{}).ue(0).picture(1, 120, 68, true, 0, 0, 540, 4).sps(66)},
+		{"crop-overflow", (&testBitWriter{}).ue(0).picture(1, 1, 1, true, 0, 1<<31+4, 0, 0).sps(66)},
+		{"width-overflow", (&testBitWriter{}).ue(0).picture(0, 0, 68, true).sps(66)},
+		{"exp-golomb", append([]byte{0x67, 66, 0x00, 0x28}, 0x00, 0x00, 0x00, 0x00, 0x01)},
+	}
+	for i := 5; i < len(baseline)-1; i++ {
+		pvs = append(pvs, struct {
+			name string
+			sps  []byte
+		}{"truncated", baseline[:i]})
+	}
+
+	for _, pv := range pvs {
+		if err := NewSPS().UnmarshalBinary(pv.sps); err == nil {
+			t.Errorf("%v %x should fail", pv.name, pv.sps)
+		}
+	}
+}
+
+func TestAnnexB_AVCC(t *testing.T) {
+	sps := (&testBitWriter{}).ue(0).picture(1, 120, 68, true, 0, 0, 0, 4).sps(66)
+	pps := []byte{0x68, 0xce, 0x3c, 0x80}
+	idr := []byte{0x65, 0x88, 0x84, 0x00, 0x00, 0x03, 0x01}
+
+	// The AnnexB with 3 and 4 bytes start code, and the trailing zero.
+	frame := bytes.Join([][]byte{nil, sps, pps, idr}, []byte{0x00, 0x00, 0x00, 0x01})
+	frame = append(append(frame, 0x00, 0x00, 0x01), pps...)
+	frame = append(frame, 0x00)
+
+	for _, lengthSizeMinusOne := range []uint8{0, 1, 3} {
+		avcc, err := AnnexBToAVCC(frame, lengthSizeMinusOne)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		size := int(lengthSizeMinusOne) + 1
+		if n := 4*size + len(sps) + 2*len(pps) + len(idr); len(avcc) != n {
+			t.Errorf("%v invalid avcc %vB, expect %vB", lengthSizeMinusOne, len(avcc), n)
+		}
+
+		annexb, err := AVCCToAnnexB(avcc, lengthSizeMinusOne)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := bytes.Join([][]byte{nil, sps, pps, idr, pps}, []byte{0x00, 0x00, 0x00, 0x01})
+		if !bytes.Equal(annexb, expect) {
+			t.Errorf("%v got %x, expect %x", lengthSizeMinusOne, annexb, expect)
+		}
+	}
+
+	// The record from the NALUs, the SPS is parsed.
+	nalus, err := SplitAnnexB(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := NewAVCDecoderConfigurationRecordFrom(nalus...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := record.SPS(); err != nil || s.Width != 1920 || s.Height != 1080 {
+		t.Errorf("invalid sps %v, err is %v", s, err)
+	}
+
+	if _, err := AnnexBToAVCC([]byte{0x65, 0x88, 0x84}, 3); err == nil {
+		t.Error("should fail for no start code")
+	}
+	if _, err := AVCCToAnnexB([]byte{0x00, 0x00, 0x00}, 3); err == nil {
+		t.Error("should fail for length")
+	}
+	if _, err := AVCCToAnnexB([]byte{0x00, 0x00, 0x00, 0x04, 0x65, 0x88}, 3); err == nil {
+		t.Error("should fail for nalu exceed")
+	}
+	if _, err := AVCCToAnnexB([]byte{0x00, 0x00}, 1); err == nil {
+		t.Error("should fail for empty nalu")
+	}
+	if _, err := NewAVCDecoderConfigurationRecordFrom(nalus[2:]...); err == nil {
+		t.Error("should fail for no sps")
+	}
+}
@@ -20,3 +20,64 @@
 // CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 
 package avc_test
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/avc"
+)
+
+func ExampleSplitAnnexB() {
+	// The AnnexB IDR frame, with SPS, PPS and IDR, the SPS is 1920x1080 baseline.
+	frame := []byte{
+		0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xc0, 0x28, 0xda, 0x01, 0xe0, 0x08, 0x9f, 0x95,
+		0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x3c, 0x80,
+		0x00, 0x00, 0x01, 0x65, 0x88, 0x84,
+	}
+
+	nalus, err := avc.SplitAnnexB(frame)
+	if err != nil {
+		return
+	}
+	for _, nalu := range nalus {
+		fmt.Println(nalu)
+	}
+
+	// Build the sequence header for FLV or MP4.
+	record, err := avc.NewAVCDecoderConfigurationRecordFrom(nalus...)
+	if err != nil {
+		return
+	}
+
+	sps, err := record.SPS()
+	if err != nil {
+		return
+	}
+	fmt.Println(sps)
+
+	// Output:
+	// SPS, NRI=3, size=9B
+	// PPS, NRI=3, size=3B
+	// IDR, NRI=3, size=2B
+	// Baseline, Level_4, 1920x1080
+}
+
+func ExampleAnnexBToAVCC() {
+	frame := []byte{0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x3c, 0x80, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84}
+
+	// Convert to the AVCC in FLV or MP4, which prefixed by 4 bytes length.
+	b, err := avc.AnnexBToAVCC(frame, 3)
+	if err != nil {
+		return
+	}
+	fmt.Printf("%x\n", b)
+
+	// Convert back to AnnexB for TS.
+	if b, err = avc.AVCCToAnnexB(b, 3); err != nil {
+		return
+	}
+	fmt.Printf("%x\n", b)
+
+	// Output:
+	// 0000000468ce3c8000000003658884
+	// 0000000168ce3c8000000001658884
+}
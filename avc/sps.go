@@ -0,0 +1,261 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The SPS parser, to get the profile, level and resolution of H.264.
+package avc
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 47, 7.3.2.1 Sequence parameter set RBSP syntax
+// @remark We only parse the fields before VUI, which is enough to get the resolution.
+type SPS struct {
+	// The profile_idc, the constraint_set flags and level_idc.
+	ProfileIDC      AVCProfile
+	ConstraintFlags uint8
+	LevelIDC        AVCLevel
+	// The seq_parameter_set_id.
+	ID uint32
+	// The chroma_format_idc, 1 for 4:2:0 if not present.
+	ChromaFormatIDC uint32
+	// The bit depth of luma and chroma, 8 if not present.
+	BitDepthLuma, BitDepthChroma uint32
+	// The max_num_ref_frames.
+	MaxNumRefFrames uint32
+	// Whether the frame_mbs_only_flag, false for interlaced.
+	FrameMbsOnly bool
+	// The size of picture, in pixels, the frame cropping is applied.
+	Width, Height int
+}
+
+func NewSPS() *SPS {
+	return &SPS{}
+}
+
+func (v *SPS) String() string {
+	return fmt.Sprintf("%v, %v, %vx%v", v.ProfileIDC, v.LevelIDC, v.Width, v.Height)
+}
+
+// Parse the SPS NALU, with the NALU header.
+func (v *SPS) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 4 {
+		return errors.Errorf("requires 4+ only %v bytes", len(data))
+	}
+	if t := NALUType(data[0] & 0x1f); t != NALUTypeSPS {
+		return errors.Errorf("invalid NALU %v", t)
+	}
+
+	v.ProfileIDC = AVCProfile(data[1])
+	v.ConstraintFlags = uint8(data[2])
+	v.LevelIDC = AVCLevel(data[3])
+
+	// Parse the fields in RBSP, the bit reader returns zero after error, so check the error at last.
+	br := newBitReader(ebspToRBSP(data[4:]))
+	v.ID = br.readUE()
+
+	v.ChromaFormatIDC, v.BitDepthLuma, v.BitDepthChroma = 1, 8, 8
+	var separateColourPlane bool
+	switch v.ProfileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		if v.ChromaFormatIDC = br.readUE(); v.ChromaFormatIDC == 3 {
+			separateColourPlane = br.readBit() == 1
+		}
+		v.BitDepthLuma, v.BitDepthChroma = br.readUE()+8, br.readUE()+8
+		// The qpprime_y_zero_transform_bypass_flag.
+		br.readBit()
+
+		// The seq_scaling_matrix_present_flag, and the scaling lists.
+		if br.readBit() == 1 {
+			n := 8
+			if v.ChromaFormatIDC == 3 {
+				n = 12
+			}
+			for i := 0; i < n; i++ {
+				if br.readBit() == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				skipScalingList(br, size)
+			}
+		}
+	}
+
+	// The log2_max_frame_num_minus4, and the pic_order_cnt_type.
+	br.readUE()
+	switch br.readUE() {
+	case 0:
+		br.readUE()
+	case 1:
+		br.readBit()
+		br.readSE()
+		br.readSE()
+		for i := br.readUE(); i > 0 && br.err == nil; i-- {
+			br.readSE()
+		}
+	}
+
+	v.MaxNumRefFrames = br.readUE()
+	// The gaps_in_frame_num_value_allowed_flag.
+	br.readBit()
+
+	widthInMbs, heightInMapUnits := br.readUE()+1, br.readUE()+1
+	if v.FrameMbsOnly = br.readBit() == 1; !v.FrameMbsOnly {
+		// The mb_adaptive_frame_field_flag.
+		br.readBit()
+	}
+	// The direct_8x8_inference_flag.
+	br.readBit()
+
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	if br.readBit() == 1 {
+		cropLeft, cropRight, cropTop, cropBottom = br.readUE(), br.readUE(), br.readUE(), br.readUE()
+	}
+
+	if br.err != nil {
+		return errors.WithMessage(br.err, "parse sps")
+	}
+
+	// The crop unit, please read 7.4.2.1.1 Sequence parameter set data semantics.
+	frameHeightFactor := uint32(2)
+	if v.FrameMbsOnly {
+		frameHeightFactor = 1
+	}
+	cropUnitX, cropUnitY := uint32(1), frameHeightFactor
+	if !separateColourPlane && v.ChromaFormatIDC != 0 {
+		subWidthC, subHeightC := uint32(2), uint32(2)
+		if v.ChromaFormatIDC == 2 {
+			subHeightC = 1
+		} else if v.ChromaFormatIDC == 3 {
+			subWidthC, subHeightC = 1, 1
+		}
+		cropUnitX, cropUnitY = subWidthC, subHeightC*frameHeightFactor
+	}
+
+	// Compute in int64, because the ue(v) may overflow the uint32, and the crop must be
+	// less than the size of picture.
+	width := int64(widthInMbs) * 16
+	height := int64(frameHeightFactor) * int64(heightInMapUnits) * 16
+	cropX := int64(cropUnitX) * (int64(cropLeft) + int64(cropRight))
+	cropY := int64(cropUnitY) * (int64(cropTop) + int64(cropBottom))
+	if cropX >= width || cropY >= height {
+		return errors.Errorf("invalid crop %vx%v of size %vx%v", cropX, cropY, width, height)
+	}
+
+	v.Width, v.Height = int(width-cropX), int(height-cropY)
+
+	return
+}
+
+// Skip the scaling_list of SPS.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 48, 7.3.2.1.1 Scaling list syntax
+func skipScalingList(br *bitReader, size int) {
+	lastScale, nextScale := int32(8), int32(8)
+	for j := 0; j < size && br.err == nil; j++ {
+		if nextScale != 0 {
+			nextScale = (lastScale + br.readSE() + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+}
+
+// Remove the emulation_prevention_three_byte, the 0x000003 to 0x0000.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 60, 7.4.1 NAL unit semantics
+func ebspToRBSP(data []byte) []byte {
+	b := make([]byte, 0, len(data))
+
+	var zeros int
+	for _, c := range data {
+		if zeros >= 2 && c == 0x03 {
+			zeros = 0
+			continue
+		}
+
+		if c == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// The bit reader for RBSP, with the Exp-Golomb codes.
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 159, 9.1 Parsing process for Exp-Golomb codes
+type bitReader struct {
+	data []byte
+	pos  int
+	// The error when read exceed the data, the following reads return 0.
+	err error
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+func (v *bitReader) readBit() uint32 {
+	if v.err != nil {
+		return 0
+	}
+	if v.pos >= len(v.data)*8 {
+		v.err = errors.Errorf("requires more than %v bytes", len(v.data))
+		return 0
+	}
+
+	bit := uint32(v.data[v.pos/8]>>uint(7-v.pos%8)) & 0x01
+	v.pos++
+	return bit
+}
+
+func (v *bitReader) readBits(n int) (r uint32) {
+	for i := 0; i < n; i++ {
+		r = r<<1 | v.readBit()
+	}
+	return
+}
+
+// Read the ue(v), the unsigned Exp-Golomb code.
+func (v *bitReader) readUE() uint32 {
+	var leadingZeroBits int
+	for v.readBit() == 0 && v.err == nil {
+		if leadingZeroBits++; leadingZeroBits > 31 {
+			v.err = errors.New("invalid exp-golomb code")
+			return 0
+		}
+	}
+	return 1<<uint(leadingZeroBits) - 1 + v.readBits(leadingZeroBits)
+}
+
+// Read the se(v), the signed Exp-Golomb code.
+func (v *bitReader) readSE() int32 {
+	k := v.readUE()
+	if k%2 == 1 {
+		return int32((k + 1) / 2)
+	}
+	return -int32(k / 2)
+}
@@ -93,6 +93,7 @@
 package errors
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 )
@@ -268,3 +269,70 @@ func Cause(err error) error {
 	}
 	return err
 }
+
+// Join returns an error that wraps the given errors, nil errors are
+// discarded. Join returns nil if every value in errs is nil, and the error
+// itself if there is only one non-nil error.
+// The error formats as the concatenation of the strings obtained by calling
+// the Error method of each element of errs, with a newline between each
+// string. When formatted with %+v, each error is expanded with its stack.
+//
+// It's similar to errors.Join of go1.20, used by cleanup paths to report
+// all failures, for example, closing the muxer, file and notifying hooks.
+func Join(errs ...error) error {
+	var v []error
+	for _, err := range errs {
+		if err != nil {
+			v = append(v, err)
+		}
+	}
+
+	switch len(v) {
+	case 0:
+		return nil
+	case 1:
+		return v[0]
+	}
+	return &joinError{errs: v}
+}
+
+type joinError struct {
+	errs []error
+}
+
+func (e *joinError) Error() string {
+	var b bytes.Buffer
+	for i, err := range e.errs {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// Errors returns the wrapped errors.
+func (e *joinError) Errors() []error { return e.errs }
+
+// Unwrap returns the wrapped errors, for errors.Is and errors.As of go1.20.
+func (e *joinError) Unwrap() []error { return e.errs }
+
+func (e *joinError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			for i, err := range e.errs {
+				if i > 0 {
+					io.WriteString(s, "\n")
+				}
+				fmt.Fprintf(s, "%+v", err)
+			}
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, e.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	}
+}
@@ -204,3 +204,14 @@ func ExampleCause_printf() {
 
 	// Output: failed: hello world
 }
+
+func ExampleJoin() {
+	err1 := errors.New("close muxer")
+	err2 := errors.Wrap(errors.New("EOF"), "close file")
+	err := errors.Join(err1, nil, err2)
+	fmt.Println(err)
+
+	// Output:
+	// close muxer
+	// close file: EOF
+}
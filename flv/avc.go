@@ -0,0 +1,153 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The AVC codec for FLV video tag, like the ADTS for AAC.
+package flv
+
+import (
+	"github.com/ossrs/go-oryx-lib/avc"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The AVC codec for FLV video tag body.
+// We can encode the SPS/PPS to sequence header, and the NALUs of frame to video tag.
+// We can also decode the video tag to SPS/PPS or NALUs.
+// Refer to @doc video_file_format_spec_v10.pdf, @page 78, @section E.4.3 Video Tags
+type AVC interface {
+	// Encode the SPS and PPS to sequence header, the AVCDecoderConfigurationRecord.
+	// @remark The length of NALU in frame is 4 bytes.
+	EncodeSequenceHeader(sps, pps *avc.NALU) (tag []byte, err error)
+	// Encode the NALUs of frame to video tag, it's keyframe if got IDR.
+	// @remark User must encode or decode the sequence header first.
+	// @remark For RTMP/FLV: pts = dts + cts, where dts is timestamp in packet/tag.
+	Encode(cts int32, nalus ...*avc.NALU) (tag []byte, err error)
+
+	// Decode the video tag to frame and NALUs, the NALUs are SPS and PPS for sequence header.
+	// @remark The NALUs refer to the tag, never copied.
+	Decode(tag []byte) (frame *VideoFrame, nalus []*avc.NALU, err error)
+	// Get the AVCDecoderConfigurationRecord, the codec information.
+	// When encode or decode a sequence header, user can use this API to get it, otherwise nil.
+	AVCC() *avc.AVCDecoderConfigurationRecord
+}
+
+type avcCodec struct {
+	avcc *avc.AVCDecoderConfigurationRecord
+}
+
+func NewAVC() (AVC, error) {
+	return &avcCodec{}, nil
+}
+
+func (v *avcCodec) AVCC() *avc.AVCDecoderConfigurationRecord {
+	return v.avcc
+}
+
+func (v *avcCodec) EncodeSequenceHeader(sps, pps *avc.NALU) (tag []byte, err error) {
+	if len(sps.Data) < 3 {
+		return nil, oe.Errorf("requires 4+ SPS only %v bytes", sps.Size())
+	}
+
+	var bsps, bpps []byte
+	if bsps, err = sps.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal sps")
+	}
+	if bpps, err = pps.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal pps")
+	}
+
+	// The profile_idc, constraint_set flags and level_idc is the first 3 bytes of SPS.
+	// Refer to @doc ISO_IEC_14496-15-AVC-format-2012.pdf, @page 16, @section 5.2.4.1.1 Syntax
+	// @see SrsRawH264Stream::mux_sequence_header
+	b := []byte{0x01, sps.Data[0], sps.Data[1], sps.Data[2], 0xff}
+	b = append(b, 0xe1, byte(len(bsps)>>8), byte(len(bsps)))
+	b = append(b, bsps...)
+	b = append(b, 0x01, byte(len(bpps)>>8), byte(len(bpps)))
+	b = append(b, bpps...)
+
+	avcc := avc.NewAVCDecoderConfigurationRecord()
+	if err = avcc.UnmarshalBinary(b); err != nil {
+		return nil, oe.WithMessage(err, "unmarshal avcc")
+	}
+	v.avcc = avcc
+
+	return (&videoPackager{}).Encode(&VideoFrame{
+		CodecID: VideoCodecAVC, FrameType: VideoFrameTypeKeyframe, Trait: VideoFrameTraitSequenceHeader, Raw: b,
+	})
+}
+
+func (v *avcCodec) Encode(cts int32, nalus ...*avc.NALU) (tag []byte, err error) {
+	if v.avcc == nil {
+		return nil, oe.New("no sequence header")
+	}
+
+	frameType := VideoFrameTypeInterframe
+	for _, nalu := range nalus {
+		if nalu.NALUType == avc.NALUTypeIDR {
+			frameType = VideoFrameTypeKeyframe
+		}
+	}
+
+	sample := avc.NewAVCSample(v.avcc.LengthSizeMinusOne)
+	sample.NALUs = nalus
+
+	var b []byte
+	if b, err = sample.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal sample")
+	}
+
+	return (&videoPackager{}).Encode(&VideoFrame{
+		CodecID: VideoCodecAVC, FrameType: frameType, Trait: VideoFrameTraitNALU, CTS: cts, Raw: b,
+	})
+}
+
+func (v *avcCodec) Decode(tag []byte) (frame *VideoFrame, nalus []*avc.NALU, err error) {
+	if frame, err = (&videoPackager{}).Decode(tag); err != nil {
+		return nil, nil, oe.WithMessage(err, "decode video")
+	}
+
+	if frame.CodecID != VideoCodecAVC {
+		return nil, nil, oe.Errorf("invalid codec %v", frame.CodecID)
+	}
+
+	switch frame.Trait {
+	case VideoFrameTraitSequenceHeader:
+		avcc := avc.NewAVCDecoderConfigurationRecord()
+		if err = avcc.UnmarshalBinary(frame.Raw); err != nil {
+			return nil, nil, oe.WithMessage(err, "unmarshal avcc")
+		}
+		v.avcc = avcc
+
+		nalus = append(nalus, avcc.SequenceParameterSetNALUnits...)
+		nalus = append(nalus, avcc.PictureParameterSetNALUnits...)
+	case VideoFrameTraitNALU:
+		if v.avcc == nil {
+			return nil, nil, oe.New("no sequence header")
+		}
+
+		sample := avc.NewAVCSample(v.avcc.LengthSizeMinusOne)
+		if err = sample.UnmarshalBinary(frame.Raw); err != nil {
+			return nil, nil, oe.WithMessage(err, "unmarshal sample")
+		}
+		nalus = sample.NALUs
+	}
+
+	return
+}
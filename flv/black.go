@@ -0,0 +1,352 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The black frames, to keep the video track alive when source is interrupted.
+package flv
+
+import (
+	"github.com/ossrs/go-oryx-lib/avc"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The black color in YUV, video range.
+const (
+	blackY  = 16
+	blackUV = 128
+)
+
+// The BlackFrames generates the minimal H.264 black frames, which is encoded in baseline
+// profile without any encoder, so servers can keep a video track alive during source
+// interruptions instead of stalling players. It works at any even resolution, for
+// example, the common 640x360, 1280x720 and 1920x1080.
+// The keyframe is a IDR, the first macroblock is I_PCM in black, others are I_16x16 predicted
+// from it. The other frames are P frames, all macroblocks are skipped.
+// @remark The frame must be sent in order, because P frame refers to previous frame.
+type BlackFrames struct {
+	// The interval of keyframe, in frames, default to 30.
+	GOP int
+	// The size of picture in pixels and macroblocks.
+	width, height     int
+	mbWidth, mbHeight int
+	// The parameter sets, in RBSP.
+	sps, pps []byte
+}
+
+func NewBlackFrames(width, height int) (*BlackFrames, error) {
+	if width <= 0 || height <= 0 || width%2 != 0 || height%2 != 0 {
+		return nil, oe.Errorf("invalid size %vx%v", width, height)
+	}
+
+	v := &BlackFrames{GOP: 30, width: width, height: height}
+	v.mbWidth, v.mbHeight = (width+15)/16, (height+15)/16
+	v.sps, v.pps = v.encodeSPS(), v.encodePPS()
+	return v, nil
+}
+
+// The FLV video tag of AVC sequence header.
+func (v *BlackFrames) SequenceHeader() (tag []byte, err error) {
+	sps := &avc.NALU{
+		NALUHeader: &avc.NALUHeader{NALRefIDC: 3, NALUType: avc.NALUTypeSPS},
+		Data:       v.sps[1:],
+	}
+	pps := &avc.NALU{
+		NALUHeader: &avc.NALUHeader{NALRefIDC: 3, NALUType: avc.NALUTypePPS},
+		Data:       v.pps[1:],
+	}
+
+	r := avc.NewAVCDecoderConfigurationRecord()
+	r.AVCProfileIndication = avc.AVCProfileBaseline
+	r.AVCLevelIndication = v.level()
+	r.LengthSizeMinusOne = 3
+	r.SequenceParameterSetNALUnits = []*avc.NALU{sps}
+	r.PictureParameterSetNALUnits = []*avc.NALU{pps}
+
+	var raw []byte
+	if raw, err = r.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal sequence header")
+	}
+
+	return v.encodeTag(VideoFrameTypeKeyframe, VideoFrameTraitSequenceHeader, raw)
+}
+
+// The FLV video tag of n-th frame, starts from 0, the keyframe is at every GOP frames.
+func (v *BlackFrames) Frame(n int) (tag []byte, err error) {
+	gop := v.GOP
+	if gop <= 0 {
+		gop = 30
+	}
+
+	frameType, nalu := VideoFrameTypeKeyframe, &avc.NALU{}
+	if n%gop == 0 {
+		// The consecutive IDR must use different idr_pic_id.
+		nalu.NALUHeader = &avc.NALUHeader{NALRefIDC: 3, NALUType: avc.NALUTypeIDR}
+		nalu.Data = v.encodeIDR((n / gop) % 2)[1:]
+	} else {
+		frameType = VideoFrameTypeInterframe
+		nalu.NALUHeader = &avc.NALUHeader{NALRefIDC: 2, NALUType: avc.NALUTypeNonIDR}
+		nalu.Data = v.encodeP(n % gop)[1:]
+	}
+
+	sample := avc.NewAVCSample(3)
+	sample.NALUs = []*avc.NALU{nalu}
+
+	var raw []byte
+	if raw, err = sample.MarshalBinary(); err != nil {
+		return nil, oe.WithMessage(err, "marshal sample")
+	}
+
+	return v.encodeTag(frameType, VideoFrameTraitNALU, raw)
+}
+
+func (v *BlackFrames) encodeTag(frameType VideoFrameType, trait VideoFrameTrait, raw []byte) ([]byte, error) {
+	p, err := NewVideoPackager()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Encode(&VideoFrame{CodecID: VideoCodecAVC, FrameType: frameType, Trait: trait, Raw: raw})
+}
+
+// The level by the frame size in macroblocks, see Table A-1 – Level limits.
+func (v *BlackFrames) level() avc.AVCLevel {
+	mbs := v.mbWidth * v.mbHeight
+	switch {
+	case mbs <= 1620:
+		return avc.AVCLevel_3
+	case mbs <= 3600:
+		return avc.AVCLevel_31
+	case mbs <= 5120:
+		return avc.AVCLevel_32
+	case mbs <= 8192:
+		return avc.AVCLevel_4
+	case mbs <= 22080:
+		return avc.AVCLevel_5
+	default:
+		return avc.AVCLevel_51
+	}
+}
+
+// The log2_max_frame_num_minus4, the frame_num is 8 bits.
+const blackLog2MaxFrameNumMinus4 = 4
+
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 48, 7.3.2.1 Sequence parameter set RBSP syntax
+func (v *BlackFrames) encodeSPS() []byte {
+	b := &bitWriter{}
+	b.writeBits(3<<5|uint32(avc.NALUTypeSPS), 8)
+	b.writeBits(uint32(avc.AVCProfileBaseline), 8) // profile_idc
+	b.writeBits(0, 8)                              // constraint_set_flags and reserved_zero_4bits
+	b.writeBits(uint32(v.level()), 8)              // level_idc
+	b.writeUE(0)                                   // seq_parameter_set_id
+	b.writeUE(blackLog2MaxFrameNumMinus4)          // log2_max_frame_num_minus4
+	b.writeUE(2)                                   // pic_order_cnt_type, no B frames.
+	b.writeUE(1)                                   // num_ref_frames
+	b.writeBits(0, 1)                              // gaps_in_frame_num_value_allowed_flag
+	b.writeUE(uint32(v.mbWidth - 1))               // pic_width_in_mbs_minus1
+	b.writeUE(uint32(v.mbHeight - 1))              // pic_height_in_map_units_minus1
+	b.writeBits(1, 1)                              // frame_mbs_only_flag
+	b.writeBits(1, 1)                              // direct_8x8_inference_flag
+
+	// The crop unit is 2 pixels for 4:2:0.
+	cropRight, cropBottom := (v.mbWidth*16-v.width)/2, (v.mbHeight*16-v.height)/2
+	if cropRight == 0 && cropBottom == 0 {
+		b.writeBits(0, 1) // frame_cropping_flag
+	} else {
+		b.writeBits(1, 1)
+		b.writeUE(0)                  // frame_crop_left_offset
+		b.writeUE(uint32(cropRight))  // frame_crop_right_offset
+		b.writeUE(0)                  // frame_crop_top_offset
+		b.writeUE(uint32(cropBottom)) // frame_crop_bottom_offset
+	}
+
+	b.writeBits(0, 1) // vui_parameters_present_flag
+	b.writeTrailingBits()
+	return b.bytes()
+}
+
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 49, 7.3.2.2 Picture parameter set RBSP syntax
+func (v *BlackFrames) encodePPS() []byte {
+	b := &bitWriter{}
+	b.writeBits(3<<5|uint32(avc.NALUTypePPS), 8)
+	b.writeUE(0)      // pic_parameter_set_id
+	b.writeUE(0)      // seq_parameter_set_id
+	b.writeBits(0, 1) // entropy_coding_mode_flag, CAVLC
+	b.writeBits(0, 1) // pic_order_present_flag
+	b.writeUE(0)      // num_slice_groups_minus1
+	b.writeUE(0)      // num_ref_idx_l0_active_minus1
+	b.writeUE(0)      // num_ref_idx_l1_active_minus1
+	b.writeBits(0, 1) // weighted_pred_flag
+	b.writeBits(0, 2) // weighted_bipred_idc
+	b.writeSE(0)      // pic_init_qp_minus26
+	b.writeSE(0)      // pic_init_qs_minus26
+	b.writeSE(0)      // chroma_qp_index_offset
+	b.writeBits(1, 1) // deblocking_filter_control_present_flag
+	b.writeBits(0, 1) // constrained_intra_pred_flag
+	b.writeBits(0, 1) // redundant_pic_cnt_present_flag
+	b.writeTrailingBits()
+	return b.bytes()
+}
+
+// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 50, 7.3.3 Slice header syntax
+func (v *BlackFrames) encodeIDR(idrPicID int) []byte {
+	b := &bitWriter{}
+	b.writeBits(3<<5|uint32(avc.NALUTypeIDR), 8)
+	b.writeUE(0)                                 // first_mb_in_slice
+	b.writeUE(7)                                 // slice_type, I slice.
+	b.writeUE(0)                                 // pic_parameter_set_id
+	b.writeBits(0, blackLog2MaxFrameNumMinus4+4) // frame_num
+	b.writeUE(uint32(idrPicID))                  // idr_pic_id
+	b.writeBits(0, 1)                            // no_output_of_prior_pics_flag
+	b.writeBits(0, 1)                            // long_term_reference_flag
+	b.writeSE(0)                                 // slice_qp_delta
+	b.writeUE(1)                                 // disable_deblocking_filter_idc
+
+	// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 56, 7.3.4 Slice data syntax
+	for y := 0; y < v.mbHeight; y++ {
+		for x := 0; x < v.mbWidth; x++ {
+			if x == 0 && y == 0 {
+				// The I_PCM macroblock in black.
+				b.writeUE(25) // mb_type, I_PCM
+				b.writeAlignZeroBits()
+				for i := 0; i < 16*16; i++ {
+					b.writeBits(blackY, 8)
+				}
+				for i := 0; i < 2*8*8; i++ {
+					b.writeBits(blackUV, 8)
+				}
+				continue
+			}
+
+			// The I_16x16_2_0_0 macroblock, DC predicted without residual.
+			b.writeUE(3) // mb_type, I_16x16_2_0_0
+			b.writeUE(0) // intra_chroma_pred_mode, DC
+			b.writeSE(0) // mb_qp_delta
+
+			// The coeff_token of Intra16x16DCLevel, TotalCoeff=0 and TrailingOnes=0,
+			// the table is selected by nC, and nN is 16 for the I_PCM neighbour.
+			// @doc ISO_IEC_14496-10-AVC-2003.pdf at page 156, 9.2.1 Parsing process for total number of transform coefficient levels and trailing ones
+			if (x == 1 && y == 0) || (x == 0 && y == 1) {
+				b.writeBits(0x03, 6) // 8 <= nC, 0000 11
+			} else {
+				b.writeBits(0x01, 1) // 0 <= nC < 2, 1
+			}
+		}
+	}
+
+	b.writeTrailingBits()
+	return b.bytes()
+}
+
+func (v *BlackFrames) encodeP(frameNum int) []byte {
+	b := &bitWriter{}
+	b.writeBits(2<<5|uint32(avc.NALUTypeNonIDR), 8)
+	b.writeUE(0)                                                // first_mb_in_slice
+	b.writeUE(5)                                                // slice_type, P slice.
+	b.writeUE(0)                                                // pic_parameter_set_id
+	b.writeBits(uint32(frameNum), blackLog2MaxFrameNumMinus4+4) // frame_num
+	b.writeBits(0, 1)                                           // num_ref_idx_active_override_flag
+	b.writeBits(0, 1)                                           // ref_pic_list_reordering_flag_l0
+	b.writeBits(0, 1)                                           // adaptive_ref_pic_marking_mode_flag
+	b.writeSE(0)                                                // slice_qp_delta
+	b.writeUE(1)                                                // disable_deblocking_filter_idc
+
+	// All macroblocks are P_Skip.
+	b.writeUE(uint32(v.mbWidth * v.mbHeight)) // mb_skip_run
+
+	b.writeTrailingBits()
+	return b.bytes()
+}
+
+// The bit writer for H.264 RBSP.
+type bitWriter struct {
+	b []byte
+	// The number of bits written.
+	pos uint
+}
+
+func (v *bitWriter) writeBit(bit uint32) {
+	if v.pos%8 == 0 {
+		v.b = append(v.b, 0)
+	}
+	if bit != 0 {
+		v.b[len(v.b)-1] |= 0x80 >> (v.pos % 8)
+	}
+	v.pos++
+}
+
+func (v *bitWriter) writeBits(value uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		v.writeBit((value >> uint(i)) & 0x01)
+	}
+}
+
+// Write the ue(v), see 9.1 Parsing process for Exp-Golomb codes.
+func (v *bitWriter) writeUE(value uint32) {
+	value++
+
+	var n int
+	for t := value; t > 1; t >>= 1 {
+		n++
+	}
+
+	v.writeBits(0, n)
+	v.writeBits(value, n+1)
+}
+
+// Write the se(v), see 9.1.1 Mapping process for signed Exp-Golomb codes.
+func (v *bitWriter) writeSE(value int32) {
+	if value > 0 {
+		v.writeUE(uint32(2*value - 1))
+	} else {
+		v.writeUE(uint32(-2 * value))
+	}
+}
+
+func (v *bitWriter) writeAlignZeroBits() {
+	for v.pos%8 != 0 {
+		v.writeBit(0)
+	}
+}
+
+// Write the rbsp_trailing_bits.
+func (v *bitWriter) writeTrailingBits() {
+	v.writeBit(1)
+	v.writeAlignZeroBits()
+}
+
+// Get the bytes of NALU, with emulation prevention bytes inserted.
+func (v *bitWriter) bytes() []byte {
+	var b []byte
+	var zeros int
+	for _, c := range v.b {
+		if zeros >= 2 && c <= 0x03 {
+			b = append(b, 0x03)
+			zeros = 0
+		}
+		b = append(b, c)
+
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return b
+}
@@ -23,6 +23,7 @@ package flv_test
 
 import (
 	"github.com/ossrs/go-oryx-lib/flv"
+	"hash/crc32"
 	"io"
 )
 
@@ -89,3 +90,55 @@ func ExampleMuxer() {
 		return
 	}
 }
+
+func ExampleCounter() {
+	// To open a flv file, or http flv stream.
+	var r io.Reader
+
+	var err error
+	var f flv.Demuxer
+	if f, err = flv.NewDemuxer(r); err != nil {
+		return
+	}
+	defer f.Close()
+
+	// Optional, enable the checksum before reading the header.
+	f.SetChecksum(crc32.NewIEEE())
+
+	// Read the header and tags, see ExampleDemuxer.
+
+	// Report the data volumes and the checksum, compare with the muxer of DVR.
+	_ = f.Bytes()
+	_ = f.Tags()
+	_ = f.Checksum()
+}
+
+func ExampleBlackFrames() {
+	// The muxer to write the black frames to.
+	var w flv.Muxer
+
+	var err error
+	var bf *flv.BlackFrames
+	if bf, err = flv.NewBlackFrames(1280, 720); err != nil {
+		return
+	}
+
+	// Write the sequence header when source is interrupted.
+	var tag []byte
+	if tag, err = bf.SequenceHeader(); err != nil {
+		return
+	}
+	if err = w.WriteTag(flv.TagTypeVideo, 0, tag); err != nil {
+		return
+	}
+
+	// Write the black frames in 25fps, until source is restored.
+	for i := 0; i < 100; i++ {
+		if tag, err = bf.Frame(i); err != nil {
+			return
+		}
+		if err = w.WriteTag(flv.TagTypeVideo, uint32(i*40), tag); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,390 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The fan-out writer, to duplicate a tag stream to multiple muxers.
+package flv
+
+import (
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"hash"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+)
+
+// The default number of tags queued for each sink.
+const defaultFanOutQueueSize = 1024
+
+// The FanOut duplicates the tags to multiple muxers, for example, the recorder, HTTP-FLV
+// and HLS segmenter. Each sink has its own queue and goroutine, so a slow sink never
+// stalls the others, and a failed sink is removed without affecting the others.
+// @remark When the queue of sink is full, the tags are dropped until next video keyframe.
+// @remark The sink added later got the header, metadata and sequence headers first.
+// @remark The tag is copied once and shared by sinks, so it's safe to reuse it after write.
+// @remark The header flags can be rewritten by UpdateHeader or AutoHeader, for the stream
+//		starts video-only and audio appears later, which only applies to sinks added later.
+type FanOut struct {
+	// The max number of tags queued for each sink, set before AddSink.
+	QueueSize int
+	// Whether update the header flags when got the audio or video tag not in header.
+	AutoHeader bool
+	// The hook when a sink fails and is removed, optional.
+	OnSinkError func(s *Sink, err error)
+
+	// To count the bytes and tags written.
+	counter *muxer
+
+	lock  sync.Mutex
+	sinks []*Sink
+	// The header, metadata and sequence headers, for sink added later.
+	header              *fanOutTag
+	metadata            *fanOutTag
+	videoSequenceHeader *fanOutTag
+	audioSequenceHeader *fanOutTag
+	closed              bool
+}
+
+func NewFanOut() *FanOut {
+	return &FanOut{
+		QueueSize: defaultFanOutQueueSize,
+		counter:   &muxer{w: ioutil.Discard},
+	}
+}
+
+// The tag or header in queue of sink.
+type fanOutTag struct {
+	// Whether it's the FLV header.
+	isHeader           bool
+	hasVideo, hasAudio bool
+
+	tagType   TagType
+	timestamp uint32
+	tag       []byte
+}
+
+// The Sink is a muxer of FanOut.
+type Sink struct {
+	// The name of sink, for example, recorder.
+	Name string
+
+	m     Muxer
+	queue chan *fanOutTag
+	done  chan struct{}
+	// The error when write to muxer, and the error when close the muxer.
+	err      error
+	closeErr error
+	// The number of dropped tags.
+	dropped uint64
+	// Whether drop tags until next video keyframe, for sink is full or added later.
+	waitKeyframe bool
+	// Whether the stream has video, to wait for keyframe.
+	hasVideo bool
+}
+
+// Get the number of tags dropped, because the sink is full.
+func (v *Sink) Dropped() uint64 {
+	return atomic.LoadUint64(&v.dropped)
+}
+
+// The channel closed when the sink is done, for error or removed.
+func (v *Sink) Done() <-chan struct{} {
+	return v.done
+}
+
+// Get the error of sink, valid after done.
+func (v *Sink) Err() error {
+	<-v.done
+	return v.err
+}
+
+// Add the muxer m as sink named name, which is closed when removed.
+func (v *FanOut) AddSink(name string, m Muxer) (s *Sink, err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.closed {
+		return nil, oe.New("fan-out closed")
+	}
+
+	queueSize := v.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultFanOutQueueSize
+	}
+
+	s = &Sink{
+		Name: name, m: m, queue: make(chan *fanOutTag, queueSize+4), done: make(chan struct{}),
+	}
+
+	// Feed the header and sequence headers, then wait for keyframe to start.
+	for _, t := range []*fanOutTag{v.header, v.metadata, v.videoSequenceHeader, v.audioSequenceHeader} {
+		if t != nil {
+			v.enqueue(s, t, true)
+		}
+	}
+	if v.header != nil {
+		s.hasVideo, s.waitKeyframe = v.header.hasVideo, true
+	}
+
+	v.sinks = append(v.sinks, s)
+	go v.serve(s)
+
+	return
+}
+
+// Remove the sink, wait for the queued tags to be written, then close the muxer.
+func (v *FanOut) RemoveSink(s *Sink) {
+	v.lock.Lock()
+	if v.remove(s) {
+		close(s.queue)
+	}
+	v.lock.Unlock()
+
+	<-s.done
+}
+
+// Get the sinks, exclude the removed ones.
+func (v *FanOut) Sinks() []*Sink {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return append([]*Sink(nil), v.sinks...)
+}
+
+// Remove the sink from list, return false if already removed. The caller should hold the lock.
+func (v *FanOut) remove(s *Sink) bool {
+	for i, e := range v.sinks {
+		if e == s {
+			v.sinks = append(v.sinks[:i], v.sinks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Write tags in queue to muxer, remove the sink when error.
+func (v *FanOut) serve(s *Sink) {
+	defer close(s.done)
+	defer func() {
+		s.closeErr = oe.WithMessage(s.m.Close(), s.Name)
+	}()
+
+	for t := range s.queue {
+		var err error
+		if t.isHeader {
+			err = s.m.WriteHeader(t.hasVideo, t.hasAudio)
+		} else {
+			err = s.m.WriteTag(t.tagType, t.timestamp, t.tag)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		s.err = oe.WithMessage(err, s.Name)
+
+		v.lock.Lock()
+		v.remove(s)
+		v.lock.Unlock()
+
+		if v.OnSinkError != nil {
+			v.OnSinkError(s, s.err)
+		}
+		return
+	}
+}
+
+// Put the tag to queue of sink, drop it if full. The caller should hold the lock.
+// @remark The header and sequence headers are never dropped, because the queue is reserved.
+func (v *FanOut) enqueue(s *Sink, t *fanOutTag, reserved bool) {
+	if !reserved {
+		if s.waitKeyframe && (!s.hasVideo || isVideoKeyframe(t)) {
+			s.waitKeyframe = false
+		}
+		if s.waitKeyframe || len(s.queue) >= cap(s.queue)-4 {
+			s.waitKeyframe = true
+			atomic.AddUint64(&s.dropped, 1)
+			return
+		}
+	}
+
+	select {
+	case s.queue <- t:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// Whether the tag is a video keyframe, not the sequence header.
+func isVideoKeyframe(t *fanOutTag) bool {
+	if t.tagType != TagTypeVideo || len(t.tag) < 2 {
+		return false
+	}
+	return VideoFrameType(t.tag[0]>>4) == VideoFrameTypeKeyframe && VideoFrameTrait(t.tag[1]) != VideoFrameTraitSequenceHeader
+}
+
+// Write the FLV header to all sinks.
+func (v *FanOut) WriteHeader(hasVideo, hasAudio bool) (err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.closed {
+		return oe.New("fan-out closed")
+	}
+
+	if err = v.counter.WriteHeader(hasVideo, hasAudio); err != nil {
+		return oe.WithMessage(err, "count")
+	}
+
+	v.header = &fanOutTag{isHeader: true, hasVideo: hasVideo, hasAudio: hasAudio}
+	for _, s := range v.sinks {
+		s.hasVideo = hasVideo
+		v.enqueue(s, v.header, true)
+	}
+
+	return
+}
+
+// Get the flags of header, which might be updated, false if no header.
+func (v *FanOut) Header() (hasVideo, hasAudio bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.header == nil {
+		return false, false
+	}
+	return v.header.hasVideo, v.header.hasAudio
+}
+
+// Rewrite the flags of header for sinks added later, for example, the new HTTP-FLV players,
+// while the sinks already got the header are not affected.
+// @remark It's ignored if no header.
+func (v *FanOut) UpdateHeader(hasVideo, hasAudio bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.updateHeader(hasVideo, hasAudio)
+}
+
+// Update the header, the caller should hold the lock.
+func (v *FanOut) updateHeader(hasVideo, hasAudio bool) {
+	if v.header == nil || (v.header.hasVideo == hasVideo && v.header.hasAudio == hasAudio) {
+		return
+	}
+
+	// The header might be in queue of sinks, so never modify it.
+	v.header = &fanOutTag{isHeader: true, hasVideo: hasVideo, hasAudio: hasAudio}
+
+	// Wait for keyframe when sink drops tags, for the video appears.
+	for _, s := range v.sinks {
+		s.hasVideo = hasVideo
+	}
+}
+
+// Write a tag to all sinks, never block for the slow sinks.
+func (v *FanOut) WriteTag(tagType TagType, timestamp uint32, tag []byte) (err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.closed {
+		return oe.New("fan-out closed")
+	}
+
+	if err = v.counter.WriteTag(tagType, timestamp, tag); err != nil {
+		return oe.WithMessage(err, "count")
+	}
+
+	if h := v.header; v.AutoHeader && h != nil {
+		if tagType == TagTypeVideo && !h.hasVideo {
+			v.updateHeader(true, h.hasAudio)
+		} else if tagType == TagTypeAudio && !h.hasAudio {
+			v.updateHeader(h.hasVideo, true)
+		}
+	}
+
+	t := &fanOutTag{tagType: tagType, timestamp: timestamp, tag: append([]byte(nil), tag...)}
+
+	// Cache the metadata and sequence headers for sink added later.
+	var reserved bool
+	switch {
+	case tagType == TagTypeScriptData:
+		v.metadata, reserved = t, true
+	case tagType == TagTypeVideo && len(tag) > 1 && VideoFrameTrait(tag[1]) == VideoFrameTraitSequenceHeader:
+		v.videoSequenceHeader, reserved = t, true
+	case tagType == TagTypeAudio && len(tag) > 1 && AudioCodec(tag[0]>>4) == AudioCodecAAC && AudioFrameTrait(tag[1]) == AudioFrameTraitSequenceHeader:
+		v.audioSequenceHeader, reserved = t, true
+	}
+
+	for _, s := range v.sinks {
+		v.enqueue(s, t, reserved)
+	}
+
+	return
+}
+
+// The number of bytes written.
+func (v *FanOut) Bytes() uint64 {
+	return v.counter.Bytes()
+}
+
+// The number of tags written.
+func (v *FanOut) Tags() uint64 {
+	return v.counter.Tags()
+}
+
+// Set the hash of bytes written, call before write.
+func (v *FanOut) SetChecksum(h hash.Hash) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.counter.SetChecksum(h)
+}
+
+// The checksum of bytes written.
+func (v *FanOut) Checksum() []byte {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.counter.Checksum()
+}
+
+// Add the handler of tags written, before the tags are queued to sinks.
+func (v *FanOut) OnTag(h TagHandler) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.counter.OnTag(h)
+}
+
+// Close the fan-out, wait for all sinks to write the queued tags, then close them.
+// @return The errors of all sinks when close the muxers, see errors.Join.
+func (v *FanOut) Close() error {
+	v.lock.Lock()
+	v.closed = true
+	sinks := v.sinks
+	v.sinks = nil
+	for _, s := range sinks {
+		close(s.queue)
+	}
+	v.lock.Unlock()
+
+	var errs []error
+	for _, s := range sinks {
+		<-s.done
+		errs = append(errs, s.closeErr)
+	}
+
+	return oe.Join(errs...)
+}
@@ -0,0 +1,86 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The fixer for the audio tag header, which mismatch the actual codec config.
+package flv
+
+import (
+	"github.com/ossrs/go-oryx-lib/aac"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"sync/atomic"
+)
+
+// The SoundRateFixer detects the mismatch between the SoundRate/SoundType bits in FLV
+// audio tag header and the actual sample rate/channels in AAC ASC(sequence header),
+// and rewrites the tag header accordingly, to prevent player pitch or sync issues.
+// @remark Only for AAC, other codecs are not changed.
+// @remark The tag is never modified, a new tag is returned when fixed.
+type SoundRateFixer struct {
+	// The expected header from ASC, ok if got ASC.
+	rate     AudioSamplingRate
+	channels AudioChannels
+	ok       bool
+	// The number of fixed tags.
+	fixed uint64
+}
+
+func NewSoundRateFixer() *SoundRateFixer {
+	return &SoundRateFixer{}
+}
+
+// Get the number of fixed tags.
+func (v *SoundRateFixer) Fixed() uint64 {
+	return atomic.LoadUint64(&v.fixed)
+}
+
+// Fix the FLV audio tag body, return the tag itself if no mismatch.
+func (v *SoundRateFixer) Fix(tag []byte) (fixed []byte, err error) {
+	if len(tag) < 2 || AudioCodec(tag[0]>>4) != AudioCodecAAC {
+		return tag, nil
+	}
+
+	// Update the expected sample rate and channels when got ASC.
+	if AudioFrameTrait(tag[1]) == AudioFrameTraitSequenceHeader {
+		var asc aac.AudioSpecificConfig
+		if err = asc.UnmarshalBinary(tag[2:]); err != nil {
+			return nil, oe.WithMessage(err, "unmarshal asc")
+		}
+
+		v.rate.From(asc.SampleRate)
+		v.channels.From(asc.Channels)
+		v.ok = v.rate != AudioSamplingRateForbidden && v.channels != AudioChannelsForbidden
+	}
+
+	if !v.ok {
+		return tag, nil
+	}
+
+	// Refer to @doc video_file_format_spec_v10.pdf, @page 76, @section E.4.2 Audio Tags
+	h := tag[0]&0xf2 | byte(v.rate)<<2 | byte(v.channels)
+	if h == tag[0] {
+		return tag, nil
+	}
+
+	atomic.AddUint64(&v.fixed, 1)
+
+	fixed = append([]byte{h}, tag[1:]...)
+	return
+}
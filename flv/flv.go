@@ -26,8 +26,12 @@ import (
 	"bytes"
 	"errors"
 	"github.com/ossrs/go-oryx-lib/aac"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"hash"
 	"io"
 	"strings"
+	"sync/atomic"
 )
 
 // FLV Tag Type is the type of tag,
@@ -59,7 +63,8 @@ func (v TagType) String() string {
 // A FLV file must consist the bellow parts:
 //	1. A FLV header, refer to @doc video_file_format_spec_v10.pdf, @page 8, @section The FLV header
 //	2. One or more tags, refer to @doc video_file_format_spec_v10.pdf, @page 9, @section FLV tags
-// @remark We always ignore the previous tag size.
+// @remark We ignore the previous tag size, except in strict or lenient mode, see ParseMode.
+// @remark Not goroutine-safe, the ReadTagHeader and ReadTag should be called in one goroutine.
 type Demuxer interface {
 	// Read the FLV header, return the version of FLV, whether hasVideo or hasAudio in header.
 	ReadHeader() (version uint8, hasVideo, hasAudio bool, err error)
@@ -68,22 +73,151 @@ type Demuxer interface {
 	ReadTagHeader() (tagType TagType, tagSize, timestamp uint32, err error)
 	// Read the FLV tag body, drop the next 4 bytes previous tag size.
 	ReadTag(tagSize uint32) (tag []byte, err error)
+	// The counters and checksum of bytes read.
+	Counter
+	// The taps of tags read.
+	Tapper
 	// Close the demuxer.
 	Close() error
 }
 
+// The counter of FLV muxer or demuxer, for relay tools to report the data volumes,
+// and verify the integrity between ingest and output.
+// @remark The counters are safe to get in other goroutines, but the checksum is not.
+type Counter interface {
+	// The total number of bytes, including FLV header and previous tag size.
+	Bytes() uint64
+	// The total number of tags.
+	Tags() uint64
+	// Enable the checksum of all bytes by h, for example, crc32.NewIEEE() or md5.New().
+	// @remark Should be set before read or write the header.
+	SetChecksum(h hash.Hash)
+	// Get the checksum of all bytes, nil if not enabled.
+	Checksum() []byte
+}
+
+type counter struct {
+	bytes uint64
+	tags  uint64
+	h     hash.Hash
+}
+
+func (v *counter) Bytes() uint64 {
+	return atomic.LoadUint64(&v.bytes)
+}
+
+func (v *counter) Tags() uint64 {
+	return atomic.LoadUint64(&v.tags)
+}
+
+func (v *counter) SetChecksum(h hash.Hash) {
+	v.h = h
+}
+
+func (v *counter) Checksum() []byte {
+	if v.h == nil {
+		return nil
+	}
+	return v.h.Sum(nil)
+}
+
+func (v *counter) update(p []byte) {
+	atomic.AddUint64(&v.bytes, uint64(len(p)))
+	if v.h != nil {
+		v.h.Write(p)
+	}
+}
+
+// The handler of tag, the tag is the body without header and previous tag size.
+// @remark The tag refers to the buffer of muxer or demuxer, copy it if kept.
+type TagHandler func(tagType TagType, timestamp uint32, tag []byte)
+
+// The tap of FLV muxer or demuxer, to observe the tags without wrapping the reader
+// or writer, for example, for metrics, validation or thumbnail extraction.
+// @remark The handlers are called in the goroutine which reads or writes tags, so never block.
+type Tapper interface {
+	// Add the handler which is called after a tag is read or written successfully.
+	// @remark Should be set before read or write the tags.
+	OnTag(h TagHandler)
+}
+
+type tapper struct {
+	handlers []TagHandler
+}
+
+func (v *tapper) OnTag(h TagHandler) {
+	v.handlers = append(v.handlers, h)
+}
+
+func (v *tapper) tap(tagType TagType, timestamp uint32, tag []byte) {
+	for _, h := range v.handlers {
+		h(tagType, timestamp, tag)
+	}
+}
+
 // When FLV signature is not "FLV"
 var errSignature = errors.New("FLV signatures are illegal")
 
+// The mode to parse FLV, for the spec violations, such as bad header flags,
+// timestamp regressions and wrong previous tag size.
+type ParseMode uint8
+
+const (
+	// Ignore the violations, the default mode.
+	ParseModeIgnore ParseMode = iota
+	// Log the violations and repair them, for ingesting from diverse encoders.
+	ParseModeLenient
+	// Error on the violations, for validation tools.
+	ParseModeStrict
+)
+
+func (v ParseMode) String() string {
+	switch v {
+	case ParseModeLenient:
+		return "Lenient"
+	case ParseModeStrict:
+		return "Strict"
+	default:
+		return "Ignore"
+	}
+}
+
 // Create a demuxer object.
 func NewDemuxer(r io.Reader) (Demuxer, error) {
+	return NewDemuxerMode(r, ParseModeIgnore)
+}
+
+// Create a demuxer object, which parse in mode.
+func NewDemuxerMode(r io.Reader, mode ParseMode) (Demuxer, error) {
 	return &demuxer{
-		r: r,
+		r:    r,
+		mode: mode,
 	}, nil
 }
 
 type demuxer struct {
-	r io.Reader
+	counter
+	tapper
+	r    io.Reader
+	mode ParseMode
+	// The size of last tag, to check the previous tag size.
+	tagSize uint32
+	// The last timestamp of audio and video, to check the regression.
+	timestamps map[TagType]uint32
+	// The type and timestamp of last tag header, for the taps.
+	tagType   TagType
+	timestamp uint32
+}
+
+// Handle the violation by mode, return error in strict mode.
+func (v *demuxer) violate(format string, a ...interface{}) error {
+	switch v.mode {
+	case ParseModeStrict:
+		return oe.Errorf(format, a...)
+	case ParseModeLenient:
+		ol.Wf(nil, "flv: "+format, a...)
+	}
+	return nil
 }
 
 func (v *demuxer) ReadHeader() (version uint8, hasVideo, hasAudio bool, err error) {
@@ -93,6 +227,7 @@ func (v *demuxer) ReadHeader() (version uint8, hasVideo, hasAudio bool, err erro
 	}
 
 	p := h.Bytes()
+	v.update(p)
 
 	if !bytes.Equal([]byte{byte('F'), byte('L'), byte('V')}, p[:3]) {
 		err = errSignature
@@ -103,6 +238,17 @@ func (v *demuxer) ReadHeader() (version uint8, hasVideo, hasAudio bool, err erro
 	hasVideo = (p[4] & 0x01) == 0x01
 	hasAudio = ((p[4] >> 2) & 0x01) == 0x01
 
+	if v.mode != ParseModeIgnore {
+		// The reserved bits must be 0, the header size is 9, and the first previous tag size is 0.
+		if flags := p[4]; flags&0xfa != 0 {
+			err = v.violate("header flags %#x reserved bits not zero", flags)
+		} else if offset := uint32(p[5])<<24 | uint32(p[6])<<16 | uint32(p[7])<<8 | uint32(p[8]); offset != 9 {
+			err = v.violate("header data offset %v, should be 9", offset)
+		} else if pts := uint32(p[9])<<24 | uint32(p[10])<<16 | uint32(p[11])<<8 | uint32(p[12]); pts != 0 {
+			err = v.violate("previous tag size %v, should be 0", pts)
+		}
+	}
+
 	return
 }
 
@@ -113,11 +259,29 @@ func (v *demuxer) ReadTagHeader() (tagType TagType, tagSize uint32, timestamp ui
 	}
 
 	p := h.Bytes()
+	v.update(p)
 
 	tagType = TagType(p[0])
 	tagSize = uint32(p[1])<<16 | uint32(p[2])<<8 | uint32(p[3])
 	timestamp = uint32(p[7])<<24 | uint32(p[4])<<16 | uint32(p[5])<<8 | uint32(p[6])
 
+	if v.mode != ParseModeIgnore && (tagType == TagTypeAudio || tagType == TagTypeVideo) {
+		if v.timestamps == nil {
+			v.timestamps = make(map[TagType]uint32)
+		}
+
+		// Repair the regression by the last timestamp of track.
+		if last, ok := v.timestamps[tagType]; ok && timestamp < last {
+			if err = v.violate("%v timestamp regress from %v to %v", tagType, last, timestamp); err != nil {
+				return
+			}
+			timestamp = last
+		}
+		v.timestamps[tagType] = timestamp
+	}
+
+	v.tagType, v.timestamp = tagType, timestamp
+
 	return
 }
 
@@ -128,8 +292,22 @@ func (v *demuxer) ReadTag(tagSize uint32) (tag []byte, err error) {
 	}
 
 	p := h.Bytes()
+	v.update(p)
+	atomic.AddUint64(&v.tags, 1)
+
 	tag = p[0 : len(p)-4]
 
+	if v.mode != ParseModeIgnore {
+		pts := p[len(p)-4:]
+		if size := uint32(pts[0])<<24 | uint32(pts[1])<<16 | uint32(pts[2])<<8 | uint32(pts[3]); size != tagSize+11 {
+			err = v.violate("previous tag size %v, should be %v", size, tagSize+11)
+		}
+	}
+
+	if err == nil {
+		v.tap(v.tagType, v.timestamp, tag)
+	}
+
 	return
 }
 
@@ -139,11 +317,16 @@ func (v *demuxer) Close() error {
 
 // The FLV muxer is used to write packet in FLV protocol.
 // Refer to @doc video_file_format_spec_v10.pdf, @page 74, @section Annex E. The FLV File Format
+// @remark Not goroutine-safe, use NewSyncMuxer for multiple goroutines, except the counters.
 type Muxer interface {
 	// Write the FLV header.
 	WriteHeader(hasVideo, hasAudio bool) (err error)
 	// Write A FLV tag.
 	WriteTag(tagType TagType, timestamp uint32, tag []byte) (err error)
+	// The counters and checksum of bytes written.
+	Counter
+	// The taps of tags written.
+	Tapper
 	// Close the muxer.
 	Close() error
 }
@@ -156,9 +339,20 @@ func NewMuxer(w io.Writer) (Muxer, error) {
 }
 
 type muxer struct {
+	counter
+	tapper
 	w io.Writer
 }
 
+func (v *muxer) write(p []byte) (err error) {
+	if _, err = io.Copy(v.w, bytes.NewReader(p)); err != nil {
+		return
+	}
+
+	v.update(p)
+	return
+}
+
 func (v *muxer) WriteHeader(hasVideo, hasAudio bool) (err error) {
 	var flags byte
 	if hasVideo {
@@ -168,15 +362,13 @@ func (v *muxer) WriteHeader(hasVideo, hasAudio bool) (err error) {
 		flags |= 0x04
 	}
 
-	r := bytes.NewReader([]byte{
+	if err = v.write([]byte{
 		byte('F'), byte('L'), byte('V'),
 		0x01,
 		flags,
 		0x00, 0x00, 0x00, 0x09,
 		0x00, 0x00, 0x00, 0x00,
-	})
-
-	if _, err = io.Copy(v.w, r); err != nil {
+	}); err != nil {
 		return
 	}
 
@@ -187,33 +379,31 @@ func (v *muxer) WriteTag(tagType TagType, timestamp uint32, tag []byte) (err err
 	// Tag header.
 	tagSize := uint32(len(tag))
 
-	r := bytes.NewReader([]byte{
+	if err = v.write([]byte{
 		byte(tagType),
 		byte(tagSize >> 16), byte(tagSize >> 8), byte(tagSize),
 		byte(timestamp >> 16), byte(timestamp >> 8), byte(timestamp),
 		byte(timestamp >> 24),
 		0x00, 0x00, 0x00,
-	})
-
-	if _, err = io.Copy(v.w, r); err != nil {
+	}); err != nil {
 		return
 	}
 
 	// TAG
-	if _, err = io.Copy(v.w, bytes.NewReader(tag)); err != nil {
+	if err = v.write(tag); err != nil {
 		return
 	}
 
 	// Previous tag size.
 	pts := uint32(11 + len(tag))
-	r = bytes.NewReader([]byte{
+	if err = v.write([]byte{
 		byte(pts >> 24), byte(pts >> 16), byte(pts >> 8), byte(pts),
-	})
-
-	if _, err = io.Copy(v.w, r); err != nil {
+	}); err != nil {
 		return
 	}
 
+	atomic.AddUint64(&v.tags, 1)
+	v.tap(tagType, timestamp, tag)
 	return
 }
 
@@ -686,14 +876,55 @@ type VideoFrame struct {
 	CodecID   VideoCodec
 	FrameType VideoFrameType
 	Trait     VideoFrameTrait
-	CTS       int32
-	Raw       []byte
+	// The composition time offset in ms, which is SI24 and might be negative.
+	CTS int32
+	Raw []byte
 }
 
 func NewVideoFrame() *VideoFrame {
 	return &VideoFrame{}
 }
 
+// Get the PTS of frame, where dts is the timestamp of tag or RTMP message.
+func (v *VideoFrame) PTS(dts uint32) uint32 {
+	return ToPTS(dts, v.CTS)
+}
+
+// Convert the DTS and CTS to PTS, in ms.
+// @remark For RTMP/FLV: pts = dts + cts, where dts is timestamp in packet/tag.
+func ToPTS(dts uint32, cts int32) uint32 {
+	return uint32(int64(dts) + int64(cts))
+}
+
+// Convert the DTS and PTS to CTS, in ms, for example, to remux the frames of
+// other container to FLV, where B-frames got PTS different from DTS.
+func ToCTS(dts, pts uint32) int32 {
+	return int32(int64(pts) - int64(dts))
+}
+
+// Read the CTS of FLV video tag, without decoding the frame.
+// @remark The cts is 0 for codecs other than AVC or HEVC.
+func VideoTagCTS(tag []byte) (cts int32, err error) {
+	if len(tag) < 1 {
+		return 0, errDataNotEnough
+	}
+
+	if codec := VideoCodec(tag[0] & 0x0f); codec != VideoCodecAVC && codec != VideoCodecHEVC {
+		return 0, nil
+	}
+
+	if len(tag) < 5 {
+		return 0, errDataNotEnough
+	}
+	return parseCTS(tag[2:5]), nil
+}
+
+// Parse the SI24 CTS, sign extends to int32.
+func parseCTS(p []byte) int32 {
+	cts := uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+	return int32(cts<<8) >> 8
+}
+
 // The packager used to codec the FLV video tag body.
 // Refer to @doc video_file_format_spec_v10.pdf, @page 78, @section E.4.3 Video Tags
 type VideoPackager interface {
@@ -724,7 +955,7 @@ func (v *videoPackager) Decode(tag []byte) (frame *VideoFrame, err error) {
 
 	if frame.CodecID == VideoCodecAVC || frame.CodecID == VideoCodecHEVC {
 		frame.Trait = VideoFrameTrait(p[1])
-		frame.CTS = int32(uint32(p[2])<<16 | uint32(p[3])<<8 | uint32(p[4]))
+		frame.CTS = parseCTS(p[2:5])
 		frame.Raw = tag[5:]
 	} else {
 		frame.Raw = tag[1:]
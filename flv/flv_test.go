@@ -0,0 +1,1196 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package flv_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	"github.com/ossrs/go-oryx-lib/avc"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/flv/flvtest"
+	"github.com/ossrs/go-oryx-lib/mp3"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestMuxDemux_Golden(t *testing.T) {
+	f := flvtest.Generate(100)
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flvtest.Golden(t, "testdata/avc_aac.flv", b, *update)
+
+	// Demux the fixture file, should be identical to the generated.
+	var r *flvtest.Fixture
+	if r, err = flvtest.Load("testdata/avc_aac.flv"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(flvtest.Dump(r), flvtest.Dump(f)) {
+		t.Errorf("demux mismatch")
+	}
+	flvtest.Golden(t, "testdata/avc_aac.golden", flvtest.Dump(r), *update)
+}
+
+func TestCounter_Fixture(t *testing.T) {
+	b, err := flvtest.Generate(10).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var d flv.Demuxer
+	if d, err = flv.NewDemuxer(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	var r *flvtest.Fixture
+	if r, err = flvtest.Read(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err = d.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	for range r.Tags {
+		_, size, _, err := d.ReadTagHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = d.ReadTag(size); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if d.Bytes() != uint64(len(b)) || d.Tags() != uint64(len(r.Tags)) {
+		t.Errorf("bytes=%v/%v, tags=%v/%v", d.Bytes(), len(b), d.Tags(), len(r.Tags))
+	}
+}
+
+func TestSoundRateFixer(t *testing.T) {
+	f := flv.NewSoundRateFixer()
+
+	// The AAC 22.05kHz stereo, but marked as 44kHz mono.
+	sh := []byte{0xae, 0x00, 0x13, 0x90}
+	raw := []byte{0xae, 0x01, 0x21, 0x00}
+
+	fixed, err := f.Fix(sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed[0] != 0xab || sh[0] != 0xae {
+		t.Errorf("invalid sequence header %x", fixed[0])
+	}
+
+	if fixed, err = f.Fix(raw); err != nil {
+		t.Fatal(err)
+	}
+	if fixed[0] != 0xab || raw[0] != 0xae {
+		t.Errorf("invalid raw %x", fixed[0])
+	}
+
+	// No mismatch, should not change.
+	raw = []byte{0xab, 0x01, 0x21, 0x00}
+	if fixed, err = f.Fix(raw); err != nil || &fixed[0] != &raw[0] {
+		t.Errorf("should not fix, err %+v", err)
+	}
+
+	if f.Fixed() != 2 {
+		t.Errorf("invalid fixed %v", f.Fixed())
+	}
+}
+
+func TestVideoPackager_CTS(t *testing.T) {
+	vp, err := flv.NewVideoPackager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The B-frame got PTS 40ms before the DTS, for example, the open GOP.
+	for _, pts := range []uint32{1040, 1000, 960} {
+		dts := uint32(1000)
+		tag, err := vp.Encode(&flv.VideoFrame{
+			CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeInterframe,
+			Trait: flv.VideoFrameTraitNALU, CTS: flv.ToCTS(dts, pts),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame, err := vp.Decode(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.PTS(dts) != pts {
+			t.Errorf("pts=%v, want %v, cts=%v", frame.PTS(dts), pts, frame.CTS)
+		}
+
+		if cts, err := flv.VideoTagCTS(tag); err != nil || cts != frame.CTS {
+			t.Errorf("cts=%v, want %v, err is %+v", cts, frame.CTS, err)
+		}
+	}
+}
+
+func TestTimestampRebaser_Loop(t *testing.T) {
+	b, err := flvtest.Generate(50).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loop the file 3 times, each demuxer starts from zero.
+	rebaser := flv.NewTimestampRebaser()
+	var timestamps []uint32
+	for i := 0; i < 3; i++ {
+		d, err := flv.NewDemuxer(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d = rebaser.Wrap(d)
+		if _, _, _, err = d.ReadHeader(); err != nil {
+			t.Fatal(err)
+		}
+
+		for {
+			_, tagSize, timestamp, err := d.ReadTagHeader()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = d.ReadTag(tagSize); err != nil {
+				t.Fatal(err)
+			}
+			timestamps = append(timestamps, timestamp)
+		}
+	}
+
+	// The timestamp is continuous, the next loop follows the last tag by SpliceGap.
+	for i := 1; i < len(timestamps); i++ {
+		if timestamps[i] < timestamps[i-1] {
+			t.Fatalf("timestamp %v jitter back from %v at %v", timestamps[i], timestamps[i-1], i)
+		}
+	}
+
+	last, first := timestamps[52], timestamps[53]
+	if first != last+rebaser.SpliceGap {
+		t.Errorf("splice at %v, want %v", first, last+rebaser.SpliceGap)
+	}
+}
+
+func TestDemuxer_ParseMode(t *testing.T) {
+	b := &bytes.Buffer{}
+	m, err := flv.NewMuxer(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.WriteHeader(false, true); err != nil {
+		t.Fatal(err)
+	}
+	// The timestamp regress from 40 to 20.
+	for _, ts := range []uint32{0, 40, 20} {
+		if err = m.WriteTag(flv.TagTypeAudio, ts, []byte{0xaf, 0x01, 0x00}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parse := func(mode flv.ParseMode) (timestamps []uint32, err error) {
+		d, err := flv.NewDemuxerMode(bytes.NewReader(b.Bytes()), mode)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, _, err = d.ReadHeader(); err != nil {
+			return nil, err
+		}
+		for {
+			_, tagSize, timestamp, err := d.ReadTagHeader()
+			if err == io.EOF {
+				return timestamps, nil
+			}
+			if err != nil {
+				return timestamps, err
+			}
+			if _, err = d.ReadTag(tagSize); err != nil {
+				return timestamps, err
+			}
+			timestamps = append(timestamps, timestamp)
+		}
+	}
+
+	if ts, err := parse(flv.ParseModeIgnore); err != nil || len(ts) != 3 || ts[2] != 20 {
+		t.Errorf("ignore got %v, err %v", ts, err)
+	}
+	if ts, err := parse(flv.ParseModeLenient); err != nil || len(ts) != 3 || ts[2] != 40 {
+		t.Errorf("lenient got %v, err %v", ts, err)
+	}
+	if ts, err := parse(flv.ParseModeStrict); err == nil || len(ts) != 2 {
+		t.Errorf("strict got %v, err %v", ts, err)
+	}
+
+	// Corrupt the previous tag size of first tag, 13 bytes header, 11+3 bytes tag.
+	b.Bytes()[13+14+3] = 0xff
+	if _, err := parse(flv.ParseModeStrict); err == nil {
+		t.Error("strict should fail for previous tag size")
+	}
+	if ts, err := parse(flv.ParseModeLenient); err != nil || len(ts) != 3 {
+		t.Errorf("lenient got %v, err %v", ts, err)
+	}
+}
+
+func TestAudioTimestampSource(t *testing.T) {
+	s := flv.NewAudioTimestampSource(44100, 1024)
+
+	// The 10000 frames is 232199.5ms, the accumulated 23ms is 230000ms.
+	var timestamp uint32
+	for i := 0; i <= 10000; i++ {
+		timestamp = s.Next()
+	}
+	if timestamp != 232199 || s.Samples() != 10001*1024 {
+		t.Errorf("invalid timestamp %v, samples %v", timestamp, s.Samples())
+	}
+
+	b := &bytes.Buffer{}
+	m, err := flv.NewMuxer(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m = flv.NewTimestampMuxer(m, flv.NewAudioTimestampSource(48000, 1024))
+	for _, tag := range [][]byte{{0xaf, 0x00, 0x11, 0x90}, {0xaf, 0x01}, {0xaf, 0x01}, {0xaf, 0x01}} {
+		if err = m.WriteTag(flv.TagTypeAudio, 0, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := flv.NewDemuxer(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var timestamps []uint32
+	for {
+		_, tagSize, timestamp, err := d.ReadTagHeader()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = d.ReadTag(tagSize); err != nil {
+			t.Fatal(err)
+		}
+		timestamps = append(timestamps, timestamp)
+	}
+	if len(timestamps) != 4 || timestamps[0] != 0 || timestamps[1] != 0 || timestamps[2] != 21 || timestamps[3] != 42 {
+		t.Errorf("invalid timestamps %v", timestamps)
+	}
+}
+
+func TestSlideshow(t *testing.T) {
+	// The SPS, PPS and IDR in Annex B, the SPS is changed by the second frame.
+	frame := []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0x1e, 0, 0, 0, 1, 0x68, 0xce, 0, 0, 1, 0x65, 0x88, 0x84}
+	frame2 := []byte{0, 0, 0, 1, 0x67, 0x4d, 0, 0x1f, 0, 0, 0, 1, 0x68, 0xce, 0, 0, 1, 0x65, 0x88, 0x84}
+
+	s := flv.NewSlideshow(nil)
+	if err := s.Add(frame, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(frame, 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(frame2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add([]byte{0, 0, 1, 0x65, 0x88}, time.Second); err == nil {
+		t.Error("should fail without sps")
+	}
+	if err := s.AddImage(nil, time.Second); err == nil {
+		t.Error("should fail without encoder")
+	}
+
+	var timestamps []uint32
+	var headers int
+	for i := 0; i < 2; i++ {
+		err := s.Tags(func(tagType flv.TagType, timestamp uint32, tag []byte) error {
+			if tagType != flv.TagTypeVideo || tag[0] != 0x17 {
+				t.Errorf("invalid tag %v %x", tagType, tag)
+			}
+			if tag[1] == 0 {
+				headers++
+			} else {
+				timestamps = append(timestamps, timestamp)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if headers != 4 {
+		t.Errorf("invalid headers %v", headers)
+	}
+	if v := fmt.Sprint(timestamps); v != "[0 1000 2000 3000 3500 4500 5500 6500 7500 8000]" {
+		t.Errorf("invalid timestamps %v", v)
+	}
+}
+
+// The writer fails after written n bytes.
+type failWriter struct {
+	n int
+}
+
+func (v *failWriter) Write(p []byte) (int, error) {
+	if v.n -= len(p); v.n < 0 {
+		return 0, fmt.Errorf("disk full")
+	}
+	return len(p), nil
+}
+
+// The writer blocks until released.
+type slowWriter struct {
+	bytes.Buffer
+	release chan bool
+}
+
+func (v *slowWriter) Write(p []byte) (int, error) {
+	<-v.release
+	return v.Buffer.Write(p)
+}
+
+func TestFanOut(t *testing.T) {
+	f := flvtest.Generate(100)
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fan := flv.NewFanOut()
+	fan.QueueSize = 8
+
+	var failed []string
+	fan.OnSinkError = func(s *flv.Sink, err error) {
+		failed = append(failed, s.Name)
+	}
+
+	var fast bytes.Buffer
+	fm, _ := flv.NewMuxer(&fast)
+	fm2, _ := flv.NewMuxer(&failWriter{n: 100})
+	slow := &slowWriter{release: make(chan bool)}
+	sm, _ := flv.NewMuxer(slow)
+
+	fs, _ := fan.AddSink("fast", fm)
+	es, _ := fan.AddSink("fail", fm2)
+	ss, _ := fan.AddSink("slow", sm)
+
+	// Never blocked by the slow sink.
+	if err = fan.WriteHeader(f.HasVideo, f.HasAudio); err != nil {
+		t.Fatal(err)
+	}
+	for i, tag := range f.Tags {
+		if err = fan.WriteTag(tag.Type, tag.Timestamp, tag.Data); err != nil {
+			t.Fatal(err)
+		}
+
+		// Wait for the fast sink, which is never dropped.
+		for fm.Tags()+4 < uint64(i) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if es.Err() == nil || len(fan.Sinks()) != 2 {
+		t.Errorf("fail sink should be removed, err is %v", es.Err())
+	}
+	if ss.Dropped() == 0 {
+		t.Error("slow sink should drop tags")
+	}
+
+	close(slow.release)
+	if err = fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fs.Err() != nil || fs.Dropped() != 0 || !bytes.Equal(fast.Bytes(), b) {
+		t.Errorf("fast sink err=%v, dropped=%v, %v/%vB", fs.Err(), fs.Dropped(), fast.Len(), len(b))
+	}
+	if fan.Bytes() != uint64(len(b)) || fan.Tags() != uint64(len(f.Tags)) {
+		t.Errorf("bytes=%v/%v, tags=%v/%v", fan.Bytes(), len(b), fan.Tags(), len(f.Tags))
+	}
+	if fmt.Sprint(failed) != "[fail]" {
+		t.Errorf("failed sinks %v", failed)
+	}
+
+	// The slow sink resumes at keyframe, the stream is still valid.
+	var r *flvtest.Fixture
+	if r, err = flvtest.Read(&slow.Buffer); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range r.Tags[3:] {
+		if tag.Type == flv.TagTypeVideo {
+			if tag.Data[0] != 0x17 {
+				t.Errorf("slow sink should resume at keyframe, got %x", tag.Data[0])
+			}
+			break
+		}
+	}
+}
+
+// The muxer fails when close.
+type closeFailMuxer struct {
+	flv.Muxer
+}
+
+func (v *closeFailMuxer) Close() error {
+	return fmt.Errorf("close failed")
+}
+
+func TestFanOut_Close(t *testing.T) {
+	fan := flv.NewFanOut()
+
+	for _, name := range []string{"recorder", "forwarder", "hls"} {
+		m, _ := flv.NewMuxer(&bytes.Buffer{})
+		if name != "hls" {
+			m = &closeFailMuxer{m}
+		}
+		if _, err := fan.AddSink(name, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// All the failures of sinks are reported.
+	err := fan.Close()
+	if err == nil || err.Error() != "recorder: close failed\nforwarder: close failed" {
+		t.Errorf("invalid err %v", err)
+	}
+}
+
+func TestFanOut_AutoHeader(t *testing.T) {
+	f := flvtest.Generate(30)
+
+	fan := flv.NewFanOut()
+	fan.AutoHeader = true
+
+	var early, late bytes.Buffer
+	m, _ := flv.NewMuxer(&early)
+	if _, err := fan.AddSink("early", m); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream starts video-only, and audio appears later.
+	if err := fan.WriteHeader(true, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range f.Tags {
+		if err := fan.WriteTag(tag.Type, tag.Timestamp, tag.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if hasVideo, hasAudio := fan.Header(); !hasVideo || !hasAudio {
+		t.Errorf("invalid header video=%v, audio=%v", hasVideo, hasAudio)
+	}
+
+	m, _ = flv.NewMuxer(&late)
+	if _, err := fan.AddSink("late", m); err != nil {
+		t.Fatal(err)
+	}
+	fan.Close()
+
+	for _, pv := range []struct {
+		name     string
+		b        *bytes.Buffer
+		hasAudio bool
+	}{
+		{"early", &early, false}, {"late", &late, true},
+	} {
+		r, err := flvtest.Read(pv.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !r.HasVideo || r.HasAudio != pv.hasAudio {
+			t.Errorf("%v invalid header video=%v, audio=%v", pv.name, r.HasVideo, r.HasAudio)
+		}
+	}
+}
+
+func TestFanOut_AddSinkLater(t *testing.T) {
+	f := flvtest.Generate(30)
+
+	fan := flv.NewFanOut()
+	if err := fan.WriteHeader(f.HasVideo, f.HasAudio); err != nil {
+		t.Fatal(err)
+	}
+
+	var late bytes.Buffer
+	for i, tag := range f.Tags {
+		// Add sink after the sequence headers and the first keyframe.
+		if i == 5 {
+			m, _ := flv.NewMuxer(&late)
+			if _, err := fan.AddSink("late", m); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := fan.WriteTag(tag.Type, tag.Timestamp, tag.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fan.Close()
+
+	r, err := flvtest.Read(&late)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Got the metadata, sequence headers, then frames since the next keyframe.
+	if len(r.Tags) < 3 || r.Tags[0].Type != flv.TagTypeScriptData || r.Tags[1].Data[1] != 0x00 || r.Tags[2].Data[1] != 0x00 {
+		t.Fatalf("invalid late sink %v", len(r.Tags))
+	}
+	for _, tag := range r.Tags[3:] {
+		if tag.Type == flv.TagTypeVideo && tag.Data[0] != 0x17 {
+			t.Errorf("late sink should start at keyframe, got %x", tag.Data[0])
+		}
+		break
+	}
+}
+
+func TestValidator(t *testing.T) {
+	b, err := flvtest.Generate(100).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := flv.Validate(bytes.NewReader(b))
+	if err != nil || len(findings) != 0 {
+		t.Errorf("should be valid, findings %v, err %+v", findings, err)
+	}
+
+	v := flv.NewValidator()
+
+	// No sequence header, only reported once.
+	raw := []byte{0xaf, 0x01, 0x21, 0x00}
+	if fs := v.Validate(flv.TagTypeAudio, 0, raw); len(fs) != 1 || fs[0].Kind != flv.FindingMissingSequenceHeader {
+		t.Errorf("invalid findings %v", fs)
+	}
+	if fs := v.Validate(flv.TagTypeAudio, 23, raw); len(fs) != 0 {
+		t.Errorf("invalid findings %v", fs)
+	}
+
+	// The ADTS of 22.05kHz, but ASC is 44.1kHz.
+	v.Validate(flv.TagTypeAudio, 23, []byte{0xaf, 0x00, 0x12, 0x10})
+	adts := []byte{0xaf, 0x01, 0xff, 0xf1, 0x5c, 0x80, 0x01, 0x1f, 0xfc, 0x21}
+	if fs := v.Validate(flv.TagTypeAudio, 46, adts); len(fs) != 1 || fs[0].Kind != flv.FindingADTSMismatch {
+		t.Errorf("invalid findings %v", fs)
+	}
+
+	// The timestamp regression.
+	if fs := v.Validate(flv.TagTypeAudio, 10, raw); len(fs) != 1 || fs[0].Kind != flv.FindingTimestampRegression {
+		t.Errorf("invalid findings %v", fs)
+	}
+
+	// The NALU size exceeds the tag.
+	v.Validate(flv.TagTypeVideo, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x42, 0x00, 0x1e, 0xff, 0xe0, 0x00})
+	nalu := []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x65}
+	if fs := v.Validate(flv.TagTypeVideo, 40, nalu); len(fs) != 1 || fs[0].Kind != flv.FindingNALUSizeCorrupt {
+		t.Errorf("invalid findings %v", fs)
+	}
+
+	if fs := v.Findings(); len(fs) != 4 || fs[3].Index != 6 {
+		t.Errorf("invalid findings %v", fs)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	f := flvtest.Generate(10)
+
+	// Replace the metadata with values.
+	sd := flv.NewScriptData()
+	sd.Name = "onMetaData"
+	metadata := amf0.NewEcmaArray()
+	metadata.Set("width", amf0.NewNumber(1280))
+	sd.Values = append(sd.Values, metadata)
+
+	b, err := sd.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Tags[0].Data = b
+
+	if b, err = f.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := flv.NewDemuxer(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = d.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	var frames []*flv.Frame
+	for {
+		frame, err := flv.ReadFrame(d)
+		if err != nil {
+			break
+		}
+		frames = append(frames, frame)
+	}
+	if len(frames) != len(f.Tags) {
+		t.Fatalf("invalid frames %v", len(frames))
+	}
+
+	if s := frames[0].Script; s == nil || s.Name != "onMetaData" || len(s.Values) != 1 {
+		t.Errorf("invalid script %v", s)
+	} else if a, ok := s.Values[0].(*amf0.EcmaArray); !ok || *a.Get("width").(*amf0.Number) != 1280 {
+		t.Errorf("invalid metadata %v", s.Values[0])
+	}
+
+	if v := frames[1].Video; v == nil || v.CodecID != flv.VideoCodecAVC || v.FrameType != flv.VideoFrameTypeKeyframe ||
+		v.Trait != flv.VideoFrameTraitSequenceHeader {
+		t.Errorf("invalid video %v", v)
+	}
+
+	if a := frames[2].Audio; a == nil || a.SoundFormat != flv.AudioCodecAAC || a.SoundRate != flv.AudioSamplingRate44kHz ||
+		a.SoundSize != flv.AudioSampleBits16bits || a.SoundType != flv.AudioChannelsStereo {
+		t.Errorf("invalid audio %v", a)
+	}
+}
+
+func TestTapper(t *testing.T) {
+	type tapped struct {
+		tagType   flv.TagType
+		timestamp uint32
+		size      int
+	}
+
+	f := flvtest.Generate(10)
+
+	var w bytes.Buffer
+	m, err := flv.NewMuxer(&w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var written []tapped
+	m.OnTag(func(tagType flv.TagType, timestamp uint32, tag []byte) {
+		written = append(written, tapped{tagType, timestamp, len(tag)})
+	})
+
+	if err = m.WriteHeader(true, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range f.Tags {
+		if err = m.WriteTag(tag.Type, tag.Timestamp, tag.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := flv.NewDemuxer(&w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var read []tapped
+	d.OnTag(func(tagType flv.TagType, timestamp uint32, tag []byte) {
+		read = append(read, tapped{tagType, timestamp, len(tag)})
+	})
+
+	if _, _, _, err = d.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err = flv.ReadFrame(d); err != nil {
+			break
+		}
+	}
+
+	if len(written) != len(f.Tags) || len(read) != len(f.Tags) {
+		t.Fatalf("invalid taps %v %v", len(written), len(read))
+	}
+	for i, tag := range f.Tags {
+		if v := (tapped{tag.Type, tag.Timestamp, len(tag.Data)}); written[i] != v || read[i] != v {
+			t.Errorf("invalid tap %v, %v %v %v", i, v, written[i], read[i])
+		}
+	}
+}
+
+func TestAVC(t *testing.T) {
+	codec, err := flv.NewAVC()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nalu := func(b ...byte) *avc.NALU {
+		v := avc.NewNALU()
+		if err := v.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	sh, err := codec.EncodeSequenceHeader(nalu(0x67, 0x64, 0x00, 0x1f, 0xac), nalu(0x68, 0xee, 0x3c, 0x80))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avcc := codec.AVCC(); avcc.AVCProfileIndication != avc.AVCProfileHigh || avcc.AVCLevelIndication != avc.AVCLevel_31 {
+		t.Errorf("invalid avcc %v %v", avcc.AVCProfileIndication, avcc.AVCLevelIndication)
+	}
+
+	tag, err := codec.Encode(40, nalu(0x06, 0x05), nalu(0x65, 0x88, 0x84))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decode by another codec.
+	if codec, err = flv.NewAVC(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = codec.Decode(tag); err == nil {
+		t.Error("should fail without sequence header")
+	}
+
+	frame, nalus, err := codec.Decode(sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Trait != flv.VideoFrameTraitSequenceHeader || len(nalus) != 2 || nalus[0].NALUType != avc.NALUTypeSPS ||
+		nalus[1].NALUType != avc.NALUTypePPS || !bytes.Equal(nalus[1].Data, []byte{0xee, 0x3c, 0x80}) {
+		t.Errorf("invalid sequence header %v %v", frame.Trait, nalus)
+	}
+
+	if frame, nalus, err = codec.Decode(tag); err != nil {
+		t.Fatal(err)
+	}
+	if frame.FrameType != flv.VideoFrameTypeKeyframe || frame.Trait != flv.VideoFrameTraitNALU || frame.CTS != 40 ||
+		len(nalus) != 2 || nalus[0].NALUType != avc.NALUTypeSEI || nalus[1].NALUType != avc.NALUTypeIDR {
+		t.Errorf("invalid frame %v %v %v %v", frame.FrameType, frame.Trait, frame.CTS, nalus)
+	}
+}
+
+func TestMP3(t *testing.T) {
+	codec, err := flv.NewMP3()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The MPEG-1 Layer III, 128kbps, 44.1kHz, joint stereo.
+	frame := append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...)
+	tag, err := codec.Encode(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag[0] != 0x2f || len(tag) != 1+len(frame) {
+		t.Errorf("invalid tag %#x %v", tag[0], len(tag))
+	}
+
+	// The MPEG-2.5 Layer III, 8kHz, mono.
+	if tag, err = codec.Encode([]byte{0xff, 0xe3, 0x18, 0xc4}); err != nil {
+		t.Fatal(err)
+	}
+	if tag[0] != 0xe2 {
+		t.Errorf("invalid tag %#x", tag[0])
+	}
+
+	if _, _, err = codec.Decode([]byte{0xaf, 0x01, 0x12}); err == nil {
+		t.Error("should fail for AAC")
+	}
+
+	if codec, err = flv.NewMP3(); err != nil {
+		t.Fatal(err)
+	}
+	af, header, err := codec.Decode(append([]byte{0x2f}, frame...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if af.SoundFormat != flv.AudioCodecMP3 || af.SoundRate != flv.AudioSamplingRate44kHz || af.SoundType != flv.AudioChannelsStereo ||
+		len(af.Raw) != len(frame) {
+		t.Errorf("invalid frame %v %v %v", af.SoundFormat, af.SoundRate, af.SoundType)
+	}
+	if header.Version != mp3.Version1 || header.Bitrate != 128 || header.SampleRate != 44100 ||
+		header.ChannelMode != mp3.ChannelModeJointStereo || codec.Header() != header {
+		t.Errorf("invalid header %+v", header)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	m := flv.NewMetadata()
+	m.HasVideo, m.Width, m.Height, m.FrameRate, m.VideoCodecID = true, 1280, 720, 25, flv.VideoCodecAVC
+	m.HasAudio, m.AudioSampleRate, m.Stereo, m.AudioCodecID = true, 44100, true, flv.AudioCodecAAC
+	m.Extra["encoder"] = amf0.NewString("Oryx")
+
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parse by ReadFrame.
+	tag, err := flvtest.NewFixture(true, true).AddTag(flv.TagTypeScriptData, 0, b).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := flv.NewDemuxer(bytes.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = d.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := flv.ReadFrame(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Script == nil || frame.Script.Name != "onMetaData" || len(frame.Script.Values) != 1 {
+		t.Fatalf("invalid script %v", frame.Script)
+	}
+	if a, ok := frame.Script.Values[0].(*amf0.EcmaArray); !ok || a.Len() != 8 || a.Keys()[0] != "width" {
+		t.Errorf("invalid metadata %v", frame.Script.Values[0])
+	}
+
+	r := flv.NewMetadata()
+	if err = r.UnmarshalBinary(frame.Raw); err != nil {
+		t.Fatal(err)
+	}
+	if !r.HasVideo || r.Width != 1280 || r.Height != 720 || r.FrameRate != 25 || r.VideoCodecID != flv.VideoCodecAVC ||
+		!r.HasAudio || r.AudioSampleRate != 44100 || !r.Stereo || r.AudioCodecID != flv.AudioCodecAAC || r.Duration != 0 {
+		t.Errorf("invalid metadata %+v", r)
+	}
+	if s, ok := r.Extra["encoder"].(*amf0.String); !ok || *s != "Oryx" || len(r.Extra) != 1 {
+		t.Errorf("invalid extra %v", r.Extra)
+	}
+
+	// The metadata of RTMP publisher, with @setDataFrame.
+	b = append(append([]byte{0x02, 0x00, 0x0d}, "@setDataFrame"...), b...)
+	if err = r.UnmarshalBinary(b); err != nil || r.Width != 1280 {
+		t.Errorf("invalid metadata %+v, err %+v", r, err)
+	}
+}
+
+func TestSyncMuxer(t *testing.T) {
+	var b bytes.Buffer
+	m, err := flv.NewMuxer(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := flv.NewSyncMuxer(m)
+	if err = sm.WriteHeader(true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The audio and video pipelines write to the same muxer.
+	var wg sync.WaitGroup
+	for _, tagType := range []flv.TagType{flv.TagTypeAudio, flv.TagTypeVideo} {
+		wg.Add(1)
+		go func(tagType flv.TagType) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := sm.WriteTag(tagType, uint32(i), []byte{byte(tagType), byte(i)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(tagType)
+	}
+	wg.Wait()
+
+	f, err := flvtest.Read(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Tags) != 200 || sm.Tags() != 200 {
+		t.Errorf("invalid tags %v %v", len(f.Tags), sm.Tags())
+	}
+	for _, tag := range f.Tags {
+		if len(tag.Data) != 2 || tag.Data[0] != byte(tag.Type) || uint32(tag.Data[1]) != tag.Timestamp {
+			t.Errorf("invalid tag %v %v %v", tag.Type, tag.Timestamp, tag.Data)
+		}
+	}
+}
+
+func TestSeekableDemuxer(t *testing.T) {
+	f := flvtest.Generate(150)
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Build the index by scanning, the keyframes are at 0, 1000 and 2000ms.
+	d, err := flv.NewSeekableDemuxer(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = d.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	keyframes, err := d.Keyframes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyframes) != 3 || keyframes[1].Timestamp != 1000 || keyframes[2].Timestamp != 2000 {
+		t.Fatalf("invalid keyframes %v", len(keyframes))
+	}
+
+	// The position is restored after indexed.
+	if tagType, _, _, err := d.ReadTagHeader(); err != nil || tagType != flv.TagTypeScriptData {
+		t.Errorf("invalid tag %v, err %+v", tagType, err)
+	}
+
+	for _, ts := range []uint32{0, 1500, 2500} {
+		keyframe, err := d.Seek(ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tagType, tagSize, timestamp, err := d.ReadTagHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tag, err := d.ReadTag(tagSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expect := ts / 1000 * 1000; keyframe != expect || tagType != flv.TagTypeVideo || timestamp != expect || tag[0] != 0x17 {
+			t.Errorf("seek %v, invalid keyframe %v, tag %v %v %x", ts, keyframe, tagType, timestamp, tag[0])
+		}
+	}
+
+	// Use the keyframes of metadata, only the first and last keyframes.
+	buildMetadata := func(keyframes []*flv.Keyframe) []byte {
+		m := flv.NewMetadata()
+		if m.Extra["keyframes"], err = flv.KeyframesToAmf0(keyframes); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	keyframes = []*flv.Keyframe{keyframes[0], keyframes[2]}
+	delta := int64(len(buildMetadata(keyframes)) - len(f.Tags[0].Data))
+	for _, k := range keyframes {
+		k.Position += delta
+	}
+	f.Tags[0].Data = buildMetadata(keyframes)
+
+	if b, err = f.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = flv.NewSeekableDemuxer(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	if keyframe, err := d.Seek(1500); err != nil || keyframe != 0 {
+		t.Errorf("invalid keyframe %v, err %+v", keyframe, err)
+	}
+	if keyframe, err := d.Seek(2500); err != nil || keyframe != 2000 {
+		t.Errorf("invalid keyframe %v, err %+v", keyframe, err)
+	}
+	if _, _, timestamp, err := d.ReadTagHeader(); err != nil || timestamp != 2000 {
+		t.Errorf("invalid tag %v, err %+v", timestamp, err)
+	}
+}
+
+// The response writer which fails after n bytes, like the client closed.
+type closedResponseWriter struct {
+	*httptest.ResponseRecorder
+	n int
+}
+
+func (v *closedResponseWriter) Write(p []byte) (int, error) {
+	if v.n -= len(p); v.n < 0 {
+		return 0, io.ErrClosedPipe
+	}
+	return v.ResponseRecorder.Write(p)
+}
+
+func TestHTTPStream(t *testing.T) {
+	f := flvtest.Generate(100)
+	serve := func(w http.ResponseWriter, contentLength int64) (producerErr, err error) {
+		s, err := flv.NewHTTPStream(w, 64)
+		if err != nil {
+			return nil, err
+		}
+		if contentLength >= 0 {
+			s.SetContentLength(contentLength)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			defer s.Close()
+			if err := s.WriteHeader(f.HasVideo, f.HasAudio); err != nil {
+				done <- err
+				return
+			}
+			for _, tag := range f.Tags {
+				if err := s.WriteTag(tag.Type, tag.Timestamp, tag.Data); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+
+		err = s.Serve()
+		return <-done, err
+	}
+
+	// The live stream, which is flushed for each tag.
+	w := httptest.NewRecorder()
+	if perr, err := serve(w, -1); perr != nil || err != nil {
+		t.Fatal(perr, err)
+	}
+	if v := w.Header().Get("Content-Type"); v != "video/x-flv" || w.Header().Get("Content-Length") != "" || !w.Flushed {
+		t.Errorf("invalid response %v %v", w.Header(), w.Flushed)
+	}
+	if r, err := flvtest.Read(w.Body); err != nil {
+		t.Error(err)
+	} else if len(r.Tags) != len(f.Tags) {
+		t.Errorf("invalid tags %v", len(r.Tags))
+	}
+
+	// The finished recording, in Content-Length.
+	size := int64(flv.HeaderSize)
+	for _, tag := range f.Tags {
+		size += flv.TagSize(tag.Data)
+	}
+
+	w = httptest.NewRecorder()
+	if perr, err := serve(w, size); perr != nil || err != nil {
+		t.Fatal(perr, err)
+	}
+	if v := w.Header().Get("Content-Length"); v != fmt.Sprint(size) || int64(w.Body.Len()) != size {
+		t.Errorf("invalid Content-Length %v, body %v", v, w.Body.Len())
+	}
+
+	if _, err := serve(httptest.NewRecorder(), size+1); err == nil {
+		t.Error("should fail for Content-Length mismatch")
+	}
+
+	// The producer fails when client closed.
+	perr, err := serve(&closedResponseWriter{httptest.NewRecorder(), 100}, -1)
+	if err != io.ErrClosedPipe || perr == nil {
+		t.Errorf("should fail, producer %v, serve %v", perr, err)
+	}
+}
+
+func TestBlackFrames(t *testing.T) {
+	if _, err := flv.NewBlackFrames(641, 360); err == nil {
+		t.Error("should fail for odd width")
+	}
+
+	p, err := flv.NewVideoPackager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range [][2]int{{640, 360}, {1280, 720}, {1920, 1080}, {2, 2}} {
+		bf, err := flv.NewBlackFrames(size[0], size[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The sequence header carries the SPS of the size.
+		tag, err := bf.SequenceHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame, err := p.Decode(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.CodecID != flv.VideoCodecAVC || frame.Trait != flv.VideoFrameTraitSequenceHeader {
+			t.Errorf("invalid sequence header %v %v", frame.CodecID, frame.Trait)
+		}
+
+		r := avc.NewAVCDecoderConfigurationRecord()
+		if err = r.UnmarshalBinary(frame.Raw); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.SequenceParameterSetNALUnits) != 1 || len(r.PictureParameterSetNALUnits) != 1 {
+			t.Fatalf("invalid parameter sets %v", r)
+		}
+
+		b, err := r.SequenceParameterSetNALUnits[0].MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sps := avc.NewSPS()
+		if err = sps.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		if sps.ProfileIDC != avc.AVCProfileBaseline || sps.Width != size[0] || sps.Height != size[1] {
+			t.Errorf("invalid sps %v for %vx%v", sps, size[0], size[1])
+		}
+	}
+
+	// The keyframe is at every GOP frames, others are P frames.
+	bf, err := flv.NewBlackFrames(640, 360)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bf.GOP = 5
+
+	for n := 0; n < 12; n++ {
+		tag, err := bf.Frame(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame, err := p.Decode(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sample := avc.NewAVCSample(3)
+		if err = sample.UnmarshalBinary(frame.Raw); err != nil {
+			t.Fatal(err)
+		}
+
+		frameType, naluType := flv.VideoFrameTypeInterframe, avc.NALUTypeNonIDR
+		if n%5 == 0 {
+			frameType, naluType = flv.VideoFrameTypeKeyframe, avc.NALUTypeIDR
+		}
+		if frame.FrameType != frameType || frame.Trait != flv.VideoFrameTraitNALU ||
+			len(sample.NALUs) != 1 || sample.NALUs[0].NALUType != naluType {
+			t.Errorf("invalid frame %v, type %v, trait %v", n, frame.FrameType, frame.Trait)
+		}
+	}
+}
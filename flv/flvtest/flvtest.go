@@ -0,0 +1,198 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The flvtest package provides the fixtures and golden files for FLV tests.
+// A fixture is a small FLV with known tags, which is loaded from file or
+// generated by program, and the golden file is the expected dump of tags:
+//		f, err := flvtest.Load("testdata/avc_aac.flv")
+//		flvtest.Golden(t, "testdata/avc_aac.golden", flvtest.Dump(f), *update)
+package flvtest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// The tag of fixture.
+type Tag struct {
+	Type      flv.TagType
+	Timestamp uint32
+	Data      []byte
+}
+
+// The fixture is a FLV stream with known tags.
+type Fixture struct {
+	HasVideo, HasAudio bool
+	Tags               []*Tag
+}
+
+// Create a fixture with the header flags.
+func NewFixture(hasVideo, hasAudio bool) *Fixture {
+	return &Fixture{HasVideo: hasVideo, HasAudio: hasAudio}
+}
+
+// Append a tag to fixture.
+func (v *Fixture) AddTag(tagType flv.TagType, timestamp uint32, data []byte) *Fixture {
+	v.Tags = append(v.Tags, &Tag{Type: tagType, Timestamp: timestamp, Data: data})
+	return v
+}
+
+// Marshal the fixture to FLV bytes by flv.Muxer.
+func (v *Fixture) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+
+	m, err := flv.NewMuxer(&b)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	if err = m.WriteHeader(v.HasVideo, v.HasAudio); err != nil {
+		return nil, err
+	}
+
+	for _, tag := range v.Tags {
+		if err = m.WriteTag(tag.Type, tag.Timestamp, tag.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// Generate a fixture of AVC and AAC, which is count tags of video and audio
+// in 25fps and 44.1kHz, the first tags are sequence headers.
+// @remark The payload is not valid for decoder, but valid for FLV.
+func Generate(count int) *Fixture {
+	v := NewFixture(true, true)
+
+	v.AddTag(flv.TagTypeScriptData, 0, []byte{0x02, 0x00, 0x0a, 'o', 'n', 'M', 'e', 't', 'a', 'D', 'a', 't', 'a'})
+	v.AddTag(flv.TagTypeVideo, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x42, 0x00, 0x1e, 0xff, 0xe0, 0x00})
+	v.AddTag(flv.TagTypeAudio, 0, []byte{0xaf, 0x00, 0x12, 0x10})
+
+	var video, audio int
+	for i := 0; i < count; i++ {
+		// Interleave the audio and video by timestamp.
+		vts, ats := uint32(video*40), uint32(audio*1024*1000/44100)
+		if vts <= ats {
+			frameType := byte(0x27)
+			if video%25 == 0 {
+				frameType = 0x17
+			}
+			v.AddTag(flv.TagTypeVideo, vts, []byte{frameType, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, byte(video)})
+			video++
+		} else {
+			v.AddTag(flv.TagTypeAudio, ats, []byte{0xaf, 0x01, 0x21, byte(audio)})
+			audio++
+		}
+	}
+
+	return v
+}
+
+// Load the fixture from FLV file.
+func Load(name string) (*Fixture, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Read the fixture from FLV stream.
+func Read(r io.Reader) (*Fixture, error) {
+	d, err := flv.NewDemuxer(r)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	v := &Fixture{}
+	if _, v.HasVideo, v.HasAudio, err = d.ReadHeader(); err != nil {
+		return nil, err
+	}
+
+	for {
+		tagType, tagSize, timestamp, err := d.ReadTagHeader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tag, err := d.ReadTag(tagSize)
+		if err != nil {
+			return nil, err
+		}
+
+		v.AddTag(tagType, timestamp, tag)
+	}
+
+	return v, nil
+}
+
+// Dump the fixture to text, one line for each tag, used as golden output.
+func Dump(v *Fixture) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "header video=%v audio=%v\n", v.HasVideo, v.HasAudio)
+	for _, tag := range v.Tags {
+		fmt.Fprintf(&b, "%v ts=%v size=%v crc32=%08x\n", tag.Type, tag.Timestamp, len(tag.Data), crc32.ChecksumIEEE(tag.Data))
+	}
+	return b.Bytes()
+}
+
+// The test interface, for example, *testing.T.
+type T interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Compare the got to the golden file, update the golden file when update is true,
+// for example, run the tests with -update flag to regenerate the golden files.
+// @return Whether got equals to golden.
+func Golden(t T, name string, got []byte, update bool) bool {
+	if update {
+		if err := ioutil.WriteFile(name, got, 0644); err != nil {
+			t.Errorf("update golden %v err %v", name, err)
+			return false
+		}
+	}
+
+	want, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Errorf("read golden %v err %v", name, err)
+		return false
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("golden %v mismatch, got\n%s\nwant\n%s", name, got, want)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,130 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The typed frame of FLV tag, to read the audio, video and script data without parsing the tag.
+package flv
+
+import (
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The script data tag, which is a name and some amf0 values, for example, onMetaData.
+// Refer to @doc video_file_format_spec_v10.pdf, @page 80, @section E.4.4 Data Tags
+type ScriptData struct {
+	// The name of script data, for example, onMetaData.
+	Name string
+	// The values of script data, for example, the EcmaArray of metadata.
+	Values []amf0.Amf0
+}
+
+func NewScriptData() *ScriptData {
+	return &ScriptData{}
+}
+
+func (v *ScriptData) UnmarshalBinary(data []byte) (err error) {
+	p := data
+
+	var name amf0.String
+	if err = name.UnmarshalBinary(p); err != nil {
+		return oe.WithMessage(err, "unmarshal name")
+	}
+	v.Name = string(name)
+	p = p[name.Size():]
+
+	v.Values = nil
+	for len(p) > 0 {
+		var a amf0.Amf0
+		if a, err = amf0.Discovery(p); err != nil {
+			return oe.WithMessage(err, "discovery value")
+		}
+		if err = a.UnmarshalBinary(p); err != nil {
+			return oe.WithMessage(err, "unmarshal value")
+		}
+		p = p[a.Size():]
+
+		v.Values = append(v.Values, a)
+	}
+
+	return
+}
+
+func (v *ScriptData) MarshalBinary() (data []byte, err error) {
+	if data, err = amf0.Append(nil, amf0.NewString(v.Name)); err != nil {
+		return nil, oe.WithMessage(err, "marshal name")
+	}
+
+	for _, a := range v.Values {
+		if data, err = amf0.Append(data, a); err != nil {
+			return nil, oe.WithMessage(err, "marshal value")
+		}
+	}
+	return
+}
+
+// The typed frame of FLV tag, only one of Audio, Video and Script is set by tag type.
+// @remark The Raw is the tag body, and the frames refer to it, never copied.
+type Frame struct {
+	TagType   TagType
+	Timestamp uint32
+	// The tag body.
+	Raw []byte
+
+	// The audio frame, for example, AAC with SoundFormat, SoundRate, SoundSize and SoundType.
+	Audio *AudioFrame
+	// The video frame, for example, AVC with CodecID, FrameType, AVCPacketType(Trait) and CTS.
+	Video *VideoFrame
+	// The script data, for example, onMetaData.
+	Script *ScriptData
+}
+
+// Read the next tag of demuxer d and decode it to typed frame.
+// @remark User should read the header by d.ReadHeader before read frames.
+// @remark The Audio, Video and Script are nil for other tag types, user can parse the Raw.
+func ReadFrame(d Demuxer) (frame *Frame, err error) {
+	var tagSize uint32
+	frame = &Frame{}
+	if frame.TagType, tagSize, frame.Timestamp, err = d.ReadTagHeader(); err != nil {
+		return nil, oe.WithMessage(err, "read tag header")
+	}
+
+	if frame.Raw, err = d.ReadTag(tagSize); err != nil {
+		return nil, oe.WithMessage(err, "read tag")
+	}
+
+	switch frame.TagType {
+	case TagTypeAudio:
+		if frame.Audio, err = (&audioPackager{}).Decode(frame.Raw); err != nil {
+			return nil, oe.WithMessage(err, "decode audio")
+		}
+	case TagTypeVideo:
+		if frame.Video, err = (&videoPackager{}).Decode(frame.Raw); err != nil {
+			return nil, oe.WithMessage(err, "decode video")
+		}
+	case TagTypeScriptData:
+		frame.Script = NewScriptData()
+		if err = frame.Script.UnmarshalBinary(frame.Raw); err != nil {
+			return nil, oe.WithMessage(err, "decode script")
+		}
+	}
+
+	return
+}
@@ -0,0 +1,170 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The HTTP-FLV streaming, pipe the muxer to the http response in memory.
+package flv
+
+import (
+	"bufio"
+	"fmt"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// The default size of buffers of HTTPStream.
+const defaultHTTPBufferSize = 32 * 1024
+
+// The size of FLV header, including the first previous tag size.
+const HeaderSize = 13
+
+// The size of tag in FLV, including the tag header and previous tag size, so
+// the size of file is HeaderSize plus the size of all tags.
+func TagSize(tag []byte) int64 {
+	return int64(11 + len(tag) + 4)
+}
+
+// The HTTPStream is a Muxer which streams the FLV to the http response through io.Pipe,
+// the producer writes tags in its goroutine, while the handler goroutine serves it:
+//		s, _ := flv.NewHTTPStream(w, 0)
+//		go func() {
+//			defer s.Close()
+//			s.WriteHeader(true, true)
+//			for tag := range tags {
+//				if err := s.WriteTag(tag.Type, tag.Timestamp, tag.Data); err != nil {
+//					return // The client closed.
+//				}
+//			}
+//		}()
+//		s.Serve()
+// Each tag is written to pipe in one write from the pre-allocated buffer, and the response
+// is flushed for each tag. The write blocks until the client reads it, so the producer is
+// paced by the client; use FanOut to drop tags for slow clients of live stream.
+// @remark For live stream there is no Content-Length, the response is chunked.
+// @remark For the finished recording, use SetContentLength to response in Content-Length.
+type HTTPStream struct {
+	Muxer
+
+	w  http.ResponseWriter
+	pr *io.PipeReader
+	pw *io.PipeWriter
+	// The buffer of muxer to write each tag once.
+	bw *bufio.Writer
+	// The buffer to copy pipe to response.
+	buf []byte
+	// The Content-Length of response, -1 for live stream.
+	contentLength int64
+}
+
+// Create the stream write to w, with buffers of bufferSize, use 32KB if zero.
+func NewHTTPStream(w http.ResponseWriter, bufferSize int) (*HTTPStream, error) {
+	if bufferSize <= 0 {
+		bufferSize = defaultHTTPBufferSize
+	}
+
+	pr, pw := io.Pipe()
+	bw := bufio.NewWriterSize(pw, bufferSize)
+
+	m, err := NewMuxer(bw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPStream{
+		Muxer: m, w: w, pr: pr, pw: pw, bw: bw,
+		buf: make([]byte, bufferSize), contentLength: -1,
+	}, nil
+}
+
+// Set the Content-Length of response, for the finished recording, which size is
+// HeaderSize plus TagSize of all tags.
+// @remark Must be called before Serve.
+func (v *HTTPStream) SetContentLength(size int64) {
+	v.contentLength = size
+}
+
+func (v *HTTPStream) WriteHeader(hasVideo, hasAudio bool) (err error) {
+	if err = v.Muxer.WriteHeader(hasVideo, hasAudio); err != nil {
+		return
+	}
+	return v.bw.Flush()
+}
+
+func (v *HTTPStream) WriteTag(tagType TagType, timestamp uint32, tag []byte) (err error) {
+	if err = v.Muxer.WriteTag(tagType, timestamp, tag); err != nil {
+		return
+	}
+	return v.bw.Flush()
+}
+
+// The producer is done, Serve returns when all tags are sent.
+func (v *HTTPStream) Close() error {
+	return oe.Join(v.bw.Flush(), v.pw.Close())
+}
+
+// Serve the stream to response until Close, or the client closed, which fails
+// the writes of producer.
+// @remark Should be called in the goroutine of http handler.
+func (v *HTTPStream) Serve() (err error) {
+	h := v.w.Header()
+	h.Set("Content-Type", "video/x-flv")
+	if v.contentLength >= 0 {
+		h.Set("Content-Length", strconv.FormatInt(v.contentLength, 10))
+	}
+
+	// Stop the producer when failed.
+	defer func() {
+		if err != nil {
+			v.pr.CloseWithError(err)
+		}
+	}()
+
+	flusher, _ := v.w.(http.Flusher)
+
+	var written int64
+	for {
+		n, rerr := v.pr.Read(v.buf)
+		if n > 0 {
+			if _, err = v.w.Write(v.buf[:n]); err != nil {
+				return
+			}
+			written += int64(n)
+
+			// Flush when the tag is all read, that is, not fill the buffer.
+			if n < len(v.buf) && flusher != nil && v.contentLength < 0 {
+				flusher.Flush()
+			}
+		}
+
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+
+	if v.contentLength >= 0 && written != v.contentLength {
+		return fmt.Errorf("written %v not match Content-Length %v", written, v.contentLength)
+	}
+	return
+}
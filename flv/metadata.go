@@ -0,0 +1,198 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The onMetaData of FLV, to build and parse the metadata script tag.
+package flv
+
+import (
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"sort"
+)
+
+// The name of metadata in script tag.
+const (
+	scriptSetDataFrame = "@setDataFrame"
+	scriptOnMetaData   = "onMetaData"
+)
+
+// The onMetaData of FLV, the fields are ignored when zero, for example, the duration and
+// filesize of live stream, except the codec ids which are set by HasVideo and HasAudio.
+// Refer to @doc video_file_format_spec_v10.pdf, @page 80, @section E.5 onMetaData
+type Metadata struct {
+	// The duration in seconds, and the size of file in bytes.
+	Duration float64
+	FileSize float64
+
+	// Whether got the video fields.
+	HasVideo bool
+	Width    float64
+	Height   float64
+	// The video bitrate in kbps.
+	VideoDataRate float64
+	// The frames per second.
+	FrameRate    float64
+	VideoCodecID VideoCodec
+
+	// Whether got the audio fields.
+	HasAudio bool
+	// The audio bitrate in kbps.
+	AudioDataRate float64
+	// The sample rate in Hz, for example, 44100.
+	AudioSampleRate float64
+	// The bits of sample, for example, 16.
+	AudioSampleSize float64
+	Stereo          bool
+	AudioCodecID    AudioCodec
+
+	// The other fields, for example, encoder, marshaled in the order of keys.
+	Extra map[string]amf0.Amf0
+}
+
+func NewMetadata() *Metadata {
+	return &Metadata{Extra: make(map[string]amf0.Amf0)}
+}
+
+// Marshal to the body of script tag, which is onMetaData and an EcmaArray.
+func (v *Metadata) MarshalBinary() (data []byte, err error) {
+	o := amf0.NewObject()
+	setNumber := func(key string, value float64, force bool) {
+		if value != 0 || force {
+			o.Set(key, amf0.NewNumber(value))
+		}
+	}
+
+	setNumber("duration", v.Duration, false)
+	setNumber("filesize", v.FileSize, false)
+
+	if v.HasVideo {
+		setNumber("width", v.Width, false)
+		setNumber("height", v.Height, false)
+		setNumber("videodatarate", v.VideoDataRate, false)
+		setNumber("framerate", v.FrameRate, false)
+		setNumber("videocodecid", float64(v.VideoCodecID), true)
+	}
+
+	if v.HasAudio {
+		setNumber("audiodatarate", v.AudioDataRate, false)
+		setNumber("audiosamplerate", v.AudioSampleRate, false)
+		setNumber("audiosamplesize", v.AudioSampleSize, false)
+		o.Set("stereo", amf0.NewBoolean(v.Stereo))
+		setNumber("audiocodecid", float64(v.AudioCodecID), true)
+	}
+
+	keys := make([]string, 0, len(v.Extra))
+	for key := range v.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		o.Set(key, v.Extra[key])
+	}
+
+	sd := NewScriptData()
+	sd.Name = scriptOnMetaData
+	sd.Values = append(sd.Values, o.ToEcmaArray())
+
+	return sd.MarshalBinary()
+}
+
+// Unmarshal from the body of script tag, the metadata can be Object or EcmaArray.
+// @remark The @setDataFrame is ignored, for example, the metadata of RTMP publisher.
+func (v *Metadata) UnmarshalBinary(data []byte) (err error) {
+	sd := NewScriptData()
+	if err = sd.UnmarshalBinary(data); err != nil {
+		return oe.WithMessage(err, "unmarshal script")
+	}
+
+	values := sd.Values
+	if sd.Name == scriptSetDataFrame && len(values) > 0 {
+		if name, ok := values[0].(*amf0.String); ok {
+			sd.Name, values = string(*name), values[1:]
+		}
+	}
+
+	if sd.Name != scriptOnMetaData {
+		return oe.Errorf("invalid name %v", sd.Name)
+	}
+	if len(values) == 0 {
+		return oe.New("no metadata")
+	}
+
+	kv, ok := amf0.ToKeyValues(values[0])
+	if !ok {
+		return oe.Errorf("invalid metadata %T", values[0])
+	}
+
+	*v = Metadata{Extra: make(map[string]amf0.Amf0)}
+	for _, key := range kv.Keys() {
+		value := kv.Get(key)
+
+		// The extra field, or the known field but not the expected type.
+		if !v.set(key, value) {
+			v.Extra[key] = value
+		}
+	}
+
+	return
+}
+
+// Set the known field, return false if unknown.
+func (v *Metadata) set(key string, value amf0.Amf0) bool {
+	if b, ok := value.(*amf0.Boolean); ok && key == "stereo" {
+		v.HasAudio, v.Stereo = true, bool(*b)
+		return true
+	}
+
+	n, ok := value.(*amf0.Number)
+	if !ok {
+		return false
+	}
+
+	switch key {
+	case "duration":
+		v.Duration = float64(*n)
+	case "filesize":
+		v.FileSize = float64(*n)
+	case "width":
+		v.HasVideo, v.Width = true, float64(*n)
+	case "height":
+		v.HasVideo, v.Height = true, float64(*n)
+	case "videodatarate":
+		v.HasVideo, v.VideoDataRate = true, float64(*n)
+	case "framerate":
+		v.HasVideo, v.FrameRate = true, float64(*n)
+	case "videocodecid":
+		v.HasVideo, v.VideoCodecID = true, VideoCodec(*n)
+	case "audiodatarate":
+		v.HasAudio, v.AudioDataRate = true, float64(*n)
+	case "audiosamplerate":
+		v.HasAudio, v.AudioSampleRate = true, float64(*n)
+	case "audiosamplesize":
+		v.HasAudio, v.AudioSampleSize = true, float64(*n)
+	case "audiocodecid":
+		v.HasAudio, v.AudioCodecID = true, AudioCodec(*n)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The MP3 codec for FLV audio tag, like the AVC for video.
+package flv
+
+import (
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"github.com/ossrs/go-oryx-lib/mp3"
+)
+
+// The MP3 codec for FLV audio tag body, which is the MP3 frames without sequence header.
+// We can encode the MP3 frames to audio tag, the SoundRate and SoundType are from the frame header.
+// We can also decode the audio tag to MP3 frame header and frames.
+// Refer to @doc video_file_format_spec_v10.pdf, @page 76, @section E.4.2 Audio Tags
+type MP3 interface {
+	// Encode the MP3 frames to audio tag, the frames should be of the same header.
+	// @remark For 8kHz, the SoundFormat is AudioCodecMP3In8kHz.
+	Encode(frames []byte) (tag []byte, err error)
+
+	// Decode the audio tag to frame, and the header of the first MP3 frame.
+	// @remark The frame refers to the tag, never copied.
+	Decode(tag []byte) (frame *AudioFrame, header *mp3.FrameHeader, err error)
+	// Get the header of the last encoded or decoded MP3 frame, the codec information.
+	// When encode or decode a audio tag, user can use this API to get it, otherwise nil.
+	Header() *mp3.FrameHeader
+}
+
+type mp3Codec struct {
+	header *mp3.FrameHeader
+}
+
+func NewMP3() (MP3, error) {
+	return &mp3Codec{}, nil
+}
+
+func (v *mp3Codec) Header() *mp3.FrameHeader {
+	return v.header
+}
+
+func (v *mp3Codec) Encode(frames []byte) (tag []byte, err error) {
+	header := mp3.NewFrameHeader()
+	if err = header.UnmarshalBinary(frames); err != nil {
+		return nil, oe.WithMessage(err, "unmarshal header")
+	}
+	v.header = header
+
+	frame := &AudioFrame{
+		SoundFormat: AudioCodecMP3, SoundSize: AudioSampleBits16bits, Raw: frames,
+	}
+
+	// For FLV, the SoundRate is 44kHz for MP3 of 32, 44.1 or 48kHz.
+	switch header.SampleRate {
+	case 8000:
+		frame.SoundFormat, frame.SoundRate = AudioCodecMP3In8kHz, AudioSamplingRate5kHz
+	case 11025, 12000:
+		frame.SoundRate = AudioSamplingRate11kHz
+	case 16000, 22050, 24000:
+		frame.SoundRate = AudioSamplingRate22kHz
+	default:
+		frame.SoundRate = AudioSamplingRate44kHz
+	}
+
+	frame.SoundType = AudioChannelsStereo
+	if header.ChannelMode == mp3.ChannelModeMono {
+		frame.SoundType = AudioChannelsMono
+	}
+
+	return (&audioPackager{}).Encode(frame)
+}
+
+func (v *mp3Codec) Decode(tag []byte) (frame *AudioFrame, header *mp3.FrameHeader, err error) {
+	if frame, err = (&audioPackager{}).Decode(tag); err != nil {
+		return nil, nil, oe.WithMessage(err, "decode audio")
+	}
+
+	if frame.SoundFormat != AudioCodecMP3 && frame.SoundFormat != AudioCodecMP3In8kHz {
+		return nil, nil, oe.Errorf("invalid codec %v", frame.SoundFormat)
+	}
+
+	header = mp3.NewFrameHeader()
+	if err = header.UnmarshalBinary(frame.Raw); err != nil {
+		return nil, nil, oe.WithMessage(err, "unmarshal header")
+	}
+	v.header = header
+
+	return
+}
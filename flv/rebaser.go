@@ -0,0 +1,122 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The rebaser for tag timestamp, to concatenate FLV files as a live stream.
+package flv
+
+import (
+	"sync"
+)
+
+// The TimestampRebaser shifts the timestamp of tags by an offset, which is updated
+// at the splice point, for example, to loop a FLV file or play a playlist as live
+// stream, where the timestamp of each file starts from zero.
+// @remark It's safe for concurrent use.
+type TimestampRebaser struct {
+	// The gap between the last tag before splice and the first tag after, in ms.
+	SpliceGap uint32
+
+	lock sync.Mutex
+	// The offset to add to the timestamp of input tags.
+	offset int64
+	// The max timestamp of output tags, and whether there is any output.
+	last   uint32
+	output bool
+	// Whether the next tag is the first one after splice.
+	splicing bool
+}
+
+func NewTimestampRebaser() *TimestampRebaser {
+	return &TimestampRebaser{SpliceGap: 40}
+}
+
+// Get the current offset, which is added to the timestamp of input tags.
+func (v *TimestampRebaser) Offset() int64 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.offset
+}
+
+// Set the offset directly, for example, to align the timestamp with other streams.
+func (v *TimestampRebaser) SetOffset(offset int64) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.offset, v.splicing = offset, false
+}
+
+// Mark the splice point, for example, when start to read the next file, so the
+// first tag after splice follows the last tag by SpliceGap.
+func (v *TimestampRebaser) Splice() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.splicing = true
+}
+
+// Rebase the timestamp of a input tag, return the timestamp for output.
+// @remark The timestamp is clamped to zero if negative.
+func (v *TimestampRebaser) Rebase(timestamp uint32) uint32 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.splicing {
+		v.splicing = false
+		if v.output {
+			v.offset = int64(v.last) + int64(v.SpliceGap) - int64(timestamp)
+		}
+	}
+
+	rebased := int64(timestamp) + v.offset
+	if rebased < 0 {
+		rebased = 0
+	}
+
+	if !v.output || uint32(rebased) > v.last {
+		v.last = uint32(rebased)
+	}
+	v.output = true
+
+	return uint32(rebased)
+}
+
+// Wrap the demuxer to rebase the timestamp of tags, and call Splice when read
+// the header, so user can create a demuxer for each file to concatenate them.
+func (v *TimestampRebaser) Wrap(d Demuxer) Demuxer {
+	return &rebaseDemuxer{Demuxer: d, rebaser: v}
+}
+
+type rebaseDemuxer struct {
+	Demuxer
+	rebaser *TimestampRebaser
+}
+
+func (v *rebaseDemuxer) ReadHeader() (version uint8, hasVideo, hasAudio bool, err error) {
+	if version, hasVideo, hasAudio, err = v.Demuxer.ReadHeader(); err == nil {
+		v.rebaser.Splice()
+	}
+	return
+}
+
+func (v *rebaseDemuxer) ReadTagHeader() (tagType TagType, tagSize, timestamp uint32, err error) {
+	if tagType, tagSize, timestamp, err = v.Demuxer.ReadTagHeader(); err == nil {
+		timestamp = v.rebaser.Rebase(timestamp)
+	}
+	return
+}
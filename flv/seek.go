@@ -0,0 +1,223 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The seekable demuxer for VOD, to seek to the keyframe by timestamp.
+package flv
+
+import (
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+	"sort"
+)
+
+// The keyframe in index, the timestamp in ms and the position of tag in file.
+type Keyframe struct {
+	Timestamp uint32
+	Position  int64
+}
+
+// The demuxer which can seek to keyframe, for example, for VOD server.
+// @remark The keyframes index is from onMetaData, or built by scanning the file if not found.
+type SeekableDemuxer interface {
+	Demuxer
+	// Get the keyframes index, sorted by timestamp.
+	Keyframes() ([]*Keyframe, error)
+	// Seek to the nearest keyframe at or before timestamp in ms, return the timestamp of
+	// keyframe, then user can read tags from the keyframe.
+	Seek(timestamp uint32) (keyframe uint32, err error)
+}
+
+// Create a seekable demuxer, which parse in ParseModeIgnore.
+func NewSeekableDemuxer(r io.ReadSeeker) (SeekableDemuxer, error) {
+	return &seekableDemuxer{demuxer: &demuxer{r: r}, rs: r}, nil
+}
+
+type seekableDemuxer struct {
+	*demuxer
+	rs io.ReadSeeker
+	// The keyframes index, nil if not indexed.
+	keyframes []*Keyframe
+}
+
+func (v *seekableDemuxer) Keyframes() (keyframes []*Keyframe, err error) {
+	if v.keyframes != nil {
+		return v.keyframes, nil
+	}
+
+	// Restore the position after indexed.
+	var pos int64
+	if pos, err = v.rs.Seek(0, seekCurrent); err != nil {
+		return nil, oe.Wrap(err, "tell")
+	}
+	defer v.rs.Seek(pos, seekStart)
+
+	if keyframes, err = v.index(); err != nil {
+		return nil, oe.WithMessage(err, "index")
+	}
+
+	v.keyframes = keyframes
+	return
+}
+
+// Scan the tags from the first tag, use the keyframes of onMetaData if found.
+func (v *seekableDemuxer) index() (keyframes []*Keyframe, err error) {
+	// The FLV header is 9 bytes, and the first previous tag size is 4 bytes.
+	var pos int64
+	if pos, err = v.rs.Seek(13, seekStart); err != nil {
+		return nil, oe.Wrap(err, "seek")
+	}
+
+	h := make([]byte, 11)
+	for {
+		if _, err = io.ReadFull(v.rs, h); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, oe.Wrap(err, "read tag header")
+		}
+
+		tagType := TagType(h[0])
+		tagSize := uint32(h[1])<<16 | uint32(h[2])<<8 | uint32(h[3])
+		timestamp := uint32(h[7])<<24 | uint32(h[4])<<16 | uint32(h[5])<<8 | uint32(h[6])
+
+		// Only read the body of script tag, and the first 2 bytes of video tag.
+		var body []byte
+		if tagType == TagTypeScriptData {
+			body = make([]byte, tagSize)
+		} else if tagType == TagTypeVideo && tagSize >= 2 {
+			body = make([]byte, 2)
+		}
+		if _, err = io.ReadFull(v.rs, body); err != nil {
+			break
+		}
+
+		switch tagType {
+		case TagTypeScriptData:
+			if ks := metadataKeyframes(body); len(ks) > 0 {
+				return ks, nil
+			}
+		case TagTypeVideo:
+			if len(body) < 2 {
+				break
+			}
+
+			frameType, codec := VideoFrameType(body[0]>>4), VideoCodec(body[0]&0x0f)
+			isAVC := codec == VideoCodecAVC || codec == VideoCodecHEVC
+			if frameType == VideoFrameTypeKeyframe && (!isAVC || VideoFrameTrait(body[1]) != VideoFrameTraitSequenceHeader) {
+				keyframes = append(keyframes, &Keyframe{Timestamp: timestamp, Position: pos})
+			}
+		}
+
+		if pos, err = v.rs.Seek(pos+11+int64(tagSize)+4, seekStart); err != nil {
+			return nil, oe.Wrap(err, "seek")
+		}
+	}
+
+	return keyframes, nil
+}
+
+// Parse the keyframes of onMetaData, nil if not found.
+func metadataKeyframes(body []byte) (keyframes []*Keyframe) {
+	m := NewMetadata()
+	if err := m.UnmarshalBinary(body); err != nil {
+		return nil
+	}
+
+	o, ok := amf0.ToNative(m.Extra["keyframes"]).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	times, _ := o["times"].([]interface{})
+	positions, _ := o["filepositions"].([]interface{})
+	for i := 0; i < len(times) && i < len(positions); i++ {
+		t, ok0 := times[i].(float64)
+		p, ok1 := positions[i].(float64)
+		if !ok0 || !ok1 {
+			return nil
+		}
+		keyframes = append(keyframes, &Keyframe{Timestamp: uint32(t * 1000), Position: int64(p)})
+	}
+
+	sort.Sort(keyframesByTimestamp(keyframes))
+	return
+}
+
+// Sort the keyframes by timestamp.
+type keyframesByTimestamp []*Keyframe
+
+func (v keyframesByTimestamp) Len() int {
+	return len(v)
+}
+
+func (v keyframesByTimestamp) Less(i, j int) bool {
+	return v[i].Timestamp < v[j].Timestamp
+}
+
+func (v keyframesByTimestamp) Swap(i, j int) {
+	v[i], v[j] = v[j], v[i]
+}
+
+func (v *seekableDemuxer) Seek(timestamp uint32) (keyframe uint32, err error) {
+	var keyframes []*Keyframe
+	if keyframes, err = v.Keyframes(); err != nil {
+		return 0, oe.WithMessage(err, "keyframes")
+	}
+
+	if len(keyframes) == 0 {
+		return 0, oe.New("no keyframes")
+	}
+
+	// The last keyframe at or before timestamp, or the first keyframe.
+	i := sort.Search(len(keyframes), func(i int) bool {
+		return keyframes[i].Timestamp > timestamp
+	})
+	if i > 0 {
+		i--
+	}
+
+	k := keyframes[i]
+	if _, err = v.rs.Seek(k.Position, seekStart); err != nil {
+		return 0, oe.Wrap(err, "seek")
+	}
+
+	// Reset the state to check the timestamps and previous tag size.
+	v.tagSize, v.timestamps = 0, nil
+
+	return k.Timestamp, nil
+}
+
+// Build the keyframes object for onMetaData, for example, set to the Extra of Metadata,
+// so the player or demuxer can seek without scanning the file.
+// @remark The times are in seconds, and the filepositions are the positions of tags.
+func KeyframesToAmf0(keyframes []*Keyframe) (amf0.Amf0, error) {
+	times := make([]float64, 0, len(keyframes))
+	positions := make([]float64, 0, len(keyframes))
+	for _, k := range keyframes {
+		times = append(times, float64(k.Timestamp)/1000)
+		positions = append(positions, float64(k.Position))
+	}
+
+	return amf0.FromNative(map[string]interface{}{
+		"times": times, "filepositions": positions,
+	})
+}
@@ -0,0 +1,262 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The slideshow, to build FLV or RTMP stream from still images, for example, the
+// placeholder stream before source is ready, or the bumpers of channel.
+package flv
+
+import (
+	"bytes"
+	"github.com/ossrs/go-oryx-lib/avc"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"time"
+)
+
+// The encoder to encode a still image to a H.264 intra frame in Annex B, which must
+// contain the SPS, PPS and IDR, for example, by x264 or ffmpeg.
+type StillEncoder func(img image.Image) (frame []byte, err error)
+
+// The slide, a pre-encoded H.264 intra frame and the duration to show it.
+type Slide struct {
+	// The duration to show the slide.
+	Duration time.Duration
+	// The parameter sets and the IDR slices.
+	sps, pps *avc.NALU
+	nalus    []*avc.NALU
+}
+
+// Create a slide from the H.264 intra frame in Annex B, which contains the SPS, PPS and IDR.
+func NewSlide(frame []byte, duration time.Duration) (*Slide, error) {
+	v := &Slide{Duration: duration}
+
+	for _, b := range splitAnnexB(frame) {
+		nalu := avc.NewNALU()
+		if err := nalu.UnmarshalBinary(b); err != nil {
+			return nil, oe.WithMessage(err, "unmarshal nalu")
+		}
+
+		switch nalu.NALUType {
+		case avc.NALUTypeSPS:
+			v.sps = nalu
+		case avc.NALUTypePPS:
+			v.pps = nalu
+		case avc.NALUTypeIDR:
+			v.nalus = append(v.nalus, nalu)
+		}
+	}
+
+	if v.sps == nil || v.pps == nil {
+		return nil, oe.New("no sps or pps")
+	}
+	if len(v.nalus) == 0 {
+		return nil, oe.New("no idr")
+	}
+	return v, nil
+}
+
+// The Slideshow generates the FLV video tags from slides, each slide is a keyframe which
+// is repeated at every interval, so the player which joins later can decode it. The
+// sequence header is generated for the first slide and when the parameter sets change.
+// For example, to write a FLV file:
+//		s := NewSlideshow(nil)
+//		s.Add(frame, 5*time.Second)
+//		m.WriteHeader(true, false)
+//		s.Mux(m)
+// Or to publish the RTMP stream, by NewMessageFromTag of rtmp:
+//		s.Tags(func(tagType TagType, timestamp uint32, tag []byte) error {...})
+// @remark The timestamp continues, so call Tags or Mux again to loop the slides.
+// @remark The keyframe is repeated as is, which is accepted by decoders, although the
+// consecutive IDR should use different idr_pic_id.
+type Slideshow struct {
+	// The interval to repeat the keyframe of slide, default to 1s.
+	Interval time.Duration
+	// The encoder for images, required by AddImage.
+	Encoder StillEncoder
+	// The slides to show in order.
+	slides []*Slide
+	// The timestamp of next tag in ms.
+	timestamp uint32
+	// The last sequence header generated.
+	sequenceHeader []byte
+}
+
+func NewSlideshow(encoder StillEncoder) *Slideshow {
+	return &Slideshow{Interval: time.Duration(1) * time.Second, Encoder: encoder}
+}
+
+// Get the number of slides.
+func (v *Slideshow) Slides() int {
+	return len(v.slides)
+}
+
+// Add a slide of H.264 intra frame in Annex B.
+func (v *Slideshow) Add(frame []byte, duration time.Duration) error {
+	s, err := NewSlide(frame, duration)
+	if err != nil {
+		return err
+	}
+
+	v.slides = append(v.slides, s)
+	return nil
+}
+
+// Add a slide of image, encoded by the Encoder.
+func (v *Slideshow) AddImage(img image.Image, duration time.Duration) error {
+	if v.Encoder == nil {
+		return oe.New("no encoder")
+	}
+
+	frame, err := v.Encoder(img)
+	if err != nil {
+		return oe.WithMessage(err, "encode image")
+	}
+
+	return v.Add(frame, duration)
+}
+
+// Add a slide of image file, for example, the JPEG or PNG, encoded by the Encoder.
+func (v *Slideshow) AddImageFile(r io.Reader, duration time.Duration) error {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return oe.Wrap(err, "decode image")
+	}
+
+	if err = v.AddImage(img, duration); err != nil {
+		return oe.WithMessage(err, format)
+	}
+	return nil
+}
+
+// Generate the tags of all slides once, the timestamp is in ms.
+func (v *Slideshow) Tags(onTag func(tagType TagType, timestamp uint32, tag []byte) error) (err error) {
+	interval := v.Interval
+	if interval <= 0 {
+		interval = time.Duration(1) * time.Second
+	}
+
+	for _, s := range v.slides {
+		var sh []byte
+		if sh, err = s.sequenceHeader(); err != nil {
+			return oe.WithMessage(err, "sequence header")
+		}
+
+		if !bytes.Equal(sh, v.sequenceHeader) {
+			if err = onTag(TagTypeVideo, v.timestamp, sh); err != nil {
+				return oe.WithMessage(err, "sequence header")
+			}
+			v.sequenceHeader = sh
+		}
+
+		var frame []byte
+		if frame, err = s.frame(); err != nil {
+			return oe.WithMessage(err, "frame")
+		}
+
+		// Show the slide at least once.
+		duration := s.Duration
+		if duration <= 0 {
+			duration = interval
+		}
+
+		for elapsed := time.Duration(0); elapsed < duration; elapsed += interval {
+			if err = onTag(TagTypeVideo, v.timestamp+uint32(elapsed/time.Millisecond), frame); err != nil {
+				return oe.WithMessage(err, "frame")
+			}
+		}
+		v.timestamp += uint32(duration / time.Millisecond)
+	}
+
+	return
+}
+
+// Write the tags of all slides once to the muxer, user should write the header.
+func (v *Slideshow) Mux(m Muxer) error {
+	return v.Tags(m.WriteTag)
+}
+
+// The FLV video tag of AVC sequence header.
+func (v *Slide) sequenceHeader() ([]byte, error) {
+	// The profile and level are the first and third bytes of SPS after NALU header.
+	if len(v.sps.Data) < 3 {
+		return nil, oe.Errorf("sps too short %v", len(v.sps.Data))
+	}
+
+	r := avc.NewAVCDecoderConfigurationRecord()
+	r.AVCProfileIndication = avc.AVCProfile(v.sps.Data[0])
+	r.AVCLevelIndication = avc.AVCLevel(v.sps.Data[2])
+	r.LengthSizeMinusOne = 3
+	r.SequenceParameterSetNALUnits = []*avc.NALU{v.sps}
+	r.PictureParameterSetNALUnits = []*avc.NALU{v.pps}
+
+	raw, err := r.MarshalBinary()
+	if err != nil {
+		return nil, oe.WithMessage(err, "marshal sequence header")
+	}
+
+	return encodeAVCTag(VideoFrameTypeKeyframe, VideoFrameTraitSequenceHeader, raw)
+}
+
+// The FLV video tag of keyframe.
+func (v *Slide) frame() ([]byte, error) {
+	sample := avc.NewAVCSample(3)
+	sample.NALUs = v.nalus
+
+	raw, err := sample.MarshalBinary()
+	if err != nil {
+		return nil, oe.WithMessage(err, "marshal sample")
+	}
+
+	return encodeAVCTag(VideoFrameTypeKeyframe, VideoFrameTraitNALU, raw)
+}
+
+func encodeAVCTag(frameType VideoFrameType, trait VideoFrameTrait, raw []byte) ([]byte, error) {
+	p, err := NewVideoPackager()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Encode(&VideoFrame{CodecID: VideoCodecAVC, FrameType: frameType, Trait: trait, Raw: raw})
+}
+
+// Split the Annex B bytes to NALUs, by the start code 0x000001 or 0x00000001.
+func splitAnnexB(b []byte) (nalus [][]byte) {
+	startCode := []byte{0x00, 0x00, 0x01}
+
+	for {
+		pos := bytes.Index(b, startCode)
+		if pos < 0 {
+			if len(b) > 0 {
+				nalus = append(nalus, b)
+			}
+			return
+		}
+
+		// The trailing zero is the 4 bytes start code of next NALU.
+		if nalu := bytes.TrimRight(b[:pos], "\x00"); len(nalu) > 0 {
+			nalus = append(nalus, nalu)
+		}
+		b = b[pos+len(startCode):]
+	}
+}
@@ -0,0 +1,86 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The synchronized muxer, which is safe for multiple goroutines.
+package flv
+
+import (
+	"hash"
+	"sync"
+)
+
+// The SyncMuxer is a Muxer which is safe for multiple goroutines, for example, the
+// audio and video pipelines write to one muxer without external locks.
+// @remark Each tag is written atomically, but the order of tags between goroutines
+// is the order of calls, so the producers should write in timestamp order.
+type SyncMuxer struct {
+	lock sync.Mutex
+	m    Muxer
+}
+
+// Wrap the muxer m to be goroutine-safe, m should never be used directly after wrapped.
+func NewSyncMuxer(m Muxer) *SyncMuxer {
+	return &SyncMuxer{m: m}
+}
+
+func (v *SyncMuxer) WriteHeader(hasVideo, hasAudio bool) (err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.m.WriteHeader(hasVideo, hasAudio)
+}
+
+func (v *SyncMuxer) WriteTag(tagType TagType, timestamp uint32, tag []byte) (err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.m.WriteTag(tagType, timestamp, tag)
+}
+
+func (v *SyncMuxer) Bytes() uint64 {
+	return v.m.Bytes()
+}
+
+func (v *SyncMuxer) Tags() uint64 {
+	return v.m.Tags()
+}
+
+func (v *SyncMuxer) SetChecksum(h hash.Hash) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.m.SetChecksum(h)
+}
+
+func (v *SyncMuxer) Checksum() []byte {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.m.Checksum()
+}
+
+func (v *SyncMuxer) OnTag(h TagHandler) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.m.OnTag(h)
+}
+
+func (v *SyncMuxer) Close() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.m.Close()
+}
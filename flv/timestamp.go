@@ -0,0 +1,113 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The timestamp source, to generate the timestamp for frames without timestamp.
+package flv
+
+import (
+	"github.com/ossrs/go-oryx-lib/aac"
+)
+
+// The source of timestamp, for example, to generate the timestamp of raw AAC frames.
+type TimestampSource interface {
+	// Get the timestamp in ms of next frame, then advance the source.
+	Next() uint32
+}
+
+// The AudioTimestampSource generates the timestamp from the cumulative number of
+// samples and the sample rate, which never drift, rather than accumulating the
+// rounded duration in ms of each frame. For example, the AAC frame of 44.1kHz is
+// about 23.22ms, it drifts 1s after about 4.5 minutes if accumulate 23ms.
+type AudioTimestampSource struct {
+	sampleRate   uint64
+	frameSamples uint64
+	// The timestamp in ms of the first frame.
+	base uint32
+	// The number of samples generated.
+	samples uint64
+}
+
+// Create a source for frames of sampleRate in Hz, each frame contains frameSamples samples.
+func NewAudioTimestampSource(sampleRate, frameSamples int) *AudioTimestampSource {
+	return &AudioTimestampSource{sampleRate: uint64(sampleRate), frameSamples: uint64(frameSamples)}
+}
+
+// Create a source for AAC frames of asc.
+// @remark We use the core sample rate and 1024 samples of ASC, which is also right
+// for HE-AAC, because the SBR doubles both the sample rate and the samples.
+func NewAACTimestampSource(asc *aac.AudioSpecificConfig) *AudioTimestampSource {
+	return NewAudioTimestampSource(asc.SampleRate.ToHz(), 1024)
+}
+
+// Set the timestamp in ms of the first frame, for example, to start from the video.
+func (v *AudioTimestampSource) SetBase(base uint32) {
+	v.base = base
+}
+
+// Get the number of samples generated.
+func (v *AudioTimestampSource) Samples() uint64 {
+	return v.samples
+}
+
+// The interface TimestampSource.
+func (v *AudioTimestampSource) Next() uint32 {
+	return v.Advance(v.frameSamples)
+}
+
+// Get the timestamp of next frame, then advance the source by samples of this frame,
+// for the frames which contains variable number of samples.
+func (v *AudioTimestampSource) Advance(samples uint64) uint32 {
+	var timestamp uint32
+	if v.sampleRate > 0 {
+		timestamp = v.base + uint32(v.samples*1000/v.sampleRate)
+	}
+
+	v.samples += samples
+	return timestamp
+}
+
+// Create a muxer which uses the audio source to generate the timestamp for audio tags,
+// and ignore the timestamp of audio tag to write.
+// @remark The sequence header of AAC uses the timestamp of last frame, never advance the source.
+func NewTimestampMuxer(m Muxer, audio TimestampSource) Muxer {
+	return &timestampMuxer{Muxer: m, audio: audio}
+}
+
+type timestampMuxer struct {
+	Muxer
+	audio TimestampSource
+	// The timestamp of last audio frame.
+	last uint32
+}
+
+func (v *timestampMuxer) WriteTag(tagType TagType, timestamp uint32, tag []byte) (err error) {
+	if tagType != TagTypeAudio {
+		return v.Muxer.WriteTag(tagType, timestamp, tag)
+	}
+
+	isSequenceHeader := len(tag) > 1 && AudioCodec(tag[0]>>4) == AudioCodecAAC &&
+		AudioFrameTrait(tag[1]) == AudioFrameTraitSequenceHeader
+	if !isSequenceHeader {
+		v.last = v.audio.Next()
+	}
+
+	return v.Muxer.WriteTag(tagType, v.last, tag)
+}
@@ -0,0 +1,254 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The validator to diagnose the FLV stream, for example, a stream doctor endpoint.
+package flv
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/aac"
+	"github.com/ossrs/go-oryx-lib/avc"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+)
+
+// The kind of problem found by validator.
+type FindingKind uint8
+
+const (
+	// The tag is corrupt, failed to decode the tag header or sequence header.
+	FindingCorruptTag FindingKind = iota
+	// The AAC raw or AVC NALU frame is received before sequence header.
+	FindingMissingSequenceHeader
+	// The timestamp of tag is smaller than the previous tag of same type.
+	FindingTimestampRegression
+	// The AAC raw frame is in ADTS, or the ADTS header mismatch the ASC.
+	FindingADTSMismatch
+	// The size of NALU is corrupt, for example, exceed the tag.
+	FindingNALUSizeCorrupt
+)
+
+func (v FindingKind) String() string {
+	switch v {
+	case FindingCorruptTag:
+		return "CorruptTag"
+	case FindingMissingSequenceHeader:
+		return "MissingSequenceHeader"
+	case FindingTimestampRegression:
+		return "TimestampRegression"
+	case FindingADTSMismatch:
+		return "ADTSMismatch"
+	case FindingNALUSizeCorrupt:
+		return "NALUSizeCorrupt"
+	default:
+		return "Unknown"
+	}
+}
+
+// Marshal the kind as its name, for JSON.
+func (v FindingKind) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// The problem found by validator, at the tag of stream.
+type Finding struct {
+	Kind FindingKind `json:"kind"`
+	// The index of tag in stream, starts from 0.
+	Index     uint64  `json:"index"`
+	TagType   TagType `json:"tag_type"`
+	Timestamp uint32  `json:"timestamp"`
+	Message   string  `json:"message"`
+}
+
+func (v *Finding) String() string {
+	return fmt.Sprintf("#%v %v %vms %v, %v", v.Index, v.TagType, v.Timestamp, v.Kind, v.Message)
+}
+
+// The Validator walks the tags of stream, reports the problems as findings.
+// @remark The missing sequence header is reported once, until got the sequence header.
+// @remark Only check the AAC and AVC frames, other codecs are only checked for timestamp.
+type Validator struct {
+	// The number of tags validated.
+	tags uint64
+	// The last timestamp of audio and video, ok if got tag.
+	audioTimestamp, videoTimestamp uint32
+	audioOK, videoOK               bool
+
+	// The ASC of AAC, nil if no sequence header.
+	asc *aac.AudioSpecificConfig
+	// The AVC decoder configuration, nil if no sequence header.
+	avcc *avc.AVCDecoderConfigurationRecord
+	// Whether reported the missing sequence header.
+	audioReported, videoReported bool
+
+	findings []*Finding
+}
+
+func NewValidator() *Validator {
+	return &Validator{}
+}
+
+// Get all findings of validated tags.
+func (v *Validator) Findings() []*Finding {
+	return v.findings
+}
+
+// Validate the tag, return the findings of this tag, nil if no problem.
+func (v *Validator) Validate(tagType TagType, timestamp uint32, tag []byte) (findings []*Finding) {
+	add := func(kind FindingKind, format string, a ...interface{}) {
+		findings = append(findings, &Finding{
+			Kind: kind, Index: v.tags, TagType: tagType, Timestamp: timestamp,
+			Message: fmt.Sprintf(format, a...),
+		})
+	}
+
+	switch tagType {
+	case TagTypeAudio:
+		if v.audioOK && timestamp < v.audioTimestamp {
+			add(FindingTimestampRegression, "from %v to %v", v.audioTimestamp, timestamp)
+		}
+		v.audioTimestamp, v.audioOK = timestamp, true
+		v.validateAudio(tag, add)
+	case TagTypeVideo:
+		if v.videoOK && timestamp < v.videoTimestamp {
+			add(FindingTimestampRegression, "from %v to %v", v.videoTimestamp, timestamp)
+		}
+		v.videoTimestamp, v.videoOK = timestamp, true
+		v.validateVideo(tag, add)
+	}
+
+	v.tags++
+	v.findings = append(v.findings, findings...)
+	return
+}
+
+func (v *Validator) validateAudio(tag []byte, add func(kind FindingKind, format string, a ...interface{})) {
+	frame, err := (&audioPackager{}).Decode(tag)
+	if err != nil {
+		add(FindingCorruptTag, "decode audio, %v", err)
+		return
+	}
+
+	if frame.SoundFormat != AudioCodecAAC {
+		return
+	}
+
+	if frame.Trait == AudioFrameTraitSequenceHeader {
+		asc := &aac.AudioSpecificConfig{}
+		if err = asc.UnmarshalBinary(frame.Raw); err != nil {
+			add(FindingCorruptTag, "unmarshal asc, %v", err)
+			return
+		}
+		v.asc, v.audioReported = asc, false
+		return
+	}
+
+	if v.asc == nil {
+		if !v.audioReported {
+			add(FindingMissingSequenceHeader, "no AAC sequence header")
+			v.audioReported = true
+		}
+		return
+	}
+
+	// The AAC raw frame in FLV should never be ADTS.
+	if p := frame.Raw; len(p) > 7 && p[0] == 0xff && p[1]&0xf0 == 0xf0 {
+		adts, _ := aac.NewADTS()
+		if _, _, err = adts.Decode(p); err != nil {
+			add(FindingADTSMismatch, "ADTS frame, %v", err)
+			return
+		}
+
+		if asc := adts.(*aac.ADTSImpl).ASC(); asc.SampleRate != v.asc.SampleRate || asc.Channels != v.asc.Channels {
+			add(FindingADTSMismatch, "ADTS %v %v, ASC %v %v", asc.SampleRate, asc.Channels, v.asc.SampleRate, v.asc.Channels)
+			return
+		}
+		add(FindingADTSMismatch, "ADTS frame")
+	}
+}
+
+func (v *Validator) validateVideo(tag []byte, add func(kind FindingKind, format string, a ...interface{})) {
+	frame, err := (&videoPackager{}).Decode(tag)
+	if err != nil {
+		add(FindingCorruptTag, "decode video, %v", err)
+		return
+	}
+
+	if frame.CodecID != VideoCodecAVC || frame.FrameType == VideoFrameTypeInfo {
+		return
+	}
+
+	switch frame.Trait {
+	case VideoFrameTraitSequenceHeader:
+		avcc := avc.NewAVCDecoderConfigurationRecord()
+		if err = avcc.UnmarshalBinary(frame.Raw); err != nil {
+			add(FindingCorruptTag, "unmarshal avcc, %v", err)
+			return
+		}
+		v.avcc, v.videoReported = avcc, false
+	case VideoFrameTraitNALU:
+		if v.avcc == nil {
+			if !v.videoReported {
+				add(FindingMissingSequenceHeader, "no AVC sequence header")
+				v.videoReported = true
+			}
+			return
+		}
+
+		if err = avc.NewAVCSample(v.avcc.LengthSizeMinusOne).UnmarshalBinary(frame.Raw); err != nil {
+			add(FindingNALUSizeCorrupt, "%v", err)
+		}
+	}
+}
+
+// Validate the FLV stream until EOF, return the findings.
+// @remark The err is not nil only when failed to read the stream.
+// @remark Never repair the stream, so the demuxer is in ParseModeIgnore.
+func Validate(r io.Reader) (findings []*Finding, err error) {
+	d, err := NewDemuxer(r)
+	if err != nil {
+		return nil, oe.WithMessage(err, "create demuxer")
+	}
+	defer d.Close()
+
+	if _, _, _, err = d.ReadHeader(); err != nil {
+		return nil, oe.WithMessage(err, "read header")
+	}
+
+	v := NewValidator()
+	for {
+		var tagType TagType
+		var tagSize, timestamp uint32
+		if tagType, tagSize, timestamp, err = d.ReadTagHeader(); err != nil {
+			if oe.Cause(err) == io.EOF {
+				return v.Findings(), nil
+			}
+			return v.Findings(), oe.WithMessage(err, "read tag header")
+		}
+
+		var tag []byte
+		if tag, err = d.ReadTag(tagSize); err != nil {
+			return v.Findings(), oe.WithMessage(err, "read tag")
+		}
+
+		v.Validate(tagType, timestamp, tag)
+	}
+}
@@ -0,0 +1,168 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx http package, the cache profiles for live and VoD responses.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// The profile of Cache-Control and Expires, so the CDN in front of server caches
+// the responses correctly.
+type CacheProfile struct {
+	// Never store the response, for example, the live playlist.
+	NoStore bool
+	// Whether the response can be cached by shared cache, such as CDN.
+	Public bool
+	// The max age to cache the response.
+	MaxAge time.Duration
+	// The response never changes, so the client never revalidate it.
+	Immutable bool
+}
+
+// The canned profiles, see CacheLive, CacheSegment, CacheVoD and CacheAPI.
+var (
+	cacheLive    = CacheProfile{NoStore: true}
+	cacheSegment = CacheProfile{Public: true, MaxAge: time.Duration(365*24) * time.Hour, Immutable: true}
+	cacheVoD     = CacheProfile{Public: true, MaxAge: time.Duration(1) * time.Hour}
+	cacheAPI     = CacheProfile{MaxAge: time.Duration(3) * time.Second}
+)
+
+// For the live playlist, such as m3u8 and mpd, which changes frequently, and the live
+// streams, such as HTTP-FLV, MP3 and AAC.
+func CacheLive() CacheProfile {
+	return cacheLive
+}
+
+// For the segments, such as ts and m4s, which never changes once generated.
+func CacheSegment() CacheProfile {
+	return cacheSegment
+}
+
+// For the VoD files, such as mp4, which might be replaced.
+func CacheVoD() CacheProfile {
+	return cacheVoD
+}
+
+// For the APIs, the client can cache it for a short while.
+func CacheAPI() CacheProfile {
+	return cacheAPI
+}
+
+// The value of Cache-Control, for example, public, max-age=31536000, immutable
+func (v CacheProfile) String() string {
+	if v.NoStore {
+		return "no-store, no-cache"
+	}
+
+	var s []string
+	if v.Public {
+		s = append(s, "public")
+	} else {
+		s = append(s, "private")
+	}
+
+	s = append(s, fmt.Sprintf("max-age=%v", int64(v.MaxAge/time.Second)))
+	if v.Immutable {
+		s = append(s, "immutable")
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// Set the Cache-Control and Expires of response.
+// @remark Should be called before writing the header.
+func (v CacheProfile) Apply(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Cache-Control", v.String())
+
+	// The Expires and Pragma is for HTTP/1.0 caches.
+	if v.NoStore {
+		h.Set("Expires", "0")
+		h.Set("Pragma", "no-cache")
+		return
+	}
+	h.Set("Expires", time.Now().Add(v.MaxAge).UTC().Format(http.TimeFormat))
+}
+
+// Wrap the handler to apply the profile to all responses.
+func (v CacheProfile) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v.Apply(w)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// The profiles by the extension of path, for example, ".m3u8" for CacheLive.
+type CacheProfiles map[string]CacheProfile
+
+// Create the default profiles, CacheLive for m3u8 and mpd, CacheSegment for ts and m4s,
+// CacheVoD for mp4 and m4a, and CacheLive for flv, mp3 and aac which might be live streams.
+// User can opt in to cache the VoD files, for example:
+//		profiles := DefaultCacheProfiles()
+//		profiles[".flv"] = CacheVoD()
+//		http.Handle("/vod/", profiles.Handler(http.FileServer(http.Dir("./objs/vod"))))
+func DefaultCacheProfiles() CacheProfiles {
+	return CacheProfiles{
+		".m3u8": cacheLive, ".mpd": cacheLive,
+		".ts": cacheSegment, ".m4s": cacheSegment,
+		".mp4": cacheVoD, ".m4a": cacheVoD,
+		".flv": cacheLive, ".mp3": cacheLive, ".aac": cacheLive,
+	}
+}
+
+// Get the profile by the extension of path, ok is false if unknown.
+func (v CacheProfiles) Of(p string) (profile CacheProfile, ok bool) {
+	profile, ok = v[strings.ToLower(path.Ext(p))]
+	return
+}
+
+// Wrap the handler to apply the profile by the extension of request path.
+// @remark The response of unknown extension is not changed.
+func (v CacheProfiles) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := v.Of(r.URL.Path); ok {
+			p.Apply(w)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// The default profiles, never changed.
+var defaultCacheProfiles = DefaultCacheProfiles()
+
+// Get the profile by the extension of path, ok is false if unknown, see DefaultCacheProfiles.
+func CacheProfileOf(p string) (profile CacheProfile, ok bool) {
+	return defaultCacheProfiles.Of(p)
+}
+
+// Wrap the handler to apply the profile by the extension of request path, for example,
+// to serve the HLS or DASH files:
+//		http.Handle("/", CacheHandler(http.FileServer(http.Dir("./objs/nginx/html"))))
+// @remark The response of unknown extension is not changed, see DefaultCacheProfiles.
+func CacheHandler(h http.Handler) http.Handler {
+	return defaultCacheProfiles.Handler(h)
+}
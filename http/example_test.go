@@ -24,7 +24,11 @@ package http_test
 import (
 	"fmt"
 	oh "github.com/ossrs/go-oryx-lib/http"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
 )
 
 func ExampleHttpTest_Global() {
@@ -129,3 +133,212 @@ func ExampleApiRequest() {
 	// user can use the body to parse to specified struct.
 	_ = body
 }
+
+func ExampleRouter() {
+	// Register apis to the default mux, with method and description.
+	router := oh.NewRouter(http.DefaultServeMux)
+
+	router.HandleFunc("GET", "/api/v1/version", "Get the version of server", func(w http.ResponseWriter, r *http.Request) {
+		oh.WriteVersion(w, r, "1.2.3-4")
+	})
+
+	// The same path, for different methods.
+	router.HandleFunc("GET", "/api/v1/streams", "List all streams", func(w http.ResponseWriter, r *http.Request) {
+		oh.WriteData(nil, w, r, []string{"livestream"})
+	})
+	router.HandleFunc("DELETE", "/api/v1/streams", "Kickoff a stream", func(w http.ResponseWriter, r *http.Request) {
+		oh.Success(nil, w, r)
+	})
+
+	// Now, the /api/v1/routes response all routes in json.
+}
+
+func ExampleAPIVersion() {
+	router := oh.NewRouter(nil)
+
+	// The v1 is deprecated, which response the data without envelope.
+	v1 := &oh.APIVersion{
+		Name: "v1", Deprecated: true, Sunset: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		Envelope: func(v map[string]interface{}) interface{} {
+			return v["data"]
+		},
+	}
+	v2 := &oh.APIVersion{Name: "v2"}
+
+	// Mount the same handler at /api/v1/streams and /api/v2/streams.
+	router.HandleVersions("GET", "/streams", "List all streams", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oh.WriteData(nil, w, r, []string{"livestream"})
+	}), v1, v2)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/streams", nil))
+	fmt.Println(w.Header().Get("Deprecation"), w.Header().Get("Sunset"))
+	fmt.Println(w.Body.String())
+
+	// Output:
+	// true Mon, 01 Jan 2018 00:00:00 GMT
+	// ["livestream"]
+}
+
+func ExampleMetrics() {
+	router := oh.NewRouter(nil)
+
+	// Record the requests of all routes, and export at /metrics for Prometheus.
+	metrics := oh.NewMetrics()
+	metrics.Buckets = []float64{1}
+	router.SetMetrics(metrics)
+
+	router.HandleFunc("GET", "/api/v1/streams", "List all streams", func(w http.ResponseWriter, r *http.Request) {
+		oh.WriteData(nil, w, r, []string{"livestream"})
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/streams", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v1/streams", nil))
+
+	for _, r := range metrics.Routes() {
+		fmt.Println(r.Method, r.Path, r.Requests, r.Statuses, r.Buckets)
+	}
+
+	// Output:
+	// GET /api/v1/streams 1 map[200:1] [1]
+	// POST /api/v1/streams 1 map[405:1] [1]
+}
+
+func ExampleBandwidthLimiter() {
+	// Limit each client to 1MBps for DVR downloads, the connections of the same
+	// client share the budget, so the live streams got enough bandwidth.
+	limiter := oh.NewBandwidthLimiter(1024*1024, 64*1024)
+
+	http.Handle("/dvr/", limiter.Handler(http.FileServer(http.Dir("./objs/dvr"))))
+
+	// Or limit the writer directly, by client IP or token.
+	var w io.Writer
+	lw, release := limiter.Writer("192.168.1.100", w)
+	defer release()
+
+	fmt.Println(limiter.Clients())
+	_ = lw
+
+	// Output:
+	// 1
+}
+
+func ExampleUploadHandler() {
+	// Accept the DVR files up to 1GB, the files are spooled to disk.
+	h := &oh.UploadHandler{MaxSize: 1024 * 1024 * 1024}
+	h.OnUpload = func(r *http.Request, files []*oh.UploadFile) (interface{}, error) {
+		// Move the files to keep them, for example, os.Rename(f.Path, "./objs/dvr/"+f.Filename)
+		for _, f := range files {
+			fmt.Println(f.Filename, f.Size, f.Checksum)
+		}
+		return nil, nil
+	}
+	http.Handle("/api/v1/dvr", h)
+
+	// Upload with the checksum of body.
+	r := httptest.NewRequest("POST", "/api/v1/dvr?name=livestream.flv", strings.NewReader("FLV"))
+	r.Header.Set(oh.UploadChecksumHeader, "1962f326640cd601ec88aadbc08384d1a10200a6585f5c10ea74ed3b734029b8")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	fmt.Println(w.Code)
+
+	// Output:
+	// livestream.flv 3 1962f326640cd601ec88aadbc08384d1a10200a6585f5c10ea74ed3b734029b8
+	// 200
+}
+
+func ExampleCacheHandler() {
+	// Serve the HLS files, the m3u8 is never cached, the ts is cached forever.
+	h := oh.CacheHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("HLS"))
+	}))
+
+	for _, p := range []string{"/live/livestream.m3u8", "/live/livestream-0.ts", "/live/livestream.flv"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		fmt.Println(w.Header().Get("Cache-Control"))
+	}
+
+	// The flv might be live stream, so opt in to cache the VoD files.
+	profiles := oh.DefaultCacheProfiles()
+	profiles[".flv"] = oh.CacheVoD()
+	if p, ok := profiles.Of("/vod/livestream.flv"); ok {
+		fmt.Println(p)
+	}
+
+	// Or apply the profile for APIs.
+	router := oh.NewRouter(nil)
+	router.Handle("GET", "/api/v1/streams", "List all streams", oh.CacheAPI().Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oh.WriteData(nil, w, r, []string{"livestream"})
+	})))
+	fmt.Println(oh.CacheAPI())
+
+	// Output:
+	// no-store, no-cache
+	// public, max-age=31536000, immutable
+	// no-store, no-cache
+	// public, max-age=3600
+	// private, max-age=3
+}
+
+func ExampleAcceptMsgpack() {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oh.WriteData(nil, w, r, map[string]interface{}{"clients": 3})
+	})
+
+	// The stats polling request msgpack, in the same envelope {code, server, data}.
+	r := httptest.NewRequest("GET", "/api/v1/stats", nil)
+	r.Header.Set("Accept", "application/msgpack, application/json;q=0.5")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	fmt.Println(w.Header().Get("Content-Type"), w.Body.Bytes()[:6])
+
+	// Disable the JSONP, the callback is ignored.
+	oh.EnableJSONP = false
+	defer func() {
+		oh.EnableJSONP = true
+	}()
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/stats?callback=cb", nil))
+	fmt.Println(w.Header().Get("Content-Type"))
+
+	// Output:
+	// application/msgpack [131 164 99 111 100 101]
+	// application/json
+}
+
+func ExampleLongPoll() {
+	events := oh.NewLongPoll(2)
+	http.Handle("/api/v1/streams/events", events)
+
+	// The stream state changes.
+	events.Publish("publish livestream")
+	events.Publish("unpublish livestream")
+
+	// The client resumes after the first event.
+	r := events.Poll(1, time.Second, nil)
+	fmt.Println(r.Token, r.Events, r.Reset)
+
+	// The heartbeat when no event, the client polls again with the same token.
+	r = events.Poll(r.Token, 10*time.Millisecond, nil)
+	fmt.Println(r.Token, len(r.Events), r.Reset)
+
+	// Wakeup the waiting client when event published.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		events.Publish("publish stream2")
+	}()
+	r = events.Poll(r.Token, time.Second, nil)
+	fmt.Println(r.Token, r.Events, r.Reset)
+
+	// The client is reset when the events after its token are lost.
+	r = events.Poll(0, time.Second, nil)
+	fmt.Println(r.Token, r.Events, r.Reset)
+
+	// Output:
+	// 2 [unpublish livestream] false
+	// 2 0 false
+	// 3 [publish stream2] false
+	// 3 [unpublish livestream publish stream2] true
+}
@@ -35,6 +35,9 @@
 //			WriteCplxError, to directly write the complex error.
 // The global variables:
 //			oh.Server, to set the response header["Server"].
+//			oh.EnableJSONP, to enable or disable the JSONP by callback.
+// The content negotiation:
+//			Response msgpack when header["Accept"] is application/msgpack, see AcceptMsgpack.
 package http
 
 import (
@@ -51,11 +54,16 @@ import (
 const (
 	HttpJson       = "application/json"
 	HttpJavaScript = "application/javascript"
+	HttpMsgpack    = "application/msgpack"
 )
 
 // header["Server"] in response.
 var Server = "Oryx"
 
+// Whether response JSONP when callback in query, set to false to disable JSONP,
+// for example, for the APIs with credentials, to prevent the cross-site leaks.
+var EnableJSONP = true
+
 // system int error.
 type SystemError int
 
@@ -146,14 +154,8 @@ func SetHeader(w http.ResponseWriter) {
 	w.Header().Set("Server", Server)
 }
 
-// response json directly.
+// response json directly, or msgpack when client accept it.
 func jsonHandler(ctx ol.Context, rv interface{}) http.Handler {
-	var err error
-	var b []byte
-	if b, err = json.Marshal(rv); err != nil {
-		return Error(ctx, err)
-	}
-
 	status := http.StatusOK
 	if v, ok := rv.(HTTPStatus); ok {
 		status = v.Status()
@@ -163,7 +165,34 @@ func jsonHandler(ctx ol.Context, rv interface{}) http.Handler {
 		SetHeader(w)
 
 		q := r.URL.Query()
-		if cb := q.Get("callback"); cb != "" {
+		cb := q.Get("callback")
+		jsonp := cb != "" && EnableJSONP
+
+		// The response is negotiated by the Accept, except the JSONP.
+		if !jsonp {
+			w.Header().Add("Vary", "Accept")
+		}
+
+		// Response msgpack if client accept it, fallback to json if failed.
+		if !jsonp && AcceptMsgpack(r) {
+			if mb, err := marshalMsgpack(rv); err == nil {
+				w.Header().Set("Content-Type", HttpMsgpack)
+				if status != http.StatusOK {
+					w.WriteHeader(status)
+				}
+				// TODO: Handle error.
+				w.Write(mb)
+				return
+			}
+		}
+
+		b, err := json.Marshal(rv)
+		if err != nil {
+			Error(ctx, err).ServeHTTP(w, r)
+			return
+		}
+
+		if jsonp {
 			w.Header().Set("Content-Type", HttpJavaScript)
 			if status != http.StatusOK {
 				w.WriteHeader(status)
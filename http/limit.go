@@ -0,0 +1,209 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx http package, the bandwidth limiter for streaming large bodies.
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/https/time/rate"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The writer limited by token bucket, where the token is byte.
+type limitWriter struct {
+	w       io.Writer
+	limiter *rate.Limiter
+	// Closed to cancel the waiting for tokens, for example, the request is done.
+	cancel <-chan struct{}
+}
+
+// Create a writer limited by l, which is in bytes per second, the l can be shared
+// by many writers. For example, limit a DVR download to 1MBps:
+//		w = NewLimitWriter(w, rate.NewLimiter(1024*1024, 64*1024))
+// @remark The write is split by the burst of l, which should not be zero unless rate.Inf.
+func NewLimitWriter(w io.Writer, l *rate.Limiter) io.Writer {
+	return &limitWriter{w: w, limiter: l}
+}
+
+func (v *limitWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		b := p
+		if v.limiter.Limit() != rate.Inf {
+			burst := v.limiter.Burst()
+			if burst <= 0 {
+				return n, fmt.Errorf("limiter burst %v disallows write", burst)
+			}
+			if len(b) > burst {
+				b = b[:burst]
+			}
+
+			// Wait for the tokens, then write.
+			if err = v.wait(len(b)); err != nil {
+				return
+			}
+		}
+
+		var nn int
+		nn, err = v.w.Write(b)
+		if n += nn; err != nil {
+			return
+		}
+		p = p[nn:]
+	}
+
+	return
+}
+
+// Wait for size tokens, which should not exceed the burst, or cancelled.
+func (v *limitWriter) wait(size int) error {
+	r := v.limiter.ReserveN(time.Now(), size)
+	if !r.OK() {
+		return fmt.Errorf("reserve %v exceeds burst %v", size, v.limiter.Burst())
+	}
+
+	d := r.Delay()
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-v.cancel:
+		// Return the tokens, for other writers of the shared limiter.
+		r.Cancel()
+		return fmt.Errorf("write cancelled")
+	}
+}
+
+// The bandwidth limiter for clients, the connections of the same client share
+// the budget, to prioritize the live traffic over the large bodies.
+// @remark It's safe for concurrent use.
+type BandwidthLimiter struct {
+	// The bytes per second and burst of each client.
+	limit rate.Limit
+	burst int
+
+	lock    sync.Mutex
+	clients map[string]*sharedLimiter
+}
+
+// The limiter shared by the connections of client.
+type sharedLimiter struct {
+	limiter *rate.Limiter
+	refs    int
+}
+
+// Create a limiter for each client, in bytes per second, and the burst in bytes.
+func NewBandwidthLimiter(bytesPerSecond, burst int) *BandwidthLimiter {
+	return &BandwidthLimiter{
+		limit: rate.Limit(bytesPerSecond), burst: burst,
+		clients: make(map[string]*sharedLimiter),
+	}
+}
+
+// Get the number of clients which are writing.
+func (v *BandwidthLimiter) Clients() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return len(v.clients)
+}
+
+// Create a writer for client, user must call release when done.
+// @remark The client is the key of budget, for example, the IP or token.
+func (v *BandwidthLimiter) Writer(client string, w io.Writer) (lw io.Writer, release func()) {
+	return v.writer(client, w, nil)
+}
+
+// Create a writer for client, which stops waiting when cancel is closed.
+func (v *BandwidthLimiter) writer(client string, w io.Writer, cancel <-chan struct{}) (lw io.Writer, release func()) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	c, ok := v.clients[client]
+	if !ok {
+		c = &sharedLimiter{limiter: rate.NewLimiter(v.limit, v.burst)}
+		v.clients[client] = c
+	}
+	c.refs++
+
+	var once sync.Once
+	return &limitWriter{w: w, limiter: c.limiter, cancel: cancel}, func() {
+		once.Do(func() {
+			v.lock.Lock()
+			defer v.lock.Unlock()
+
+			if c.refs--; c.refs <= 0 {
+				delete(v.clients, client)
+			}
+		})
+	}
+}
+
+// Wrap the handler to limit the response body, the client is the IP of request.
+// @remark The waiting for tokens is cancelled when request is done, for go1.7+.
+func (v *BandwidthLimiter) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			client = host
+		}
+
+		lw, release := v.writer(client, w, requestDone(r))
+		defer release()
+
+		h.ServeHTTP(&limitResponseWriter{ResponseWriter: w, w: lw}, r)
+	})
+}
+
+// The response writer which body is limited.
+type limitResponseWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (v *limitResponseWriter) Write(p []byte) (int, error) {
+	return v.w.Write(p)
+}
+
+// The interface http.Flusher, for streaming such as HTTP-FLV.
+func (v *limitResponseWriter) Flush() {
+	if f, ok := v.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// The interface http.Hijacker, for WebSocket, which is not limited after hijacked.
+func (v *limitResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := v.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("not hijacker")
+}
@@ -0,0 +1,73 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package http
+
+import (
+	"bytes"
+	"github.com/ossrs/go-oryx-lib/https/time/rate"
+	"testing"
+	"time"
+)
+
+func TestLimitWriter_Write(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := NewLimitWriter(b, rate.NewLimiter(rate.Inf, 0))
+	if n, err := w.Write([]byte("hello")); err != nil || n != 5 {
+		t.Errorf("write %v, %v", n, err)
+	}
+
+	// The write is split by burst, which is larger than it.
+	b.Reset()
+	w = NewLimitWriter(b, rate.NewLimiter(1024*1024, 4))
+	if n, err := w.Write([]byte("hello, world")); err != nil || n != 12 {
+		t.Errorf("write %v, %v", n, err)
+	}
+	if s := b.String(); s != "hello, world" {
+		t.Errorf("got %v", s)
+	}
+
+	// The zero burst allows no write.
+	w = NewLimitWriter(b, rate.NewLimiter(1024, 0))
+	if _, err := w.Write([]byte("hello")); err == nil {
+		t.Error("should fail for zero burst")
+	}
+}
+
+func TestLimitWriter_Cancel(t *testing.T) {
+	cancel := make(chan struct{})
+	l := rate.NewLimiter(1, 4)
+	w := &limitWriter{w: &bytes.Buffer{}, limiter: l, cancel: cancel}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(cancel)
+	}()
+
+	// The second chunk waits for about 4s, until cancelled.
+	starttime := time.Now()
+	if n, err := w.Write([]byte("hello, world")); err == nil || n != 4 {
+		t.Errorf("write %v, %v", n, err)
+	}
+	if d := time.Now().Sub(starttime); d > time.Second {
+		t.Errorf("wait %v", d)
+	}
+}
@@ -0,0 +1,260 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx http package, the per-route metrics in the Prometheus text format.
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The path of the Prometheus exporter.
+const MetricsPath = "/metrics"
+
+// The default buckets of latency histogram, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// The metrics of a route, which is the method and path pattern.
+type RouteMetrics struct {
+	Method string
+	Path   string
+	// The number of requests.
+	Requests uint64
+	// The number of requests by status code.
+	Statuses map[int]uint64
+	// The sum of latency of all requests.
+	Latency time.Duration
+	// The cumulative number of requests by the upper bound of Buckets.
+	Buckets []uint64
+}
+
+// The metrics registry of routes, which is an http.Handler as the Prometheus
+// exporter, and a kxps.KrpsSource to calc the rps of api.
+// @remark It's safe for concurrent use.
+type Metrics struct {
+	// The upper bounds of latency histogram in seconds, sorted, see DefaultBuckets.
+	// @remark Never change it after any request observed.
+	Buckets []float64
+
+	requests   uint64
+	lock       sync.Mutex
+	routes     map[string]*RouteMetrics
+	collectors []Collector
+}
+
+// The collector of other metrics, for example, the RTMP send queues, which write
+// the metrics in the Prometheus text format.
+type Collector interface {
+	WriteMetrics(w io.Writer) error
+}
+
+// The adapter to use a function as Collector.
+type CollectorFunc func(w io.Writer) error
+
+func (v CollectorFunc) WriteMetrics(w io.Writer) error {
+	return v(w)
+}
+
+// Register the collector, which is exported after the metrics of routes.
+func (v *Metrics) Register(c Collector) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.collectors = append(v.collectors, c)
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{Buckets: DefaultBuckets, routes: make(map[string]*RouteMetrics)}
+}
+
+// The interface kxps.KrpsSource, the total number of requests.
+func (v *Metrics) NbRequests() uint64 {
+	return atomic.LoadUint64(&v.requests)
+}
+
+// Record a request of route, where path is the pattern rather than the url,
+// to keep the number of series small.
+func (v *Metrics) Observe(method, path string, status int, latency time.Duration) {
+	atomic.AddUint64(&v.requests, 1)
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	key := method + " " + path
+	r, ok := v.routes[key]
+	if !ok {
+		r = &RouteMetrics{
+			Method: method, Path: path,
+			Statuses: make(map[int]uint64), Buckets: make([]uint64, len(v.Buckets)),
+		}
+		v.routes[key] = r
+	}
+
+	r.Requests++
+	r.Statuses[status]++
+	r.Latency += latency
+	for i, le := range v.Buckets {
+		if latency.Seconds() <= le {
+			r.Buckets[i]++
+		}
+	}
+}
+
+// Wrap the handler to record the requests of route.
+func (v *Metrics) Handler(path string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		starttime := time.Now()
+
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+
+		v.Observe(r.Method, path, sw.status, time.Now().Sub(starttime))
+	})
+}
+
+// Get the metrics of all routes, sorted by path and method.
+func (v *Metrics) Routes() []RouteMetrics {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	routes := make([]RouteMetrics, 0, len(v.routes))
+	for _, r := range v.routes {
+		c := *r
+		c.Statuses = make(map[int]uint64, len(r.Statuses))
+		for status, n := range r.Statuses {
+			c.Statuses[status] = n
+		}
+		c.Buckets = append([]uint64(nil), r.Buckets...)
+		routes = append(routes, c)
+	}
+
+	sort.Sort(routeMetricsByPath(routes))
+
+	return routes
+}
+
+type routeMetricsByPath []RouteMetrics
+
+func (v routeMetricsByPath) Len() int {
+	return len(v)
+}
+
+func (v routeMetricsByPath) Less(i, j int) bool {
+	if v[i].Path != v[j].Path {
+		return v[i].Path < v[j].Path
+	}
+	return v[i].Method < v[j].Method
+}
+
+func (v routeMetricsByPath) Swap(i, j int) {
+	v[i], v[j] = v[j], v[i]
+}
+
+// The interface http.Handler, response the metrics in the Prometheus text format.
+func (v *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	routes := v.Routes()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	fmt.Fprintln(w, "# HELP http_requests_total The total number of requests by route and status.")
+	fmt.Fprintln(w, "# TYPE http_requests_total counter")
+	for _, r := range routes {
+		statuses := make([]int, 0, len(r.Statuses))
+		for status := range r.Statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+
+		for _, status := range statuses {
+			fmt.Fprintf(w, "http_requests_total{method=%q,path=%q,code=\"%v\"} %v\n",
+				r.Method, r.Path, status, r.Statuses[status])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP http_request_duration_seconds The latency of requests by route.")
+	fmt.Fprintln(w, "# TYPE http_request_duration_seconds histogram")
+	for _, r := range routes {
+		for i, le := range v.Buckets {
+			fmt.Fprintf(w, "http_request_duration_seconds_bucket{method=%q,path=%q,le=\"%v\"} %v\n",
+				r.Method, r.Path, strconv.FormatFloat(le, 'g', -1, 64), r.Buckets[i])
+		}
+		fmt.Fprintf(w, "http_request_duration_seconds_bucket{method=%q,path=%q,le=\"+Inf\"} %v\n",
+			r.Method, r.Path, r.Requests)
+		fmt.Fprintf(w, "http_request_duration_seconds_sum{method=%q,path=%q} %v\n",
+			r.Method, r.Path, strconv.FormatFloat(r.Latency.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(w, "http_request_duration_seconds_count{method=%q,path=%q} %v\n",
+			r.Method, r.Path, r.Requests)
+	}
+
+	v.lock.Lock()
+	collectors := append([]Collector(nil), v.collectors...)
+	v.lock.Unlock()
+
+	for _, c := range collectors {
+		if err := c.WriteMetrics(w); err != nil {
+			return
+		}
+	}
+}
+
+// The response writer to get the status code.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (v *statusResponseWriter) WriteHeader(status int) {
+	if !v.wrote {
+		v.status, v.wrote = status, true
+	}
+	v.ResponseWriter.WriteHeader(status)
+}
+
+func (v *statusResponseWriter) Write(p []byte) (int, error) {
+	v.wrote = true
+	return v.ResponseWriter.Write(p)
+}
+
+// The interface http.Flusher, for streaming such as HTTP-FLV.
+func (v *statusResponseWriter) Flush() {
+	if f, ok := v.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// The interface http.Hijacker, for WebSocket.
+func (v *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := v.ResponseWriter.(http.Hijacker); ok {
+		v.status, v.wrote = http.StatusSwitchingProtocols, true
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("not hijacker")
+}
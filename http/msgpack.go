@@ -0,0 +1,366 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The msgpack response for content negotiation, to reduce the CPU of high frequency polling.
+package http
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Whether client accept msgpack in header["Accept"], for example:
+//		Accept: application/msgpack
+// @remark The application/x-msgpack is also accepted, but q=0 is rejected.
+func AcceptMsgpack(r *http.Request) bool {
+	for _, accept := range r.Header["Accept"] {
+		for _, mt := range strings.Split(accept, ",") {
+			params := strings.Split(mt, ";")
+			if t := strings.TrimSpace(params[0]); t != HttpMsgpack && t != "application/x-msgpack" {
+				continue
+			}
+
+			accepted := true
+			for _, p := range params[1:] {
+				if p = strings.TrimSpace(p); strings.HasPrefix(p, "q=") {
+					q, err := strconv.ParseFloat(p[2:], 64)
+					accepted = err == nil && q > 0
+				}
+			}
+			if accepted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Marshal the v to msgpack directly, so the envelope and fields are exactly the same as json,
+// while the integer is packed as int and the float as float without the json round trip.
+// @remark The keys of map are sorted, the fields of struct follow the json tags.
+// @remark The json.Marshaler is converted from its json, the encoding.TextMarshaler is a str.
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	return appendMsgpack(nil, reflect.ValueOf(v))
+}
+
+var (
+	jsonNumberType    = reflect.TypeOf(json.Number(""))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Please read https://github.com/msgpack/msgpack/blob/master/spec.md
+func appendMsgpack(dst []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(dst, 0xc0), nil
+	}
+
+	// Use the pointer receiver when addressable, like json does.
+	if v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(jsonMarshalerType) {
+		v = v.Addr()
+	}
+	if v.Type().Implements(jsonMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return append(dst, 0xc0), nil
+		}
+		b, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpackJSON(dst, b)
+	}
+	if v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return append(dst, 0xc0), nil
+		}
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpackString(dst, string(b)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return append(dst, 0xc0), nil
+		}
+		return appendMsgpack(dst, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(dst, 0xc3), nil
+		}
+		return append(dst, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(dst, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > math.MaxInt64 {
+			return appendUint(append(dst, 0xcf), u, 8), nil
+		}
+		return appendMsgpackInt(dst, int64(u)), nil
+	case reflect.Float32:
+		return appendUint(append(dst, 0xca), uint64(math.Float32bits(float32(v.Float()))), 4), nil
+	case reflect.Float64:
+		return appendUint(append(dst, 0xcb), math.Float64bits(v.Float()), 8), nil
+	case reflect.String:
+		if v.Type() == jsonNumberType {
+			return appendMsgpackNumber(dst, json.Number(v.String()))
+		}
+		return appendMsgpackString(dst, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(dst, 0xc0), nil
+		}
+		// The []byte is bin, the json encodes it as base64 str.
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			dst = appendMsgpackHeader(dst, v.Len(), 0, 0, 0xc4)
+			return append(dst, v.Bytes()...), nil
+		}
+		fallthrough
+	case reflect.Array:
+		dst = appendMsgpackHeader(dst, v.Len(), 0x90, 16, 0xdc)
+		for i := 0; i < v.Len(); i++ {
+			var err error
+			if dst, err = appendMsgpack(dst, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return append(dst, 0xc0), nil
+		}
+		return appendMsgpackMap(dst, v)
+	case reflect.Struct:
+		fields := msgpackFields(nil, v)
+		dst = appendMsgpackHeader(dst, len(fields), 0x80, 16, 0xde)
+		for _, f := range fields {
+			dst = appendMsgpackString(dst, f.name)
+
+			var err error
+			if dst, err = appendMsgpack(dst, f.value); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	}
+
+	return nil, fmt.Errorf("msgpack: unsupported type %v", v.Type())
+}
+
+// Convert the json of json.Marshaler to msgpack.
+func appendMsgpackJSON(dst []byte, b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var o interface{}
+	if err := d.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	return appendMsgpack(dst, reflect.ValueOf(o))
+}
+
+// The json number is packed as int if possible, otherwise float64.
+func appendMsgpackNumber(dst []byte, n json.Number) ([]byte, error) {
+	if v, err := n.Int64(); err == nil {
+		return appendMsgpackInt(dst, v), nil
+	}
+
+	v, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return appendUint(append(dst, 0xcb), math.Float64bits(v), 8), nil
+}
+
+func appendMsgpackString(dst []byte, s string) []byte {
+	dst = appendMsgpackHeader(dst, len(s), 0xa0, 32, 0xd9)
+	return append(dst, s...)
+}
+
+// The keys of map are sorted, where the key is string or integer like json.
+func appendMsgpackMap(dst []byte, v reflect.Value) ([]byte, error) {
+	keys := make([]string, 0, v.Len())
+	values := make(map[string]reflect.Value, v.Len())
+	for _, k := range v.MapKeys() {
+		var key string
+		switch k.Kind() {
+		case reflect.String:
+			key = k.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			key = strconv.FormatInt(k.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			key = strconv.FormatUint(k.Uint(), 10)
+		default:
+			return nil, fmt.Errorf("msgpack: unsupported key type %v", k.Type())
+		}
+		keys = append(keys, key)
+		values[key] = v.MapIndex(k)
+	}
+	sort.Strings(keys)
+
+	dst = appendMsgpackHeader(dst, len(keys), 0x80, 16, 0xde)
+	for _, k := range keys {
+		dst = appendMsgpackString(dst, k)
+
+		var err error
+		if dst, err = appendMsgpack(dst, values[k]); err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+type msgpackField struct {
+	name  string
+	value reflect.Value
+}
+
+// Collect the fields of struct by the json tags, where the embedded struct is flattened.
+func msgpackFields(fields []msgpackField, v reflect.Value) []msgpackField {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf, fv := t.Field(i), v.Field(i)
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if pos := strings.Index(tag, ","); pos >= 0 {
+			name, opts = tag[:pos], tag[pos+1:]
+		}
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						continue
+					}
+					fv = fv.Elem()
+				}
+				fields = msgpackFields(fields, fv)
+				continue
+			}
+		}
+
+		// Ignore the unexported field.
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(fv) {
+			continue
+		}
+		fields = append(fields, msgpackField{name, fv})
+	}
+	return fields
+}
+
+// Whether the value is empty for omitempty, the same to json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Append the header of str, bin, array or map, use the fix format when n less than fix.
+// For str and bin, the marker is str8 or bin8, otherwise array16 or map16.
+func appendMsgpackHeader(dst []byte, n int, fixMarker byte, fix int, marker byte) []byte {
+	if n < fix {
+		return append(dst, fixMarker|byte(n))
+	}
+
+	// The str8 0xd9, str16 0xda, str32 0xdb, and bin8 0xc4, bin16 0xc5, bin32 0xc6.
+	if marker == 0xd9 || marker == 0xc4 {
+		if n <= math.MaxUint8 {
+			return append(dst, marker, byte(n))
+		}
+		marker++
+	}
+
+	if n <= math.MaxUint16 {
+		return appendUint(append(dst, marker), uint64(n), 2)
+	}
+	return appendUint(append(dst, marker+1), uint64(n), 4)
+}
+
+func appendMsgpackInt(dst []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= 0x7f:
+		return append(dst, byte(v))
+	case v < 0 && v >= -32:
+		return append(dst, byte(v))
+	case v >= 0 && v <= math.MaxUint8:
+		return append(dst, 0xcc, byte(v))
+	case v >= 0 && v <= math.MaxUint16:
+		return appendUint(append(dst, 0xcd), uint64(v), 2)
+	case v >= 0 && v <= math.MaxUint32:
+		return appendUint(append(dst, 0xce), uint64(v), 4)
+	case v >= 0:
+		return appendUint(append(dst, 0xcf), uint64(v), 8)
+	case v >= math.MinInt8:
+		return append(dst, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return appendUint(append(dst, 0xd1), uint64(v), 2)
+	case v >= math.MinInt32:
+		return appendUint(append(dst, 0xd2), uint64(v), 4)
+	default:
+		return appendUint(append(dst, 0xd3), uint64(v), 8)
+	}
+}
+
+// Append the n bytes of v in big-endian.
+func appendUint(dst []byte, v uint64, n int) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(dst, b[8-n:]...)
+}
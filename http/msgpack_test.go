@@ -0,0 +1,94 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMarshalMsgpack(t *testing.T) {
+	// The integer and float are not converted by json.
+	o := struct {
+		Int    int64   `json:"i"`
+		Float  float64 `json:"f"`
+		Empty  string  `json:"e,omitempty"`
+		Hidden string  `json:"-"`
+	}{1<<53 + 1, 1, "", "hidden"}
+
+	b, err := marshalMsgpack(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []byte{0x82, 0xa1, 'i', 0xcf, 0, 0x20, 0, 0, 0, 0, 0, 1}
+	expect = append(expect, 0xa1, 'f', 0xcb, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0)
+	if !bytes.Equal(b, expect) {
+		t.Errorf("got %x, expect %x", b, expect)
+	}
+
+	// The keys of map are sorted, and the json number is packed as int.
+	b, err = marshalMsgpack(map[string]interface{}{"n": json.Number("3"), "b": []byte("x"), "a": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect = []byte{0x83, 0xa1, 'a', 0xc0, 0xa1, 'b', 0xc4, 1, 'x', 0xa1, 'n', 3}
+	if !bytes.Equal(b, expect) {
+		t.Errorf("got %x, expect %x", b, expect)
+	}
+
+	if _, err = marshalMsgpack(make(chan int)); err == nil {
+		t.Error("should fail for chan")
+	}
+}
+
+func TestJsonHandler_Vary(t *testing.T) {
+	h := Data(nil, map[string]interface{}{"clients": 3})
+
+	r := httptest.NewRequest("GET", "/api/v1/stats", nil)
+	r.Header.Set("Accept", HttpMsgpack)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if v := w.Header().Get("Content-Type"); v != HttpMsgpack {
+		t.Errorf("content type %v", v)
+	}
+	if v := w.Header().Get("Vary"); v != "Accept" {
+		t.Errorf("vary %v", v)
+	}
+
+	// The json also varies by the Accept.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	if v := w.Header().Get("Vary"); v != "Accept" {
+		t.Errorf("vary %v", v)
+	}
+
+	// The JSONP is not negotiated.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/stats?callback=cb", nil))
+	if v := w.Header().Get("Vary"); v != "" {
+		t.Errorf("vary %v", v)
+	}
+}
@@ -0,0 +1,201 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx http package, the long-polling for clients which can't use WebSocket or SSE.
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The default timeout to wait for events, then response the heartbeat.
+var LongPollTimeout = time.Duration(30) * time.Second
+
+// The result of polling, which is the data of response.
+type PollResult struct {
+	// The token of last event, to resume polling after it.
+	Token uint64 `json:"token"`
+	// The events after the token of request, empty for heartbeat.
+	Events []interface{} `json:"events"`
+	// Whether the events after the token of request are lost, for example, the token
+	// is too old or the server restarted, the client should reload the full state.
+	Reset bool `json:"reset"`
+}
+
+// The event in buffer.
+type pollEvent struct {
+	token uint64
+	data  interface{}
+}
+
+// The long-polling, the client waits for the events after the resume token, for example,
+// the dashboard polls the stream state changes:
+//		GET /api/v1/streams/events?token=10&timeout=30
+// The response is the standard {code, server, data} where data is the PollResult.
+// The client should poll again with the token in result, to resume after the last event.
+// The result is:
+//		events, when there are events after token, response immediately.
+//		heartbeat, when timeout without event, the events is empty.
+//		reset, when events lost or token invalid, with all buffered events.
+// @remark The token is the latest when not specified, that is, waits for new events.
+// @remark It's safe for concurrent use.
+type LongPoll struct {
+	// The max duration to wait for events, use LongPollTimeout when zero.
+	Timeout time.Duration
+
+	lock sync.Mutex
+	// The buffered events for resuming, at most capacity.
+	events   []*pollEvent
+	capacity int
+	// The token of last event.
+	token uint64
+	// Closed to notify the pollers when event published or closed.
+	signal chan bool
+	closed bool
+}
+
+// Create the long-polling which buffers at most capacity events to resume.
+func NewLongPoll(capacity int) *LongPoll {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LongPoll{capacity: capacity, signal: make(chan bool)}
+}
+
+// Publish the event to pollers, return its token.
+func (v *LongPoll) Publish(event interface{}) uint64 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.token++
+	v.events = append(v.events, &pollEvent{token: v.token, data: event})
+	if len(v.events) > v.capacity {
+		v.events = v.events[len(v.events)-v.capacity:]
+	}
+
+	if !v.closed {
+		close(v.signal)
+		v.signal = make(chan bool)
+	}
+	return v.token
+}
+
+// The token of last event, zero when no event.
+func (v *LongPoll) Token() uint64 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.token
+}
+
+// Close the long-polling, all pollers return immediately.
+func (v *LongPoll) Close() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if !v.closed {
+		v.closed = true
+		close(v.signal)
+	}
+	return nil
+}
+
+// Wait for the events after token, until timeout, or cancel is closed.
+// @remark Set cancel to nil to wait until timeout.
+func (v *LongPoll) Poll(token uint64, timeout time.Duration, cancel <-chan bool) *PollResult {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		v.lock.Lock()
+		r := v.since(token)
+		signal, closed := v.signal, v.closed
+		v.lock.Unlock()
+
+		if len(r.Events) > 0 || r.Reset || closed {
+			return r
+		}
+
+		select {
+		case <-signal:
+		case <-timer.C:
+			return r
+		case <-cancel:
+			return r
+		}
+	}
+}
+
+// Get the events after token, the lock must be held.
+func (v *LongPoll) since(token uint64) *PollResult {
+	r := &PollResult{Token: v.token, Events: []interface{}{}}
+
+	// The token is from future, or the events after it are evicted.
+	if token > v.token || (len(v.events) > 0 && token+1 < v.events[0].token) {
+		r.Reset = true
+		token = 0
+	}
+
+	for _, e := range v.events {
+		if e.token > token {
+			r.Events = append(r.Events, e.data)
+		}
+	}
+	return r
+}
+
+// Serve the polling request, with the query:
+//		token, optional, the resume token, use the latest if not specified.
+//		timeout, optional, the seconds to wait, no more than Timeout.
+func (v *LongPoll) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	token := v.Token()
+	if s := q.Get("token"); s != "" {
+		var err error
+		if token, err = strconv.ParseUint(s, 10, 64); err != nil {
+			// Reset the client, for the token is invalid.
+			token = ^uint64(0)
+		}
+	}
+
+	timeout := v.Timeout
+	if timeout <= 0 {
+		timeout = LongPollTimeout
+	}
+	if n, err := strconv.Atoi(q.Get("timeout")); err == nil && n >= 0 {
+		if d := time.Duration(n) * time.Second; d < timeout {
+			timeout = d
+		}
+	}
+
+	// Stop waiting when client closed.
+	var cancel <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		cancel = cn.CloseNotify()
+	}
+
+	CacheLive().Apply(w)
+	WriteData(nil, w, r, v.Poll(token, timeout, cancel))
+}
@@ -0,0 +1,182 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx http package, the route registry with self-description.
+package http
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The path of the route listing api.
+const RoutesPath = "/api/v1/routes"
+
+// The route of api, which is the description of handler.
+type Route struct {
+	// The http method, for example, GET or POST, empty for any method.
+	Method string `json:"method"`
+	// The pattern of path, see http.ServeMux.
+	Path string `json:"path"`
+	// The description of api.
+	Description string `json:"description"`
+
+	handler http.Handler
+}
+
+// The route registry, where handlers are registered with method, path and description,
+// which response the machine-readable route listing at RoutesPath.
+// @remark It's safe for concurrent use.
+type Router struct {
+	mux *http.ServeMux
+
+	lock sync.Mutex
+	// The routes of each path, in registered order.
+	paths  map[string][]*Route
+	routes []*Route
+	// The metrics of routes, nil to disable.
+	metrics *Metrics
+}
+
+// Create a router over mux, use a new mux if nil.
+// @remark The route listing api is registered at RoutesPath.
+func NewRouter(mux *http.ServeMux) *Router {
+	if mux == nil {
+		mux = http.NewServeMux()
+	}
+
+	v := &Router{mux: mux, paths: make(map[string][]*Route)}
+
+	v.HandleFunc("GET", RoutesPath, "List all routes of api", func(w http.ResponseWriter, r *http.Request) {
+		WriteData(nil, w, r, v.Routes())
+	})
+
+	return v
+}
+
+// Register the handler for method and path, with description.
+// @remark The same path can be registered for different methods.
+func (v *Router) Handle(method, path, description string, handler http.Handler) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	route := &Route{Method: method, Path: path, Description: description, handler: handler}
+	v.routes = append(v.routes, route)
+
+	routes, ok := v.paths[path]
+	v.paths[path] = append(routes, route)
+
+	if !ok {
+		v.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			v.serve(path, w, r)
+		})
+	}
+}
+
+// Record the requests of all routes to metrics, and export it at MetricsPath.
+func (v *Router) SetMetrics(m *Metrics) {
+	func() {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+		v.metrics = m
+	}()
+
+	v.Handle("GET", MetricsPath, "The metrics of api in Prometheus format", m)
+}
+
+func (v *Router) HandleFunc(method, path, description string, handler func(w http.ResponseWriter, r *http.Request)) {
+	v.Handle(method, path, description, http.HandlerFunc(handler))
+}
+
+// Get all the routes, sorted by path and method.
+func (v *Router) Routes() []Route {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	routes := make([]Route, 0, len(v.routes))
+	for _, r := range v.routes {
+		routes = append(routes, *r)
+	}
+
+	sort.Sort(routesByPath(routes))
+
+	return routes
+}
+
+type routesByPath []Route
+
+func (v routesByPath) Len() int {
+	return len(v)
+}
+
+func (v routesByPath) Less(i, j int) bool {
+	if v[i].Path != v[j].Path {
+		return v[i].Path < v[j].Path
+	}
+	return v[i].Method < v[j].Method
+}
+
+func (v routesByPath) Swap(i, j int) {
+	v[i], v[j] = v[j], v[i]
+}
+
+// The interface http.Handler.
+func (v *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mux.ServeHTTP(w, r)
+}
+
+// Serve the request of path, dispatch by method.
+func (v *Router) serve(path string, w http.ResponseWriter, r *http.Request) {
+	var handler http.Handler
+	var metrics *Metrics
+	var allowed []string
+
+	func() {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+
+		metrics = v.metrics
+		for _, route := range v.paths[path] {
+			if route.Method == "" || route.Method == r.Method {
+				handler = route.handler
+				return
+			}
+			allowed = append(allowed, route.Method)
+		}
+	}()
+
+	// The Allow header is required for 405, see RFC 7231 section 6.5.5.
+	if handler == nil {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			SetHeader(w)
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		})
+	}
+
+	if metrics != nil {
+		handler = metrics.Handler(path, handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
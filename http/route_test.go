@@ -0,0 +1,81 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package http_test
+
+import (
+	oh "github.com/ossrs/go-oryx-lib/http"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	r := oh.NewRouter(nil)
+
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.URL.Path))
+	}
+	r.HandleFunc("GET", "/api/v1/streams/", "Get the stream by id", echo)
+	r.HandleFunc("DELETE", "/api/v1/streams/", "Kickoff the stream by id", echo)
+	r.HandleFunc("", "/api/v1/versions", "The version of server", echo)
+
+	cases := []struct {
+		method, path string
+		code         int
+		body, allow  string
+	}{
+		// The id is the sub path of pattern.
+		{"GET", "/api/v1/streams/1001", http.StatusOK, "GET /api/v1/streams/1001", ""},
+		{"DELETE", "/api/v1/streams/1002", http.StatusOK, "DELETE /api/v1/streams/1002", ""},
+		{"POST", "/api/v1/versions", http.StatusOK, "POST /api/v1/versions", ""},
+		{"GET", "/api/v1/clients", http.StatusNotFound, "404 page not found", ""},
+		{"PUT", "/api/v1/streams/1001", http.StatusMethodNotAllowed, "Method not allowed", "GET, DELETE"},
+		{"POST", oh.RoutesPath, http.StatusMethodNotAllowed, "Method not allowed", "GET"},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != c.code || strings.TrimSpace(w.Body.String()) != c.body {
+			t.Errorf("%v %v got %v %v, want %v %v", c.method, c.path, w.Code, w.Body.String(), c.code, c.body)
+		}
+		if allow := w.Header().Get("Allow"); allow != c.allow {
+			t.Errorf("%v %v got allow %v, want %v", c.method, c.path, allow, c.allow)
+		}
+	}
+
+	// The routes are listed, sorted by path and method.
+	var paths []string
+	for _, route := range r.Routes() {
+		paths = append(paths, route.Method+" "+route.Path)
+	}
+	if v := strings.Join(paths, ","); v != "GET /api/v1/routes,DELETE /api/v1/streams/,GET /api/v1/streams/, /api/v1/versions" {
+		t.Errorf("invalid routes %v", v)
+	}
+}
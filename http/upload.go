@@ -0,0 +1,196 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx http package, the upload handler for large bodies, for example, the DVR files.
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The header of hex SHA256 checksum of the upload body or multipart file.
+const UploadChecksumHeader = "X-Content-Sha256"
+
+// The error codes of upload.
+const (
+	// The request is not a valid upload.
+	UploadInvalid SystemError = 1000 + iota
+	// The file exceeds the MaxSize of handler.
+	UploadTooLarge
+	// The checksum of file mismatch.
+	UploadChecksumMismatch
+)
+
+// The uploaded file, which is spooled to disk.
+type UploadFile struct {
+	// The field name of multipart form, empty for the raw body.
+	Field string `json:"field,omitempty"`
+	// The file name from client, from the multipart form or the query name.
+	Filename string `json:"filename,omitempty"`
+	// The path of spooled file.
+	Path string `json:"-"`
+	// The bytes received.
+	Size int64 `json:"size"`
+	// The hex SHA256 checksum of file.
+	Checksum string `json:"sha256"`
+}
+
+// The UploadHandler accepts the large multipart or chunked uploads, for example, the
+// recorded FLV or MP4 files, spools the files to disk with checksum, and responses the
+// standard JSON envelope.
+// For the multipart form, each file part is spooled, and the checksum is verified when
+// the part has the UploadChecksumHeader. For other body, the body is spooled as a file,
+// named by the query name, and the checksum is verified by the UploadChecksumHeader.
+// @remark The spooled files are removed after OnUpload, so move them to keep.
+type UploadHandler struct {
+	// The directory to spool files, use the os.TempDir if empty.
+	Dir string
+	// The max bytes of each file, 0 for no limit.
+	MaxSize int64
+	// The callback when receiving the file, optional. The total is the content
+	// length of request, -1 if unknown, for example, the chunked uploads.
+	OnProgress func(r *http.Request, f *UploadFile, total int64)
+	// The callback when all files are spooled and verified, return the data of response.
+	// Response the files if not set.
+	OnUpload func(r *http.Request, files []*UploadFile) (interface{}, error)
+}
+
+func (v *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var files []*UploadFile
+	defer func() {
+		for _, f := range files {
+			os.Remove(f.Path)
+		}
+	}()
+
+	spool := func(src io.Reader, field, filename, checksum string) error {
+		f, err := v.spool(r, src, field, filename)
+		if f != nil {
+			files = append(files, f)
+		}
+		if err != nil {
+			return err
+		}
+
+		if checksum != "" && !strings.EqualFold(checksum, f.Checksum) {
+			return SystemComplexError{UploadChecksumMismatch, "checksum mismatch for " + f.Filename}
+		}
+		return nil
+	}
+
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			WriteError(nil, w, r, SystemComplexError{UploadInvalid, err.Error()})
+			return
+		}
+
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				WriteError(nil, w, r, SystemComplexError{UploadInvalid, err.Error()})
+				return
+			}
+
+			// Ignore the fields which are not files.
+			if part.FileName() == "" {
+				continue
+			}
+
+			if err = spool(part, part.FormName(), part.FileName(), part.Header.Get(UploadChecksumHeader)); err != nil {
+				WriteError(nil, w, r, err)
+				return
+			}
+		}
+	} else {
+		if err := spool(r.Body, "", r.URL.Query().Get("name"), r.Header.Get(UploadChecksumHeader)); err != nil {
+			WriteError(nil, w, r, err)
+			return
+		}
+	}
+
+	if v.OnUpload == nil {
+		WriteData(nil, w, r, files)
+		return
+	}
+
+	data, err := v.OnUpload(r, files)
+	if err != nil {
+		WriteError(nil, w, r, err)
+		return
+	}
+	WriteData(nil, w, r, data)
+}
+
+// Spool the src to a temporary file, return the file even when error, to cleanup.
+func (v *UploadHandler) spool(r *http.Request, src io.Reader, field, filename string) (f *UploadFile, err error) {
+	var fw *os.File
+	if fw, err = ioutil.TempFile(v.Dir, "upload"); err != nil {
+		return nil, err
+	}
+	defer fw.Close()
+
+	f = &UploadFile{Field: field, Filename: filename, Path: fw.Name()}
+
+	if v.MaxSize > 0 {
+		src = io.LimitReader(src, v.MaxSize+1)
+	}
+
+	h := sha256.New()
+	pw := &progressWriter{f: f, onWrite: func() {
+		if v.OnProgress != nil {
+			v.OnProgress(r, f, r.ContentLength)
+		}
+	}}
+
+	if _, err = io.Copy(io.MultiWriter(fw, h, pw), src); err != nil {
+		return f, err
+	}
+
+	if v.MaxSize > 0 && f.Size > v.MaxSize {
+		return f, SystemComplexError{UploadTooLarge, "exceed max size for " + filename}
+	}
+
+	f.Checksum = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// The writer to update the size of file and notify the progress.
+type progressWriter struct {
+	f       *UploadFile
+	onWrite func()
+}
+
+func (v *progressWriter) Write(p []byte) (int, error) {
+	v.f.Size += int64(len(p))
+	v.onWrite()
+	return len(p), nil
+}
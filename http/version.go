@@ -0,0 +1,154 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx http package, the versioned api with deprecation headers.
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The version of api tree, for example, v1 for /api/v1.
+type APIVersion struct {
+	// The name of version, for example, v1.
+	Name string
+	// Whether the version is deprecated, response the Deprecation header.
+	Deprecated bool
+	// The time when deprecated, optional.
+	DeprecatedAt time.Time
+	// The time when the version is removed, response the Sunset header, optional.
+	Sunset time.Time
+	// The link to the document of deprecation, optional.
+	Link string
+	// The compatibility shim, map the standard envelope {code, server, data} to the
+	// old format of this version, optional.
+	Envelope func(v map[string]interface{}) interface{}
+}
+
+// Wrap the handler for this version, set the deprecation headers and apply the envelope.
+func (v *APIVersion) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v.Deprecated {
+			// Please read RFC 9745, The Deprecation HTTP Response Header Field.
+			if v.DeprecatedAt.IsZero() {
+				w.Header().Set("Deprecation", "true")
+			} else {
+				w.Header().Set("Deprecation", fmt.Sprintf("@%v", v.DeprecatedAt.Unix()))
+			}
+
+			if v.Link != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%v>; rel="deprecation"`, v.Link))
+			}
+		}
+
+		// Please read RFC 8594, The Sunset HTTP Header Field.
+		if !v.Sunset.IsZero() {
+			w.Header().Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+		}
+
+		if v.Envelope == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// Apply the envelope to json, then convert to msgpack if client accept it.
+		msgpack := AcceptMsgpack(r)
+		if msgpack {
+			nr := *r
+			nr.Header = make(http.Header)
+			for k, vv := range r.Header {
+				nr.Header[k] = vv
+			}
+			nr.Header.Del("Accept")
+			r = &nr
+		}
+
+		bw := &bufferedResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(bw, r)
+		bw.flush(v.Envelope, msgpack)
+	})
+}
+
+// Mount the handler under the versioned api trees, the path is relative to /api/{version},
+// for example, /streams is mounted at /api/v1/streams and /api/v2/streams.
+func (v *Router) HandleVersions(method, path, description string, handler http.Handler, versions ...*APIVersion) {
+	for _, version := range versions {
+		desc := description
+		if version.Deprecated {
+			desc += " (deprecated)"
+		}
+
+		v.Handle(method, "/api/"+version.Name+path, desc, version.Handler(handler))
+	}
+}
+
+// The response writer to buffer the body, to apply the envelope.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (v *bufferedResponseWriter) WriteHeader(status int) {
+	v.status = status
+}
+
+func (v *bufferedResponseWriter) Write(p []byte) (int, error) {
+	return v.body.Write(p)
+}
+
+func (v *bufferedResponseWriter) flush(envelope func(v map[string]interface{}) interface{}, msgpack bool) {
+	w, b := v.ResponseWriter, v.body.Bytes()
+
+	// Only apply to json object, ignore others such as jsonp.
+	// @remark Keep the json number, so the integer is still packed as int in msgpack.
+	var o map[string]interface{}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), HttpJson) && decodeJSONObject(b, &o) == nil {
+		e := envelope(o)
+
+		var mb []byte
+		if msgpack {
+			mb, _ = marshalMsgpack(e)
+		}
+
+		if mb != nil {
+			w.Header().Set("Content-Type", HttpMsgpack)
+			b = mb
+		} else if nb, err := json.Marshal(e); err == nil {
+			b = nb
+		}
+	}
+
+	w.Header().Del("Content-Length")
+	w.WriteHeader(v.status)
+	w.Write(b)
+}
+
+func decodeJSONObject(b []byte, o *map[string]interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(o)
+}
@@ -0,0 +1,177 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The multiple certificates manager, serve different domains on one IP by SNI.
+package https
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// The interval to check the certificate files for hot reload.
+var CertReloadInterval = time.Duration(10) * time.Second
+
+// The certificate loaded from files, which is reloaded when files changed.
+type fileCertificate struct {
+	serverName string
+	certFile   string
+	keyFile    string
+	cert       *tls.Certificate
+	// The modified time of files when loaded.
+	certModTime time.Time
+	keyModTime  time.Time
+	// The last time to check the files.
+	checked time.Time
+}
+
+// Load the certificate if files changed, keep the previous one when failed,
+// for example, the key file is written while the cert file is not yet.
+func (v *fileCertificate) reload() error {
+	ci, err := os.Stat(v.certFile)
+	if err != nil {
+		return err
+	}
+	ki, err := os.Stat(v.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if v.cert != nil && ci.ModTime().Equal(v.certModTime) && ki.ModTime().Equal(v.keyModTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(v.certFile, v.keyFile)
+	if err != nil {
+		return err
+	}
+
+	v.cert, v.certModTime, v.keyModTime = &cert, ci.ModTime(), ki.ModTime()
+	return nil
+}
+
+// The manager to serve multiple domains, which maps the server name of SNI to
+// different cert and key files, and reloads the changed files without restart.
+// The server name can be:
+//		"ossrs.net", exactly match the SNI.
+//		"*.ossrs.net", match one label subdomain, live.ossrs.net but not a.live.ossrs.net.
+//		"", the default certificate when no name matched.
+// For example:
+//		m := https.NewMultiCertManager()
+//		m.Add("ossrs.net", "ossrs.net.crt", "ossrs.net.key")
+//		m.Add("*.ossrs.net", "wildcard.crt", "wildcard.key")
+//		m.Add("", "default.crt", "default.key")
+//		server := &http.Server{TLSConfig: &tls.Config{GetCertificate: m.GetCertificate}}
+// @remark The files are checked at most every CertReloadInterval.
+type MultiCertManager struct {
+	lock  sync.Mutex
+	certs []*fileCertificate
+}
+
+func NewMultiCertManager() *MultiCertManager {
+	return &MultiCertManager{}
+}
+
+// Add the certificate for serverName, load it from certFile and keyFile.
+// @remark Replace the certificate when serverName exists.
+func (v *MultiCertManager) Add(serverName, certFile, keyFile string) (err error) {
+	c := &fileCertificate{serverName: serverName, certFile: certFile, keyFile: keyFile, checked: time.Now()}
+	if err = c.reload(); err != nil {
+		return fmt.Errorf("load certificate of %v failed, err is %v", serverName, err)
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for i, cert := range v.certs {
+		if cert.serverName == serverName {
+			v.certs[i] = c
+			return
+		}
+	}
+
+	v.certs = append(v.certs, c)
+	return
+}
+
+// Remove the certificate of serverName.
+func (v *MultiCertManager) Remove(serverName string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for i, cert := range v.certs {
+		if cert.serverName == serverName {
+			v.certs = append(v.certs[:i], v.certs[i+1:]...)
+			return
+		}
+	}
+}
+
+// The interface Manager, get the certificate by SNI, reload it when files changed.
+// @remark The files are loaded without lock, so the slow disk never blocks other handshakes.
+func (v *MultiCertManager) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c, loaded, due := v.match(clientHello.ServerName)
+	if c == nil {
+		return nil, fmt.Errorf("no certificate for %v", clientHello.ServerName)
+	}
+
+	if !due {
+		return loaded.cert, nil
+	}
+
+	// Ignore the reload error, serve with the previous certificate.
+	if err := loaded.reload(); err != nil || loaded.cert == c.cert {
+		return loaded.cert, nil
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	c.cert, c.certModTime, c.keyModTime = loaded.cert, loaded.certModTime, loaded.keyModTime
+	return loaded.cert, nil
+}
+
+// Match the certificate for serverName, return a copy to load, and whether it's due to check
+// the files, which is marked as checked so only one handshake reloads it.
+func (v *MultiCertManager) match(serverName string) (c *fileCertificate, loaded fileCertificate, due bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	names := make([]string, len(v.certs))
+	for i, cert := range v.certs {
+		names[i] = cert.serverName
+	}
+
+	i := matchServerName(names, serverName)
+	if i < 0 {
+		return nil, loaded, false
+	}
+
+	c = v.certs[i]
+	if now := time.Now(); now.Sub(c.checked) >= CertReloadInterval {
+		c.checked, due = now, true
+	}
+
+	return c, *c, due
+}
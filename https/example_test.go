@@ -153,3 +153,45 @@ func ExampleSelfSignHttpAndHttps() {
 		fmt.Println("https serve failed, err is", err)
 	}
 }
+
+func ExampleSNIRouter() {
+	var err error
+	var api, stream https.Manager
+	if api, err = https.NewSelfSignManager("api.crt", "api.key"); err != nil {
+		fmt.Println("https failed, err is", err)
+		return
+	}
+	if stream, err = https.NewSelfSignManager("stream.crt", "stream.key"); err != nil {
+		fmt.Println("https failed, err is", err)
+		return
+	}
+
+	// Serve the management API and the streaming domains on one port.
+	r := https.NewSNIRouter()
+	defer r.Close()
+
+	r.Handle("api.ossrs.net", api, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, API~"))
+	}))
+	r.Handle("*.ossrs.net", stream, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, Stream~"))
+	}))
+
+	if err := r.ListenAndServe(":https"); err != nil {
+		fmt.Println("https serve failed, err is", err)
+	}
+}
+
+func ExampleValidateCertificate() {
+	cert, err := tls.LoadX509KeyPair("server.crt", "server.key")
+	if err != nil {
+		fmt.Println("load cert failed, err is", err)
+		return
+	}
+
+	// Validate the chain before serving traffic, the problems are logged.
+	if err := https.ValidateCertificate(nil, &cert, &https.ValidateOptions{MustStaple: true}); err != nil {
+		fmt.Println("invalid cert, err is", err)
+		return
+	}
+}
@@ -0,0 +1,66 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// +build go1.8
+
+package https
+
+import (
+	"crypto/x509"
+	"fmt"
+)
+
+// Create the VerifyPeerCertificate for client tls.Config, which requires any certificate
+// of the peer chain to match one of the pins, for example:
+//		config := &tls.Config{VerifyPeerCertificate: https.VerifyPins(pin)}
+// @remark The pins are checked against the verified chains, or only the leaf cert when
+//		InsecureSkipVerify for the self-signed cert, because the others are not verified.
+// @remark Requires golang 1.8+, for the VerifyPeerCertificate of tls.Config.
+func VerifyPins(pins ...string) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	expects := make(map[string]bool)
+	for _, pin := range pins {
+		expects[pin] = true
+	}
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var certs []*x509.Certificate
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+
+		// The peer may send any cert without the private key, so only the leaf is trusted,
+		// which is proved by the handshake.
+		if len(verifiedChains) == 0 && len(rawCerts) > 0 {
+			c, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return fmt.Errorf("parse peer cert failed, err is %v", err)
+			}
+			certs = append(certs, c)
+		}
+
+		for _, c := range certs {
+			if expects[SPKIPin(c)] {
+				return nil
+			}
+		}
+		return fmt.Errorf("no pin matched in %v peer certs", len(certs))
+	}
+}
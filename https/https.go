@@ -22,12 +22,22 @@
 package https
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"github.com/ossrs/go-oryx-lib/https/letsencrypt"
+	"math/big"
+	"net"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Requires golang 1.6+, because there's bug in http.Server
@@ -82,6 +92,92 @@ func (v *selfSignManager) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls
 	return &cert, err
 }
 
+// The options to generate the self-signed certificate.
+type SelfSignOptions struct {
+	// The common name of subject, use the first host if empty.
+	CommonName string
+	// The SANs, the DNS names or IP addresses, for example, localhost and 127.0.0.1.
+	Hosts []string
+	// The validity from now, use one year if zero.
+	Validity time.Duration
+	// Whether use the RSA 2048 key, default to ECDSA P-256 key.
+	RSA bool
+}
+
+// Generate the self-signed certificate in memory, without the openssl.
+// @remark Set opts to nil to generate for localhost.
+func GenerateSelfSignCertificate(opts *SelfSignOptions) (cert *tls.Certificate, err error) {
+	if opts == nil {
+		opts = &SelfSignOptions{Hosts: []string{"localhost", "127.0.0.1", "::1"}}
+	}
+
+	var key crypto.Signer
+	if opts.RSA {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generate key failed, err is %v", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number failed, err is %v", err)
+	}
+
+	validity := opts.Validity
+	if validity <= 0 {
+		validity = time.Duration(365*24) * time.Hour
+	}
+
+	commonName := opts.CommonName
+	if commonName == "" && len(opts.Hosts) > 0 {
+		commonName = opts.Hosts[0]
+	}
+
+	// Allow the clock skew of clients.
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Oryx"}},
+		NotBefore:    now.Add(-time.Hour), NotAfter: now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	for _, host := range opts.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate failed, err is %v", err)
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{b}, PrivateKey: key}, nil
+}
+
+// Generate the self-signed certificate in memory, see GenerateSelfSignCertificate,
+// for the test servers and development, without the cert and key files.
+func NewGeneratedSelfSignManager(opts *SelfSignOptions) (m Manager, err error) {
+	if err = checkRuntime(); err != nil {
+		return
+	}
+
+	cert, err := GenerateSelfSignCertificate(opts)
+	if err != nil {
+		return
+	}
+
+	return &selfSignManager{cert: cert}, nil
+}
+
 // The cert is sign by letsencrypt
 type letsencryptManager struct {
 	lets letsencrypt.Manager
@@ -0,0 +1,62 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// +build go1.8
+
+package https
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+)
+
+func TestVerifyPins(t *testing.T) {
+	root, rootKey := mockCertificate(t, "root", nil, nil, false)
+	leaf, _ := mockCertificate(t, "leaf.ossrs.net", root, rootKey, false)
+	other, _ := mockCertificate(t, "other", nil, nil, false)
+
+	pins, err := CertificatePins(&tls.Certificate{Certificate: [][]byte{leaf.Raw, root.Raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 || pins[0] != SPKIPin(leaf) || pins[1] != SPKIPin(root) {
+		t.Errorf("invalid pins %v", pins)
+	}
+
+	// Only the leaf is checked without verified chains, the root in raw certs is not trusted.
+	raw := [][]byte{leaf.Raw, root.Raw}
+	if err := VerifyPins(SPKIPin(leaf))(raw, nil); err != nil {
+		t.Errorf("leaf pin failed, err is %v", err)
+	}
+	if err := VerifyPins(SPKIPin(root))(raw, nil); err == nil {
+		t.Error("should fail for unverified root pin")
+	}
+	if err := VerifyPins(SPKIPin(other))(raw, nil); err == nil {
+		t.Error("should fail for other pin")
+	}
+	if err := VerifyPins(SPKIPin(root))(nil, [][]*x509.Certificate{{leaf, root}}); err != nil {
+		t.Errorf("verified chain failed, err is %v", err)
+	}
+	if err := VerifyPins(SPKIPin(leaf))([][]byte{[]byte("bad")}, nil); err == nil {
+		t.Error("should fail for bad cert")
+	}
+}
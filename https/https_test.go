@@ -21,7 +21,450 @@
 
 package https
 
-import "testing"
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"github.com/ossrs/go-oryx-lib/https/crypto/ocsp"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestHttps(t *testing.T) {
 }
+
+type mockManager struct {
+	name string
+}
+
+func (v *mockManager) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return &tls.Certificate{OCSPStaple: []byte(v.name)}, nil
+}
+
+func TestSNIRouter_GetCertificate(t *testing.T) {
+	r := NewSNIRouter()
+
+	if _, err := r.GetCertificate(&tls.ClientHelloInfo{ServerName: "ossrs.net"}); err == nil {
+		t.Error("should fail without route")
+	}
+
+	r.Handle("*.ossrs.net", &mockManager{"wildcard"}, nil)
+	r.Handle("api.ossrs.net", &mockManager{"api"}, nil)
+	r.Handle("*.live.ossrs.net", &mockManager{"live"}, nil)
+	r.Handle("", &mockManager{"default"}, nil)
+
+	pvs := []struct {
+		serverName string
+		name       string
+	}{
+		{"api.ossrs.net", "api"},
+		{"API.ossrs.net", "api"},
+		{"live.ossrs.net", "wildcard"},
+		{"a.live.ossrs.net", "live"},
+		{"a.b.live.ossrs.net", "default"},
+		{"ossrs.net", "default"},
+		{".ossrs.net", "default"},
+		{"", "default"},
+	}
+	for _, pv := range pvs {
+		if c, err := r.GetCertificate(&tls.ClientHelloInfo{ServerName: pv.serverName}); err != nil {
+			t.Errorf("%v failed, err is %+v", pv.serverName, err)
+		} else if v := string(c.OCSPStaple); v != pv.name {
+			t.Errorf("%v expect %v actual %v", pv.serverName, pv.name, v)
+		}
+	}
+}
+
+// Create a certificate issued by parent, self-signed when parent is nil.
+func mockCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, mustStaple bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: parent == nil || !strings.Contains(name, "leaf"), BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	if mustStaple {
+		value, _ := asn1.Marshal([]int{5})
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}, Value: value,
+		})
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, key
+}
+
+func TestValidateCertificate(t *testing.T) {
+	root, rootKey := mockCertificate(t, "root", nil, nil, false)
+	inter, interKey := mockCertificate(t, "intermediate", root, rootKey, false)
+	leaf, leafKey := mockCertificate(t, "leaf.ossrs.net", inter, interKey, true)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	opts := &ValidateOptions{Roots: roots, MustStaple: true}
+
+	pvs := []struct {
+		name    string
+		certs   []*x509.Certificate
+		key     interface{}
+		problem string
+	}{
+		{"ok", []*x509.Certificate{leaf, inter}, leafKey, ""},
+		{"order", []*x509.Certificate{inter, leaf}, leafKey, "chain order"},
+		{"incomplete", []*x509.Certificate{leaf}, leafKey, "incomplete chain"},
+		{"key", []*x509.Certificate{leaf, inter}, interKey, "does not match"},
+		{"staple", []*x509.Certificate{inter}, interKey, "Must-Staple"},
+	}
+	for _, pv := range pvs {
+		cert := &tls.Certificate{PrivateKey: pv.key, OCSPStaple: []byte("staple")}
+		for _, c := range pv.certs {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+
+		err := ValidateCertificate(nil, cert, opts)
+		if pv.problem == "" && err != nil {
+			t.Errorf("%v failed, err is %v", pv.name, err)
+		} else if pv.problem != "" && (err == nil || !strings.Contains(err.Error(), pv.problem)) {
+			t.Errorf("%v expect %v, err is %v", pv.name, pv.problem, err)
+		}
+	}
+
+	// The self-signed is ok without roots.
+	cert := &tls.Certificate{Certificate: [][]byte{root.Raw}, PrivateKey: rootKey}
+	if err := ValidateCertificate(nil, cert, nil); err != nil {
+		t.Errorf("self-signed failed, err is %v", err)
+	}
+}
+
+type mockCertManager struct {
+	cert *tls.Certificate
+}
+
+func (v *mockCertManager) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return v.cert, nil
+}
+
+// The OCSP responder signed by issuer, which fails the first N requests, N is fails.
+type mockOCSPResponder struct {
+	issuer    *x509.Certificate
+	issuerKey *ecdsa.PrivateKey
+	lock      sync.Mutex
+	requests  int
+	fails     int
+}
+
+func (v *mockOCSPResponder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.lock.Lock()
+	v.requests++
+	fail := v.requests <= v.fails
+	v.lock.Unlock()
+
+	if fail {
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+		return
+	}
+
+	b, _ := ioutil.ReadAll(r.Body)
+	req, err := ocsp.ParseRequest(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	res, err := ocsp.CreateResponse(v.issuer, v.issuer, ocsp.Response{
+		Status: ocsp.Good, SerialNumber: req.SerialNumber,
+		ThisUpdate: now.Add(-time.Minute), NextUpdate: now.Add(time.Hour),
+	}, v.issuerKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(res)
+}
+
+// Create a stapler for a leaf with OCSP server url, issued by the issuer of responder.
+func mockOCSPStapler(t *testing.T, responder *mockOCSPResponder, url string) *OCSPStapler {
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "leaf.ossrs.net"},
+		NotBefore:    time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature, OCSPServer: []string{url},
+	}
+	b, err := x509.CreateCertificate(rand.Reader, template, responder.issuer, &leafKey.PublicKey, responder.issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := &tls.Certificate{Certificate: [][]byte{b, responder.issuer.Raw}, PrivateKey: leafKey}
+	return NewOCSPStapler(nil, &mockCertManager{cert})
+}
+
+func TestOCSPStapler_Prefetch(t *testing.T) {
+	root, rootKey := mockCertificate(t, "root", nil, nil, false)
+	responder := &mockOCSPResponder{issuer: root, issuerKey: rootKey}
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	s := mockOCSPStapler(t, responder, server.URL)
+	defer s.Close()
+
+	if err := s.Prefetch("leaf.ossrs.net"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: "leaf.ossrs.net"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.OCSPStaple) == 0 {
+		t.Fatal("no staple")
+	}
+
+	leaf, _ := x509.ParseCertificate(c.Certificate[0])
+	if resp, err := ocsp.ParseResponseForCert(c.OCSPStaple, leaf, root); err != nil {
+		t.Errorf("parse staple failed, err is %v", err)
+	} else if resp.Status != ocsp.Good {
+		t.Errorf("invalid status %v", resp.Status)
+	}
+
+	// Should never change the certificate of manager.
+	if origin, _ := s.manager.GetCertificate(nil); len(origin.OCSPStaple) != 0 {
+		t.Error("should not modify the origin certificate")
+	}
+}
+
+func TestOCSPStapler_Backoff(t *testing.T) {
+	root, rootKey := mockCertificate(t, "root", nil, nil, false)
+	responder := &mockOCSPResponder{issuer: root, issuerKey: rootKey, fails: 2}
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	s := mockOCSPStapler(t, responder, server.URL)
+	s.MinBackoff, s.MaxBackoff = time.Millisecond, 10*time.Millisecond
+	defer s.Close()
+
+	if err := s.Prefetch("leaf.ossrs.net"); err == nil {
+		t.Error("should fail for responder")
+	}
+
+	// The first handshake is not stapled, which starts to fetch it.
+	var c *tls.Certificate
+	for i := 0; i < 200 && (c == nil || len(c.OCSPStaple) == 0); i++ {
+		if i > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		var err error
+		if c, err = s.GetCertificate(&tls.ClientHelloInfo{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.OCSPStaple) == 0 {
+		t.Fatal("no staple after retry")
+	}
+
+	responder.lock.Lock()
+	defer responder.lock.Unlock()
+	if responder.requests != 3 {
+		t.Errorf("invalid requests %v", responder.requests)
+	}
+}
+
+func TestOCSPStapler_nextBackoff(t *testing.T) {
+	s := &OCSPStapler{MinBackoff: time.Second, MaxBackoff: 4 * time.Second}
+
+	var backoff time.Duration
+	for _, expect := range []time.Duration{1, 2, 4, 4} {
+		if backoff = s.nextBackoff(backoff); backoff != expect*time.Second {
+			t.Errorf("expect %v actual %v", expect*time.Second, backoff)
+		}
+	}
+
+	now := time.Now()
+	resp := &ocsp.Response{ThisUpdate: now, NextUpdate: now.Add(10 * time.Minute)}
+	if wait := s.refreshAfter(resp); wait > 5*time.Minute || wait < 4*time.Minute {
+		t.Errorf("should refresh at half, actual %v", wait)
+	}
+}
+
+// Write the certificate of name to dir, return the files.
+func mockCertificateFiles(t *testing.T, dir, name string) (certFile, keyFile string) {
+	cert, key := mockCertificate(t, name, nil, nil, false)
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = path.Join(dir, name+".crt"), path.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestMultiCertManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewMultiCertManager()
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "ossrs.net"}); err == nil {
+		t.Error("should fail without certificate")
+	}
+	if err := m.Add("ossrs.net", path.Join(dir, "none.crt"), path.Join(dir, "none.key")); err == nil {
+		t.Error("should fail for no file")
+	}
+
+	for _, name := range []string{"ossrs.net", "*.ossrs.net", ""} {
+		certFile, keyFile := mockCertificateFiles(t, dir, name+"default")
+		if err := m.Add(name, certFile, keyFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pvs := []struct {
+		serverName string
+		name       string
+	}{
+		{"ossrs.net", "ossrs.netdefault"},
+		{"API.ossrs.net", "*.ossrs.netdefault"},
+		{"srs.net", "default"},
+		{"", "default"},
+	}
+	for _, pv := range pvs {
+		c, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: pv.serverName})
+		if err != nil {
+			t.Errorf("%v failed, err is %+v", pv.serverName, err)
+			continue
+		}
+		if leaf, err := x509.ParseCertificate(c.Certificate[0]); err != nil {
+			t.Error(err)
+		} else if leaf.Subject.CommonName != pv.name {
+			t.Errorf("%v expect %v actual %v", pv.serverName, pv.name, leaf.Subject.CommonName)
+		}
+	}
+
+	// Reload the certificate when files changed.
+	interval := CertReloadInterval
+	CertReloadInterval = 0
+	defer func() {
+		CertReloadInterval = interval
+	}()
+
+	certFile, keyFile := mockCertificateFiles(t, dir, "renewed")
+	b, _ := ioutil.ReadFile(certFile)
+	ioutil.WriteFile(path.Join(dir, "ossrs.netdefault.crt"), b, 0644)
+	b, _ = ioutil.ReadFile(keyFile)
+	ioutil.WriteFile(path.Join(dir, "ossrs.netdefault.key"), b, 0644)
+
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path.Join(dir, "ossrs.netdefault.crt"), future, future)
+
+	c, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "ossrs.net"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf, _ := x509.ParseCertificate(c.Certificate[0]); leaf.Subject.CommonName != "renewed" {
+		t.Errorf("should reload, actual %v", leaf.Subject.CommonName)
+	}
+
+	// Keep the previous certificate when reload failed.
+	ioutil.WriteFile(path.Join(dir, "ossrs.netdefault.key"), []byte("bad"), 0644)
+	os.Chtimes(path.Join(dir, "ossrs.netdefault.key"), future, future)
+	if c, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "ossrs.net"}); err != nil || c == nil {
+		t.Errorf("should use previous certificate, err is %v", err)
+	}
+
+	m.Remove("")
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "srs.net"}); err == nil {
+		t.Error("should fail without default")
+	}
+}
+
+func TestGenerateSelfSignCertificate(t *testing.T) {
+	for _, opts := range []*SelfSignOptions{
+		nil,
+		{CommonName: "ossrs.net", Hosts: []string{"ossrs.net", "10.0.0.1"}, Validity: time.Hour, RSA: true},
+	} {
+		m, err := NewGeneratedSelfSignManager(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := m.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateCertificate(nil, c, nil); err != nil {
+			t.Errorf("invalid certificate, err is %v", err)
+		}
+
+		leaf, err := x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if opts == nil {
+			if err := leaf.VerifyHostname("localhost"); err != nil {
+				t.Error(err)
+			}
+			if err := leaf.VerifyHostname("127.0.0.1"); err != nil {
+				t.Error(err)
+			}
+			if _, ok := c.PrivateKey.(*ecdsa.PrivateKey); !ok {
+				t.Errorf("invalid key %T", c.PrivateKey)
+			}
+			continue
+		}
+
+		if leaf.Subject.CommonName != "ossrs.net" || leaf.VerifyHostname("10.0.0.1") != nil {
+			t.Errorf("invalid subject %v and hosts %v %v", leaf.Subject, leaf.DNSNames, leaf.IPAddresses)
+		}
+		if leaf.NotAfter.After(time.Now().Add(time.Hour)) {
+			t.Errorf("invalid validity %v", leaf.NotAfter)
+		}
+		if leaf.PublicKeyAlgorithm != x509.RSA {
+			t.Errorf("invalid key %v", leaf.PublicKeyAlgorithm)
+		}
+	}
+}
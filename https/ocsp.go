@@ -0,0 +1,329 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The OCSP stapling, fetch and refresh the OCSP response of certificate, to staple in TLS handshake.
+package https
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/https/crypto/ocsp"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The default interval to refresh the OCSP response.
+var OCSPRefreshInterval = time.Duration(1) * time.Hour
+
+// The default backoff when fetch OCSP response failed, doubled for each failure until the max.
+var OCSPMinBackoff = time.Duration(10) * time.Second
+var OCSPMaxBackoff = time.Duration(10) * time.Minute
+
+// The max size of OCSP response.
+const ocspMaxResponseSize = 1024 * 1024
+
+// The default client to request the OCSP responder.
+var ocspClient = &http.Client{Timeout: time.Duration(30) * time.Second}
+
+// The OCSP response of a certificate.
+type ocspStaple struct {
+	// The DER of OCSP response, nil when not fetched.
+	response   []byte
+	nextUpdate time.Time
+	// The last time the certificate is served.
+	used time.Time
+}
+
+// The OCSP stapler, which wraps a Manager and staples the OCSP response to its certificates.
+// For each certificate, the response is fetched from the OCSP server of leaf, then refreshed
+// every RefreshInterval or at the half of its validity, and retried with backoff when failed.
+// For example:
+//		m, _ := https.NewLetsencryptManager(email, hosts, cacheFile)
+//		s := https.NewOCSPStapler(ctx, m)
+//		defer s.Close()
+//		server := &http.Server{TLSConfig: &tls.Config{GetCertificate: s.GetCertificate}}
+// @remark The certificate must contain the issuer, that is, the chain is leaf then issuer.
+// @remark The first handshake of a certificate is not stapled, use Prefetch at startup.
+type OCSPStapler struct {
+	// The interval to refresh the response, use OCSPRefreshInterval when zero.
+	RefreshInterval time.Duration
+	// The backoff when failed, use OCSPMinBackoff and OCSPMaxBackoff when zero.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// The client to request the OCSP responder, nil to use a client with timeout.
+	Client *http.Client
+
+	ctx     ol.Context
+	manager Manager
+
+	lock sync.Mutex
+	// The staples, key is the DER of leaf certificate.
+	staples map[string]*ocspStaple
+	closed  bool
+	closing chan bool
+	wait    sync.WaitGroup
+}
+
+func NewOCSPStapler(ctx ol.Context, m Manager) *OCSPStapler {
+	return &OCSPStapler{
+		ctx: ctx, manager: m,
+		staples: make(map[string]*ocspStaple),
+		closing: make(chan bool),
+	}
+}
+
+// The interface Manager, get the certificate of manager with the OCSP response stapled.
+// @remark The certificate is returned without staple when the response is not ready.
+func (v *OCSPStapler) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := v.manager.GetCertificate(clientHello)
+	if err != nil || cert == nil || len(cert.Certificate) < 2 {
+		return cert, err
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	s := v.staple(cert, 0)
+	if s == nil || len(s.response) == 0 {
+		return cert, nil
+	}
+
+	// Never staple the expired response, which is rejected by clients.
+	if !s.nextUpdate.IsZero() && time.Now().After(s.nextUpdate) {
+		return cert, nil
+	}
+
+	stapled := *cert
+	stapled.OCSPStaple = s.response
+	return &stapled, nil
+}
+
+// Fetch the OCSP response of certificate for serverName, and start to refresh it.
+// @remark Call it before serving, to staple the OCSP response in the first handshake.
+func (v *OCSPStapler) Prefetch(serverName string) (err error) {
+	cert, err := v.manager.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		return fmt.Errorf("get certificate of %v failed, err is %v", serverName, err)
+	}
+	if cert == nil || len(cert.Certificate) < 2 {
+		return fmt.Errorf("no issuer of %v, the chain must be leaf then issuer", serverName)
+	}
+
+	resp, b, err := v.fetch(cert)
+	if err != nil {
+		return fmt.Errorf("fetch OCSP of %v failed, err is %v", serverName, err)
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if s := v.staple(cert, v.refreshAfter(resp)); s != nil {
+		s.response, s.nextUpdate = b, resp.NextUpdate
+	}
+	return
+}
+
+// Stop to refresh the OCSP responses, and wait for all refreshing to quit.
+func (v *OCSPStapler) Close() error {
+	v.lock.Lock()
+	if !v.closed {
+		v.closed = true
+		close(v.closing)
+	}
+	v.lock.Unlock()
+
+	v.wait.Wait()
+	return nil
+}
+
+// Get the staple of cert, or create one and refresh it after wait.
+// @remark Return nil when closed; the lock must be held.
+func (v *OCSPStapler) staple(cert *tls.Certificate, wait time.Duration) *ocspStaple {
+	key := string(cert.Certificate[0])
+	if s, ok := v.staples[key]; ok {
+		s.used = time.Now()
+		return s
+	}
+
+	if v.closed {
+		return nil
+	}
+
+	s := &ocspStaple{used: time.Now()}
+	v.staples[key] = s
+
+	v.wait.Add(1)
+	go func() {
+		defer v.wait.Done()
+		v.refresh(key, s, cert, wait)
+	}()
+	return s
+}
+
+// Refresh the staple s of cert until closed, or the cert is not served any more,
+// for example, the certificate is renewed.
+func (v *OCSPStapler) refresh(key string, s *ocspStaple, cert *tls.Certificate, wait time.Duration) {
+	var backoff time.Duration
+	for {
+		select {
+		case <-v.closing:
+			return
+		case <-time.After(wait):
+		}
+
+		if v.idle(key, s) {
+			return
+		}
+
+		resp, b, err := v.fetch(cert)
+		if err != nil {
+			backoff = v.nextBackoff(backoff)
+			wait = backoff
+			ol.Wf(v.ctx, "https OCSP fetch failed, retry in %v, err is %v", wait, err)
+			continue
+		}
+
+		v.lock.Lock()
+		s.response, s.nextUpdate = b, resp.NextUpdate
+		v.lock.Unlock()
+
+		backoff, wait = 0, v.refreshAfter(resp)
+	}
+}
+
+// Whether the staple is not served for a while, and remove it when idle.
+func (v *OCSPStapler) idle(key string, s *ocspStaple) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if time.Now().Sub(s.used) < 2*v.refreshInterval() {
+		return false
+	}
+
+	delete(v.staples, key)
+	return true
+}
+
+// The duration to refresh the response, at the half of its validity, but no longer than RefreshInterval.
+func (v *OCSPStapler) refreshAfter(resp *ocsp.Response) time.Duration {
+	wait := v.refreshInterval()
+	if !resp.NextUpdate.IsZero() {
+		half := resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+		if d := half.Sub(time.Now()); d < wait {
+			wait = d
+		}
+	}
+
+	// Never refresh too fast, for example, the response is expired.
+	if min := v.minBackoff(); wait < min {
+		wait = min
+	}
+	return wait
+}
+
+// The next backoff, doubled from MinBackoff to MaxBackoff.
+func (v *OCSPStapler) nextBackoff(backoff time.Duration) time.Duration {
+	if backoff *= 2; backoff < v.minBackoff() {
+		backoff = v.minBackoff()
+	}
+	if max := v.maxBackoff(); backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+func (v *OCSPStapler) refreshInterval() time.Duration {
+	if v.RefreshInterval > 0 {
+		return v.RefreshInterval
+	}
+	return OCSPRefreshInterval
+}
+
+func (v *OCSPStapler) minBackoff() time.Duration {
+	if v.MinBackoff > 0 {
+		return v.MinBackoff
+	}
+	return OCSPMinBackoff
+}
+
+func (v *OCSPStapler) maxBackoff() time.Duration {
+	if v.MaxBackoff > 0 {
+		return v.MaxBackoff
+	}
+	return OCSPMaxBackoff
+}
+
+// Fetch the OCSP response of cert from the OCSP server of leaf, return the parsed and DER response.
+// @remark Only the good status is returned, the others are error.
+func (v *OCSPStapler) fetch(cert *tls.Certificate) (resp *ocsp.Response, b []byte, err error) {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse leaf failed, err is %v", err)
+	}
+
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse issuer failed, err is %v", err)
+	}
+
+	if len(leaf.OCSPServer) == 0 {
+		return nil, nil, fmt.Errorf("no OCSP server in %v", leaf.Subject.CommonName)
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create OCSP request failed, err is %v", err)
+	}
+
+	client := v.Client
+	if client == nil {
+		client = ocspClient
+	}
+
+	r, err := client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, fmt.Errorf("request %v failed, err is %v", leaf.OCSPServer[0], err)
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("request %v failed, status is %v", leaf.OCSPServer[0], r.Status)
+	}
+
+	if b, err = ioutil.ReadAll(io.LimitReader(r.Body, ocspMaxResponseSize)); err != nil {
+		return nil, nil, fmt.Errorf("read OCSP response failed, err is %v", err)
+	}
+
+	if resp, err = ocsp.ParseResponseForCert(b, leaf, issuer); err != nil {
+		return nil, nil, fmt.Errorf("parse OCSP response failed, err is %v", err)
+	}
+
+	if resp.Status != ocsp.Good {
+		return nil, nil, fmt.Errorf("OCSP status of %v is %v, not good", leaf.Subject.CommonName, resp.Status)
+	}
+	return resp, b, nil
+}
@@ -0,0 +1,281 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The SNI router, serve different domains with different certificates and handlers on one port.
+package https
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The timeout for TLS handshake of SNI router.
+var SNIHandshakeTimeout = time.Duration(10) * time.Second
+
+// The route of SNI router, serve the connections of server name.
+type sniRoute struct {
+	serverName string
+	manager    Manager
+	// Either the http handler or raw connection handler.
+	handler     http.Handler
+	connHandler func(c net.Conn)
+	// The listener to feed connections to the http server.
+	listener *chanListener
+}
+
+// The SNI router, which routes TLS connections to different handlers by SNI,
+// for example, the management API domain and the streaming domain on one port.
+// The server name can be:
+//		"api.ossrs.net", exactly match the SNI.
+//		"*.ossrs.net", match one label subdomain, live.ossrs.net but not a.live.ossrs.net.
+//		"", the default route when no route matched.
+type SNIRouter struct {
+	lock   sync.Mutex
+	routes []*sniRoute
+	closed bool
+	// The listeners to serve.
+	listeners []net.Listener
+}
+
+func NewSNIRouter() *SNIRouter {
+	return &SNIRouter{}
+}
+
+// Route the connections of serverName to http handler, with certificate of manager.
+func (v *SNIRouter) Handle(serverName string, m Manager, h http.Handler) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.routes = append(v.routes, &sniRoute{serverName: serverName, manager: m, handler: h})
+}
+
+// Route the connections of serverName to raw conn handler, with certificate of manager.
+// @remark The handler should close the connection, which TLS handshake is done.
+func (v *SNIRouter) HandleConn(serverName string, m Manager, h func(c net.Conn)) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.routes = append(v.routes, &sniRoute{serverName: serverName, manager: m, connHandler: h})
+}
+
+func (v *SNIRouter) match(serverName string) *sniRoute {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	names := make([]string, len(v.routes))
+	for i, r := range v.routes {
+		names[i] = r.serverName
+	}
+
+	if i := matchServerName(names, serverName); i >= 0 {
+		return v.routes[i]
+	}
+	return nil
+}
+
+// Find the best match of serverName in names, return the index or -1 if not found.
+// The exactly match first, then the wildcard of longest suffix, and the last default.
+// @remark The wildcard only matches a single label, please read RFC 6125 section 6.4.3.
+func matchServerName(names []string, serverName string) int {
+	serverName = strings.ToLower(serverName)
+
+	wildcard, fallback := -1, -1
+	for i, name := range names {
+		name = strings.ToLower(name)
+		if name == "" {
+			fallback = i
+		} else if name == serverName {
+			return i
+		} else if strings.HasPrefix(name, "*.") {
+			pos := strings.Index(serverName, ".")
+			if pos <= 0 || serverName[pos:] != name[1:] {
+				continue
+			}
+			if wildcard < 0 || len(name) > len(names[wildcard]) {
+				wildcard = i
+			}
+		}
+	}
+
+	if wildcard >= 0 {
+		return wildcard
+	}
+	return fallback
+}
+
+// The interface Manager, get the certificate of route by SNI.
+func (v *SNIRouter) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r := v.match(clientHello.ServerName)
+	if r == nil {
+		return nil, fmt.Errorf("no route for %v", clientHello.ServerName)
+	}
+	return r.manager.GetCertificate(clientHello)
+}
+
+// Listen at addr and serve it.
+func (v *SNIRouter) ListenAndServe(addr string) (err error) {
+	var l net.Listener
+	if l, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+
+	return v.Serve(l)
+}
+
+// Serve the listener, which accept TCP connections, do TLS handshake and route by SNI.
+// @remark The listener is closed when router closed.
+func (v *SNIRouter) Serve(l net.Listener) (err error) {
+	if err = func() error {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+
+		if v.closed {
+			return fmt.Errorf("router closed")
+		}
+		v.listeners = append(v.listeners, l)
+		return nil
+	}(); err != nil {
+		l.Close()
+		return
+	}
+
+	conf := &tls.Config{GetCertificate: v.GetCertificate}
+
+	for {
+		var c net.Conn
+		if c, err = l.Accept(); err != nil {
+			return
+		}
+
+		go v.serve(tls.Server(c, conf))
+	}
+}
+
+func (v *SNIRouter) serve(c *tls.Conn) {
+	c.SetDeadline(time.Now().Add(SNIHandshakeTimeout))
+	if err := c.Handshake(); err != nil {
+		c.Close()
+		return
+	}
+	c.SetDeadline(time.Time{})
+
+	r := v.match(c.ConnectionState().ServerName)
+	if r == nil {
+		c.Close()
+		return
+	}
+
+	if r.connHandler != nil {
+		r.connHandler(c)
+		return
+	}
+
+	if l := v.routeListener(r); l == nil || !l.push(c) {
+		c.Close()
+	}
+}
+
+// Get the listener of route, start a http server when first used.
+func (v *SNIRouter) routeListener(r *sniRoute) *chanListener {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.closed {
+		return nil
+	}
+
+	if r.listener == nil {
+		r.listener = newChanListener()
+		server := &http.Server{Handler: r.handler}
+		go server.Serve(r.listener)
+	}
+
+	return r.listener
+}
+
+// The interface io.Closer, close all listeners.
+func (v *SNIRouter) Close() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.closed = true
+
+	for _, l := range v.listeners {
+		l.Close()
+	}
+	v.listeners = nil
+
+	for _, r := range v.routes {
+		if r.listener != nil {
+			r.listener.Close()
+		}
+	}
+
+	return nil
+}
+
+// The listener which accept connections from channel.
+type chanListener struct {
+	conns  chan net.Conn
+	closed chan bool
+	once   sync.Once
+}
+
+func newChanListener() *chanListener {
+	return &chanListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan bool),
+	}
+}
+
+func (v *chanListener) push(c net.Conn) bool {
+	select {
+	case v.conns <- c:
+		return true
+	case <-v.closed:
+		return false
+	}
+}
+
+func (v *chanListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-v.conns:
+		return c, nil
+	case <-v.closed:
+		return nil, fmt.Errorf("listener closed")
+	}
+}
+
+func (v *chanListener) Close() error {
+	v.once.Do(func() {
+		close(v.closed)
+	})
+	return nil
+}
+
+func (v *chanListener) Addr() net.Addr {
+	return &net.TCPAddr{}
+}
@@ -0,0 +1,161 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The startup validation for certificate chain, to find the problems before serving traffic.
+package https
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"strings"
+)
+
+// The OID of TLS Feature extension, RFC7633, which is the OCSP Must-Staple when contains status_request.
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// The status_request of TLS Feature, RFC6066.
+const tlsFeatureStatusRequest = 5
+
+// The options to validate certificate.
+type ValidateOptions struct {
+	// The roots to verify the chain, nil to use the system roots.
+	Roots *x509.CertPool
+	// Whether require the OCSP Must-Staple in the leaf certificate.
+	MustStaple bool
+}
+
+// Whether the cert requires OCSP Must-Staple.
+func MustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidTLSFeature) {
+			continue
+		}
+
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, feature := range features {
+			if feature == tlsFeatureStatusRequest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate the certificate, for example, loaded by tls.LoadX509KeyPair, which checks:
+//		the chain order, each certificate must be issued by the next one.
+//		the private key matches the leaf certificate.
+//		the OCSP Must-Staple presence, when required by opts.
+//		the intermediates completeness, the chain must be verified by the roots.
+// The problems are logged and returned in error, which is nil when all ok.
+// @remark Set opts to nil to use the system roots without Must-Staple.
+// @remark The self-signed certificate is not verified by the roots.
+func ValidateCertificate(ctx ol.Context, cert *tls.Certificate, opts *ValidateOptions) (err error) {
+	if opts == nil {
+		opts = &ValidateOptions{}
+	}
+
+	if cert == nil || len(cert.Certificate) == 0 {
+		return fmt.Errorf("no certificate")
+	}
+
+	var certs []*x509.Certificate
+	for i, b := range cert.Certificate {
+		c, err := x509.ParseCertificate(b)
+		if err != nil {
+			return fmt.Errorf("parse certificate #%v failed, err is %v", i, err)
+		}
+		certs = append(certs, c)
+	}
+	leaf := certs[0]
+
+	var problems []string
+	problem := func(format string, a ...interface{}) {
+		s := fmt.Sprintf(format, a...)
+		ol.Ef(ctx, "https validate %v failed, %v", leaf.Subject.CommonName, s)
+		problems = append(problems, s)
+	}
+
+	// The private key must match the leaf.
+	if signer, ok := cert.PrivateKey.(crypto.Signer); !ok {
+		problem("private key %T is not a signer, check the key file", cert.PrivateKey)
+	} else if pub, err := x509.MarshalPKIXPublicKey(signer.Public()); err != nil {
+		problem("marshal public key failed, err is %v", err)
+	} else if want, err := x509.MarshalPKIXPublicKey(leaf.PublicKey); err != nil {
+		problem("marshal leaf public key failed, err is %v", err)
+	} else if !bytes.Equal(pub, want) {
+		problem("private key does not match certificate %v, check the key file", leaf.Subject)
+	}
+
+	// Each certificate must be issued by the next one, the leaf is the first.
+	for i := 1; i < len(certs); i++ {
+		if err := certs[i-1].CheckSignatureFrom(certs[i]); err != nil {
+			problem("chain order wrong at #%v, %v is issued by %v, but next is %v, the leaf must be first and followed by its issuer",
+				i-1, certs[i-1].Subject, certs[i-1].Issuer, certs[i].Subject)
+		}
+	}
+
+	// The OCSP Must-Staple.
+	if mustStaple := MustStaple(leaf); !mustStaple && opts.MustStaple {
+		problem("no OCSP Must-Staple in %v, request the certificate with TLS Feature status_request", leaf.Subject)
+	} else if mustStaple && len(cert.OCSPStaple) == 0 {
+		ol.Wf(ctx, "https validate %v, OCSP Must-Staple without staple, clients will reject the connection", leaf.Subject.CommonName)
+	}
+
+	// Verify the chain by roots, ignore the self-signed leaf.
+	selfSigned := len(certs) == 1 && bytes.Equal(leaf.RawIssuer, leaf.RawSubject) && leaf.CheckSignatureFrom(leaf) == nil
+	if !selfSigned {
+		intermediates := x509.NewCertPool()
+		for _, c := range certs[1:] {
+			intermediates.AddCert(c)
+		}
+
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: opts.Roots, Intermediates: intermediates}); err != nil {
+			if _, ok := err.(x509.UnknownAuthorityError); ok {
+				last := certs[len(certs)-1]
+				problem("incomplete chain, missing intermediate issued by %v, append it to the certificate file", last.Issuer)
+			} else {
+				problem("verify failed, err is %v", err)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("certificate %v invalid, %v", leaf.Subject.CommonName, strings.Join(problems, "; "))
+	}
+	return
+}
+
+// Validate the certificate of manager for serverName, see ValidateCertificate.
+func ValidateManager(ctx ol.Context, m Manager, serverName string, opts *ValidateOptions) (err error) {
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		return fmt.Errorf("get certificate of %v failed, err is %v", serverName, err)
+	}
+	return ValidateCertificate(ctx, cert, opts)
+}
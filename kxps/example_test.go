@@ -22,6 +22,7 @@
 package kxps_test
 
 import (
+	"fmt"
 	"github.com/ossrs/go-oryx-lib/kxps"
 )
 
@@ -58,3 +59,23 @@ func ExampleKbps() {
 	_ = kbps.Kbps30s()
 	_ = kbps.Kbps300s()
 }
+
+func ExampleThreshold() {
+	// user must provides the kbps source
+	var source kxps.KbpsSource
+
+	kbps := kxps.NewKbps(nil, source)
+	defer kbps.Close()
+
+	// Alarm when the bitrate in last 30s below 100kbps, recover when above 150kbps.
+	kbps.(kxps.Thresholder).AddThreshold(&kxps.Threshold{
+		Metric: kxps.Metric30s, Value: 100, Hysteresis: 50,
+		OnCross: func(t *kxps.Threshold, value float64, alarm bool) {
+			fmt.Println("Stream bitrate", value, "kbps, alarm", alarm)
+		},
+	})
+
+	if err := kbps.Start(); err != nil {
+		return
+	}
+}
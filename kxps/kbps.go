@@ -35,7 +35,7 @@ type KbpsSource interface {
 
 // The object to calc the kbps.
 type Kbps interface {
-	// Start the kbps sample goroutine.
+	// Start to sample the kbps by the scheduler shared by all kxps.
 	Start() (err error)
 
 	// Get the kbps in last 10s.
@@ -59,6 +59,8 @@ type kbps struct {
 func NewKbps(ctx ol.Context, source KbpsSource) Kbps {
 	v := &kbps{source: source}
 	v.imp = newKxps(ctx, v)
+	// Bps to Kbps
+	v.imp.scale = 8.0 / 1000
 	return v
 }
 
@@ -102,6 +104,10 @@ func (v *kbps) Average() float64 {
 	return v.imp.Average() * 8 / 1000
 }
 
+func (v *kbps) AddThreshold(t *Threshold) {
+	v.imp.AddThreshold(t)
+}
+
 func (v *kbps) Start() (err error) {
 	return v.imp.Start()
 }
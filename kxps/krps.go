@@ -35,7 +35,7 @@ type KrpsSource interface {
 
 // The object to calc the krps.
 type Krps interface {
-	// Start the krps sample goroutine.
+	// Start to sample the krps by the scheduler shared by all kxps.
 	Start() (err error)
 
 	// Get the rps in last 10s.
@@ -101,6 +101,10 @@ func (v *krps) Average() float64 {
 	return v.imp.Average()
 }
 
+func (v *krps) AddThreshold(t *Threshold) {
+	v.imp.AddThreshold(t)
+}
+
 func (v *krps) Start() (err error) {
 	return v.imp.Start()
 }
@@ -84,6 +84,8 @@ type kxps struct {
 	closed  bool
 	started bool
 	lock    *sync.Mutex
+	// The scheduler to sample this kxps.
+	scheduler *scheduler
 	// samples
 	r10s  sample
 	r30s  sample
@@ -91,23 +93,30 @@ type kxps struct {
 	// for average
 	average uint64
 	create  time.Time
+	// The thresholds and scale of xps to the unit of thresholds.
+	thresholds []*Threshold
+	scale      float64
 }
 
 func newKxps(ctx ol.Context, s kxpsSource) *kxps {
 	v := &kxps{
-		lock:   &sync.Mutex{},
-		source: s,
-		ctx:    ctx,
+		lock:      &sync.Mutex{},
+		source:    s,
+		ctx:       ctx,
+		scale:     1,
+		scheduler: defaultScheduler,
 	}
 
-	v.r10s.interval = time.Duration(10) * time.Second
-	v.r30s.interval = time.Duration(30) * time.Second
-	v.r300s.interval = time.Duration(300) * time.Second
+	v.r10s.interval = Metric10s.Window()
+	v.r30s.interval = Metric30s.Window()
+	v.r300s.interval = Metric300s.Window()
 
 	return v
 }
 
 func (v *kxps) Close() (err error) {
+	v.scheduler.unregister(v)
+
 	v.lock.Lock()
 	defer v.lock.Unlock()
 
@@ -184,27 +193,16 @@ func (v *kxps) doSample(now time.Time) (err error) {
 	return
 }
 
+// Start to sample by the shared scheduler, about every 10s.
 func (v *kxps) Start() (err error) {
-	ctx := v.ctx
-
-	go func() {
-		for {
-			if err := v.sample(); err != nil {
-				if err == kxpsClosed {
-					return
-				}
-				ol.W(ctx, "kxps ignore sample failed, err is", err)
-			}
-			time.Sleep(time.Duration(10) * time.Second)
-		}
-	}()
+	v.scheduler.register(v)
 
 	v.started = true
 
 	return
 }
 
-func (v *kxps) sample() (err error) {
+func (v *kxps) sample(now time.Time) (err error) {
 	ctx := v.ctx
 
 	defer func() {
@@ -213,6 +211,11 @@ func (v *kxps) sample() (err error) {
 		}
 	}()
 
+	var events []thresholdEvent
+	defer func() {
+		v.notify(events)
+	}()
+
 	v.lock.Lock()
 	defer v.lock.Unlock()
 
@@ -220,5 +223,10 @@ func (v *kxps) sample() (err error) {
 		return kxpsClosed
 	}
 
-	return v.doSample(time.Now())
+	if err = v.doSample(now); err != nil {
+		return
+	}
+
+	events = v.evaluate(now)
+	return
 }
@@ -22,6 +22,7 @@
 package kxps
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 )
@@ -113,3 +114,106 @@ func TestKxps_Rps10s(t *testing.T) {
 		t.Errorf("sample invalid, 10s=%v, 30s=%v, 300s=%v", kxps.Xps10s(), kxps.Xps30s(), kxps.Xps300s())
 	}
 }
+
+func TestKxps_Threshold(t *testing.T) {
+	s := &mockSource{}
+	kxps := newKxps(nil, s)
+
+	var alarms []bool
+	kxps.AddThreshold(&Threshold{
+		Metric: Metric10s, Above: true, Value: 10, Hysteresis: 2,
+		OnCross: func(t *Threshold, value float64, alarm bool) {
+			alarms = append(alarms, alarm)
+		},
+	})
+
+	// The rps of each 10s, alarm above 10, recover below 8.
+	var now int64
+	for _, rps := range []uint64{1, 5, 20, 30, 9, 7, 7, 11} {
+		s.s += rps * 10
+		now += 10
+		if err := kxps.doSample(time.Unix(now, 0)); err != nil {
+			t.Fatalf("sample failed, err is %+v", err)
+		}
+		kxps.notify(kxps.evaluate(time.Unix(now, 0)))
+	}
+
+	if len(alarms) != 3 || !alarms[0] || alarms[1] || !alarms[2] {
+		t.Errorf("invalid alarms %v", alarms)
+	}
+
+	// The kbps and krps support threshold, but not in the interfaces.
+	if _, ok := NewKbps(nil, nil).(Thresholder); !ok {
+		t.Error("kbps should be thresholder")
+	}
+	if _, ok := NewKrps(nil, nil).(Thresholder); !ok {
+		t.Error("krps should be thresholder")
+	}
+}
+
+func TestThresholdMetric(t *testing.T) {
+	pvs := []struct {
+		s  string
+		m  ThresholdMetric
+		ok bool
+	}{
+		{"10s", Metric10s, true}, {"30s", Metric30s, true}, {"5m", Metric300s, true}, {"300s", Metric300s, true},
+		{"average", MetricAverage, true}, {"Average", MetricAverage, true}, {"1m", MetricAverage, false},
+		{"10", MetricAverage, false},
+	}
+	for _, pv := range pvs {
+		if m, err := ParseThresholdMetric(pv.s); (err == nil) != pv.ok || m != pv.m {
+			t.Errorf("parse %v got %v, err is %v", pv.s, m, err)
+		}
+	}
+
+	var th Threshold
+	if err := json.Unmarshal([]byte(`{"Metric":"0.5m","Value":1.5}`), &th); err != nil || th.Metric != Metric30s || th.Value != 1.5 {
+		t.Errorf("unmarshal %v, err is %v", th.Metric, err)
+	}
+	if b, err := json.Marshal(Metric300s); err != nil || string(b) != `"300s"` {
+		t.Errorf("marshal %s, err is %v", b, err)
+	}
+	if m := MetricAverage; m.Window() != 0 || Metric10s.Window() != 10*time.Second {
+		t.Errorf("invalid windows")
+	}
+}
+
+func TestScheduler_Tick(t *testing.T) {
+	sch := newScheduler()
+
+	s0, s1 := &mockSource{}, &mockSource{}
+	k0, k1 := newKxps(nil, s0), newKxps(nil, s1)
+	k0.scheduler, k1.scheduler = sch, sch
+
+	// The k1 starts 5s later than k0.
+	sch.instances[k0], sch.instances[k1] = time.Unix(0, 0), time.Unix(5, 0)
+
+	for now := int64(0); now <= 25; now++ {
+		s0.s, s1.s = uint64(now*10), uint64(now*20)
+		if !sch.tick(time.Unix(now, 0)) {
+			t.Fatal("should running")
+		}
+	}
+
+	// The k0 sampled at 0, 10, 20, and k1 at 5, 15, 25.
+	if k0.r10s.lastSample != time.Unix(20, 0) || k0.Xps10s() != 10 {
+		t.Errorf("invalid k0 %v", k0.r10s.String())
+	}
+	if k1.r10s.lastSample != time.Unix(25, 0) || k1.Xps10s() != 20 {
+		t.Errorf("invalid k1 %v", k1.r10s.String())
+	}
+
+	// The closed kxps is removed, and stop running when no kxps.
+	k0.Close()
+	k1.lock.Lock()
+	k1.closed = true
+	k1.lock.Unlock()
+
+	if !sch.tick(time.Unix(35, 0)) || len(sch.instances) != 0 {
+		t.Errorf("invalid instances %v", len(sch.instances))
+	}
+	if sch.tick(time.Unix(36, 0)) || sch.running {
+		t.Error("should stop")
+	}
+}
@@ -0,0 +1,118 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The scheduler to sample all kxps in one goroutine.
+package kxps
+
+import (
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"sync"
+	"time"
+)
+
+// The interval to tick the scheduler.
+const schedulerTick = time.Duration(1) * time.Second
+
+// The interval to sample each kxps.
+const sampleInterval = time.Duration(10) * time.Second
+
+// The scheduler ticks every second by one timer, and samples the kxps which is due,
+// so the servers with thousands of streams never start a goroutine and timer for each kxps.
+// @remark Each kxps is sampled about every 10s from its start, so the samples are spread
+// over the ticks, not all at the same second.
+// @remark The goroutine exits when no kxps, and starts again when kxps registered.
+type scheduler struct {
+	lock sync.Mutex
+	// The registered kxps and the time of next sample.
+	instances map[*kxps]time.Time
+	running   bool
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{instances: make(map[*kxps]time.Time)}
+}
+
+// The scheduler shared by all kxps.
+var defaultScheduler = newScheduler()
+
+// Register the kxps to sample at next tick.
+func (v *scheduler) register(x *kxps) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.instances[x] = time.Now()
+
+	if !v.running {
+		v.running = true
+		go v.run()
+	}
+}
+
+func (v *scheduler) unregister(x *kxps) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	delete(v.instances, x)
+}
+
+func (v *scheduler) run() {
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if !v.tick(now) {
+			return
+		}
+	}
+}
+
+// Sample the kxps which is due, return false and stop running when no kxps.
+func (v *scheduler) tick(now time.Time) bool {
+	var due []*kxps
+
+	v.lock.Lock()
+	if len(v.instances) == 0 {
+		v.running = false
+		v.lock.Unlock()
+		return false
+	}
+
+	for x, next := range v.instances {
+		if !now.Before(next) {
+			due = append(due, x)
+			v.instances[x] = now.Add(sampleInterval)
+		}
+	}
+	v.lock.Unlock()
+
+	// Sample without lock, for the threshold callbacks might be slow.
+	for _, x := range due {
+		if err := x.sample(now); err != nil {
+			if err == kxpsClosed {
+				v.unregister(x)
+				continue
+			}
+			ol.W(x.ctx, "kxps ignore sample failed, err is", err)
+		}
+	}
+
+	return true
+}
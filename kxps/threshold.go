@@ -0,0 +1,225 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The threshold to alarm when kxps crosses a value.
+package kxps
+
+import (
+	"encoding/json"
+	"fmt"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	oo "github.com/ossrs/go-oryx-lib/options"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The metric of kxps to check the threshold.
+type ThresholdMetric int
+
+const (
+	// The xps in last 10s.
+	Metric10s ThresholdMetric = iota
+	// The xps in last 30s.
+	Metric30s
+	// The xps in last 300s.
+	Metric300s
+	// The xps in average.
+	MetricAverage
+)
+
+func (v ThresholdMetric) String() string {
+	switch v {
+	case Metric10s:
+		return "10s"
+	case Metric30s:
+		return "30s"
+	case Metric300s:
+		return "300s"
+	default:
+		return "Average"
+	}
+}
+
+// The window of metric, 0 for average.
+func (v ThresholdMetric) Window() time.Duration {
+	switch v {
+	case Metric10s:
+		return time.Duration(10) * time.Second
+	case Metric30s:
+		return time.Duration(30) * time.Second
+	case Metric300s:
+		return time.Duration(300) * time.Second
+	default:
+		return 0
+	}
+}
+
+// Parse the metric by window, for example, "30s" or "5m", or "average" for MetricAverage.
+func ParseThresholdMetric(s string) (ThresholdMetric, error) {
+	if strings.EqualFold(strings.TrimSpace(s), MetricAverage.String()) {
+		return MetricAverage, nil
+	}
+
+	var d oo.Duration
+	if err := d.Set(s); err != nil {
+		return MetricAverage, fmt.Errorf("parse metric %v, %v", s, err)
+	}
+
+	for _, m := range []ThresholdMetric{Metric10s, Metric30s, Metric300s} {
+		if d.Duration() == m.Window() {
+			return m, nil
+		}
+	}
+	return MetricAverage, fmt.Errorf("no metric of window %v", d)
+}
+
+func (v *ThresholdMetric) Set(s string) (err error) {
+	*v, err = ParseThresholdMetric(s)
+	return
+}
+
+func (v ThresholdMetric) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+func (v *ThresholdMetric) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("unmarshal metric %s, %v", data, err)
+	}
+	return v.Set(s)
+}
+
+// The threshold attached to kxps, for example, rps10s > X or kbps30s < Y,
+// which callback when the metric crosses the value, with hysteresis to avoid flapping.
+// @remark The value is in the unit of kxps, that is, rps for krps and kbps for kbps.
+// @remark The threshold is checked after each sample, about every 10s, and only
+// after the first sample, so it never alarms before the source got any data.
+type Threshold struct {
+	// The metric to check.
+	Metric ThresholdMetric
+	// Alarm when metric above the Value if true, otherwise below the Value.
+	Above bool
+	// The value to alarm.
+	Value float64
+	// Recover when the metric back over the Value by Hysteresis, for example,
+	// for above threshold, recover when metric below Value-Hysteresis.
+	Hysteresis float64
+	// The callback when crossed, alarm is true when raised, false when recovered.
+	// @remark Never call the kxps in callback, which is called by the scheduler goroutine,
+	// and never block it, for it is shared by all kxps.
+	OnCross func(t *Threshold, value float64, alarm bool)
+	// Whether alarm raised, updated by the scheduler goroutine.
+	lock  sync.Mutex
+	alarm bool
+}
+
+// Whether the alarm is raised.
+func (v *Threshold) Alarm() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.alarm
+}
+
+// Update the threshold by the metric value, return true when crossed.
+func (v *Threshold) update(value float64) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if !v.alarm {
+		if (v.Above && value > v.Value) || (!v.Above && value < v.Value) {
+			v.alarm = true
+			return true
+		}
+		return false
+	}
+
+	if (v.Above && value < v.Value-v.Hysteresis) || (!v.Above && value > v.Value+v.Hysteresis) {
+		v.alarm = false
+		return true
+	}
+	return false
+}
+
+// The event when threshold crossed.
+type thresholdEvent struct {
+	t     *Threshold
+	value float64
+	alarm bool
+}
+
+// The kxps which supports threshold, for example, the Kbps and Krps created by NewKbps
+// and NewKrps, which value is in kbps and rps, see ExampleThreshold.
+type Thresholder interface {
+	// Attach a threshold, the value is in the unit of kxps.
+	AddThreshold(t *Threshold)
+}
+
+func (v *kxps) AddThreshold(t *Threshold) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.thresholds = append(v.thresholds, t)
+}
+
+// Check all thresholds, return the crossed events.
+func (v *kxps) evaluate(now time.Time) (events []thresholdEvent) {
+	// Not sampled yet.
+	if len(v.thresholds) == 0 || !v.r10s.lastSample.After(v.r10s.create) {
+		return
+	}
+
+	for _, t := range v.thresholds {
+		var value float64
+		switch t.Metric {
+		case Metric10s:
+			value = v.r10s.rps
+		case Metric30s:
+			value = v.r30s.rps
+		case Metric300s:
+			value = v.r300s.rps
+		default:
+			value = v.sampleAverage(now)
+		}
+		value *= v.scale
+
+		if t.update(value) {
+			events = append(events, thresholdEvent{t, value, t.Alarm()})
+		}
+	}
+
+	return
+}
+
+// Notify the events, without lock.
+func (v *kxps) notify(events []thresholdEvent) {
+	ctx := v.ctx
+
+	for _, e := range events {
+		ol.Tf(ctx, "kxps threshold %v above=%v value=%v crossed, current=%v, alarm=%v",
+			e.t.Metric, e.t.Above, e.t.Value, e.value, e.alarm)
+
+		if e.t.OnCross != nil {
+			e.t.OnCross(e.t, e.value, e.alarm)
+		}
+	}
+}
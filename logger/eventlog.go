@@ -0,0 +1,56 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The Windows Event Log writer, for services deployed on Windows.
+package logger
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// The event types of Windows Event Log, the severity of event.
+const (
+	eventLogError       = 0x0001
+	eventLogWarning     = 0x0002
+	eventLogInformation = 0x0004
+)
+
+// The event id, for the source installed by EventCreate.exe, which message file
+// shows the string of event for id 1 to 1000.
+const eventLogID = 1
+
+// Map the level of log line p to the event type, the log line is written by Switch in
+// text format, or by SwitchFormat in logfmt, JSON or GELF format.
+func eventLogType(p []byte) uint16 {
+	for _, level := range []string{LevelError, LevelWarn} {
+		if bytes.HasPrefix(p, []byte("["+level+"] ")) ||
+			bytes.Contains(p, []byte(" level="+level+" ")) ||
+			bytes.Contains(p, []byte(`"level":"`+level+`"`)) ||
+			bytes.Contains(p, []byte(fmt.Sprintf(`"level":%v,`, gelfLevel(level)))) {
+			if level == LevelError {
+				return eventLogError
+			}
+			return eventLogWarning
+		}
+	}
+	return eventLogInformation
+}
@@ -0,0 +1,110 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// +build windows
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procRegisterEventSourceW  = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW          = advapi32.NewProc("ReportEventW")
+)
+
+// The writer to Windows Event Log.
+type eventLogWriter struct {
+	lock   sync.Mutex
+	handle uintptr
+}
+
+// Create the writer to Windows Event Log of source, each log is an event, which type is
+// mapped from the level, that is, error, warning or information. Use Switch to select it:
+//		w, _ := logger.NewEventLogWriter("srs")
+//		logger.Switch(w)
+//		defer logger.Close()
+// @remark The source should be installed, for example, by the administrator:
+//		eventcreate /ID 1 /L APPLICATION /T INFORMATION /SO srs /D "Install srs"
+func NewEventLogWriter(source string) (io.WriteCloser, error) {
+	name, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source %v, err is %v", source, err)
+	}
+
+	h, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(name)))
+	if h == 0 {
+		return nil, fmt.Errorf("register event source %v failed, err is %v", source, err)
+	}
+
+	return &eventLogWriter{handle: h}, nil
+}
+
+// Write the log line p as an event.
+func (v *eventLogWriter) Write(p []byte) (n int, err error) {
+	// The NUL is not allowed in string of event.
+	s := strings.Replace(strings.TrimRight(string(p), "\r\n"), "\x00", " ", -1)
+	msg, err := syscall.UTF16PtrFromString(s)
+	if err != nil {
+		return 0, err
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.handle == 0 {
+		return 0, fmt.Errorf("event log closed")
+	}
+
+	strs := []*uint16{msg}
+	r, _, err := procReportEventW.Call(
+		v.handle, uintptr(eventLogType(p)), 0, eventLogID, 0,
+		uintptr(len(strs)), 0, uintptr(unsafe.Pointer(&strs[0])), 0,
+	)
+	if r == 0 {
+		return 0, fmt.Errorf("report event failed, err is %v", err)
+	}
+	return len(p), nil
+}
+
+func (v *eventLogWriter) Close() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.handle == 0 {
+		return nil
+	}
+
+	r, _, err := procDeregisterEventSource.Call(v.handle)
+	v.handle = 0
+	if r == 0 {
+		return fmt.Errorf("deregister event source failed, err is %v", err)
+	}
+	return nil
+}
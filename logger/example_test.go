@@ -23,6 +23,7 @@ package logger_test
 
 import (
 	ol "github.com/ossrs/go-oryx-lib/logger"
+	"io"
 	"os"
 )
 
@@ -101,3 +102,15 @@ func ExampleLogger_ConnectionBased() {
 	ol.Warn.Println(ctx, "The log text.")
 	ol.Error.Println(ctx, "The log text.")
 }
+
+func ExampleSwitchFormat() {
+	// Write logs in logfmt, for example, to the log agent which parse logfmt.
+	ol.SwitchFormat(os.Stdout, ol.NewLogfmtFormatter())
+	ol.T(cidContext(100), "The log text.")
+
+	// Or write the error logs in GELF to Graylog, by a TCP connection.
+	var c io.Writer
+	gelf := ol.NewGELFFormatter()
+	gelf.NullDelimiter = true
+	ol.Error = ol.NewFormatLogger(c, ol.LevelError, gelf)
+}
@@ -0,0 +1,96 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package logger
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// The field of log, for example, the service name or region.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// The global fields for all loggers.
+var globals struct {
+	lock   sync.RWMutex
+	fields []Field
+	// The prefix of text logs, for example, [service=srs region=cn].
+	prefix string
+}
+
+// Set the global fields, which are included in every log, nil to disable. For example,
+// to filter the multi-instance deployments in a central log store:
+//		logger.SetGlobalFields(logger.InstanceFields("srs", logger.Field{"region", "cn"})...)
+// The text logs are prefixed by [service=srs host=xxx region=cn], while the logfmt and
+// GELF logs have the fields.
+func SetGlobalFields(fields ...Field) {
+	globals.lock.Lock()
+	defer globals.lock.Unlock()
+
+	globals.fields = append([]Field(nil), fields...)
+
+	globals.prefix = fieldsPrefix(fields)
+}
+
+// The prefix of fields for text logs, for example, [service=srs region=cn], empty if no fields.
+func fieldsPrefix(fields []Field) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	kvs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		kvs = append(kvs, f.Key+"="+logfmtValue(f.Value))
+	}
+	return "[" + strings.Join(kvs, " ") + "]"
+}
+
+// Get the global fields.
+func GlobalFields() []Field {
+	globals.lock.RLock()
+	defer globals.lock.RUnlock()
+
+	return globals.fields
+}
+
+// Get the prefix of global fields for text logs, empty if no fields.
+func globalPrefix() string {
+	globals.lock.RLock()
+	defer globals.lock.RUnlock()
+
+	return globals.prefix
+}
+
+// The fields to identify the instance, which are the service and hostname, then the
+// extra fields, for example, the region and instance id.
+// @remark The pid is always in logs, so it's not in fields.
+func InstanceFields(service string, extra ...Field) []Field {
+	fields := []Field{{"service", service}}
+	if host, err := os.Hostname(); err == nil {
+		fields = append(fields, Field{"host", host})
+	}
+	return append(fields, extra...)
+}
@@ -0,0 +1,337 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The level names of logger.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelTrace = "trace"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// The log entry to format.
+type Entry struct {
+	Time  time.Time
+	Level string
+	Pid   int
+	// The cid of context, 0 if no cid.
+	Cid     int
+	Message string
+	// The global fields, see SetGlobalFields, then the fields of context, see WithFields.
+	Fields []Field
+}
+
+// The formatter to marshal the log entry, with the line delimiter.
+type Formatter interface {
+	Format(e *Entry) ([]byte, error)
+}
+
+// The logfmt formatter, for example:
+//		time=2017-01-01T10:00:00.000000+08:00 level=trace pid=1 cid=100 msg="The log text."
+// Please read https://brandur.org/logfmt
+type LogfmtFormatter struct {
+}
+
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{}
+}
+
+func (v *LogfmtFormatter) Format(e *Entry) ([]byte, error) {
+	b := getBuffer()
+	defer putBuffer(b)
+
+	fmt.Fprintf(b, "time=%v level=%v pid=%v", e.Time.Format("2006-01-02T15:04:05.000000Z07:00"), e.Level, e.Pid)
+	if e.Cid != 0 {
+		fmt.Fprintf(b, " cid=%v", e.Cid)
+	}
+	for _, f := range e.Fields {
+		fmt.Fprintf(b, " %v=%v", f.Key, logfmtValue(f.Value))
+	}
+	fmt.Fprintf(b, " msg=%v\n", logfmtValue(e.Message))
+
+	// Copy out for the buffer is reused.
+	return append([]byte(nil), b.Bytes()...), nil
+}
+
+// Quote the value if required.
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// The JSON formatter, one object per line, for log stores like ELK, for example:
+//		{"time":"2017-01-01T10:00:00.000000+08:00","level":"trace","pid":1,"cid":100,"service":"srs","msg":"The log text."}
+// The fields are the keys of object, and prefixed with underscore if conflict with the
+// keys of entry, for example, the field pid is _pid.
+type JSONFormatter struct {
+}
+
+func NewJSONFormatter() *JSONFormatter {
+	return &JSONFormatter{}
+}
+
+// The keys of entry in JSON.
+var jsonKeys = map[string]bool{"time": true, "level": true, "pid": true, "cid": true, "msg": true}
+
+func (v *JSONFormatter) Format(e *Entry) ([]byte, error) {
+	b := getBuffer()
+	defer putBuffer(b)
+
+	fmt.Fprintf(b, `{"time":"%v","level":%v,"pid":%v`, e.Time.Format("2006-01-02T15:04:05.000000Z07:00"), jsonString(e.Level), e.Pid)
+	if e.Cid != 0 {
+		fmt.Fprintf(b, `,"cid":%v`, e.Cid)
+	}
+	for _, f := range e.Fields {
+		key := f.Key
+		if jsonKeys[key] {
+			key = "_" + key
+		}
+		fmt.Fprintf(b, `,%v:%v`, jsonString(key), jsonString(f.Value))
+	}
+	fmt.Fprintf(b, `,"msg":%v}`+"\n", jsonString(e.Message))
+
+	// Copy out for the buffer is reused.
+	return append([]byte(nil), b.Bytes()...), nil
+}
+
+// Quote the string in JSON.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// The GELF formatter, for Graylog, please read
+// https://go2docs.graylog.org/current/getting_in_log_data/gelf.html
+type GELFFormatter struct {
+	// The host of message, use os.Hostname if empty.
+	Host string
+	// Whether use the null byte as delimiter, for GELF TCP input, otherwise the newline.
+	NullDelimiter bool
+}
+
+func NewGELFFormatter() *GELFFormatter {
+	v := &GELFFormatter{}
+	v.Host, _ = os.Hostname()
+	return v
+}
+
+// The GELF 1.1 message, the additional fields are prefixed with underscore.
+type gelfMessage struct {
+	Version      string  `json:"version"`
+	Host         string  `json:"host"`
+	ShortMessage string  `json:"short_message"`
+	FullMessage  string  `json:"full_message,omitempty"`
+	Timestamp    float64 `json:"timestamp"`
+	Level        int     `json:"level"`
+	Pid          int     `json:"_pid"`
+	Cid          int     `json:"_cid,omitempty"`
+}
+
+func (v *GELFFormatter) Format(e *Entry) ([]byte, error) {
+	m := &gelfMessage{
+		Version: "1.1", Host: v.Host, ShortMessage: e.Message,
+		Timestamp: float64(e.Time.UnixNano()/int64(time.Microsecond)) / 1e6,
+		Level:     gelfLevel(e.Level), Pid: e.Pid, Cid: e.Cid,
+	}
+
+	// The multiple lines message, for example, with stack trace.
+	if pos := strings.Index(e.Message, "\n"); pos >= 0 {
+		m.ShortMessage, m.FullMessage = e.Message[:pos], e.Message
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// The fields are additional fields, insert before the last }.
+	if len(e.Fields) > 0 {
+		fields := make(map[string]string, len(e.Fields))
+		for _, f := range e.Fields {
+			fields["_"+f.Key] = f.Value
+		}
+
+		var fb []byte
+		if fb, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+		b = append(append(b[:len(b)-1], ','), fb[1:]...)
+	}
+
+	if v.NullDelimiter {
+		return append(b, 0), nil
+	}
+	return append(b, '\n'), nil
+}
+
+// The syslog severity of GELF level.
+const (
+	gelfLevelError  = 3
+	gelfLevelWarn   = 4
+	gelfLevelNotice = 5
+	gelfLevelInfo   = 6
+	gelfLevelDebug  = 7
+)
+
+// Map the level to syslog severity, where trace is notice for it's above info.
+func gelfLevel(level string) int {
+	switch level {
+	case LevelError:
+		return gelfLevelError
+	case LevelWarn:
+		return gelfLevelWarn
+	case LevelTrace:
+		return gelfLevelNotice
+	case LevelInfo:
+		return gelfLevelInfo
+	default:
+		return gelfLevelDebug
+	}
+}
+
+// The logger which write the entries by formatter.
+type formatLogger struct {
+	level string
+	f     Formatter
+
+	lock sync.Mutex
+	w    io.Writer
+	// Whether write to ioutil.Discard, to ignore logs before formatting.
+	discard bool
+	// The index of level, to ignore logs lower than SetLevel.
+	rank int
+}
+
+// Create a logger of level, which write to w in the format of f.
+// For example, use GELF for error logs:
+//		logger.Error = logger.NewFormatLogger(w, logger.LevelError, logger.NewGELFFormatter())
+func NewFormatLogger(w io.Writer, level string, f Formatter) Logger {
+	return &formatLogger{w: w, level: level, f: f, discard: w == ioutil.Discard, rank: levelIndex(level)}
+}
+
+func (v *formatLogger) enabled() bool {
+	return !v.discard && levelRankEnabled(v.rank)
+}
+
+func (v *formatLogger) Println(ctx Context, a ...interface{}) {
+	if !v.enabled() {
+		return
+	}
+
+	b := getBuffer()
+	defer putBuffer(b)
+	fmt.Fprintln(b, a...)
+	v.write(ctx, strings.TrimSuffix(b.String(), "\n"))
+}
+
+func (v *formatLogger) Printf(ctx Context, format string, a ...interface{}) {
+	if !v.enabled() {
+		return
+	}
+
+	b := getBuffer()
+	defer putBuffer(b)
+	fmt.Fprintf(b, format, a...)
+	v.write(ctx, b.String())
+}
+
+func (v *formatLogger) write(ctx Context, msg string) {
+	if v.level == LevelError {
+		msg += stackTrace()
+	}
+
+	fields := GlobalFields()
+	if ctxFields := fieldsOf(ctx); len(ctxFields) > 0 {
+		// Never modify the global fields.
+		fields = append(fields[:len(fields):len(fields)], ctxFields...)
+	}
+
+	if r := redactor(); r != nil {
+		msg = r("msg", msg)
+		fields = redactFields(r, fields)
+	}
+
+	e := &Entry{Time: time.Now(), Level: v.level, Pid: os.Getpid(), Message: msg, Fields: fields}
+	e.Cid, _ = contextCid(ctx)
+
+	b, err := v.f.Format(e)
+	if err != nil {
+		return
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.w.Write(b)
+}
+
+// Set the formatter of logs, which writes to the current underlayer io, nil to use the
+// text format. For example, to write logs in JSON for ELK:
+//		logger.SetFormatter(logger.NewJSONFormatter())
+// @remark The levels write to the current underlayer io if switched, see Switch and SwitchFormat,
+//		otherwise the warn and error write to stderr and others to stdout.
+func SetFormatter(f Formatter) {
+	if switched && f == nil {
+		Switch(previousWriter)
+	} else if switched {
+		SwitchFormat(previousWriter, f)
+	} else if f == nil {
+		Debug = newLoggerPlus(os.Stdout, LevelDebug, logDebugLabel)
+		Info = newLoggerPlus(os.Stdout, LevelInfo, logInfoLabel)
+		Trace = newLoggerPlus(os.Stdout, LevelTrace, logTraceLabel)
+		Warn = newLoggerPlus(os.Stderr, LevelWarn, logWarnLabel)
+		Error = newLoggerPlus(os.Stderr, LevelError, logErrorLabel)
+	} else {
+		Debug = NewFormatLogger(os.Stdout, LevelDebug, f)
+		Info = NewFormatLogger(os.Stdout, LevelInfo, f)
+		Trace = NewFormatLogger(os.Stdout, LevelTrace, f)
+		Warn = NewFormatLogger(os.Stderr, LevelWarn, f)
+		Error = NewFormatLogger(os.Stderr, LevelError, f)
+	}
+}
+
+// Switch the underlayer io, and write logs in the format of f.
+// @remark user must close previous io for logger never close it.
+func SwitchFormat(w io.Writer, f Formatter) io.Writer {
+	Debug = NewFormatLogger(w, LevelDebug, f)
+	Info = NewFormatLogger(w, LevelInfo, f)
+	Trace = NewFormatLogger(w, LevelTrace, f)
+	Warn = NewFormatLogger(w, LevelWarn, f)
+	Error = NewFormatLogger(w, LevelError, f)
+
+	return switchWriter(w)
+}
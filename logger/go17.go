@@ -27,20 +27,32 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
 )
 
 func (v *loggerPlus) Println(ctx Context, a ...interface{}) {
+	if !v.enabled() {
+		return
+	}
+
 	args := v.contextFormat(ctx, a...)
 	v.doPrintln(args...)
 }
 
 func (v *loggerPlus) Printf(ctx Context, format string, a ...interface{}) {
+	if !v.enabled() {
+		return
+	}
+
 	format, args := v.contextFormatf(ctx, format, a...)
 	v.doPrintf(format, args...)
 }
 
 func (v *loggerPlus) contextFormat(ctx Context, a ...interface{}) []interface{} {
 	if ctx, ok := ctx.(context.Context); ok {
+		if cf, ok := ctx.Value(fieldsKey).(*contextFields); ok {
+			a = append([]interface{}{cf.prefix}, a...)
+		}
 		if cid, ok := ctx.Value(cidKey).(int); ok {
 			return append([]interface{}{fmt.Sprintf("[%v][%v]", os.Getpid(), cid)}, a...)
 		}
@@ -52,6 +64,9 @@ func (v *loggerPlus) contextFormat(ctx Context, a ...interface{}) []interface{}
 
 func (v *loggerPlus) contextFormatf(ctx Context, format string, a ...interface{}) (string, []interface{}) {
 	if ctx, ok := ctx.(context.Context); ok {
+		if cf, ok := ctx.Value(fieldsKey).(*contextFields); ok {
+			format, a = "%v "+format, append([]interface{}{cf.prefix}, a...)
+		}
 		if cid, ok := ctx.Value(cidKey).(int); ok {
 			return "[%v][%v] " + format, append([]interface{}{os.Getpid(), cid}, a...)
 		}
@@ -61,6 +76,34 @@ func (v *loggerPlus) contextFormatf(ctx Context, format string, a ...interface{}
 	return format, a
 }
 
+// The fields of context, and the prefix for text logs.
+type contextFields struct {
+	fields []Field
+	prefix string
+}
+
+// Get the fields of context, see WithFields.
+func fieldsOf(ctx Context) []Field {
+	if c, ok := ctx.(context.Context); ok {
+		if cf, ok := c.Value(fieldsKey).(*contextFields); ok {
+			return cf.fields
+		}
+	}
+	return nil
+}
+
+// Get the cid of context, which is cidContext or context.Context.
+func contextCid(ctx Context) (int, bool) {
+	if c, ok := ctx.(context.Context); ok {
+		cid, ok := c.Value(cidKey).(int)
+		return cid, ok
+	}
+	if c, ok := ctx.(cidContext); ok {
+		return c.Cid(), true
+	}
+	return 0, false
+}
+
 // User should use context with value to pass the cid.
 type key string
 
@@ -68,6 +111,35 @@ var cidKey key = "cid.logger.ossrs.org"
 
 var gCid int = 999
 
+var fieldsKey key = "fields.logger.ossrs.org"
+
+// Create context with fields, which are printed in every log of the context, for example,
+// the trace id, session id and client ip:
+//		ctx = logger.WithFields(ctx, map[string]interface{}{"trace": traceID, "ip": ip})
+//		logger.Tf(ctx, "play stream") // [pid][cid] [ip=10.0.0.1 trace=xxx] play stream
+// The fields are merged with the fields of parent, sorted by key. The logfmt, JSON
+// and GELF logs have the fields after the global fields, see SetGlobalFields.
+func WithFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Override the fields of parent.
+	var merged []Field
+	for _, f := range fieldsOf(ctx) {
+		if _, ok := fields[f.Key]; !ok {
+			merged = append(merged, f)
+		}
+	}
+	for _, k := range keys {
+		merged = append(merged, Field{k, fmt.Sprint(fields[k])})
+	}
+
+	return context.WithValue(ctx, fieldsKey, &contextFields{fields: merged, prefix: fieldsPrefix(merged)})
+}
+
 // Create context with value.
 func WithContext(ctx context.Context) context.Context {
 	gCid += 1
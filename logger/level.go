@@ -0,0 +1,73 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// The levels from the lowest to the highest.
+var levels = []string{LevelDebug, LevelInfo, LevelTrace, LevelWarn, LevelError}
+
+// The index of level in levels, -1 for unknown level which is never filtered.
+func levelIndex(level string) int {
+	for i, l := range levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// The minimum level to write logs, the index of levels, default to trace.
+var minLevel = int32(levelIndex(LevelTrace))
+
+// Set the minimum level to write logs, the logs of lower levels are ignored, for example,
+// to enable the debug logs at runtime, without reconstructing the loggers:
+//		logger.SetLevel(logger.LevelDebug)
+// The level is one of debug, info, trace, warn and error, default to trace.
+func SetLevel(level string) error {
+	i := levelIndex(strings.ToLower(level))
+	if i < 0 {
+		return fmt.Errorf("invalid level %v", level)
+	}
+
+	atomic.StoreInt32(&minLevel, int32(i))
+	return nil
+}
+
+// Get the minimum level to write logs.
+func GetLevel() string {
+	return levels[atomic.LoadInt32(&minLevel)]
+}
+
+// Whether the logs of level are written, see SetLevel.
+func LevelEnabled(level string) bool {
+	return levelRankEnabled(levelIndex(level))
+}
+
+// Whether the logs of level index are written, the unknown level is always written.
+func levelRankEnabled(rank int) bool {
+	return rank < 0 || int32(rank) >= atomic.LoadInt32(&minLevel)
+}
@@ -29,21 +29,42 @@
 //		logger.Tf(ctx, format, ...)
 //		logger.Wf(ctx, format, ...)
 //		logger.Ef(ctx, format, ...)
+// To append stack trace to error logs:
+//		logger.SetStackTrace(depth, interval)
+// To write logs in logfmt, JSON or GELF:
+//		logger.SwitchFormat(w, logger.NewLogfmtFormatter())
+//		logger.SetFormatter(logger.NewJSONFormatter())
+// To write logs to Windows Event Log:
+//		w, _ := logger.NewEventLogWriter("srs"); logger.Switch(w)
+// To include the service and hostname in logs:
+//		logger.SetGlobalFields(logger.InstanceFields("srs")...)
+// To include the trace id and client ip in logs of context, from 1.7+:
+//		ctx = logger.WithFields(ctx, map[string]interface{}{"trace": id, "ip": ip})
+// To mask the tokens and IPs in logs:
+//		logger.SetRedactor(logger.ChainRedactors(logger.RedactParams("token"), logger.RedactIPs()))
+// To write the debug and info logs at runtime:
+//		logger.SetLevel(logger.LevelDebug)
+// To avoid building the expensive args when level is discarded:
+//		if logger.Enabled(logger.Info) { logger.If(ctx, "%v", dump()) }
 // @remark the Context is optional thus can be nil.
 // @remark From 1.7+, the ctx could be context.Context, wrap by logger.WithContext,
 // 	please read ExampleLogger_ContextGO17().
 package logger
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"sync"
 )
 
 // default level for logger.
 const (
+	logDebugLabel = "[debug] "
 	logInfoLabel  = "[info] "
 	logTraceLabel = "[trace] "
 	logWarnLabel  = "[warn] "
@@ -63,10 +84,66 @@ type cidContext interface {
 // the LOG+ which provides connection-based log.
 type loggerPlus struct {
 	logger *log.Logger
+	// Whether the logger write to ioutil.Discard, to ignore logs before formatting.
+	discard bool
+	// The index of level, to ignore logs lower than SetLevel, -1 to never ignore.
+	rank int
 }
 
 func NewLoggerPlus(l *log.Logger) Logger {
-	return &loggerPlus{logger: l}
+	return &loggerPlus{logger: l, rank: -1}
+}
+
+// Create the logger plus of level write to w with label, which ignore logs directly for
+// ioutil.Discard or lower than SetLevel.
+func newLoggerPlus(w io.Writer, level, label string) Logger {
+	return &loggerPlus{
+		logger:  log.New(w, label, log.Ldate|log.Ltime|log.Lmicroseconds),
+		discard: w == ioutil.Discard,
+		rank:    levelIndex(level),
+	}
+}
+
+func (v *loggerPlus) enabled() bool {
+	return !v.discard && levelRankEnabled(v.rank)
+}
+
+// The logger which knows whether the logs are discarded.
+type leveledLogger interface {
+	enabled() bool
+}
+
+// Whether the logger l writes logs, which is not discarded and not lower than SetLevel, user can use it to avoid building the expensive args,
+// for example, the trace in media hot path:
+//		if logger.Enabled(logger.Info) {
+//			logger.If(ctx, "packet %v", hex.Dump(b))
+//		}
+// @remark The logger is enabled if unknown, for example, created by NewLoggerPlus.
+func Enabled(l Logger) bool {
+	if l, ok := l.(leveledLogger); ok {
+		return l.enabled()
+	}
+	return true
+}
+
+// The pool of buffers to format the logs, to avoid allocations in hot path.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+func putBuffer(b *bytes.Buffer) {
+	// Drop the large buffer, for example, the huge stack trace.
+	if b.Cap() <= 64*1024 {
+		bufferPool.Put(b)
+	}
 }
 
 func (v *loggerPlus) format(ctx Context, a ...interface{}) []interface{} {
@@ -92,6 +169,20 @@ var colorRed = "\033[31m"
 var colorBlack = "\033[0m"
 
 func (v *loggerPlus) doPrintln(args ...interface{}) {
+	if v == Error {
+		if s := stackTrace(); s != "" {
+			args = append(args, s)
+		}
+	}
+
+	if p := globalPrefix(); p != "" {
+		args = append([]interface{}{p}, args...)
+	}
+
+	if r := redactor(); r != nil {
+		args = []interface{}{r("msg", strings.TrimSuffix(fmt.Sprintln(args...), "\n"))}
+	}
+
 	if previousCloser == nil {
 		if v == Error {
 			fmt.Fprintf(os.Stdout, colorRed)
@@ -110,24 +201,56 @@ func (v *loggerPlus) doPrintln(args ...interface{}) {
 }
 
 func (v *loggerPlus) doPrintf(format string, args ...interface{}) {
+	if v == Error {
+		if s := stackTrace(); s != "" {
+			format, args = format+"%v", append(args, s)
+		}
+	}
+
+	if p := globalPrefix(); p != "" {
+		format, args = "%v "+format, append([]interface{}{p}, args...)
+	}
+
+	if r := redactor(); r != nil {
+		format, args = "%v", []interface{}{r("msg", fmt.Sprintf(format, args...))}
+	}
+
+	// Format in the pooled buffer, rather than the fmt.Sprintf of log.Printf.
+	b := getBuffer()
+	defer putBuffer(b)
+	fmt.Fprintf(b, format, args...)
+
 	if previousCloser == nil {
 		if v == Error {
 			fmt.Fprintf(os.Stdout, colorRed)
-			v.logger.Printf(format, args...)
+			v.logger.Output(3, b.String())
 			fmt.Fprintf(os.Stdout, colorBlack)
 		} else if v == Warn {
 			fmt.Fprintf(os.Stdout, colorYellow)
-			v.logger.Printf(format, args...)
+			v.logger.Output(3, b.String())
 			fmt.Fprintf(os.Stdout, colorBlack)
 		} else {
-			v.logger.Printf(format, args...)
+			v.logger.Output(3, b.String())
 		}
 	} else {
-		v.logger.Printf(format, args...)
+		v.logger.Output(3, b.String())
 	}
 }
 
-// Info, the verbose info level, very detail log, the lowest level, to discard.
+// Debug, the debug level, the most detail log for troubleshooting, lower than info.
+var Debug Logger
+
+// Alias for Debug level println.
+func D(ctx Context, a ...interface{}) {
+	Debug.Println(ctx, a...)
+}
+
+// Printf for Debug level log.
+func Df(ctx Context, format string, a ...interface{}) {
+	Debug.Printf(ctx, format, a...)
+}
+
+// Info, the verbose info level, very detail log, ignored by the default level trace.
 var Info Logger
 
 // Alias for Info level println.
@@ -189,46 +312,59 @@ type Logger interface {
 }
 
 func init() {
-	Info = NewLoggerPlus(log.New(ioutil.Discard, logInfoLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
-	Trace = NewLoggerPlus(log.New(os.Stdout, logTraceLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
-	Warn = NewLoggerPlus(log.New(os.Stderr, logWarnLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
-	Error = NewLoggerPlus(log.New(os.Stderr, logErrorLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
+	Debug = newLoggerPlus(os.Stdout, LevelDebug, logDebugLabel)
+	Info = newLoggerPlus(os.Stdout, LevelInfo, logInfoLabel)
+	Trace = newLoggerPlus(os.Stdout, LevelTrace, logTraceLabel)
+	Warn = newLoggerPlus(os.Stderr, LevelWarn, logWarnLabel)
+	Error = newLoggerPlus(os.Stderr, LevelError, logErrorLabel)
 
 	// init writer and closer.
 	previousWriter = os.Stdout
 	previousCloser = nil
+	switched = false
 }
 
 // Switch the underlayer io.
 // @remark user must close previous io for logger never close it.
 func Switch(w io.Writer) io.Writer {
-	// TODO: support level, default to trace here.
-	Info = NewLoggerPlus(log.New(ioutil.Discard, logInfoLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
-	Trace = NewLoggerPlus(log.New(w, logTraceLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
-	Warn = NewLoggerPlus(log.New(w, logWarnLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
-	Error = NewLoggerPlus(log.New(w, logErrorLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
+	// The level is filtered by SetLevel, default to trace.
+	Debug = newLoggerPlus(w, LevelDebug, logDebugLabel)
+	Info = newLoggerPlus(w, LevelInfo, logInfoLabel)
+	Trace = newLoggerPlus(w, LevelTrace, logTraceLabel)
+	Warn = newLoggerPlus(w, LevelWarn, logWarnLabel)
+	Error = newLoggerPlus(w, LevelError, logErrorLabel)
+
+	return switchWriter(w)
+}
+
+// The previous underlayer io for logger.
+var previousCloser io.Closer
+var previousWriter io.Writer
 
+// Whether the underlayer io is switched, or the levels write to the stdout and stderr.
+var switched bool
+
+// Update the previous underlayer io, return the previous one.
+// @remark Never close the stdout or stderr, which is not the closer.
+func switchWriter(w io.Writer) io.Writer {
 	ow := previousWriter
-	previousWriter = w
+	previousWriter, switched = w, true
 
-	if c, ok := w.(io.Closer); ok {
+	if c, ok := w.(io.Closer); ok && w != io.Writer(os.Stdout) && w != io.Writer(os.Stderr) {
 		previousCloser = c
 	}
 
 	return ow
 }
 
-// The previous underlayer io for logger.
-var previousCloser io.Closer
-var previousWriter io.Writer
-
 // The interface io.Closer
 // Cleanup the logger, discard any log util switch to fresh writer.
 func Close() (err error) {
-	Info = NewLoggerPlus(log.New(ioutil.Discard, logInfoLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
-	Trace = NewLoggerPlus(log.New(ioutil.Discard, logTraceLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
-	Warn = NewLoggerPlus(log.New(ioutil.Discard, logWarnLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
-	Error = NewLoggerPlus(log.New(ioutil.Discard, logErrorLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
+	Debug = newLoggerPlus(ioutil.Discard, LevelDebug, logDebugLabel)
+	Info = newLoggerPlus(ioutil.Discard, LevelInfo, logInfoLabel)
+	Trace = newLoggerPlus(ioutil.Discard, LevelTrace, logTraceLabel)
+	Warn = newLoggerPlus(ioutil.Discard, LevelWarn, logWarnLabel)
+	Error = newLoggerPlus(ioutil.Discard, LevelError, logErrorLabel)
 
 	if previousCloser != nil {
 		err = previousCloser.Close()
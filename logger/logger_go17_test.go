@@ -0,0 +1,79 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// +build go1.7
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLogger_WithFields(t *testing.T) {
+	b := &bytes.Buffer{}
+	ow := Switch(b)
+	defer Switch(ow)
+
+	ctx := WithFields(WithContext(context.Background()), map[string]interface{}{"trace": "abc", "session": 3})
+	ctx = WithFields(ctx, map[string]interface{}{"ip": "10.0.0.1", "session": 4})
+
+	Tf(ctx, "play %v", "livestream")
+	T(ctx, "stop")
+	if s := b.String(); !strings.Contains(s, "] [trace=abc ip=10.0.0.1 session=4] play livestream\n") ||
+		!strings.Contains(s, "] [trace=abc ip=10.0.0.1 session=4] stop\n") {
+		t.Errorf("got %v", s)
+	}
+
+	// Without cid.
+	b.Reset()
+	T(WithFields(context.Background(), map[string]interface{}{"trace": "x y"}), "stop")
+	if s := b.String(); !strings.HasSuffix(s, ` [trace="x y"] stop`+"\n") {
+		t.Errorf("got %v", s)
+	}
+
+	// The format logger, after global fields.
+	SetGlobalFields(Field{"service", "srs"})
+	defer SetGlobalFields()
+
+	b.Reset()
+	SwitchFormat(b, NewLogfmtFormatter())
+	Tf(ctx, "play")
+	if s := b.String(); !strings.Contains(s, " service=srs trace=abc ip=10.0.0.1 session=4 msg=play\n") {
+		t.Errorf("got %v", s)
+	}
+	if fields := GlobalFields(); len(fields) != 1 {
+		t.Errorf("should not modify global fields %v", fields)
+	}
+
+	// The fields of context are redacted.
+	SetRedactor(RedactParams("token"))
+	defer SetRedactor(nil)
+
+	b.Reset()
+	SwitchFormat(b, NewJSONFormatter())
+	Tf(WithFields(ctx, map[string]interface{}{"token": "xyz"}), "play")
+	if s := b.String(); !strings.Contains(s, `"session":"4","token":"***","msg":"play"}`) {
+		t.Errorf("got %v", s)
+	}
+}
@@ -21,7 +21,397 @@
 
 package logger
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestLogger(t *testing.T) {
 }
+
+func TestLogger_StackTrace(t *testing.T) {
+	b := &bytes.Buffer{}
+	ow := Switch(b)
+	defer Switch(ow)
+	defer SetStackTrace(0, 0)
+
+	SetStackTrace(3, 0)
+	Ef(nil, "error %v", 1)
+	if s := b.String(); !strings.Contains(s, "logger_test.go") {
+		t.Errorf("no stack in %v", s)
+	}
+
+	b.Reset()
+	E(nil, "error", 2)
+	if s := b.String(); !strings.Contains(s, "logger_test.go") {
+		t.Errorf("no stack in %v", s)
+	}
+
+	b.Reset()
+	Tf(nil, "trace")
+	if s := b.String(); strings.Contains(s, "logger_test.go") {
+		t.Errorf("stack in %v", s)
+	}
+
+	// Only one stack in interval.
+	SetStackTrace(3, time.Hour)
+	b.Reset()
+	Ef(nil, "error")
+	Ef(nil, "error")
+	if n := strings.Count(b.String(), "logger_test.go"); n != 1 {
+		t.Errorf("stacks %v in %v", n, b.String())
+	}
+}
+
+func TestLogger_Logfmt(t *testing.T) {
+	e := &Entry{
+		Time: time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC), Level: LevelTrace, Pid: 1, Cid: 100,
+		Message: `The "log" text.`,
+	}
+
+	b, err := NewLogfmtFormatter().Format(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, want := string(b), `time=2017-01-01T10:00:00.000000Z level=trace pid=1 cid=100 msg="The \"log\" text."`+"\n"; s != want {
+		t.Errorf("got %v, want %v", s, want)
+	}
+
+	e.Cid, e.Message = 0, "text"
+	if b, _ = NewLogfmtFormatter().Format(e); !strings.HasSuffix(string(b), "pid=1 msg=text\n") {
+		t.Errorf("got %v", string(b))
+	}
+}
+
+func TestLogger_JSON(t *testing.T) {
+	e := &Entry{
+		Time: time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC), Level: LevelTrace, Pid: 1, Cid: 100,
+		Message: "The \"log\" text.\n", Fields: []Field{{"service", "srs"}, {"pid", "2"}},
+	}
+
+	b, err := NewJSONFormatter().Format(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"time":"2017-01-01T10:00:00.000000Z","level":"trace","pid":1,"cid":100,` +
+		`"service":"srs","_pid":"2","msg":"The \"log\" text.\n"}` + "\n"
+	if s := string(b); s != want {
+		t.Errorf("got %v, want %v", s, want)
+	}
+
+	var o map[string]interface{}
+	if err := json.Unmarshal(b, &o); err != nil || o["msg"] != e.Message {
+		t.Errorf("invalid json %v, err is %v", string(b), err)
+	}
+}
+
+func TestLogger_SetFormatter(t *testing.T) {
+	b := &bytes.Buffer{}
+	ow := Switch(b)
+	defer Switch(ow)
+
+	SetFormatter(NewJSONFormatter())
+	Wf(testCid(100), "The log %v", "text")
+	if s := b.String(); !strings.HasPrefix(s, `{"time":`) || !strings.Contains(s, `"level":"warn","pid":`) ||
+		!strings.Contains(s, `"cid":100,"msg":"The log text"}`) {
+		t.Errorf("got %v", s)
+	}
+
+	b.Reset()
+	SetFormatter(nil)
+	Tf(nil, "The log %v", "text")
+	if s := b.String(); !strings.HasPrefix(s, "[trace] ") {
+		t.Errorf("got %v", s)
+	}
+}
+
+func TestLogger_SetFormatterDefault(t *testing.T) {
+	loggers := []Logger{Debug, Info, Trace, Warn, Error}
+	ow, oc, sw := previousWriter, previousCloser, switched
+	defer func() {
+		Debug, Info, Trace, Warn, Error = loggers[0], loggers[1], loggers[2], loggers[3], loggers[4]
+		previousWriter, previousCloser, switched = ow, oc, sw
+	}()
+
+	// Keep the stdout and stderr of levels, when not switched.
+	previousWriter, previousCloser, switched = os.Stdout, nil, false
+	SetFormatter(NewJSONFormatter())
+	if w := Trace.(*formatLogger).w; w != io.Writer(os.Stdout) {
+		t.Errorf("trace writes to %v", w)
+	}
+	if w := Warn.(*formatLogger).w; w != io.Writer(os.Stderr) {
+		t.Errorf("warn writes to %v", w)
+	}
+	if previousCloser != nil || switched {
+		t.Errorf("invalid closer %v, switched %v", previousCloser, switched)
+	}
+
+	// Never close the stdout.
+	SwitchFormat(os.Stdout, NewJSONFormatter())
+	if previousCloser != nil || !switched {
+		t.Errorf("invalid closer %v, switched %v", previousCloser, switched)
+	}
+}
+
+func TestLogger_GELF(t *testing.T) {
+	e := &Entry{
+		Time: time.Date(2017, 1, 1, 10, 0, 0, 5000000, time.UTC), Level: LevelError, Pid: 1,
+		Message: "The log text.\n\tlogger_test.go:10",
+	}
+
+	f := &GELFFormatter{Host: "ossrs.net", NullDelimiter: true}
+	b, err := f.Format(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"version":"1.1","host":"ossrs.net","short_message":"The log text.",` +
+		`"full_message":"The log text.\n\tlogger_test.go:10","timestamp":1483264800.005,"level":3,"_pid":1}` + "\x00"
+	if s := string(b); s != want {
+		t.Errorf("got %v, want %v", s, want)
+	}
+
+	for level, want := range map[string]int{
+		LevelDebug: 7, LevelInfo: 6, LevelTrace: 5, LevelWarn: 4, LevelError: 3,
+	} {
+		if v := gelfLevel(level); v != want {
+			t.Errorf("%v expect %v actual %v", level, want, v)
+		}
+	}
+}
+
+func TestLogger_SwitchFormat(t *testing.T) {
+	b := &bytes.Buffer{}
+	ow := SwitchFormat(b, NewLogfmtFormatter())
+	defer Switch(ow)
+
+	Tf(testCid(100), "The log %v", "text")
+	if s := b.String(); !strings.Contains(s, `level=trace`) || !strings.Contains(s, `cid=100 msg="The log text"`) {
+		t.Errorf("got %v", s)
+	}
+}
+
+type testCid int
+
+func (v testCid) Cid() int {
+	return int(v)
+}
+
+func TestLogger_Redact(t *testing.T) {
+	b := &bytes.Buffer{}
+	ow := Switch(b)
+	defer Switch(ow)
+	defer SetRedactor(nil)
+
+	SetRedactor(ChainRedactors(RedactParams("token", "key"), RedactIPs()))
+
+	Tf(nil, "play rtmp://ossrs.net/live/livestream?token=abc&KEY=xyz from %v", "192.168.1.100:1935")
+	T(nil, "client", "10.0.0.1", "token=abc")
+	if s := b.String(); strings.Contains(s, "abc") || strings.Contains(s, "xyz") || strings.Contains(s, ".100") || strings.Contains(s, ".1 ") {
+		t.Errorf("not redacted %v", s)
+	} else if !strings.Contains(s, "?token=***&KEY=*** from 192.168.1.***:1935\n") || !strings.Contains(s, "client 10.0.0.*** token=***\n") {
+		t.Errorf("invalid redacted %v", s)
+	}
+
+	if v := RedactParams("token")("token", "abc"); v != RedactMask {
+		t.Errorf("invalid field %v", v)
+	}
+}
+
+func TestLogger_RedactFields(t *testing.T) {
+	b := &bytes.Buffer{}
+	ow := SwitchFormat(b, NewJSONFormatter())
+	defer Switch(ow)
+	defer SetRedactor(nil)
+	defer SetGlobalFields()
+
+	SetRedactor(RedactParams("token"))
+	SetGlobalFields(Field{"token", "abc"}, Field{"url", "rtmp://ossrs.net/live/livestream?token=xyz"})
+
+	Tf(nil, "play token=%v", "def")
+	if s := b.String(); strings.Contains(s, "abc") || strings.Contains(s, "xyz") || strings.Contains(s, "def") {
+		t.Errorf("not redacted %v", s)
+	} else if !strings.Contains(s, `"token":"***","url":"rtmp://ossrs.net/live/livestream?token=***","msg":"play token=***"}`) {
+		t.Errorf("invalid redacted %v", s)
+	}
+
+	if fields := GlobalFields(); fields[0].Value != "abc" {
+		t.Errorf("should not modify global fields %v", fields)
+	}
+}
+
+func TestLogger_GlobalFields(t *testing.T) {
+	b := &bytes.Buffer{}
+	ow := Switch(b)
+	defer Switch(ow)
+	defer SetGlobalFields()
+
+	SetGlobalFields(Field{"service", "srs"}, Field{"region", "cn east"})
+	Tf(nil, "The log %v", "text")
+	T(nil, "The log")
+	if s := b.String(); strings.Count(s, `[service=srs region="cn east"] [`) != 2 {
+		t.Errorf("no fields in %v", s)
+	}
+
+	e := &Entry{
+		Time: time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC), Level: LevelTrace, Pid: 1,
+		Message: "text", Fields: GlobalFields(),
+	}
+	if b, _ := NewLogfmtFormatter().Format(e); !strings.HasSuffix(string(b), `pid=1 service=srs region="cn east" msg=text`+"\n") {
+		t.Errorf("got %v", string(b))
+	}
+	if b, _ := (&GELFFormatter{Host: "ossrs.net"}).Format(e); !strings.HasSuffix(string(b), `"_pid":1,"_region":"cn east","_service":"srs"}`+"\n") {
+		t.Errorf("got %v", string(b))
+	}
+
+	if fields := InstanceFields("srs", Field{"id", "1"}); len(fields) != 3 || fields[0].Value != "srs" || fields[1].Key != "host" {
+		t.Errorf("invalid fields %v", fields)
+	}
+
+	SetGlobalFields()
+	b.Reset()
+	T(nil, "The log")
+	if s := b.String(); strings.Contains(s, "service") {
+		t.Errorf("fields in %v", s)
+	}
+}
+
+func TestLogger_Enabled(t *testing.T) {
+	b := &bytes.Buffer{}
+	ow := Switch(b)
+	defer Switch(ow)
+
+	if Enabled(Info) || !Enabled(Trace) {
+		t.Errorf("invalid enabled info=%v, trace=%v", Enabled(Info), Enabled(Trace))
+	}
+
+	If(nil, "info %v", 1)
+	Tf(nil, "trace %v", 2)
+	if s := b.String(); strings.Contains(s, "info") || !strings.Contains(s, "trace 2") {
+		t.Errorf("invalid logs %v", s)
+	}
+
+	if l := NewFormatLogger(ioutil.Discard, LevelInfo, NewLogfmtFormatter()); Enabled(l) {
+		t.Error("discard format logger should be disabled")
+	}
+	if !Enabled(NewLoggerPlus(log.New(ioutil.Discard, "", 0))) {
+		t.Error("unknown logger should be enabled")
+	}
+}
+
+func TestLogger_SetLevel(t *testing.T) {
+	b := &bytes.Buffer{}
+	ow := Switch(b)
+	defer Switch(ow)
+	defer SetLevel(LevelTrace)
+
+	if GetLevel() != LevelTrace || Enabled(Debug) || Enabled(Info) {
+		t.Errorf("invalid default level %v", GetLevel())
+	}
+	if err := SetLevel("verbose"); err == nil {
+		t.Error("should fail for invalid level")
+	}
+
+	if err := SetLevel("DEBUG"); err != nil {
+		t.Fatal(err)
+	}
+	if !Enabled(Debug) || !Enabled(Info) || !LevelEnabled(LevelDebug) {
+		t.Errorf("invalid enabled debug=%v, info=%v", Enabled(Debug), Enabled(Info))
+	}
+	Df(nil, "debug %v", 1)
+	I(nil, "info", 2)
+
+	if err := SetLevel(LevelWarn); err != nil {
+		t.Fatal(err)
+	}
+	Tf(nil, "trace %v", 3)
+	Wf(nil, "warn %v", 4)
+
+	s := b.String()
+	for _, e := range []string{"[debug] ", "debug 1", "[info] ", "info 2", "warn 4"} {
+		if !strings.Contains(s, e) {
+			t.Errorf("no %v in %v", e, s)
+		}
+	}
+	if strings.Contains(s, "trace 3") {
+		t.Errorf("should ignore trace in %v", s)
+	}
+
+	// The format logger also respects the level.
+	b.Reset()
+	SwitchFormat(b, NewLogfmtFormatter())
+	I(nil, "info", 5)
+	E(nil, "error", 6)
+	if s := b.String(); strings.Contains(s, "info 5") || !strings.Contains(s, "level=error") {
+		t.Errorf("invalid logs %v", s)
+	}
+}
+
+func TestLogger_EventLogType(t *testing.T) {
+	pvs := []struct {
+		line string
+		want uint16
+	}{
+		{"[error] 2017/01/01 10:00:00.000000 [1] failed", eventLogError},
+		{"[warn] 2017/01/01 10:00:00.000000 [1] slow", eventLogWarning},
+		{"[trace] 2017/01/01 10:00:00.000000 [1] error in text", eventLogInformation},
+		{"time=2017-01-01T10:00:00.000000Z level=warn pid=1 msg=slow", eventLogWarning},
+		{`{"time":"2017-01-01T10:00:00.000000Z","level":"error","pid":1,"msg":"failed"}`, eventLogError},
+		{`{"time":"2017-01-01T10:00:00.000000Z","level":"debug","pid":1,"msg":"level=error"}`, eventLogInformation},
+		{`{"version":"1.1","host":"ossrs.net","short_message":"failed","timestamp":1483264800,"level":3,"_pid":1}`, eventLogError},
+		{`{"version":"1.1","host":"ossrs.net","short_message":"slow","timestamp":1483264800,"level":4,"_pid":1}`, eventLogWarning},
+		{`{"version":"1.1","host":"ossrs.net","short_message":"ok","timestamp":1483264800,"level":6,"_pid":1}`, eventLogInformation},
+	}
+	for _, pv := range pvs {
+		if v := eventLogType([]byte(pv.line)); v != pv.want {
+			t.Errorf("%v expect %v actual %v", pv.line, pv.want, v)
+		}
+	}
+
+	if runtime.GOOS != "windows" {
+		if _, err := NewEventLogWriter("srs"); err == nil {
+			t.Error("should fail for not windows")
+		}
+	}
+}
+
+func BenchmarkLogger_Discard(b *testing.B) {
+	ow := Switch(ioutil.Discard)
+	defer Switch(ow)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		If(nil, "packet %v size %v", i, 1024)
+	}
+}
+
+func BenchmarkLogger_Printf(b *testing.B) {
+	ow := Switch(ioutil.Discard)
+	defer Switch(ow)
+	Trace = NewLoggerPlus(log.New(ioutil.Discard, logTraceLabel, log.Ldate|log.Ltime|log.Lmicroseconds))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Tf(nil, "packet %v size %v", i, 1024)
+	}
+}
+
+func BenchmarkLogger_Logfmt(b *testing.B) {
+	ow := SwitchFormat(ioutil.Discard, NewLogfmtFormatter())
+	defer Switch(ow)
+	Trace = NewFormatLogger(&bytes.Buffer{}, LevelTrace, NewLogfmtFormatter())
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Tf(nil, "packet %v size %v", i, 1024)
+	}
+}
@@ -24,11 +24,32 @@
 package logger
 
 func (v *loggerPlus) Println(ctx Context, a ...interface{}) {
+	if !v.enabled() {
+		return
+	}
+
 	args := v.format(ctx, a...)
 	v.doPrintln(args...)
 }
 
 func (v *loggerPlus) Printf(ctx Context, format string, a ...interface{}) {
+	if !v.enabled() {
+		return
+	}
+
 	format, args := v.formatf(ctx, format, a...)
 	v.doPrintf(format, args...)
 }
+
+// Get the cid of context, which is cidContext.
+func contextCid(ctx Context) (int, bool) {
+	if ctx, ok := ctx.(cidContext); ok {
+		return ctx.Cid(), true
+	}
+	return 0, false
+}
+
+// The fields of context is only available for context.Context.
+func fieldsOf(ctx Context) []Field {
+	return nil
+}
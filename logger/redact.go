@@ -0,0 +1,113 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package logger
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The redactor to mask the sensitive data before writing, for example, the tokens,
+// stream keys and IPs, for GDPR-compliant log shipping.
+// @param key The name of field, for example, "msg" for the formatted message.
+// @return The redacted value.
+type Redactor func(key, value string) string
+
+// The redactor for all loggers.
+var redaction struct {
+	lock sync.RWMutex
+	r    Redactor
+}
+
+// Set the redactor, which is invoked on each formatted message, and each field of
+// the logfmt, JSON and GELF logs, see SetGlobalFields. Nil to disable.
+// @remark The redactor is invoked for each log, so it should be fast.
+func SetRedactor(r Redactor) {
+	redaction.lock.Lock()
+	defer redaction.lock.Unlock()
+
+	redaction.r = r
+}
+
+// Get the redactor, nil if disabled.
+func redactor() Redactor {
+	redaction.lock.RLock()
+	defer redaction.lock.RUnlock()
+
+	return redaction.r
+}
+
+// Redact the value of each field by its key, return the redacted copy of fields.
+func redactFields(r Redactor, fields []Field) []Field {
+	redacted := make([]Field, 0, len(fields))
+	for _, f := range fields {
+		redacted = append(redacted, Field{f.Key, r(f.Key, f.Value)})
+	}
+	return redacted
+}
+
+// The mask of redacted value.
+const RedactMask = "***"
+
+// Chain the redactors, the value is redacted by each redactor in order.
+func ChainRedactors(rs ...Redactor) Redactor {
+	return func(key, value string) string {
+		for _, r := range rs {
+			value = r(key, value)
+		}
+		return value
+	}
+}
+
+// Mask the value of parameters in message, for example, the token=xxx in query
+// or logfmt, or the field of name. The names are case-insensitive.
+// For example, RedactParams("token", "key") masks:
+//		rtmp://ossrs.net/live/livestream?token=xxx&key=yyy
+// to:
+//		rtmp://ossrs.net/live/livestream?token=***&key=***
+func RedactParams(names ...string) Redactor {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, regexp.QuoteMeta(name))
+	}
+	re := regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)=("[^"]*"|[^&\s"',]+)`)
+
+	return func(key, value string) string {
+		for _, name := range names {
+			if strings.EqualFold(key, name) {
+				return RedactMask
+			}
+		}
+		return re.ReplaceAllString(value, "${1}="+RedactMask)
+	}
+}
+
+// The IPv4 address.
+var ipv4Regexp = regexp.MustCompile(`\b(\d{1,3}\.\d{1,3}\.\d{1,3})\.\d{1,3}\b`)
+
+// Mask the last octet of IPv4 addresses, for example, 192.168.1.100 to 192.168.1.***
+func RedactIPs() Redactor {
+	return func(key, value string) string {
+		return ipv4Regexp.ReplaceAllString(value, "${1}."+RedactMask)
+	}
+}
@@ -0,0 +1,113 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package logger
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The config of stack trace for error level.
+var stack struct {
+	lock sync.Mutex
+	// The max frames of stack, 0 to disable.
+	depth int
+	// The min interval between two stacks, to limit the rate.
+	interval time.Duration
+	// The last time to print stack.
+	last time.Time
+}
+
+// Append the abbreviated stack trace to the log of E and Ef, for the sporadic errors.
+// @param depth The max frames of stack, 0 to disable it, which is the default.
+// @param interval At most one stack in interval, because the stack is expensive, 0 for no limit.
+func SetStackTrace(depth int, interval time.Duration) {
+	stack.lock.Lock()
+	defer stack.lock.Unlock()
+
+	stack.depth, stack.interval = depth, interval
+	stack.last = time.Time{}
+}
+
+// Get the stack of caller, return empty string if disabled or throttled.
+func stackTrace() string {
+	depth := func() int {
+		stack.lock.Lock()
+		defer stack.lock.Unlock()
+
+		if stack.depth <= 0 {
+			return 0
+		}
+
+		now := time.Now()
+		if stack.interval > 0 && now.Sub(stack.last) < stack.interval {
+			return 0
+		}
+		stack.last = now
+
+		return stack.depth
+	}()
+
+	if depth <= 0 {
+		return ""
+	}
+
+	// Ignore the frames of runtime.Callers and stackTrace.
+	pcs := make([]uintptr, depth+16)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+
+	var frames []string
+	for _, pc := range pcs {
+		f := runtime.FuncForPC(pc - 1)
+		if f == nil {
+			continue
+		}
+
+		name := f.Name()
+		if strings.HasPrefix(name, "github.com/ossrs/go-oryx-lib/logger.(*loggerPlus).") ||
+			strings.HasPrefix(name, "github.com/ossrs/go-oryx-lib/logger.(*formatLogger).") ||
+			name == "github.com/ossrs/go-oryx-lib/logger.E" || name == "github.com/ossrs/go-oryx-lib/logger.Ef" {
+			continue
+		}
+
+		// Abbreviate the package path and file path.
+		if pos := strings.LastIndex(name, "/"); pos >= 0 {
+			name = name[pos+1:]
+		}
+		file, line := f.FileLine(pc - 1)
+		if pos := strings.LastIndex(file, "/"); pos >= 0 {
+			file = file[pos+1:]
+		}
+
+		if frames = append(frames, fmt.Sprintf("\t%v %v:%v", name, file, line)); len(frames) >= depth {
+			break
+		}
+	}
+
+	if len(frames) == 0 {
+		return ""
+	}
+	return "\n" + strings.Join(frames, "\n")
+}
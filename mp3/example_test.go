@@ -0,0 +1,48 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mp3_test
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/mp3"
+)
+
+func ExampleDecode() {
+	var data []byte // Read MP3 frames from file or network.
+	data = append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...)
+
+	for len(data) > 0 {
+		header, frame, left, err := mp3.Decode(data)
+		if err != nil {
+			fmt.Println(fmt.Sprintf("APP: MP3 decode failed, err is %+v", err))
+			return
+		}
+		data = left
+
+		fmt.Println(header.Version, header.Layer, header.ChannelMode)
+		fmt.Println(header.Bitrate, "kbps", header.SampleRate, "Hz", len(frame), "bytes")
+	}
+
+	// Output:
+	// MPEG-1 LayerIII JointStereo
+	// 128 kbps 44100 Hz 417 bytes
+}
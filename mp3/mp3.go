@@ -0,0 +1,314 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx MP3 package, to parse the MPEG audio frame header of MP3.
+package mp3
+
+import (
+	"github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The MPEG audio version.
+// Refer to @doc ISO_IEC_11172-3-MP3-1993.pdf, @page 22, @section 2.4.2.3 Header
+// @remark The MPEG-2.5 is an unofficial extension for low sample rates.
+type Version uint8
+
+const (
+	Version2_5      Version = iota // 0 = MPEG-2.5
+	VersionReserved                // 1 = reserved
+	Version2                       // 2 = MPEG-2, ISO/IEC 13818-3
+	Version1                       // 3 = MPEG-1, ISO/IEC 11172-3
+	VersionForbidden
+)
+
+func (v Version) String() string {
+	switch v {
+	case Version2_5:
+		return "MPEG-2.5"
+	case Version2:
+		return "MPEG-2"
+	case Version1:
+		return "MPEG-1"
+	default:
+		return "Forbidden"
+	}
+}
+
+// The MPEG audio layer, where MP3 is the Layer III.
+type Layer uint8
+
+const (
+	LayerReserved Layer = iota // 0 = reserved
+	Layer3                     // 1 = Layer III
+	Layer2                     // 2 = Layer II
+	Layer1                     // 3 = Layer I
+	LayerForbidden
+)
+
+func (v Layer) String() string {
+	switch v {
+	case Layer3:
+		return "LayerIII"
+	case Layer2:
+		return "LayerII"
+	case Layer1:
+		return "LayerI"
+	default:
+		return "Forbidden"
+	}
+}
+
+// The channel mode of MPEG audio.
+type ChannelMode uint8
+
+const (
+	ChannelModeStereo      ChannelMode = iota // 0 = stereo
+	ChannelModeJointStereo                    // 1 = joint stereo
+	ChannelModeDualChannel                    // 2 = dual channel
+	ChannelModeMono                           // 3 = single channel
+	ChannelModeForbidden
+)
+
+func (v ChannelMode) String() string {
+	switch v {
+	case ChannelModeStereo:
+		return "Stereo"
+	case ChannelModeJointStereo:
+		return "JointStereo"
+	case ChannelModeDualChannel:
+		return "DualChannel"
+	case ChannelModeMono:
+		return "Mono"
+	default:
+		return "Forbidden"
+	}
+}
+
+// The number of channels, 1 for mono, otherwise 2.
+func (v ChannelMode) Channels() int {
+	if v == ChannelModeMono {
+		return 1
+	}
+	return 2
+}
+
+// The bitrate in kbps of Layer III, by version and bitrate_index, where 0 is free format.
+var bitrates = map[Version][15]int{
+	Version1:   {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	Version2:   {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	Version2_5: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// The sample rate in Hz, by version and sampling_frequency.
+var sampleRates = map[Version][3]int{
+	Version1:   {44100, 48000, 32000},
+	Version2:   {22050, 24000, 16000},
+	Version2_5: {11025, 12000, 8000},
+}
+
+// The size of frame header in bytes.
+const HeaderSize = 4
+
+// The header of MPEG audio frame, only Layer III is supported.
+// Refer to @doc ISO_IEC_11172-3-MP3-1993.pdf, @page 22, @section 2.4.1.3 Header
+type FrameHeader struct {
+	Version Version
+	Layer   Layer
+	// Whether there is a 16bits CRC after header, the protection_bit is 0.
+	Protected bool
+	// The bitrate in kbps.
+	Bitrate int
+	// The sample rate in Hz.
+	SampleRate int
+	// Whether the frame contains an additional slot.
+	Padding     bool
+	Private     bool
+	ChannelMode ChannelMode
+	ModeExt     uint8
+	Copyright   bool
+	Original    bool
+	Emphasis    uint8
+}
+
+func NewFrameHeader() *FrameHeader {
+	return &FrameHeader{}
+}
+
+// The number of PCM samples per channel of frame.
+func (v *FrameHeader) Samples() int {
+	if v.Version == Version1 {
+		return 1152
+	}
+	return 576
+}
+
+// The size of frame in bytes, including the header.
+func (v *FrameHeader) FrameSize() int {
+	// Refer to @doc ISO_IEC_11172-3-MP3-1993.pdf, @page 23, @section 2.4.3.1 Audio sequence general
+	// For Layer III, a slot is a byte, and frame is Samples/8 slots per bit of bitrate.
+	size := v.Samples() / 8 * v.Bitrate * 1000 / v.SampleRate
+	if v.Padding {
+		size++
+	}
+	return size
+}
+
+func (v *FrameHeader) validate() (err error) {
+	if _, ok := sampleRates[v.Version]; !ok {
+		return errors.Errorf("invalid version %v", uint8(v.Version))
+	}
+	if v.Layer != Layer3 {
+		return errors.Errorf("unsupported layer %v", v.Layer)
+	}
+	if v.ChannelMode >= ChannelModeForbidden {
+		return errors.Errorf("invalid channel mode %v", uint8(v.ChannelMode))
+	}
+	if v.bitrateIndex() <= 0 {
+		return errors.Errorf("invalid bitrate %v for %v", v.Bitrate, v.Version)
+	}
+	if v.sampleRateIndex() < 0 {
+		return errors.Errorf("invalid sample-rate %v for %v", v.SampleRate, v.Version)
+	}
+	return
+}
+
+func (v *FrameHeader) bitrateIndex() int {
+	for i, bitrate := range bitrates[v.Version] {
+		if bitrate == v.Bitrate {
+			return i
+		}
+	}
+	return -1
+}
+
+func (v *FrameHeader) sampleRateIndex() int {
+	for i, sampleRate := range sampleRates[v.Version] {
+		if sampleRate == v.SampleRate {
+			return i
+		}
+	}
+	return -1
+}
+
+func (v *FrameHeader) UnmarshalBinary(data []byte) (err error) {
+	// Refer to @doc ISO_IEC_11172-3-MP3-1993.pdf, @page 22, @section 2.4.1.3 Header
+	//
+	// syncword, 11bits, all 1, the MPEG-2.5 uses the last bit of 12bits syncword.
+	// ID, 2bits, the version.
+	// layer, 2bits.
+	// protection_bit, 1bit.
+	// bitrate_index, 4bits.
+	// sampling_frequency, 2bits.
+	// padding_bit, 1bit.
+	// private_bit, 1bit.
+	// mode, 2bits.
+	// mode_extension, 2bits.
+	// copyright, 1bit.
+	// original/home, 1bit.
+	// emphasis, 2bits.
+	if len(data) < HeaderSize {
+		return errors.Errorf("requires %v but only %v bytes", HeaderSize, len(data))
+	}
+
+	if data[0] != 0xff || (data[1]&0xe0) != 0xe0 {
+		return errors.Errorf("invalid syncword %#x", uint16(data[0])<<3|uint16(data[1]>>5))
+	}
+
+	*v = FrameHeader{
+		Version:     Version((data[1] >> 3) & 0x03),
+		Layer:       Layer((data[1] >> 1) & 0x03),
+		Protected:   (data[1] & 0x01) == 0,
+		Padding:     ((data[2] >> 1) & 0x01) == 1,
+		Private:     (data[2] & 0x01) == 1,
+		ChannelMode: ChannelMode((data[3] >> 6) & 0x03),
+		ModeExt:     (data[3] >> 4) & 0x03,
+		Copyright:   ((data[3] >> 3) & 0x01) == 1,
+		Original:    ((data[3] >> 2) & 0x01) == 1,
+		Emphasis:    data[3] & 0x03,
+	}
+
+	if _, ok := sampleRates[v.Version]; !ok {
+		return errors.Errorf("invalid version %v", uint8(v.Version))
+	}
+
+	bitrateIndex, sampleRateIndex := int(data[2]>>4), int((data[2]>>2)&0x03)
+	if bitrateIndex == 0 || bitrateIndex == 0x0f {
+		return errors.Errorf("unsupported bitrate index %v", bitrateIndex)
+	}
+	if sampleRateIndex == 0x03 {
+		return errors.Errorf("invalid sample-rate index %v", sampleRateIndex)
+	}
+
+	v.Bitrate = bitrates[v.Version][bitrateIndex]
+	v.SampleRate = sampleRates[v.Version][sampleRateIndex]
+
+	return v.validate()
+}
+
+func (v *FrameHeader) MarshalBinary() (data []byte, err error) {
+	if err = v.validate(); err != nil {
+		return
+	}
+
+	b1 := byte(0xe0) | byte(v.Version)<<3 | byte(v.Layer)<<1
+	if !v.Protected {
+		b1 |= 0x01
+	}
+
+	b2 := byte(v.bitrateIndex())<<4 | byte(v.sampleRateIndex())<<2
+	if v.Padding {
+		b2 |= 0x02
+	}
+	if v.Private {
+		b2 |= 0x01
+	}
+
+	b3 := byte(v.ChannelMode)<<6 | (v.ModeExt&0x03)<<4 | v.Emphasis&0x03
+	if v.Copyright {
+		b3 |= 0x08
+	}
+	if v.Original {
+		b3 |= 0x04
+	}
+
+	return []byte{0xff, b1, b2, b3}, nil
+}
+
+// Decode the first frame from data, which must start with a frame header.
+// @remark The frame includes the header and refers to the data, never copied.
+// @remark When left if not nil, user must decode it again.
+func Decode(data []byte) (header *FrameHeader, frame, left []byte, err error) {
+	header = NewFrameHeader()
+	if err = header.UnmarshalBinary(data); err != nil {
+		return nil, nil, nil, errors.WithMessage(err, "mp3 decode")
+	}
+
+	size := header.FrameSize()
+	if len(data) < size {
+		return nil, nil, nil, errors.Errorf("requires %v but only %v bytes", size, len(data))
+	}
+
+	frame = data[:size]
+	if len(data) > size {
+		left = data[size:]
+	}
+	return
+}
@@ -0,0 +1,114 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mp3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameHeader_UnmarshalBinary(t *testing.T) {
+	h := NewFrameHeader()
+
+	if err := h.UnmarshalBinary(nil); err == nil {
+		t.Error("unmarshal")
+	}
+	if err := h.UnmarshalBinary([]byte{0xff, 0x0b, 0x90, 0x64}); err == nil {
+		t.Error("should fail for syncword")
+	}
+	if err := h.UnmarshalBinary([]byte{0xff, 0xeb, 0x90, 0x64}); err == nil {
+		t.Error("should fail for reserved version")
+	}
+	if err := h.UnmarshalBinary([]byte{0xff, 0xfd, 0x90, 0x64}); err == nil {
+		t.Error("should fail for Layer II")
+	}
+	if err := h.UnmarshalBinary([]byte{0xff, 0xfb, 0x00, 0x64}); err == nil {
+		t.Error("should fail for free format")
+	}
+	if err := h.UnmarshalBinary([]byte{0xff, 0xfb, 0x9c, 0x64}); err == nil {
+		t.Error("should fail for sample rate")
+	}
+
+	if err := h.UnmarshalBinary([]byte{0xff, 0xfb, 0x90, 0x64}); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if h.Version != Version1 || h.Layer != Layer3 || h.Protected || h.Bitrate != 128 || h.SampleRate != 44100 ||
+		h.Padding || h.ChannelMode != ChannelModeJointStereo || h.ModeExt != 2 || !h.Original {
+		t.Errorf("invalid header %+v", h)
+	}
+	if h.Samples() != 1152 || h.FrameSize() != 417 {
+		t.Errorf("invalid samples %v or size %v", h.Samples(), h.FrameSize())
+	}
+
+	// The MPEG-2 Layer III, 64kbps, 22.05kHz, mono, padding, with CRC.
+	if err := h.UnmarshalBinary([]byte{0xff, 0xf2, 0x82, 0xc0}); err != nil {
+		t.Fatalf("unmarshal failed %+v", err)
+	}
+	if h.Version != Version2 || !h.Protected || h.Bitrate != 64 || h.SampleRate != 22050 || !h.Padding ||
+		h.ChannelMode.Channels() != 1 {
+		t.Errorf("invalid header %+v", h)
+	}
+	if h.Samples() != 576 || h.FrameSize() != 209 {
+		t.Errorf("invalid samples %v or size %v", h.Samples(), h.FrameSize())
+	}
+}
+
+func TestFrameHeader_MarshalBinary(t *testing.T) {
+	h := &FrameHeader{Version: Version1, Layer: Layer3, Bitrate: 100, SampleRate: 44100}
+	if _, err := h.MarshalBinary(); err == nil {
+		t.Error("should fail for bitrate")
+	}
+
+	for _, b := range [][]byte{
+		{0xff, 0xfb, 0x90, 0x64},
+		{0xff, 0xf2, 0x82, 0xc0},
+		{0xff, 0xe3, 0x18, 0xc4},
+	} {
+		if err := h.UnmarshalBinary(b); err != nil {
+			t.Fatalf("unmarshal failed %+v", err)
+		}
+		if v, err := h.MarshalBinary(); err != nil || !bytes.Equal(v, b) {
+			t.Errorf("marshal %x, %+v", v, err)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	frame := append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...)
+	data := append(append([]byte{}, frame...), frame...)
+
+	h, f, left, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Bitrate != 128 || len(f) != len(frame) || len(left) != len(frame) {
+		t.Errorf("invalid frame %v %v", len(f), len(left))
+	}
+
+	if _, f, left, err = Decode(left); err != nil || len(f) != len(frame) || left != nil {
+		t.Errorf("invalid last frame %v %v %+v", len(f), len(left), err)
+	}
+
+	if _, _, _, err = Decode(frame[:100]); err == nil {
+		t.Error("should fail for truncated frame")
+	}
+}
@@ -0,0 +1,736 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx mp4 package, the MP4 demuxer to read the AVC and AAC samples, and the fMP4
+// muxer to write the init segment and fragments.
+package mp4
+
+import (
+	"encoding/binary"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+	"sort"
+	"time"
+)
+
+// The handler type of track.
+// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 37, @section 8.4.3 Handler Reference Box
+const (
+	HandlerVideo = "vide"
+	HandlerAudio = "soun"
+)
+
+// The codec of track, the type of sample entry.
+const (
+	CodecAVC = "avc1"
+	CodecAAC = "mp4a"
+)
+
+// The track of MP4, parsed from the trak box.
+type Track struct {
+	// The track id, in tkhd.
+	ID uint32
+	// The handler type, for example, HandlerVideo or HandlerAudio.
+	Handler string
+	// The codec, the type of sample entry, for example, CodecAVC or CodecAAC.
+	Codec string
+	// The timescale and duration, in mdhd.
+	Timescale uint32
+	Duration  uint64
+	// The size of picture for video track.
+	Width, Height uint16
+	// The decoder config, the AVCDecoderConfigurationRecord for AVC, the
+	// AudioSpecificConfig for AAC.
+	Config []byte
+	// The edit list in edts, nil if no edit, for example, to skip the encoder delay of AAC
+	// by aac.Gapless.EditList.
+	EditList *EditList
+	// The samples, parsed from the sample table.
+	samples []*sampleEntry
+}
+
+// Convert the time in timescale to ms.
+func (v *Track) toMs(t int64) int64 {
+	if v.Timescale == 0 {
+		return t
+	}
+	return t * 1000 / int64(v.Timescale)
+}
+
+// Convert the DTS in timescale to ms of presentation, where the media before the start of edit
+// list is at 0, for example, the priming samples of AAC.
+func (v *Track) presentationMs(dts uint64) int64 {
+	t := int64(dts)
+	if v.EditList != nil {
+		t -= v.EditList.MediaTime
+	}
+	if t < 0 {
+		t = 0
+	}
+	return v.toMs(t)
+}
+
+// The edit of track, which maps the presentation to the media, only one edit is supported.
+// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 36, @section 8.6.6 Edit List Box
+type EditList struct {
+	// The start time of media to present, in timescale of track, for example, the encoder delay.
+	MediaTime int64
+	// The duration to present, in timescale of track, 0 for all media after MediaTime.
+	Duration uint64
+}
+
+// The sample in sample table.
+type sampleEntry struct {
+	track    *Track
+	offset   int64
+	size     uint32
+	dts      uint64
+	cts      int32
+	keyframe bool
+}
+
+// The sample of track, for example, the AVC frame in AVCC or AAC raw frame.
+type Sample struct {
+	// The track of sample.
+	Track *Track
+	// The DTS and the composition offset, in timescale of track.
+	DTS uint64
+	CTS int32
+	// Whether the sample is sync sample, for example, the IDR frame.
+	Keyframe bool
+	// The data of sample.
+	Data []byte
+}
+
+// The DTS in ms, starts from the MediaTime of edit list if there is one.
+func (v *Sample) Timestamp() uint32 {
+	return uint32(v.Track.presentationMs(v.DTS))
+}
+
+// The composition offset in ms, where pts = dts + cts.
+func (v *Sample) CompositionTime() int32 {
+	return int32(v.Track.toMs(int64(v.CTS)))
+}
+
+// The Demuxer reads the moov of MP4, then reads the samples of all tracks in order of DTS.
+// @remark The fragmented MP4 is not supported.
+type Demuxer struct {
+	// The tracks parsed from moov.
+	Tracks []*Track
+	// The timescale and duration of movie, in mvhd.
+	Timescale uint32
+	Duration  uint64
+
+	r io.ReadSeeker
+	// The size of file, to check the sample table.
+	size int64
+	// The samples of all tracks, in order of DTS.
+	samples []*sampleEntry
+	// The index of next sample.
+	pos int
+}
+
+// Create a demuxer and read the moov of r.
+func NewDemuxer(r io.ReadSeeker) (v *Demuxer, err error) {
+	v = &Demuxer{r: r}
+
+	var moov []byte
+	if moov, err = v.readMoov(); err != nil {
+		return nil, oe.WithMessage(err, "read moov")
+	}
+
+	if err = v.parseMoov(moov); err != nil {
+		return nil, oe.WithMessage(err, "parse moov")
+	}
+
+	for _, t := range v.Tracks {
+		v.samples = append(v.samples, t.samples...)
+	}
+	sort.Stable(samplesByDTS(v.samples))
+
+	return
+}
+
+// The duration of movie.
+func (v *Demuxer) DurationTime() time.Duration {
+	if v.Timescale == 0 {
+		return 0
+	}
+	return time.Duration(v.Duration) * time.Second / time.Duration(v.Timescale)
+}
+
+// Get the track of handler, nil if not found.
+func (v *Demuxer) Track(handler string) *Track {
+	for _, t := range v.Tracks {
+		if t.Handler == handler {
+			return t
+		}
+	}
+	return nil
+}
+
+// Read the next sample, io.EOF when no more samples.
+func (v *Demuxer) ReadSample() (s *Sample, err error) {
+	if v.pos >= len(v.samples) {
+		return nil, io.EOF
+	}
+
+	e := v.samples[v.pos]
+	v.pos++
+
+	if _, err = v.r.Seek(e.offset, seekStart); err != nil {
+		return nil, oe.Wrapf(err, "seek to %v", e.offset)
+	}
+
+	s = &Sample{Track: e.track, DTS: e.dts, CTS: e.cts, Keyframe: e.keyframe}
+	s.Data = make([]byte, e.size)
+	if _, err = io.ReadFull(v.r, s.Data); err != nil {
+		return nil, oe.Wrapf(err, "read sample %vB at %v", e.size, e.offset)
+	}
+
+	return
+}
+
+// Rewind to the first sample, for example, to loop the file.
+func (v *Demuxer) Rewind() {
+	v.pos = 0
+}
+
+// Read the top level boxes until the moov, skip others such as mdat.
+func (v *Demuxer) readMoov() (moov []byte, err error) {
+	if v.size, err = v.r.Seek(0, seekEnd); err != nil {
+		return nil, oe.Wrap(err, "seek to end")
+	}
+
+	if _, err = v.r.Seek(0, seekStart); err != nil {
+		return nil, oe.Wrap(err, "seek to start")
+	}
+
+	for {
+		b := make([]byte, 8)
+		if _, err = io.ReadFull(v.r, b); err != nil {
+			return nil, oe.Wrap(err, "read box header")
+		}
+
+		size, boxType, headerSize := uint64(binary.BigEndian.Uint32(b)), string(b[4:8]), uint64(8)
+		if size == 1 {
+			if _, err = io.ReadFull(v.r, b); err != nil {
+				return nil, oe.Wrap(err, "read large size")
+			}
+			size, headerSize = binary.BigEndian.Uint64(b), 16
+		} else if size == 0 {
+			return nil, oe.Errorf("no moov before %v", boxType)
+		}
+
+		if size < headerSize {
+			return nil, oe.Errorf("invalid box %v size %v", boxType, size)
+		}
+
+		// The box should not exceed the file, for example, the corrupt largesize.
+		var pos int64
+		if pos, err = v.r.Seek(0, seekCurrent); err != nil {
+			return nil, oe.Wrap(err, "tell")
+		}
+		if size-headerSize > uint64(v.size-pos) {
+			return nil, oe.Errorf("box %v size %v exceed %v", boxType, size, v.size-pos)
+		}
+
+		if boxType != "moov" {
+			if _, err = v.r.Seek(int64(size-headerSize), seekCurrent); err != nil {
+				return nil, oe.Wrapf(err, "skip %v", boxType)
+			}
+			continue
+		}
+
+		moov = make([]byte, size-headerSize)
+		if _, err = io.ReadFull(v.r, moov); err != nil {
+			return nil, oe.Wrap(err, "read moov")
+		}
+		return
+	}
+}
+
+func (v *Demuxer) parseMoov(moov []byte) (err error) {
+	return forEachBox(moov, func(boxType string, p []byte) (err error) {
+		switch boxType {
+		case "mvhd":
+			v.Timescale, v.Duration, err = parseTimescaleDuration(p, 12)
+			return
+		case "trak":
+			t := &Track{}
+			if err = t.parse(p, v.size, v.Timescale); err != nil {
+				return oe.WithMessage(err, "parse trak")
+			}
+
+			// Ignore the tracks which is not AVC or AAC, for example, the hint track.
+			if t.Codec == CodecAVC || t.Codec == CodecAAC {
+				v.Tracks = append(v.Tracks, t)
+			}
+		}
+		return
+	})
+}
+
+// Parse the trak box, which contains tkhd, edts and mdia, in the file of size, the timescale
+// is of movie, for the segment_duration of elst.
+func (v *Track) parse(trak []byte, size int64, timescale uint32) (err error) {
+	var stbl, elst []byte
+
+	err = forEachBox(trak, func(boxType string, p []byte) (err error) {
+		switch boxType {
+		case "tkhd":
+			if len(p) < 1 {
+				return oe.New("tkhd too short")
+			}
+			offset := 12
+			if p[0] == 1 {
+				offset = 20
+			}
+			if len(p) < offset+4 {
+				return oe.Errorf("tkhd too short %v", len(p))
+			}
+			v.ID = binary.BigEndian.Uint32(p[offset:])
+		case "edts":
+			return forEachBox(p, func(boxType string, p []byte) error {
+				if boxType == "elst" {
+					elst = p
+				}
+				return nil
+			})
+		case "mdia":
+			return forEachBox(p, func(boxType string, p []byte) error {
+				switch boxType {
+				case "mdhd":
+					v.Timescale, v.Duration, err = parseTimescaleDuration(p, 12)
+					return err
+				case "hdlr":
+					// The version, flags and pre_defined, then handler_type.
+					if len(p) < 12 {
+						return oe.Errorf("hdlr too short %v", len(p))
+					}
+					v.Handler = string(p[8:12])
+				case "minf":
+					return forEachBox(p, func(boxType string, p []byte) error {
+						if boxType == "stbl" {
+							stbl = p
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	if stbl == nil {
+		return oe.Errorf("no stbl of track %v", v.ID)
+	}
+
+	if elst != nil {
+		if v.EditList, err = parseEditList(elst, timescale, v.Timescale); err != nil {
+			return oe.WithMessage(err, "parse elst")
+		}
+	}
+
+	return v.parseSampleTable(stbl, size)
+}
+
+// Parse the sample table, to build the samples, which never exceed the file of size.
+// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 40, @section 8.5 Sample Tables
+func (v *Track) parseSampleTable(stbl []byte, size int64) (err error) {
+	var stts, ctts, stsc, stsz, stss [][]uint32
+	var sampleSize uint32
+	var chunkOffsets []uint64
+	var hasStss bool
+
+	err = forEachBox(stbl, func(boxType string, p []byte) (err error) {
+		switch boxType {
+		case "stsd":
+			return v.parseSampleDescription(p)
+		case "stts":
+			stts, err = parseTable(p, 0, 2)
+		case "ctts":
+			ctts, err = parseTable(p, 0, 2)
+		case "stsc":
+			stsc, err = parseTable(p, 0, 3)
+		case "stss":
+			hasStss = true
+			stss, err = parseTable(p, 0, 1)
+		case "stsz":
+			// The sample_size, then sample_count and entries if sample_size is 0.
+			if len(p) < 12 {
+				return oe.Errorf("stsz too short %v", len(p))
+			}
+			if sampleSize = binary.BigEndian.Uint32(p[4:]); sampleSize == 0 {
+				stsz, err = parseTable(p, 4, 1)
+			} else {
+				// The samples of the same size, which should be in the file.
+				count := binary.BigEndian.Uint32(p[8:])
+				if uint64(count)*uint64(sampleSize) > uint64(size) {
+					return oe.Errorf("stsz %v samples of %vB exceed %vB", count, sampleSize, size)
+				}
+				stsz = make([][]uint32, count)
+			}
+		case "stco":
+			var entries [][]uint32
+			if entries, err = parseTable(p, 0, 1); err == nil {
+				for _, e := range entries {
+					chunkOffsets = append(chunkOffsets, uint64(e[0]))
+				}
+			}
+		case "co64":
+			var entries [][]uint32
+			if entries, err = parseTable(p, 0, 2); err == nil {
+				for _, e := range entries {
+					chunkOffsets = append(chunkOffsets, uint64(e[0])<<32|uint64(e[1]))
+				}
+			}
+		}
+		return
+	})
+	if err != nil {
+		return oe.WithMessage(err, "parse stbl")
+	}
+
+	// Build the samples by chunks, the sample_size is shared if not 0.
+	v.samples = make([]*sampleEntry, len(stsz))
+	for i := range v.samples {
+		s := &sampleEntry{track: v, size: sampleSize, keyframe: !hasStss}
+		if sampleSize == 0 {
+			s.size = stsz[i][0]
+		}
+		v.samples[i] = s
+	}
+
+	// The sample_number of stss is 1-based.
+	for _, e := range stss {
+		if n := int(e[0]) - 1; n >= 0 && n < len(v.samples) {
+			v.samples[n].keyframe = true
+		}
+	}
+
+	// The first_chunk of stsc is 1-based, the last entry applies to all remaining chunks.
+	var n int
+	for i, e := range stsc {
+		if e[0] < 1 || uint64(e[0]) > uint64(len(chunkOffsets)) || (i > 0 && e[0] <= stsc[i-1][0]) {
+			return oe.Errorf("track %v stsc %v first chunk %v of %v chunks", v.ID, i, e[0], len(chunkOffsets))
+		}
+
+		first, last := int(e[0])-1, len(chunkOffsets)
+		if i < len(stsc)-1 {
+			last = int(stsc[i+1][0]) - 1
+		}
+
+		for chunk := first; chunk < last && chunk < len(chunkOffsets); chunk++ {
+			offset := int64(chunkOffsets[chunk])
+			for j := 0; j < int(e[1]) && n < len(v.samples); j++ {
+				v.samples[n].offset = offset
+				offset += int64(v.samples[n].size)
+				n++
+			}
+		}
+	}
+	if n != len(v.samples) {
+		return oe.Errorf("track %v chunks has %v samples, expect %v", v.ID, n, len(v.samples))
+	}
+
+	// The delta of DTS in stts, and the composition offset in ctts, which is signed for
+	// version 1 and generally for version 0.
+	var dts uint64
+	n = 0
+	for _, e := range stts {
+		for j := 0; j < int(e[0]) && n < len(v.samples); j++ {
+			v.samples[n].dts = dts
+			dts += uint64(e[1])
+			n++
+		}
+	}
+
+	n = 0
+	for _, e := range ctts {
+		for j := 0; j < int(e[0]) && n < len(v.samples); j++ {
+			v.samples[n].cts = int32(e[1])
+			n++
+		}
+	}
+
+	return
+}
+
+// Parse the sample description, only the first entry is used.
+func (v *Track) parseSampleDescription(stsd []byte) (err error) {
+	// The version, flags and entry_count.
+	if len(stsd) < 8 {
+		return oe.Errorf("stsd too short %v", len(stsd))
+	}
+
+	return forEachBox(stsd[8:], func(boxType string, p []byte) error {
+		if v.Codec != "" {
+			return nil
+		}
+
+		// The reserved and data_reference_index of SampleEntry, then the VisualSampleEntry
+		// or AudioSampleEntry, follows by the child boxes.
+		var children []byte
+		switch boxType {
+		case "avc1", "avc3":
+			if len(p) < 78 {
+				return oe.Errorf("%v too short %v", boxType, len(p))
+			}
+			v.Codec = CodecAVC
+			v.Width, v.Height = binary.BigEndian.Uint16(p[24:]), binary.BigEndian.Uint16(p[26:])
+			children = p[78:]
+		case "mp4a":
+			if len(p) < 28 {
+				return oe.Errorf("%v too short %v", boxType, len(p))
+			}
+			v.Codec = CodecAAC
+			children = p[28:]
+		default:
+			v.Codec = boxType
+			return nil
+		}
+
+		return forEachBox(children, func(boxType string, p []byte) (err error) {
+			switch boxType {
+			case "avcC":
+				v.Config = append([]byte{}, p...)
+			case "esds":
+				// The version and flags, then the ES_Descriptor.
+				if len(p) < 4 {
+					return oe.Errorf("esds too short %v", len(p))
+				}
+				v.Config, err = parseDecoderSpecificInfo(p[4:])
+			}
+			return
+		})
+	})
+}
+
+// The descriptors of ES_Descriptor.
+// Please read @doc ISO_IEC_14496-1-System-2010.pdf, @page 47, @section 7.2.6.5 ES_Descriptor
+const (
+	esDescrTag                = 0x03
+	decoderConfigDescrTag     = 0x04
+	decoderSpecificInfoTag    = 0x05
+	decoderConfigDescrMinSize = 13
+)
+
+// Parse the ES_Descriptor to get the DecoderSpecificInfo, which is the AudioSpecificConfig for AAC.
+func parseDecoderSpecificInfo(p []byte) (asc []byte, err error) {
+	for len(p) > 0 {
+		tag := p[0]
+
+		// The size is encoded in 7bits per byte, the MSB indicates more bytes, at most 4 bytes.
+		var size int
+		for i := 0; ; i++ {
+			if p = p[1:]; len(p) == 0 {
+				return nil, oe.Errorf("descriptor %v size too short", tag)
+			}
+			if i >= 4 {
+				return nil, oe.Errorf("descriptor %v size exceed 4 bytes", tag)
+			}
+			if size = size<<7 | int(p[0]&0x7f); p[0]&0x80 == 0 {
+				p = p[1:]
+				break
+			}
+		}
+		if size > len(p) {
+			return nil, oe.Errorf("descriptor %v size %v exceed %v", tag, size, len(p))
+		}
+
+		switch tag {
+		case esDescrTag:
+			// The ES_ID and flags, and the optional fields by flags.
+			if size < 3 {
+				return nil, oe.Errorf("es descriptor too short %v", size)
+			}
+			flags, skip := p[2], 3
+			if flags&0x80 != 0 {
+				skip += 2
+			}
+			if flags&0x40 != 0 && skip < size {
+				skip += 1 + int(p[skip])
+			}
+			if flags&0x20 != 0 {
+				skip += 2
+			}
+			if skip > size {
+				return nil, oe.Errorf("es descriptor too short %v", size)
+			}
+			p = p[skip:size]
+		case decoderConfigDescrTag:
+			if size < decoderConfigDescrMinSize {
+				return nil, oe.Errorf("decoder config too short %v", size)
+			}
+			p = p[decoderConfigDescrMinSize:size]
+		case decoderSpecificInfoTag:
+			return append([]byte{}, p[:size]...), nil
+		default:
+			p = p[size:]
+		}
+	}
+
+	return nil, oe.New("no decoder specific info")
+}
+
+// Parse the first edit of elst which is not empty, the segment_duration in movie timescale is
+// converted to the timescale of track, nil if all edits are empty.
+// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 36, @section 8.6.6 Edit List Box
+func parseEditList(p []byte, movieTimescale, trackTimescale uint32) (*EditList, error) {
+	if len(p) < 8 {
+		return nil, oe.Errorf("elst too short %v", len(p))
+	}
+
+	// Each entry is segment_duration, media_time and media_rate, 64bits time for version 1.
+	entrySize := 12
+	if p[0] == 1 {
+		entrySize = 20
+	}
+
+	count := int(binary.BigEndian.Uint32(p[4:]))
+	if p = p[8:]; count > len(p)/entrySize {
+		return nil, oe.Errorf("elst %v entries exceed %vB", count, len(p))
+	}
+
+	for i := 0; i < count; i, p = i+1, p[entrySize:] {
+		var duration uint64
+		var mediaTime int64
+		if entrySize == 20 {
+			duration, mediaTime = binary.BigEndian.Uint64(p), int64(binary.BigEndian.Uint64(p[8:]))
+		} else {
+			duration, mediaTime = uint64(binary.BigEndian.Uint32(p)), int64(int32(binary.BigEndian.Uint32(p[4:])))
+		}
+
+		// The empty edit, whose media_time is -1, to delay the presentation, which is ignored.
+		if mediaTime == -1 {
+			continue
+		}
+		if mediaTime < 0 {
+			return nil, oe.Errorf("invalid media time %v", mediaTime)
+		}
+
+		if movieTimescale > 0 {
+			duration = duration * uint64(trackTimescale) / uint64(movieTimescale)
+		}
+		return &EditList{MediaTime: mediaTime, Duration: duration}, nil
+	}
+
+	return nil, nil
+}
+
+// Parse the timescale and duration of mvhd or mdhd, the offset is for version 0.
+func parseTimescaleDuration(p []byte, offset int) (timescale uint32, duration uint64, err error) {
+	if len(p) < 1 {
+		return 0, 0, oe.New("empty box")
+	}
+
+	// The creation_time and modification_time are 64bits for version 1, so is the duration.
+	if p[0] == 1 {
+		if offset += 8; len(p) < offset+12 {
+			return 0, 0, oe.Errorf("box too short %v", len(p))
+		}
+		return binary.BigEndian.Uint32(p[offset:]), binary.BigEndian.Uint64(p[offset+4:]), nil
+	}
+
+	if len(p) < offset+8 {
+		return 0, 0, oe.Errorf("box too short %v", len(p))
+	}
+	return binary.BigEndian.Uint32(p[offset:]), uint64(binary.BigEndian.Uint32(p[offset+4:])), nil
+}
+
+// Parse the table of full box, skip some bytes after version and flags, then the entry_count
+// and entries, each entry is some uint32.
+func parseTable(p []byte, skip, fields int) (entries [][]uint32, err error) {
+	if len(p) < 8+skip {
+		return nil, oe.Errorf("table too short %v", len(p))
+	}
+
+	count := int(binary.BigEndian.Uint32(p[4+skip:]))
+	if p = p[8+skip:]; count > len(p)/4/fields {
+		return nil, oe.Errorf("table %v entries exceed %vB", count, len(p))
+	}
+
+	entries = make([][]uint32, count)
+	for i := range entries {
+		e := make([]uint32, fields)
+		for j := range e {
+			e[j] = binary.BigEndian.Uint32(p)
+			p = p[4:]
+		}
+		entries[i] = e
+	}
+
+	return
+}
+
+// Visit each box in p, the f is called with the type and payload of box.
+func forEachBox(p []byte, f func(boxType string, p []byte) error) error {
+	for len(p) > 0 {
+		if len(p) < 8 {
+			return oe.Errorf("box header too short %v", len(p))
+		}
+
+		size, boxType, headerSize := uint64(binary.BigEndian.Uint32(p)), string(p[4:8]), uint64(8)
+		if size == 1 {
+			if len(p) < 16 {
+				return oe.Errorf("box %v header too short %v", boxType, len(p))
+			}
+			size, headerSize = binary.BigEndian.Uint64(p[8:]), 16
+		} else if size == 0 {
+			size = uint64(len(p))
+		}
+
+		if size < headerSize || size > uint64(len(p)) {
+			return oe.Errorf("box %v size %v exceed %v", boxType, size, len(p))
+		}
+
+		if err := f(boxType, p[headerSize:size]); err != nil {
+			return oe.WithMessage(err, boxType)
+		}
+		p = p[size:]
+	}
+
+	return nil
+}
+
+// Sort the samples by DTS in ms of presentation, then by offset.
+type samplesByDTS []*sampleEntry
+
+func (v samplesByDTS) Len() int {
+	return len(v)
+}
+
+func (v samplesByDTS) Less(i, j int) bool {
+	a, b := v[i], v[j]
+	if x, y := a.track.presentationMs(a.dts), b.track.presentationMs(b.dts); x != y {
+		return x < y
+	}
+	return a.offset < b.offset
+}
+
+func (v samplesByDTS) Swap(i, j int) {
+	v[i], v[j] = v[j], v[i]
+}
@@ -0,0 +1,282 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/rtmp"
+	"io"
+	"testing"
+	"time"
+)
+
+func mockBox(boxType string, payloads ...[]byte) []byte {
+	p := bytes.Join(payloads, nil)
+	b := make([]byte, 8, 8+len(p))
+	binary.BigEndian.PutUint32(b, uint32(8+len(p)))
+	copy(b[4:], boxType)
+	return append(b, p...)
+}
+
+func mockUint32s(vs ...uint32) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+// The MP4 with moov after mdat, the video of 3 samples in a chunk, the audio of 2 samples in 2 chunks,
+// with optional edts of audio.
+func mockMP4(edts ...[]byte) []byte {
+	ftyp := mockBox("ftyp", []byte("isom"), mockUint32s(512))
+	mdat := mockBox("mdat", []byte{1, 1, 1, 1, 2, 2, 2, 0xa, 0xa, 3, 3, 0xb, 0xb})
+	base := uint32(len(ftyp) + 8)
+
+	// The full box of version 0 and flags, with the stsd entry.
+	fullBox := func(boxType string, payloads ...[]byte) []byte {
+		return mockBox(boxType, append([][]byte{mockUint32s(0)}, payloads...)...)
+	}
+	trak := func(id uint32, handler string, timescale uint32, edit, entry []byte, tables ...[]byte) []byte {
+		stbl := mockBox("stbl", append([][]byte{fullBox("stsd", mockUint32s(1), entry)}, tables...)...)
+		return mockBox("trak",
+			fullBox("tkhd", mockUint32s(0, 0, id)),
+			edit,
+			mockBox("mdia",
+				fullBox("mdhd", mockUint32s(0, 0, timescale, 0)),
+				fullBox("hdlr", mockUint32s(0), []byte(handler)),
+				mockBox("minf", stbl),
+			),
+		)
+	}
+
+	avc1 := mockBox("avc1", make([]byte, 24), []byte{0x05, 0x00, 0x02, 0xd0}, make([]byte, 50),
+		mockBox("avcC", []byte{1, 0x42, 0, 0x1e}))
+	video := trak(1, HandlerVideo, 90000, nil, avc1,
+		fullBox("stts", mockUint32s(1, 3, 3000)),
+		fullBox("ctts", mockUint32s(3, 1, 0, 1, 6000, 1, 0)),
+		fullBox("stss", mockUint32s(1, 1)),
+		fullBox("stsc", mockUint32s(1, 1, 3, 1)),
+		fullBox("stsz", mockUint32s(0, 3, 4, 3, 2)),
+		fullBox("stco", mockUint32s(1, base)),
+	)
+
+	// The ES_Descriptor, DecoderConfigDescriptor and DecoderSpecificInfo of AAC.
+	esds := fullBox("esds", []byte{0x03, 0x18, 0, 1, 0, 0x04, 0x13, 0x40, 0x15}, make([]byte, 11),
+		[]byte{0x05, 0x80, 0x80, 0x02, 0x12, 0x10})
+	mp4a := mockBox("mp4a", make([]byte, 28), esds)
+	audio := trak(2, HandlerAudio, 44100, bytes.Join(edts, nil), mp4a,
+		fullBox("stts", mockUint32s(1, 2, 1024)),
+		fullBox("stsc", mockUint32s(1, 1, 1, 1)),
+		fullBox("stsz", mockUint32s(2, 2)),
+		fullBox("stco", mockUint32s(2, base+9, base+11)),
+	)
+
+	moov := mockBox("moov", fullBox("mvhd", mockUint32s(0, 0, 1000, 100)), video, audio)
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+func TestDemuxer(t *testing.T) {
+	d, err := NewDemuxer(bytes.NewReader(mockMP4()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.DurationTime().Seconds() != 0.1 || len(d.Tracks) != 2 {
+		t.Errorf("invalid movie %v, %v tracks", d.DurationTime(), len(d.Tracks))
+	}
+	if v := d.Track(HandlerVideo); v == nil || v.Width != 1280 || v.Height != 720 || !bytes.Equal(v.Config, []byte{1, 0x42, 0, 0x1e}) {
+		t.Errorf("invalid video %+v", v)
+	}
+	if v := d.Track(HandlerAudio); v == nil || !bytes.Equal(v.Config, []byte{0x12, 0x10}) {
+		t.Errorf("invalid audio %+v", v)
+	}
+
+	var samples []string
+	for {
+		s, err := d.ReadSample()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, fmt.Sprintf("%v/%v/%v/%v/%x", s.Track.Handler, s.Timestamp(), s.CompositionTime(), s.Keyframe, s.Data))
+	}
+
+	if v := fmt.Sprint(samples); v != "[vide/0/0/true/01010101 soun/0/0/true/0303 soun/23/0/true/0b0b vide/33/66/false/020202 vide/66/0/false/0a0a]" {
+		t.Errorf("invalid samples %v", v)
+	}
+}
+
+func TestDemuxer_SampleCount(t *testing.T) {
+	// The count of stsz entries exceeds the box.
+	fullStsz := func(vs ...uint32) []byte {
+		return mockBox("stsz", mockUint32s(append([]uint32{0}, vs...)...))
+	}
+
+	b := bytes.Replace(mockMP4(), fullStsz(0, 3, 4, 3, 2), fullStsz(0, 0xffffff, 4, 3, 2), 1)
+	if _, err := NewDemuxer(bytes.NewReader(b)); err == nil {
+		t.Error("should fail for stsz entries")
+	}
+
+	// The samples of the same size exceed the file.
+	b = bytes.Replace(mockMP4(), fullStsz(2, 2), fullStsz(2, 0xffffffff), 1)
+	if _, err := NewDemuxer(bytes.NewReader(b)); err == nil {
+		t.Error("should fail for stsz sample count")
+	}
+}
+
+func TestDemuxer_Corrupt(t *testing.T) {
+	// The first_chunk of stsc is 1-based, and should increase.
+	stsc := func(vs ...uint32) []byte {
+		return mockBox("stsc", mockUint32s(append([]uint32{0, uint32(len(vs) / 3)}, vs...)...))
+	}
+	for _, entries := range [][]uint32{{0, 3, 1}, {2, 3, 1}} {
+		b := bytes.Replace(mockMP4(), stsc(1, 3, 1), stsc(entries...), 1)
+		if _, err := NewDemuxer(bytes.NewReader(b)); err == nil {
+			t.Errorf("should fail for stsc %v", entries)
+		}
+	}
+
+	b := bytes.Replace(mockMP4(), stsc(1, 1, 1), stsc(2, 1, 1, 2, 1, 1), 1)
+	if _, err := NewDemuxer(bytes.NewReader(b)); err == nil {
+		t.Error("should fail for stsc not increase")
+	}
+
+	// The largesize of box exceeds the file.
+	b = append(mockBox("ftyp", []byte("isom")), 0, 0, 0, 1, 'm', 'o', 'o', 'v', 0x40, 0, 0, 0, 0, 0, 0, 0)
+	if _, err := NewDemuxer(bytes.NewReader(b)); err == nil {
+		t.Error("should fail for largesize")
+	}
+
+	// The size of descriptor is at most 4 bytes.
+	if _, err := parseDecoderSpecificInfo([]byte{0x05, 0x80, 0x80, 0x80, 0x80, 0x00}); err == nil {
+		t.Error("should fail for 5 bytes size")
+	}
+	p := append([]byte{0x05}, bytes.Repeat([]byte{0xff}, 9)...)
+	if _, err := parseDecoderSpecificInfo(append(p, 0x7f, 0)); err == nil {
+		t.Error("should fail for overflow size")
+	}
+	if asc, err := parseDecoderSpecificInfo([]byte{0x05, 0x80, 0x80, 0x80, 0x02, 0x12, 0x10}); err != nil || !bytes.Equal(asc, []byte{0x12, 0x10}) {
+		t.Errorf("asc %v, err is %+v", asc, err)
+	}
+}
+
+func TestStreamer(t *testing.T) {
+	d, err := NewDemuxer(bytes.NewReader(mockMP4()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStreamer(d)
+	s.Realtime = false
+	s.Loop = true
+
+	var tags []string
+	err = s.Tags(func(tagType flv.TagType, timestamp uint32, tag []byte) error {
+		if tags = append(tags, fmt.Sprintf("%v/%v/%x", tagType, timestamp, tag[:2])); len(tags) == 9 {
+			s.Close()
+		}
+		return nil
+	})
+	if err == nil {
+		t.Error("should closed")
+	}
+
+	if v := fmt.Sprint(tags); v != "[Video/0/1700 Audio/0/af00 Video/0/1701 Audio/0/af01 Audio/23/af01 Video/33/2701 Video/66/2701 Video/100/1701 Audio/100/af01]" {
+		t.Errorf("invalid tags %v", v)
+	}
+}
+
+func TestStreamer_Clock(t *testing.T) {
+	d, err := NewDemuxer(bytes.NewReader(mockMP4()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pace the tags in virtual time, never block.
+	start := time.Unix(0, 0)
+	clock := rtmp.NewVirtualClock(start)
+
+	s := NewStreamer(d)
+	s.Clock = clock
+	if err = s.Tags(func(tagType flv.TagType, timestamp uint32, tag []byte) error {
+		if elapsed := clock.Now().Sub(start); elapsed != time.Duration(timestamp)*time.Millisecond {
+			t.Errorf("tag %v at %v, elapsed %v", tagType, timestamp, elapsed)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := clock.Now().Sub(start); elapsed != 66*time.Millisecond {
+		t.Errorf("elapsed %v", elapsed)
+	}
+}
+
+func TestDemuxer_EditList(t *testing.T) {
+	// The audio starts at 1024 in timescale of track, after an empty edit of 10ms.
+	elst := mockBox("elst", mockUint32s(0, 2, 10, 0xffffffff, 0x00010000, 46, 1024, 0x00010000))
+	b := mockMP4(mockBox("edts", elst))
+
+	d, err := NewDemuxer(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := d.Track(HandlerAudio); v == nil || v.EditList == nil || *v.EditList != (EditList{MediaTime: 1024, Duration: 2028}) {
+		t.Errorf("invalid audio %+v", v)
+	}
+	if v := d.Track(HandlerVideo); v == nil || v.EditList != nil {
+		t.Errorf("invalid video %+v", v)
+	}
+
+	var samples []string
+	for {
+		s, err := d.ReadSample()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, fmt.Sprintf("%v/%v/%v/%x", s.Track.Handler, s.DTS, s.Timestamp(), s.Data))
+	}
+
+	if v := fmt.Sprint(samples); v != "[vide/0/0/01010101 soun/0/0/0303 soun/1024/0/0b0b vide/3000/33/020202 vide/6000/66/0a0a]" {
+		t.Errorf("invalid samples %v", v)
+	}
+
+	// The media_time should not be negative, except the empty edit.
+	elst = mockBox("elst", mockUint32s(0, 1, 46, 0xfffffffe, 0x00010000))
+	b = mockMP4(mockBox("edts", elst))
+	if _, err := NewDemuxer(bytes.NewReader(b)); err == nil {
+		t.Error("should fail for negative media time")
+	}
+
+	elst = mockBox("elst", mockUint32s(0, 2, 46, 1024, 0x00010000))
+	b = mockMP4(mockBox("edts", elst))
+	if _, err := NewDemuxer(bytes.NewReader(b)); err == nil {
+		t.Error("should fail for elst entries")
+	}
+}
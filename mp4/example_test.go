@@ -0,0 +1,127 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mp4_test
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/mp4"
+	"os"
+	"time"
+)
+
+func ExampleMPD() {
+	// The live DASH, refresh every 5s and keep 30s for time shift.
+	mpd := mp4.NewMPD(mp4.MPDDynamic)
+	mpd.AvailabilityStartTime = time.Now()
+	mpd.MinimumUpdatePeriod = 5 * time.Second
+	mpd.TimeShiftBufferDepth = 30 * time.Second
+
+	// The video track of fMP4 segments, keep the last 10 segments.
+	video := mpd.AddRepresentation(&mp4.Representation{
+		ID: "video", MimeType: "video/mp4", Codecs: "avc1.64001f", Bandwidth: 800000,
+		Width: 1280, Height: 720, Timescale: 90000,
+		Initialization: "video/init.mp4", Media: "video/$Number$.m4s", Window: 10,
+	})
+
+	// When the segmenter reaps a fMP4 segment of 3s.
+	mpd.Update(func() {
+		video.AddSegment(3 * 90000)
+	})
+
+	// Serve the MPD by http.
+	b, err := mpd.MarshalBinary()
+	if err != nil {
+		return
+	}
+	fmt.Println(len(b) > 0)
+
+	// Output:
+	// true
+}
+
+func ExampleStreamer() {
+	f, err := os.Open("bumper.mp4")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	d, err := mp4.NewDemuxer(f)
+	if err != nil {
+		return
+	}
+
+	// Play the VoD file as a live channel, loop forever.
+	s := mp4.NewStreamer(d)
+	s.Loop = true
+	defer s.Close()
+
+	// Publish the tags by RTMP, see NewMessageFromTag of rtmp, or write to FLV by Mux.
+	s.Tags(func(tagType flv.TagType, timestamp uint32, tag []byte) error {
+		return nil
+	})
+}
+
+func ExampleMuxer() {
+	f, err := os.Open("bumper.mp4")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	d, err := mp4.NewDemuxer(f)
+	if err != nil {
+		return
+	}
+
+	// The init segment of video track, for DASH or LL-HLS.
+	video := d.Track(mp4.HandlerVideo)
+	w, err := os.Create("video/init.mp4")
+	if err != nil {
+		return
+	}
+	defer w.Close()
+
+	m, err := mp4.NewMuxer(w)
+	if err != nil {
+		return
+	}
+	defer m.Close()
+
+	if err = m.WriteInit(video); err != nil {
+		return
+	}
+
+	// Write the video samples as a fragment, generally a GOP for each segment.
+	var samples []*mp4.Sample
+	for {
+		s, err := d.ReadSample()
+		if err != nil {
+			break
+		}
+		if s.Track == video {
+			samples = append(samples, s)
+		}
+	}
+	m.WriteFragment(samples...)
+}
@@ -0,0 +1,196 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx mp4 package, the streamer to play the MP4 file as a live stream.
+package mp4
+
+import (
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/rtmp"
+	"io"
+	"sync"
+	"time"
+)
+
+// The Streamer reads the samples from demuxer, converts them to FLV tags and paces them
+// in real time, so the VoD file is played as a live channel. For example, to publish
+// by RTMP, use NewMessageFromTag of rtmp:
+//		s := NewStreamer(d)
+//		s.Loop = true
+//		s.Tags(func(tagType flv.TagType, timestamp uint32, tag []byte) error {...})
+// Or to write FLV, use Mux.
+// @remark The timestamp starts from 0, and continues when loop.
+type Streamer struct {
+	// Whether to pace the tags in real time, default to true.
+	Realtime bool
+	// Whether to loop the file forever.
+	Loop bool
+	// The clock to pace the tags, default to rtmp.SystemClock.
+	Clock rtmp.Clock
+
+	d      *Demuxer
+	once   sync.Once
+	closed chan bool
+}
+
+func NewStreamer(d *Demuxer) *Streamer {
+	return &Streamer{Realtime: true, Clock: rtmp.SystemClock, d: d, closed: make(chan bool)}
+}
+
+// Close the streamer, the Tags or Mux returns.
+func (v *Streamer) Close() error {
+	v.once.Do(func() {
+		close(v.closed)
+	})
+	return nil
+}
+
+// Write the FLV header and tags to muxer, until the file is done or closed.
+func (v *Streamer) Mux(m flv.Muxer) (err error) {
+	hasVideo, hasAudio := v.d.Track(HandlerVideo) != nil, v.d.Track(HandlerAudio) != nil
+	if err = m.WriteHeader(hasVideo, hasAudio); err != nil {
+		return oe.WithMessage(err, "write header")
+	}
+
+	return v.Tags(m.WriteTag)
+}
+
+// Generate the tags, the sequence headers first, then the samples, until the file is
+// done or closed. The timestamp is in ms.
+func (v *Streamer) Tags(onTag func(tagType flv.TagType, timestamp uint32, tag []byte) error) (err error) {
+	for _, t := range v.d.Tracks {
+		var tagType flv.TagType
+		var tag []byte
+		if tagType, tag, err = sequenceHeader(t); err != nil {
+			return oe.WithMessage(err, "sequence header")
+		}
+
+		if err = onTag(tagType, 0, tag); err != nil {
+			return oe.WithMessage(err, "write sequence header")
+		}
+	}
+
+	var offset, last uint32
+	start := v.Clock.Now()
+	for {
+		var s *Sample
+		if s, err = v.d.ReadSample(); err == io.EOF {
+			if !v.Loop {
+				return nil
+			}
+
+			// Continue the timestamp at the end of movie, or the last sample.
+			if d := uint32(v.d.DurationTime() / time.Millisecond); offset+d > last {
+				offset += d
+			} else {
+				offset = last
+			}
+
+			v.d.Rewind()
+			continue
+		} else if err != nil {
+			return oe.WithMessage(err, "read sample")
+		}
+
+		timestamp := offset + s.Timestamp()
+		if timestamp > last {
+			last = timestamp
+		}
+
+		if v.Realtime {
+			wait := start.Add(time.Duration(timestamp) * time.Millisecond).Sub(v.Clock.Now())
+			if wait > 0 {
+				select {
+				case <-v.Clock.After(wait):
+				case <-v.closed:
+					return oe.New("closed")
+				}
+			}
+		}
+
+		select {
+		case <-v.closed:
+			return oe.New("closed")
+		default:
+		}
+
+		var tagType flv.TagType
+		var tag []byte
+		if tagType, tag, err = sampleTag(s); err != nil {
+			return oe.WithMessage(err, "sample tag")
+		}
+
+		if err = onTag(tagType, timestamp, tag); err != nil {
+			return oe.WithMessage(err, "write tag")
+		}
+	}
+}
+
+// The FLV tag of sequence header of track.
+func sequenceHeader(t *Track) (tagType flv.TagType, tag []byte, err error) {
+	if t.Handler == HandlerVideo {
+		tag, err = encodeVideoTag(flv.VideoFrameTypeKeyframe, flv.VideoFrameTraitSequenceHeader, 0, t.Config)
+		return flv.TagTypeVideo, tag, err
+	}
+
+	tag, err = encodeAudioTag(flv.AudioFrameTraitSequenceHeader, t.Config)
+	return flv.TagTypeAudio, tag, err
+}
+
+// The FLV tag of sample.
+func sampleTag(s *Sample) (tagType flv.TagType, tag []byte, err error) {
+	if s.Track.Handler == HandlerVideo {
+		frameType := flv.VideoFrameTypeInterframe
+		if s.Keyframe {
+			frameType = flv.VideoFrameTypeKeyframe
+		}
+
+		tag, err = encodeVideoTag(frameType, flv.VideoFrameTraitNALU, s.CompositionTime(), s.Data)
+		return flv.TagTypeVideo, tag, err
+	}
+
+	tag, err = encodeAudioTag(flv.AudioFrameTraitRaw, s.Data)
+	return flv.TagTypeAudio, tag, err
+}
+
+func encodeVideoTag(frameType flv.VideoFrameType, trait flv.VideoFrameTrait, cts int32, raw []byte) ([]byte, error) {
+	p, err := flv.NewVideoPackager()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Encode(&flv.VideoFrame{CodecID: flv.VideoCodecAVC, FrameType: frameType, Trait: trait, CTS: cts, Raw: raw})
+}
+
+// The AAC in FLV is always 44kHz, 16bits and stereo, the actual format is in sequence header.
+func encodeAudioTag(trait flv.AudioFrameTrait, raw []byte) ([]byte, error) {
+	p, err := flv.NewAudioPackager()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Encode(&flv.AudioFrame{
+		SoundFormat: flv.AudioCodecAAC, SoundRate: flv.AudioSamplingRate44kHz,
+		SoundSize: flv.AudioSampleBits16bits, SoundType: flv.AudioChannelsStereo,
+		Trait: trait, Raw: raw,
+	})
+}
@@ -0,0 +1,285 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The oryx mp4 package, the DASH MPD generator.
+package mp4
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The type of MPD, static for VoD and dynamic for live.
+// Please read @doc ISO_IEC_23009-1-DASH-2014.pdf, @page 26, @section 5.3.1.2 Semantics
+type MPDType string
+
+const (
+	MPDStatic  MPDType = "static"
+	MPDDynamic MPDType = "dynamic"
+)
+
+// The segment in timeline, in timescale of representation.
+type Segment struct {
+	// The start time, the t of S.
+	Time uint64
+	// The duration, the d of S.
+	Duration uint64
+}
+
+// The representation of DASH, which is a fMP4 track, for example, the video or audio
+// track of the mp4 muxer.
+// @remark The segments are described by SegmentTemplate with SegmentTimeline.
+type Representation struct {
+	// The id of representation, unique in MPD.
+	ID string
+	// The mime type, for example, video/mp4 or audio/mp4.
+	MimeType string
+	// The codecs, for example, avc1.64001f or mp4a.40.2.
+	Codecs string
+	// The bandwidth in bps.
+	Bandwidth int
+	// For video, the width and height in pixels.
+	Width, Height int
+	// For audio, the sampling rate in Hz.
+	AudioSamplingRate int
+	// The timescale of segments, for example, 90000 for video.
+	Timescale uint32
+	// The template of initialization and media segments, for example,
+	// init.mp4 and $Number$.m4s, where $Number$ and $Time$ are replaced by player.
+	Initialization string
+	Media          string
+	// The max number of segments for live, 0 to keep all.
+	Window int
+
+	// The number of first segment.
+	startNumber uint64
+	segments    []*Segment
+}
+
+// Append a segment to the representation, the start time is the end of last segment.
+func (v *Representation) AddSegment(duration uint64) {
+	var start uint64
+	if len(v.segments) > 0 {
+		last := v.segments[len(v.segments)-1]
+		start = last.Time + last.Duration
+	}
+	v.AddSegmentAt(start, duration)
+}
+
+// Append a segment start at time, for the timeline with gaps.
+func (v *Representation) AddSegmentAt(start, duration uint64) {
+	v.segments = append(v.segments, &Segment{Time: start, Duration: duration})
+
+	if v.Window > 0 && len(v.segments) > v.Window {
+		n := len(v.segments) - v.Window
+		v.segments = v.segments[n:]
+		v.startNumber += uint64(n)
+	}
+}
+
+// Get the segments in timeline.
+func (v *Representation) Segments() []*Segment {
+	return v.segments
+}
+
+// The MPD writer, which generates the live or VoD DASH manifest.
+// @remark It's safe for concurrent use.
+type MPD struct {
+	// The type of MPD, MPDDynamic for live.
+	Type MPDType
+	// For live, the time when the first segment is available.
+	AvailabilityStartTime time.Time
+	// For live, the interval for player to refresh MPD, and the time shift window.
+	MinimumUpdatePeriod  time.Duration
+	TimeShiftBufferDepth time.Duration
+	// For VoD, the duration of presentation.
+	MediaPresentationDuration time.Duration
+	// The min buffer time, default to 2s.
+	MinBufferTime time.Duration
+
+	lock            sync.Mutex
+	representations []*Representation
+}
+
+func NewMPD(t MPDType) *MPD {
+	return &MPD{Type: t, MinBufferTime: 2 * time.Second}
+}
+
+// Add a representation, which segments are updated by caller.
+func (v *MPD) AddRepresentation(r *Representation) *Representation {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.representations = append(v.representations, r)
+	return r
+}
+
+// Lock to update the segments of representations.
+func (v *MPD) Update(f func()) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	f()
+}
+
+// The xml elements of MPD.
+type xmlMPD struct {
+	XMLName                   xml.Name `xml:"MPD"`
+	Xmlns                     string   `xml:"xmlns,attr"`
+	Profiles                  string   `xml:"profiles,attr"`
+	Type                      MPDType  `xml:"type,attr"`
+	AvailabilityStartTime     string   `xml:"availabilityStartTime,attr,omitempty"`
+	PublishTime               string   `xml:"publishTime,attr,omitempty"`
+	MinimumUpdatePeriod       string   `xml:"minimumUpdatePeriod,attr,omitempty"`
+	TimeShiftBufferDepth      string   `xml:"timeShiftBufferDepth,attr,omitempty"`
+	MediaPresentationDuration string   `xml:"mediaPresentationDuration,attr,omitempty"`
+	MinBufferTime             string   `xml:"minBufferTime,attr"`
+	Period                    struct {
+		ID             string `xml:"id,attr"`
+		Start          string `xml:"start,attr"`
+		AdaptationSets []*xmlAdaptationSet
+	} `xml:"Period"`
+}
+
+type xmlAdaptationSet struct {
+	XMLName          xml.Name `xml:"AdaptationSet"`
+	MimeType         string   `xml:"mimeType,attr"`
+	SegmentAlignment bool     `xml:"segmentAlignment,attr"`
+	StartWithSAP     int      `xml:"startWithSAP,attr"`
+	Representations  []*xmlRepresentation
+}
+
+type xmlRepresentation struct {
+	XMLName           xml.Name `xml:"Representation"`
+	ID                string   `xml:"id,attr"`
+	Codecs            string   `xml:"codecs,attr,omitempty"`
+	Bandwidth         int      `xml:"bandwidth,attr"`
+	Width             int      `xml:"width,attr,omitempty"`
+	Height            int      `xml:"height,attr,omitempty"`
+	AudioSamplingRate int      `xml:"audioSamplingRate,attr,omitempty"`
+	SegmentTemplate   struct {
+		Timescale       uint32  `xml:"timescale,attr"`
+		Initialization  string  `xml:"initialization,attr"`
+		Media           string  `xml:"media,attr"`
+		StartNumber     uint64  `xml:"startNumber,attr"`
+		SegmentTimeline []*xmlS `xml:"SegmentTimeline>S"`
+	} `xml:"SegmentTemplate"`
+}
+
+type xmlS struct {
+	T *uint64 `xml:"t,attr,omitempty"`
+	D uint64  `xml:"d,attr"`
+	R int     `xml:"r,attr,omitempty"`
+}
+
+// Generate the MPD in xml.
+func (v *MPD) MarshalBinary() (data []byte, err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	m := &xmlMPD{
+		Xmlns:    "urn:mpeg:dash:schema:mpd:2011",
+		Profiles: "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:     v.Type,
+	}
+	m.MinBufferTime = isoDuration(v.MinBufferTime)
+	m.Period.ID, m.Period.Start = "0", isoDuration(0)
+
+	if v.Type == MPDDynamic {
+		m.AvailabilityStartTime = v.AvailabilityStartTime.UTC().Format(time.RFC3339)
+		m.PublishTime = time.Now().UTC().Format(time.RFC3339)
+		if v.MinimumUpdatePeriod > 0 {
+			m.MinimumUpdatePeriod = isoDuration(v.MinimumUpdatePeriod)
+		}
+		if v.TimeShiftBufferDepth > 0 {
+			m.TimeShiftBufferDepth = isoDuration(v.TimeShiftBufferDepth)
+		}
+	} else if v.MediaPresentationDuration > 0 {
+		m.MediaPresentationDuration = isoDuration(v.MediaPresentationDuration)
+	}
+
+	// Group the representations by mime type.
+	sets := map[string]*xmlAdaptationSet{}
+	for _, r := range v.representations {
+		as, ok := sets[r.MimeType]
+		if !ok {
+			as = &xmlAdaptationSet{MimeType: r.MimeType, SegmentAlignment: true, StartWithSAP: 1}
+			sets[r.MimeType] = as
+			m.Period.AdaptationSets = append(m.Period.AdaptationSets, as)
+		}
+
+		xr := &xmlRepresentation{
+			ID: r.ID, Codecs: r.Codecs, Bandwidth: r.Bandwidth,
+			Width: r.Width, Height: r.Height, AudioSamplingRate: r.AudioSamplingRate,
+		}
+		xr.SegmentTemplate.Timescale = r.Timescale
+		xr.SegmentTemplate.Initialization = r.Initialization
+		xr.SegmentTemplate.Media = r.Media
+		xr.SegmentTemplate.StartNumber = r.startNumber
+		xr.SegmentTemplate.SegmentTimeline = timeline(r.segments)
+
+		as.Representations = append(as.Representations, xr)
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(b)
+	enc.Indent("", "  ")
+	if err = enc.Encode(m); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// Convert segments to timeline, merge the continuous segments with same duration by r.
+func timeline(segments []*Segment) (ss []*xmlS) {
+	var next uint64
+	for _, s := range segments {
+		if len(ss) > 0 {
+			last := ss[len(ss)-1]
+			if s.Time == next && s.Duration == last.D {
+				last.R++
+				next += s.Duration
+				continue
+			}
+		}
+
+		t := s.Time
+		x := &xmlS{D: s.Duration}
+		// The t is required for the first one, or there is a gap.
+		if len(ss) == 0 || t != next {
+			x.T = &t
+		}
+		ss = append(ss, x)
+		next = s.Time + s.Duration
+	}
+	return
+}
+
+// Format duration in ISO 8601, for example, PT2.000S.
+func isoDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%.3fS", d.Seconds())
+}
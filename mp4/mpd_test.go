@@ -0,0 +1,82 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mp4
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepresentation_Window(t *testing.T) {
+	r := &Representation{Window: 3}
+	for i := 0; i < 5; i++ {
+		r.AddSegment(100)
+	}
+
+	if ss := r.Segments(); len(ss) != 3 || ss[0].Time != 200 || r.startNumber != 2 {
+		t.Errorf("invalid window %v, start=%v", len(ss), r.startNumber)
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	r := &Representation{}
+	r.AddSegment(100)
+	r.AddSegment(100)
+	r.AddSegment(100)
+	r.AddSegment(50)
+	r.AddSegmentAt(1000, 50)
+
+	ss := timeline(r.Segments())
+	if len(ss) != 3 {
+		t.Errorf("invalid timeline %v", len(ss))
+		return
+	}
+
+	if s := ss[0]; s.T == nil || *s.T != 0 || s.D != 100 || s.R != 2 {
+		t.Errorf("invalid s0 %+v", s)
+	}
+	if s := ss[1]; s.T != nil || s.D != 50 || s.R != 0 {
+		t.Errorf("invalid s1 %+v", s)
+	}
+	if s := ss[2]; s.T == nil || *s.T != 1000 || s.D != 50 || s.R != 0 {
+		t.Errorf("invalid s2 %+v", s)
+	}
+}
+
+func TestMPD_MarshalBinary(t *testing.T) {
+	mpd := NewMPD(MPDStatic)
+	r := mpd.AddRepresentation(&Representation{ID: "audio", MimeType: "audio/mp4", Timescale: 44100})
+	r.AddSegment(44100)
+
+	b, err := mpd.MarshalBinary()
+	if err != nil {
+		t.Errorf("marshal err %+v", err)
+		return
+	}
+
+	s := string(b)
+	for _, want := range []string{`type="static"`, `<AdaptationSet mimeType="audio/mp4"`, `<S t="0" d="44100"></S>`} {
+		if !strings.Contains(s, want) {
+			t.Errorf("no %v in %v", want, s)
+		}
+	}
+}
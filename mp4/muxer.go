@@ -0,0 +1,395 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The fragmented MP4 muxer, to write the init segment and media segments for DASH and LL-HLS.
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ossrs/go-oryx-lib/aac"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+)
+
+// The fragmented MP4(fMP4) muxer, which writes the init segment with the tracks, then the
+// fragments of samples, for example:
+//		m, _ := mp4.NewMuxer(w)
+//		m.WriteInit(video, audio)
+//		m.WriteFragment(samples...)
+// @remark The sample of AVC is in AVCC, and the track config is AVCDecoderConfigurationRecord.
+// @remark The sample of AAC is the raw frame, and the track config is AudioSpecificConfig.
+type Muxer interface {
+	// Write the init segment, the ftyp and moov of tracks.
+	WriteInit(tracks ...*Track) (err error)
+	// Write a fragment, the moof and mdat of samples, which should be in order of DTS for each track.
+	// @remark Each call is a media segment for DASH, or a part for LL-HLS.
+	WriteFragment(samples ...*Sample) (err error)
+	// Close the muxer.
+	Close() error
+}
+
+// Create a fMP4 muxer object.
+func NewMuxer(w io.Writer) (Muxer, error) {
+	return &muxer{
+		w: w,
+	}, nil
+}
+
+type muxer struct {
+	w io.Writer
+	// The tracks in init segment.
+	tracks []*Track
+	// The last sample duration of track, by track id, for the last sample in fragment.
+	durations map[uint32]uint32
+	// The sequence number of fragment, starts from 1.
+	sequence uint32
+}
+
+func (v *muxer) Close() error {
+	return nil
+}
+
+func (v *muxer) WriteInit(tracks ...*Track) (err error) {
+	if len(tracks) == 0 {
+		return oe.New("no track")
+	}
+
+	v.tracks, v.durations = tracks, make(map[uint32]uint32)
+
+	var traks, trexs [][]byte
+	var nextID uint32
+	for _, t := range tracks {
+		var trak []byte
+		if trak, err = encodeTrak(t); err != nil {
+			return oe.WithMessage(err, "encode trak")
+		}
+		traks = append(traks, trak)
+
+		// The default_sample_description_index is 1, others are set in each fragment.
+		trexs = append(trexs, fullBox("trex", 0, 0, uint32s(t.ID, 1, 0, 0, 0)))
+
+		if t.ID >= nextID {
+			nextID = t.ID + 1
+		}
+	}
+
+	// The mvhd of version 0, the timescale of movie is 1000, the duration is 0 for fragments.
+	// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 23, @section 8.2.2 Movie Header Box
+	mvhd := fullBox("mvhd", 0, 0, uint32s(0, 0, 1000, 0, 0x00010000), []byte{0x01, 0x00},
+		make([]byte, 10), matrix(), make([]byte, 24), uint32s(nextID))
+
+	moov := box("moov", append(append([][]byte{mvhd}, traks...), box("mvex", trexs...))...)
+	ftyp := box("ftyp", []byte("iso6"), uint32s(0), []byte("iso6cmfcmp41"))
+
+	return v.write(ftyp, moov)
+}
+
+func (v *muxer) WriteFragment(samples ...*Sample) (err error) {
+	if len(v.tracks) == 0 {
+		return oe.New("no init segment")
+	}
+	if len(samples) == 0 {
+		return oe.New("no sample")
+	}
+
+	// Group the samples by track, in order of init segment.
+	groups := make(map[uint32][]*Sample)
+	for _, s := range samples {
+		if s.Track == nil {
+			return oe.New("no track of sample")
+		}
+		groups[s.Track.ID] = append(groups[s.Track.ID], s)
+	}
+
+	var trafs []*trackFragment
+	for _, t := range v.tracks {
+		if ss, ok := groups[t.ID]; ok {
+			trafs = append(trafs, &trackFragment{track: t, samples: ss})
+			delete(groups, t.ID)
+		}
+	}
+	for id := range groups {
+		return oe.Errorf("track %v not in init segment", id)
+	}
+
+	for _, traf := range trafs {
+		if err = traf.build(v.durations); err != nil {
+			return oe.WithMessage(err, "build traf")
+		}
+	}
+
+	// The data_offset of trun is relative to the moof, so encode the moof to get its size
+	// first, which does not depend on the offsets.
+	v.sequence++
+	moof := v.encodeMoof(trafs, 0)
+	moof = v.encodeMoof(trafs, uint32(len(moof))+8)
+
+	var payloads [][]byte
+	for _, traf := range trafs {
+		for _, s := range traf.samples {
+			payloads = append(payloads, s.Data)
+		}
+	}
+
+	return v.write(moof, box("mdat", payloads...))
+}
+
+// Encode the moof, the base is the offset of mdat payload to the moof.
+// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 44, @section 8.8.4 Movie Fragment Box
+func (v *muxer) encodeMoof(trafs []*trackFragment, base uint32) []byte {
+	payloads := [][]byte{fullBox("mfhd", 0, 0, uint32s(v.sequence))}
+
+	for _, traf := range trafs {
+		payloads = append(payloads, traf.encode(base))
+		for _, s := range traf.samples {
+			base += uint32(len(s.Data))
+		}
+	}
+
+	return box("moof", payloads...)
+}
+
+func (v *muxer) write(boxes ...[]byte) (err error) {
+	for _, b := range boxes {
+		if _, err = io.Copy(v.w, bytes.NewReader(b)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// The samples of a track in fragment.
+type trackFragment struct {
+	track   *Track
+	samples []*Sample
+	// The duration of each sample, in timescale of track.
+	durations []uint32
+}
+
+// Build the duration of samples by DTS, the last one use the previous duration.
+func (v *trackFragment) build(durations map[uint32]uint32) (err error) {
+	v.durations = make([]uint32, len(v.samples))
+
+	last := durations[v.track.ID]
+	for i, s := range v.samples {
+		if i < len(v.samples)-1 {
+			next := v.samples[i+1]
+			if next.DTS < s.DTS {
+				return oe.Errorf("track %v dts %v after %v", v.track.ID, next.DTS, s.DTS)
+			}
+			last = uint32(next.DTS - s.DTS)
+		}
+		v.durations[i] = last
+	}
+
+	durations[v.track.ID] = last
+	return
+}
+
+// The flags of sample, the sync sample does not depend on others, while the non-sync sample
+// depends on others and is_non_sync_sample.
+// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 46, @section 8.8.3.1 Definition
+const (
+	sampleFlagsSync    = 0x02000000
+	sampleFlagsNonSync = 0x01010000
+)
+
+// The flags of tfhd and trun.
+const (
+	tfhdDefaultBaseIsMoof = 0x020000
+	trunDataOffset        = 0x000001
+	trunSampleDuration    = 0x000100
+	trunSampleSize        = 0x000200
+	trunSampleFlags       = 0x000400
+	trunSampleCTS         = 0x000800
+)
+
+// Encode the traf, the base is the offset of samples to the moof.
+// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 45, @section 8.8.6 Track Fragment Box
+func (v *trackFragment) encode(base uint32) []byte {
+	tfhd := fullBox("tfhd", 0, tfhdDefaultBaseIsMoof, uint32s(v.track.ID))
+
+	// The baseMediaDecodeTime is 64bits for version 1.
+	tfdt := fullBox("tfdt", 1, 0, uint64s(v.samples[0].DTS))
+
+	// The version 1 for the signed composition offset.
+	entries := []uint32{uint32(len(v.samples)), base}
+	for i, s := range v.samples {
+		flags := uint32(sampleFlagsNonSync)
+		if s.Keyframe {
+			flags = sampleFlagsSync
+		}
+		entries = append(entries, v.durations[i], uint32(len(s.Data)), flags, uint32(s.CTS))
+	}
+	trun := fullBox("trun", 1, trunDataOffset|trunSampleDuration|trunSampleSize|trunSampleFlags|trunSampleCTS,
+		uint32s(entries...))
+
+	return box("traf", tfhd, tfdt, trun)
+}
+
+// Encode the trak of track, with empty sample table for fragments.
+// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 24, @section 8.3.1 Track Box
+func encodeTrak(t *Track) (trak []byte, err error) {
+	var entry, mhd []byte
+	var volume uint16
+	var name string
+
+	switch t.Codec {
+	case CodecAVC:
+		entry, mhd, name = encodeAVCSampleEntry(t), fullBox("vmhd", 0, 1, make([]byte, 8)), "VideoHandler"
+	case CodecAAC:
+		if entry, err = encodeAACSampleEntry(t); err != nil {
+			return nil, oe.WithMessage(err, "encode mp4a")
+		}
+		mhd, name, volume = fullBox("smhd", 0, 0, make([]byte, 4)), "SoundHandler", 0x0100
+	default:
+		return nil, oe.Errorf("invalid codec %v", t.Codec)
+	}
+
+	// The tkhd of version 0, flags is track_enabled and track_in_movie.
+	tkhd := fullBox("tkhd", 0, 3, uint32s(0, 0, t.ID, 0, 0, 0, 0), uint16s(0, 0, volume, 0), matrix(),
+		uint32s(uint32(t.Width)<<16, uint32(t.Height)<<16))
+
+	// The language is packed ISO-639-2 code und.
+	mdhd := fullBox("mdhd", 0, 0, uint32s(0, 0, t.Timescale, 0), uint16s(0x55c4, 0))
+	hdlr := fullBox("hdlr", 0, 0, uint32s(0), []byte(t.Handler), make([]byte, 12), []byte(name), []byte{0})
+
+	// The data is in the same file, flags is 1.
+	dinf := box("dinf", fullBox("dref", 0, 0, uint32s(1), fullBox("url ", 0, 1)))
+
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, uint32s(1), entry),
+		fullBox("stts", 0, 0, uint32s(0)),
+		fullBox("stsc", 0, 0, uint32s(0)),
+		fullBox("stsz", 0, 0, uint32s(0, 0)),
+		fullBox("stco", 0, 0, uint32s(0)),
+	)
+
+	mdia := box("mdia", mdhd, hdlr, box("minf", mhd, dinf, stbl))
+	if t.EditList == nil {
+		return box("trak", tkhd, mdia), nil
+	}
+
+	// The elst of version 1 with one edit, the segment_duration is in timescale of movie, and the
+	// media_rate is 1.
+	// Please read @doc ISO_IEC_14496-12-base-format-2012.pdf, @page 36, @section 8.6.6 Edit List Box
+	if t.EditList.MediaTime < 0 {
+		return nil, oe.Errorf("invalid media time %v", t.EditList.MediaTime)
+	}
+	var duration uint64
+	if t.Timescale > 0 {
+		duration = t.EditList.Duration * 1000 / uint64(t.Timescale)
+	}
+	elst := fullBox("elst", 1, 0, uint32s(1), uint64s(duration, uint64(t.EditList.MediaTime)), uint16s(1, 0))
+
+	trak = box("trak", tkhd, box("edts", elst), mdia)
+	return
+}
+
+// Encode the avc1 VisualSampleEntry with avcC.
+// Please read @doc ISO_IEC_14496-15-AVC-format-2012.pdf, @page 20, @section 5.4.2.1 Syntax
+func encodeAVCSampleEntry(t *Track) []byte {
+	// The compressorname is 32 bytes, the depth is 0x0018 and pre_defined is -1.
+	return box("avc1", make([]byte, 6), uint16s(1), make([]byte, 16), uint16s(t.Width, t.Height),
+		uint32s(0x00480000, 0x00480000, 0), uint16s(1), make([]byte, 32), uint16s(0x0018, 0xffff),
+		box("avcC", t.Config))
+}
+
+// Encode the mp4a AudioSampleEntry with esds, the channels and sample rate are from the ASC.
+// Please read @doc ISO_IEC_14496-14-MP4-2003.pdf, @page 15, @section 5.6 Sample Description Boxes
+func encodeAACSampleEntry(t *Track) ([]byte, error) {
+	asc := &aac.AudioSpecificConfig{}
+	if err := asc.UnmarshalBinary(t.Config); err != nil {
+		return nil, oe.WithMessage(err, "parse asc")
+	}
+
+	// The DecoderConfigDescriptor of AAC, objectTypeIndication is 0x40 and streamType is audio,
+	// then the bufferSizeDB, maxBitrate and avgBitrate.
+	dcd := append([]byte{0x40, 0x15}, make([]byte, 11)...)
+	dcd = append(dcd, descriptor(decoderSpecificInfoTag, t.Config)...)
+
+	// The ES_Descriptor with ES_ID and flags, and the SLConfigDescriptor of predefined 2.
+	esd := append([]byte{0, 0, 0}, descriptor(decoderConfigDescrTag, dcd)...)
+	esd = append(esd, descriptor(slConfigDescrTag, []byte{0x02})...)
+	esds := fullBox("esds", 0, 0, descriptor(esDescrTag, esd))
+
+	return box("mp4a", make([]byte, 6), uint16s(1), make([]byte, 8),
+		uint16s(uint16(asc.Channels), 16, 0, 0), uint32s(uint32(asc.SampleRate.ToHz())<<16), esds), nil
+}
+
+// The SLConfigDescriptor of ES_Descriptor.
+const slConfigDescrTag = 0x06
+
+// Encode the descriptor, the size is encoded in 7bits per byte, the MSB indicates more bytes.
+func descriptor(tag uint8, p []byte) []byte {
+	b := []byte{tag}
+	for shift := uint(21); shift > 0; shift -= 7 {
+		if len(p)>>shift > 0 {
+			b = append(b, byte(len(p)>>shift&0x7f)|0x80)
+		}
+	}
+	b = append(b, byte(len(p)&0x7f))
+	return append(b, p...)
+}
+
+// The unity matrix of mvhd and tkhd.
+func matrix() []byte {
+	return uint32s(0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000)
+}
+
+// Encode the box with payloads.
+func box(boxType string, payloads ...[]byte) []byte {
+	p := bytes.Join(payloads, nil)
+	b := make([]byte, 8, 8+len(p))
+	binary.BigEndian.PutUint32(b, uint32(8+len(p)))
+	copy(b[4:], boxType)
+	return append(b, p...)
+}
+
+// Encode the full box with version and flags.
+func fullBox(boxType string, version uint8, flags uint32, payloads ...[]byte) []byte {
+	return box(boxType, append([][]byte{uint32s(uint32(version)<<24 | flags&0xffffff)}, payloads...)...)
+}
+
+func uint16s(vs ...uint16) []byte {
+	b := make([]byte, 2*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint16(b[2*i:], v)
+	}
+	return b
+}
+
+func uint32s(vs ...uint32) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+func uint64s(vs ...uint64) []byte {
+	b := make([]byte, 8*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint64(b[8*i:], v)
+	}
+	return b
+}
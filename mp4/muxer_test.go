@@ -0,0 +1,113 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestMuxer(t *testing.T) {
+	video := &Track{ID: 1, Handler: HandlerVideo, Codec: CodecAVC, Timescale: 90000, Width: 1280, Height: 720,
+		Config: []byte{1, 0x42, 0, 0x1e}}
+	audio := &Track{ID: 2, Handler: HandlerAudio, Codec: CodecAAC, Timescale: 44100, Config: []byte{0x12, 0x10},
+		EditList: &EditList{MediaTime: 2112, Duration: 441000}}
+
+	b := &bytes.Buffer{}
+	m, err := NewMuxer(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.WriteInit(video, audio); err != nil {
+		t.Fatal(err)
+	}
+
+	// The init segment is parsed by demuxer, without samples.
+	d, err := NewDemuxer(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := d.Track(HandlerVideo); v == nil || v.ID != 1 || v.Width != 1280 || v.Height != 720 || v.Timescale != 90000 || !bytes.Equal(v.Config, video.Config) || v.EditList != nil {
+		t.Errorf("invalid video %+v", v)
+	}
+	if v := d.Track(HandlerAudio); v == nil || v.ID != 2 || v.Timescale != 44100 || !bytes.Equal(v.Config, audio.Config) || v.EditList == nil || *v.EditList != *audio.EditList {
+		t.Errorf("invalid audio %+v", v)
+	}
+
+	b.Reset()
+	err = m.WriteFragment(
+		&Sample{Track: video, DTS: 3000, Keyframe: true, Data: []byte{1, 1, 1}},
+		&Sample{Track: audio, DTS: 1024, Keyframe: true, Data: []byte{3, 3}},
+		&Sample{Track: video, DTS: 6000, CTS: 3000, Data: []byte{2, 2}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parse the trun of each traf, to check the samples in mdat.
+	var samples []string
+	fragment := b.Bytes()
+	err = forEachBox(fragment, func(boxType string, p []byte) error {
+		if boxType != "moof" {
+			return nil
+		}
+		return forEachBox(p, func(boxType string, p []byte) error {
+			if boxType != "traf" {
+				return nil
+			}
+
+			var id uint32
+			var dts uint64
+			return forEachBox(p, func(boxType string, p []byte) error {
+				switch boxType {
+				case "tfhd":
+					id = binary.BigEndian.Uint32(p[4:])
+				case "tfdt":
+					dts = binary.BigEndian.Uint64(p[4:])
+				case "trun":
+					count, offset := binary.BigEndian.Uint32(p[4:]), binary.BigEndian.Uint32(p[8:])
+					for i := 0; i < int(count); i++ {
+						e := p[12+16*i:]
+						duration, size := binary.BigEndian.Uint32(e), binary.BigEndian.Uint32(e[4:])
+						flags, cts := binary.BigEndian.Uint32(e[8:]), int32(binary.BigEndian.Uint32(e[12:]))
+						samples = append(samples, fmt.Sprintf("%v/%v/%v/%x/%v/%x", id, dts, duration, flags, cts, fragment[offset:offset+size]))
+						offset, dts = offset+size, dts+uint64(duration)
+					}
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := fmt.Sprint(samples); v != "[1/3000/3000/2000000/0/010101 1/6000/3000/1010000/3000/0202 2/1024/0/2000000/0/0303]" {
+		t.Errorf("invalid samples %v", v)
+	}
+
+	if err = m.WriteFragment(&Sample{Track: &Track{ID: 3}}); err == nil {
+		t.Error("should fail for unknown track")
+	}
+}
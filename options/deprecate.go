@@ -0,0 +1,148 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The deprecated options, which are aliases of the new options with warnings,
+// for the smooth migration of config across releases.
+package options
+
+import (
+	"flag"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"strings"
+	"sync"
+)
+
+// The deprecated option, replaced by the new name.
+type deprecation struct {
+	old, name string
+}
+
+var deprecations struct {
+	lock  sync.Mutex
+	items []*deprecation
+}
+
+// Declare the deprecated option name old, which is replaced by name, for both the
+// flags and the fields of config. The name of config field can be a dotted path,
+// for example, "rtmp.listen".
+// @remark For flags, the flag name must be defined before, and Deprecate must be
+// called before ParseArgv, then the old flag is an alias of the new one.
+func Deprecate(old, name string) {
+	deprecations.lock.Lock()
+	defer deprecations.lock.Unlock()
+
+	deprecations.items = append(deprecations.items, &deprecation{old: old, name: name})
+
+	if f := flag.Lookup(name); f != nil && flag.Lookup(old) == nil {
+		flag.Var(&deprecatedValue{target: f.Value, old: old, name: name}, old, "Deprecated, please use -"+name)
+	}
+}
+
+// The flag value which set the new flag with warning.
+type deprecatedValue struct {
+	target    flag.Value
+	old, name string
+}
+
+func (v *deprecatedValue) String() string {
+	if v.target == nil {
+		return ""
+	}
+	return v.target.String()
+}
+
+func (v *deprecatedValue) Set(s string) error {
+	ol.Wf(nil, "option -%v is deprecated, please use -%v", v.old, v.name)
+	return v.target.Set(s)
+}
+
+// For bool flags, the value is optional.
+func (v *deprecatedValue) IsBoolFlag() bool {
+	if f, ok := v.target.(interface {
+		IsBoolFlag() bool
+	}); ok {
+		return f.IsBoolFlag()
+	}
+	return false
+}
+
+// Migrate the deprecated fields of config to the new names, with warnings, for
+// example, the config object parsed by json.Unmarshal.
+// @remark The new field wins if both present.
+// @return The number of migrated fields.
+func MigrateConfig(conf map[string]interface{}) (migrated int) {
+	deprecations.lock.Lock()
+	items := append([]*deprecation(nil), deprecations.items...)
+	deprecations.lock.Unlock()
+
+	for _, d := range items {
+		op, ok := configParent(conf, d.old, false)
+		if !ok {
+			continue
+		}
+
+		value, ok := op[configKey(d.old)]
+		if !ok {
+			continue
+		}
+		delete(op, configKey(d.old))
+
+		np, _ := configParent(conf, d.name, true)
+		if _, ok = np[configKey(d.name)]; ok {
+			ol.Wf(nil, "config %v is deprecated and ignored, use %v", d.old, d.name)
+			continue
+		}
+
+		ol.Wf(nil, "config %v is deprecated, please use %v", d.old, d.name)
+		np[configKey(d.name)] = value
+		migrated++
+	}
+
+	return
+}
+
+// Get the object which contains the field of dotted path, create if required.
+func configParent(conf map[string]interface{}, path string, create bool) (map[string]interface{}, bool) {
+	keys := strings.Split(path, ".")
+
+	o := conf
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := o[key].(map[string]interface{})
+		if !ok {
+			if !create {
+				return nil, false
+			}
+			child = make(map[string]interface{})
+			o[key] = child
+		}
+		o = child
+	}
+
+	return o, true
+}
+
+// Get the last key of dotted path.
+func configKey(path string) string {
+	if pos := strings.LastIndex(path, "."); pos >= 0 {
+		return path[pos+1:]
+	}
+	return path
+}
@@ -22,8 +22,11 @@
 package options_test
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	oo "github.com/ossrs/go-oryx-lib/options"
+	"io/ioutil"
 	"os"
 )
 
@@ -45,3 +48,42 @@ func ExampleOptions() {
 	// Use the config file.
 	_ = f
 }
+
+func ExampleDeprecate() {
+	// The -listen is renamed to -rtmp-listen, while the old one still works with warning.
+	var listen string
+	flag.StringVar(&listen, "rtmp-listen", ":1935", "The RTMP listen address")
+	oo.Deprecate("listen", "rtmp-listen")
+
+	// The field of config is renamed, which is dotted path for nested object.
+	oo.Deprecate("log_file", "log.file")
+
+	configFile := oo.ParseArgv("conf/console.json", "1.0", "GoOryx/1.0")
+
+	var conf map[string]interface{}
+	if b, err := ioutil.ReadFile(configFile); err != nil || json.Unmarshal(b, &conf) != nil {
+		return
+	}
+
+	// Migrate the old fields to new ones, then use the config.
+	oo.MigrateConfig(conf)
+}
+
+func ExampleByteSize() {
+	var conf struct {
+		Timeout oo.Duration `json:"timeout"`
+		Buffer  oo.ByteSize `json:"buffer"`
+		Limit   oo.BitRate  `json:"limit"`
+	}
+
+	// The flags override the config, for example, -limit 2Mbps
+	flag.Var(&conf.Limit, "limit", "The bitrate limit, for example, 2Mbps")
+
+	if err := json.Unmarshal([]byte(`{"timeout":"30s","buffer":"10MB","limit":"800kbps"}`), &conf); err != nil {
+		return
+	}
+	fmt.Println(conf.Timeout.Duration(), int64(conf.Buffer), conf.Limit.BytesPerSecond())
+
+	// Output:
+	// 30s 10485760 100000
+}
@@ -25,6 +25,8 @@
 //		-g, to print signature and quit.
 //		-h, to print help and quit.
 // We return the parsed config file path.
+// To rename the options, declare the deprecated names by Deprecate.
+// To parse the values with units, such as "500ms" or "10MB", use Duration, ByteSize and BitRate.
 package options
 
 import (
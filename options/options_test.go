@@ -21,7 +21,109 @@
 
 package options
 
-import "testing"
+import (
+	"encoding/json"
+	"flag"
+	"testing"
+	"time"
+)
 
 func TestOptions(t *testing.T) {
 }
+
+func TestMigrateConfig(t *testing.T) {
+	Deprecate("listen", "rtmp.listen")
+	Deprecate("log_file", "log.file")
+
+	conf := map[string]interface{}{
+		"listen":   1935,
+		"log_file": "objs/srs.log",
+		"log":      map[string]interface{}{"file": "objs/oryx.log"},
+	}
+	if n := MigrateConfig(conf); n != 1 {
+		t.Errorf("migrated %v, want 1", n)
+	}
+
+	if v := conf["rtmp"].(map[string]interface{})["listen"]; v != 1935 {
+		t.Errorf("rtmp.listen is %v", v)
+	}
+	if v := conf["log"].(map[string]interface{})["file"]; v != "objs/oryx.log" {
+		t.Errorf("log.file is %v", v)
+	}
+	if _, ok := conf["listen"]; ok {
+		t.Error("listen not removed")
+	}
+}
+
+func TestDeprecate_Flag(t *testing.T) {
+	var listen string
+	flag.StringVar(&listen, "rtmp-listen", ":1935", "The listen address")
+	Deprecate("listen", "rtmp-listen")
+
+	if err := flag.CommandLine.Parse([]string{"-listen", ":19350"}); err != nil {
+		t.Fatal(err)
+	}
+	if listen != ":19350" {
+		t.Errorf("listen is %v", listen)
+	}
+}
+
+func TestUnits(t *testing.T) {
+	var conf struct {
+		Timeout Duration `json:"timeout"`
+		Window  Duration `json:"window"`
+		Buffer  ByteSize `json:"buffer"`
+		Limit   BitRate  `json:"limit"`
+	}
+	if err := json.Unmarshal([]byte(`{"timeout":"500ms","window":30,"buffer":"1.5GB","limit":"1.5Gbps"}`), &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Timeout.Duration() != 500*time.Millisecond || conf.Window.Duration() != 30*time.Second {
+		t.Errorf("invalid duration %v, %v", conf.Timeout, conf.Window)
+	}
+	if conf.Buffer != 1536*MegaByte || conf.Limit != 1500*MegaBitPerSecond {
+		t.Errorf("invalid buffer %v, limit %v", conf.Buffer, conf.Limit)
+	}
+
+	if b, err := json.Marshal(&conf); err != nil || string(b) != `{"timeout":"500ms","window":"30s","buffer":"1536MB","limit":"1500Mbps"}` {
+		t.Errorf("marshal %s, err is %v", b, err)
+	}
+
+	pvs := []struct {
+		s    string
+		size ByteSize
+		ok   bool
+	}{
+		{"1024", 1024, true}, {"10MB", 10 * MegaByte, true}, {"10 mb", 10 * MegaByte, true},
+		{"2k", 2 * KiloByte, true}, {"1500B", 1500, true}, {"MB", 0, false}, {"-1KB", 0, false},
+		{"NaN", 0, false}, {"nan KB", 0, false}, {"Inf", 0, false}, {"+infMB", 0, false}, {"-Inf", 0, false},
+		{"8388607TB", 8388607 * TeraByte, true}, {"8388608TB", 0, false}, {"1e30", 0, false},
+		{"9223372036854775807", 0, false},
+	}
+	for _, pv := range pvs {
+		if v, err := ParseByteSize(pv.s); (err == nil) != pv.ok || v != pv.size {
+			t.Errorf("parse %v got %v, err is %v", pv.s, v, err)
+		}
+	}
+
+	if v, err := ParseBitRate("800kbps"); err != nil || v != 800*KiloBitPerSecond || v.BytesPerSecond() != 100000 {
+		t.Errorf("parse bitrate got %v, err is %v", v, err)
+	}
+
+	if v, err := ParseBitRate("9223372036854775Gbps"); err == nil {
+		t.Errorf("parse bitrate should overflow, got %v", v)
+	}
+	if err := json.Unmarshal([]byte(`{"buffer":1e30}`), &conf); err == nil {
+		t.Error("should fail for overflow number")
+	}
+	if err := json.Unmarshal([]byte(`{"timeout":-1}`), &conf); err == nil {
+		t.Error("should fail for negative number")
+	}
+
+	var d Duration
+	fs := flag.NewFlagSet("units", flag.ContinueOnError)
+	fs.Var(&d, "timeout", "The timeout")
+	if err := fs.Parse([]string{"-timeout", "2h"}); err != nil || d.Duration() != 2*time.Hour {
+		t.Errorf("flag got %v, err is %v", d, err)
+	}
+}
@@ -0,0 +1,251 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The typed options with units, for both the flags and the fields of config, for example:
+//		Timeout options.Duration `json:"timeout"` // "500ms", "2h"
+//		Buffer  options.ByteSize `json:"buffer"`  // "10MB"
+//		Limit   options.BitRate  `json:"limit"`   // "1.5Gbps"
+// Use flag.Var for flags, for example:
+//		flag.Var(&conf.Timeout, "timeout", "The timeout, for example, 30s")
+// The timeouts of rtmp and the windows of kxps in config are parsed by Duration, for example,
+// the rtmp.AcceptTimeouts, rtmp.WritePolicy, rtmp.TransactionPolicy and kxps.ThresholdMetric.
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The duration parsed by time.ParseDuration, for example, "500ms" or "2h".
+// @remark The number in config is in seconds, for example, 30 is 30s.
+type Duration time.Duration
+
+// Get the time.Duration, for example, the timeout of rtmp or the window of kxps.
+func (v Duration) Duration() time.Duration {
+	return time.Duration(v)
+}
+
+func (v Duration) String() string {
+	return time.Duration(v).String()
+}
+
+func (v *Duration) Set(s string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return oe.Wrapf(err, "parse duration %v", s)
+	}
+
+	*v = Duration(d)
+	return nil
+}
+
+func (v Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+func (v *Duration) UnmarshalJSON(data []byte) error {
+	return unmarshalUnits(data, v, float64(time.Second), func(n int64) {
+		*v = Duration(n)
+	})
+}
+
+// The size in bytes, the units are B, KB, MB, GB and TB, in base 1024, for example,
+// "10MB" or "1.5GB", case insensitive and the B is optional.
+type ByteSize int64
+
+// The units of ByteSize.
+const (
+	Byte     ByteSize = 1
+	KiloByte          = 1024 * Byte
+	MegaByte          = 1024 * KiloByte
+	GigaByte          = 1024 * MegaByte
+	TeraByte          = 1024 * GigaByte
+)
+
+var byteSizeUnits = []unit{
+	{"tb", float64(TeraByte)}, {"gb", float64(GigaByte)}, {"mb", float64(MegaByte)}, {"kb", float64(KiloByte)},
+	{"t", float64(TeraByte)}, {"g", float64(GigaByte)}, {"m", float64(MegaByte)}, {"k", float64(KiloByte)},
+	{"b", float64(Byte)},
+}
+
+// Parse the size in bytes, for example, "10MB".
+func ParseByteSize(s string) (ByteSize, error) {
+	n, err := parseUnits(s, byteSizeUnits)
+	return ByteSize(n), err
+}
+
+func (v ByteSize) String() string {
+	return formatUnits(int64(v), []unit{
+		{"TB", float64(TeraByte)}, {"GB", float64(GigaByte)}, {"MB", float64(MegaByte)}, {"KB", float64(KiloByte)},
+	}, "B")
+}
+
+func (v *ByteSize) Set(s string) (err error) {
+	*v, err = ParseByteSize(s)
+	return
+}
+
+func (v ByteSize) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+// @remark The number in config is in bytes.
+func (v *ByteSize) UnmarshalJSON(data []byte) error {
+	return unmarshalUnits(data, v, float64(Byte), func(n int64) {
+		*v = ByteSize(n)
+	})
+}
+
+// The bitrate in bits per second, the units are bps, kbps, Mbps and Gbps, in base 1000,
+// for example, "800kbps" or "1.5Gbps", case insensitive and the bps is optional.
+type BitRate int64
+
+// The units of BitRate.
+const (
+	BitPerSecond     BitRate = 1
+	KiloBitPerSecond         = 1000 * BitPerSecond
+	MegaBitPerSecond         = 1000 * KiloBitPerSecond
+	GigaBitPerSecond         = 1000 * MegaBitPerSecond
+)
+
+var bitRateUnits = []unit{
+	{"gbps", float64(GigaBitPerSecond)}, {"mbps", float64(MegaBitPerSecond)}, {"kbps", float64(KiloBitPerSecond)},
+	{"g", float64(GigaBitPerSecond)}, {"m", float64(MegaBitPerSecond)}, {"k", float64(KiloBitPerSecond)},
+	{"bps", float64(BitPerSecond)},
+}
+
+// Parse the bitrate in bps, for example, "1.5Gbps".
+func ParseBitRate(s string) (BitRate, error) {
+	n, err := parseUnits(s, bitRateUnits)
+	return BitRate(n), err
+}
+
+// The bytes per second, for example, to limit the bandwidth.
+func (v BitRate) BytesPerSecond() int64 {
+	return int64(v) / 8
+}
+
+func (v BitRate) String() string {
+	return formatUnits(int64(v), []unit{
+		{"Gbps", float64(GigaBitPerSecond)}, {"Mbps", float64(MegaBitPerSecond)}, {"kbps", float64(KiloBitPerSecond)},
+	}, "bps")
+}
+
+func (v *BitRate) Set(s string) (err error) {
+	*v, err = ParseBitRate(s)
+	return
+}
+
+func (v BitRate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+// @remark The number in config is in bps.
+func (v *BitRate) UnmarshalJSON(data []byte) error {
+	return unmarshalUnits(data, v, float64(BitPerSecond), func(n int64) {
+		*v = BitRate(n)
+	})
+}
+
+// The unit name and the value of unit.
+type unit struct {
+	name  string
+	value float64
+}
+
+// Parse the number with optional unit, the units are in lowercase and matched in order.
+func parseUnits(s string, units []unit) (int64, error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+
+	scale := float64(1)
+	for _, u := range units {
+		if strings.HasSuffix(t, u.name) {
+			t, scale = strings.TrimSpace(strings.TrimSuffix(t, u.name)), u.value
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil {
+		return 0, oe.Wrapf(err, "parse %v", s)
+	}
+
+	r, err := toUnits(n, scale)
+	if err != nil {
+		return 0, oe.WithMessage(err, s)
+	}
+	return r, nil
+}
+
+// Convert the n of scale to int64, round to the nearest, for example, 1.1kbps is 1100bps.
+// @remark The NaN, Inf, negative number and the overflow of int64 are rejected.
+func toUnits(n, scale float64) (int64, error) {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, oe.Errorf("invalid number %v", n)
+	}
+	if n < 0 {
+		return 0, oe.Errorf("negative %v", n)
+	}
+
+	// The MaxInt64 in float64 is 2^63, which overflows int64.
+	if n = n*scale + 0.5; n >= math.MaxInt64 {
+		return 0, oe.Errorf("overflow %v", n)
+	}
+	return int64(n), nil
+}
+
+// Format the number in the largest unit which divides it exactly, the units are in descending order.
+func formatUnits(n int64, units []unit, base string) string {
+	for _, u := range units {
+		if value := int64(u.value); n != 0 && n%value == 0 {
+			return fmt.Sprintf("%v%v", n/value, u.name)
+		}
+	}
+	return fmt.Sprintf("%v%v", n, base)
+}
+
+// Unmarshal the string with units by flag.Value, or the number of scale by f.
+func unmarshalUnits(data []byte, v interface {
+	Set(s string) error
+}, scale float64, f func(n int64)) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return v.Set(s)
+	}
+
+	var n float64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return oe.Wrapf(err, "unmarshal %s", data)
+	}
+
+	r, err := toUnits(n, scale)
+	if err != nil {
+		return oe.WithMessage(err, string(data))
+	}
+
+	f(r)
+	return nil
+}
@@ -0,0 +1,186 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The server side accept of RTMP, with timeouts to protect from slowloris clients.
+package rtmp
+
+import (
+	"encoding/json"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	oo "github.com/ossrs/go-oryx-lib/options"
+	"net"
+	"time"
+)
+
+// The stages of server accept, to identify where the client stalls.
+const (
+	AcceptStageC0C1    = "c0c1"
+	AcceptStageC2      = "c2"
+	AcceptStageConnect = "connect"
+)
+
+// The timeouts for each stage of server accept, zero to disable.
+// @remark The timeout is the deadline of whole stage rather than each read, so
+// the client can not keep the connection by trickling bytes.
+type AcceptTimeouts struct {
+	// To read the C0 and C1, then write the S0, S1 and S2.
+	C0C1 time.Duration
+	// To read the C2.
+	C2 time.Duration
+	// To read the connect command.
+	Connect time.Duration
+	// The hook when client stalls at stage, optional. The connection is closed
+	// by ServerAccept before the hook.
+	OnStall func(addr net.Addr, stage string)
+}
+
+// The default timeouts to accept client.
+var DefaultAcceptTimeouts = AcceptTimeouts{
+	C0C1:    time.Duration(5) * time.Second,
+	C2:      time.Duration(5) * time.Second,
+	Connect: time.Duration(10) * time.Second,
+}
+
+// The timeouts in config, with units, for example:
+//		{"c0c1": "5s", "c2": "5s", "connect": "10s"}
+type acceptTimeoutsConfig struct {
+	C0C1    oo.Duration `json:"c0c1"`
+	C2      oo.Duration `json:"c2"`
+	Connect oo.Duration `json:"connect"`
+}
+
+func (v AcceptTimeouts) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&acceptTimeoutsConfig{
+		C0C1: oo.Duration(v.C0C1), C2: oo.Duration(v.C2), Connect: oo.Duration(v.Connect),
+	})
+}
+
+// @remark The absent fields are not changed, so user can unmarshal over DefaultAcceptTimeouts.
+func (v *AcceptTimeouts) UnmarshalJSON(data []byte) error {
+	c := &acceptTimeoutsConfig{
+		C0C1: oo.Duration(v.C0C1), C2: oo.Duration(v.C2), Connect: oo.Duration(v.Connect),
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return oe.Wrap(err, "unmarshal timeouts")
+	}
+
+	v.C0C1, v.C2, v.Connect = c.C0C1.Duration(), c.C2.Duration(), c.Connect.Duration()
+	return nil
+}
+
+// Accept the client c, do the complex or simple handshake and read the connect command, use
+// DefaultAcceptTimeouts if timeouts is nil.
+// @remark The c is closed when any error, and the stalled client is logged.
+func ServerAccept(c net.Conn, hs *Handshake, timeouts *AcceptTimeouts) (p *Protocol, connect *ConnectAppPacket, err error) {
+	if timeouts == nil {
+		timeouts = &DefaultAcceptTimeouts
+	}
+
+	// Capture the handshake bytes if enabled, to save the failed handshake.
+	rw, crw := hs.capture(c)
+
+	stage := AcceptStageC0C1
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		c.Close()
+
+		if stage != AcceptStageConnect {
+			hs.saveCapture(crw, true)
+		}
+
+		if ne, ok := oe.Cause(err).(net.Error); !ok || !ne.Timeout() {
+			return
+		}
+
+		ol.Wf(nil, "rtmp client %v stall at %v, err is %v", c.RemoteAddr(), stage, err)
+		if timeouts.OnStall != nil {
+			timeouts.OnStall(c.RemoteAddr(), stage)
+		}
+	}()
+
+	if err = setDeadline(c, timeouts.C0C1); err != nil {
+		return nil, nil, oe.Wrap(err, "set deadline")
+	}
+
+	if _, err = hs.ReadC0S0(rw); err != nil {
+		return nil, nil, oe.WithMessage(err, "read c0")
+	}
+
+	var c1 []byte
+	if c1, err = hs.ReadC1S1(rw); err != nil {
+		return nil, nil, oe.WithMessage(err, "read c1")
+	}
+
+	// Use the complex handshake if client supports it, or fallback to simple.
+	var s1 []byte
+	var complex bool
+	if s1, complex, err = hs.WriteS0S1S2(rw, c1); err != nil {
+		return nil, nil, oe.WithMessage(err, "write s0s1s2")
+	}
+
+	stage = AcceptStageC2
+	if err = setDeadline(c, timeouts.C2); err != nil {
+		return nil, nil, oe.Wrap(err, "set deadline")
+	}
+
+	var c2 []byte
+	if c2, err = hs.ReadC2S2(rw); err != nil {
+		return nil, nil, oe.WithMessage(err, "read c2")
+	}
+
+	// Some clients send invalid C2, so we only warn it, except the strict mode.
+	if !ValidateC2(c2, s1, complex) {
+		if err = hs.violate(1+1536, RuleC2Echo, "invalid c2, complex=%v", complex); err != nil {
+			return nil, nil, err
+		}
+		ol.Wf(nil, "rtmp client %v ignore invalid c2, complex=%v", c.RemoteAddr(), complex)
+		hs.saveCapture(crw, true)
+	}
+
+	stage = AcceptStageConnect
+	if err = setDeadline(c, timeouts.Connect); err != nil {
+		return nil, nil, oe.Wrap(err, "set deadline")
+	}
+
+	p = NewProtocol(c)
+	p.SetComplianceMode(hs.mode)
+	if _, err = p.ExpectPacket(&connect); err != nil {
+		return nil, nil, oe.WithMessage(err, "expect connect")
+	}
+
+	if err = c.SetDeadline(time.Time{}); err != nil {
+		return nil, nil, oe.Wrap(err, "reset deadline")
+	}
+
+	return
+}
+
+// Set the deadline after timeout, or no deadline if timeout is zero.
+func setDeadline(c net.Conn, timeout time.Duration) error {
+	if timeout <= 0 {
+		return c.SetDeadline(time.Time{})
+	}
+	return c.SetDeadline(time.Now().Add(timeout))
+}
@@ -0,0 +1,223 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The admission control for RTMP server, to protect server from connection storms.
+package rtmp
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/https/time/rate"
+	"net"
+	"sync"
+)
+
+// The reason why the admission reject a connection or publisher.
+type RejectReason uint8
+
+const (
+	RejectReasonMaxConnections RejectReason = iota + 1
+	RejectReasonConnectRate
+	RejectReasonMaxPublishers
+)
+
+func (v RejectReason) String() string {
+	switch v {
+	case RejectReasonMaxConnections:
+		return "MaxConnections"
+	case RejectReasonConnectRate:
+		return "ConnectRate"
+	case RejectReasonMaxPublishers:
+		return "MaxPublishers"
+	default:
+		return "Unknown"
+	}
+}
+
+// The status code in onStatus or _error response for rejected client.
+const (
+	StatusConnectRejected = "NetConnection.Connect.Rejected"
+	StatusPublishRejected = "NetStream.Publish.Rejected"
+)
+
+// The standard rejection of admission, user can use it to response the client.
+type AdmissionError struct {
+	Reason RejectReason
+	// The remote address of client, nil if unknown.
+	Addr net.Addr
+	// The vhost and app of publisher, empty for connection.
+	Vhost, App string
+}
+
+func (v *AdmissionError) Error() string {
+	if v.Reason == RejectReasonMaxPublishers {
+		return fmt.Sprintf("rejected by %v, addr=%v, vhost=%v, app=%v", v.Reason, v.Addr, v.Vhost, v.App)
+	}
+	return fmt.Sprintf("rejected by %v, addr=%v", v.Reason, v.Addr)
+}
+
+// The status code for the client, see StatusConnectRejected and StatusPublishRejected.
+func (v *AdmissionError) Code() string {
+	if v.Reason == RejectReasonMaxPublishers {
+		return StatusPublishRejected
+	}
+	return StatusConnectRejected
+}
+
+// The description for client in onStatus or _error response.
+func (v *AdmissionError) Description() string {
+	switch v.Reason {
+	case RejectReasonMaxConnections:
+		return "Server is busy, too many connections"
+	case RejectReasonConnectRate:
+		return "Server is busy, connect too frequently"
+	case RejectReasonMaxPublishers:
+		return "Server is busy, too many publishers"
+	default:
+		return "Rejected"
+	}
+}
+
+// The config for admission, zero value means no limit.
+type AdmissionConfig struct {
+	// The max number of connections of server.
+	MaxConnections int
+	// The max number of publishers for each vhost/app.
+	MaxPublishers int
+	// The max connections accepted per second, and the burst of connections.
+	// @remark The burst is set to 1 if not specified.
+	ConnectRate  float64
+	ConnectBurst int
+	// The hook when reject a connection or publisher, optional.
+	OnReject func(err *AdmissionError)
+}
+
+// The admission control for RTMP server, limit the connections and publishers.
+// @remark It's safe for concurrent use.
+type Admission struct {
+	conf    AdmissionConfig
+	limiter *rate.Limiter
+
+	lock        sync.Mutex
+	connections int
+	publishers  map[string]int
+}
+
+func NewAdmission(conf *AdmissionConfig) *Admission {
+	v := &Admission{publishers: map[string]int{}}
+	if conf != nil {
+		v.conf = *conf
+	}
+
+	if v.conf.ConnectRate > 0 {
+		burst := v.conf.ConnectBurst
+		if burst <= 0 {
+			burst = 1
+		}
+		v.limiter = rate.NewLimiter(rate.Limit(v.conf.ConnectRate), burst)
+	}
+
+	return v
+}
+
+// Get the number of connections and publishers of vhost/app.
+func (v *Admission) Connections() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.connections
+}
+
+func (v *Admission) Publishers(vhost, app string) int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.publishers[publisherKey(vhost, app)]
+}
+
+// Admit a new connection from addr, user must call release when connection closed.
+// @return An *AdmissionError when rejected.
+func (v *Admission) AdmitConnection(addr net.Addr) (release func(), err error) {
+	if v.limiter != nil && !v.limiter.Allow() {
+		return nil, v.reject(&AdmissionError{Reason: RejectReasonConnectRate, Addr: addr})
+	}
+
+	if err = func() error {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+
+		if v.conf.MaxConnections > 0 && v.connections >= v.conf.MaxConnections {
+			return &AdmissionError{Reason: RejectReasonMaxConnections, Addr: addr}
+		}
+		v.connections++
+		return nil
+	}(); err != nil {
+		return nil, v.reject(err.(*AdmissionError))
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			v.lock.Lock()
+			defer v.lock.Unlock()
+			v.connections--
+		})
+	}, nil
+}
+
+// Admit a new publisher for vhost/app, user must call release when unpublish.
+// @return An *AdmissionError when rejected.
+func (v *Admission) AdmitPublisher(addr net.Addr, vhost, app string) (release func(), err error) {
+	key := publisherKey(vhost, app)
+
+	if err = func() error {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+
+		if v.conf.MaxPublishers > 0 && v.publishers[key] >= v.conf.MaxPublishers {
+			return &AdmissionError{Reason: RejectReasonMaxPublishers, Addr: addr, Vhost: vhost, App: app}
+		}
+		v.publishers[key]++
+		return nil
+	}(); err != nil {
+		return nil, v.reject(err.(*AdmissionError))
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			v.lock.Lock()
+			defer v.lock.Unlock()
+
+			if v.publishers[key]--; v.publishers[key] <= 0 {
+				delete(v.publishers, key)
+			}
+		})
+	}, nil
+}
+
+func (v *Admission) reject(err *AdmissionError) error {
+	if v.conf.OnReject != nil {
+		v.conf.OnReject(err)
+	}
+	return err
+}
+
+func publisherKey(vhost, app string) string {
+	return vhost + "/" + app
+}
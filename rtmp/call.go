@@ -0,0 +1,152 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The generic RPC of NetConnection.call, for custom server-side extensions like FMS.
+package rtmp
+
+import (
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+)
+
+// Please read @doc rtmp_specification_1.0.pdf, @page 51, @section 4.1.2. Call
+// The generic call packet, for arbitrary command name with any number of args,
+// and it's also the _result or _error of the call.
+type RPCPacket struct {
+	variantCallPacket
+	Args []amf0.Amf0
+}
+
+// Create a call packet for command name with args, the command object is null.
+func NewRPCPacket(name string, args ...amf0.Amf0) *RPCPacket {
+	v := &RPCPacket{Args: args}
+	v.CommandName = amf0.String(name)
+	v.CommandObject = amf0.NewNull()
+	return v
+}
+
+// Whether the packet is the _error response.
+func (v *RPCPacket) IsError() bool {
+	return v.CommandName == commandError
+}
+
+// Call the remote procedure name with args, wait for the _result or _error.
+// @remark The messages before the response are dropped, so it should be used
+// before publish or play, and user should set the deadline of connection.
+// @remark The call fails when transaction expired, see TransactionPolicy, user
+// can close the connection in OnError to unblock the reading on idle connection.
+// @return The response packet, and an error if it's the _error.
+func (v *Protocol) Call(name string, args ...amf0.Amf0) (res *RPCPacket, err error) {
+	pkt := NewRPCPacket(name, args...)
+	pkt.TransactionID = v.nextTransactionID()
+
+	if err = v.WritePacket(pkt, 0); err != nil {
+		return nil, oe.WithMessage(err, "write call")
+	}
+
+	// The transaction is removed when expired, then the call fails.
+	expired := func() error {
+		if v.pendingTransaction(pkt.TransactionID) {
+			return nil
+		}
+		return &TransactionError{
+			Reason: TransactionReasonTimeout, TransactionID: pkt.TransactionID, CommandName: pkt.CommandName,
+		}
+	}
+
+	for {
+		if err = expired(); err != nil {
+			return nil, err
+		}
+
+		var m *Message
+		if m, err = v.ReadMessage(); err != nil {
+			if terr := expired(); terr != nil {
+				return nil, oe.WithMessage(terr, err.Error())
+			}
+			return nil, oe.WithMessage(err, "read message")
+		}
+
+		// Drop the messages except the response of call, for example, the
+		// audio, video, onStatus or response of other request.
+		command, tid, ok := responseOf(m)
+		if !ok {
+			continue
+		}
+		if tid != pkt.TransactionID {
+			v.finishTransaction(tid)
+			continue
+		}
+
+		var p Packet
+		if p, err = v.DecodeMessage(m); err != nil {
+			return nil, oe.WithMessage(err, "decode message")
+		}
+
+		if res, ok := p.(*RPCPacket); ok {
+			if command == commandError {
+				return res, oe.Errorf("call %v failed", name)
+			}
+			return res, nil
+		}
+		return nil, oe.Errorf("call %v got %T", name, p)
+	}
+}
+
+// Parse the command name and transaction id, if the message is a _result or _error.
+func responseOf(m *Message) (command amf0.String, tid amf0.Number, ok bool) {
+	p := m.Payload
+	switch m.MessageType {
+	case MessageTypeAMF0Command:
+	case MessageTypeAMF3Command:
+		if len(p) == 0 {
+			return
+		}
+		p = p[1:]
+	default:
+		return
+	}
+
+	if err := command.UnmarshalBinary(p); err != nil {
+		return
+	}
+	if command != commandResult && command != commandError {
+		return
+	}
+
+	if err := tid.UnmarshalBinary(p[command.Size():]); err != nil {
+		return
+	}
+	return command, tid, true
+}
+
+// Generate a transaction id for call, which never conflicts with the connect and createStream.
+func (v *Protocol) nextTransactionID() amf0.Number {
+	v.input.ltransactions.Lock()
+	defer v.input.ltransactions.Unlock()
+
+	if v.input.lastTid < 2 {
+		v.input.lastTid = 2
+	}
+	v.input.lastTid++
+
+	return v.input.lastTid
+}
@@ -0,0 +1,260 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The capture of failed handshake and the offline analyzer, to diagnose the handshake
+// incompatibilities of encoders.
+package rtmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The size of C0C1C2 or S0S1S2.
+const handshakeSize = 1 + 1536 + 1536
+
+// The raw bytes of handshake, truncated if the handshake is not complete.
+type HandshakeCapture struct {
+	// The bytes from client, the C0, C1 and C2.
+	C0C1C2 []byte
+	// The bytes from server, the S0, S1 and S2.
+	S0S1S2 []byte
+}
+
+// Load the capture from files prefix.c0c1c2 and prefix.s0s1s2, see Save.
+func LoadHandshakeCapture(prefix string) (v *HandshakeCapture, err error) {
+	v = &HandshakeCapture{}
+	if v.C0C1C2, err = ioutil.ReadFile(prefix + ".c0c1c2"); err != nil {
+		return nil, oe.Wrap(err, "read c0c1c2")
+	}
+	if v.S0S1S2, err = ioutil.ReadFile(prefix + ".s0s1s2"); err != nil {
+		return nil, oe.Wrap(err, "read s0s1s2")
+	}
+	return
+}
+
+// Save the capture to files prefix.c0c1c2 and prefix.s0s1s2.
+func (v *HandshakeCapture) Save(prefix string) (err error) {
+	if err = ioutil.WriteFile(prefix+".c0c1c2", v.C0C1C2, 0644); err != nil {
+		return oe.Wrap(err, "write c0c1c2")
+	}
+	if err = ioutil.WriteFile(prefix+".s0s1s2", v.S0S1S2, 0644); err != nil {
+		return oe.Wrap(err, "write s0s1s2")
+	}
+	return
+}
+
+// Split the C0C1C2 or S0S1S2 to parts, the part is nil if not enough bytes.
+func splitHandshake(p []byte) (c0, c1, c2 []byte) {
+	if len(p) >= 1 {
+		c0 = p[:1]
+	}
+	if len(p) >= 1+1536 {
+		c1 = p[1 : 1+1536]
+	}
+	if len(p) >= handshakeSize {
+		c2 = p[1+1536 : handshakeSize]
+	}
+	return
+}
+
+// The result of analyzer, which explains each step of handshake.
+type HandshakeAnalysis struct {
+	// The schema of digest in C1 signed by Flash player, -1 for simple handshake.
+	C1Schema int
+	// The schema of digest in S1 signed by Flash media server, -1 for simple handshake.
+	S1Schema int
+	// For complex handshake, whether signed for the digest of peer, otherwise echo the peer.
+	S2Valid bool
+	C2Valid bool
+	// The explanation of each step.
+	Notes []string
+}
+
+func (v *HandshakeAnalysis) notef(format string, a ...interface{}) {
+	v.Notes = append(v.Notes, fmt.Sprintf(format, a...))
+}
+
+func (v *HandshakeAnalysis) String() string {
+	return strings.Join(v.Notes, "\n")
+}
+
+// Analyze the handshake, to explain which schema or digest failed.
+func (v *HandshakeCapture) Analyze() *HandshakeAnalysis {
+	a := &HandshakeAnalysis{C1Schema: -1, S1Schema: -1}
+
+	c0, c1, c2 := splitHandshake(v.C0C1C2)
+	s0, s1, s2 := splitHandshake(v.S0S1S2)
+
+	analyzeC0S0(a, "C0", c0)
+	a.C1Schema = analyzeC1S1(a, "C1", c1, genuineFPKey[:30], "Flash player")
+
+	analyzeC0S0(a, "S0", s0)
+	a.S1Schema = analyzeC1S1(a, "S1", s1, genuineFMSKey[:36], "Flash media server")
+
+	// The server uses the complex handshake when C1 is valid, see WriteS0S1S2.
+	if s2 == nil {
+		a.notef("S2 is truncated, %v bytes", len(v.S0S1S2))
+	} else if a.C1Schema < 0 {
+		if a.S2Valid = c1 != nil && simpleEchoed(s2, c1); a.S2Valid {
+			a.notef("S2 echoes C1, ok for simple handshake")
+		} else {
+			a.notef("S2 does not echo C1, invalid for simple handshake")
+		}
+	} else {
+		_, digest := complexFindSchema(c1, genuineFPKey[:30])
+		if a.S2Valid = complexValidateC2S2(s2, digest, genuineFMSKey); a.S2Valid {
+			a.notef("S2 is signed by Flash media server for C1 digest, ok for complex handshake")
+		} else {
+			a.notef("S2 is not signed by Flash media server for C1 digest, invalid for complex handshake")
+		}
+	}
+
+	// The client uses the complex handshake when S1 is valid, see ClientHandshake.
+	if c2 == nil {
+		a.notef("C2 is truncated, %v bytes", len(v.C0C1C2))
+	} else if a.S1Schema < 0 || a.C1Schema < 0 {
+		if a.C2Valid = s1 != nil && simpleEchoed(c2, s1); a.C2Valid {
+			a.notef("C2 echoes S1, ok for simple handshake")
+		} else {
+			a.notef("C2 does not echo S1, invalid for simple handshake")
+		}
+	} else {
+		_, digest := complexFindSchema(s1, genuineFMSKey[:36])
+		if a.C2Valid = complexValidateC2S2(c2, digest, genuineFPKey); a.C2Valid {
+			a.notef("C2 is signed by Flash player for S1 digest, ok for complex handshake")
+		} else if simpleEchoed(c2, s1) {
+			a.notef("C2 echoes S1, the client does simple handshake for complex S1")
+		} else {
+			a.notef("C2 is not signed by Flash player for S1 digest, invalid for complex handshake")
+		}
+	}
+
+	return a
+}
+
+func analyzeC0S0(a *HandshakeAnalysis, name string, p []byte) {
+	if p == nil {
+		a.notef("%v is missing", name)
+	} else if p[0] != 0x03 {
+		a.notef("%v version %v is not 3", name, p[0])
+	}
+}
+
+// Analyze the C1S1, return the schema of digest signed by key, or -1 if simple.
+func analyzeC1S1(a *HandshakeAnalysis, name string, p, key []byte, signer string) int {
+	if p == nil {
+		a.notef("%v is truncated", name)
+		return -1
+	}
+
+	version := binary.BigEndian.Uint32(p[4:8])
+	if version == 0 {
+		a.notef("%v version is 0, simple handshake", name)
+		return -1
+	}
+
+	schema, _ := complexFindSchema(p, key)
+	if schema < 0 {
+		a.notef("%v version %#x, no digest signed by %v at schema0(pos=%v) or schema1(pos=%v), simple handshake",
+			name, version, signer, complexDigestPos(p, complexSchema0Digest), complexDigestPos(p, complexSchema1Digest))
+		return -1
+	}
+
+	a.notef("%v version %#x, digest signed by %v at schema%v, complex handshake", name, version, signer, schema)
+	return schema
+}
+
+// The read writer to record the handshake bytes, the in and out are at most handshakeSize.
+type captureReadWriter struct {
+	rw      io.ReadWriter
+	in, out []byte
+}
+
+func (v *captureReadWriter) Read(p []byte) (n int, err error) {
+	n, err = v.rw.Read(p)
+	v.in = appendHandshake(v.in, p[:n])
+	return
+}
+
+func (v *captureReadWriter) Write(p []byte) (n int, err error) {
+	n, err = v.rw.Write(p)
+	v.out = appendHandshake(v.out, p[:n])
+	return
+}
+
+func appendHandshake(dst, p []byte) []byte {
+	if left := handshakeSize - len(dst); len(p) > left {
+		p = p[:left]
+	}
+	return append(dst, p...)
+}
+
+// Capture the handshake bytes, and save the failed handshake to files in dir,
+// the files are named by time and peer address, see HandshakeCapture.
+// @remark Disable it if dir is empty.
+func (v *Handshake) SetCaptureDir(dir string) {
+	v.captureDir = dir
+}
+
+// Wrap the rw to capture the handshake bytes, or nil if disabled.
+func (v *Handshake) capture(rw io.ReadWriter) (io.ReadWriter, *captureReadWriter) {
+	if v.captureDir == "" {
+		return rw, nil
+	}
+
+	crw := &captureReadWriter{rw: rw}
+	return crw, crw
+}
+
+// Save the captured bytes of failed handshake, where server indicates the in is C0C1C2.
+// @remark Ignore if peer sent nothing, for example, the health checks.
+func (v *Handshake) saveCapture(crw *captureReadWriter, server bool) {
+	if crw == nil || len(crw.in) == 0 {
+		return
+	}
+
+	capture := &HandshakeCapture{C0C1C2: crw.out, S0S1S2: crw.in}
+	if server {
+		capture.C0C1C2, capture.S0S1S2 = crw.in, crw.out
+	}
+
+	peer := "unknown"
+	if c, ok := crw.rw.(net.Conn); ok && c.RemoteAddr() != nil {
+		peer = strings.NewReplacer(":", "_", "/", "_", "[", "", "]", "").Replace(c.RemoteAddr().String())
+	}
+
+	prefix := filepath.Join(v.captureDir, fmt.Sprintf("handshake-%v-%v", time.Now().UnixNano(), peer))
+	if err := capture.Save(prefix); err != nil {
+		ol.Wf(nil, "rtmp ignore save handshake to %v, err is %+v", prefix, err)
+		return
+	}
+
+	ol.Tf(nil, "rtmp save failed handshake to %v, %v", prefix, strings.Replace(capture.Analyze().String(), "\n", ", ", -1))
+}
@@ -0,0 +1,123 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The typed timestamps of message, and the clock to pace messages.
+package rtmp
+
+import (
+	"sync"
+	"time"
+)
+
+// The timestamp of RTMP is 32 bits in ms, which rolls over about 49.7 days.
+const TimestampRollover = uint64(1) << 32
+
+// Get the timestamp of message as duration.
+func (v *Message) Time() time.Duration {
+	return time.Duration(v.Timestamp) * time.Millisecond
+}
+
+// Set the timestamp of message by duration, truncated to ms.
+func (v *Message) SetTime(d time.Duration) {
+	v.Timestamp = uint64(d / time.Millisecond)
+}
+
+// Get the delta from timestamp from to to, in ms, which considers the rollover, so it's
+// negative if to is before from, for example, the jitter of audio and video.
+func TimestampDelta(from, to uint64) time.Duration {
+	return time.Duration(int32(uint32(to)-uint32(from))) * time.Millisecond
+}
+
+// The unwrapper converts the 32 bits timestamps which might roll over, to the monotonic
+// time since first timestamp, for example:
+//		var u rtmp.TimestampUnwrapper
+//		for { m, err := p.ReadMessage(); t := u.Unwrap(m.Timestamp) }
+type TimestampUnwrapper struct {
+	started bool
+	last    uint64
+	current time.Duration
+}
+
+// Unwrap the timestamp, the first one is returned as is.
+func (v *TimestampUnwrapper) Unwrap(timestamp uint64) time.Duration {
+	if !v.started {
+		v.started, v.current = true, time.Duration(uint32(timestamp))*time.Millisecond
+	} else {
+		v.current += TimestampDelta(v.last, timestamp)
+	}
+
+	v.last = timestamp
+	return v.current
+}
+
+// The clock to pace the messages, for example, to play the VoD file as live, which can
+// be replaced by VirtualClock in tests.
+type Clock interface {
+	// Get the current time.
+	Now() time.Time
+	// Wait for the duration, like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+// The clock of system, by time.Now and time.After.
+var SystemClock Clock = &systemClock{}
+
+type systemClock struct {
+}
+
+func (v *systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (v *systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// The virtual clock, which advances when wait, so the pacing never blocks, for tests.
+type VirtualClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// Create a virtual clock starts at now.
+func NewVirtualClock(now time.Time) *VirtualClock {
+	return &VirtualClock{now: now}
+}
+
+func (v *VirtualClock) Now() time.Time {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.now
+}
+
+// Advance the clock by d, and the channel is fired immediately.
+func (v *VirtualClock) After(d time.Duration) <-chan time.Time {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if d > 0 {
+		v.now = v.now.Add(d)
+	}
+
+	c := make(chan time.Time, 1)
+	c <- v.now
+	return c
+}
@@ -0,0 +1,263 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The complex handshake of RTMP, also known as the digest handshake of FP9+,
+// which is required by Flash player, FMLE and some encoders.
+package rtmp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"io"
+)
+
+// The key of Flash player, 30 bytes text and 32 bytes random, the text is used to
+// sign the C1, and the whole key is used to sign the C2.
+var genuineFPKey = []byte{
+	'G', 'e', 'n', 'u', 'i', 'n', 'e', ' ', 'A', 'd', 'o', 'b', 'e', ' ',
+	'F', 'l', 'a', 's', 'h', ' ', 'P', 'l', 'a', 'y', 'e', 'r', ' ',
+	'0', '0', '1', // Genuine Adobe Flash Player 001
+	0xF0, 0xEE, 0xC2, 0x4A, 0x80, 0x68, 0xBE, 0xE8, 0x2E, 0x00, 0xD0, 0xD1,
+	0x02, 0x9E, 0x7E, 0x57, 0x6E, 0xEC, 0x5D, 0x2D, 0x29, 0x80, 0x6F, 0xAB,
+	0x93, 0xB8, 0xE6, 0x36, 0xCF, 0xEB, 0x31, 0xAE,
+}
+
+// The key of Flash media server, 36 bytes text and 32 bytes random, the text is
+// used to sign the S1, and the whole key is used to sign the S2.
+var genuineFMSKey = []byte{
+	'G', 'e', 'n', 'u', 'i', 'n', 'e', ' ', 'A', 'd', 'o', 'b', 'e', ' ',
+	'F', 'l', 'a', 's', 'h', ' ', 'M', 'e', 'd', 'i', 'a', ' ',
+	'S', 'e', 'r', 'v', 'e', 'r', ' ',
+	'0', '0', '1', // Genuine Adobe Flash Media Server 001
+	0xF0, 0xEE, 0xC2, 0x4A, 0x80, 0x68, 0xBE, 0xE8, 0x2E, 0x00, 0xD0, 0xD1,
+	0x02, 0x9E, 0x7E, 0x57, 0x6E, 0xEC, 0x5D, 0x2D, 0x29, 0x80, 0x6F, 0xAB,
+	0x93, 0xB8, 0xE6, 0x36, 0xCF, 0xEB, 0x31, 0xAE,
+}
+
+// The version in C1 and S1, which must not be zero for complex handshake.
+const (
+	complexClientVersion = uint32(0x80000702)
+	complexServerVersion = uint32(0x04050001)
+)
+
+// The C1S1 is time(4B), version(4B), then two 764 bytes blocks, the key and digest.
+// The schema0 is key-digest, the schema1 is digest-key, so the digest block starts
+// at these offsets. The digest block is offset(4B), random, digest(32B), random, where
+// the position of digest is calculated by the offset.
+const (
+	complexSchema0Digest = 8 + 764
+	complexSchema1Digest = 8
+)
+
+// Calculate the position of digest in C1S1, for the digest block at base.
+func complexDigestPos(p []byte, base int) int {
+	offset := int(p[base]) + int(p[base+1]) + int(p[base+2]) + int(p[base+3])
+	return base + 4 + offset%728
+}
+
+// Calculate the HMAC-SHA256 of p with key, excluding the 32 bytes digest at pos,
+// or the whole p if pos is negative.
+func complexDigest(key, p []byte, pos int) []byte {
+	h := hmac.New(sha256.New, key)
+	if pos < 0 {
+		h.Write(p)
+	} else {
+		h.Write(p[:pos])
+		h.Write(p[pos+32:])
+	}
+	return h.Sum(nil)
+}
+
+// Find and validate the digest of C1S1 signed by key, try schema0 then schema1.
+// Return nil if not a valid complex C1S1.
+func complexFindDigest(p, key []byte) []byte {
+	_, digest := complexFindSchema(p, key)
+	return digest
+}
+
+// Find and validate the digest of C1S1 signed by key, return the schema 0 or 1 and
+// the digest, or -1 if not a valid complex C1S1.
+func complexFindSchema(p, key []byte) (schema int, digest []byte) {
+	if len(p) != 1536 || binary.BigEndian.Uint32(p[4:8]) == 0 {
+		return -1, nil
+	}
+
+	for i, base := range []int{complexSchema0Digest, complexSchema1Digest} {
+		pos := complexDigestPos(p, base)
+		if hmac.Equal(p[pos:pos+32], complexDigest(key, p, pos)) {
+			return i, p[pos : pos+32]
+		}
+	}
+	return -1, nil
+}
+
+// Create the C1S1 of version, signed by key, in schema1.
+func (v *Handshake) createComplexC1S1(version uint32, key []byte) []byte {
+	p := make([]byte, 1536)
+	for i := 8; i < len(p); i++ {
+		p[i] = byte(v.r.Int())
+	}
+	binary.BigEndian.PutUint32(p[4:8], version)
+
+	pos := complexDigestPos(p, complexSchema1Digest)
+	copy(p[pos:], complexDigest(key, p, pos))
+	return p
+}
+
+// Create the C2S2 for the digest of peer C1S1, signed by key, the last 32 bytes is the digest.
+func (v *Handshake) createComplexC2S2(digest, key []byte) []byte {
+	p := make([]byte, 1536)
+	for i := 0; i < len(p)-32; i++ {
+		p[i] = byte(v.r.Int())
+	}
+
+	pos := len(p) - 32
+	copy(p[pos:], complexDigest(complexDigest(key, digest, -1), p, pos))
+	return p
+}
+
+// Validate the C2S2 for the digest of our C1S1, signed by key.
+func complexValidateC2S2(p, digest, key []byte) bool {
+	if len(p) != 1536 {
+		return false
+	}
+
+	pos := len(p) - 32
+	return hmac.Equal(p[pos:], complexDigest(complexDigest(key, digest, -1), p, pos))
+}
+
+// Write the S0, S1 and S2 for the C1 of client, use the complex handshake if C1 is
+// signed by Flash player, otherwise fallback to the simple handshake.
+// @return The S1 to validate the C2, see ValidateC2.
+func (v *Handshake) WriteS0S1S2(w io.Writer, c1 []byte) (s1 []byte, complex bool, err error) {
+	var s2 []byte
+	if digest := complexFindDigest(c1, genuineFPKey[:30]); digest != nil {
+		s1 = v.createComplexC1S1(complexServerVersion, genuineFMSKey[:36])
+		s2 = v.createComplexC2S2(digest, genuineFMSKey)
+		complex = true
+	} else {
+		s1, s2 = v.createSimpleC1S1(), c1
+	}
+
+	s0s1s2 := append(append([]byte{0x03}, s1...), s2...)
+	if _, err = io.Copy(w, bytes.NewReader(s0s1s2)); err != nil {
+		return nil, false, oe.Wrap(err, "write s0s1s2")
+	}
+
+	return
+}
+
+// Validate the C2 of client for the S1, for complex handshake, the C2 must be signed by
+// Flash player for the digest of S1, for simple handshake, the C2 must echo the S1 except
+// the time2, which the client may change.
+func ValidateC2(c2, s1 []byte, complex bool) bool {
+	if !complex {
+		return simpleEchoed(c2, s1)
+	}
+
+	digest := complexFindDigest(s1, genuineFMSKey[:36])
+	return digest != nil && complexValidateC2S2(c2, digest, genuineFPKey)
+}
+
+// Create the C1S1 of simple handshake.
+func (v *Handshake) createSimpleC1S1() []byte {
+	p := make([]byte, 1536)
+	for i := 8; i < len(p); i++ {
+		p[i] = byte(v.r.Int())
+	}
+	return p
+}
+
+// Do the client handshake over rw, use the complex handshake if complex, and fallback
+// to the simple handshake if server not supports it.
+// @return Whether the complex handshake is done.
+func (v *Handshake) ClientHandshake(rw io.ReadWriter, complex bool) (ok bool, err error) {
+	// Capture the handshake bytes if enabled, to save the failed handshake.
+	rw, crw := v.capture(rw)
+	defer func() {
+		if err != nil {
+			v.saveCapture(crw, false)
+		}
+	}()
+
+	c0c1 := []byte{0x03}
+	if complex {
+		c0c1 = append(c0c1, v.createComplexC1S1(complexClientVersion, genuineFPKey[:30])...)
+	} else {
+		c0c1 = append(c0c1, v.createSimpleC1S1()...)
+	}
+
+	if _, err = io.Copy(rw, bytes.NewReader(c0c1)); err != nil {
+		return false, oe.Wrap(err, "write c0c1")
+	}
+
+	if _, err = v.ReadC0S0(rw); err != nil {
+		return false, oe.WithMessage(err, "read s0")
+	}
+
+	var s1, s2 []byte
+	if s1, err = v.ReadC1S1(rw); err != nil {
+		return false, oe.WithMessage(err, "read s1")
+	}
+	if s2, err = v.ReadC2S2(rw); err != nil {
+		return false, oe.WithMessage(err, "read s2")
+	}
+
+	// Fallback to simple handshake, echo the S1.
+	var digest []byte
+	if complex {
+		digest = complexFindDigest(s1, genuineFMSKey[:36])
+	}
+	if digest == nil {
+		if !simpleEchoed(s2, c0c1[1:]) {
+			if err = v.violate(1+1536, RuleS2Echo, "s2 not echo c1"); err != nil {
+				return false, err
+			}
+		}
+		if err = v.WriteC2S2(rw, s1); err != nil {
+			return false, oe.WithMessage(err, "write c2")
+		}
+		return false, nil
+	}
+
+	c1 := c0c1[1:]
+	invalidS2 := !complexValidateC2S2(s2, complexFindDigest(c1, genuineFPKey[:30]), genuineFMSKey)
+	if invalidS2 {
+		if err = v.violate(1+1536, RuleS2Echo, "invalid complex s2"); err != nil {
+			return false, err
+		}
+		ol.Wf(nil, "rtmp ignore invalid complex s2")
+	}
+
+	if _, err = io.Copy(rw, bytes.NewReader(v.createComplexC2S2(digest, genuineFPKey))); err != nil {
+		return false, oe.Wrap(err, "write c2")
+	}
+
+	if invalidS2 {
+		v.saveCapture(crw, false)
+	}
+
+	return true, nil
+}
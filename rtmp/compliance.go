@@ -0,0 +1,159 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The compliance check of peer, for the spec rules tolerated for interoperability.
+package rtmp
+
+import (
+	"bytes"
+	"fmt"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"sync"
+	"sync/atomic"
+)
+
+// The mode to check the protocol compliance of peer, for the spec rules which are
+// tolerated by default, such as the C2 echo of handshake.
+type ComplianceMode uint8
+
+const (
+	// Tolerate the violations, the default mode.
+	ComplianceIgnore ComplianceMode = iota
+	// Record the violations and continue, see Violations, for conformance reports.
+	ComplianceReport
+	// Record the violations and error on them, for conformance test tools.
+	ComplianceStrict
+)
+
+func (v ComplianceMode) String() string {
+	switch v {
+	case ComplianceReport:
+		return "Report"
+	case ComplianceStrict:
+		return "Strict"
+	default:
+		return "Ignore"
+	}
+}
+
+// The rules of compliance check.
+const (
+	// Please read @doc rtmp_specification_1.0.pdf, @page 8, @section 5.2.4. C2 and S2 Format
+	// The C2 and S2 packets are 1536 octets long, and nearly an echo of S1 and C1 (respectively).
+	// For complex handshake, the C2 and S2 must be signed for the digest of S1 and C1.
+	RuleC2Echo = "c2-echo"
+	RuleS2Echo = "s2-echo"
+	// Please read @doc rtmp_specification_1.0.pdf, @page 13, @section 5.3.1.2. Chunk Message Header
+	// The type 0 chunk header MUST be used at the start of a chunk stream.
+	RuleFreshChunkFormat = "fresh-chunk-fmt"
+	// Please read @doc rtmp_specification_1.0.pdf, @page 18, @section 5.4. Protocol Control Messages
+	// The protocol control messages MUST have message stream ID 0 and be sent in chunk stream ID 2.
+	RuleControlChunkStream = "control-chunk-stream"
+	// Please read @doc rtmp_specification_1.0.pdf, @page 20, @section 5.4.4. Window Acknowledgement Size
+	// The peer should set the window acknowledgement size, before the media messages.
+	RuleWindowAckBeforeMedia = "window-ack-before-media"
+)
+
+// The violation of spec rule by peer.
+type Violation struct {
+	// The rule violated, for example, RuleC2Echo.
+	Rule string
+	// The position in bytes received from peer, when found the violation.
+	Offset uint64
+	// The detail of violation.
+	Detail string
+}
+
+func (v *Violation) String() string {
+	return fmt.Sprintf("%v at %vB, %v", v.Rule, v.Offset, v.Detail)
+}
+
+// The compliance check, which records the violations of peer.
+type compliance struct {
+	mode ComplianceMode
+
+	lock       sync.Mutex
+	violations []*Violation
+}
+
+// Set the mode to check the compliance of peer, default to ComplianceIgnore.
+// @remark Must be called before reading from peer.
+func (v *compliance) SetComplianceMode(mode ComplianceMode) {
+	v.mode = mode
+}
+
+// Get the violations of peer, in order of found, empty when ComplianceIgnore.
+// @remark It's safe to call it in other goroutines.
+func (v *compliance) Violations() []*Violation {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return append([]*Violation(nil), v.violations...)
+}
+
+// Handle the violation of rule by mode, return error in strict mode.
+func (v *compliance) violate(offset uint64, rule string, format string, a ...interface{}) error {
+	if v.mode == ComplianceIgnore {
+		return nil
+	}
+
+	violation := &Violation{Rule: rule, Offset: offset, Detail: fmt.Sprintf(format, a...)}
+
+	v.lock.Lock()
+	v.violations = append(v.violations, violation)
+	v.lock.Unlock()
+
+	if v.mode == ComplianceStrict {
+		return oe.Errorf("violate %v", violation)
+	}
+	return nil
+}
+
+// Check the compliance of message m from peer.
+func (v *Protocol) checkCompliance(m *Message) (err error) {
+	if v.mode == ComplianceIgnore {
+		return
+	}
+
+	offset := atomic.LoadUint64(&v.rw.in)
+
+	switch m.MessageType {
+	case MessageTypeSetChunkSize, MessageTypeAbort, MessageTypeAcknowledgement,
+		MessageTypeWindowAcknowledgementSize, MessageTypeSetPeerBandwidth:
+		if m.streamID != 0 || m.betterCid != chunkIDProtocolControl {
+			return v.violate(offset, RuleControlChunkStream, "message %v over stream %v, cid is %v",
+				m.MessageType, m.streamID, m.betterCid)
+		}
+	case MessageTypeAudio, MessageTypeVideo:
+		// Only report once, because all media messages violate it.
+		if v.input.ackWindow == 0 && !v.input.mediaBeforeAck {
+			v.input.mediaBeforeAck = true
+			return v.violate(offset, RuleWindowAckBeforeMedia, "message %v before window ack size", m.MessageType)
+		}
+	}
+
+	return
+}
+
+// Whether the C2S2 p echoes the C1S1, except the time2 which is the time when read C1S1.
+func simpleEchoed(p, c1s1 []byte) bool {
+	return len(p) == len(c1s1) && len(p) >= 8 && bytes.Equal(p[:4], c1s1[:4]) && bytes.Equal(p[8:], c1s1[8:])
+}
@@ -0,0 +1,166 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The write deadline and stall detection, to disconnect the slow peer on output path.
+package rtmp
+
+import (
+	"encoding/json"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	oo "github.com/ossrs/go-oryx-lib/options"
+	"net"
+	"time"
+)
+
+// The error when peer is too slow to receive messages, for example, the TCP zero window,
+// use oe.Cause(err) == ErrSlowPeer to identify it, and the caller should close the conn.
+var ErrSlowPeer = oe.New("slow peer")
+
+// The policy to disconnect the slow peer, which stalls the writer goroutine, zero to disable.
+// The write of message is a stall when it takes StallThreshold or longer, for example,
+// the send buffer of TCP is full, and the peer is slow when either:
+//		one write is not done in Timeout, by the write deadline of conn.
+//		the stalls in Window accumulate to MaxStall.
+// @remark The Timeout requires the underlayer supports SetWriteDeadline, such as net.Conn.
+type WritePolicy struct {
+	// The deadline of each write, zero to disable.
+	Timeout time.Duration
+	// The max cumulative stall in Window, zero to disable.
+	MaxStall time.Duration
+	// The write is a stall when takes this or longer.
+	StallThreshold time.Duration
+	// The window to accumulate the stalls, which is reset when elapsed.
+	Window time.Duration
+}
+
+// The default policy, which disconnects the peer stalls for 10s in 30s.
+var DefaultWritePolicy = WritePolicy{
+	Timeout:        time.Duration(10) * time.Second,
+	MaxStall:       time.Duration(10) * time.Second,
+	StallThreshold: time.Duration(100) * time.Millisecond,
+	Window:         time.Duration(30) * time.Second,
+}
+
+// The policy in config, with units, for example:
+//		{"timeout": "10s", "max_stall": "10s", "stall_threshold": "100ms", "window": "30s"}
+type writePolicyConfig struct {
+	Timeout        oo.Duration `json:"timeout"`
+	MaxStall       oo.Duration `json:"max_stall"`
+	StallThreshold oo.Duration `json:"stall_threshold"`
+	Window         oo.Duration `json:"window"`
+}
+
+func (v WritePolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&writePolicyConfig{
+		Timeout: oo.Duration(v.Timeout), MaxStall: oo.Duration(v.MaxStall),
+		StallThreshold: oo.Duration(v.StallThreshold), Window: oo.Duration(v.Window),
+	})
+}
+
+// @remark The absent fields are not changed, so user can unmarshal over DefaultWritePolicy.
+func (v *WritePolicy) UnmarshalJSON(data []byte) error {
+	c := &writePolicyConfig{
+		Timeout: oo.Duration(v.Timeout), MaxStall: oo.Duration(v.MaxStall),
+		StallThreshold: oo.Duration(v.StallThreshold), Window: oo.Duration(v.Window),
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return oe.Wrap(err, "unmarshal policy")
+	}
+
+	v.Timeout, v.MaxStall = c.Timeout.Duration(), c.MaxStall.Duration()
+	v.StallThreshold, v.Window = c.StallThreshold.Duration(), c.Window.Duration()
+	return nil
+}
+
+// The writer which supports deadline, for example, the net.Conn.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// Set the policy to disconnect slow peer, see WritePolicy.
+// @remark Once the peer is slow, all writes fail with ErrSlowPeer, because the
+// message might be partially written.
+func (v *Protocol) SetWritePolicy(policy WritePolicy) {
+	v.output.lock.Lock()
+	defer v.output.lock.Unlock()
+
+	v.output.policy = policy
+	v.output.stallStart, v.output.stalled = time.Time{}, 0
+}
+
+// Set the write deadline by policy, return the start time of write.
+// @remark The caller should hold the output lock.
+func (v *Protocol) beforeWrite() (start time.Time, err error) {
+	if v.output.slow != nil {
+		return start, v.output.slow
+	}
+
+	policy := &v.output.policy
+	if policy.Timeout <= 0 && policy.MaxStall <= 0 {
+		return
+	}
+
+	start = time.Now()
+	if policy.Timeout > 0 {
+		if c, ok := v.rw.rw.(writeDeadliner); ok {
+			if err = c.SetWriteDeadline(start.Add(policy.Timeout)); err != nil {
+				return start, oe.Wrap(err, "set write deadline")
+			}
+		}
+	}
+	return
+}
+
+// Account the write which starts at start, return ErrSlowPeer if the peer is slow.
+// @remark The caller should hold the output lock.
+func (v *Protocol) afterWrite(start time.Time, err error) error {
+	if start.IsZero() {
+		return err
+	}
+
+	policy := &v.output.policy
+	if err != nil {
+		if ne, ok := oe.Cause(err).(net.Error); ok && ne.Timeout() && policy.Timeout > 0 {
+			v.output.slow = oe.Wrapf(ErrSlowPeer, "write timeout %v, %v", policy.Timeout, err)
+			return v.output.slow
+		}
+		return err
+	}
+
+	if policy.MaxStall <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if policy.Window > 0 && now.Sub(v.output.stallStart) > policy.Window {
+		v.output.stallStart, v.output.stalled = now, 0
+	}
+
+	if elapsed := now.Sub(start); elapsed >= policy.StallThreshold {
+		v.output.stalled += elapsed
+	}
+
+	if v.output.stalled >= policy.MaxStall {
+		v.output.slow = oe.Wrapf(ErrSlowPeer, "stalled %v in %v", v.output.stalled, policy.Window)
+		return v.output.slow
+	}
+	return nil
+}
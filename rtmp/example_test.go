@@ -22,12 +22,17 @@
 package rtmp_test
 
 import (
+	"fmt"
 	"math/rand"
 	"net"
+	"os"
+	"strings"
 	"time"
 
-	"github.com/ossrs/go-oryx-lib/rtmp"
 	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"github.com/ossrs/go-oryx-lib/flv"
+	"github.com/ossrs/go-oryx-lib/rtmp"
 )
 
 func ExampleRtmpClientHandshake() {
@@ -86,3 +91,892 @@ func ExampleRtmpClientConnect() {
 		panic(err)
 	}
 }
+
+func ExampleAdmission() {
+	// Limit the server to 1000 connections, 10 publishers for each vhost/app,
+	// and accept 100 connections per second.
+	admission := rtmp.NewAdmission(&rtmp.AdmissionConfig{
+		MaxConnections: 1000,
+		MaxPublishers:  10,
+		ConnectRate:    100,
+		ConnectBurst:   200,
+		OnReject: func(err *rtmp.AdmissionError) {
+			// Notify the hooks, for example, log or alert.
+			_ = err
+		},
+	})
+
+	// Use it in server, which admits the connections and publishers.
+	var l net.Listener
+	s := rtmp.NewServer(l)
+	s.Admission = admission
+
+	// Or use it manually, when accept a TCP connection.
+	var c *net.TCPConn
+	release, err := admission.AdmitConnection(c.RemoteAddr())
+	if err != nil {
+		// Response the client by err.(*rtmp.AdmissionError).Code() and Description().
+		c.Close()
+		return
+	}
+	defer release()
+
+	// When client publish a stream.
+	unpublish, err := admission.AdmitPublisher(c.RemoteAddr(), "__defaultVhost__", "live")
+	if err != nil {
+		return
+	}
+	defer unpublish()
+}
+
+func ExampleRequest() {
+	// Parse the tcUrl when got the connect packet, see NewRequestFromConnect.
+	r, err := rtmp.NewRequest("rtmp://127.0.0.1/live?vhost=ossrs.net")
+	if err != nil {
+		panic(err)
+	}
+
+	// Set the stream when got the publish or play packet.
+	r.SetStream("livestream?token=xxx")
+	fmt.Println(r.StreamURL(), r.Param.Get("token"))
+
+	// Lookup the config of vhost.
+	vhosts := rtmp.StaticVhosts{
+		rtmp.DefaultVhost: &rtmp.VhostConfig{Name: rtmp.DefaultVhost},
+		"ossrs.net":       &rtmp.VhostConfig{Name: "ossrs.net", ChunkSize: 60000},
+	}
+	fmt.Println(vhosts.Lookup(r.Vhost).ChunkSize)
+
+	// Output:
+	// ossrs.net/live/livestream xxx
+	// 60000
+}
+
+func ExampleSwitcher() {
+	// The primary and backup stream, for example, the RTMP publishing clients.
+	var primary, backup *rtmp.Protocol
+
+	// The output stream, for example, the RTMP player.
+	var player *rtmp.Protocol
+
+	switcher := rtmp.NewSwitcher(primary, backup)
+	switcher.OnSwitch = func(from, to int) {
+		// Log or alert when failover.
+	}
+
+	for {
+		m, err := switcher.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if err = player.WriteMessage(m); err != nil {
+			return
+		}
+	}
+}
+
+func ExampleNewRelayMessage() {
+	// The publisher and players, see ExampleRtmpClientConnect.
+	var publisher *rtmp.Protocol
+	var players []*rtmp.Protocol
+
+	for {
+		m, err := publisher.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// Relay the message to players, the payload is shared and never decoded.
+		relay := rtmp.NewRelayMessage(m, 1)
+		for _, player := range players {
+			if err = player.WriteMessage(relay); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// The frames in memory, for example, the WebSocket bridge.
+type frameChan chan []byte
+
+func (v frameChan) ReadFrame() ([]byte, error) {
+	return <-v, nil
+}
+
+func (v frameChan) WriteFrame(frame []byte) error {
+	v <- append([]byte{}, frame...)
+	return nil
+}
+
+func ExampleNewFrameProtocol() {
+	// Drive the protocol over frames in memory, without TCP.
+	frames := make(frameChan, 16)
+	client, server := rtmp.NewFrameProtocol(frames), rtmp.NewFrameProtocol(frames)
+
+	connectApp := rtmp.NewConnectAppPacket()
+	connectApp.CommandObject.Set("tcUrl", amf0.NewString("rtmp://localhost/live"))
+	if err := client.WritePacket(connectApp, 0); err != nil {
+		panic(err)
+	}
+
+	var pkt *rtmp.ConnectAppPacket
+	if _, err := server.ExpectPacket(&pkt); err != nil {
+		panic(err)
+	}
+
+	r, err := rtmp.NewRequestFromConnect(pkt)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(r.Vhost, r.App)
+
+	// Output:
+	// localhost live
+}
+
+func ExampleMetadataNormalizer() {
+	// The metadata from encoder, for example, FMLE.
+	metadata := amf0.NewEcmaArray()
+	metadata.Set("duration", amf0.NewNumber(0))
+	metadata.Set("encoder", amf0.NewString("Lavf57.83.100"))
+
+	m := rtmp.NewStreamMessage(1)
+	m.MessageType = rtmp.MessageTypeAMF0Data
+	for _, a := range []amf0.Amf0{amf0.NewString("@setDataFrame"), amf0.NewString("onMetaData"), metadata} {
+		b, _ := a.MarshalBinary()
+		m.Payload = append(m.Payload, b...)
+	}
+
+	// Normalize it before relay to players.
+	n := rtmp.NewMetadataNormalizer()
+	r, err := n.Normalize(m)
+	if err != nil {
+		panic(err)
+	}
+
+	var name amf0.String
+	name.UnmarshalBinary(r.Payload)
+	normalized := amf0.NewEcmaArray()
+	normalized.UnmarshalBinary(r.Payload[name.Size():])
+	fmt.Println(name, normalized.Get("duration") == nil, *normalized.Get("server").(*amf0.String))
+
+	// Output:
+	// onMetaData true Oryx
+}
+
+func ExampleTransactionPolicy() {
+	frames := make(frameChan, 16)
+	client := rtmp.NewFrameProtocol(frames)
+
+	// Remove the request when the response not arrive in time, see DefaultTransactionPolicy.
+	client.SetTransactionPolicy(rtmp.TransactionPolicy{
+		Timeout: 10 * time.Millisecond,
+		Max:     2,
+		OnError: func(err *rtmp.TransactionError) {
+			fmt.Println(err)
+		},
+	})
+
+	if err := client.WritePacket(rtmp.NewCreateStreamPacket(), 0); err != nil {
+		panic(err)
+	}
+
+	// The expired transaction is removed, even no message arrives.
+	time.Sleep(20 * time.Millisecond)
+	fmt.Println(client.Transactions())
+
+	// Output:
+	// transaction Timeout, tid=2, command=createStream
+	// 0
+}
+
+func ExampleNewMessageFromTag() {
+	// The B-frame, which PTS is 40ms after DTS.
+	vp, _ := flv.NewVideoPackager()
+	tag, _ := vp.Encode(&flv.VideoFrame{
+		CodecID: flv.VideoCodecAVC, FrameType: flv.VideoFrameTypeInterframe,
+		Trait: flv.VideoFrameTraitNALU, CTS: 40,
+	})
+
+	// Convert the FLV tag to RTMP message, then back to FLV tag.
+	m := rtmp.NewMessageFromTag(flv.TagTypeVideo, 1000, tag, 1)
+	tagType, dts, tag := m.Tag()
+
+	frame, _ := vp.Decode(tag)
+	fmt.Println(tagType, dts, frame.PTS(dts))
+
+	// Output:
+	// Video 1000 1040
+}
+
+func ExampleServerAccept() {
+	l, err := net.Listen("tcp", ":1935")
+	if err != nil {
+		panic(err)
+	}
+
+	// Close the clients which stall at handshake or connect, see DefaultAcceptTimeouts.
+	timeouts := rtmp.DefaultAcceptTimeouts
+	timeouts.OnStall = func(addr net.Addr, stage string) {
+		// Stat or block the slow clients.
+	}
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(c net.Conn) {
+			rd := rand.New(rand.NewSource(time.Now().UnixNano()))
+			p, connect, err := rtmp.ServerAccept(c, rtmp.NewHandshake(rd), &timeouts)
+			if err != nil {
+				// The c is closed.
+				return
+			}
+			defer c.Close()
+
+			// Serve the client by p and connect, see ExampleRtmpClientConnect.
+			_, _ = p, connect
+		}(c)
+	}
+}
+
+func ExampleProtocol_Call() {
+	// The client and server in memory, after handshake, see ExampleServerAccept.
+	c, s := net.Pipe()
+	client, server := rtmp.NewProtocol(c), rtmp.NewProtocol(s)
+
+	go func() {
+		// The server response the custom RPC, echo the args.
+		var req *rtmp.CallPacket
+		if _, err := server.ExpectPacket(&req); err != nil {
+			panic(err)
+		}
+
+		res := rtmp.NewRPCPacket("_result", req.Args)
+		res.TransactionID = req.TransactionID
+		if err := server.WritePacket(res, 0); err != nil {
+			panic(err)
+		}
+	}()
+
+	res, err := client.Call("getServerTime", amf0.NewString("utc"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(res.CommandName, *res.Args[0].(*amf0.String))
+
+	// Output:
+	// _result utc
+}
+
+func ExamplePayloadTransform() {
+	// Scramble the payload by xor, the transform returns new payload.
+	xor := func(m *rtmp.Message) ([]byte, error) {
+		p := make([]byte, len(m.Payload))
+		for i, b := range m.Payload {
+			p[i] = b ^ 0x5a
+		}
+		return p, nil
+	}
+
+	c, s := net.Pipe()
+	client, server := rtmp.NewProtocol(c), rtmp.NewProtocol(s)
+	client.SetPayloadTransform(xor, xor)
+	server.SetPayloadTransform(xor, xor)
+
+	go func() {
+		m := rtmp.NewStreamMessage(1)
+		m.MessageType = rtmp.MessageTypeVideo
+		m.Payload = []byte("scrambled")
+		if err := client.WriteMessage(m); err != nil {
+			panic(err)
+		}
+	}()
+
+	m, err := server.ReadMessage()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(m.Payload))
+
+	// Output:
+	// scrambled
+}
+
+func ExamplePlayerSession() {
+	// The server in memory, which serves two frames then disconnect.
+	serve := func(s net.Conn, base uint64) {
+		defer s.Close()
+
+		p, _, err := rtmp.ServerAccept(s, rtmp.NewHandshake(rand.New(rand.NewSource(0))), nil)
+		if err != nil {
+			return
+		}
+		if err = p.WritePacket(rtmp.NewConnectAppResPacket(1), 0); err != nil {
+			return
+		}
+
+		var createStream *rtmp.CreateStreamPacket
+		if _, err = p.ExpectPacket(&createStream); err != nil {
+			return
+		}
+		res := rtmp.NewCreateStreamResPacket(createStream.TransactionID)
+		res.StreamID = 1
+		if err = p.WritePacket(res, 0); err != nil {
+			return
+		}
+		var play *rtmp.PlayPacket
+		if _, err = p.ExpectPacket(&play); err != nil {
+			return
+		}
+
+		for i, payload := range [][]byte{{0x17, 0x00, 0x01}, {0x17, 0x01, 0x02}, {0x27, 0x01, 0x03}} {
+			m := rtmp.NewStreamMessage(1)
+			m.MessageType, m.Payload = rtmp.MessageTypeVideo, payload
+			if i > 0 {
+				m.Timestamp = base + uint64(i-1)*40
+			}
+			if err = p.WriteMessage(m); err != nil {
+				return
+			}
+		}
+	}
+
+	player, err := rtmp.NewPlayerSession("rtmp://127.0.0.1/live/livestream")
+	if err != nil {
+		panic(err)
+	}
+	defer player.Close()
+
+	var connections uint64
+	player.RetryInterval = 10 * time.Millisecond
+	player.OnReconnect = func(err error) {
+		// Stat the reconnecting.
+	}
+	player.Dial = func(addr string) (net.Conn, error) {
+		c, s := net.Pipe()
+		connections++
+		go serve(s, connections*1000)
+		return c, nil
+	}
+
+	// The sequence header is deduplicated, and the timestamp is continuous after reconnect.
+	for i := 0; i < 5; i++ {
+		m, err := player.ReadMessage()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(m.Timestamp, m.Payload)
+	}
+
+	// Output:
+	// 0 [23 0 1]
+	// 0 [23 1 2]
+	// 40 [39 1 3]
+	// 40 [23 1 2]
+	// 80 [39 1 3]
+}
+
+func ExamplePublisherSession() {
+	publisher, err := rtmp.NewPublisherSession("rtmp://127.0.0.1/live/livestream")
+	if err != nil {
+		panic(err)
+	}
+	defer publisher.Close()
+
+	publisher.OnReconnect = func(err error) {
+		// The publish is rejected, for example, the stream is busy.
+		if serr, ok := oe.Cause(err).(*rtmp.StatusError); ok {
+			_ = serr.Code
+		}
+	}
+
+	// The sequence header is resent after reconnect, and the frames are dropped until keyframe.
+	m := rtmp.NewStreamMessage(1)
+	m.MessageType, m.Payload = rtmp.MessageTypeVideo, []byte{0x17, 0x00, 0x01}
+	if err := publisher.WriteMessage(m); err != nil {
+		return
+	}
+}
+
+func ExampleSendQueue() {
+	// The peer never reads, so the network is congested.
+	c, _ := net.Pipe()
+	q := rtmp.NewSendQueue(rtmp.NewProtocol(c))
+	q.Name, q.Size = "live/livestream", 2
+	defer q.Close()
+
+	frame := func(payload ...byte) *rtmp.Message {
+		m := rtmp.NewStreamMessage(1)
+		m.MessageType, m.Payload = rtmp.MessageTypeVideo, payload
+		return m
+	}
+
+	// The keyframe is writing and blocked.
+	q.WriteMessage(frame(0x17, 0x01))
+	for q.Stats().Queued > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queue is full after two frames, drop the others until next keyframe.
+	for _, payload := range [][]byte{{0x27, 0x01}, {0x27, 0x01}, {0x27, 0x01}, {0x27, 0x01}} {
+		q.WriteMessage(frame(payload...))
+	}
+
+	// Export the stats, for example, as a collector of http.Metrics.
+	if err := rtmp.WriteSendMetrics(os.Stdout, q); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// # HELP rtmp_send_dropped_total The frames dropped for send queue full.
+	// # TYPE rtmp_send_dropped_total counter
+	// rtmp_send_dropped_total{queue="live/livestream",type="video"} 2
+	// # HELP rtmp_send_late_total The frames dropped for waiting in send queue too long.
+	// # TYPE rtmp_send_late_total counter
+	// # HELP rtmp_send_queued The messages in send queue.
+	// # TYPE rtmp_send_queued gauge
+	// rtmp_send_queued{queue="live/livestream"} 2
+}
+
+func ExampleHandshake_ClientHandshake() {
+	c, s := net.Pipe()
+	defer c.Close()
+
+	// The server accepts both complex and simple handshake.
+	go func() {
+		defer s.Close()
+		rtmp.ServerAccept(s, rtmp.NewHandshake(rand.New(rand.NewSource(0))), nil)
+	}()
+
+	// The client prefers the complex handshake, and fallback to simple.
+	hs := rtmp.NewHandshake(rand.New(rand.NewSource(time.Now().UnixNano())))
+	complex, err := hs.ClientHandshake(c, true)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("complex", complex)
+
+	// Output:
+	// complex true
+}
+
+func ExampleServer() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	// Or rtmp.ListenAndServe(":1935", handler) to serve the clients.
+	s := rtmp.NewServer(l)
+	defer s.Close()
+
+	done := make(chan bool)
+	go s.Serve(rtmp.HandlerFunc(func(c *rtmp.Conn) {
+		defer close(done)
+
+		// Identify the client, use ExpectPublish for publisher.
+		if err := c.ExpectPlay(); err != nil {
+			return
+		}
+		fmt.Println(c.Type, c.Request.App, c.Request.Stream)
+
+		// Write the messages to player, for example, by rtmp.NewMessageFromTag.
+		_ = c.StreamID
+	}))
+
+	// The player connects to server.
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if _, err := rtmp.ClientPlay(c, rtmp.NewHandshake(rd), "rtmp://127.0.0.1/live", "livestream"); err != nil {
+		panic(err)
+	}
+	<-done
+
+	// Output:
+	// play live livestream
+}
+
+func ExampleServer_Drain() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	s := rtmp.NewServer(l)
+	go s.Serve(rtmp.HandlerFunc(func(c *rtmp.Conn) {
+		if err := c.ExpectPlay(); err != nil {
+			return
+		}
+
+		// Serve the player until it quit.
+		for {
+			if _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+
+	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	p, err := rtmp.ClientPlay(c, rtmp.NewHandshake(rd), "rtmp://127.0.0.1/live", "livestream")
+	if err != nil {
+		panic(err)
+	}
+
+	// The player quits when got the play stop.
+	started := make(chan bool)
+	go func() {
+		defer c.Close()
+		for {
+			m, err := p.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			pkt, err := p.DecodeMessage(m)
+			if err != nil {
+				continue
+			}
+
+			if pkt, ok := pkt.(*rtmp.OnStatusCallPacket); ok {
+				code := *pkt.Data.Get("code").(*amf0.String)
+				if code == rtmp.StatusCodePlayStart {
+					close(started)
+				}
+				if code == rtmp.StatusCodePlayStop {
+					fmt.Println(code, *pkt.Data.Get("description").(*amf0.String))
+					return
+				}
+			}
+		}
+	}()
+	<-started
+
+	// Stop accepting clients, then drain the server for graceful restart.
+	s.Close()
+	if err := s.Drain("Server is restarting.", 3*time.Second); err != nil {
+		panic(err)
+	}
+	fmt.Println("drained")
+
+	// Output:
+	// NetStream.Play.Stop Server is restarting.
+	// drained
+}
+
+func ExampleConn_HandlePlay2() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	s := rtmp.NewServer(l)
+	defer s.Close()
+
+	var streams []string
+	done := make(chan bool)
+	go s.Serve(rtmp.HandlerFunc(func(c *rtmp.Conn) {
+		defer close(done)
+		if err := c.ExpectPlay(); err != nil {
+			return
+		}
+		streams = append(streams, c.Request.Stream)
+
+		for {
+			m, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			// Switch to the new stream, for example, the higher bitrate.
+			if ok, _, err := c.HandlePlay2(m); ok {
+				if err != nil {
+					return
+				}
+				streams = append(streams, c.Request.Stream)
+			}
+		}
+	}))
+
+	// The player of CDN, which requires FCSubscribe.
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+
+	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	p, err := rtmp.ClientSubscribePlay(c, rtmp.NewHandshake(rd), "rtmp://127.0.0.1/live", "livestream")
+	if err != nil {
+		panic(err)
+	}
+
+	if err = p.WritePacket(rtmp.NewPlay2SwitchPacket("livestream", "livestream_hd"), 1); err != nil {
+		panic(err)
+	}
+
+	for {
+		var res *rtmp.OnStatusCallPacket
+		if _, err = p.ExpectPacket(&res); err != nil {
+			panic(err)
+		}
+
+		if code := *res.Data.Get("code").(*amf0.String); code == rtmp.StatusCodePlayTransition {
+			fmt.Println(code)
+			break
+		}
+	}
+	c.Close()
+	<-done
+	fmt.Println(strings.Join(streams, ", "))
+
+	// Output:
+	// NetStream.Play.Transition
+	// livestream, livestream_hd
+}
+
+func ExampleConn_HandleRotate() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	s := rtmp.NewServer(l)
+	defer s.Close()
+
+	// Verify the new key when publisher rotates it.
+	s.OnRotate = func(r *rtmp.Request) error {
+		if r.Param.Get("token") != "new" {
+			return fmt.Errorf("invalid token %v", r.Param.Get("token"))
+		}
+		return nil
+	}
+
+	var tokens []string
+	done := make(chan bool)
+	go s.Serve(rtmp.HandlerFunc(func(c *rtmp.Conn) {
+		defer close(done)
+		if err := c.ExpectPublish(); err != nil {
+			return
+		}
+
+		for {
+			m, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if ok, err := c.HandleRotate(m); ok {
+				if err != nil {
+					tokens = append(tokens, err.Error())
+					return
+				}
+				tokens = append(tokens, c.Request.Param.Get("token"))
+			}
+		}
+	}))
+
+	// The publisher connects to server.
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if _, err = rtmp.NewHandshake(rd).ClientHandshake(c, true); err != nil {
+		panic(err)
+	}
+
+	p := rtmp.NewProtocol(c)
+	connect := rtmp.NewConnectAppPacket()
+	connect.CommandObject.Set("tcUrl", amf0.NewString("rtmp://127.0.0.1/live"))
+	if err = p.WritePacket(connect, 0); err != nil {
+		panic(err)
+	}
+
+	var connectRes *rtmp.ConnectAppResPacket
+	if _, err = p.ExpectPacket(&connectRes); err != nil {
+		panic(err)
+	}
+
+	publish := rtmp.NewPublishPacket()
+	publish.StreamName = "livestream?token=old"
+	if err = p.WritePacket(publish, 1); err != nil {
+		panic(err)
+	}
+
+	// Rotate the key without disconnecting, then rotate to an invalid key.
+	if res, err := p.Call(rtmp.CommandRotateStreamKey, amf0.NewString("livestream?token=new")); err == nil {
+		fmt.Println("client:", res.CommandName)
+	}
+	if _, err := p.Call(rtmp.CommandRotateStreamKey, amf0.NewString("livestream?token=bad")); err != nil {
+		fmt.Println("client: rejected")
+	}
+	<-done
+	fmt.Println("server:", strings.Join(tokens, ", "))
+
+	// Output:
+	// client: _result
+	// client: rejected
+	// server: new, rejected: invalid token bad
+}
+
+func ExampleListenAndServeAll() {
+	// Serve the public clients at TCP 1935, and the local relays behind a proxy at
+	// unix socket, which is trusted so never timeout.
+	err := rtmp.ListenAndServeAll(rtmp.HandlerFunc(func(c *rtmp.Conn) {
+		if _, ok := c.NetConn().LocalAddr().(*net.UnixAddr); ok {
+			// The client from local relay.
+		}
+	}), &rtmp.ListenerConfig{Addr: ":1935"}, &rtmp.ListenerConfig{
+		Network: "unix", Addr: "/var/run/rtmp.sock", Timeouts: &rtmp.AcceptTimeouts{},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ExampleOnStatusCallPacket() {
+	// The server notify the publisher to start publishing.
+	pkt := rtmp.NewOnStatusCallPacket()
+	pkt.Data.Set("level", amf0.NewString("status"))
+	pkt.Data.Set("code", amf0.NewString(rtmp.StatusCodePublishStart))
+
+	b, err := pkt.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	// The client parse the onStatus, generally by ExpectPacket.
+	res := rtmp.NewOnStatusCallPacket()
+	if err = res.UnmarshalBinary(b); err != nil {
+		panic(err)
+	}
+	fmt.Println(*res.Data.Get("code").(*amf0.String))
+
+	// Output:
+	// NetStream.Publish.Start
+}
+
+func ExampleLatencyMeter() {
+	// The publisher stamps the video frames with wall clock.
+	m := rtmp.NewStreamMessage(1)
+	m.MessageType, m.Payload = rtmp.MessageTypeVideo, []byte{0x17, 0x01, 0, 0, 0, 0, 0, 0, 2, 0x65, 0x88}
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	m = rtmp.StampLatency(m, start)
+
+	// The player measures the latency, export it by http Metrics, or the rate by kxps.NewKrps.
+	meter := rtmp.NewLatencyMeter("livestream")
+	latency, ok := meter.Observe(m, start.Add(150*time.Millisecond))
+	fmt.Println(latency, ok)
+
+	// Export the meters of streams, the metrics are described once.
+	rtmp.WriteLatencyMetrics(os.Stdout, meter, rtmp.NewLatencyMeter("other"))
+
+	// Output:
+	// 150ms true
+	// # HELP rtmp_latency_seconds The end-to-end latency measured by SEI.
+	// # TYPE rtmp_latency_seconds gauge
+	// rtmp_latency_seconds{stream="livestream",stat="last"} 0.15
+	// rtmp_latency_seconds{stream="livestream",stat="min"} 0.15
+	// rtmp_latency_seconds{stream="livestream",stat="max"} 0.15
+	// rtmp_latency_seconds{stream="livestream",stat="avg"} 0.15
+	// rtmp_latency_seconds{stream="other",stat="last"} 0
+	// rtmp_latency_seconds{stream="other",stat="min"} 0
+	// rtmp_latency_seconds{stream="other",stat="max"} 0
+	// rtmp_latency_seconds{stream="other",stat="avg"} 0
+	// # HELP rtmp_latency_frames_total The frames measured.
+	// # TYPE rtmp_latency_frames_total counter
+	// rtmp_latency_frames_total{stream="livestream"} 1
+	// rtmp_latency_frames_total{stream="other"} 0
+}
+
+func ExampleProtocol_InBytes() {
+	// The client and server in memory, after handshake, see ExampleServerAccept.
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	client, server := rtmp.NewProtocol(c), rtmp.NewProtocol(s)
+
+	// The server requires acknowledgement for each 100 bytes, then sends the video.
+	go func() {
+		ack := rtmp.NewWindowAcknowledgementSize()
+		ack.AckSize = 100
+		if err := server.WritePacket(ack, 0); err != nil {
+			return
+		}
+
+		for i := 0; i < 3; i++ {
+			m := rtmp.NewStreamMessage(1)
+			m.MessageType, m.Payload = rtmp.MessageTypeVideo, make([]byte, 60)
+			if err := server.WriteMessage(m); err != nil {
+				return
+			}
+		}
+	}()
+
+	// The client sends the acknowledgement automatically when reading messages.
+	go func() {
+		for {
+			if _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var ack *rtmp.Acknowledgement
+	if _, err := server.ExpectPacket(&ack); err != nil {
+		panic(err)
+	}
+	fmt.Println(ack.SequenceNumber >= 100, client.InBytes() >= uint64(ack.SequenceNumber))
+
+	// Output:
+	// true true
+}
+
+func ExampleProtocol_SetAutoPingResponse() {
+	// The client and server in memory, after handshake, see ExampleServerAccept.
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	client, server := rtmp.NewProtocol(c), rtmp.NewProtocol(s)
+
+	// The client response the ping request automatically when reading messages.
+	client.SetAutoPingResponse(true)
+	go func() {
+		for {
+			if _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// The server pings the client by timestamp.
+	ping := rtmp.NewUserControl()
+	ping.EventType, ping.EventData = rtmp.EventTypePingRequest, 1000
+	if err := server.WritePacket(ping, 0); err != nil {
+		panic(err)
+	}
+
+	var pong *rtmp.UserControl
+	if _, err := server.ExpectPacket(&pong); err != nil {
+		panic(err)
+	}
+	fmt.Println(pong.EventType, pong.EventData)
+
+	// Output:
+	// PingResponse 1000
+}
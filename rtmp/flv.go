@@ -0,0 +1,65 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The conversion between RTMP messages and FLV tags, for example, to record
+// or to play a FLV file over RTMP.
+package rtmp
+
+import (
+	"github.com/ossrs/go-oryx-lib/flv"
+)
+
+// Create a message for the FLV tag, where timestamp is the DTS of tag.
+// @remark The payload is shared without copy, so the CTS of video is preserved,
+// that is the PTS of B-frames is kept after remux.
+func NewMessageFromTag(tagType flv.TagType, timestamp uint32, tag []byte, streamID int) *Message {
+	v := NewStreamMessage(streamID)
+	v.MessageType = MessageType(tagType)
+	v.Timestamp = uint64(timestamp)
+	v.Payload = tag
+
+	switch tagType {
+	case flv.TagTypeAudio:
+		v.betterCid = chunkIDAudio
+	case flv.TagTypeVideo:
+		v.betterCid = chunkIDVideo
+	}
+
+	return v
+}
+
+// Get the FLV tag of message, to write by flv.Muxer.
+// @remark The payload is shared without copy, and the timestamp is the DTS.
+// @return The tag type is TagTypeForbidden if message is not audio, video or data.
+func (v *Message) Tag() (tagType flv.TagType, timestamp uint32, tag []byte) {
+	switch v.MessageType {
+	case MessageTypeAudio:
+		tagType = flv.TagTypeAudio
+	case MessageTypeVideo:
+		tagType = flv.TagTypeVideo
+	case MessageTypeAMF0Data:
+		tagType = flv.TagTypeScriptData
+	default:
+		return flv.TagTypeForbidden, 0, nil
+	}
+
+	return tagType, uint32(v.Timestamp), v.Payload
+}
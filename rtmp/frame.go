@@ -0,0 +1,75 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The frame adapter, to drive the RTMP protocol over frames rather than TCP stream,
+// for example, over the WebSocket bridge in WASM, or in memory for tests.
+package rtmp
+
+import (
+	"io"
+)
+
+// The duplex of frames, for example, the binary messages of WebSocket.
+type FrameConn interface {
+	// Read a frame, which is the bytes of RTMP stream, the frame is owned by caller.
+	ReadFrame() (frame []byte, err error)
+	// Write a frame, which is the bytes of RTMP stream.
+	// @remark The frame is reused after return, so copy it if need to retain it.
+	WriteFrame(frame []byte) (err error)
+}
+
+// The io.ReadWriter over frames.
+type frameReadWriter struct {
+	c FrameConn
+	// The left bytes of last frame.
+	left []byte
+}
+
+// Create a io.ReadWriter over frames, the bytes of RTMP stream are carried by frames,
+// and the boundary of frames is not required to match the chunks.
+func NewFrameReadWriter(c FrameConn) io.ReadWriter {
+	return &frameReadWriter{c: c}
+}
+
+// Create the protocol over frames, see NewFrameReadWriter.
+// @remark Use net.Pipe to run the protocol fully in-memory.
+func NewFrameProtocol(c FrameConn) *Protocol {
+	return NewProtocol(NewFrameReadWriter(c))
+}
+
+func (v *frameReadWriter) Read(p []byte) (n int, err error) {
+	for len(v.left) == 0 {
+		if v.left, err = v.c.ReadFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	n = copy(p, v.left)
+	v.left = v.left[n:]
+	return
+}
+
+func (v *frameReadWriter) Write(p []byte) (n int, err error) {
+	if err = v.c.WriteFrame(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,30 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The packets generated by amf0gen, the struct is declared by hand, and the methods
+// Size, UnmarshalBinary and MarshalBinary are generated, run go generate to update.
+package rtmp
+
+//go:generate go run ../amf0/amf0gen/main.go -type=PausePacket -embed=variantCallPacket -methods -fields=IsPause:Boolean,Time:Number
+//go:generate go run ../amf0/amf0gen/main.go -type=Play2Packet -embed=variantCallPacket -methods -fields=Parameters:Object
+//go:generate go run ../amf0/amf0gen/main.go -type=FMLEStartPacket -embed=variantCallPacket -methods -fields=StreamName:String
+//go:generate go run ../amf0/amf0gen/main.go -type=OnStatusCallPacket -embed=variantCallPacket -methods -fields=Data:Object
+//go:generate go run ../amf0/amf0gen/main.go -type=RPCPacket -embed=variantCallPacket -methods -fields=Args:Amf0*
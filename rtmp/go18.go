@@ -0,0 +1,44 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// +build go1.8
+
+package rtmp
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// Whether the underlayer writer supports writev, for example, the TCP or unix conn.
+func (v *countReadWriter) writevable() bool {
+	_, ok := v.rw.(net.Conn)
+	return ok
+}
+
+// Write the buffers by writev if supported, or write one by one.
+// @remark The bufs is consumed, the slices are set to empty.
+func (v *countReadWriter) writeBuffers(bufs [][]byte) (n int64, err error) {
+	nb := net.Buffers(bufs)
+	n, err = nb.WriteTo(v.rw)
+	atomic.AddUint64(&v.out, uint64(n))
+	return
+}
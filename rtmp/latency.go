@@ -0,0 +1,278 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The latency measurement by SEI, which carries the wall clock in the video stream.
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// The UUID of SEI user_data_unregistered, to identify the wall clock stamped by StampLatency.
+var LatencyUUID = []byte{
+	0x6f, 0x72, 0x79, 0x78, 0x2d, 0x6c, 0x61, 0x74,
+	0x65, 0x6e, 0x63, 0x79, 0x2d, 0x73, 0x65, 0x69,
+}
+
+// The SEI of user_data_unregistered, see ISO_IEC_14496-10-AVC-2003.pdf, @page 83, @section D.1.6
+const (
+	naluTypeSEI                    = 6
+	seiUserDataUnregistered        = 5
+	latencyPayloadSize             = 16 + 8
+	latencyAVCTagHeaderSize        = 5
+	latencyAVCPacketTypeNALU uint8 = 1
+)
+
+// Stamp the AVC video message with a SEI which carries the wall clock now in ms, to
+// measure the end-to-end latency by ParseLatency when the stream is played back.
+// It returns a new message, or m if it's not an AVC frame, for example, the audio or
+// sequence header, so m is never modified and it's safe to stamp a shared message.
+// @remark The NALU length size must be 4 bytes, which is used by almost all encoders.
+func StampLatency(m *Message, now time.Time) *Message {
+	if !isAVCFrame(m) {
+		return m
+	}
+
+	// The wall clock in ms, with emulation prevention.
+	rbsp := make([]byte, 0, latencyPayloadSize+2)
+	rbsp = append(rbsp, seiUserDataUnregistered, latencyPayloadSize)
+	rbsp = append(rbsp, LatencyUUID...)
+	rbsp = append(rbsp, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(rbsp[len(rbsp)-8:], uint64(now.UnixNano()/int64(time.Millisecond)))
+	rbsp = append(rbsp, 0x80)
+
+	nalu := append([]byte{naluTypeSEI}, escapeRBSP(rbsp)...)
+
+	payload := make([]byte, 0, len(m.Payload)+4+len(nalu))
+	payload = append(payload, m.Payload[:latencyAVCTagHeaderSize]...)
+	payload = append(payload, byte(len(nalu)>>24), byte(len(nalu)>>16), byte(len(nalu)>>8), byte(len(nalu)))
+	payload = append(payload, nalu...)
+	payload = append(payload, m.Payload[latencyAVCTagHeaderSize:]...)
+
+	tm := *m
+	tm.Payload = payload
+	return &tm
+}
+
+// Parse the wall clock of AVC video message, which is stamped by StampLatency.
+func ParseLatency(m *Message) (t time.Time, ok bool) {
+	if !isAVCFrame(m) {
+		return
+	}
+
+	for p := m.Payload[latencyAVCTagHeaderSize:]; len(p) > 4; {
+		size := int(binary.BigEndian.Uint32(p))
+		if p = p[4:]; size > len(p) {
+			return
+		}
+
+		nalu := p[:size]
+		p = p[size:]
+
+		if len(nalu) < 1 || nalu[0]&0x1f != naluTypeSEI {
+			continue
+		}
+
+		rbsp := unescapeRBSP(nalu[1:])
+		if len(rbsp) < 2+latencyPayloadSize || rbsp[0] != seiUserDataUnregistered || rbsp[1] != latencyPayloadSize {
+			continue
+		}
+		if !bytes.Equal(rbsp[2:18], LatencyUUID) {
+			continue
+		}
+
+		ms := int64(binary.BigEndian.Uint64(rbsp[18:26]))
+		return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)), true
+	}
+
+	return
+}
+
+// Whether m is an AVC frame, not the sequence header.
+func isAVCFrame(m *Message) bool {
+	p := m.Payload
+	return m.MessageType == MessageTypeVideo && len(p) > latencyAVCTagHeaderSize &&
+		p[0]&0x0f == 7 && p[1] == latencyAVCPacketTypeNALU
+}
+
+// Insert the emulation_prevention_three_byte, see ISO_IEC_14496-10-AVC-2003.pdf, @page 44, @section 7.4.1
+func escapeRBSP(rbsp []byte) []byte {
+	b := make([]byte, 0, len(rbsp)+4)
+	var zeros int
+	for _, c := range rbsp {
+		if zeros >= 2 && c <= 3 {
+			b, zeros = append(b, 3), 0
+		}
+		if b = append(b, c); c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return b
+}
+
+// Remove the emulation_prevention_three_byte.
+func unescapeRBSP(p []byte) []byte {
+	b := make([]byte, 0, len(p))
+	var zeros int
+	for _, c := range p {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if b = append(b, c); c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return b
+}
+
+// The statistic of latency.
+type LatencyStats struct {
+	// The number of frames measured.
+	Count uint64
+	// The last, min, max and average latency.
+	Last, Min, Max, Average time.Duration
+}
+
+// The LatencyMeter measures the end-to-end latency of stream, by the wall clock stamped by
+// StampLatency. It's a KrpsSource of kxps for the rate of frames measured, and a Collector
+// of http Metrics to export the latency. For example:
+//
+//	meter := NewLatencyMeter("livestream")
+//	metrics.Register(meter)
+//	for { m, err := p.ReadMessage(); meter.Observe(m, time.Now()) }
+//
+// For many streams, export the meters by WriteLatencyMetrics.
+// @remark The clocks of publisher and player should be synchronized, for example, by NTP,
+// or run them on the same machine.
+type LatencyMeter struct {
+	// The name of stream, the label of metrics.
+	Name string
+
+	lock  sync.Mutex
+	stats LatencyStats
+	total time.Duration
+}
+
+func NewLatencyMeter(name string) *LatencyMeter {
+	return &LatencyMeter{Name: name}
+}
+
+// Measure the latency of m, which is received at now. Returns false if m is not stamped.
+func (v *LatencyMeter) Observe(m *Message, now time.Time) (latency time.Duration, ok bool) {
+	var t time.Time
+	if t, ok = ParseLatency(m); !ok {
+		return
+	}
+
+	// Ignore the negative latency, when the clocks are not synchronized.
+	if latency = now.Sub(t); latency < 0 {
+		latency = 0
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	s := &v.stats
+	if s.Count == 0 || latency < s.Min {
+		s.Min = latency
+	}
+	if latency > s.Max {
+		s.Max = latency
+	}
+	s.Count++
+	s.Last = latency
+	v.total += latency
+	s.Average = v.total / time.Duration(s.Count)
+
+	return
+}
+
+// Get the statistic of latency.
+func (v *LatencyMeter) Stats() LatencyStats {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.stats
+}
+
+// The interface kxps.KrpsSource, the number of frames measured.
+func (v *LatencyMeter) NbRequests() uint64 {
+	return v.Stats().Count
+}
+
+// The interface http.Collector, to export the latency in seconds.
+// @remark Use WriteLatencyMetrics for multiple meters, because each metric should be described once.
+func (v *LatencyMeter) WriteMetrics(w io.Writer) (err error) {
+	return WriteLatencyMetrics(w, v)
+}
+
+// Write the latency of meters in the Prometheus text format, for example, as a
+// collector of http.Metrics:
+//
+//	metrics.Register(http.CollectorFunc(func(w io.Writer) error {
+//		return WriteLatencyMetrics(w, meters...)
+//	}))
+func WriteLatencyMetrics(w io.Writer, meters ...*LatencyMeter) (err error) {
+	stats := make([]LatencyStats, 0, len(meters))
+	for _, m := range meters {
+		stats = append(stats, m.Stats())
+	}
+
+	if _, err = fmt.Fprintln(w, "# HELP rtmp_latency_seconds The end-to-end latency measured by SEI.\n# TYPE rtmp_latency_seconds gauge"); err != nil {
+		return oe.Wrap(err, "write")
+	}
+
+	for i, m := range meters {
+		s := &stats[i]
+		for _, e := range []struct {
+			stat  string
+			value time.Duration
+		}{
+			{"last", s.Last}, {"min", s.Min}, {"max", s.Max}, {"avg", s.Average},
+		} {
+			if _, err = fmt.Fprintf(w, "rtmp_latency_seconds{stream=%q,stat=%q} %v\n", m.Name, e.stat, e.value.Seconds()); err != nil {
+				return oe.Wrap(err, "write")
+			}
+		}
+	}
+
+	if _, err = fmt.Fprintln(w, "# HELP rtmp_latency_frames_total The frames measured.\n# TYPE rtmp_latency_frames_total counter"); err != nil {
+		return oe.Wrap(err, "write")
+	}
+
+	for i, m := range meters {
+		if _, err = fmt.Fprintf(w, "rtmp_latency_frames_total{stream=%q} %v\n", m.Name, stats[i].Count); err != nil {
+			return oe.Wrap(err, "write")
+		}
+	}
+
+	return
+}
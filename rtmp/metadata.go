@@ -0,0 +1,132 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The normalizer for onMetaData, rewrite the metadata like SRS.
+package rtmp
+
+import (
+	"bytes"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+)
+
+// The name of metadata in data message.
+const (
+	dataSetDataFrame amf0.String = amf0.String("@setDataFrame")
+	dataOnMetaData   amf0.String = amf0.String("onMetaData")
+)
+
+// The normalizer of onMetaData, which rewrites the metadata like SRS does:
+//		Remove the @setDataFrame, for players only accept onMetaData.
+//		Set the server fields, for example, server=Oryx.
+//		Remove the duration and filesize for live, or player think it's VoD.
+//		Remove the fields which break some players.
+// @remark Optional, apply it in the relay or ingest path.
+type MetadataNormalizer struct {
+	// The server field, ignore if empty.
+	Server string
+	// Whether live stream, remove the duration and filesize.
+	Live bool
+	// The fields to remove.
+	Strip []string
+	// The fields to set or overwrite.
+	Fields map[string]amf0.Amf0
+}
+
+func NewMetadataNormalizer() *MetadataNormalizer {
+	return &MetadataNormalizer{Server: "Oryx", Live: true}
+}
+
+// Normalize the metadata message, return the message itself if not metadata,
+// otherwise a new message with the normalized payload.
+func (v *MetadataNormalizer) Normalize(m *Message) (*Message, error) {
+	if m.MessageType != MessageTypeAMF0Data {
+		return m, nil
+	}
+
+	p := m.Payload
+
+	var name amf0.String
+	if err := name.UnmarshalBinary(p); err != nil {
+		return nil, oe.WithMessage(err, "unmarshal name")
+	}
+	p = p[name.Size():]
+
+	if name == dataSetDataFrame {
+		if err := name.UnmarshalBinary(p); err != nil {
+			return nil, oe.WithMessage(err, "unmarshal name")
+		}
+		p = p[name.Size():]
+	}
+
+	if name != dataOnMetaData {
+		return m, nil
+	}
+
+	a, err := amf0.Discovery(p)
+	if err != nil {
+		return nil, oe.WithMessage(err, "discovery metadata")
+	}
+	if err = a.UnmarshalBinary(p); err != nil {
+		return nil, oe.WithMessage(err, "unmarshal metadata")
+	}
+
+	switch a := a.(type) {
+	case *amf0.Object:
+		v.normalize(func(key string, value amf0.Amf0) { a.Set(key, value) }, func(key string) { a.Delete(key) })
+	case *amf0.EcmaArray:
+		v.normalize(func(key string, value amf0.Amf0) { a.Set(key, value) }, func(key string) { a.Delete(key) })
+	default:
+		return m, nil
+	}
+
+	b := &bytes.Buffer{}
+	for _, o := range []amf0.Amf0{&name, a} {
+		var pb []byte
+		if pb, err = o.MarshalBinary(); err != nil {
+			return nil, oe.WithMessage(err, "marshal metadata")
+		}
+		b.Write(pb)
+	}
+
+	r := *m
+	r.Payload = b.Bytes()
+	return &r, nil
+}
+
+func (v *MetadataNormalizer) normalize(set func(string, amf0.Amf0), del func(string)) {
+	if v.Live {
+		del("duration")
+		del("filesize")
+	}
+
+	for _, key := range v.Strip {
+		del(key)
+	}
+
+	if v.Server != "" {
+		set("server", amf0.NewString(v.Server))
+	}
+
+	for key, value := range v.Fields {
+		set(key, value)
+	}
+}
@@ -0,0 +1,63 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The data messages passthrough, to forward the data without decode, for relays.
+package rtmp
+
+// Whether pass the data messages through, that is, the MessageTypeAMF0Data and
+// MessageTypeAMF3Data are not decoded by DecodeMessage, which returns a RawDataPacket,
+// so the relay never fails for unknown data commands. It's disabled by default.
+func (v *Protocol) SetDataPassthrough(enabled bool) {
+	v.input.dataPassthrough = enabled
+}
+
+// The data message which is not decoded, see SetDataPassthrough.
+type RawDataPacket struct {
+	// The type of message, MessageTypeAMF0Data or MessageTypeAMF3Data.
+	MessageType MessageType
+	// The payload of message, includes the leading byte of AMF3.
+	Payload []byte
+}
+
+func NewRawDataPacket(t MessageType) *RawDataPacket {
+	return &RawDataPacket{MessageType: t}
+}
+
+func (v *RawDataPacket) BetterCid() chunkID {
+	return chunkIDOverStream
+}
+
+func (v *RawDataPacket) Type() MessageType {
+	return v.MessageType
+}
+
+func (v *RawDataPacket) Size() int {
+	return len(v.Payload)
+}
+
+func (v *RawDataPacket) UnmarshalBinary(data []byte) (err error) {
+	v.Payload = data
+	return
+}
+
+func (v *RawDataPacket) MarshalBinary() (data []byte, err error) {
+	return v.Payload, nil
+}
@@ -0,0 +1,437 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The player session, which plays a stream and reconnects on error.
+package rtmp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Do the complex client handshake over c, fallback to simple, then connect to tcUrl and play the stream.
+// The ping request of server is responsed automatically.
+// @remark The stream may carry query, for example, livestream?token=xxx
+func ClientPlay(c net.Conn, hs *Handshake, tcUrl, stream string) (p *Protocol, err error) {
+	return clientPlay(c, hs, tcUrl, stream, false)
+}
+
+// Same to ClientPlay, but send FCSubscribe before play, which is required by some CDNs.
+func ClientSubscribePlay(c net.Conn, hs *Handshake, tcUrl, stream string) (p *Protocol, err error) {
+	return clientPlay(c, hs, tcUrl, stream, true)
+}
+
+func clientPlay(c net.Conn, hs *Handshake, tcUrl, stream string, subscribe bool) (p *Protocol, err error) {
+	if p, err = clientConnect(c, hs, tcUrl); err != nil {
+		return nil, err
+	}
+
+	// Never wait for the response of FCSubscribe, some servers ignore it.
+	// @remark The tid 2 is used by createStream, so we use 3.
+	if subscribe {
+		pkt := NewFCSubscribePacket()
+		pkt.TransactionID = 3
+		pkt.StreamName = amf0.String(stream)
+		if err = p.WritePacket(pkt, 0); err != nil {
+			return nil, oe.WithMessage(err, "write fc subscribe")
+		}
+	}
+
+	if err = p.WritePacket(NewCreateStreamPacket(), 0); err != nil {
+		return nil, oe.WithMessage(err, "write create stream")
+	}
+
+	var createStreamRes *CreateStreamResPacket
+	if _, err = p.ExpectPacket(&createStreamRes); err != nil {
+		return nil, oe.WithMessage(err, "expect create stream res")
+	}
+
+	play := NewPlayPacket()
+	play.StreamName = amf0.String(stream)
+	if err = p.WritePacket(play, int(createStreamRes.StreamID)); err != nil {
+		return nil, oe.WithMessage(err, "write play")
+	}
+
+	return
+}
+
+// Do the complex client handshake over c, fallback to simple, then connect to tcUrl.
+func clientConnect(c net.Conn, hs *Handshake, tcUrl string) (p *Protocol, err error) {
+	if _, err = hs.ClientHandshake(c, true); err != nil {
+		return nil, oe.WithMessage(err, "handshake")
+	}
+
+	p = NewProtocol(c)
+	p.SetAutoPingResponse(true)
+
+	connect := NewConnectAppPacket()
+	connect.CommandObject.Set("tcUrl", amf0.NewString(tcUrl))
+	if err = p.WritePacket(connect, 0); err != nil {
+		return nil, oe.WithMessage(err, "write connect")
+	}
+
+	var connectRes *ConnectAppResPacket
+	if _, err = p.ExpectPacket(&connectRes); err != nil {
+		return nil, oe.WithMessage(err, "expect connect res")
+	}
+
+	return
+}
+
+// The error of onStatus, when the level is error, for example, the NetStream.Play.StreamNotFound
+// or NetStream.Publish.Rejected, see StatusPublishRejected.
+type StatusError struct {
+	Code        string
+	Description string
+}
+
+func (v *StatusError) Error() string {
+	return fmt.Sprintf("status %v, %v", v.Code, v.Description)
+}
+
+// Get the StatusError of onStatus, nil if level is not error.
+func statusError(pkt *OnStatusCallPacket) error {
+	if level, ok := pkt.Data.Get("level").(*amf0.String); !ok || string(*level) != StatusLevelError {
+		return nil
+	}
+
+	err := &StatusError{}
+	if code, ok := pkt.Data.Get("code").(*amf0.String); ok {
+		err.Code = string(*code)
+	}
+	if description, ok := pkt.Data.Get("description").(*amf0.String); ok {
+		err.Description = string(*description)
+	}
+	return err
+}
+
+// Parse the url of session, for example, rtmp://ossrs.net/live/livestream
+func parseSessionURL(url string) (tcUrl, stream, addr string, err error) {
+	pos := strings.LastIndex(url, "/")
+	if pos < 0 {
+		return "", "", "", oe.Errorf("invalid url %v", url)
+	}
+
+	r, err := NewRequest(url[:pos])
+	if err != nil {
+		return "", "", "", oe.WithMessage(err, "parse url")
+	}
+
+	return r.TcUrl, url[pos+1:], net.JoinHostPort(r.Host, fmt.Sprint(r.Port)), nil
+}
+
+// Dial the TCP address of session, the default dialer.
+func dialSession(addr string) (net.Conn, error) {
+	return net.DialTimeout("tcp", addr, time.Duration(5)*time.Second)
+}
+
+// The default duration of messages to buffer for player.
+const defaultPlayerBuffer = time.Duration(3) * time.Second
+
+// The default interval to reconnect for player.
+const defaultPlayerRetryInterval = time.Duration(1) * time.Second
+
+// The PlayerSession plays a stream, buffers the messages and reconnects on error,
+// then resumes from the live edge, so the consumer reads a continuous stream.
+// @remark The timestamp is rebased to be monotonically increasing, starts from 0.
+// @remark The sequence headers and metadata are deduplicated after reconnect.
+// @remark The old messages are dropped when buffer is full, except the sequence headers,
+// from the first message to the next video keyframe, so the consumer got a decodable GOP.
+// @remark The error of play onStatus is passed to OnReconnect, see StatusError.
+// @remark It's the consumer counterpart to the PublisherSession.
+type PlayerSession struct {
+	// The duration of messages to buffer. If zero, 3 seconds is used.
+	Buffer time.Duration
+	// The interval to reconnect. If zero, 1 second is used.
+	RetryInterval time.Duration
+	// The dialer to connect to server, optional. Use TCP to dial the address by default.
+	Dial func(addr string) (net.Conn, error)
+	// The hook when reconnect for err, optional. Log the err if not set.
+	OnReconnect func(err error)
+	// Whether send FCSubscribe before play, which is required by some CDNs.
+	Subscribe bool
+
+	tcUrl, stream, addr string
+
+	once   sync.Once
+	lock   sync.Mutex
+	cond   *sync.Cond
+	closed bool
+	// The current connection, closed when session closed.
+	conn net.Conn
+
+	// The buffered messages and number of dropped messages.
+	msgs    []*Message
+	dropped uint64
+	// The payloads of last sequence headers and metadata, to deduplicate.
+	metadata, audioSequenceHeader, videoSequenceHeader []byte
+
+	// Whether to rebase at next frame, the timestamp of source at rebasing, and the output timestamp at rebasing.
+	rebasing     bool
+	base, offset uint64
+	// The last timestamp of output.
+	lastTimestamp uint64
+}
+
+// Create a player session for url, for example, rtmp://ossrs.net/live/livestream
+func NewPlayerSession(url string) (v *PlayerSession, err error) {
+	v = &PlayerSession{rebasing: true}
+	if v.tcUrl, v.stream, v.addr, err = parseSessionURL(url); err != nil {
+		return nil, err
+	}
+
+	v.cond = sync.NewCond(&v.lock)
+	return
+}
+
+// Get the number of dropped messages for buffer full.
+func (v *PlayerSession) Dropped() uint64 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.dropped
+}
+
+// Read the buffered message, start to play when first read.
+// Return error only when session is closed.
+func (v *PlayerSession) ReadMessage() (m *Message, err error) {
+	v.once.Do(func() {
+		go v.run()
+	})
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for len(v.msgs) == 0 && !v.closed {
+		v.cond.Wait()
+	}
+
+	if v.closed {
+		return nil, oe.New("player closed")
+	}
+
+	m, v.msgs = v.msgs[0], v.msgs[1:]
+	return
+}
+
+// Close the session, and the current connection.
+func (v *PlayerSession) Close() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.closed = true
+	if v.conn != nil {
+		v.conn.Close()
+	}
+
+	v.cond.Broadcast()
+	return nil
+}
+
+func (v *PlayerSession) run() {
+	for {
+		err := v.play()
+
+		v.lock.Lock()
+		closed := v.closed
+		v.rebasing = true
+		v.lock.Unlock()
+
+		if closed {
+			return
+		}
+
+		if v.OnReconnect != nil {
+			v.OnReconnect(err)
+		} else {
+			ol.Wf(nil, "player %v/%v reconnect, err is %v", v.tcUrl, v.stream, err)
+		}
+
+		interval := v.RetryInterval
+		if interval <= 0 {
+			interval = defaultPlayerRetryInterval
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (v *PlayerSession) play() (err error) {
+	dial := v.Dial
+	if dial == nil {
+		dial = dialSession
+	}
+
+	var c net.Conn
+	if c, err = dial(v.addr); err != nil {
+		return oe.Wrapf(err, "dial %v", v.addr)
+	}
+	defer c.Close()
+
+	v.lock.Lock()
+	if v.closed {
+		v.lock.Unlock()
+		return oe.New("player closed")
+	}
+	v.conn = c
+	v.lock.Unlock()
+
+	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	play := ClientPlay
+	if v.Subscribe {
+		play = ClientSubscribePlay
+	}
+
+	var p *Protocol
+	if p, err = play(c, NewHandshake(rd), v.tcUrl, v.stream); err != nil {
+		return oe.WithMessage(err, "play")
+	}
+
+	for {
+		var m *Message
+		if m, err = p.ReadMessage(); err != nil {
+			return oe.WithMessage(err, "read message")
+		}
+
+		switch m.MessageType {
+		case MessageTypeAudio, MessageTypeVideo, MessageTypeAMF0Data, MessageTypeAMF3Data:
+			v.push(m)
+		case MessageTypeAMF0Command, MessageTypeAMF3Command:
+			// Ignore the unknown commands, for example, the _result of unknown request.
+			if pkt, err := p.DecodeMessage(m); err == nil {
+				if status, ok := pkt.(*OnStatusCallPacket); ok {
+					if err = statusError(status); err != nil {
+						return oe.WithMessage(err, "play")
+					}
+				}
+			}
+		}
+	}
+}
+
+// Push the message to buffer, deduplicate the sequence headers, rebase the timestamp.
+func (v *PlayerSession) push(m *Message) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	var last *[]byte
+	switch {
+	case m.MessageType == MessageTypeAMF0Data || m.MessageType == MessageTypeAMF3Data:
+		last = &v.metadata
+	case isAudioSequenceHeader(m):
+		last = &v.audioSequenceHeader
+	case isVideoSequenceHeader(m):
+		last = &v.videoSequenceHeader
+	}
+
+	c := *m
+	if last != nil {
+		if bytes.Equal(*last, m.Payload) {
+			return
+		}
+		*last = m.Payload
+
+		// The sequence header is at the last timestamp of output.
+		c.Timestamp = v.lastTimestamp
+	} else {
+		// Rebase at the first frame of connection.
+		if v.rebasing {
+			v.rebasing, v.base, v.offset = false, m.Timestamp, v.lastTimestamp
+		}
+
+		if c.Timestamp >= v.base {
+			c.Timestamp = v.offset + c.Timestamp - v.base
+		} else {
+			c.Timestamp = v.offset
+		}
+
+		if c.Timestamp > v.lastTimestamp {
+			v.lastTimestamp = c.Timestamp
+		}
+	}
+
+	v.msgs = append(v.msgs, &c)
+	v.trim()
+
+	v.cond.Signal()
+}
+
+// Drop the old messages out of buffer, keep the sequence headers and metadata.
+// @remark Drop to the video keyframe, or wait for it if no keyframe, so the GOP is complete.
+// @remark Drop by timestamp for audio only stream.
+func (v *PlayerSession) trim() {
+	buffer := v.Buffer
+	if buffer <= 0 {
+		buffer = defaultPlayerBuffer
+	}
+
+	limit := uint64(buffer / time.Millisecond)
+	if first := v.msgs[0]; v.lastTimestamp-first.Timestamp <= limit {
+		return
+	}
+
+	// Drop the messages before end, which is the first keyframe in buffer limit, or the last
+	// keyframe if all are out of limit.
+	end, hasVideo := 0, false
+	for i, m := range v.msgs {
+		if m.MessageType == MessageTypeVideo {
+			hasVideo = true
+		}
+		if i == 0 || !isVideoKeyframe(m) {
+			continue
+		}
+
+		if end = i; v.lastTimestamp-m.Timestamp <= limit {
+			break
+		}
+	}
+
+	// For audio only stream, drop the messages out of buffer limit.
+	if !hasVideo {
+		for i, m := range v.msgs {
+			if end = i; v.lastTimestamp-m.Timestamp <= limit {
+				break
+			}
+		}
+	}
+
+	if end == 0 {
+		return
+	}
+
+	var msgs []*Message
+	for _, m := range v.msgs[:end] {
+		if m.MessageType == MessageTypeAMF0Data || m.MessageType == MessageTypeAMF3Data ||
+			isAudioSequenceHeader(m) || isVideoSequenceHeader(m) {
+			msgs = append(msgs, m)
+		} else {
+			v.dropped++
+		}
+	}
+	v.msgs = append(msgs, v.msgs[end:]...)
+}
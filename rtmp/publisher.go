@@ -0,0 +1,278 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The publisher session, which publishes a stream and reconnects on error.
+package rtmp
+
+import (
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Do the complex client handshake over c, fallback to simple, then connect to tcUrl and publish
+// the stream, wait for the onStatus of publish.
+// @remark The stream may carry query, for example, livestream?token=xxx
+// @return The stream id to write messages, see NewStreamMessage. A StatusError if rejected.
+func ClientPublish(c net.Conn, hs *Handshake, tcUrl, stream string) (p *Protocol, streamID int, err error) {
+	if p, err = clientConnect(c, hs, tcUrl); err != nil {
+		return nil, 0, err
+	}
+
+	if err = p.WritePacket(NewCreateStreamPacket(), 0); err != nil {
+		return nil, 0, oe.WithMessage(err, "write create stream")
+	}
+
+	var createStreamRes *CreateStreamResPacket
+	if _, err = p.ExpectPacket(&createStreamRes); err != nil {
+		return nil, 0, oe.WithMessage(err, "expect create stream res")
+	}
+	streamID = int(createStreamRes.StreamID)
+
+	publish := NewPublishPacket()
+	publish.StreamName = amf0.String(stream)
+	if err = p.WritePacket(publish, streamID); err != nil {
+		return nil, 0, oe.WithMessage(err, "write publish")
+	}
+
+	var onStatus *OnStatusCallPacket
+	if _, err = p.ExpectPacket(&onStatus); err != nil {
+		return nil, 0, oe.WithMessage(err, "expect publish status")
+	}
+
+	if err = statusError(onStatus); err != nil {
+		return nil, 0, oe.WithMessage(err, "publish")
+	}
+
+	return
+}
+
+// The default interval to reconnect for publisher.
+const defaultPublisherRetryInterval = time.Duration(1) * time.Second
+
+// The PublisherSession publishes a stream, reconnects on error, then resends the metadata and
+// sequence headers, and resumes from the next video keyframe, so the server got a decodable stream.
+// @remark The messages are dropped when reconnecting, see Dropped.
+// @remark The error of publish onStatus is passed to OnReconnect, see StatusError.
+// @remark It's the producer counterpart to the PlayerSession.
+type PublisherSession struct {
+	// The interval to reconnect. If zero, 1 second is used.
+	RetryInterval time.Duration
+	// The dialer to connect to server, optional. Use TCP to dial the address by default.
+	Dial func(addr string) (net.Conn, error)
+	// The hook when reconnect for err, optional. Log the err if not set.
+	OnReconnect func(err error)
+
+	tcUrl, stream, addr string
+
+	// Serialize the writing, for the state of connection.
+	wlock    sync.Mutex
+	p        *Protocol
+	streamID int
+	// The time to reconnect, after the connection failed.
+	retryAt time.Time
+	// Whether drop the video until keyframe, after connected.
+	waitKeyframe bool
+	// The last sequence headers and metadata, to resend after reconnect.
+	metadata, audioSequenceHeader, videoSequenceHeader *Message
+
+	lock   sync.Mutex
+	closed bool
+	// The current connection, closed when session closed.
+	conn net.Conn
+	// The number of dropped messages for reconnecting.
+	dropped uint64
+}
+
+// Create a publisher session for url, for example, rtmp://ossrs.net/live/livestream
+func NewPublisherSession(url string) (v *PublisherSession, err error) {
+	v = &PublisherSession{}
+	if v.tcUrl, v.stream, v.addr, err = parseSessionURL(url); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Get the number of dropped messages for reconnecting.
+func (v *PublisherSession) Dropped() uint64 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.dropped
+}
+
+// Write the message to stream, connect to server when first write, or reconnect when
+// connection failed, the message is dropped if not connected.
+// Return error only when session is closed.
+func (v *PublisherSession) WriteMessage(m *Message) (err error) {
+	v.wlock.Lock()
+	defer v.wlock.Unlock()
+
+	v.lock.Lock()
+	closed := v.closed
+	v.lock.Unlock()
+
+	if closed {
+		return oe.New("publisher closed")
+	}
+
+	// Cache the sequence headers and metadata, which is sent when connected.
+	var cached bool
+	switch {
+	case m.MessageType == MessageTypeAMF0Data || m.MessageType == MessageTypeAMF3Data:
+		v.metadata, cached = m, true
+	case isAudioSequenceHeader(m):
+		v.audioSequenceHeader, cached = m, true
+	case isVideoSequenceHeader(m):
+		v.videoSequenceHeader, cached = m, true
+	}
+
+	if v.p == nil {
+		if time.Now().Before(v.retryAt) {
+			v.drop(cached)
+			return
+		}
+
+		if err = v.connect(m.Timestamp); err != nil {
+			v.reconnect(err)
+			v.drop(cached)
+			return nil
+		}
+
+		// The cached message is sent when connected.
+		if cached {
+			return
+		}
+	}
+
+	// Resume from the keyframe, because the previous frames are lost.
+	if v.waitKeyframe && m.MessageType == MessageTypeVideo && !cached {
+		if !isVideoKeyframe(m) {
+			v.drop(false)
+			return
+		}
+		v.waitKeyframe = false
+	}
+
+	if err = v.p.WriteMessage(NewRelayMessage(m, v.streamID)); err != nil {
+		v.reconnect(oe.WithMessage(err, "write message"))
+		v.drop(cached)
+		return nil
+	}
+
+	return
+}
+
+// Close the session, and the current connection.
+func (v *PublisherSession) Close() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.closed = true
+	if v.conn != nil {
+		v.conn.Close()
+	}
+
+	return nil
+}
+
+// Connect to server and publish, then send the cached messages at timestamp.
+func (v *PublisherSession) connect(timestamp uint64) (err error) {
+	dial := v.Dial
+	if dial == nil {
+		dial = dialSession
+	}
+
+	var c net.Conn
+	if c, err = dial(v.addr); err != nil {
+		return oe.Wrapf(err, "dial %v", v.addr)
+	}
+
+	v.lock.Lock()
+	if v.closed {
+		v.lock.Unlock()
+		c.Close()
+		return oe.New("publisher closed")
+	}
+	v.conn = c
+	v.lock.Unlock()
+
+	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	var p *Protocol
+	var streamID int
+	if p, streamID, err = ClientPublish(c, NewHandshake(rd), v.tcUrl, v.stream); err != nil {
+		c.Close()
+		return oe.WithMessage(err, "publish")
+	}
+
+	for _, m := range []*Message{v.metadata, v.audioSequenceHeader, v.videoSequenceHeader} {
+		if m == nil {
+			continue
+		}
+
+		r := NewRelayMessage(m, streamID)
+		r.Timestamp = timestamp
+		if err = p.WriteMessage(r); err != nil {
+			c.Close()
+			return oe.WithMessage(err, "write cached message")
+		}
+	}
+
+	v.p, v.streamID, v.waitKeyframe = p, streamID, true
+	return
+}
+
+// Close the connection for err, and reconnect after the retry interval.
+func (v *PublisherSession) reconnect(err error) {
+	v.lock.Lock()
+	if v.conn != nil {
+		v.conn.Close()
+	}
+	v.conn = nil
+	v.lock.Unlock()
+
+	interval := v.RetryInterval
+	if interval <= 0 {
+		interval = defaultPublisherRetryInterval
+	}
+	v.p, v.retryAt = nil, time.Now().Add(interval)
+
+	if v.OnReconnect != nil {
+		v.OnReconnect(err)
+	} else {
+		ol.Wf(nil, "publisher %v/%v reconnect, err is %v", v.tcUrl, v.stream, err)
+	}
+}
+
+// Drop the message when not connected or failed, the cached message is not dropped.
+func (v *PublisherSession) drop(cached bool) {
+	if cached {
+		return
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.dropped++
+}
@@ -0,0 +1,296 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The send queue, to drop frames under congestion for live stream.
+package rtmp
+
+import (
+	"fmt"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The default number of messages of send queue.
+const defaultSendQueueSize = 1024
+
+// The statistics of send queue.
+type SendStats struct {
+	// The number of messages written.
+	Messages uint64
+	// The number of messages in queue.
+	Queued int
+	// The frames dropped for queue full, by message type.
+	Dropped map[MessageType]uint64
+	// The frames dropped for waiting in queue over MaxDelay, by message type.
+	Late map[MessageType]uint64
+}
+
+// The message in send queue.
+type queuedMessage struct {
+	m  *Message
+	at time.Time
+}
+
+// The SendQueue writes the messages to protocol by a goroutine, and drops the audio and
+// video frames under congestion, to keep the latency for live stream. The drops are
+// accounted per message type, so the operators can distinguish network issues, which
+// drop frames in queue, from the encoder issues.
+// @remark The sequence headers, metadata and control messages are never dropped.
+// @remark When a video frame is dropped, the video is dropped until next keyframe.
+type SendQueue struct {
+	// The name of queue, for example, the stream url, used as label of metrics.
+	Name string
+	// The max number of messages in queue, drop frames when full. If zero, 1024 is used.
+	Size int
+	// The max duration of frame in queue, drop the late frames. If zero, never drop late frames.
+	MaxDelay time.Duration
+
+	p *Protocol
+
+	once   sync.Once
+	lock   sync.Mutex
+	cond   *sync.Cond
+	closed bool
+	// The error of writing, the queue is stopped when error.
+	err  error
+	msgs []*queuedMessage
+	// Drop the video until keyframe, for dropping in enqueue and dequeue.
+	dropVideo, lateVideo bool
+
+	stats SendStats
+}
+
+// Create a send queue to write messages to p.
+func NewSendQueue(p *Protocol) *SendQueue {
+	v := &SendQueue{p: p}
+	v.cond = sync.NewCond(&v.lock)
+	v.stats.Dropped = make(map[MessageType]uint64)
+	v.stats.Late = make(map[MessageType]uint64)
+	return v
+}
+
+// Get a copy of statistics.
+func (v *SendQueue) Stats() SendStats {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	s := v.stats
+	s.Queued = len(v.msgs)
+	s.Dropped, s.Late = make(map[MessageType]uint64), make(map[MessageType]uint64)
+	for t, n := range v.stats.Dropped {
+		s.Dropped[t] = n
+	}
+	for t, n := range v.stats.Late {
+		s.Late[t] = n
+	}
+	return s
+}
+
+// Queue the message to write, never block. Return the error of writing if failed.
+// @remark The message is shared, so never modify it after queued.
+func (v *SendQueue) WriteMessage(m *Message) (err error) {
+	v.once.Do(func() {
+		go v.cycle()
+	})
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.err != nil {
+		return v.err
+	}
+	if v.closed {
+		return oe.New("queue closed")
+	}
+
+	size := v.Size
+	if size <= 0 {
+		size = defaultSendQueueSize
+	}
+
+	if isDroppableFrame(m) {
+		if len(v.msgs) >= size || (m.MessageType == MessageTypeVideo && v.dropVideo && !isVideoKeyframe(m)) {
+			v.stats.Dropped[m.MessageType]++
+			if m.MessageType == MessageTypeVideo {
+				v.dropVideo = true
+			}
+			return
+		}
+
+		if m.MessageType == MessageTypeVideo {
+			v.dropVideo = false
+		}
+	}
+
+	v.msgs = append(v.msgs, &queuedMessage{m: m, at: time.Now()})
+	v.cond.Signal()
+
+	return
+}
+
+// Close the queue, the messages in queue are discarded, the protocol is not closed.
+func (v *SendQueue) Close() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.closed = true
+	v.msgs = nil
+	v.cond.Broadcast()
+	return nil
+}
+
+func (v *SendQueue) cycle() {
+	for {
+		m := v.dequeue()
+		if m == nil {
+			return
+		}
+
+		err := v.p.WriteMessage(m)
+
+		v.lock.Lock()
+		if err != nil {
+			v.err = oe.WithMessage(err, "write message")
+		} else {
+			v.stats.Messages++
+		}
+		v.lock.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Get the message to write, drop the late frames, nil if closed.
+func (v *SendQueue) dequeue() *Message {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for {
+		for len(v.msgs) == 0 && !v.closed {
+			v.cond.Wait()
+		}
+
+		if v.closed {
+			return nil
+		}
+
+		qm := v.msgs[0]
+		v.msgs = v.msgs[1:]
+
+		m := qm.m
+		if !isDroppableFrame(m) {
+			return m
+		}
+
+		late := v.MaxDelay > 0 && time.Now().Sub(qm.at) > v.MaxDelay
+		if late || (m.MessageType == MessageTypeVideo && v.lateVideo && !isVideoKeyframe(m)) {
+			v.stats.Late[m.MessageType]++
+			if m.MessageType == MessageTypeVideo {
+				v.lateVideo = true
+			}
+			continue
+		}
+
+		if m.MessageType == MessageTypeVideo {
+			v.lateVideo = false
+		}
+		return m
+	}
+}
+
+// Whether the message is audio or video frame, which can be dropped.
+func isDroppableFrame(m *Message) bool {
+	if m.MessageType != MessageTypeAudio && m.MessageType != MessageTypeVideo {
+		return false
+	}
+	return !isAudioSequenceHeader(m) && !isVideoSequenceHeader(m)
+}
+
+// The name of message type, for the label of metrics.
+func messageTypeName(t MessageType) string {
+	switch t {
+	case MessageTypeAudio:
+		return "audio"
+	case MessageTypeVideo:
+		return "video"
+	default:
+		return fmt.Sprint(uint8(t))
+	}
+}
+
+// Write the statistics of queues in the Prometheus text format, for example, as a
+// collector of http.Metrics:
+//		metrics.Register(http.CollectorFunc(func(w io.Writer) error {
+//			return rtmp.WriteSendMetrics(w, queues...)
+//		}))
+func WriteSendMetrics(w io.Writer, queues ...*SendQueue) (err error) {
+	type counter struct {
+		name, help string
+		values     func(s *SendStats) map[MessageType]uint64
+	}
+
+	stats := make([]SendStats, 0, len(queues))
+	for _, q := range queues {
+		stats = append(stats, q.Stats())
+	}
+
+	for _, c := range []counter{
+		{"rtmp_send_dropped_total", "The frames dropped for send queue full.", func(s *SendStats) map[MessageType]uint64 { return s.Dropped }},
+		{"rtmp_send_late_total", "The frames dropped for waiting in send queue too long.", func(s *SendStats) map[MessageType]uint64 { return s.Late }},
+	} {
+		if _, err = fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v counter\n", c.name, c.help, c.name); err != nil {
+			return oe.Wrap(err, "write")
+		}
+
+		for i, q := range queues {
+			values := c.values(&stats[i])
+
+			types := make([]int, 0, len(values))
+			for t := range values {
+				types = append(types, int(t))
+			}
+			sort.Ints(types)
+
+			for _, t := range types {
+				if _, err = fmt.Fprintf(w, "%v{queue=%q,type=%q} %v\n", c.name, q.Name,
+					messageTypeName(MessageType(t)), values[MessageType(t)]); err != nil {
+					return oe.Wrap(err, "write")
+				}
+			}
+		}
+	}
+
+	if _, err = fmt.Fprintln(w, "# HELP rtmp_send_queued The messages in send queue.\n# TYPE rtmp_send_queued gauge"); err != nil {
+		return oe.Wrap(err, "write")
+	}
+	for i, q := range queues {
+		if _, err = fmt.Fprintf(w, "rtmp_send_queued{queue=%q} %v\n", q.Name, stats[i].Queued); err != nil {
+			return oe.Wrap(err, "write")
+		}
+	}
+
+	return
+}
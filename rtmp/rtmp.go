@@ -34,11 +34,17 @@ import (
 	"math/rand"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // The handshake implements the RTMP handshake protocol.
 type Handshake struct {
 	r *rand.Rand
+	// The dir to save the failed handshake, see SetCaptureDir.
+	captureDir string
+	// The compliance check of peer, see SetComplianceMode.
+	compliance
 }
 
 func NewHandshake(r *rand.Rand) *Handshake {
@@ -66,13 +72,7 @@ func (v *Handshake) ReadC0S0(r io.Reader) (c0 []byte, err error) {
 }
 
 func (v *Handshake) WriteC1S1(w io.Writer) (err error) {
-	p := make([]byte, 1536)
-
-	for i := 8; i < len(p); i++ {
-		p[i] = byte(v.r.Int())
-	}
-
-	r := bytes.NewReader(p)
+	r := bytes.NewReader(v.createSimpleC1S1())
 	if _, err = io.Copy(w, r); err != nil {
 		return oe.Wrap(err, "write c0s1")
 	}
@@ -125,6 +125,12 @@ const extendedTimestamp = uint64(0xffffff)
 // The default chunk size of RTMP is 128 bytes.
 const defaultChunkSize = 128
 
+// The range of chunk size, the peer which sets the chunk size out of range is rejected.
+const (
+	MinChunkSize = 128
+	MaxChunkSize = 65536
+)
+
 // The intput or output settings for RTMP protocol.
 type settings struct {
 	chunkSize uint32
@@ -150,31 +156,92 @@ func newChunkStream() *chunkStream {
 	return &chunkStream{}
 }
 
+// The reader and writer which counts the bytes.
+// @remark The counters must be the first fields, for atomic on 32bits platforms.
+type countReadWriter struct {
+	in, out uint64
+	rw      io.ReadWriter
+}
+
+func (v *countReadWriter) Read(p []byte) (n int, err error) {
+	n, err = v.rw.Read(p)
+	atomic.AddUint64(&v.in, uint64(n))
+	return
+}
+
+func (v *countReadWriter) Write(p []byte) (n int, err error) {
+	n, err = v.rw.Write(p)
+	atomic.AddUint64(&v.out, uint64(n))
+	return
+}
+
+// The minimum payload and chunk size to use writev, because it's slower than bufio for small iovecs.
+const (
+	writevMinPayload   = 4096
+	writevMinChunkSize = 1024
+)
+
 // The protocol implements the RTMP command and chunk stack.
 type Protocol struct {
 	r     *bufio.Reader
 	w     *bufio.Writer
+	rw    *countReadWriter
 	input struct {
 		opt    *settings
 		chunks map[chunkID]*chunkStream
-
-		transactions  map[amf0.Number]amf0.String
+		// Whether response the ping request automatically.
+		autoPingResponse bool
+		// The maximum chunk size allowed to set by peer.
+		maxChunkSize uint32
+		// The window acknowledgement size of peer, and the bytes when last acknowledgement sent.
+		ackWindow  uint32
+		ackedBytes uint64
+		// Whether got media message before the window acknowledgement size.
+		mediaBeforeAck bool
+
+		transactions  map[amf0.Number]*transaction
 		ltransactions sync.Mutex
+		policy        TransactionPolicy
+		// The last transaction id of call.
+		lastTid amf0.Number
+		// The transform of payload after chunk assembly, nil to disable.
+		transform PayloadTransform
+		// Whether pass the data messages through without decode.
+		dataPassthrough bool
 	}
 	output struct {
-		opt *settings
-	}
+		// To write messages in multiple goroutines, for example, the acknowledgement.
+		lock sync.Mutex
+		opt  *settings
+		// The buffer for chunk headers.
+		header []byte
+		// The iovecs of chunk headers and payloads, to write by writev.
+		iovecs [][]byte
+		// The transform of payload before chunking, nil to disable.
+		transform PayloadTransform
+		// The policy to disconnect slow peer, the stalls accumulated in window since
+		// stallStart, and the error when peer is slow.
+		policy     WritePolicy
+		stallStart time.Time
+		stalled    time.Duration
+		slow       error
+	}
+	// The compliance check of peer, see SetComplianceMode.
+	compliance
 }
 
 func NewProtocol(rw io.ReadWriter) *Protocol {
+	crw := &countReadWriter{rw: rw}
 	v := &Protocol{
-		r: bufio.NewReader(rw),
-		w: bufio.NewWriter(rw),
+		r:  bufio.NewReader(crw),
+		w:  bufio.NewWriter(crw),
+		rw: crw,
 	}
 
 	v.input.opt = newSettings()
 	v.input.chunks = map[chunkID]*chunkStream{}
-	v.input.transactions = map[amf0.Number]amf0.String{}
+	v.input.transactions = map[amf0.Number]*transaction{}
+	v.input.maxChunkSize = MaxChunkSize
 
 	v.output.opt = newSettings()
 
@@ -246,20 +313,9 @@ func (v *Protocol) parseAMFObject(p []byte) (pkt Packet, err error) {
 			return nil, oe.WithMessage(err, "unmarshal tid")
 		}
 
-		var requestName amf0.String
-		if err = func() error {
-			v.input.ltransactions.Lock()
-			defer v.input.ltransactions.Unlock()
-
-			var ok bool
-			if requestName, ok = v.input.transactions[transactionID]; !ok {
-				return oe.Errorf("No matched request for tid=%v", transactionID)
-			}
-			delete(v.input.transactions, transactionID)
-
-			return nil
-		}(); err != nil {
-			return nil, oe.WithMessage(err, "discovery request name")
+		requestName, ok := v.finishTransaction(transactionID)
+		if !ok {
+			return nil, oe.Errorf("No matched request for tid=%v", transactionID)
 		}
 
 		switch requestName {
@@ -267,13 +323,27 @@ func (v *Protocol) parseAMFObject(p []byte) (pkt Packet, err error) {
 			return NewConnectAppResPacket(transactionID), nil
 		case commandCreateStream:
 			return NewCreateStreamResPacket(transactionID), nil
+		case commandReleaseStream, commandFCPublish, commandFCUnpublish, commandFCSubscribe:
+			return NewFMLEStartResPacket(transactionID), nil
 		default:
-			return nil, oe.Errorf("No request for %v", string(requestName))
+			return &RPCPacket{}, nil
 		}
 	case commandConnect:
 		return NewConnectAppPacket(), nil
+	case commandCreateStream:
+		return NewCreateStreamPacket(), nil
 	case commandPublish:
 		return NewPublishPacket(), nil
+	case commandPlay:
+		return NewPlayPacket(), nil
+	case commandPlay2:
+		return NewPlay2Packet(), nil
+	case commandPause:
+		return NewPausePacket(), nil
+	case commandOnStatus:
+		return NewOnStatusCallPacket(), nil
+	case commandReleaseStream, commandFCPublish, commandFCUnpublish, commandFCSubscribe:
+		return newFMLEStartPacket(commandName), nil
 	default:
 		return NewCallPacket(), nil
 	}
@@ -285,6 +355,15 @@ func (v *Protocol) DecodeMessage(m *Message) (pkt Packet, err error) {
 		return nil, oe.New("Empty packet")
 	}
 
+	// The data is not decoded, the payload is shared without copy.
+	if v.input.dataPassthrough && (m.MessageType == MessageTypeAMF0Data || m.MessageType == MessageTypeAMF3Data) {
+		pkt = NewRawDataPacket(m.MessageType)
+		if err = pkt.UnmarshalBinary(p); err != nil {
+			return nil, oe.WithMessage(err, fmt.Sprintf("Unmarshal %v", m.MessageType))
+		}
+		return
+	}
+
 	switch m.MessageType {
 	case MessageTypeAMF3Command, MessageTypeAMF3Data:
 		p = p[1:]
@@ -293,6 +372,8 @@ func (v *Protocol) DecodeMessage(m *Message) (pkt Packet, err error) {
 	switch m.MessageType {
 	case MessageTypeSetChunkSize:
 		pkt = NewSetChunkSize()
+	case MessageTypeAcknowledgement:
+		pkt = NewAcknowledgement()
 	case MessageTypeWindowAcknowledgementSize:
 		pkt = NewWindowAcknowledgementSize()
 	case MessageTypeSetPeerBandwidth:
@@ -327,7 +408,7 @@ func (v *Protocol) ReadMessage() (m *Message, err error) {
 		if chunk, ok = v.input.chunks[cid]; !ok {
 			chunk = newChunkStream()
 			v.input.chunks[cid] = chunk
-			chunk.header.betterCid = cid
+			chunk.cid, chunk.header.betterCid = cid, cid
 		}
 
 		if err = v.readMessageHeader(chunk, format); err != nil {
@@ -338,6 +419,12 @@ func (v *Protocol) ReadMessage() (m *Message, err error) {
 			return nil, oe.WithMessage(err, "read message payload")
 		}
 
+		if m != nil && v.input.transform != nil {
+			if m.Payload, err = v.input.transform(m); err != nil {
+				return nil, oe.WithMessage(err, "transform payload")
+			}
+		}
+
 		if err = v.onMessageArrivated(m); err != nil {
 			return nil, oe.WithMessage(err, "on message")
 		}
@@ -471,6 +558,10 @@ func (v *Protocol) readMessageHeader(chunk *chunkStream, format formatType) (err
 		// @see: https://github.com/ossrs/srs/issues/98
 		if chunk.cid == chunkIDProtocolControl && format == formatType1 {
 			// We accept cid=2, fmt=1 to make librtmp happy.
+			if err = v.violate(atomic.LoadUint64(&v.rw.in), RuleFreshChunkFormat,
+				"fresh chunk fmt %v, cid is %v", format, chunk.cid); err != nil {
+				return err
+			}
 		} else {
 			return oe.Errorf("For fresh chunk, fmt %v != %v(required), cid is %v", format, formatType0, chunk.cid)
 		}
@@ -702,39 +793,60 @@ func (v *Protocol) WritePacket(pkt Packet, streamID int) (err error) {
 	m.streamID = uint32(streamID)
 	m.betterCid = pkt.BetterCid()
 
-	if err = v.WriteMessage(m); err != nil {
-		return oe.WithMessage(err, "write message")
+	// Start the transaction before write, because the response may arrive
+	// before WriteMessage returns.
+	tid, name := v.requestOf(pkt)
+	if tid > 0 && len(name) > 0 {
+		if err = v.startTransaction(tid, name); err != nil {
+			return oe.WithMessage(err, "start transaction")
+		}
 	}
 
-	if err = v.onPacketWriten(m, pkt); err != nil {
-		return oe.WithMessage(err, "on write packet")
+	if err = v.WriteMessage(m); err != nil {
+		if tid > 0 && len(name) > 0 {
+			v.finishTransaction(tid)
+		}
+		return oe.WithMessage(err, "write message")
 	}
 
 	return
 }
 
-func (v *Protocol) onPacketWriten(m *Message, pkt Packet) (err error) {
-	var tid amf0.Number
-	var name amf0.String
-
+// Get the transaction id and command name, if the packet is a request which expect a response.
+func (v *Protocol) requestOf(pkt Packet) (tid amf0.Number, name amf0.String) {
 	switch pkt := pkt.(type) {
 	case *ConnectAppPacket:
 		tid, name = pkt.TransactionID, pkt.CommandName
 	case *CreateStreamPacket:
 		tid, name = pkt.TransactionID, pkt.CommandName
+	case *FMLEStartPacket:
+		tid, name = pkt.TransactionID, pkt.CommandName
+	case *RPCPacket:
+		if pkt.CommandName != commandResult && pkt.CommandName != commandError {
+			tid, name = pkt.TransactionID, pkt.CommandName
+		}
 	}
+	return
+}
 
-	if tid > 0 && len(name) > 0 {
-		v.input.ltransactions.Lock()
-		defer v.input.ltransactions.Unlock()
+func (v *Protocol) onMessageArrivated(m *Message) (err error) {
+	// Acknowledge for each chunk, because the large message might exceed the window.
+	if err = v.acknowledge(); err != nil {
+		return oe.WithMessage(err, "acknowledge")
+	}
 
-		v.input.transactions[tid] = name
+	// The message is not completed, for example, the large message in multiple chunks.
+	if m == nil {
+		return
 	}
 
-	return
-}
+	// Expire the transactions, when got any message.
+	v.gcTransactions()
+
+	if err = v.checkCompliance(m); err != nil {
+		return err
+	}
 
-func (v *Protocol) onMessageArrivated(m *Message) (err error) {
 	var pkt Packet
 	switch m.MessageType {
 	case MessageTypeSetChunkSize, MessageTypeUserControl, MessageTypeWindowAcknowledgementSize:
@@ -745,34 +857,150 @@ func (v *Protocol) onMessageArrivated(m *Message) (err error) {
 
 	switch pkt := pkt.(type) {
 	case *SetChunkSize:
+		if pkt.ChunkSize < MinChunkSize || pkt.ChunkSize > v.input.maxChunkSize {
+			return oe.Errorf("invalid chunk size %v, should in [%v, %v]", pkt.ChunkSize, MinChunkSize, v.input.maxChunkSize)
+		}
 		v.input.opt.chunkSize = pkt.ChunkSize
+	case *WindowAcknowledgementSize:
+		v.input.ackWindow = pkt.AckSize
+	case *UserControl:
+		if pkt.EventType == EventTypePingRequest && v.input.autoPingResponse {
+			res := NewUserControl()
+			res.EventType, res.EventData = EventTypePingResponse, pkt.EventData
+			if err = v.WritePacket(res, 0); err != nil {
+				return oe.WithMessage(err, "write ping response")
+			}
+		}
 	}
 
 	return
 }
 
+// Whether response the ping request of peer automatically, the timestamp of request is
+// echoed, or server such as FMS/AMS drops the connection. It's disabled by default.
+// @remark The ping request is still returned by ReadMessage.
+func (v *Protocol) SetAutoPingResponse(enabled bool) {
+	v.input.autoPingResponse = enabled
+}
+
+// Send the SetChunkSize to peer and use the chunk size n to write messages, for example,
+// 60000 for video to reduce the chunk headers. The n should in [MinChunkSize, MaxChunkSize].
+func (v *Protocol) SetOutputChunkSize(n uint32) (err error) {
+	if n < MinChunkSize || n > MaxChunkSize {
+		return oe.Errorf("invalid chunk size %v, should in [%v, %v]", n, MinChunkSize, MaxChunkSize)
+	}
+
+	pkt := NewSetChunkSize()
+	pkt.ChunkSize = n
+
+	m := NewMessage()
+	if m.Payload, err = pkt.MarshalBinary(); err != nil {
+		return oe.WithMessage(err, "marshal payload")
+	}
+	m.MessageType, m.betterCid = pkt.Type(), pkt.BetterCid()
+
+	// Switch the chunk size after the SetChunkSize is written, in the same lock, so the
+	// messages in other goroutines never mess up.
+	v.output.lock.Lock()
+	defer v.output.lock.Unlock()
+
+	if err = v.writeMessage(m); err != nil {
+		return oe.WithMessage(err, "write chunk size")
+	}
+	v.output.opt.chunkSize = n
+
+	return
+}
+
+// Set the maximum chunk size allowed to set by peer, the default is MaxChunkSize. The
+// ReadMessage fails when peer sets the chunk size out of range, to protect the memory.
+func (v *Protocol) SetMaxInputChunkSize(n uint32) {
+	v.input.maxChunkSize = n
+}
+
+// Send the acknowledgement when the received bytes exceed the window of peer, or FMS/AMS
+// might stop sending data.
+func (v *Protocol) acknowledge() (err error) {
+	if v.input.ackWindow == 0 {
+		return
+	}
+
+	in := v.InBytes()
+	if in-v.input.ackedBytes < uint64(v.input.ackWindow) {
+		return
+	}
+	v.input.ackedBytes = in
+
+	// The sequence number is the bytes received so far, which wraps at 32bits.
+	ack := NewAcknowledgement()
+	ack.SequenceNumber = uint32(in)
+	if err = v.WritePacket(ack, 0); err != nil {
+		return oe.WithMessage(err, "write ack")
+	}
+
+	return
+}
+
+// The number of bytes received from peer.
+// @remark It's safe to call it in other goroutines.
+func (v *Protocol) InBytes() uint64 {
+	return atomic.LoadUint64(&v.rw.in)
+}
+
+// The number of bytes sent to peer.
+// @remark It's safe to call it in other goroutines.
+func (v *Protocol) OutBytes() uint64 {
+	return atomic.LoadUint64(&v.rw.out)
+}
+
+// Write the message, which payload is already encoded, for example, the audio or video
+// message from publisher, so it's the fast path for relays. The payload is written
+// without any copy or AMF decode/encode, only the chunk headers are generated.
+// @remark The message is not modified, so it's safe to write it to multiple protocols.
+// @remark The chunks are written by writev when the underlayer is a net.Conn, for go1.8+.
 func (v *Protocol) WriteMessage(m *Message) (err error) {
-	m.payloadLength = uint32(len(m.Payload))
+	v.output.lock.Lock()
+	defer v.output.lock.Unlock()
 
-	var c0h, c3h []byte
-	if c0h, err = m.generateC0Header(); err != nil {
-		return oe.WithMessage(err, "generate c0 header")
+	return v.writeMessage(m)
+}
+
+// Write the message, the caller should hold the output lock.
+func (v *Protocol) writeMessage(m *Message) (err error) {
+	start, err := v.beforeWrite()
+	if err != nil {
+		return err
 	}
-	if c3h, err = m.generateC3Header(); err != nil {
-		return oe.WithMessage(err, "generate c3 header")
+	defer func() {
+		err = v.afterWrite(start, err)
+	}()
+
+	// The message might be shared, so never modify it.
+	if v.output.transform != nil {
+		var payload []byte
+		if payload, err = v.output.transform(m); err != nil {
+			return oe.WithMessage(err, "transform payload")
+		}
+
+		tm := *m
+		tm.Payload = payload
+		m = &tm
 	}
 
-	var h []byte
+	// Reuse the buffer for the c0 and c3 headers.
+	v.output.header = m.appendC0Header(v.output.header[:0])
+	c0h := v.output.header
+	v.output.header = m.appendC3Header(v.output.header)
+	c3h := v.output.header[len(c0h):]
+
+	// Build the iovecs of headers and payload slices, the payload is never copied.
+	iovecs := v.output.iovecs[:0]
 	p := m.Payload
 	for len(p) > 0 {
-		if h == nil {
-			h = c0h
+		if len(iovecs) == 0 {
+			iovecs = append(iovecs, c0h)
 		} else {
-			h = c3h
-		}
-
-		if _, err = io.Copy(v.w, bytes.NewReader(h)); err != nil {
-			return oe.Wrapf(err, "write c0c3 header %x", h)
+			iovecs = append(iovecs, c3h)
 		}
 
 		size := len(p)
@@ -780,13 +1008,34 @@ func (v *Protocol) WriteMessage(m *Message) (err error) {
 			size = int(v.output.opt.chunkSize)
 		}
 
-		if _, err = io.Copy(v.w, bytes.NewReader(p[:size])); err != nil {
-			return oe.Wrapf(err, "write chunk payload %vB", size)
-		}
+		iovecs = append(iovecs, p[:size])
 		p = p[size:]
 	}
 
-	// TODO: FIXME: Use writev to write for high performance.
+	// Reset the iovecs to not reference the payload, because the writev consumes the slices.
+	defer func() {
+		for i := range iovecs {
+			iovecs[i] = nil
+		}
+		v.output.iovecs = iovecs[:0]
+	}()
+
+	// Use writev for conn, which writes all chunks in one syscall. For small message or chunk, the
+	// iovecs are small and it's faster to copy them to the bufio.
+	if len(m.Payload) >= writevMinPayload && v.output.opt.chunkSize >= writevMinChunkSize && v.rw.writevable() {
+		if _, err = v.rw.writeBuffers(iovecs); err != nil {
+			return oe.Wrapf(err, "writev %v iovecs", len(iovecs))
+		}
+		return
+	}
+
+	// Fallback to write by bufio, which writes large payload directly to the underlayer writer.
+	for _, iovec := range iovecs {
+		if _, err = v.w.Write(iovec); err != nil {
+			return oe.Wrapf(err, "write chunk %vB", len(iovec))
+		}
+	}
+
 	if err = v.w.Flush(); err != nil {
 		return oe.Wrapf(err, "flush writer")
 	}
@@ -903,77 +1152,62 @@ func NewStreamMessage(streamID int) *Message {
 	return v
 }
 
-func (v *Message) generateC3Header() ([]byte, error) {
-	var c3h []byte
-	if v.Timestamp < extendedTimestamp {
-		c3h = make([]byte, 1)
-	} else {
-		c3h = make([]byte, 1+4)
+// Create a message to relay m to streamID, the payload is shared without copy.
+// The chunk stream of audio and video is separated, like SRS.
+func NewRelayMessage(m *Message, streamID int) *Message {
+	v := NewStreamMessage(streamID)
+	v.MessageType = m.MessageType
+	v.Timestamp = m.Timestamp
+	v.Payload = m.Payload
+
+	switch m.MessageType {
+	case MessageTypeAudio:
+		v.betterCid = chunkIDAudio
+	case MessageTypeVideo:
+		v.betterCid = chunkIDVideo
 	}
 
-	p := c3h
-	p[0] = 0xc0 | byte(v.betterCid&0x3f)
-	p = p[1:]
+	return v
+}
+
+// Append the c3 header to b, and return the new slice.
+func (v *Message) appendC3Header(b []byte) []byte {
+	b = append(b, 0xc0|byte(v.betterCid&0x3f))
 
 	// In RTMP protocol, there must not any timestamp in C3 header,
 	// but actually all products from adobe, such as FMS/AMS and Flash player and FMLE,
 	// always carry a extended timestamp in C3 header.
 	// @see: http://blog.csdn.net/win_lin/article/details/13363699
 	if v.Timestamp >= extendedTimestamp {
-		p[0] = byte(v.Timestamp >> 24)
-		p[1] = byte(v.Timestamp >> 16)
-		p[2] = byte(v.Timestamp >> 8)
-		p[3] = byte(v.Timestamp)
+		b = append(b, byte(v.Timestamp>>24), byte(v.Timestamp>>16), byte(v.Timestamp>>8), byte(v.Timestamp))
 	}
 
-	return c3h, nil
+	return b
 }
 
-func (v *Message) generateC0Header() ([]byte, error) {
-	var c0h []byte
-	if v.Timestamp < extendedTimestamp {
-		c0h = make([]byte, 1+3+3+1+4)
-	} else {
-		c0h = make([]byte, 1+3+3+1+4+4)
-	}
-
-	p := c0h
-	p[0] = byte(v.betterCid) & 0x3f
-	p = p[1:]
+// Append the c0 header to b, and return the new slice.
+// @remark The payload length is the size of payload, the message is not modified.
+func (v *Message) appendC0Header(b []byte) []byte {
+	b = append(b, byte(v.betterCid)&0x3f)
 
 	if v.Timestamp < extendedTimestamp {
-		p[0] = byte(v.Timestamp >> 16)
-		p[1] = byte(v.Timestamp >> 8)
-		p[2] = byte(v.Timestamp)
+		b = append(b, byte(v.Timestamp>>16), byte(v.Timestamp>>8), byte(v.Timestamp))
 	} else {
-		p[0] = 0xff
-		p[1] = 0xff
-		p[2] = 0xff
+		b = append(b, 0xff, 0xff, 0xff)
 	}
-	p = p[3:]
 
-	p[0] = byte(v.payloadLength >> 16)
-	p[1] = byte(v.payloadLength >> 8)
-	p[2] = byte(v.payloadLength)
-	p = p[3:]
+	payloadLength := uint32(len(v.Payload))
+	b = append(b, byte(payloadLength>>16), byte(payloadLength>>8), byte(payloadLength))
 
-	p[0] = byte(v.MessageType)
-	p = p[1:]
+	b = append(b, byte(v.MessageType))
 
-	p[0] = byte(v.streamID)
-	p[1] = byte(v.streamID >> 8)
-	p[2] = byte(v.streamID >> 16)
-	p[3] = byte(v.streamID >> 24)
-	p = p[4:]
+	b = append(b, byte(v.streamID), byte(v.streamID>>8), byte(v.streamID>>16), byte(v.streamID>>24))
 
 	if v.Timestamp >= extendedTimestamp {
-		p[0] = byte(v.Timestamp >> 24)
-		p[1] = byte(v.Timestamp >> 16)
-		p[2] = byte(v.Timestamp >> 8)
-		p[3] = byte(v.Timestamp)
+		b = append(b, byte(v.Timestamp>>24), byte(v.Timestamp>>16), byte(v.Timestamp>>8), byte(v.Timestamp))
 	}
 
-	return c0h, nil
+	return b
 }
 
 // Please read the cs id of @doc rtmp_specification_1.0.pdf, @page 17, @section 6.1.1. Chunk Basic Header
@@ -995,6 +1229,7 @@ const (
 	commandCreateStream     amf0.String = amf0.String("createStream")
 	commandCloseStream      amf0.String = amf0.String("closeStream")
 	commandPlay             amf0.String = amf0.String("play")
+	commandPlay2            amf0.String = amf0.String("play2")
 	commandPause            amf0.String = amf0.String("pause")
 	commandOnBWDone         amf0.String = amf0.String("onBWDone")
 	commandOnStatus         amf0.String = amf0.String("onStatus")
@@ -1003,6 +1238,8 @@ const (
 	commandReleaseStream    amf0.String = amf0.String("releaseStream")
 	commandFCPublish        amf0.String = amf0.String("FCPublish")
 	commandFCUnpublish      amf0.String = amf0.String("FCUnpublish")
+	commandFCSubscribe      amf0.String = amf0.String("FCSubscribe")
+	commandOnFCSubscribe    amf0.String = amf0.String("onFCSubscribe")
 	commandPublish          amf0.String = amf0.String("publish")
 	commandRtmpSampleAccess amf0.String = amf0.String("|RtmpSampleAccess")
 )
@@ -1074,27 +1311,26 @@ func (v *objectCallPacket) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *objectCallPacket) MarshalBinary() (data []byte, err error) {
-	var pb []byte
-	if pb, err = v.CommandName.MarshalBinary(); err != nil {
+	return v.appendBinary(make([]byte, 0, v.Size()))
+}
+
+func (v *objectCallPacket) appendBinary(dst []byte) (data []byte, err error) {
+	if data, err = v.CommandName.AppendBinary(dst); err != nil {
 		return nil, oe.WithMessage(err, "marshal command name")
 	}
-	data = append(data, pb...)
 
-	if pb, err = v.TransactionID.MarshalBinary(); err != nil {
+	if data, err = v.TransactionID.AppendBinary(data); err != nil {
 		return nil, oe.WithMessage(err, "marshal tid")
 	}
-	data = append(data, pb...)
 
-	if pb, err = v.CommandObject.MarshalBinary(); err != nil {
+	if data, err = amf0.Append(data, v.CommandObject); err != nil {
 		return nil, oe.WithMessage(err, "marshal command object")
 	}
-	data = append(data, pb...)
 
 	if v.Args != nil {
-		if pb, err = v.Args.MarshalBinary(); err != nil {
+		if data, err = amf0.Append(data, v.Args); err != nil {
 			return nil, oe.WithMessage(err, "marshal args")
 		}
-		data = append(data, pb...)
 	}
 
 	return
@@ -1208,22 +1444,22 @@ func (v *variantCallPacket) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *variantCallPacket) MarshalBinary() (data []byte, err error) {
-	var pb []byte
-	if pb, err = v.CommandName.MarshalBinary(); err != nil {
+	return v.appendBinary(make([]byte, 0, v.Size()))
+}
+
+func (v *variantCallPacket) appendBinary(dst []byte) (data []byte, err error) {
+	if data, err = v.CommandName.AppendBinary(dst); err != nil {
 		return nil, oe.WithMessage(err, "marshal command name")
 	}
-	data = append(data, pb...)
 
-	if pb, err = v.TransactionID.MarshalBinary(); err != nil {
+	if data, err = v.TransactionID.AppendBinary(data); err != nil {
 		return nil, oe.WithMessage(err, "marshal tid")
 	}
-	data = append(data, pb...)
 
 	if v.CommandObject != nil {
-		if pb, err = v.CommandObject.MarshalBinary(); err != nil {
+		if data, err = amf0.Append(data, v.CommandObject); err != nil {
 			return nil, oe.WithMessage(err, "marshal command object")
 		}
-		data = append(data, pb...)
 	}
 
 	return
@@ -1281,17 +1517,14 @@ func (v *CallPacket) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *CallPacket) MarshalBinary() (data []byte, err error) {
-	var pb []byte
-	if pb, err = v.variantCallPacket.MarshalBinary(); err != nil {
+	if data, err = v.variantCallPacket.appendBinary(make([]byte, 0, v.Size())); err != nil {
 		return nil, oe.WithMessage(err, "marshal call")
 	}
-	data = append(data, pb...)
 
 	if v.Args != nil {
-		if pb, err = v.Args.MarshalBinary(); err != nil {
+		if data, err = amf0.Append(data, v.Args); err != nil {
 			return nil, oe.WithMessage(err, "marshal args")
 		}
-		data = append(data, pb...)
 	}
 
 	return
@@ -1348,16 +1581,13 @@ func (v *CreateStreamResPacket) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *CreateStreamResPacket) MarshalBinary() (data []byte, err error) {
-	var pb []byte
-	if pb, err = v.variantCallPacket.MarshalBinary(); err != nil {
+	if data, err = v.variantCallPacket.appendBinary(make([]byte, 0, v.Size())); err != nil {
 		return nil, oe.WithMessage(err, "marshal call")
 	}
-	data = append(data, pb...)
 
-	if pb, err = v.StreamID.MarshalBinary(); err != nil {
+	if data, err = v.StreamID.AppendBinary(data); err != nil {
 		return nil, oe.WithMessage(err, "marshal sid")
 	}
-	data = append(data, pb...)
 
 	return
 }
@@ -1402,21 +1632,17 @@ func (v *PublishPacket) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *PublishPacket) MarshalBinary() (data []byte, err error) {
-	var pb []byte
-	if pb, err = v.variantCallPacket.MarshalBinary(); err != nil {
+	if data, err = v.variantCallPacket.appendBinary(make([]byte, 0, v.Size())); err != nil {
 		return nil, oe.WithMessage(err, "marshal call")
 	}
-	data = append(data, pb...)
 
-	if pb, err = v.StreamName.MarshalBinary(); err != nil {
+	if data, err = v.StreamName.AppendBinary(data); err != nil {
 		return nil, oe.WithMessage(err, "marshal stream name")
 	}
-	data = append(data, pb...)
 
-	if pb, err = v.StreamType.MarshalBinary(); err != nil {
+	if data, err = v.StreamType.AppendBinary(data); err != nil {
 		return nil, oe.WithMessage(err, "marshal stream type")
 	}
-	data = append(data, pb...)
 
 	return
 }
@@ -1455,20 +1681,178 @@ func (v *PlayPacket) UnmarshalBinary(data []byte) (err error) {
 }
 
 func (v *PlayPacket) MarshalBinary() (data []byte, err error) {
-	var pb []byte
-	if pb, err = v.variantCallPacket.MarshalBinary(); err != nil {
+	if data, err = v.variantCallPacket.appendBinary(make([]byte, 0, v.Size())); err != nil {
 		return nil, oe.WithMessage(err, "marshal call")
 	}
-	data = append(data, pb...)
 
-	if pb, err = v.StreamName.MarshalBinary(); err != nil {
+	if data, err = v.StreamName.AppendBinary(data); err != nil {
 		return nil, oe.WithMessage(err, "marshal stream name")
 	}
-	data = append(data, pb...)
 
 	return
 }
 
+// The play2 packet, to switch the stream without stopping playback, for example, the
+// bitrates of multiple bitrate stream. The parameters is a NetStreamPlayOptions object:
+//		streamName, the new stream to play.
+//		oldStreamName, the stream to switch from.
+//		transition, for example, switch or swap.
+//		start, len and offset, in seconds.
+// @remark The server response onStatus NetStream.Play.Transition when switched.
+type Play2Packet struct {
+	variantCallPacket
+	Parameters *amf0.Object
+}
+
+func NewPlay2Packet() *Play2Packet {
+	v := &Play2Packet{}
+	v.CommandName = commandPlay2
+	v.CommandObject = amf0.NewNull()
+	v.Parameters = amf0.NewObject()
+	return v
+}
+
+// Create a play2 to switch from oldStream to stream.
+func NewPlay2SwitchPacket(oldStream, stream string) *Play2Packet {
+	v := NewPlay2Packet()
+	v.Parameters.Set("streamName", amf0.NewString(stream))
+	v.Parameters.Set("oldStreamName", amf0.NewString(oldStream))
+	v.Parameters.Set("transition", amf0.NewString("switch"))
+	v.Parameters.Set("start", amf0.NewNumber(-2))
+	v.Parameters.Set("len", amf0.NewNumber(-1))
+	v.Parameters.Set("offset", amf0.NewNumber(-1))
+	return v
+}
+
+// Get the string parameter of key, empty if not exists.
+func (v *Play2Packet) Get(key string) string {
+	if s, ok := v.Parameters.Get(key).(*amf0.String); ok {
+		return string(*s)
+	}
+	return ""
+}
+
+// The FMLE start packets, releaseStream, FCPublish and FCUnpublish, which is sent by
+// FMLE or OBS before publish or after unpublish.
+// @remark The FCSubscribe is also FMLE start packet, which is sent by player before play,
+// required by some CDNs, and the server response the onFCSubscribe.
+type FMLEStartPacket struct {
+	variantCallPacket
+	StreamName amf0.String
+}
+
+func newFMLEStartPacket(name amf0.String) *FMLEStartPacket {
+	v := &FMLEStartPacket{}
+	v.CommandName = name
+	v.CommandObject = amf0.NewNull()
+	return v
+}
+
+func NewReleaseStreamPacket() *FMLEStartPacket {
+	return newFMLEStartPacket(commandReleaseStream)
+}
+
+func NewFCPublishPacket() *FMLEStartPacket {
+	return newFMLEStartPacket(commandFCPublish)
+}
+
+func NewFCUnpublishPacket() *FMLEStartPacket {
+	return newFMLEStartPacket(commandFCUnpublish)
+}
+
+func NewFCSubscribePacket() *FMLEStartPacket {
+	return newFMLEStartPacket(commandFCSubscribe)
+}
+
+// The response for FMLEStartPacket, the command object is null and args is undefined.
+type FMLEStartResPacket struct {
+	variantCallPacket
+	Args amf0.Amf0
+}
+
+func NewFMLEStartResPacket(tid amf0.Number) *FMLEStartResPacket {
+	v := &FMLEStartResPacket{}
+	v.CommandName = commandResult
+	v.TransactionID = tid
+	v.CommandObject = amf0.NewNull()
+	v.Args = amf0.NewUndefined()
+	return v
+}
+
+func (v *FMLEStartResPacket) Size() int {
+	return v.variantCallPacket.Size() + v.Args.Size()
+}
+
+func (v *FMLEStartResPacket) UnmarshalBinary(data []byte) (err error) {
+	p := data
+
+	if err = v.variantCallPacket.UnmarshalBinary(p); err != nil {
+		return oe.WithMessage(err, "unmarshal call")
+	}
+	p = p[v.variantCallPacket.Size():]
+
+	// The args is optional, some servers response only the null.
+	if len(p) > 0 {
+		if v.Args, err = amf0.Discovery(p); err != nil {
+			return oe.WithMessage(err, "discovery args")
+		}
+		if err = v.Args.UnmarshalBinary(p); err != nil {
+			return oe.WithMessage(err, "unmarshal args")
+		}
+	}
+
+	return
+}
+
+func (v *FMLEStartResPacket) MarshalBinary() (data []byte, err error) {
+	if data, err = v.variantCallPacket.appendBinary(make([]byte, 0, v.Size())); err != nil {
+		return nil, oe.WithMessage(err, "marshal call")
+	}
+
+	if data, err = amf0.Append(data, v.Args); err != nil {
+		return nil, oe.WithMessage(err, "marshal args")
+	}
+
+	return
+}
+
+// The onStatus command, sent by server to notify the status of stream, for example,
+// the NetStream.Publish.Start or NetStream.Play.Start.
+type OnStatusCallPacket struct {
+	variantCallPacket
+	// The info object, which contains level, code and description.
+	Data *amf0.Object
+}
+
+func NewOnStatusCallPacket() *OnStatusCallPacket {
+	v := &OnStatusCallPacket{}
+	v.CommandName = commandOnStatus
+	v.CommandObject = amf0.NewNull()
+	v.Data = amf0.NewObject()
+	return v
+}
+
+func (v *OnStatusCallPacket) BetterCid() chunkID {
+	return chunkIDOverStream
+}
+
+// Please read @doc rtmp_specification_1.0.pdf, @page 66, @section 4.2.8. pause
+// The client sends the pause command to tell the server to pause or start playing.
+type PausePacket struct {
+	variantCallPacket
+	// Whether to pause or resume play.
+	IsPause amf0.Boolean
+	// The stream time in ms at which the stream is paused or play resumed.
+	Time amf0.Number
+}
+
+func NewPausePacket() *PausePacket {
+	v := &PausePacket{}
+	v.CommandName = commandPause
+	v.CommandObject = amf0.NewNull()
+	return v
+}
+
 // Please read @doc rtmp_specification_1.0.pdf, @page 31, @section 5.1. Set Chunk Size
 // Protocol control message 1, Set Chunk Size, is used to notify the
 // peer about the new maximum chunk size.
@@ -1510,6 +1894,46 @@ func (v *SetChunkSize) MarshalBinary() (data []byte, err error) {
 	return
 }
 
+// Please read @doc rtmp_specification_1.0.pdf, @page 32, @section 5.3. Acknowledgement (3)
+// The client or the server sends the acknowledgment to the peer after
+// receiving bytes equal to the window size.
+type Acknowledgement struct {
+	// This field holds the number of bytes received so far.
+	SequenceNumber uint32
+}
+
+func NewAcknowledgement() *Acknowledgement {
+	return &Acknowledgement{}
+}
+
+func (v *Acknowledgement) BetterCid() chunkID {
+	return chunkIDProtocolControl
+}
+
+func (v *Acknowledgement) Type() MessageType {
+	return MessageTypeAcknowledgement
+}
+
+func (v *Acknowledgement) Size() int {
+	return 4
+}
+
+func (v *Acknowledgement) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 4 {
+		return oe.Errorf("requires 4 only %v bytes, %x", len(data), data)
+	}
+	v.SequenceNumber = binary.BigEndian.Uint32(data)
+
+	return
+}
+
+func (v *Acknowledgement) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, 4)
+	binary.BigEndian.PutUint32(data, v.SequenceNumber)
+
+	return
+}
+
 // Please read @doc rtmp_specification_1.0.pdf, @page 33, @section 5.5. Window Acknowledgement Size (5)
 // The client or the server sends this message to inform the peer which
 // window size to use when sending acknowledgment.
@@ -1604,6 +2028,7 @@ func (v *SetPeerBandwidth) MarshalBinary() (data []byte, err error) {
 
 type EventType uint16
 
+// The event types are untyped, so they are also used as uint16.
 const (
 	// Generally, 4bytes event-data
 
@@ -1670,6 +2095,29 @@ const (
 	EventTypeFmsEvent0 = 0x1a
 )
 
+func (v EventType) String() string {
+	switch v {
+	case EventTypeStreamBegin:
+		return "StreamBegin"
+	case EventTypeStreamEOF:
+		return "StreamEOF"
+	case EventTypeStreamDry:
+		return "StreamDry"
+	case EventTypeSetBufferLength:
+		return "SetBufferLength"
+	case EventTypeStreamIsRecorded:
+		return "StreamIsRecorded"
+	case EventTypePingRequest:
+		return "PingRequest"
+	case EventTypePingResponse:
+		return "PingResponse"
+	case EventTypeFmsEvent0:
+		return "FmsEvent0"
+	default:
+		return fmt.Sprintf("EventType(%v)", uint16(v))
+	}
+}
+
 // Please read @doc rtmp_specification_1.0.pdf, @page 32, @5.4. User Control Message (4)
 // The client or the server sends this message to notify the peer about the user control events.
 // This message carries Event type and Event data.
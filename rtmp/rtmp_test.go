@@ -0,0 +1,1361 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package rtmp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProtocol_WriteMessage(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	payload := make([]byte, 64*1024+7)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		// Write by writev and bufio.
+		p := NewProtocol(c)
+		if err := p.SetOutputChunkSize(4096); err != nil {
+			return
+		}
+		for _, size := range []int{len(payload), 100} {
+			m := NewStreamMessage(1)
+			m.MessageType = MessageTypeVideo
+			m.Payload = payload[:size]
+			if err := p.WriteMessage(m); err != nil {
+				return
+			}
+		}
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := NewProtocol(c)
+	for _, size := range []int{len(payload), 100} {
+		var m *Message
+		for m == nil || m.MessageType == MessageTypeSetChunkSize {
+			if m, err = p.ReadMessage(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if m.MessageType != MessageTypeVideo || !bytes.Equal(m.Payload, payload[:size]) {
+			t.Errorf("invalid message %v %vB", m.MessageType, len(m.Payload))
+		}
+	}
+}
+
+func TestProtocol_SetOutputChunkSize(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	client := NewProtocol(c)
+	if err := client.SetOutputChunkSize(MinChunkSize - 1); err == nil {
+		t.Error("should fail for small chunk size")
+	}
+	if err := client.SetOutputChunkSize(MaxChunkSize + 1); err == nil {
+		t.Error("should fail for large chunk size")
+	}
+
+	go client.SetOutputChunkSize(4096)
+
+	server := NewProtocol(s)
+	server.SetMaxInputChunkSize(1024)
+	if _, err := server.ReadMessage(); err == nil {
+		t.Error("should fail for chunk size exceed maximum")
+	}
+}
+
+// Write the video messages to a TCP conn, the rw wraps the conn as the writer of protocol,
+// which hides the conn to disable the writev.
+func benchmarkWriteMessage(b *testing.B, size, chunkSize int, rw func(c net.Conn) io.ReadWriter) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(ioutil.Discard, c)
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+
+	p := NewProtocol(rw(c))
+	if err := p.SetOutputChunkSize(uint32(chunkSize)); err != nil {
+		b.Fatal(err)
+	}
+	m := NewStreamMessage(1)
+	m.MessageType = MessageTypeVideo
+	m.Payload = make([]byte, size)
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := p.WriteMessage(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func conn(c net.Conn) io.ReadWriter {
+	return c
+}
+
+func buffered(c net.Conn) io.ReadWriter {
+	return struct{ io.ReadWriter }{c}
+}
+
+func BenchmarkWriteMessage_Conn_1KB_Chunk128(b *testing.B) {
+	benchmarkWriteMessage(b, 1024, 128, conn)
+}
+
+func BenchmarkWriteMessage_Buffered_1KB_Chunk128(b *testing.B) {
+	benchmarkWriteMessage(b, 1024, 128, buffered)
+}
+
+func BenchmarkWriteMessage_Conn_64KB_Chunk128(b *testing.B) {
+	benchmarkWriteMessage(b, 65536, 128, conn)
+}
+
+func BenchmarkWriteMessage_Buffered_64KB_Chunk128(b *testing.B) {
+	benchmarkWriteMessage(b, 65536, 128, buffered)
+}
+
+func BenchmarkWriteMessage_Conn_1KB_Chunk4096(b *testing.B) {
+	benchmarkWriteMessage(b, 1024, 4096, conn)
+}
+
+func BenchmarkWriteMessage_Buffered_1KB_Chunk4096(b *testing.B) {
+	benchmarkWriteMessage(b, 1024, 4096, buffered)
+}
+
+func BenchmarkWriteMessage_Conn_64KB_Chunk4096(b *testing.B) {
+	benchmarkWriteMessage(b, 65536, 4096, conn)
+}
+
+func BenchmarkWriteMessage_Buffered_64KB_Chunk4096(b *testing.B) {
+	benchmarkWriteMessage(b, 65536, 4096, buffered)
+}
+
+func TestProtocol_SetDataPassthrough(t *testing.T) {
+	p := NewProtocol(&bytes.Buffer{})
+
+	// The unknown data command, with invalid AMF0 after the name.
+	m := NewStreamMessage(1)
+	m.MessageType = MessageTypeAMF0Data
+	m.Payload = []byte{0x02, 0x00, 0x03, 'f', 'o', 'o', 0xff, 0x01}
+
+	if _, err := p.DecodeMessage(m); err == nil {
+		t.Error("should fail for invalid data")
+	}
+
+	p.SetDataPassthrough(true)
+	pkt, err := p.DecodeMessage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, ok := pkt.(*RawDataPacket); !ok || raw.Type() != MessageTypeAMF0Data || !bytes.Equal(raw.Payload, m.Payload) {
+		t.Errorf("invalid packet %+v", pkt)
+	}
+
+	// The commands are still decoded.
+	m.MessageType = MessageTypeAMF0Command
+	if _, err := p.DecodeMessage(m); err == nil {
+		t.Error("should fail for invalid command")
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	m := NewMessage()
+	m.SetTime(1500*time.Millisecond + 300*time.Microsecond)
+	if m.Timestamp != 1500 || m.Time() != 1500*time.Millisecond {
+		t.Errorf("invalid timestamp %v, %v", m.Timestamp, m.Time())
+	}
+
+	if d := TimestampDelta(TimestampRollover-10, 20); d != 30*time.Millisecond {
+		t.Errorf("invalid rollover delta %v", d)
+	}
+	if d := TimestampDelta(100, 90); d != -10*time.Millisecond {
+		t.Errorf("invalid negative delta %v", d)
+	}
+
+	var u TimestampUnwrapper
+	var got []time.Duration
+	for _, ts := range []uint64{TimestampRollover - 20, TimestampRollover - 10, 5, 3, 25} {
+		got = append(got, u.Unwrap(ts))
+	}
+	base := time.Duration(TimestampRollover-20) * time.Millisecond
+	for i, d := range []time.Duration{0, 10, 25, 23, 45} {
+		if got[i] != base+d*time.Millisecond {
+			t.Errorf("unwrap %v got %v, want %v", i, got[i]-base, d*time.Millisecond)
+		}
+	}
+}
+
+func TestHandshake_Capture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, s := net.Pipe()
+	defer c.Close()
+
+	// The client does complex handshake with an invalid C2.
+	go func() {
+		defer c.Close()
+
+		hs := NewHandshake(rand.New(rand.NewSource(0)))
+		c0c1 := append([]byte{0x03}, hs.createComplexC1S1(complexClientVersion, genuineFPKey[:30])...)
+		if _, err := c.Write(c0c1); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(c, make([]byte, handshakeSize)); err != nil {
+			return
+		}
+		c.Write(make([]byte, 1536))
+	}()
+
+	hs := NewHandshake(rand.New(rand.NewSource(0)))
+	hs.SetCaptureDir(dir)
+	if _, _, err := ServerAccept(s, hs, nil); err == nil {
+		t.Error("should fail for no connect")
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "handshake-*.c0c1c2"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("invalid capture %v %v", files, err)
+	}
+
+	capture, err := LoadHandshakeCapture(strings.TrimSuffix(files[0], ".c0c1c2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(capture.C0C1C2) != handshakeSize || len(capture.S0S1S2) != handshakeSize {
+		t.Errorf("invalid capture %v %v", len(capture.C0C1C2), len(capture.S0S1S2))
+	}
+
+	a := capture.Analyze()
+	if a.C1Schema != 1 || a.S1Schema != 1 || !a.S2Valid || a.C2Valid {
+		t.Errorf("invalid analysis %v", a)
+	}
+	if !strings.Contains(a.String(), "C2 is not signed by Flash player") {
+		t.Errorf("invalid notes %v", a)
+	}
+}
+
+func TestHandshakeCapture_Analyze(t *testing.T) {
+	hs := NewHandshake(rand.New(rand.NewSource(0)))
+	c1, s1 := hs.createSimpleC1S1(), hs.createSimpleC1S1()
+
+	// The simple handshake, the C2 and S2 echo the peer.
+	capture := &HandshakeCapture{
+		C0C1C2: append(append([]byte{0x03}, c1...), s1...),
+		S0S1S2: append(append([]byte{0x03}, s1...), c1...),
+	}
+	if a := capture.Analyze(); a.C1Schema != -1 || a.S1Schema != -1 || !a.S2Valid || !a.C2Valid {
+		t.Errorf("invalid analysis %v", a)
+	}
+
+	// The client may change the time2 of C2, which is still valid.
+	c2 := append([]byte{}, s1...)
+	c2[4] ^= 0xff
+	if !ValidateC2(c2, s1, false) {
+		t.Error("c2 with time2 should be valid")
+	}
+	capture.C0C1C2 = append(append([]byte{0x03}, c1...), c2...)
+	if a := capture.Analyze(); !a.C2Valid {
+		t.Errorf("invalid analysis %v", a)
+	}
+
+	// The C2 changes the time, which is invalid.
+	c2[0] ^= 0xff
+	if ValidateC2(c2, s1, false) {
+		t.Error("c2 with time should be invalid")
+	}
+
+	// The client sends the C0C1 only.
+	capture = &HandshakeCapture{C0C1C2: []byte{0x06}}
+	if a := capture.Analyze(); a.S2Valid || a.C2Valid || !strings.Contains(a.String(), "C0 version 6 is not 3") {
+		t.Errorf("invalid analysis %v", a)
+	}
+}
+
+// The conn which writes slowly.
+type slowWriter struct {
+	delay    time.Duration
+	deadline time.Time
+}
+
+func (v *slowWriter) Read(p []byte) (n int, err error) {
+	return 0, io.EOF
+}
+
+func (v *slowWriter) Write(p []byte) (n int, err error) {
+	time.Sleep(v.delay)
+	return len(p), nil
+}
+
+func (v *slowWriter) SetWriteDeadline(t time.Time) error {
+	v.deadline = t
+	return nil
+}
+
+func TestProtocol_SetWritePolicy(t *testing.T) {
+	w := &slowWriter{delay: 5 * time.Millisecond}
+	p := NewProtocol(w)
+	p.SetWritePolicy(WritePolicy{
+		Timeout: time.Second, MaxStall: 20 * time.Millisecond, StallThreshold: 5 * time.Millisecond, Window: time.Minute,
+	})
+
+	m := NewStreamMessage(1)
+	m.MessageType, m.Payload = MessageTypeAudio, []byte{0xaf, 0x01}
+
+	var err error
+	var n int
+	for n = 0; n < 10 && err == nil; n++ {
+		err = p.WriteMessage(m)
+	}
+	if oe.Cause(err) != ErrSlowPeer || n < 2 || n > 4 {
+		t.Errorf("should be slow after about 4 writes, n=%v, err is %v", n, err)
+	}
+	if w.deadline.IsZero() {
+		t.Error("should set the write deadline")
+	}
+
+	// All writes fail once peer is slow.
+	w.delay = 0
+	if err := p.WriteMessage(m); oe.Cause(err) != ErrSlowPeer {
+		t.Errorf("should fail for slow peer, err is %v", err)
+	}
+
+	// The fast peer is never slow.
+	p = NewProtocol(w)
+	p.SetWritePolicy(DefaultWritePolicy)
+	for i := 0; i < 10; i++ {
+		if err := p.WriteMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProtocol_WriteTimeout(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	// The peer never reads, so the write blocks until deadline.
+	p := NewProtocol(c)
+	p.SetWritePolicy(WritePolicy{Timeout: 10 * time.Millisecond})
+
+	m := NewStreamMessage(1)
+	m.MessageType, m.Payload = MessageTypeVideo, make([]byte, 1024)
+	if err := p.WriteMessage(m); oe.Cause(err) != ErrSlowPeer {
+		t.Errorf("should timeout, err is %v", err)
+	}
+}
+
+func TestProtocol_SetComplianceMode(t *testing.T) {
+	// The fresh chunk fmt=1 over cid=2 by librtmp, then the video before window ack size.
+	b := []byte{
+		0x42, 0x00, 0x00, 0x00, 0x00, 0x00, 0x06, 0x04, 0x00, 0x06, 0x00, 0x00, 0x0d, 0x0f,
+		0x06, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x09, 0x01, 0x00, 0x00, 0x00, 0x17,
+	}
+
+	for _, mode := range []ComplianceMode{ComplianceIgnore, ComplianceReport} {
+		p := NewProtocol(bytes.NewBuffer(b))
+		p.SetComplianceMode(mode)
+		for i := 0; i < 2; i++ {
+			if _, err := p.ReadMessage(); err != nil {
+				t.Fatalf("mode %v read %v, err %+v", mode, i, err)
+			}
+		}
+
+		violations := p.Violations()
+		if mode == ComplianceIgnore && len(violations) != 0 {
+			t.Errorf("invalid violations %v", violations)
+		}
+		if mode == ComplianceReport && (len(violations) != 2 ||
+			violations[0].Rule != RuleFreshChunkFormat || violations[1].Rule != RuleWindowAckBeforeMedia) {
+			t.Errorf("invalid violations %v", violations)
+		}
+	}
+
+	p := NewProtocol(bytes.NewBuffer(b))
+	p.SetComplianceMode(ComplianceStrict)
+	if _, err := p.ReadMessage(); err == nil || !strings.Contains(err.Error(), RuleFreshChunkFormat) {
+		t.Errorf("should fail for strict, err %v", err)
+	}
+}
+
+func TestServerAccept_ComplianceStrict(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+
+	// The client does simple handshake with an invalid C2.
+	go func() {
+		defer c.Close()
+
+		hs := NewHandshake(rand.New(rand.NewSource(0)))
+		c0c1 := append([]byte{0x03}, hs.createSimpleC1S1()...)
+		if _, err := c.Write(c0c1); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(c, make([]byte, handshakeSize)); err != nil {
+			return
+		}
+		c.Write(make([]byte, 1536))
+	}()
+
+	hs := NewHandshake(rand.New(rand.NewSource(0)))
+	hs.SetComplianceMode(ComplianceStrict)
+	if _, _, err := ServerAccept(s, hs, nil); err == nil || !strings.Contains(err.Error(), RuleC2Echo) {
+		t.Errorf("should fail for invalid c2, err %v", err)
+	}
+
+	if v := hs.Violations(); len(v) != 1 || v[0].Rule != RuleC2Echo || v[0].Offset != 1537 {
+		t.Errorf("invalid violations %v", v)
+	}
+}
+
+func TestServer_CaptureCompliance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := NewServer(l)
+	s.CaptureDir, s.ComplianceMode = dir, ComplianceStrict
+
+	served := make(chan bool, 1)
+	go s.Serve(HandlerFunc(func(c *Conn) {
+		served <- true
+	}))
+
+	// The client does simple handshake with an invalid C2, which is rejected by strict mode.
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	hs := NewHandshake(rand.New(rand.NewSource(0)))
+	if _, err := c.Write(append([]byte{0x03}, hs.createSimpleC1S1()...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(c, make([]byte, handshakeSize)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write(make([]byte, 1536)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Error("should be closed for invalid c2")
+	}
+
+	// The failed handshake is saved.
+	for i := 0; i < 100; i++ {
+		if files, _ := filepath.Glob(filepath.Join(dir, "handshake-*.c0c1c2")); len(files) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if files, err := filepath.Glob(filepath.Join(dir, "handshake-*.c0c1c2")); err != nil || len(files) != 1 {
+		t.Errorf("invalid capture %v %v", files, err)
+	}
+
+	select {
+	case <-served:
+		t.Error("should not serve")
+	default:
+	}
+}
+
+// Publish the stream to server at addr, return the client and the code of onStatus.
+func testClientPublish(addr, tcUrl, stream string) (c net.Conn, code string, err error) {
+	if c, err = net.Dial("tcp", addr); err != nil {
+		return nil, "", err
+	}
+
+	if code, err = func() (code string, err error) {
+		if _, err = NewHandshake(rand.New(rand.NewSource(0))).ClientHandshake(c, true); err != nil {
+			return "", err
+		}
+
+		p := NewProtocol(c)
+		connect := NewConnectAppPacket()
+		connect.CommandObject.Set("tcUrl", amf0.NewString(tcUrl))
+		if err = p.WritePacket(connect, 0); err != nil {
+			return "", err
+		}
+
+		var connectRes *ConnectAppResPacket
+		if _, err = p.ExpectPacket(&connectRes); err != nil {
+			return "", err
+		}
+
+		if err = p.WritePacket(NewCreateStreamPacket(), 0); err != nil {
+			return "", err
+		}
+
+		var createStreamRes *CreateStreamResPacket
+		if _, err = p.ExpectPacket(&createStreamRes); err != nil {
+			return "", err
+		}
+
+		publish := NewPublishPacket()
+		publish.StreamName = amf0.String(stream)
+		if err = p.WritePacket(publish, int(createStreamRes.StreamID)); err != nil {
+			return "", err
+		}
+
+		var onStatus *OnStatusCallPacket
+		if _, err = p.ExpectPacket(&onStatus); err != nil {
+			return "", err
+		}
+
+		if v, ok := onStatus.Data.Get("code").(*amf0.String); ok {
+			code = string(*v)
+		}
+		return
+	}(); err != nil {
+		c.Close()
+		return nil, "", err
+	}
+
+	return
+}
+
+func TestServer_Admission(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := NewServer(l)
+	s.Admission = NewAdmission(&AdmissionConfig{MaxConnections: 2, MaxPublishers: 1})
+
+	// Serve the publisher or player until it's closed.
+	go s.Serve(HandlerFunc(func(c *Conn) {
+		t, err := c.Identify()
+		if err == nil && t == ClientTypePublish {
+			err = c.ExpectPublish()
+		}
+		for err == nil {
+			_, err = c.ReadMessage()
+		}
+	}))
+
+	addr := l.Addr().String()
+
+	// The first publisher holds the stream.
+	a, code, err := testClientPublish(addr, "rtmp://"+addr+"/live", "livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if code != StatusCodePublishStart {
+		t.Errorf("invalid code %v", code)
+	}
+
+	// The second publisher is rejected by max publishers, and the connection is released.
+	b, code, err := testClientPublish(addr, "rtmp://"+addr+"/live", "livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if code != StatusPublishRejected {
+		t.Errorf("invalid code %v", code)
+	}
+
+	for s.Admission.Connections() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The connection exceeds max connections is closed before handshake.
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := ClientPlay(c, NewHandshake(rand.New(rand.NewSource(0))), "rtmp://"+addr+"/live", "livestream"); err != nil {
+		t.Fatal(err)
+	}
+
+	if d, _, err := testClientPublish(addr, "rtmp://"+addr+"/live", "livestream"); err == nil {
+		d.Close()
+		t.Error("should fail for max connections")
+	}
+}
+
+func TestListenAll(t *testing.T) {
+	// The admission is shared by listeners.
+	admission := NewAdmission(&AdmissionConfig{MaxPublishers: 1})
+	servers, err := ListenAll(&ListenerConfig{Addr: "127.0.0.1:0", Admission: admission},
+		&ListenerConfig{Addr: "127.0.0.1:0", Admission: admission, Vhosts: StaticVhosts{DefaultVhost: {}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer servers.Close()
+
+	if len(servers) != 2 || servers[0].Vhosts != nil || servers[1].Vhosts == nil || servers[1].Admission != admission {
+		t.Errorf("invalid servers %v", servers)
+	}
+
+	go servers.Serve(HandlerFunc(func(c *Conn) {
+		err := c.ExpectPublish()
+		for err == nil {
+			_, err = c.ReadMessage()
+		}
+	}))
+
+	addr0, addr1 := servers[0].Addr().String(), servers[1].Addr().String()
+	a, code, err := testClientPublish(addr0, "rtmp://"+addr0+"/live", "livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != StatusCodePublishStart {
+		t.Errorf("invalid code %v", code)
+	}
+
+	b, code, err := testClientPublish(addr1, "rtmp://"+addr1+"/live", "livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if code != StatusPublishRejected {
+		t.Errorf("invalid code %v", code)
+	}
+
+	// Drain all servers, which is done when publisher closed.
+	servers.Close()
+	go a.Close()
+	if err := servers.Drain("Server is restarting.", 3*time.Second); err != nil {
+		t.Errorf("drain failed, err is %v", err)
+	}
+}
+
+// Read the onStatus until the level is error, return its code.
+func testExpectErrorStatus(p *Protocol) (code string, err error) {
+	for {
+		var onStatus *OnStatusCallPacket
+		if _, err = p.ExpectPacket(&onStatus); err != nil {
+			return "", err
+		}
+
+		if level, ok := onStatus.Data.Get("level").(*amf0.String); ok && string(*level) == StatusLevelError {
+			if code, ok := onStatus.Data.Get("code").(*amf0.String); ok {
+				return string(*code), nil
+			}
+			return "", nil
+		}
+	}
+}
+
+func TestConn_Reauthenticate(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The client is refused when identified, the player and publisher are responsed differently.
+	go NewServer(l).Serve(HandlerFunc(func(c *Conn) {
+		t, err := c.Identify()
+		if err != nil {
+			return
+		}
+
+		if t == ClientTypePlay {
+			err = c.ExpectPlay()
+		} else {
+			err = c.ExpectPublish()
+		}
+		if err == nil {
+			c.Reauthenticate(func(r *Request) error {
+				return oe.New("revoked")
+			})
+		}
+	}))
+
+	addr := l.Addr().String()
+	tcUrl := "rtmp://" + addr + "/live"
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p, err := ClientPlay(c, NewHandshake(rand.New(rand.NewSource(0))), tcUrl, "livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, err := testExpectErrorStatus(p); err != nil {
+		t.Fatal(err)
+	} else if code != StatusCodePlayFailed {
+		t.Errorf("invalid code %v", code)
+	}
+
+	// The publisher is started, then rejected.
+	c2, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	p, _, err = ClientPublish(c2, NewHandshake(rand.New(rand.NewSource(0))), tcUrl, "livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, err := testExpectErrorStatus(p); err != nil {
+		t.Fatal(err)
+	} else if code != StatusPublishRejected {
+		t.Errorf("invalid code %v", code)
+	}
+}
+
+func TestServer_Vhosts(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := NewServer(l)
+	s.Vhosts = StaticVhosts{
+		"ossrs.net": &VhostConfig{Name: "ossrs.net", ChunkSize: 60000, Auth: func(r *Request) error {
+			if r.Stream == "forbidden" {
+				return oe.New("forbidden")
+			}
+			return nil
+		}},
+		"locked.net": &VhostConfig{Name: "locked.net", Auth: func(r *Request) error {
+			return oe.New("locked")
+		}},
+	}
+
+	vhosts := make(chan string, 1)
+	go s.Serve(HandlerFunc(func(c *Conn) {
+		t, err := c.Identify()
+		if err != nil || t != ClientTypePlay {
+			c.ExpectPublish()
+			return
+		}
+
+		if err := c.ExpectPlay(); err != nil {
+			return
+		}
+		vhosts <- c.Vhost.Name
+
+		m := NewStreamMessage(c.StreamID)
+		m.MessageType, m.Payload = MessageTypeVideo, make([]byte, 1000)
+		c.WriteMessage(m)
+		c.ReadMessage()
+	}))
+
+	addr := l.Addr().String()
+	tcUrl := "rtmp://" + addr + "/live?vhost=ossrs.net"
+
+	// The chunk size of vhost is used to write messages to player.
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p, err := ClientPlay(c, NewHandshake(rand.New(rand.NewSource(0))), tcUrl, "livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vhost := <-vhosts; vhost != "ossrs.net" {
+		t.Errorf("invalid vhost %v", vhost)
+	}
+
+	for {
+		m, err := p.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.MessageType == MessageTypeVideo {
+			break
+		}
+	}
+	if p.input.opt.chunkSize != 60000 {
+		t.Errorf("invalid chunk size %v", p.input.opt.chunkSize)
+	}
+
+	// The publisher is rejected by the auth of vhost.
+	if c, code, err := testClientPublish(addr, tcUrl, "forbidden"); err != nil {
+		t.Error(err)
+	} else if c.Close(); code != StatusPublishRejected {
+		t.Errorf("invalid code %v", code)
+	}
+
+	// The client is rejected when vhost not found.
+	if c, _, err := testClientPublish(addr, "rtmp://"+addr+"/live?vhost=other", "livestream"); err == nil {
+		c.Close()
+		t.Error("should fail for no vhost")
+	}
+
+	// The vhost of stream overwrites the vhost of connect.
+	if c, code, err := testClientPublish(addr, tcUrl, "livestream?vhost=locked.net"); err != nil {
+		t.Error(err)
+	} else if c.Close(); code != StatusPublishRejected {
+		t.Errorf("invalid code %v", code)
+	}
+	if c, code, err := testClientPublish(addr, tcUrl, "livestream?vhost=other"); err != nil {
+		t.Error(err)
+	} else if c.Close(); code != StatusPublishRejected {
+		t.Errorf("invalid code %v", code)
+	}
+}
+
+// The source of messages in channel, EOF when closed.
+type chanSource chan *Message
+
+func (v chanSource) ReadMessage() (*Message, error) {
+	if m, ok := <-v; ok {
+		return m, nil
+	}
+	return nil, io.EOF
+}
+
+func testMessage(t MessageType, timestamp uint64, payload ...byte) *Message {
+	m := NewStreamMessage(1)
+	m.MessageType, m.Timestamp, m.Payload = t, timestamp, payload
+	return m
+}
+
+// Read n messages from switcher, return the first byte of payloads and timestamps.
+func testSwitcherRead(s *Switcher, n int) (got []uint64, err error) {
+	for i := 0; i < n; i++ {
+		var m *Message
+		if m, err = s.ReadMessage(); err != nil {
+			return
+		}
+		got = append(got, uint64(m.Payload[0]), m.Timestamp)
+	}
+	return
+}
+
+func TestSwitcher(t *testing.T) {
+	primary, backup := make(chanSource, 8), make(chanSource, 8)
+	s := NewSwitcher(primary, backup)
+	s.Timeout = time.Millisecond
+	defer s.Close()
+
+	var switches []int
+	s.OnSwitch = func(from, to int) {
+		switches = append(switches, from, to)
+	}
+
+	primary <- testMessage(MessageTypeVideo, 1000, 0x17, 0x00)
+	primary <- testMessage(MessageTypeVideo, 1000, 0x17, 0x01)
+	primary <- testMessage(MessageTypeVideo, 1040, 0x27, 0x01)
+	if got, err := testSwitcherRead(s, 3); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(got) != "[23 1000 23 1000 39 1040]" {
+		t.Errorf("invalid primary %v", got)
+	}
+
+	// Switch to backup at keyframe when primary timeout, with sequence header and timestamp rebased.
+	time.Sleep(10 * time.Millisecond)
+	backup <- testMessage(MessageTypeVideo, 4960, 0x27, 0x01)
+	backup <- testMessage(MessageTypeVideo, 5000, 0x17, 0x00)
+	backup <- testMessage(MessageTypeVideo, 5000, 0x17, 0x01)
+
+	got, err := testSwitcherRead(s, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[23 1040 23 1040]" {
+		t.Errorf("invalid backup %v", got)
+	}
+	if s.Active() != SwitcherBackup || fmt.Sprint(switches) != "[0 1]" {
+		t.Errorf("invalid active %v, switches %v", s.Active(), switches)
+	}
+
+	// The switcher fails when both sources failed.
+	close(primary)
+	close(backup)
+	if _, err := s.ReadMessage(); err == nil {
+		t.Error("should fail for both failed")
+	}
+}
+
+func TestSwitcher_AudioOnly(t *testing.T) {
+	primary, backup := make(chanSource, 8), make(chanSource, 8)
+	s := NewSwitcher(primary, backup)
+	s.Timeout = time.Millisecond
+	defer s.Close()
+
+	primary <- testMessage(MessageTypeAudio, 100, 0xaf, 0x00)
+	primary <- testMessage(MessageTypeAudio, 100, 0xaf, 0x01)
+	if _, err := testSwitcherRead(s, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Switch at audio frame when primary timeout, because backup has no video.
+	time.Sleep(10 * time.Millisecond)
+	backup <- testMessage(MessageTypeAudio, 900, 0xaf, 0x00)
+	backup <- testMessage(MessageTypeAudio, 900, 0xaf, 0x01)
+
+	got, err := testSwitcherRead(s, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[1] != 100 || got[3] != 100 || s.Active() != SwitcherBackup {
+		t.Errorf("invalid backup %v, active %v", got, s.Active())
+	}
+}
+
+func TestSwitcher_Close(t *testing.T) {
+	primary, backup := make(chanSource), make(chanSource)
+	s := NewSwitcher(primary, backup)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.ReadMessage()
+		done <- err
+	}()
+
+	// The reading goroutines quit when switcher closed and sources closed.
+	s.Close()
+	if err := <-done; err == nil {
+		t.Error("should fail for closed")
+	}
+
+	close(primary)
+	close(backup)
+}
+
+func TestProtocol_TransactionPolicy(t *testing.T) {
+	// The policy is opt-in, no timer and no limit by default.
+	p := NewProtocol(&bytes.Buffer{})
+	n := DefaultTransactionPolicy.Max + 1
+	for i := 0; i < n; i++ {
+		pkt := NewRPCPacket("test")
+		pkt.TransactionID = amf0.Number(i + 1)
+		if err := p.WritePacket(pkt, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v := p.Transactions(); v != n {
+		t.Errorf("invalid transactions %v", v)
+	}
+
+	p.SetTransactionPolicy(DefaultTransactionPolicy)
+	pkt := NewRPCPacket("test")
+	pkt.TransactionID = amf0.Number(n + 1)
+	if err := p.WritePacket(pkt, 0); err == nil {
+		t.Error("should fail for overflow")
+	}
+}
+
+func TestEventType(t *testing.T) {
+	// The event types are untyped constants, for the callers of uint16.
+	var v uint16 = EventTypePingRequest
+	if s := EventType(v).String(); s != "PingRequest" {
+		t.Errorf("invalid event %v", s)
+	}
+	if s := EventType(0xff).String(); s != "EventType(255)" {
+		t.Errorf("invalid event %v", s)
+	}
+}
+
+func TestPolicy_JSON(t *testing.T) {
+	// The config with units, the absent fields are the defaults.
+	var conf struct {
+		Timeouts    AcceptTimeouts    `json:"timeouts"`
+		Write       WritePolicy       `json:"write"`
+		Transaction TransactionPolicy `json:"transaction"`
+	}
+	conf.Timeouts, conf.Write, conf.Transaction = DefaultAcceptTimeouts, DefaultWritePolicy, DefaultTransactionPolicy
+
+	b := `{"timeouts":{"c0c1":"3s","connect":20},"write":{"max_stall":"5s","window":"1m"},"transaction":{"timeout":"500ms"}}`
+	if err := json.Unmarshal([]byte(b), &conf); err != nil {
+		t.Fatal(err)
+	}
+	if v := conf.Timeouts; v.C0C1 != 3*time.Second || v.C2 != 5*time.Second || v.Connect != 20*time.Second {
+		t.Errorf("invalid timeouts %+v", v)
+	}
+	if v := conf.Write; v.Timeout != 10*time.Second || v.MaxStall != 5*time.Second || v.StallThreshold != 100*time.Millisecond || v.Window != time.Minute {
+		t.Errorf("invalid write policy %+v", v)
+	}
+	if v := conf.Transaction; v.Timeout != 500*time.Millisecond || v.Max != 128 {
+		t.Errorf("invalid transaction policy %+v", v)
+	}
+
+	if b, err := json.Marshal(&conf); err != nil || string(b) != `{"timeouts":{"c0c1":"3s","c2":"5s","connect":"20s"},"write":{"timeout":"10s","max_stall":"5s","stall_threshold":"100ms","window":"1m0s"},"transaction":{"timeout":"500ms","max":128}}` {
+		t.Errorf("marshal %s, err is %v", b, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"timeouts":{"c2":"5"}}`), &conf); err == nil {
+		t.Error("should fail for no unit")
+	}
+}
+
+func TestProtocol_TransactionIdleTimeout(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	// The server never responses.
+	go io.Copy(ioutil.Discard, s)
+
+	errs := make(chan *TransactionError, 1)
+	p := NewProtocol(c)
+	p.SetTransactionPolicy(TransactionPolicy{Timeout: 10 * time.Millisecond, OnError: func(err *TransactionError) {
+		errs <- err
+		c.Close()
+	}})
+
+	if err := p.WritePacket(NewConnectAppPacket(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The transaction expires on idle connection, and the hook unblocks the reading.
+	var res *ConnectAppResPacket
+	if _, err := p.ExpectPacket(&res); err == nil {
+		t.Error("should fail for timeout")
+	}
+
+	if err := <-errs; err.Reason != TransactionReasonTimeout || err.CommandName != commandConnect {
+		t.Errorf("invalid err %v", err)
+	}
+	if n := p.Transactions(); n != 0 {
+		t.Errorf("invalid transactions %v", n)
+	}
+}
+
+func TestProtocol_Call(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	client, server := NewProtocol(c), NewProtocol(s)
+
+	go func() {
+		var req *CallPacket
+		if _, err := server.ExpectPacket(&req); err != nil {
+			return
+		}
+
+		// The messages before the response of call are dropped.
+		video := NewMessage()
+		video.MessageType, video.Payload, video.betterCid = MessageTypeVideo, []byte{0x17, 0x01}, chunkIDVideo
+		if err := server.WriteMessage(video); err != nil {
+			return
+		}
+
+		status := NewOnStatusCallPacket()
+		status.Data.Set("code", amf0.NewString(StatusCodePublishStart))
+		if err := server.WritePacket(status, 1); err != nil {
+			return
+		}
+
+		other := NewRPCPacket(string(commandResult))
+		other.TransactionID = req.TransactionID + 1
+		if err := server.WritePacket(other, 0); err != nil {
+			return
+		}
+
+		res := NewRPCPacket(string(commandResult), req.Args)
+		res.TransactionID = req.TransactionID
+		_ = server.WritePacket(res, 0)
+	}()
+
+	res, err := client.Call("echo", amf0.NewString("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Args) != 1 || *res.Args[0].(*amf0.String) != "hello" {
+		t.Errorf("invalid args %v", res.Args)
+	}
+	if n := client.Transactions(); n != 0 {
+		t.Errorf("invalid transactions %v", n)
+	}
+}
+
+func TestProtocol_CallTimeout(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	// The server never responses.
+	go io.Copy(ioutil.Discard, s)
+
+	p := NewProtocol(c)
+	p.SetTransactionPolicy(TransactionPolicy{Timeout: 10 * time.Millisecond, OnError: func(err *TransactionError) {
+		c.Close()
+	}})
+
+	_, err := p.Call("echo")
+	if terr, ok := oe.Cause(err).(*TransactionError); !ok || terr.Reason != TransactionReasonTimeout {
+		t.Errorf("invalid err %v", err)
+	}
+}
+
+func TestPlayerSession_Trim(t *testing.T) {
+	v, err := NewPlayerSession("rtmp://127.0.0.1/live/livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Buffer = 100 * time.Millisecond
+
+	frame := func(timestamp uint64, payload ...byte) *Message {
+		m := NewStreamMessage(1)
+		m.MessageType, m.Timestamp, m.Payload = MessageTypeVideo, timestamp, payload
+		return m
+	}
+
+	// The GOP is 160ms, larger than the buffer.
+	v.push(frame(0, 0x17, 0x00))
+	for ts := uint64(0); ts <= 280; ts += 40 {
+		if ts%160 == 0 {
+			v.push(frame(ts, 0x17, 0x01))
+		} else {
+			v.push(frame(ts, 0x27, 0x01))
+		}
+	}
+
+	// Wait for the next keyframe, never drop the GOP partially.
+	if len(v.msgs) != 5 || !isVideoSequenceHeader(v.msgs[0]) || !isVideoKeyframe(v.msgs[1]) || v.msgs[1].Timestamp != 160 {
+		t.Errorf("invalid msgs %v", len(v.msgs))
+	}
+
+	// Drop to the next keyframe, keep the sequence header.
+	v.push(frame(320, 0x17, 0x01))
+	if len(v.msgs) != 2 || !isVideoSequenceHeader(v.msgs[0]) || v.msgs[1].Timestamp != 320 {
+		t.Errorf("invalid msgs %v", len(v.msgs))
+	}
+	if v.Dropped() != 8 {
+		t.Errorf("invalid dropped %v", v.Dropped())
+	}
+
+	// The audio only stream is dropped by timestamp.
+	if v, err = NewPlayerSession("rtmp://127.0.0.1/live/livestream"); err != nil {
+		t.Fatal(err)
+	}
+	v.Buffer = 100 * time.Millisecond
+
+	for ts := uint64(0); ts <= 200; ts += 20 {
+		m := NewStreamMessage(1)
+		m.MessageType, m.Timestamp, m.Payload = MessageTypeAudio, ts, []byte{0xaf, 0x01}
+		v.push(m)
+	}
+	if m := v.msgs[0]; m.Timestamp != 100 || v.Dropped() != 5 {
+		t.Errorf("invalid first %v, dropped %v", m.Timestamp, v.Dropped())
+	}
+}
+
+// Accept the client over s, response the connect and createStream, return the protocol.
+func testServerCreateStream(s net.Conn) (p *Protocol, err error) {
+	if p, _, err = ServerAccept(s, NewHandshake(rand.New(rand.NewSource(0))), nil); err != nil {
+		return
+	}
+	if err = p.WritePacket(NewConnectAppResPacket(1), 0); err != nil {
+		return
+	}
+
+	var createStream *CreateStreamPacket
+	if _, err = p.ExpectPacket(&createStream); err != nil {
+		return
+	}
+
+	res := NewCreateStreamResPacket(createStream.TransactionID)
+	res.StreamID = 1
+	err = p.WritePacket(res, 0)
+	return
+}
+
+func TestPlayerSession_StatusError(t *testing.T) {
+	v, err := NewPlayerSession("rtmp://127.0.0.1/live/livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	errs := make(chan error, 1)
+	v.RetryInterval = time.Hour
+	v.OnReconnect = func(err error) {
+		errs <- err
+	}
+	v.Dial = func(addr string) (net.Conn, error) {
+		c, s := net.Pipe()
+		go func() {
+			defer s.Close()
+
+			p, err := testServerCreateStream(s)
+			if err != nil {
+				return
+			}
+
+			var play *PlayPacket
+			if _, err = p.ExpectPacket(&play); err != nil {
+				return
+			}
+
+			status := NewOnStatusCallPacket()
+			status.Data.Set("level", amf0.NewString(StatusLevelError))
+			status.Data.Set("code", amf0.NewString(StatusCodeStreamNotFound))
+			if err = p.WritePacket(status, 1); err != nil {
+				return
+			}
+			io.Copy(ioutil.Discard, s)
+		}()
+		return c, nil
+	}
+
+	go v.ReadMessage()
+
+	err = <-errs
+	if serr, ok := oe.Cause(err).(*StatusError); !ok || serr.Code != StatusCodeStreamNotFound {
+		t.Errorf("invalid err %v", err)
+	}
+}
+
+func TestPublisherSession(t *testing.T) {
+	v, err := NewPublisherSession("rtmp://127.0.0.1/live/livestream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	// Each server receives three media messages, then disconnect.
+	payloads := make(chan []byte, 16)
+	v.RetryInterval = time.Millisecond
+	v.OnReconnect = func(err error) {
+	}
+	v.Dial = func(addr string) (net.Conn, error) {
+		c, s := net.Pipe()
+		go func() {
+			defer s.Close()
+
+			p, err := testServerCreateStream(s)
+			if err != nil {
+				return
+			}
+
+			var publish *PublishPacket
+			if _, err = p.ExpectPacket(&publish); err != nil {
+				return
+			}
+
+			status := NewOnStatusCallPacket()
+			status.Data.Set("level", amf0.NewString(StatusLevelStatus))
+			status.Data.Set("code", amf0.NewString(StatusCodePublishStart))
+			if err = p.WritePacket(status, 1); err != nil {
+				return
+			}
+
+			for n := 0; n < 3; {
+				m, err := p.ReadMessage()
+				if err != nil {
+					return
+				}
+				if m.MessageType == MessageTypeAudio || m.MessageType == MessageTypeVideo {
+					payloads <- m.Payload
+					n++
+				}
+			}
+		}()
+		return c, nil
+	}
+
+	write := func(mt MessageType, timestamp uint64, payload ...byte) {
+		m := NewStreamMessage(1)
+		m.MessageType, m.Timestamp, m.Payload = mt, timestamp, payload
+		if err := v.WriteMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(MessageTypeAudio, 0, 0xaf, 0x00)
+	write(MessageTypeVideo, 0, 0x17, 0x00)
+	write(MessageTypeVideo, 0, 0x17, 0x01)
+	// The server disconnected, the frame is dropped.
+	write(MessageTypeVideo, 40, 0x27, 0x01)
+	time.Sleep(10 * time.Millisecond)
+	// Reconnect and resend the sequence headers, drop to the keyframe.
+	write(MessageTypeVideo, 80, 0x27, 0x01)
+	write(MessageTypeVideo, 120, 0x17, 0x01)
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, fmt.Sprintf("%x", <-payloads))
+	}
+	if s := strings.Join(got, ","); s != "af00,1700,1701,af00,1700,1701" {
+		t.Errorf("invalid payloads %v", s)
+	}
+	if v.Dropped() != 2 {
+		t.Errorf("invalid dropped %v", v.Dropped())
+	}
+}
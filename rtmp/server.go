@@ -0,0 +1,980 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The high level RTMP server, to accept the publishers and players.
+package rtmp
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	ol "github.com/ossrs/go-oryx-lib/logger"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// The type of client, identified by the publish or play command.
+type ClientType uint8
+
+const (
+	ClientTypeUnknown ClientType = iota
+	ClientTypePublish
+	ClientTypePlay
+)
+
+func (v ClientType) String() string {
+	switch v {
+	case ClientTypePublish:
+		return "publish"
+	case ClientTypePlay:
+		return "play"
+	default:
+		return "unknown"
+	}
+}
+
+// The level and code of onStatus, see StatusConnectRejected and StatusPublishRejected for rejection.
+const (
+	StatusLevelStatus = "status"
+	StatusLevelError  = "error"
+
+	StatusCodeConnectSuccess   = "NetConnection.Connect.Success"
+	StatusCodePublishStart     = "NetStream.Publish.Start"
+	StatusCodeUnpublishSuccess = "NetStream.Unpublish.Success"
+	StatusCodePlayReset        = "NetStream.Play.Reset"
+	StatusCodePlayStart        = "NetStream.Play.Start"
+	StatusCodePlayStop         = "NetStream.Play.Stop"
+	StatusCodePlayTransition   = "NetStream.Play.Transition"
+	StatusCodeStreamNotFound   = "NetStream.Play.StreamNotFound"
+	StatusCodePlayFailed       = "NetStream.Play.Failed"
+)
+
+// The command for publisher to rotate the stream key, the arg is the stream with the new
+// key, for example, livestream?token=xxx. The response is _result if accepted.
+const CommandRotateStreamKey = "rotateStreamKey"
+
+// The stream id created for client, there is only one stream for each connection.
+const serverStreamID = 1
+
+// The window acknowledgement size and peer bandwidth for client.
+const serverAckSize = 2500000
+
+// The Handler serves the RTMP connection, which is closed when ServeRTMP returns.
+type Handler interface {
+	ServeRTMP(c *Conn)
+}
+
+// The HandlerFunc is an adapter to use the function as Handler.
+type HandlerFunc func(c *Conn)
+
+func (v HandlerFunc) ServeRTMP(c *Conn) {
+	v(c)
+}
+
+// The Server accepts the RTMP clients, does the handshake and responses the connect. For example:
+//		s := NewServer(l)
+//		for {
+//			c, err := s.Accept()
+//			...
+//			go func() {
+//				defer c.Close()
+//				if err := c.ExpectPublish(); err != nil { ... }
+//				for { m, err := c.ReadMessage() ... }
+//			}()
+//		}
+// Or use ListenAndServe with a handler.
+type Server struct {
+	// The timeouts of handshake and connect, use DefaultAcceptTimeouts if nil.
+	Timeouts *AcceptTimeouts
+	// The hook to verify the connect request, optional. The client is rejected if error.
+	OnConnect func(r *Request) error
+	// The hook to verify the publisher when stream key rotated, with the new key in param
+	// of r. The publisher is disconnected if error. The rotation is not supported if nil.
+	OnRotate func(r *Request) error
+	// The admission to limit the connections and publishers, optional. The connection is
+	// closed before handshake if rejected, and the publisher is responsed with error status.
+	Admission *Admission
+	// The configs of vhosts, optional. The vhost is resolved from tcUrl of connect, and again
+	// from the stream when identified, the client is rejected if vhost not found, see Conn.Vhost.
+	Vhosts Vhosts
+	// The dir to save the failed handshake for diagnosis, optional, see Handshake.SetCaptureDir.
+	CaptureDir string
+	// The mode to check the compliance of client, see Handshake.SetComplianceMode.
+	ComplianceMode ComplianceMode
+
+	l net.Listener
+	// The connections not closed, and the state of drain.
+	lock     sync.Mutex
+	conns    map[*Conn]bool
+	draining bool
+	drained  chan struct{}
+}
+
+func NewServer(l net.Listener) *Server {
+	return &Server{l: l, conns: make(map[*Conn]bool)}
+}
+
+// Listen at addr and serve the clients by h, for example, ListenAndServe(":1935", h).
+func ListenAndServe(addr string, h Handler) error {
+	return ListenAndServeAll(h, &ListenerConfig{Addr: addr})
+}
+
+// The config of each listener, the fields are set to the Server of listener.
+type ListenerConfig struct {
+	// The network, tcp or unix, default to tcp.
+	Network string
+	// The address, for example, :1935 for tcp, or /var/run/rtmp.sock for unix.
+	Addr string
+	// The timeouts of handshake and connect, use DefaultAcceptTimeouts if nil.
+	Timeouts *AcceptTimeouts
+	// The hook to verify the connect request, optional.
+	OnConnect func(r *Request) error
+	// The hook to verify the publisher when stream key rotated, optional.
+	OnRotate func(r *Request) error
+	// The admission to limit the connections and publishers, optional. Share it between
+	// listeners to limit the total of server.
+	Admission *Admission
+	// The configs of vhosts, optional.
+	Vhosts Vhosts
+	// The dir to save the failed handshake, optional.
+	CaptureDir string
+	// The mode to check the compliance of client.
+	ComplianceMode ComplianceMode
+}
+
+// Listen at all addresses and serve the clients by the shared h, for example, the
+// public port for clients and the unix socket for local relays behind a proxy:
+//		ListenAndServeAll(h, &ListenerConfig{Addr: ":1935"},
+//			&ListenerConfig{Network: "unix", Addr: "/var/run/rtmp.sock", Timeouts: &AcceptTimeouts{}})
+// Use c.NetConn().LocalAddr() to identify the listener of client.
+// @remark Use ListenAll to drain the servers.
+// @remark Returns when any listener fails, and all listeners are closed.
+func ListenAndServeAll(h Handler, configs ...*ListenerConfig) (err error) {
+	var servers Servers
+	if servers, err = ListenAll(configs...); err != nil {
+		return
+	}
+	defer servers.Close()
+
+	return servers.Serve(h)
+}
+
+// The servers of listeners, to serve and drain them together.
+type Servers []*Server
+
+// Listen at all addresses, user should serve and close the servers. For example, drain the
+// servers for graceful restart:
+//		servers, err := ListenAll(&ListenerConfig{Addr: ":1935"})
+//		go servers.Serve(h)
+//		servers.Close() // Stop accepting, the new process listens at the same port.
+//		servers.Drain("Server is restarting.", 30*time.Second)
+// @remark The stale unix socket file is removed before listen.
+// @remark The listeners are closed when any fails.
+func ListenAll(configs ...*ListenerConfig) (servers Servers, err error) {
+	if len(configs) == 0 {
+		return nil, oe.New("no listener")
+	}
+
+	defer func() {
+		if err != nil {
+			servers.Close()
+		}
+	}()
+
+	for _, conf := range configs {
+		network := conf.Network
+		if network == "" {
+			network = "tcp"
+		}
+
+		if network == "unix" {
+			removeStaleSocket(conf.Addr)
+		}
+
+		var l net.Listener
+		if l, err = net.Listen(network, conf.Addr); err != nil {
+			return servers, oe.Wrapf(err, "listen %v %v", network, conf.Addr)
+		}
+
+		s := NewServer(l)
+		s.Timeouts, s.OnConnect, s.OnRotate = conf.Timeouts, conf.OnConnect, conf.OnRotate
+		s.Admission, s.Vhosts = conf.Admission, conf.Vhosts
+		s.CaptureDir, s.ComplianceMode = conf.CaptureDir, conf.ComplianceMode
+		servers = append(servers, s)
+	}
+
+	return
+}
+
+// Serve the clients of all servers by h, returns when any server fails.
+func (v Servers) Serve(h Handler) error {
+	errs := make(chan error, len(v))
+	for _, s := range v {
+		go func(s *Server) {
+			errs <- oe.WithMessage(s.Serve(h), s.Addr().String())
+		}(s)
+	}
+
+	return <-errs
+}
+
+// Close all listeners, the accepted connections are not closed.
+func (v Servers) Close() (err error) {
+	for _, s := range v {
+		if r := s.Close(); r != nil && err == nil {
+			err = r
+		}
+	}
+	return
+}
+
+// Drain all servers concurrently, see Server.Drain.
+// @return The first error of servers.
+func (v Servers) Drain(reason string, timeout time.Duration) (err error) {
+	errs := make(chan error, len(v))
+	for _, s := range v {
+		go func(s *Server) {
+			errs <- s.Drain(reason, timeout)
+		}(s)
+	}
+
+	for range v {
+		if r := <-errs; r != nil && err == nil {
+			err = r
+		}
+	}
+	return
+}
+
+// Remove the unix socket file left by previous process, which is not listened by others.
+func removeStaleSocket(addr string) {
+	if fi, err := os.Stat(addr); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	if c, err := net.Dial("unix", addr); err == nil {
+		c.Close()
+		return
+	}
+
+	os.Remove(addr)
+}
+
+// The address of listener.
+func (v *Server) Addr() net.Addr {
+	return v.l.Addr()
+}
+
+// Close the listener, the accepted connections are not closed.
+func (v *Server) Close() error {
+	return v.l.Close()
+}
+
+// Whether the server is draining, the handler should not start new streams.
+func (v *Server) Draining() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.draining
+}
+
+// Drain the server for graceful restart, the new publishers are rejected, the players are
+// notified by StatusCodePlayStop with reason, then wait for all connections to close. The
+// connections not closed in timeout are closed, and returns error. For example:
+//		s.Close() // Stop accepting, the new process listens at the same port.
+//		s.Drain("Server is restarting.", 30*time.Second)
+// @remark The listener is not closed, user should close it if required.
+func (v *Server) Drain(reason string, timeout time.Duration) (err error) {
+	v.lock.Lock()
+	v.draining = true
+	if v.drained == nil {
+		v.drained = make(chan struct{})
+	}
+	drained := v.drained
+
+	var players []*Conn
+	for c := range v.conns {
+		if c.clientType == ClientTypePlay {
+			players = append(players, c)
+		}
+	}
+	v.checkDrained()
+	v.lock.Unlock()
+
+	for _, c := range players {
+		if err := c.WriteStatus(StatusLevelStatus, StatusCodePlayStop, reason); err != nil {
+			ol.Wf(nil, "rtmp ignore notify player %v, err is %v", c.conn.RemoteAddr(), err)
+		}
+	}
+
+	select {
+	case <-drained:
+		return
+	case <-time.After(timeout):
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if len(v.conns) == 0 {
+		return
+	}
+
+	err = oe.Errorf("drain timeout %v, close %v connections", timeout, len(v.conns))
+	for c := range v.conns {
+		c.conn.Close()
+	}
+	return
+}
+
+// Notify the drain is done, the caller should hold the lock.
+func (v *Server) checkDrained() {
+	if v.draining && len(v.conns) == 0 && v.drained != nil {
+		close(v.drained)
+		v.drained = nil
+	}
+}
+
+// Track the connection, which is untracked when closed.
+func (v *Server) track(c *Conn) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.conns[c] = true
+}
+
+func (v *Server) untrack(c *Conn) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if !v.conns[c] {
+		return
+	}
+	delete(v.conns, c)
+
+	v.checkDrained()
+}
+
+// Accept a client, which handshake and connect is done.
+// @remark The client fails at handshake or connect is closed and ignored.
+// @remark The handshake is done one by one in Accept, use Serve to do it concurrently.
+func (v *Server) Accept() (c *Conn, err error) {
+	for {
+		var nc net.Conn
+		if nc, err = v.l.Accept(); err != nil {
+			return nil, oe.Wrap(err, "accept")
+		}
+
+		release, ok := v.admit(nc)
+		if !ok {
+			continue
+		}
+
+		if c, err = v.handshake(nc, release); err != nil {
+			ol.Wf(nil, "rtmp ignore client %v, err is %v", nc.RemoteAddr(), err)
+			continue
+		}
+
+		return
+	}
+}
+
+// Accept clients and serve each by h in goroutine, returns when listener is closed.
+func (v *Server) Serve(h Handler) error {
+	for {
+		nc, err := v.l.Accept()
+		if err != nil {
+			return oe.Wrap(err, "accept")
+		}
+
+		release, ok := v.admit(nc)
+		if !ok {
+			continue
+		}
+
+		go func(nc net.Conn) {
+			c, err := v.handshake(nc, release)
+			if err != nil {
+				ol.Wf(nil, "rtmp ignore client %v, err is %v", nc.RemoteAddr(), err)
+				return
+			}
+			defer c.Close()
+
+			h.ServeRTMP(c)
+		}(nc)
+	}
+}
+
+// Admit the connection nc by admission, close it if rejected.
+// @return The release of connection, nil if no admission.
+func (v *Server) admit(nc net.Conn) (release func(), ok bool) {
+	if v.Admission == nil {
+		return nil, true
+	}
+
+	release, err := v.Admission.AdmitConnection(nc.RemoteAddr())
+	if err != nil {
+		ol.Wf(nil, "rtmp reject client %v, err is %v", nc.RemoteAddr(), err)
+		nc.Close()
+		return nil, false
+	}
+
+	return release, true
+}
+
+// Do handshake, read and response the connect, the release of admission is called when
+// connection closed.
+// @remark The nc is closed and the release is called when error.
+func (v *Server) handshake(nc net.Conn, release func()) (c *Conn, err error) {
+	defer func() {
+		if err != nil && release != nil {
+			release()
+		}
+	}()
+
+	hs := NewHandshake(rand.New(rand.NewSource(time.Now().UnixNano())))
+	hs.SetCaptureDir(v.CaptureDir)
+	hs.SetComplianceMode(v.ComplianceMode)
+
+	p, connect, err := ServerAccept(nc, hs, v.Timeouts)
+	if err != nil {
+		return nil, oe.WithMessage(err, "server accept")
+	}
+
+	c = &Conn{Protocol: p, conn: nc, server: v}
+	if err = c.responseConnect(connect, v.verifyConnect(c)); err != nil {
+		nc.Close()
+		return nil, oe.WithMessage(err, "response connect")
+	}
+
+	if c.Vhost != nil && c.Vhost.ChunkSize > 0 {
+		if err = c.SetOutputChunkSize(uint32(c.Vhost.ChunkSize)); err != nil {
+			nc.Close()
+			return nil, oe.WithMessage(err, "set chunk size")
+		}
+	}
+	c.releases = append(c.releases, release)
+
+	v.track(c)
+	return
+}
+
+// Resolve the vhost of c and verify the connect by the auth of vhost and OnConnect.
+func (v *Server) verifyConnect(c *Conn) func(r *Request) error {
+	return func(r *Request) error {
+		if v.Vhosts != nil {
+			if c.Vhost = v.Vhosts.Lookup(r.Vhost); c.Vhost == nil {
+				return oe.Errorf("vhost %v not found", r.Vhost)
+			}
+			if c.Vhost.Auth != nil {
+				if err := c.Vhost.Auth(r); err != nil {
+					return err
+				}
+			}
+		}
+
+		if v.OnConnect != nil {
+			return v.OnConnect(r)
+		}
+		return nil
+	}
+}
+
+// The Conn is a RTMP connection of server side, which is connected.
+// @remark Use ExpectPublish or ExpectPlay to identify the client, then read or write messages.
+type Conn struct {
+	*Protocol
+	// The request parsed from connect, the stream is set after identified.
+	Request *Request
+	// The type of client, set after identified.
+	Type ClientType
+	// The stream id of client, to write messages to player.
+	StreamID int
+	// The config of vhost, nil if no Vhosts of server. It's resolved from tcUrl of connect, and
+	// updated by the vhost of stream when identified.
+	Vhost *VhostConfig
+
+	conn   net.Conn
+	server *Server
+	// To update the request when stream key rotated, while reauthenticate in other goroutine.
+	rlock sync.Mutex
+	// The copy of Type, protected by the lock of server, to notify the players when drain.
+	clientType ClientType
+	// The release of admission for connection and publisher, called when closed.
+	releases []func()
+}
+
+// The underlayer connection.
+func (v *Conn) NetConn() net.Conn {
+	return v.conn
+}
+
+// Close the connection.
+func (v *Conn) Close() error {
+	if v.server != nil {
+		v.server.untrack(v)
+	}
+
+	v.rlock.Lock()
+	releases := v.releases
+	v.releases = nil
+	v.rlock.Unlock()
+
+	for _, release := range releases {
+		if release != nil {
+			release()
+		}
+	}
+
+	return v.conn.Close()
+}
+
+// Set the type of client when identified.
+func (v *Conn) setType(t ClientType) {
+	v.Type = t
+
+	if v.server != nil {
+		v.server.lock.Lock()
+		defer v.server.lock.Unlock()
+		v.clientType = t
+	}
+}
+
+// Get the type of client, which is safe in other goroutines if there is server.
+func (v *Conn) safeType() ClientType {
+	if v.server == nil {
+		return v.Type
+	}
+
+	v.server.lock.Lock()
+	defer v.server.lock.Unlock()
+	return v.clientType
+}
+
+// Identify the client, response the createStream and FMLE commands, until got publish or play.
+// @remark It's ok to call it multiple times, the type is identified once.
+func (v *Conn) Identify() (t ClientType, err error) {
+	for v.Type == ClientTypeUnknown {
+		var m *Message
+		if m, err = v.ReadMessage(); err != nil {
+			return ClientTypeUnknown, oe.WithMessage(err, "read message")
+		}
+
+		switch m.MessageType {
+		case MessageTypeAMF0Command, MessageTypeAMF3Command:
+		default:
+			continue
+		}
+
+		var pkt Packet
+		if pkt, err = v.DecodeMessage(m); err != nil {
+			return ClientTypeUnknown, oe.WithMessage(err, "decode message")
+		}
+
+		switch pkt := pkt.(type) {
+		case *PublishPacket:
+			v.Request.SetStream(string(pkt.StreamName))
+			v.setType(ClientTypePublish)
+		case *PlayPacket:
+			v.Request.SetStream(string(pkt.StreamName))
+			v.setType(ClientTypePlay)
+		case *CreateStreamPacket:
+			v.StreamID = serverStreamID
+			res := NewCreateStreamResPacket(pkt.TransactionID)
+			res.StreamID = amf0.Number(v.StreamID)
+			if err = v.WritePacket(res, 0); err != nil {
+				return ClientTypeUnknown, oe.WithMessage(err, "write create stream res")
+			}
+		case *FMLEStartPacket:
+			if err = v.WritePacket(NewFMLEStartResPacket(pkt.TransactionID), 0); err != nil {
+				return ClientTypeUnknown, oe.WithMessage(err, "write fmle start res")
+			}
+
+			// For FCSubscribe, some CDNs require the onFCSubscribe before play.
+			if pkt.CommandName == commandFCSubscribe {
+				res := NewOnStatusCallPacket()
+				res.CommandName = commandOnFCSubscribe
+				res.Data.Set("code", amf0.NewString(StatusCodePlayStart))
+				res.Data.Set("description", amf0.NewString(string(pkt.StreamName)))
+				if err = v.WritePacket(res, 0); err != nil {
+					return ClientTypeUnknown, oe.WithMessage(err, "write on fc subscribe")
+				}
+			}
+		}
+	}
+
+	if err = v.resolveVhost(); err != nil {
+		return ClientTypeUnknown, oe.WithMessage(err, "resolve vhost")
+	}
+
+	return v.Type, nil
+}
+
+// Resolve the vhost config again when identified, because the stream may specify other vhost,
+// for example, livestream?vhost=ossrs.net, so the auth, chunk size and admission of the vhost
+// of stream is used. The client is rejected if vhost not found.
+func (v *Conn) resolveVhost() (err error) {
+	if v.server == nil || v.server.Vhosts == nil {
+		return
+	}
+
+	r := v.cloneRequest()
+	c := v.server.Vhosts.Lookup(r.Vhost)
+	if c == nil {
+		code := StatusPublishRejected
+		if v.Type == ClientTypePlay {
+			code = StatusCodeStreamNotFound
+		}
+
+		rejected := oe.Errorf("vhost %v not found", r.Vhost)
+		if err = v.WriteStatus(StatusLevelError, code, rejected.Error()); err != nil {
+			return oe.WithMessage(err, "write rejected")
+		}
+		return rejected
+	}
+
+	if c == v.Vhost {
+		return
+	}
+	v.Vhost = c
+
+	if c.ChunkSize > 0 {
+		if err = v.SetOutputChunkSize(uint32(c.ChunkSize)); err != nil {
+			return oe.WithMessage(err, "set chunk size")
+		}
+	}
+
+	return
+}
+
+// Identify the client, which must be a publisher, then response the publish.
+func (v *Conn) ExpectPublish() (err error) {
+	var t ClientType
+	if t, err = v.Identify(); err != nil {
+		return oe.WithMessage(err, "identify")
+	}
+
+	if t != ClientTypePublish {
+		return oe.Errorf("client is %v, not publish", t)
+	}
+
+	// Reject the new publisher when draining, the encoder should retry other servers.
+	if v.server != nil && v.server.Draining() {
+		if err = v.WriteStatus(StatusLevelError, StatusPublishRejected, "Server is draining."); err != nil {
+			return oe.WithMessage(err, "write publish rejected")
+		}
+		return oe.New("server is draining")
+	}
+
+	// Reject the publisher by the auth of vhost.
+	if v.Vhost != nil && v.Vhost.Auth != nil {
+		if rejected := v.Vhost.Auth(v.cloneRequest()); rejected != nil {
+			if err = v.WriteStatus(StatusLevelError, StatusPublishRejected, rejected.Error()); err != nil {
+				return oe.WithMessage(err, "write publish rejected")
+			}
+			return oe.WithMessage(rejected, "rejected")
+		}
+	}
+
+	// Reject the publisher when exceed the admission, the encoder should retry later.
+	if v.server != nil && v.server.Admission != nil {
+		r := v.cloneRequest()
+
+		var release func()
+		if release, err = v.server.Admission.AdmitPublisher(v.conn.RemoteAddr(), r.Vhost, r.App); err != nil {
+			ae := err.(*AdmissionError)
+			if err = v.WriteStatus(StatusLevelError, ae.Code(), ae.Description()); err != nil {
+				return oe.WithMessage(err, "write publish rejected")
+			}
+			return ae
+		}
+
+		v.rlock.Lock()
+		v.releases = append(v.releases, release)
+		v.rlock.Unlock()
+	}
+
+	if err = v.WriteStatus(StatusLevelStatus, StatusCodePublishStart, "Started publishing stream."); err != nil {
+		return oe.WithMessage(err, "write publish start")
+	}
+
+	return
+}
+
+// Identify the client, which must be a player, then response the play. User should
+// write the metadata, sequence headers and frames to StreamID.
+func (v *Conn) ExpectPlay() (err error) {
+	var t ClientType
+	if t, err = v.Identify(); err != nil {
+		return oe.WithMessage(err, "identify")
+	}
+
+	if t != ClientTypePlay {
+		return oe.Errorf("client is %v, not play", t)
+	}
+
+	// Reject the player by the auth of vhost.
+	if v.Vhost != nil && v.Vhost.Auth != nil {
+		if rejected := v.Vhost.Auth(v.cloneRequest()); rejected != nil {
+			if err = v.WriteStatus(StatusLevelError, StatusCodeStreamNotFound, rejected.Error()); err != nil {
+				return oe.WithMessage(err, "write play rejected")
+			}
+			return oe.WithMessage(rejected, "rejected")
+		}
+	}
+
+	if err = v.WriteStreamBegin(); err != nil {
+		return oe.WithMessage(err, "write stream begin")
+	}
+
+	if err = v.WriteStatus(StatusLevelStatus, StatusCodePlayReset, "Playing and resetting stream."); err != nil {
+		return oe.WithMessage(err, "write play reset")
+	}
+
+	if err = v.WriteStatus(StatusLevelStatus, StatusCodePlayStart, "Started playing stream."); err != nil {
+		return oe.WithMessage(err, "write play start")
+	}
+
+	return
+}
+
+// Handle the play2 of player, ok is true if m is play2, to switch the stream without
+// stopping playback, for example, switch the bitrates. The stream of Request is updated,
+// and user should write the frames of new stream to player.
+// For example, in the loop of player:
+//		m, err := c.ReadMessage()
+//		if ok, pkt, err := c.HandlePlay2(m); ok { if err != nil { return } switch to pkt.Get("streamName") }
+func (v *Conn) HandlePlay2(m *Message) (ok bool, pkt *Play2Packet, err error) {
+	if m.MessageType != MessageTypeAMF0Command && m.MessageType != MessageTypeAMF3Command {
+		return false, nil, nil
+	}
+
+	var p Packet
+	if p, err = v.DecodeMessage(m); err != nil {
+		return false, nil, nil
+	}
+
+	if pkt, ok = p.(*Play2Packet); !ok {
+		return false, nil, nil
+	}
+
+	stream := pkt.Get("streamName")
+	if stream == "" {
+		return true, nil, oe.New("no stream")
+	}
+
+	r := v.cloneRequest()
+	r.SetStream(stream)
+
+	v.rlock.Lock()
+	v.Request = r
+	v.rlock.Unlock()
+
+	if err = v.WriteStatus(StatusLevelStatus, StatusCodePlayTransition, fmt.Sprintf("Transition to %v.", stream)); err != nil {
+		return true, nil, oe.WithMessage(err, "write play transition")
+	}
+
+	return true, pkt, nil
+}
+
+// Handle the stream key rotation of publisher, ok is true if m is CommandRotateStreamKey.
+// The request with the new key is verified by OnRotate of server, the publisher is
+// disconnected if refused, so the live event is not interrupted when key rotated.
+// For example, in the loop of publisher:
+//		m, err := c.ReadMessage()
+//		if ok, err := c.HandleRotate(m); ok { if err != nil { return } continue }
+func (v *Conn) HandleRotate(m *Message) (ok bool, err error) {
+	if m.MessageType != MessageTypeAMF0Command && m.MessageType != MessageTypeAMF3Command {
+		return false, nil
+	}
+
+	var pkt Packet
+	if pkt, err = v.DecodeMessage(m); err != nil {
+		return false, nil
+	}
+
+	call, ok := pkt.(*CallPacket)
+	if !ok || call.CommandName != CommandRotateStreamKey {
+		return false, nil
+	}
+
+	stream, _ := call.Args.(*amf0.String)
+	if stream == nil {
+		return true, v.reject(call.TransactionID, oe.New("no stream"))
+	}
+
+	if v.server == nil || v.server.OnRotate == nil {
+		res := NewRPCPacket(string(commandError), amf0.NewString("rotation not supported"))
+		res.TransactionID = call.TransactionID
+		return true, v.WritePacket(res, 0)
+	}
+
+	// Update the key on a copy of request, the stream must not change.
+	r := v.cloneRequest()
+	r.SetStream(string(*stream))
+
+	if r.Stream != v.Request.Stream {
+		return true, v.reject(call.TransactionID, oe.Errorf("stream %v changed to %v", v.Request.Stream, r.Stream))
+	}
+
+	if err = v.server.OnRotate(r); err != nil {
+		return true, v.reject(call.TransactionID, err)
+	}
+
+	v.rlock.Lock()
+	v.Request = r
+	v.rlock.Unlock()
+
+	res := NewRPCPacket(string(commandResult), amf0.NewNull())
+	res.TransactionID = call.TransactionID
+	if err = v.WritePacket(res, 0); err != nil {
+		return true, oe.WithMessage(err, "write rotate result")
+	}
+
+	return true, nil
+}
+
+// Copy the request and its param, to update it without lock.
+func (v *Conn) cloneRequest() *Request {
+	v.rlock.Lock()
+	r := *v.Request
+	v.rlock.Unlock()
+
+	param := r.Param
+	r.Param = url.Values{}
+	for key, values := range param {
+		r.Param[key] = values
+	}
+	return &r
+}
+
+// Verify the client again by verify, for example, when the key is revoked by backend.
+// The client is rejected and disconnected if refused, by StatusPublishRejected for publisher
+// or StatusCodePlayFailed for player.
+// @remark It's safe to call it in other goroutines.
+func (v *Conn) Reauthenticate(verify func(r *Request) error) (err error) {
+	v.rlock.Lock()
+	r := v.Request
+	v.rlock.Unlock()
+
+	if err = verify(r); err != nil {
+		return v.reject(0, err)
+	}
+
+	return
+}
+
+// Reject the client by _error of transaction if not zero, and onStatus, then close it.
+func (v *Conn) reject(tid amf0.Number, reason error) error {
+	defer v.Close()
+
+	if tid != 0 {
+		res := NewRPCPacket(string(commandError), amf0.NewString(reason.Error()))
+		res.TransactionID = tid
+		if err := v.WritePacket(res, 0); err != nil {
+			return oe.WithMessage(err, "write rotate error")
+		}
+	}
+
+	code := StatusPublishRejected
+	if v.safeType() == ClientTypePlay {
+		code = StatusCodePlayFailed
+	}
+	if err := v.WriteStatus(StatusLevelError, code, reason.Error()); err != nil {
+		return oe.WithMessage(err, "write rejected")
+	}
+
+	return oe.WithMessage(reason, "rejected")
+}
+
+// Write the onStatus to the stream of client, for example, to notify the player
+// StatusCodeStreamNotFound.
+func (v *Conn) WriteStatus(level, code, description string) error {
+	pkt := NewOnStatusCallPacket()
+	pkt.Data.Set("level", amf0.NewString(level))
+	pkt.Data.Set("code", amf0.NewString(code))
+	pkt.Data.Set("description", amf0.NewString(description))
+
+	return v.WritePacket(pkt, v.StreamID)
+}
+
+// Write the user control event stream begin, to notify player the stream is functional.
+func (v *Conn) WriteStreamBegin() error {
+	pkt := NewUserControl()
+	pkt.EventType = EventTypeStreamBegin
+	pkt.EventData = int32(v.StreamID)
+	return v.WritePacket(pkt, 0)
+}
+
+// Response the connect, reject the client if verify failed.
+func (v *Conn) responseConnect(connect *ConnectAppPacket, verify func(r *Request) error) (err error) {
+	if v.Request, err = NewRequestFromConnect(connect); err != nil {
+		return oe.WithMessage(err, "parse request")
+	}
+
+	ack := NewWindowAcknowledgementSize()
+	ack.AckSize = serverAckSize
+	if err = v.WritePacket(ack, 0); err != nil {
+		return oe.WithMessage(err, "write ack size")
+	}
+
+	bw := NewSetPeerBandwidth()
+	bw.Bandwidth, bw.LimitType = serverAckSize, LimitTypeDynamic
+	if err = v.WritePacket(bw, 0); err != nil {
+		return oe.WithMessage(err, "write peer bandwidth")
+	}
+
+	res := NewConnectAppResPacket(connect.TransactionID)
+	res.CommandObject.Set("fmsVer", amf0.NewString("FMS/3,5,3,888"))
+	res.CommandObject.Set("capabilities", amf0.NewNumber(127))
+	res.CommandObject.Set("mode", amf0.NewNumber(1))
+
+	res.Args = amf0.NewObject()
+	res.Args.Set("level", amf0.NewString(StatusLevelStatus))
+	res.Args.Set("code", amf0.NewString(StatusCodeConnectSuccess))
+	res.Args.Set("description", amf0.NewString("Connection succeeded"))
+	if encoding := connect.CommandObject.Get("objectEncoding"); encoding != nil {
+		res.Args.Set("objectEncoding", encoding)
+	} else {
+		res.Args.Set("objectEncoding", amf0.NewNumber(0))
+	}
+
+	var rejected error
+	if verify != nil {
+		if rejected = verify(v.Request); rejected != nil {
+			res.CommandName = commandError
+			res.Args.Set("level", amf0.NewString(StatusLevelError))
+			res.Args.Set("code", amf0.NewString(StatusConnectRejected))
+			res.Args.Set("description", amf0.NewString(rejected.Error()))
+		}
+	}
+
+	if err = v.WritePacket(res, 0); err != nil {
+		return oe.WithMessage(err, "write connect res")
+	}
+
+	if rejected != nil {
+		return oe.WithMessage(rejected, "rejected")
+	}
+	return
+}
@@ -0,0 +1,275 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The switcher for hot failover of redundant RTMP streams.
+package rtmp
+
+import (
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"sync"
+	"time"
+)
+
+// The source of messages, for example, the Protocol.
+type MessageSource interface {
+	ReadMessage() (m *Message, err error)
+}
+
+// The source of switcher.
+const (
+	SwitcherPrimary = iota
+	SwitcherBackup
+)
+
+// The default timeout to switch to the other source.
+const defaultSwitcherTimeout = time.Duration(3) * time.Second
+
+// The message or error read from source.
+type switcherMessage struct {
+	source int
+	m      *Message
+	err    error
+}
+
+// The state of source of switcher.
+type switcherSource struct {
+	// Whether source is failed.
+	err error
+	// The last time got message from source.
+	lastRecv time.Time
+	// Whether source has video, switch at audio frame if not.
+	hasVideo bool
+	// The cached sequence headers and metadata of source.
+	metadata, audioSequenceHeader, videoSequenceHeader *Message
+}
+
+// The Switcher reads messages from the primary and backup source and outputs a single
+// stream, for seamless failover for redundant contribution feeds. It switches to the
+// other source when the active source is failed or no message for Timeout, and switches
+// back to primary when primary is restored.
+// @remark It only switches at keyframe, or audio frame if source has no video, and rebase the
+// timestamp to be monotonically increasing.
+// @remark User should close the switcher and the sources, to stop the goroutines reading sources.
+type Switcher struct {
+	// Switch to the other source when active source has no message in Timeout.
+	// If zero, 3 seconds is used.
+	Timeout time.Duration
+	// The hook when switch from source to other source, optional.
+	OnSwitch func(from, to int)
+
+	inputs  [2]MessageSource
+	sources [2]*switcherSource
+	once    sync.Once
+	msgs    chan *switcherMessage
+	// Closed when switcher closed, to stop the goroutines reading sources.
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// The active source and the messages to output.
+	active  int
+	pending []*Message
+
+	// The timestamp of active source at switching, and the output timestamp at switching.
+	base, offset uint64
+	// The last timestamp of output.
+	lastTimestamp uint64
+}
+
+func NewSwitcher(primary, backup MessageSource) *Switcher {
+	return &Switcher{
+		inputs:  [2]MessageSource{primary, backup},
+		sources: [2]*switcherSource{&switcherSource{}, &switcherSource{}},
+		msgs:    make(chan *switcherMessage),
+		closed:  make(chan struct{}),
+		active:  SwitcherPrimary,
+	}
+}
+
+// Close the switcher, the ReadMessage returns error. The goroutine reading source quits when
+// got next message or error, so user should close the sources to unblock it.
+func (v *Switcher) Close() error {
+	v.closeOnce.Do(func() {
+		close(v.closed)
+	})
+	return nil
+}
+
+// Get the active source, SwitcherPrimary or SwitcherBackup.
+// @remark It's not safe for concurrent use with ReadMessage.
+func (v *Switcher) Active() int {
+	return v.active
+}
+
+// Read the message from the active source, with timestamp rebased.
+// Return error only when both sources are failed.
+func (v *Switcher) ReadMessage() (m *Message, err error) {
+	v.once.Do(func() {
+		for source, input := range v.inputs {
+			go v.read(source, input)
+		}
+	})
+
+	for {
+		if len(v.pending) > 0 {
+			m, v.pending = v.pending[0], v.pending[1:]
+			return v.rebase(m), nil
+		}
+
+		if primary, backup := v.sources[0], v.sources[1]; primary.err != nil && backup.err != nil {
+			return nil, v.sources[v.active].err
+		}
+
+		var sm *switcherMessage
+		select {
+		case sm = <-v.msgs:
+		case <-v.closed:
+			return nil, oe.New("switcher closed")
+		}
+		source := v.sources[sm.source]
+
+		if sm.err != nil {
+			source.err = sm.err
+			continue
+		}
+
+		source.lastRecv = time.Now()
+		source.cache(sm.m)
+
+		if sm.source == v.active {
+			return v.rebase(sm.m), nil
+		}
+
+		// Switch at keyframe, when active source is failed or timeout, or primary restored.
+		if !v.shouldSwitch(sm.source) || !source.canSwitchAt(sm.m) {
+			continue
+		}
+
+		if v.OnSwitch != nil {
+			v.OnSwitch(v.active, sm.source)
+		}
+
+		v.active, v.base, v.offset = sm.source, sm.m.Timestamp, v.lastTimestamp
+		for _, m := range []*Message{source.metadata, source.audioSequenceHeader, source.videoSequenceHeader} {
+			if m != nil {
+				v.pending = append(v.pending, m)
+			}
+		}
+		v.pending = append(v.pending, sm.m)
+	}
+}
+
+func (v *Switcher) read(source int, input MessageSource) {
+	for {
+		m, err := input.ReadMessage()
+
+		select {
+		case v.msgs <- &switcherMessage{source: source, m: m, err: err}:
+		case <-v.closed:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (v *Switcher) shouldSwitch(to int) bool {
+	if to == SwitcherPrimary {
+		return true
+	}
+
+	timeout := v.Timeout
+	if timeout <= 0 {
+		timeout = defaultSwitcherTimeout
+	}
+
+	active := v.sources[v.active]
+	return active.err != nil || time.Now().Sub(active.lastRecv) > timeout
+}
+
+// Rebase the timestamp of message, the output is a copy of message.
+func (v *Switcher) rebase(m *Message) *Message {
+	c := *m
+
+	if c.Timestamp >= v.base {
+		c.Timestamp = v.offset + c.Timestamp - v.base
+	} else {
+		c.Timestamp = v.offset
+	}
+
+	if c.Timestamp > v.lastTimestamp {
+		v.lastTimestamp = c.Timestamp
+	}
+
+	return &c
+}
+
+func (v *switcherSource) cache(m *Message) {
+	if m.MessageType == MessageTypeVideo {
+		v.hasVideo = true
+	}
+
+	switch {
+	case m.MessageType == MessageTypeAMF0Data || m.MessageType == MessageTypeAMF3Data:
+		v.metadata = m
+	case isAudioSequenceHeader(m):
+		v.audioSequenceHeader = m
+	case isVideoSequenceHeader(m):
+		v.videoSequenceHeader = m
+	}
+}
+
+// Whether switch to source at message m, the video keyframe, or the audio frame if no video.
+func (v *switcherSource) canSwitchAt(m *Message) bool {
+	if v.hasVideo {
+		return isVideoKeyframe(m)
+	}
+	return m.MessageType == MessageTypeAudio && !isAudioSequenceHeader(m)
+}
+
+// Whether message is AAC sequence header.
+// Please read @doc video_file_format_spec_v10.pdf, @page 76, @section E.4.2 Audio Tags
+func isAudioSequenceHeader(m *Message) bool {
+	p := m.Payload
+	return m.MessageType == MessageTypeAudio && len(p) > 1 && p[0]>>4 == 10 && p[1] == 0
+}
+
+// Whether message is AVC or HEVC sequence header.
+// Please read @doc video_file_format_spec_v10.pdf, @page 78, @section E.4.3 Video Tags
+func isVideoSequenceHeader(m *Message) bool {
+	p := m.Payload
+	if m.MessageType != MessageTypeVideo || len(p) < 2 {
+		return false
+	}
+
+	codec := p[0] & 0x0f
+	return (codec == 7 || codec == 12) && p[1] == 0
+}
+
+// Whether message is video keyframe, but not sequence header.
+func isVideoKeyframe(m *Message) bool {
+	p := m.Payload
+	if m.MessageType != MessageTypeVideo || len(p) < 1 || p[0]>>4 != 1 {
+		return false
+	}
+	return !isVideoSequenceHeader(m)
+}
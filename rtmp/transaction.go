@@ -0,0 +1,220 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The transactions of RTMP, the requests which wait for the responses, with timeout and limit.
+package rtmp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	oo "github.com/ossrs/go-oryx-lib/options"
+	"time"
+)
+
+// The reason why the transaction fail.
+type TransactionReason uint8
+
+const (
+	// The response of transaction never arrives before the deadline.
+	TransactionReasonTimeout TransactionReason = iota + 1
+	// There are too many outstanding transactions, the request is not sent.
+	TransactionReasonOverflow
+)
+
+func (v TransactionReason) String() string {
+	switch v {
+	case TransactionReasonTimeout:
+		return "Timeout"
+	case TransactionReasonOverflow:
+		return "Overflow"
+	default:
+		return "Unknown"
+	}
+}
+
+// The error of a failed transaction, which is a request expecting a response,
+// for example, the connect and createStream.
+type TransactionError struct {
+	Reason        TransactionReason
+	TransactionID amf0.Number
+	CommandName   amf0.String
+}
+
+func (v *TransactionError) Error() string {
+	return fmt.Sprintf("transaction %v, tid=%v, command=%v", v.Reason, float64(v.TransactionID), string(v.CommandName))
+}
+
+// The policy for outstanding transactions, zero value means no timeout and no limit,
+// which is the policy of new Protocol, user can enable it by SetTransactionPolicy.
+type TransactionPolicy struct {
+	// The timeout to wait for the response, the transaction is removed when expired.
+	Timeout time.Duration
+	// The max number of outstanding transactions, the request is rejected when exceed.
+	Max int
+	// The hook when transaction fail, optional.
+	// @remark It's called in the goroutine which reads or writes the protocol, or the timer
+	// when the connection is idle, so user can close the connection to unblock the reading.
+	OnError func(err *TransactionError)
+}
+
+// The recommended policy, for example, SetTransactionPolicy(DefaultTransactionPolicy).
+// @remark It's not applied to new Protocol, because the late response is rejected.
+var DefaultTransactionPolicy = TransactionPolicy{
+	Timeout: time.Duration(30) * time.Second,
+	Max:     128,
+}
+
+// The policy in config, with units, for example:
+//		{"timeout": "30s", "max": 128}
+type transactionPolicyConfig struct {
+	Timeout oo.Duration `json:"timeout"`
+	Max     int         `json:"max"`
+}
+
+func (v TransactionPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&transactionPolicyConfig{Timeout: oo.Duration(v.Timeout), Max: v.Max})
+}
+
+// @remark The absent fields are not changed, so user can unmarshal over DefaultTransactionPolicy.
+func (v *TransactionPolicy) UnmarshalJSON(data []byte) error {
+	c := &transactionPolicyConfig{Timeout: oo.Duration(v.Timeout), Max: v.Max}
+	if err := json.Unmarshal(data, c); err != nil {
+		return oe.Wrap(err, "unmarshal policy")
+	}
+
+	v.Timeout, v.Max = c.Timeout.Duration(), c.Max
+	return nil
+}
+
+// The outstanding transaction, wait for the response.
+type transaction struct {
+	name     amf0.String
+	deadline time.Time
+	// The timer to expire the transaction, even no message arrives.
+	timer *time.Timer
+}
+
+// Set the policy for transactions, see DefaultTransactionPolicy.
+func (v *Protocol) SetTransactionPolicy(policy TransactionPolicy) {
+	v.input.ltransactions.Lock()
+	defer v.input.ltransactions.Unlock()
+	v.input.policy = policy
+}
+
+// Get the number of outstanding transactions.
+func (v *Protocol) Transactions() int {
+	v.input.ltransactions.Lock()
+	defer v.input.ltransactions.Unlock()
+	return len(v.input.transactions)
+}
+
+// Start a transaction for the request, when the packet is about to write.
+// @return An *TransactionError when there are too many outstanding transactions.
+func (v *Protocol) startTransaction(tid amf0.Number, name amf0.String) (err error) {
+	v.gcTransactions()
+
+	v.input.ltransactions.Lock()
+	policy := v.input.policy
+	if policy.Max > 0 && len(v.input.transactions) >= policy.Max {
+		v.input.ltransactions.Unlock()
+		return v.failTransaction(&TransactionError{
+			Reason: TransactionReasonOverflow, TransactionID: tid, CommandName: name,
+		})
+	}
+
+	t := &transaction{name: name}
+	if policy.Timeout > 0 {
+		t.deadline = time.Now().Add(policy.Timeout)
+		t.timer = time.AfterFunc(policy.Timeout, v.gcTransactions)
+	}
+	v.input.transactions[tid] = t
+	v.input.ltransactions.Unlock()
+
+	return
+}
+
+// Remove the transaction and return the name of request, when got the response.
+func (v *Protocol) finishTransaction(tid amf0.Number) (name amf0.String, ok bool) {
+	v.gcTransactions()
+
+	v.input.ltransactions.Lock()
+	defer v.input.ltransactions.Unlock()
+
+	var t *transaction
+	if t, ok = v.input.transactions[tid]; ok {
+		name = t.name
+		delete(v.input.transactions, tid)
+
+		if t.timer != nil {
+			t.timer.Stop()
+		}
+	}
+	return
+}
+
+// Whether the transaction is waiting for the response, not finished or expired.
+func (v *Protocol) pendingTransaction(tid amf0.Number) bool {
+	v.input.ltransactions.Lock()
+	defer v.input.ltransactions.Unlock()
+
+	_, ok := v.input.transactions[tid]
+	return ok
+}
+
+// Remove the expired transactions, and notify user by the hook.
+// @remark It's called when start or finish transaction, got message, or the timer of transaction.
+func (v *Protocol) gcTransactions() {
+	var expired []*TransactionError
+
+	func() {
+		v.input.ltransactions.Lock()
+		defer v.input.ltransactions.Unlock()
+
+		now := time.Now()
+		for tid, t := range v.input.transactions {
+			if t.deadline.IsZero() || now.Before(t.deadline) {
+				continue
+			}
+
+			delete(v.input.transactions, tid)
+			expired = append(expired, &TransactionError{
+				Reason: TransactionReasonTimeout, TransactionID: tid, CommandName: t.name,
+			})
+		}
+	}()
+
+	for _, err := range expired {
+		v.failTransaction(err)
+	}
+}
+
+func (v *Protocol) failTransaction(err *TransactionError) error {
+	v.input.ltransactions.Lock()
+	onError := v.input.policy.OnError
+	v.input.ltransactions.Unlock()
+
+	if onError != nil {
+		onError(err)
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The payload transform hooks, for proprietary scrambling or DRM experiments, like RTMPE.
+package rtmp
+
+// The transform of message payload, return the transformed payload.
+// @remark For write, the message might be shared, so never modify the message or
+// payload, return a new payload instead.
+type PayloadTransform func(m *Message) (payload []byte, err error)
+
+// Set the payload transforms, nil to disable.
+// @param read Applied to the message read, after chunk assembly.
+// @param write Applied to the message to write, before chunking.
+// @remark Set it before read or write, and the peer must use the reverse transforms.
+func (v *Protocol) SetPayloadTransform(read, write PayloadTransform) {
+	v.input.transform = read
+	v.output.transform = write
+}
@@ -0,0 +1,178 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// The vhost of RTMP, parse the vhost from tcUrl and lookup the config of vhost,
+// which follows the vhost model of SRS.
+package rtmp
+
+import (
+	"fmt"
+	"github.com/ossrs/go-oryx-lib/amf0"
+	oe "github.com/ossrs/go-oryx-lib/errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The default vhost, used when no vhost specified or vhost not found.
+const DefaultVhost = "__defaultVhost__"
+
+// The default port of RTMP.
+const DefaultPort = 1935
+
+// The request of client, parsed from tcUrl of connect and stream of publish or play.
+// For example, the tcUrl and stream:
+//		rtmp://ip/app?vhost=ossrs.net, livestream?token=xxx
+//		rtmp://ossrs.net:1935/app, livestream
+//		rtmp://ip/app...vhost...ossrs.net, livestream
+// The vhost is ossrs.net, app is app and stream is livestream.
+type Request struct {
+	// The tcUrl of connect.
+	TcUrl string
+	// The schema, host and port of tcUrl.
+	Schema string
+	Host   string
+	Port   int
+	// The vhost, parsed from query vhost or domain, or the host if it's not an ip.
+	Vhost string
+	App   string
+	// The stream name, without any query parameters.
+	Stream string
+	// The query parameters of tcUrl and stream, without the vhost.
+	Param url.Values
+}
+
+// Parse the tcUrl of connect request, for example, rtmp://ossrs.net/live?vhost=xxx
+func NewRequest(tcUrl string) (v *Request, err error) {
+	v = &Request{TcUrl: tcUrl, Param: url.Values{}}
+
+	// The app...vhost...ossrs.net format is used by FMLE which not support query.
+	s := strings.Replace(tcUrl, "...", "?", 1)
+	s = strings.Replace(s, "...", "=", 1)
+
+	var u *url.URL
+	if u, err = url.Parse(s); err != nil {
+		return nil, oe.Wrapf(err, "parse tcUrl %v", tcUrl)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, oe.Errorf("invalid tcUrl %v", tcUrl)
+	}
+
+	v.Schema, v.Host, v.Port = u.Scheme, u.Host, DefaultPort
+	if host, port, err := net.SplitHostPort(u.Host); err == nil {
+		if v.Port, err = strconv.Atoi(port); err != nil {
+			return nil, oe.Wrapf(err, "parse port %v", port)
+		}
+		v.Host = host
+	}
+
+	v.App = strings.Trim(u.Path, "/")
+	v.Vhost = v.Host
+	if net.ParseIP(v.Host) != nil {
+		v.Vhost = DefaultVhost
+	}
+
+	v.parseParam(u.RawQuery)
+
+	return
+}
+
+// Parse the vhost and app from the connect packet.
+func NewRequestFromConnect(pkt *ConnectAppPacket) (v *Request, err error) {
+	var tcUrl string
+	if s, ok := pkt.CommandObject.Get("tcUrl").(*amf0.String); ok {
+		tcUrl = string(*s)
+	}
+
+	if tcUrl == "" {
+		return nil, oe.New("no tcUrl")
+	}
+
+	return NewRequest(tcUrl)
+}
+
+// Set the stream of publish or play, the query of stream may also specify the vhost,
+// for example, livestream?vhost=ossrs.net
+func (v *Request) SetStream(stream string) {
+	if pos := strings.Index(stream, "?"); pos >= 0 {
+		v.parseParam(stream[pos+1:])
+		stream = stream[:pos]
+	}
+	v.Stream = stream
+}
+
+// Overwrite vhost by query vhost or domain, and keep others in param.
+func (v *Request) parseParam(query string) {
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return
+	}
+
+	for _, key := range []string{"vhost", "domain"} {
+		if vhost := q.Get(key); vhost != "" {
+			v.Vhost = vhost
+		}
+		q.Del(key)
+	}
+
+	for key, values := range q {
+		v.Param[key] = values
+	}
+}
+
+// The url of stream, in vhost/app/stream format.
+func (v *Request) StreamURL() string {
+	return fmt.Sprintf("%v/%v/%v", v.Vhost, v.App, v.Stream)
+}
+
+func (v *Request) String() string {
+	return fmt.Sprintf("tcUrl=%v, vhost=%v, app=%v, stream=%v", v.TcUrl, v.Vhost, v.App, v.Stream)
+}
+
+// The config of vhost, zero value means use the default.
+type VhostConfig struct {
+	// The name of vhost.
+	Name string
+	// The output chunk size, set by server after connect, see SetOutputChunkSize.
+	ChunkSize int
+	// The auth for connect, publish and play, optional.
+	// @remark The request is connect if stream is empty.
+	Auth func(r *Request) error
+}
+
+// The lookup of vhost config, the server use it to get the settings of vhost.
+type Vhosts interface {
+	// Get the config of vhost, return nil if not found.
+	Lookup(vhost string) *VhostConfig
+}
+
+// The static vhost configs, the key is the vhost name.
+// @remark Fallback to the DefaultVhost if vhost not found, like SRS.
+type StaticVhosts map[string]*VhostConfig
+
+// The interface Vhosts.
+func (v StaticVhosts) Lookup(vhost string) *VhostConfig {
+	if c, ok := v[vhost]; ok {
+		return c
+	}
+	return v[DefaultVhost]
+}
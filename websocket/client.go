@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -60,10 +61,21 @@ type Dialer struct {
 	// If Proxy is nil or returns a nil *URL, no proxy is used.
 	Proxy func(*http.Request) (*url.URL, error)
 
+	// ProxyConnectHeader specifies the headers to send to the proxy in the
+	// CONNECT request, for example, the Proxy-Authorization for schemes other
+	// than Basic. The Basic credential from the proxy URL is used only when
+	// there is no Proxy-Authorization in it.
+	ProxyConnectHeader http.Header
+
 	// TLSClientConfig specifies the TLS configuration to use with tls.Client.
 	// If nil, the default configuration is used.
 	TLSClientConfig *tls.Config
 
+	// TLSManager specifies the certificate to present to wss server, for
+	// example, the https.Manager of go-oryx-lib. It's used only when there is
+	// no certificate in TLSClientConfig.
+	TLSManager CertificateManager
+
 	// HandshakeTimeout specifies the duration for the handshake to complete.
 	HandshakeTimeout time.Duration
 
@@ -87,6 +99,12 @@ type Dialer struct {
 	Jar http.CookieJar
 }
 
+// CertificateManager gets the certificate by the server name, it's the
+// interface of https.Manager.
+type CertificateManager interface {
+	GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
 var errMalformedURL = errors.New("malformed ws or wss URL")
 
 // parseURL parses the URL.
@@ -293,12 +311,13 @@ func (d *Dialer) Dial(urlStr string, requestHeader http.Header) (*Conn, *http.Re
 
 	if proxyURL != nil {
 		connectHeader := make(http.Header)
-		if user := proxyURL.User; user != nil {
-			proxyUser := user.Username()
-			if proxyPassword, passwordSet := user.Password(); passwordSet {
-				credential := base64.StdEncoding.EncodeToString([]byte(proxyUser + ":" + proxyPassword))
-				connectHeader.Set("Proxy-Authorization", "Basic "+credential)
-			}
+		for k, vs := range d.ProxyConnectHeader {
+			connectHeader[k] = vs
+		}
+		if user := proxyURL.User; user != nil && connectHeader.Get("Proxy-Authorization") == "" {
+			proxyPassword, _ := user.Password()
+			credential := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + proxyPassword))
+			connectHeader.Set("Proxy-Authorization", "Basic "+credential)
 		}
 		connectReq := &http.Request{
 			Method: "CONNECT",
@@ -318,8 +337,7 @@ func (d *Dialer) Dial(urlStr string, requestHeader http.Header) (*Conn, *http.Re
 			return nil, nil, err
 		}
 		if resp.StatusCode != 200 {
-			f := strings.SplitN(resp.Status, " ", 2)
-			return nil, nil, errors.New(f[1])
+			return nil, nil, errors.New("websocket: proxy CONNECT failed: " + resp.Status)
 		}
 	}
 
@@ -328,6 +346,13 @@ func (d *Dialer) Dial(urlStr string, requestHeader http.Header) (*Conn, *http.Re
 		if cfg.ServerName == "" {
 			cfg.ServerName = hostNoPort
 		}
+		if d.TLSManager != nil && len(cfg.Certificates) == 0 {
+			cert, err := d.TLSManager.GetCertificate(&tls.ClientHelloInfo{ServerName: cfg.ServerName})
+			if err != nil {
+				return nil, nil, err
+			}
+			cfg.Certificates = []tls.Certificate{*cert}
+		}
 		tlsConn := tls.Client(netConn, cfg)
 		netConn = tlsConn
 		if err := tlsConn.Handshake(); err != nil {
@@ -387,6 +412,9 @@ func (d *Dialer) Dial(urlStr string, requestHeader http.Header) (*Conn, *http.Re
 	resp.Body = ioutil.NopCloser(bytes.NewReader([]byte{}))
 	conn.subprotocol = resp.Header.Get("Sec-Websocket-Protocol")
 
+	// Exclude the handshake from the counters, except the frames read ahead.
+	atomic.StoreUint64(&conn.stats.bytesRead, uint64(conn.br.Buffered()))
+
 	netConn.SetDeadline(time.Time{})
 	netConn = nil // to avoid close in defer.
 	return conn, resp, nil
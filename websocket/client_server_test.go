@@ -218,6 +218,65 @@ func TestProxyAuthorizationDial(t *testing.T) {
 	cstDialer.Proxy = http.ProxyFromEnvironment
 }
 
+func TestProxyConnectHeaderDial(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	surl, _ := url.Parse(s.URL)
+	surl.User = url.UserPassword("username", "password")
+	cstDialer.Proxy = http.ProxyURL(surl)
+	cstDialer.ProxyConnectHeader = http.Header{"Proxy-Authorization": {"Bearer token"}}
+
+	connect := false
+	origHandler := s.Server.Config.Handler
+
+	// The header overwrites the Basic credential of proxy URL.
+	s.Server.Config.Handler = http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "CONNECT" && r.Header.Get("Proxy-Authorization") == "Bearer token" {
+				connect = true
+				w.WriteHeader(200)
+				return
+			}
+
+			if !connect {
+				t.Log("connect with proxy connect header not recieved")
+				http.Error(w, "connect with proxy connect header not recieved", 405)
+				return
+			}
+			origHandler.ServeHTTP(w, r)
+		})
+
+	ws, _, err := cstDialer.Dial(s.URL, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer ws.Close()
+	sendRecv(t, ws)
+
+	cstDialer.Proxy = http.ProxyFromEnvironment
+	cstDialer.ProxyConnectHeader = nil
+}
+
+func TestProxyRejectDial(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	surl, _ := url.Parse(s.URL)
+	d := cstDialer
+	d.Proxy = http.ProxyURL(surl)
+
+	s.Server.Config.Handler = http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+		})
+
+	_, _, err := d.Dial(s.URL, nil)
+	if err == nil || !strings.Contains(err.Error(), "407") {
+		t.Fatalf("Dial: %v, want 407", err)
+	}
+}
+
 func TestDial(t *testing.T) {
 	s := newServer(t)
 	defer s.Close()
@@ -303,6 +362,41 @@ func TestDialTLS(t *testing.T) {
 	sendRecv(t, ws)
 }
 
+func TestDialTLSManager(t *testing.T) {
+	var s cstServer
+	s.Server = httptest.NewUnstartedServer(cstHandler{t})
+	s.Server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	s.Server.StartTLS()
+	s.Server.URL += cstRequestURI
+	s.URL = makeWsProto(s.Server.URL)
+	defer s.Close()
+
+	// Present the certificate of server, as the manager always does.
+	var serverName string
+	d := cstDialer
+	d.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	d.TLSManager = certificateManagerFunc(func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		serverName = clientHello.ServerName
+		return &s.TLS.Certificates[0], nil
+	})
+	ws, _, err := d.Dial(s.URL, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer ws.Close()
+	sendRecv(t, ws)
+
+	if serverName != "127.0.0.1" {
+		t.Errorf("serverName=%v, want 127.0.0.1", serverName)
+	}
+}
+
+type certificateManagerFunc func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error)
+
+func (f certificateManagerFunc) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return f(clientHello)
+}
+
 func xTestDialTLSBadCert(t *testing.T) {
 	// This test is deactivated because of noisy logging from the net/http package.
 	s := newTLSServer(t)
@@ -15,6 +15,7 @@ import (
 	"net"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 )
@@ -230,6 +231,8 @@ type Conn struct {
 	conn        net.Conn
 	isServer    bool
 	subprotocol string
+	info        *ConnInfo // metadata of server connection
+	stats       *connStats
 
 	// Write fields
 	mu            chan bool // used as mutex to protect write to conn
@@ -282,12 +285,15 @@ func newConnBRW(conn net.Conn, isServer bool, readBufferSize, writeBufferSize in
 	mu := make(chan bool, 1)
 	mu <- true
 
+	stats := &connStats{}
+	sr := &statsReader{r: conn, stats: stats}
+
 	var br *bufio.Reader
 	if readBufferSize == 0 && brw != nil && brw.Reader != nil {
 		// Reuse the supplied bufio.Reader if the buffer has a useful size.
 		// This code assumes that peek on a reader returns
 		// bufio.Reader.buf[:0].
-		brw.Reader.Reset(conn)
+		brw.Reader.Reset(sr)
 		if p, err := brw.Reader.Peek(0); err == nil && cap(p) >= 256 {
 			br = brw.Reader
 		}
@@ -299,7 +305,7 @@ func newConnBRW(conn net.Conn, isServer bool, readBufferSize, writeBufferSize in
 		if readBufferSize < maxControlFramePayloadSize {
 			readBufferSize = maxControlFramePayloadSize
 		}
-		br = bufio.NewReaderSize(conn, readBufferSize)
+		br = bufio.NewReaderSize(sr, readBufferSize)
 	}
 
 	var writeBuf []byte
@@ -327,6 +333,7 @@ func newConnBRW(conn net.Conn, isServer bool, readBufferSize, writeBufferSize in
 		isServer:               isServer,
 		br:                     br,
 		conn:                   conn,
+		stats:                  stats,
 		mu:                     mu,
 		readFinal:              true,
 		writeBuf:               writeBuf,
@@ -344,6 +351,12 @@ func (c *Conn) Subprotocol() string {
 	return c.subprotocol
 }
 
+// Info returns the metadata parsed from the upgrade request, or nil for the
+// client connection.
+func (c *Conn) Info() *ConnInfo {
+	return c.info
+}
+
 // Close closes the underlying network connection without sending or waiting for a close frame.
 func (c *Conn) Close() error {
 	return c.conn.Close()
@@ -385,7 +398,8 @@ func (c *Conn) write(frameType int, deadline time.Time, bufs ...[]byte) error {
 	c.conn.SetWriteDeadline(deadline)
 	for _, buf := range bufs {
 		if len(buf) > 0 {
-			_, err := c.conn.Write(buf)
+			n, err := c.conn.Write(buf)
+			atomic.AddUint64(&c.stats.bytesWritten, uint64(n))
 			if err != nil {
 				return c.writeFatal(err)
 			}
@@ -451,7 +465,8 @@ func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) er
 	}
 
 	c.conn.SetWriteDeadline(deadline)
-	_, err = c.conn.Write(buf)
+	n, err := c.conn.Write(buf)
+	atomic.AddUint64(&c.stats.bytesWritten, uint64(n))
 	if err != nil {
 		return c.writeFatal(err)
 	}
@@ -599,6 +614,9 @@ func (w *messageWriter) flushFrame(final bool, extra []byte) error {
 	}
 
 	if final {
+		if !isControl(w.frameType) {
+			atomic.AddUint64(&c.stats.messagesWritten, 1)
+		}
 		c.writer = nil
 		return nil
 	}
@@ -723,6 +741,9 @@ func (c *Conn) WritePreparedMessage(pm *PreparedMessage) error {
 		panic("concurrent write to websocket connection")
 	}
 	c.isWriting = false
+	if err == nil && isData(pm.messageType) {
+		atomic.AddUint64(&c.stats.messagesWritten, 1)
+	}
 	return err
 }
 
@@ -942,6 +963,7 @@ func (c *Conn) NextReader() (messageType int, r io.Reader, err error) {
 			break
 		}
 		if frameType == TextMessage || frameType == BinaryMessage {
+			atomic.AddUint64(&c.stats.messagesRead, 1)
 			c.messageReader = &messageReader{c}
 			c.reader = c.messageReader
 			if c.readDecompress {
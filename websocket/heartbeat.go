@@ -0,0 +1,197 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// HeartbeatPolicy specifies how to detect the dead connections.
+type HeartbeatPolicy struct {
+	// PingInterval specifies the interval to send ping to peers.
+	// If zero, 10 seconds is used.
+	PingInterval time.Duration
+
+	// PongTimeout specifies the duration to wait for pong, after the ping is
+	// sent. If zero, the PingInterval is used.
+	PongTimeout time.Duration
+
+	// CloseCode and CloseText specify the close message sent to dead peers.
+	// If zero, CloseGoingAway is used.
+	CloseCode int
+	CloseText string
+
+	// OnDead is called when the connection is reaped for dead, optional.
+	OnDead func(c *Conn)
+}
+
+func (p *HeartbeatPolicy) pingInterval() time.Duration {
+	if p.PingInterval > 0 {
+		return p.PingInterval
+	}
+	return 10 * time.Second
+}
+
+func (p *HeartbeatPolicy) pongTimeout() time.Duration {
+	if p.PongTimeout > 0 {
+		return p.PongTimeout
+	}
+	return p.pingInterval()
+}
+
+// HeartbeatRegistry sends ping to all the registered connections on one timer,
+// and reaps the connections which stop responding.
+//
+// The pong is only processed when application reads the connection, so the
+// application must keep reading the connection, see the section Control
+// Messages in the package document.
+type HeartbeatRegistry struct {
+	policy HeartbeatPolicy
+
+	mu     sync.Mutex
+	conns  map[*Conn]time.Time
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewHeartbeatRegistry creates a registry and starts the heartbeat goroutine,
+// user should Close it when not used.
+func NewHeartbeatRegistry(policy HeartbeatPolicy) *HeartbeatRegistry {
+	r := &HeartbeatRegistry{
+		policy: policy,
+		conns:  make(map[*Conn]time.Time),
+		closed: make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// Add registers the connection and hooks its pong handler. Because the pong
+// handler is set, Add must be called before the application reads the
+// connection.
+func (r *HeartbeatRegistry) Add(c *Conn) {
+	r.mu.Lock()
+	r.conns[c] = time.Now()
+	r.mu.Unlock()
+
+	h := c.PongHandler()
+	c.SetPongHandler(func(appData string) error {
+		r.Touch(c)
+		return h(appData)
+	})
+}
+
+// Remove unregisters the connection, for example, when connection is closed by
+// application.
+func (r *HeartbeatRegistry) Remove(c *Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, c)
+}
+
+// Touch marks the connection alive, application can call it when receives any
+// message from peer.
+func (r *HeartbeatRegistry) Touch(c *Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.conns[c]; ok {
+		r.conns[c] = time.Now()
+	}
+}
+
+// Len returns the number of registered connections.
+func (r *HeartbeatRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+// Close stops the heartbeat goroutine, the connections are not closed.
+func (r *HeartbeatRegistry) Close() error {
+	r.once.Do(func() {
+		close(r.closed)
+	})
+	return nil
+}
+
+func (r *HeartbeatRegistry) run() {
+	ticker := time.NewTicker(r.policy.pingInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.closed:
+			return
+		case now := <-ticker.C:
+			r.heartbeat(now)
+		}
+	}
+}
+
+func (r *HeartbeatRegistry) heartbeat(now time.Time) {
+	// The peer must response pong in the timeout after we send ping.
+	timeout := r.policy.pingInterval() + r.policy.pongTimeout()
+
+	var alive, dead []*Conn
+	r.mu.Lock()
+	for c, t := range r.conns {
+		if now.Sub(t) > timeout {
+			dead = append(dead, c)
+			delete(r.conns, c)
+		} else {
+			alive = append(alive, c)
+		}
+	}
+	r.mu.Unlock()
+
+	deadline := now.Add(r.policy.pongTimeout())
+	for _, c := range alive {
+		if err := c.WriteControl(PingMessage, nil, deadline); err != nil {
+			r.Remove(c)
+			dead = append(dead, c)
+		}
+	}
+
+	for _, c := range dead {
+		r.reap(c, deadline)
+	}
+}
+
+func (r *HeartbeatRegistry) reap(c *Conn, deadline time.Time) {
+	code, text := r.policy.CloseCode, r.policy.CloseText
+	if code == 0 {
+		code = CloseGoingAway
+	}
+	if text == "" {
+		text = "heartbeat timeout"
+	}
+
+	c.WriteControl(CloseMessage, FormatCloseMessage(code, text), deadline)
+	c.Close()
+
+	if r.policy.OnDead != nil {
+		r.policy.OnDead(c)
+	}
+}
@@ -0,0 +1,69 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package websocket
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatRegistry(t *testing.T) {
+	var dead *Conn
+	r := NewHeartbeatRegistry(HeartbeatPolicy{
+		PingInterval: time.Hour,
+		PongTimeout:  time.Hour,
+		OnDead:       func(c *Conn) { dead = c },
+	})
+	defer r.Close()
+
+	var b bytes.Buffer
+	c := newConn(fakeNetConn{Reader: nil, Writer: &b}, true, 1024, 1024)
+	r.Add(c)
+
+	// The connection is alive, should send ping.
+	now := time.Now()
+	r.heartbeat(now.Add(time.Hour))
+	if r.Len() != 1 || dead != nil {
+		t.Errorf("should be alive, len=%v", r.Len())
+	}
+	if p := b.Bytes(); len(p) == 0 || p[0]&0x0f != PingMessage {
+		t.Errorf("should send ping, %x", p)
+	}
+
+	// Got pong, the connection is alive.
+	r.Touch(c)
+	r.heartbeat(time.Now().Add(time.Hour))
+	if r.Len() != 1 || dead != nil {
+		t.Errorf("should be alive, len=%v", r.Len())
+	}
+
+	// No pong, the connection is dead.
+	b.Reset()
+	r.heartbeat(time.Now().Add(3 * time.Hour))
+	if r.Len() != 0 || dead != c {
+		t.Errorf("should be dead, len=%v", r.Len())
+	}
+	if p := b.Bytes(); len(p) == 0 || p[0]&0x0f != CloseMessage {
+		t.Errorf("should send close, %x", p)
+	}
+}
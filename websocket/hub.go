@@ -0,0 +1,303 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package websocket
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HubPolicy specifies how the hub sends messages to the connections.
+type HubPolicy struct {
+	// QueueSize specifies the number of messages queued for each connection.
+	// If zero, 64 is used.
+	QueueSize int
+
+	// WriteTimeout specifies the timeout to write a message to peer.
+	// If zero, 10 seconds is used.
+	WriteTimeout time.Duration
+
+	// CloseSlow specifies whether to close the slow connection when its queue
+	// is full, otherwise the message is dropped for the connection.
+	CloseSlow bool
+
+	// OnDrop is called when a message is dropped for the slow connection,
+	// optional.
+	OnDrop func(c *Conn, room string)
+
+	// OnRemove is called when the connection is removed from the hub for
+	// write failed or closed for slow, at most once for each join, optional.
+	OnRemove func(c *Conn, err error)
+}
+
+func (p *HubPolicy) queueSize() int {
+	if p.QueueSize > 0 {
+		return p.QueueSize
+	}
+	return 64
+}
+
+func (p *HubPolicy) writeTimeout() time.Duration {
+	if p.WriteTimeout > 0 {
+		return p.WriteTimeout
+	}
+	return 10 * time.Second
+}
+
+// hubClient is the connection joined to the hub, with a send queue.
+type hubClient struct {
+	conn    *Conn
+	rooms   map[string]bool
+	send    chan *PreparedMessage
+	done    chan struct{}
+	dropped uint64
+}
+
+// Hub manages the groups of connections, named rooms, for example, the chat,
+// danmaku and viewers of a live stream. Each connection has a send queue and a
+// writer goroutine, so the slow connection never blocks the broadcast.
+//
+// The hub only writes the connection, application must read the connection to
+// process the control messages, and remove it from the hub when closed.
+type Hub struct {
+	policy HubPolicy
+
+	mu      sync.Mutex
+	rooms   map[string]map[*hubClient]bool
+	clients map[*Conn]*hubClient
+}
+
+// NewHub creates a hub with the policy.
+func NewHub(policy HubPolicy) *Hub {
+	return &Hub{
+		policy:  policy,
+		rooms:   make(map[string]map[*hubClient]bool),
+		clients: make(map[*Conn]*hubClient),
+	}
+}
+
+// Join adds the connection to the room, the writer goroutine of connection is
+// started when it joins the first room.
+func (h *Hub) Join(room string, c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client, ok := h.clients[c]
+	if !ok {
+		client = &hubClient{
+			conn:  c,
+			rooms: make(map[string]bool),
+			send:  make(chan *PreparedMessage, h.policy.queueSize()),
+			done:  make(chan struct{}),
+		}
+		h.clients[c] = client
+		go h.writeLoop(client)
+	}
+
+	clients, ok := h.rooms[room]
+	if !ok {
+		clients = make(map[*hubClient]bool)
+		h.rooms[room] = clients
+	}
+
+	clients[client] = true
+	client.rooms[room] = true
+}
+
+// Leave removes the connection from the room, the writer goroutine is stopped
+// when it leaves all rooms.
+func (h *Hub) Leave(room string, c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client, ok := h.clients[c]
+	if !ok {
+		return
+	}
+
+	h.leave(room, client)
+	if len(client.rooms) == 0 {
+		h.remove(client)
+	}
+}
+
+// Remove removes the connection from all rooms, for example, when connection is
+// closed. The connection is not closed.
+func (h *Hub) Remove(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if client, ok := h.clients[c]; ok {
+		h.leaveAll(client)
+	}
+}
+
+// removeClient removes the client from all rooms, and returns false if it's
+// already removed, for example, the connection re-joins the hub as a new client
+// after removed, so the old client never removes the new one.
+func (h *Hub) removeClient(client *hubClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.clients[client.conn] != client {
+		return false
+	}
+
+	h.leaveAll(client)
+	return true
+}
+
+func (h *Hub) leaveAll(client *hubClient) {
+	for room := range client.rooms {
+		h.leave(room, client)
+	}
+	h.remove(client)
+}
+
+func (h *Hub) leave(room string, client *hubClient) {
+	delete(client.rooms, room)
+
+	if clients, ok := h.rooms[room]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+func (h *Hub) remove(client *hubClient) {
+	delete(h.clients, client.conn)
+	close(client.done)
+}
+
+// Broadcast sends the message to all connections in the room, the message is
+// prepared once for all connections. It never blocks, the message is dropped or
+// the connection is closed when the queue is full, see HubPolicy.
+func (h *Hub) Broadcast(room string, messageType int, data []byte) error {
+	pm, err := NewPreparedMessage(messageType, data)
+	if err != nil {
+		return err
+	}
+
+	return h.BroadcastPrepared(room, pm)
+}
+
+// BroadcastPrepared sends the prepared message to all connections in the room.
+func (h *Hub) BroadcastPrepared(room string, pm *PreparedMessage) error {
+	var slows []*hubClient
+
+	h.mu.Lock()
+	for client := range h.rooms[room] {
+		select {
+		case client.send <- pm:
+		default:
+			atomic.AddUint64(&client.dropped, 1)
+			slows = append(slows, client)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, client := range slows {
+		if h.policy.OnDrop != nil {
+			h.policy.OnDrop(client.conn, room)
+		}
+
+		if h.policy.CloseSlow && h.removeClient(client) {
+			client.conn.Close()
+
+			if h.policy.OnRemove != nil {
+				h.policy.OnRemove(client.conn, errHubSlow)
+			}
+		}
+	}
+
+	return nil
+}
+
+var errHubSlow = &netError{msg: "websocket: hub queue full for slow connection", timeout: true}
+
+// Len returns the number of connections in the room, for example, the number of
+// viewers of a live stream.
+func (h *Hub) Len(room string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.rooms[room])
+}
+
+// Rooms returns the sorted names of all rooms.
+func (h *Hub) Rooms() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rooms := make([]string, 0, len(h.rooms))
+	for room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// Dropped returns the number of messages dropped for the connection.
+func (h *Hub) Dropped(c *Conn) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if client, ok := h.clients[c]; ok {
+		return atomic.LoadUint64(&client.dropped)
+	}
+	return 0
+}
+
+// Close removes all connections from the hub, the connections are not closed.
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range h.clients {
+		h.remove(client)
+	}
+	h.rooms = make(map[string]map[*hubClient]bool)
+	return nil
+}
+
+func (h *Hub) writeLoop(client *hubClient) {
+	for {
+		select {
+		case <-client.done:
+			return
+		case pm := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(h.policy.writeTimeout()))
+			if err := client.conn.WritePreparedMessage(pm); err != nil {
+				if !h.removeClient(client) {
+					return
+				}
+
+				if h.policy.OnRemove != nil {
+					h.policy.OnRemove(client.conn, err)
+				}
+				return
+			}
+		}
+	}
+}
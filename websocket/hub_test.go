@@ -0,0 +1,145 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package websocket
+
+import (
+	"io"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countWriter struct {
+	n int32
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	atomic.AddInt32(&w.n, 1)
+	return len(p), nil
+}
+
+type blockWriter chan struct{}
+
+func (w blockWriter) Write(p []byte) (int, error) {
+	<-w
+	return len(p), nil
+}
+
+type failWriter chan struct{}
+
+func (w failWriter) Write(p []byte) (int, error) {
+	<-w
+	return 0, io.ErrClosedPipe
+}
+
+func TestHub_Rejoin(t *testing.T) {
+	var removes int32
+	h := NewHub(HubPolicy{CloseSlow: true, OnRemove: func(c *Conn, err error) {
+		atomic.AddInt32(&removes, 1)
+	}})
+	defer h.Close()
+
+	fw := make(failWriter)
+	c := newConn(fakeNetConn{Reader: nil, Writer: fw}, true, 1024, 1024)
+
+	// The old client blocks in writing, then the connection re-joins as a new client.
+	h.Join("live", c)
+	h.Broadcast("live", TextMessage, []byte("hello"))
+	time.Sleep(10 * time.Millisecond)
+	h.Remove(c)
+	h.Join("live", c)
+
+	// The write of old client fails, which should never remove the new client.
+	close(fw)
+	time.Sleep(50 * time.Millisecond)
+	if n := h.Len("live"); n != 1 || atomic.LoadInt32(&removes) != 0 {
+		t.Errorf("new client should not be removed, len=%v, removes=%v", n, removes)
+	}
+}
+
+func TestHub(t *testing.T) {
+	var drops int32
+	h := NewHub(HubPolicy{QueueSize: 1, OnDrop: func(c *Conn, room string) {
+		atomic.AddInt32(&drops, 1)
+	}})
+	defer h.Close()
+
+	fw, sw := &countWriter{}, make(blockWriter)
+	defer close(sw)
+
+	fast := newConn(fakeNetConn{Reader: nil, Writer: fw}, true, 1024, 1024)
+	slow := newConn(fakeNetConn{Reader: nil, Writer: sw}, true, 1024, 1024)
+
+	h.Join("live", fast)
+	h.Join("live", slow)
+	h.Join("chat", fast)
+	if n := h.Len("live"); n != 2 {
+		t.Errorf("expect 2 viewers, got %v", n)
+	}
+	if rooms := h.Rooms(); !reflect.DeepEqual(rooms, []string{"chat", "live"}) {
+		t.Errorf("invalid rooms %v", rooms)
+	}
+
+	// The slow connection blocks in writing one message, queue another, drop others.
+	for i := 0; i < 4; i++ {
+		if err := h.Broadcast("live", TextMessage, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 100 && atomic.LoadInt32(&fw.n) <= int32(i); j++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if n := atomic.LoadInt32(&fw.n); n != 4 || h.Dropped(fast) != 0 {
+		t.Errorf("fast should got all messages, got %v", n)
+	}
+	if n := h.Dropped(slow); n < 2 || int32(n) != atomic.LoadInt32(&drops) {
+		t.Errorf("slow should drop, dropped=%v, drops=%v", n, drops)
+	}
+
+	h.Leave("live", slow)
+	h.Remove(fast)
+	if n, rooms := h.Len("live"), h.Rooms(); n != 0 || len(rooms) != 0 {
+		t.Errorf("should be empty, len=%v, rooms=%v", n, rooms)
+	}
+}
+
+func TestHub_CloseSlow(t *testing.T) {
+	var removed *Conn
+	h := NewHub(HubPolicy{QueueSize: 1, CloseSlow: true, OnRemove: func(c *Conn, err error) {
+		removed = c
+	}})
+	defer h.Close()
+
+	sw := make(blockWriter)
+	defer close(sw)
+
+	slow := newConn(fakeNetConn{Reader: nil, Writer: sw}, true, 1024, 1024)
+	h.Join("live", slow)
+
+	for i := 0; i < 3; i++ {
+		h.Broadcast("live", TextMessage, []byte("hello"))
+	}
+	if removed != slow || h.Len("live") != 0 {
+		t.Errorf("slow should be removed, len=%v", h.Len("live"))
+	}
+}
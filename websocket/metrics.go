@@ -0,0 +1,236 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package websocket
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ConnStats is the counters of a connection, where the bytes are the frames on
+// the wire, including headers, and the messages are the text and binary
+// messages, excluding control messages.
+type ConnStats struct {
+	BytesRead, BytesWritten       uint64
+	MessagesRead, MessagesWritten uint64
+}
+
+func (s *ConnStats) add(o ConnStats) {
+	s.BytesRead += o.BytesRead
+	s.BytesWritten += o.BytesWritten
+	s.MessagesRead += o.MessagesRead
+	s.MessagesWritten += o.MessagesWritten
+}
+
+// connStats is the counters updated atomically by the connection.
+type connStats struct {
+	bytesRead, bytesWritten       uint64
+	messagesRead, messagesWritten uint64
+}
+
+// statsReader counts the bytes read from the network connection.
+type statsReader struct {
+	r     io.Reader
+	stats *connStats
+}
+
+func (r *statsReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddUint64(&r.stats.bytesRead, uint64(n))
+	return n, err
+}
+
+// Stats returns the counters of the connection, which is safe to call
+// concurrently with reads and writes.
+func (c *Conn) Stats() ConnStats {
+	return ConnStats{
+		BytesRead:       atomic.LoadUint64(&c.stats.bytesRead),
+		BytesWritten:    atomic.LoadUint64(&c.stats.bytesWritten),
+		MessagesRead:    atomic.LoadUint64(&c.stats.messagesRead),
+		MessagesWritten: atomic.LoadUint64(&c.stats.messagesWritten),
+	}
+}
+
+// Metrics is the registry of connections grouped by endpoint, which writes the
+// counters in the Prometheus text format. It implements the Collector of the
+// oryx http package, so it's exported by the same registry as the REST api:
+//
+//	m := ohttp.NewMetrics()
+//	wm := websocket.NewMetrics()
+//	m.Register(wm)
+//
+// The counters of closed connections are accumulated to the endpoint, so the
+// totals never go backwards.
+type Metrics struct {
+	lock      sync.Mutex
+	endpoints map[string]*endpointMetrics
+}
+
+type endpointMetrics struct {
+	conns  map[*Conn]bool
+	closed ConnStats
+}
+
+// NewMetrics returns an empty registry.
+func NewMetrics() *Metrics {
+	return &Metrics{endpoints: make(map[string]*endpointMetrics)}
+}
+
+// Add registers the connection of endpoint, where the endpoint should be the
+// pattern rather than the url, to keep the number of series small.
+func (m *Metrics) Add(endpoint string, c *Conn) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	e, ok := m.endpoints[endpoint]
+	if !ok {
+		e = &endpointMetrics{conns: make(map[*Conn]bool)}
+		m.endpoints[endpoint] = e
+	}
+	e.conns[c] = true
+}
+
+// Remove unregisters the connection of endpoint, and accumulates its counters.
+func (m *Metrics) Remove(endpoint string, c *Conn) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e, ok := m.endpoints[endpoint]; ok && e.conns[c] {
+		delete(e.conns, c)
+		e.closed.add(c.Stats())
+	}
+}
+
+// Len returns the number of active connections of endpoint.
+func (m *Metrics) Len(endpoint string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e, ok := m.endpoints[endpoint]; ok {
+		return len(e.conns)
+	}
+	return 0
+}
+
+// Stats returns the counters of endpoint, of both active and closed connections.
+func (m *Metrics) Stats(endpoint string) ConnStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.stats(endpoint)
+}
+
+func (m *Metrics) stats(endpoint string) ConnStats {
+	var s ConnStats
+	if e, ok := m.endpoints[endpoint]; ok {
+		s = e.closed
+		for c := range e.conns {
+			s.add(c.Stats())
+		}
+	}
+	return s
+}
+
+// WriteMetrics writes the counters of all endpoints in the Prometheus text
+// format, sorted by endpoint.
+func (m *Metrics) WriteMetrics(w io.Writer) error {
+	type sample struct {
+		endpoint string
+		conns    int
+		stats    ConnStats
+	}
+
+	var samples []sample
+	func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		endpoints := make([]string, 0, len(m.endpoints))
+		for endpoint := range m.endpoints {
+			endpoints = append(endpoints, endpoint)
+		}
+		sort.Strings(endpoints)
+
+		for _, endpoint := range endpoints {
+			samples = append(samples, sample{endpoint, len(m.endpoints[endpoint].conns), m.stats(endpoint)})
+		}
+	}()
+
+	var err error
+	printf := func(format string, a ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, a...)
+		}
+	}
+
+	printf("# HELP websocket_connections The number of active connections by endpoint.\n")
+	printf("# TYPE websocket_connections gauge\n")
+	for _, s := range samples {
+		printf("websocket_connections{path=%q} %v\n", s.endpoint, s.conns)
+	}
+
+	printf("# HELP websocket_bytes_total The total bytes of frames by endpoint and direction.\n")
+	printf("# TYPE websocket_bytes_total counter\n")
+	for _, s := range samples {
+		printf("websocket_bytes_total{path=%q,direction=\"in\"} %v\n", s.endpoint, s.stats.BytesRead)
+		printf("websocket_bytes_total{path=%q,direction=\"out\"} %v\n", s.endpoint, s.stats.BytesWritten)
+	}
+
+	printf("# HELP websocket_messages_total The total data messages by endpoint and direction.\n")
+	printf("# TYPE websocket_messages_total counter\n")
+	for _, s := range samples {
+		printf("websocket_messages_total{path=%q,direction=\"in\"} %v\n", s.endpoint, s.stats.MessagesRead)
+		printf("websocket_messages_total{path=%q,direction=\"out\"} %v\n", s.endpoint, s.stats.MessagesWritten)
+	}
+
+	return err
+}
+
+// Handler returns an http.Handler which upgrades the request and serves the
+// connection by handler, so the endpoint composes with the http middlewares,
+// for example, the auth, logging and rate limit of the oryx http package. The
+// connection is closed when handler returns.
+//
+// If Metrics is not nil, the connection is registered under endpoint during
+// handler is running. The middlewares must keep the http.Hijacker of the
+// response writer.
+func (u *Upgrader) Handler(endpoint string, handler func(c *Conn)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := u.Upgrade(w, r, nil)
+		if err != nil {
+			// The error response is already written by Upgrade.
+			return
+		}
+		defer c.Close()
+
+		if u.Metrics != nil {
+			u.Metrics.Add(endpoint, c)
+			defer u.Metrics.Remove(endpoint, c)
+		}
+
+		handler(c)
+	})
+}
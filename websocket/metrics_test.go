@@ -0,0 +1,125 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2013-2017 Oryx(ossrs)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package websocket
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpgrader_HandlerMetrics(t *testing.T) {
+	m := NewMetrics()
+	u := Upgrader{Metrics: m}
+
+	done := make(chan bool, 1)
+	s := httptest.NewServer(u.Handler("/ws", func(c *Conn) {
+		defer func() { done <- true }()
+		for {
+			mt, p, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(mt, p); err != nil {
+				return
+			}
+		}
+	}))
+	defer s.Close()
+
+	ws, _, err := DefaultDialer.Dial(makeWsProto(s.URL), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []string{"hello", "world"} {
+		if err := ws.WriteMessage(TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if _, p, err := ws.ReadMessage(); err != nil || string(p) != msg {
+			t.Fatalf("echo %v, %v", string(p), err)
+		}
+	}
+
+	if n := m.Len("/ws"); n != 1 {
+		t.Errorf("conns %v", n)
+	}
+	if s := ws.Stats(); s.MessagesRead != 2 || s.MessagesWritten != 2 || s.BytesRead != 14 || s.BytesWritten != 22 {
+		t.Errorf("client stats %+v", s)
+	}
+
+	ws.Close()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// The handler returns before the connection is removed.
+	for i := 0; i < 100 && m.Len("/ws") != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := m.Len("/ws"); n != 0 {
+		t.Errorf("conns %v", n)
+	}
+	if s := m.Stats("/ws"); s.MessagesRead != 2 || s.MessagesWritten != 2 || s.BytesRead != 22 || s.BytesWritten != 14 {
+		t.Errorf("server stats %+v", s)
+	}
+
+	var b bytes.Buffer
+	if err := m.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`websocket_connections{path="/ws"} 0`,
+		`websocket_bytes_total{path="/ws",direction="in"} 22`,
+		`websocket_bytes_total{path="/ws",direction="out"} 14`,
+		`websocket_messages_total{path="/ws",direction="in"} 2`,
+		`websocket_messages_total{path="/ws",direction="out"} 2`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("no %v in %v", line, b.String())
+		}
+	}
+}
+
+func TestUpgrader_HandlerRejected(t *testing.T) {
+	m := NewMetrics()
+	u := Upgrader{Metrics: m, Authenticate: func(info *ConnInfo) error {
+		return &AuthError{Status: 403, Reason: "invalid token"}
+	}}
+
+	s := httptest.NewServer(u.Handler("/ws", func(c *Conn) {
+		t.Error("should not serve")
+	}))
+	defer s.Close()
+
+	if _, resp, err := DefaultDialer.Dial(makeWsProto(s.URL), nil); err == nil || resp == nil || resp.StatusCode != 403 {
+		t.Errorf("should reject, %v", err)
+	}
+	if n := m.Len("/ws"); n != 0 {
+		t.Errorf("conns %v", n)
+	}
+}
@@ -80,6 +80,7 @@ func (pm *PreparedMessage) frame(key prepareKey) (int, []byte, error) {
 		var nc prepareConn
 		c := &Conn{
 			conn:                   &nc,
+			stats:                  &connStats{},
 			mu:                     mu,
 			isServer:               key.isServer,
 			compressionLevel:       key.compressionLevel,
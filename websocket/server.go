@@ -54,8 +54,85 @@ type Upgrader struct {
 	// guarantee that compression will be supported. Currently only "no context
 	// takeover" modes are supported.
 	EnableCompression bool
+
+	// Authenticate is called with the connection metadata before the handshake
+	// is completed. If Authenticate returns an error, then the handshake is
+	// rejected with the status of AuthError, or 401 for other errors. If
+	// Authenticate is nil, all connections are accepted.
+	Authenticate func(info *ConnInfo) error
+
+	// Metrics specifies the registry of connections served by Handler. If
+	// Metrics is nil, the connections are not registered.
+	Metrics *Metrics
+}
+
+// ConnInfo is the metadata of a server connection, parsed from the upgrade
+// request, for example:
+//
+//	ws://ossrs.net/live/livestream.flv?token=xxx&clientId=yyy
+type ConnInfo struct {
+	// Token is the token query parameter, or the bearer token in the
+	// Authorization header.
+	Token string
+
+	// Stream is the stream query parameter, or the last element of path
+	// without extension, for example, livestream.
+	Stream string
+
+	// ClientID is the clientId query parameter, or the X-Client-Id header.
+	ClientID string
+
+	// RemoteAddr is the network address of client.
+	RemoteAddr string
+
+	// Query and Header are the query parameters and headers of the upgrade
+	// request.
+	Query  url.Values
+	Header http.Header
+}
+
+// NewConnInfo parses the metadata from the upgrade request.
+func NewConnInfo(r *http.Request) *ConnInfo {
+	q := r.URL.Query()
+	info := &ConnInfo{
+		Token:      q.Get("token"),
+		Stream:     q.Get("stream"),
+		ClientID:   q.Get("clientId"),
+		RemoteAddr: r.RemoteAddr,
+		Query:      q,
+		Header:     r.Header,
+	}
+
+	if info.Token == "" {
+		if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			info.Token = strings.TrimSpace(auth[7:])
+		}
+	}
+
+	if info.Stream == "" {
+		stream := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if pos := strings.Index(stream, "."); pos >= 0 {
+			stream = stream[:pos]
+		}
+		info.Stream = stream
+	}
+
+	if info.ClientID == "" {
+		info.ClientID = r.Header.Get("X-Client-Id")
+	}
+
+	return info
+}
+
+// AuthError is returned by Upgrader.Authenticate to reject the handshake with
+// the status, for example, 403 for invalid token.
+type AuthError struct {
+	Status int
+	Reason string
 }
 
+func (e *AuthError) Error() string { return e.Reason }
+
 func (u *Upgrader) returnError(w http.ResponseWriter, r *http.Request, status int, reason string) (*Conn, error) {
 	err := HandshakeError{reason}
 	if u.Error != nil {
@@ -138,6 +215,17 @@ func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeade
 		return u.returnError(w, r, http.StatusBadRequest, "websocket: not a websocket handshake: `Sec-Websocket-Key' header is missing or blank")
 	}
 
+	info := NewConnInfo(r)
+	if u.Authenticate != nil {
+		if err := u.Authenticate(info); err != nil {
+			status := http.StatusUnauthorized
+			if ae, ok := err.(*AuthError); ok && ae.Status != 0 {
+				status = ae.Status
+			}
+			return u.returnError(w, r, status, "websocket: authenticate failed: "+err.Error())
+		}
+	}
+
 	subprotocol := u.selectSubprotocol(r, responseHeader)
 
 	// Negotiate PMCE
@@ -174,6 +262,7 @@ func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeade
 
 	c := newConnBRW(netConn, true, u.ReadBufferSize, u.WriteBufferSize, brw)
 	c.subprotocol = subprotocol
+	c.info = info
 
 	if compress {
 		c.newCompressionWriter = compressNoContextTakeover
@@ -6,7 +6,9 @@
 package websocket
 
 import (
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 )
@@ -50,3 +52,80 @@ func TestIsWebSocketUpgrade(t *testing.T) {
 		}
 	}
 }
+
+var connInfoTests = []struct {
+	url      string
+	h        http.Header
+	token    string
+	stream   string
+	clientID string
+}{
+	{"/live/livestream.flv?token=abc&clientId=c0", nil, "abc", "livestream", "c0"},
+	{"/ws?stream=livestream", http.Header{"Authorization": {"Bearer xyz"}, "X-Client-Id": {"c1"}}, "xyz", "livestream", "c1"},
+	{"/live/", http.Header{"Authorization": {"Basic xyz"}}, "", "", ""},
+}
+
+func TestConnInfo(t *testing.T) {
+	for _, tt := range connInfoTests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		for k, vs := range tt.h {
+			r.Header[k] = vs
+		}
+
+		info := NewConnInfo(r)
+		if info.Token != tt.token || info.Stream != tt.stream || info.ClientID != tt.clientID {
+			t.Errorf("NewConnInfo(%v) returned %+v", tt.url, info)
+		}
+	}
+}
+
+func TestUpgradeAuthenticate(t *testing.T) {
+	u := Upgrader{Authenticate: func(info *ConnInfo) error {
+		if info.Token == "" {
+			return errors.New("no token")
+		}
+		if info.Token != "abc" {
+			return &AuthError{Status: http.StatusForbidden, Reason: "invalid token"}
+		}
+		return nil
+	}}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := u.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		ws.WriteMessage(TextMessage, []byte(ws.Info().Stream))
+	}))
+	defer s.Close()
+
+	for _, tt := range []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusUnauthorized}, {"?token=xyz", http.StatusForbidden},
+	} {
+		ws, resp, err := DefaultDialer.Dial(makeWsProto(s.URL)+"/live/livestream"+tt.query, nil)
+		if err == nil {
+			ws.Close()
+			t.Errorf("Dial %v succeeded, expect fail", tt.query)
+		} else if resp == nil || resp.StatusCode != tt.status {
+			t.Errorf("Dial %v resp=%v, want %v", tt.query, resp, tt.status)
+		}
+	}
+
+	ws, _, err := DefaultDialer.Dial(makeWsProto(s.URL)+"/live/livestream?token=abc", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer ws.Close()
+
+	if _, p, err := ws.ReadMessage(); err != nil || string(p) != "livestream" {
+		t.Errorf("ReadMessage returned %v, %v", string(p), err)
+	}
+	if ws.Info() != nil {
+		t.Errorf("client Info() = %v, want nil", ws.Info())
+	}
+}